@@ -10,7 +10,6 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	_ "net/http/pprof" // http profile handlers
 	"os"
@@ -20,19 +19,24 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ortuman/jackal/audit"
 	"github.com/ortuman/jackal/c2s"
+	"github.com/ortuman/jackal/cluster"
 	"github.com/ortuman/jackal/component"
+	"github.com/ortuman/jackal/listener"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/s2s"
 	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/trace"
 	"github.com/ortuman/jackal/version"
 	"github.com/pkg/errors"
 )
 
 const (
 	defaultShutDownWaitTime = time.Duration(5) * time.Second
+	defaultHandoffTimeout   = time.Duration(30) * time.Second
 )
 
 var logoStr = []string{
@@ -49,6 +53,14 @@ Usage: jackal [options]
 
 Server Options:
     -c, --Config <file>    Configuration file path
+Data Options:
+    --export <file>        Export accounts data to a XEP-0227 file
+    --user <jid>           Export a single account
+    --domain <domain>      Export accounts under a given domain
+    --import <file>        Import accounts data from a XEP-0227 file
+    --copy-to <file>       Copy accounts data to the storage configured in file
+    --restore <path>       Restore BadgerDB data dir from a backup file or dir
+    --verify-backup <file> Verify BadgerDB backup file integrity
 Common Options:
     -h, --help             Show this message
     -v, --version          Show version
@@ -57,17 +69,17 @@ Common Options:
 var initLogger = func(config *loggerConfig, output io.Writer) (log.Logger, error) {
 	var logFiles []io.WriteCloser
 	if len(config.LogPath) > 0 {
-		// create logFile intermediate directories.
-		if err := os.MkdirAll(filepath.Dir(config.LogPath), os.ModePerm); err != nil {
-			return nil, err
-		}
-		f, err := os.OpenFile(config.LogPath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+		f, err := log.OpenFile(config.LogPath, log.RotationConfig{
+			MaxSize:    int64(config.MaxSize) * 1024 * 1024,
+			Interval:   time.Duration(config.RotateInterval) * time.Second,
+			MaxBackups: config.MaxBackups,
+		})
 		if err != nil {
 			return nil, err
 		}
 		logFiles = append(logFiles, f)
 	}
-	logger, err := log.New(config.Level, output, logFiles...)
+	logger, err := log.New(config.Level, config.Format, output, logFiles...)
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +97,9 @@ type Application struct {
 	logger           log.Logger
 	storage          storage.Storage
 	router           *router.Router
+	cluster          *cluster.Cluster
+	tracer           *trace.Tracer
+	auditor          *audit.Auditor
 	mods             *module.Modules
 	comps            *component.Components
 	s2s              *s2s.S2S
@@ -110,6 +125,7 @@ func (a *Application) Run() error {
 	}
 	var configFile string
 	var showVersion, showUsage bool
+	var dataCmd dataCommand
 
 	fs := flag.NewFlagSet("jackal", flag.ExitOnError)
 	fs.SetOutput(a.output)
@@ -120,6 +136,13 @@ func (a *Application) Run() error {
 	fs.BoolVar(&showVersion, "v", false, "Print version information.")
 	fs.StringVar(&configFile, "config", "/etc/jackal/jackal.yml", "Configuration file path.")
 	fs.StringVar(&configFile, "c", "/etc/jackal/jackal.yml", "Configuration file path.")
+	fs.StringVar(&dataCmd.exportPath, "export", "", "Export accounts data to a XEP-0227 file.")
+	fs.StringVar(&dataCmd.user, "user", "", "Export a single account.")
+	fs.StringVar(&dataCmd.domain, "domain", "", "Export accounts under a given domain.")
+	fs.StringVar(&dataCmd.importPath, "import", "", "Import accounts data from a XEP-0227 file.")
+	fs.StringVar(&dataCmd.copyTo, "copy-to", "", "Copy accounts data to the storage configured in file.")
+	fs.StringVar(&dataCmd.restorePath, "restore", "", "Restore BadgerDB data dir from a backup file or dir.")
+	fs.StringVar(&dataCmd.verifyPath, "verify-backup", "", "Verify BadgerDB backup file integrity.")
 	fs.Usage = func() {
 		for i := range logoStr {
 			fmt.Fprintf(a.output, "%s\n", logoStr[i])
@@ -144,10 +167,17 @@ func (a *Application) Run() error {
 	if err != nil {
 		return err
 	}
+	// run data portability command
+	if dataCmd.isSet() {
+		return a.runDataCommand(&dataCmd, &cfg)
+	}
 	// create PID file
 	if err := a.createPIDFile(cfg.PIDFile); err != nil {
 		return err
 	}
+	if cfg.ShutdownWaitTime > 0 {
+		a.shutDownWaitSecs = time.Duration(cfg.ShutdownWaitTime) * time.Second
+	}
 
 	// initialize logger
 	a.logger, err = initLogger(&cfg.Logger, a.output)
@@ -155,6 +185,7 @@ func (a *Application) Run() error {
 		return err
 	}
 	log.Set(a.logger)
+	go a.reopenLogOnSignal()
 
 	// initialize storage
 	a.storage, err = initStorage(&cfg.Storage)
@@ -162,15 +193,43 @@ func (a *Application) Run() error {
 		return err
 	}
 	storage.Set(a.storage)
+	storage.SetCallTimeout(cfg.Storage.Timeout)
+
+	// initialize audit log
+	if cfg.Audit != nil {
+		a.auditor, err = audit.New(cfg.Audit)
+		if err != nil {
+			return err
+		}
+		audit.Set(a.auditor)
+	}
 
 	a.printLogo()
 
+	// initialize stanza tracer
+	if cfg.Trace != nil {
+		a.tracer, err = trace.New(cfg.Trace)
+		if err != nil {
+			return err
+		}
+		trace.Set(a.tracer)
+	}
+
 	// initialize router
 	a.router, err = router.New(&cfg.Router)
 	if err != nil {
 		return err
 	}
 
+	// join cluster...
+	if cfg.Cluster != nil {
+		a.cluster = cluster.New(cfg.Cluster)
+		if err := a.cluster.Start(); err != nil {
+			return err
+		}
+		a.router.SetCluster(a.cluster)
+	}
+
 	// initialize modules & components...
 	a.mods = module.New(&cfg.Modules, a.router)
 	a.comps = component.New(&cfg.Components, a.mods.DiscoInfo)
@@ -197,7 +256,22 @@ func (a *Application) Run() error {
 			return err
 		}
 	}
-	a.waitForStopSignal()
+	// every listener has been claimed at this point
+	listener.CloseUnclaimed()
+
+	// notify parent process in case listeners were handed off
+	if err := listener.NotifyReady(); err != nil {
+		log.Error(err)
+	}
+	for a.waitForStopSignal() == syscall.SIGUSR2 {
+		// restart handing off listeners to a new process
+		log.Infof("received restart signal... handing off listeners...")
+		if err := listener.Handoff(a.args, defaultHandoffTimeout); err != nil {
+			log.Error(err)
+			continue
+		}
+		break
+	}
 
 	// shutdown gracefully
 	if err := a.gracefullyShutdown(); err != nil {
@@ -239,8 +313,15 @@ func (a *Application) printLogo() {
 }
 
 func (a *Application) initDebugServer(port int) error {
-	a.debugSrv = &http.Server{}
-	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	mux := http.NewServeMux()
+	mux.Handle("/", http.DefaultServeMux) // http profile handlers
+	if a.tracer != nil && a.tracer.Live() {
+		mux.HandleFunc("/debug/trace", a.serveTrace)
+	}
+	mux.HandleFunc("/debug/backup", a.serveBackup)
+	mux.HandleFunc("/debug/cache", serveCacheStats)
+	a.debugSrv = &http.Server{Handler: mux}
+	ln, err := listener.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return err
 	}
@@ -249,9 +330,25 @@ func (a *Application) initDebugServer(port int) error {
 	return nil
 }
 
-func (a *Application) waitForStopSignal() {
-	signal.Notify(a.waitStopCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
-	<-a.waitStopCh
+func (a *Application) waitForStopSignal() os.Signal {
+	signal.Notify(a.waitStopCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2)
+	return <-a.waitStopCh
+}
+
+func (a *Application) reopenLogOnSignal() {
+	reopenCh := make(chan os.Signal, 1)
+	signal.Notify(reopenCh, syscall.SIGUSR1)
+	for range reopenCh {
+		if err := log.Reopen(); err != nil {
+			log.Error(err)
+			continue
+		}
+		if err := audit.Reopen(); err != nil {
+			log.Error(err)
+			continue
+		}
+		log.Infof("log files reopened")
+	}
 }
 
 func (a *Application) gracefullyShutdown() error {
@@ -272,16 +369,34 @@ func (a *Application) gracefullyShutdown() error {
 func (a *Application) shutdown(ctx context.Context) <-chan bool {
 	c := make(chan bool, 1)
 	go func() {
-		if a.debugSrv != nil {
-			a.debugSrv.Shutdown(ctx)
-		}
+		// stop accepting new connections...
+		listener.CloseAll()
+
+		// abort pending storage operations if graceful shutdown times out
+		stopCancelCalls := context.AfterFunc(ctx, storage.CancelCalls)
+
 		a.c2s.Shutdown(ctx)
+		if a.cluster != nil {
+			a.cluster.Shutdown(ctx)
+		}
 		if a.s2s.Enabled() {
 			a.s2s.Shutdown(ctx)
 		}
 		a.comps.Shutdown(ctx)
 		a.mods.Shutdown(ctx)
 
+		if a.tracer != nil {
+			trace.Unset()
+			a.tracer.Close()
+		}
+		if a.debugSrv != nil {
+			a.debugSrv.Shutdown(ctx)
+		}
+		if a.auditor != nil {
+			audit.Unset()
+			a.auditor.Close()
+		}
+		stopCancelCalls()
 		storage.Unset()
 		log.Unset()
 		c <- true
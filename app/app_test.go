@@ -83,6 +83,23 @@ func TestApplication_Run(t *testing.T) {
 	os.Remove("test.jackal.log")
 }
 
+func TestApplication_ExportData(t *testing.T) {
+	w := newWriterBuffer()
+	args := []string{"./jackal", "--config=../testdata/config_basic.yml", "--export=test.export.xml"}
+	err := New(w, args).Run()
+	require.Nil(t, err)
+	require.Equal(t, "exported 0 account(s) to test.export.xml\n", w.String())
+
+	_, err = os.Stat("test.export.xml")
+	require.False(t, os.IsNotExist(err))
+	os.Remove("test.export.xml")
+	os.Remove("test.jackal.log")
+
+	// no pid file should be created
+	_, err = os.Stat("test.jackal.pid")
+	require.True(t, os.IsNotExist(err))
+}
+
 func expectedUsageString() string {
 	var r string
 	for i := range logoStr {
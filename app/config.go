@@ -9,12 +9,15 @@ import (
 	"bytes"
 	"io/ioutil"
 
+	"github.com/ortuman/jackal/audit"
 	"github.com/ortuman/jackal/c2s"
+	"github.com/ortuman/jackal/cluster"
 	"github.com/ortuman/jackal/component"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/s2s"
 	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/trace"
 	"gopkg.in/yaml.v2"
 )
 
@@ -24,21 +27,29 @@ type debugConfig struct {
 }
 
 type loggerConfig struct {
-	Level   string `yaml:"level"`
-	LogPath string `yaml:"log_path"`
+	Level          string `yaml:"level"`
+	Format         string `yaml:"format"`
+	LogPath        string `yaml:"log_path"`
+	MaxSize        int    `yaml:"max_size"`        // megabytes
+	RotateInterval int    `yaml:"rotate_interval"` // seconds
+	MaxBackups     int    `yaml:"max_backups"`
 }
 
 // Config represents a global configuration.
 type Config struct {
-	PIDFile    string           `yaml:"pid_path"`
-	Debug      debugConfig      `yaml:"debug"`
-	Logger     loggerConfig     `yaml:"logger"`
-	Storage    storage.Config   `yaml:"storage"`
-	Router     router.Config    `yaml:"router"`
-	Modules    module.Config    `yaml:"modules"`
-	Components component.Config `yaml:"components"`
-	C2S        []c2s.Config     `yaml:"c2s"`
-	S2S        *s2s.Config      `yaml:"s2s"`
+	PIDFile          string           `yaml:"pid_path"`
+	ShutdownWaitTime int              `yaml:"shutdown_wait_time"`
+	Debug            debugConfig      `yaml:"debug"`
+	Logger           loggerConfig     `yaml:"logger"`
+	Storage          storage.Config   `yaml:"storage"`
+	Router           router.Config    `yaml:"router"`
+	Cluster          *cluster.Config  `yaml:"cluster"`
+	Trace            *trace.Config    `yaml:"trace"`
+	Audit            *audit.Config    `yaml:"audit"`
+	Modules          module.Config    `yaml:"modules"`
+	Components       component.Config `yaml:"components"`
+	C2S              []c2s.Config     `yaml:"c2s"`
+	S2S              *s2s.Config      `yaml:"s2s"`
 }
 
 // FromFile loads default global configuration from
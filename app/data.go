@@ -0,0 +1,291 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/pie"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/badgerdb"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const defaultDataDomain = "localhost"
+
+// dataCommand represents an account data portability or backup command line request.
+type dataCommand struct {
+	exportPath  string
+	importPath  string
+	copyTo      string
+	user        string
+	domain      string
+	restorePath string
+	verifyPath  string
+}
+
+func (c *dataCommand) isSet() bool {
+	return len(c.exportPath) > 0 || len(c.importPath) > 0 || len(c.copyTo) > 0 ||
+		len(c.restorePath) > 0 || len(c.verifyPath) > 0
+}
+
+func (a *Application) runDataCommand(cmd *dataCommand, cfg *Config) error {
+	// backup commands operate offline
+	switch {
+	case len(cmd.restorePath) > 0:
+		return a.restoreBackup(cmd, cfg)
+	case len(cmd.verifyPath) > 0:
+		return a.verifyBackup(cmd)
+	}
+	s, err := initStorage(&cfg.Storage)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	switch {
+	case len(cmd.exportPath) > 0:
+		return a.exportData(s, cmd, cfg)
+	case len(cmd.importPath) > 0:
+		return a.importData(s, cmd)
+	default:
+		return a.copyData(s, cmd)
+	}
+}
+
+func (a *Application) exportData(s storage.Storage, cmd *dataCommand, cfg *Config) error {
+	domain := cmd.domain
+	var usernames []string
+	if len(cmd.user) > 0 {
+		j, err := jid.NewWithString(cmd.user, false)
+		if err != nil {
+			return err
+		}
+		if len(j.Node()) == 0 {
+			return fmt.Errorf("invalid user jid: %s", cmd.user)
+		}
+		domain = j.Domain()
+		usernames = append(usernames, j.Node())
+	}
+	if len(domain) == 0 {
+		// accounts are shared among every configured host
+		domain = defaultDataDomain
+		if len(cfg.Router.Hosts) > 0 {
+			domain = cfg.Router.Hosts[0].Name
+		}
+	}
+	f, err := os.Create(cmd.exportPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := pie.Export(context.Background(), f, s, domain, usernames...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.output, "exported %d account(s) to %s\n", n, cmd.exportPath)
+	return nil
+}
+
+func (a *Application) importData(s storage.Storage, cmd *dataCommand) error {
+	f, err := os.Open(cmd.importPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := pie.Import(context.Background(), f, s)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.output, "imported %d account(s) from %s\n", n, cmd.importPath)
+	return nil
+}
+
+func (a *Application) copyData(s storage.Storage, cmd *dataCommand) error {
+	var dstCfg Config
+	if err := dstCfg.FromFile(cmd.copyTo); err != nil {
+		return err
+	}
+	if dstCfg.Storage.Type == storage.Memory {
+		return errors.New("cannot copy accounts data to memory storage")
+	}
+	dst, err := initStorage(&dstCfg.Storage)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	n, err := pie.Copy(context.Background(), dst, s)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.output, "copied %d account(s) to %s storage\n", n, cmd.copyTo)
+	return nil
+}
+
+func (a *Application) restoreBackup(cmd *dataCommand, cfg *Config) error {
+	if cfg.Storage.Type != storage.BadgerDB {
+		return errors.New("backup restore is only supported by BadgerDB storage")
+	}
+	fi, err := os.Stat(cmd.restorePath)
+	if err != nil {
+		return err
+	}
+	paths := []string{cmd.restorePath}
+	if fi.IsDir() {
+		if paths, err = badgerdb.BackupChain(cmd.restorePath); err != nil {
+			return err
+		}
+	}
+	if err := badgerdb.Restore(cfg.Storage.BadgerDB.DataDir, paths...); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.output, "restored %d backup file(s) to %s\n", len(paths), cfg.Storage.BadgerDB.DataDir)
+	return nil
+}
+
+func (a *Application) verifyBackup(cmd *dataCommand) error {
+	info, err := badgerdb.VerifyBackup(cmd.verifyPath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.output, "%s: OK (since: %d, version: %d, entries: %d)\n",
+		cmd.verifyPath, info.Since, info.Version, info.Entries)
+	return nil
+}
+
+// backupVersionHeader carries the version an on demand backup has been taken at,
+// to be passed as 'since' query parameter in order to request an incremental one.
+const backupVersionHeader = "X-Backup-Version"
+
+// serveBackup streams an online storage backup. An incremental backup will be produced
+// in case a previous backup version is passed through 'since' query parameter.
+// Backups can only be requested from the local host by a server administrator.
+func (a *Application) serveBackup(w http.ResponseWriter, r *http.Request) {
+	if !a.authorizeDebugRequest(w, r) {
+		return
+	}
+	var since uint64
+	if sinceStr := r.URL.Query().Get("since"); len(sinceStr) > 0 {
+		v, err := strconv.ParseUint(sinceStr, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid since version", http.StatusBadRequest)
+			return
+		}
+		since = v
+	}
+	// backup version is only known once it has been completely written,
+	// so it gets buffered into a temporary file before being sent.
+	f, err := ioutil.TempFile("", "jackal_backup")
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	version, err := storage.Backup(r.Context(), f, since)
+	switch err {
+	case nil:
+		break
+	case storage.ErrBackupNotSupported:
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	default:
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(backupVersionHeader, strconv.FormatUint(version, 10))
+	if _, err := io.Copy(w, f); err != nil {
+		log.Error(err)
+	}
+}
+
+// isAdminRequest returns whether or not a request carries
+// the basic authentication credentials of a server administrator,
+// identified by its bare JID.
+// serveTrace streams live stanza traces, which carry private user data.
+// Traces can only be followed from the local host by a server administrator.
+func (a *Application) serveTrace(w http.ResponseWriter, r *http.Request) {
+	if !a.authorizeDebugRequest(w, r) {
+		return
+	}
+	a.tracer.ServeHTTP(w, r)
+}
+
+func (a *Application) authorizeDebugRequest(w http.ResponseWriter, r *http.Request) bool {
+	if !isLoopbackRequest(r) {
+		http.Error(w, "only available from the local host", http.StatusForbidden)
+		return false
+	}
+	if !a.isAdminRequest(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jackal"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (a *Application) isAdminRequest(r *http.Request) bool {
+	username, password, ok := r.BasicAuth()
+	if !ok || a.router == nil {
+		return false
+	}
+	j, err := jid.NewWithString(username, false)
+	if err != nil || len(j.Node()) == 0 || !a.router.IsAdmin(j) {
+		return false
+	}
+	user, err := storage.FetchUser(r.Context(), j.Node())
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	if user == nil || user.Disabled {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == 1
+}
+
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serveCacheStats returns storage cache usage statistics as a JSON object.
+func serveCacheStats(w http.ResponseWriter, _ *http.Request) {
+	stats := storage.FetchCacheStats()
+	if stats == nil {
+		http.Error(w, "storage cache not enabled", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
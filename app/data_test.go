@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/badgerdb"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/trace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplication_ServeBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jackal_backup_test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	db := badgerdb.New(&badgerdb.Config{DataDir: dir})
+	storage.Set(db)
+	defer storage.Unset()
+
+	_ = storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"})
+	_ = storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "noelia", Password: "4321"})
+
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: "jackal.im", Certificate: tls.Certificate{}, Admins: []string{"ortuman"}}},
+	})
+	a := &Application{router: r}
+
+	serve := func(remoteAddr, username, password, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/debug/backup"+query, nil)
+		req.RemoteAddr = remoteAddr
+		if len(username) > 0 {
+			req.SetBasicAuth(username, password)
+		}
+		rec := httptest.NewRecorder()
+		a.serveBackup(rec, req)
+		return rec
+	}
+	// remote callers
+	rec := serve("10.0.0.1:52432", "ortuman@jackal.im", "1234", "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// unauthenticated, wrong password or non admin users
+	rec = serve("127.0.0.1:52432", "", "", "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = serve("127.0.0.1:52432", "ortuman@jackal.im", "4321", "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = serve("127.0.0.1:52432", "noelia@jackal.im", "4321", "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve("127.0.0.1:52432", "ortuman@jackal.im", "1234", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	version, err := strconv.ParseUint(rec.Header().Get(backupVersionHeader), 10, 64)
+	require.Nil(t, err)
+	require.True(t, version > 0)
+	require.True(t, rec.Body.Len() > 0)
+
+	// chained incremental backup
+	rec = serve("[::1]:52432", "ortuman@jackal.im", "1234", "?since="+strconv.FormatUint(version, 10))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, strconv.FormatUint(version, 10), rec.Header().Get(backupVersionHeader))
+}
+
+func TestApplication_ServeTrace(t *testing.T) {
+	storage.Set(memstorage.New())
+	defer storage.Unset()
+
+	_ = storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"})
+
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: "jackal.im", Certificate: tls.Certificate{}, Admins: []string{"ortuman"}}},
+	})
+	tr, err := trace.New(&trace.Config{Live: true})
+	require.Nil(t, err)
+	defer tr.Close()
+
+	a := &Application{router: r, tracer: tr}
+
+	serve := func(remoteAddr, username, password string) *httptest.ResponseRecorder {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		time.AfterFunc(time.Millisecond*100, cancel) // stop following the trace
+
+		req := httptest.NewRequest(http.MethodGet, "/debug/trace?jid=noelia@jackal.im", nil).WithContext(ctx)
+		req.RemoteAddr = remoteAddr
+		if len(username) > 0 {
+			req.SetBasicAuth(username, password)
+		}
+		rec := httptest.NewRecorder()
+		a.serveTrace(rec, req)
+		return rec
+	}
+	rec := serve("10.0.0.1:52432", "ortuman@jackal.im", "1234")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve("127.0.0.1:52432", "", "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve("127.0.0.1:52432", "ortuman@jackal.im", "1234")
+	require.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package audit
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/stream"
+)
+
+const eventChanBufferSize = 2048
+
+// Audit event types.
+const (
+	// Login represents a successful c2s authentication.
+	Login = "login"
+
+	// LoginFailure represents a failed c2s authentication attempt.
+	LoginFailure = "login_failure"
+
+	// Logout represents an authenticated c2s stream disconnection.
+	Logout = "logout"
+
+	// PasswordChange represents a user password change.
+	PasswordChange = "password_change"
+
+	// AccountCancel represents a user account cancellation.
+	AccountCancel = "account_cancel"
+
+	// Block represents a block list addition.
+	Block = "block"
+
+	// Unblock represents a block list removal.
+	Unblock = "unblock"
+
+	// RosterSubscription represents a roster subscription state change request.
+	RosterSubscription = "roster_subscription"
+
+	// AdminAction represents an action performed by a server administrator.
+	AdminAction = "admin_action"
+
+	// S2SAuth represents a successful remote server authentication.
+	S2SAuth = "s2s_auth"
+
+	// S2SAuthFailure represents a failed remote server authentication attempt.
+	S2SAuthFailure = "s2s_auth_failure"
+)
+
+// Auditor records security relevant events into the configured sink.
+type Auditor struct {
+	dropped uint64
+	sink    sink
+	mu      sync.RWMutex
+	closed  bool
+	eventCh chan *model.AuditEvent
+	doneCh  chan struct{}
+}
+
+// New returns a new auditor instance.
+func New(config *Config) (*Auditor, error) {
+	var s sink
+	switch config.Type {
+	case FileSink:
+		fs, err := newFileSink(config.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		s = fs
+	case StorageSink:
+		s = &storageSink{}
+	}
+	return newAuditor(s, eventChanBufferSize), nil
+}
+
+func newAuditor(s sink, bufferSize int) *Auditor {
+	a := &Auditor{
+		sink:    s,
+		eventCh: make(chan *model.AuditEvent, bufferSize),
+		doneCh:  make(chan struct{}),
+	}
+	go a.loop()
+	return a
+}
+
+// Reopen reopens auditor output file.
+func (a *Auditor) Reopen() error {
+	return a.sink.reopen()
+}
+
+// Close waits until every pending event has been written and closes auditor sink.
+func (a *Auditor) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.eventCh)
+	a.mu.Unlock()
+
+	<-a.doneCh
+	return a.sink.close()
+}
+
+func (a *Auditor) record(event *model.AuditEvent) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return
+	}
+	// never block the calling stream when the sink can't keep up
+	select {
+	case a.eventCh <- event:
+	default:
+		n := atomic.AddUint64(&a.dropped, 1)
+		if n == 1 || n%eventChanBufferSize == 0 {
+			log.Warnf("audit: event buffer full, dropping '%s' event (%d dropped so far)", event.Type, n)
+		}
+	}
+}
+
+// runs on its own goroutine
+func (a *Auditor) loop() {
+	defer close(a.doneCh)
+	for event := range a.eventCh {
+		if err := a.sink.write(event); err != nil {
+			log.Errorf("audit: failed to record '%s' event: %v", event.Type, err)
+		}
+	}
+}
+
+var (
+	instMu sync.RWMutex
+	inst   *Auditor
+)
+
+// Set sets the global auditor instance.
+func Set(auditor *Auditor) {
+	instMu.Lock()
+	inst = auditor
+	instMu.Unlock()
+}
+
+// Unset removes the global auditor instance.
+func Unset() {
+	Set(nil)
+}
+
+// Reopen reopens global auditor output file.
+func Reopen() error {
+	if a := instance(); a != nil {
+		return a.Reopen()
+	}
+	return nil
+}
+
+// Record records an audit event.
+func Record(event *model.AuditEvent) {
+	a := instance()
+	if a == nil {
+		return
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	a.record(event)
+}
+
+// RecordC2S records an audit event performed through a c2s stream.
+func RecordC2S(eventType string, stm stream.C2S, details map[string]string) {
+	event := &model.AuditEvent{
+		Type:     eventType,
+		Username: stm.Username(),
+		StreamID: stm.ID(),
+		Details:  details,
+	}
+	if j := stm.JID(); j != nil {
+		event.JID = j.String()
+	}
+	Record(event)
+}
+
+func instance() *Auditor {
+	instMu.RLock()
+	a := inst
+	instMu.RUnlock()
+	return a
+}
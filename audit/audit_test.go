@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit_FileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jackal_audit")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filePath := filepath.Join(dir, "audit.log")
+	a, err := New(&Config{Type: FileSink, FilePath: filePath})
+	require.Nil(t, err)
+	Set(a)
+	defer Unset()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S("c2s:default:1", j)
+
+	Record(&model.AuditEvent{Type: Login, Username: "ortuman", RemoteAddr: "127.0.0.1:52432", Details: map[string]string{"mechanism": "PLAIN"}})
+	RecordC2S(PasswordChange, stm, nil)
+
+	require.Nil(t, a.Close())
+	Record(&model.AuditEvent{Type: Logout, Username: "ortuman"}) // discarded
+
+	b, err := ioutil.ReadFile(filePath)
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Equal(t, 2, len(lines))
+
+	var rec map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &rec))
+	require.Equal(t, Login, rec["type"])
+	require.Equal(t, "127.0.0.1:52432", rec["remote_addr"])
+	require.Equal(t, map[string]interface{}{"mechanism": "PLAIN"}, rec["details"])
+	require.NotEmpty(t, rec["time"])
+
+	rec = nil
+	require.Nil(t, json.Unmarshal([]byte(lines[1]), &rec))
+	require.Equal(t, PasswordChange, rec["type"])
+	require.Equal(t, "ortuman", rec["username"])
+	require.Equal(t, "ortuman@jackal.im/balcony", rec["jid"])
+	require.Equal(t, "c2s:default:1", rec["stream_id"])
+}
+
+func TestAudit_StorageSink(t *testing.T) {
+	storage.Set(memstorage.New())
+	defer storage.Unset()
+
+	a, err := New(&Config{Type: StorageSink})
+	require.Nil(t, err)
+	Set(a)
+	defer Unset()
+
+	Record(&model.AuditEvent{Type: Block, Username: "ortuman", Details: map[string]string{"jid": "romeo@jackal.im"}})
+	Record(&model.AuditEvent{Type: Unblock, Username: "ortuman", Details: map[string]string{"jid": "romeo@jackal.im"}})
+	require.Nil(t, a.Close())
+
+	events, err := storage.FetchAuditEvents(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(events))
+	require.Equal(t, Block, events[0].Type)
+	require.Equal(t, Unblock, events[1].Type)
+	require.False(t, events[0].CreatedAt.IsZero())
+}
+
+func TestAudit_BufferFull(t *testing.T) {
+	s := &blockingSink{releaseCh: make(chan struct{})}
+	a := newAuditor(s, 1)
+
+	recorded := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			a.record(&model.AuditEvent{Type: Login})
+		}
+		close(recorded)
+	}()
+	select {
+	case <-recorded:
+		break
+	case <-time.After(time.Second):
+		require.Fail(t, "record blocked on a full event buffer")
+	}
+	require.True(t, atomic.LoadUint64(&a.dropped) >= 8)
+
+	close(s.releaseCh)
+	require.Nil(t, a.Close())
+}
+
+type blockingSink struct {
+	releaseCh chan struct{}
+}
+
+func (s *blockingSink) write(_ *model.AuditEvent) error {
+	<-s.releaseCh
+	return nil
+}
+
+func (s *blockingSink) reopen() error { return nil }
+func (s *blockingSink) close() error  { return nil }
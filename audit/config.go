@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package audit
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SinkType represents an audit sink type.
+type SinkType int
+
+const (
+	// FileSink represents an audit sink writing JSON lines to a file.
+	FileSink SinkType = iota
+
+	// StorageSink represents an audit sink appending events to the storage audit table.
+	StorageSink
+)
+
+// Config represents an audit log configuration.
+type Config struct {
+	Type     SinkType
+	FilePath string
+}
+
+type configProxy struct {
+	Type     string `yaml:"type"`
+	FilePath string `yaml:"file_path"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	switch p.Type {
+	case "file":
+		if len(p.FilePath) == 0 {
+			return errors.New("audit.Config: file_path must be specified")
+		}
+		c.Type = FileSink
+	case "storage":
+		c.Type = StorageSink
+	case "":
+		return errors.New("audit.Config: unspecified sink type")
+	default:
+		return fmt.Errorf("audit.Config: unrecognized sink type: %s", p.Type)
+	}
+	c.FilePath = p.FilePath
+	return nil
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig(t *testing.T) {
+	cfg := Config{}
+	err := yaml.Unmarshal([]byte(`file_path: audit.log`), &cfg)
+	require.NotNil(t, err) // unspecified type
+
+	err = yaml.Unmarshal([]byte(`type: syslog`), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte(`type: file`), &cfg)
+	require.NotNil(t, err) // missing file path
+
+	rawCfg := `
+type: file
+file_path: audit.log
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, FileSink, cfg.Type)
+	require.Equal(t, "audit.log", cfg.FilePath)
+
+	err = yaml.Unmarshal([]byte(`type: storage`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, StorageSink, cfg.Type)
+}
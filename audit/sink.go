@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+)
+
+type sink interface {
+	write(event *model.AuditEvent) error
+	reopen() error
+	close() error
+}
+
+type fileSink struct {
+	f *log.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	// audit trail is append-only... never rotate it
+	f, err := log.OpenFile(path, log.RotationConfig{})
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f}, nil
+}
+
+type fileRecord struct {
+	Time       string            `json:"time"`
+	Type       string            `json:"type"`
+	Username   string            `json:"username,omitempty"`
+	JID        string            `json:"jid,omitempty"`
+	StreamID   string            `json:"stream_id,omitempty"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+}
+
+func (s *fileSink) write(event *model.AuditEvent) error {
+	b, err := json.Marshal(&fileRecord{
+		Time:       event.CreatedAt.Format(time.RFC3339Nano),
+		Type:       event.Type,
+		Username:   event.Username,
+		JID:        event.JID,
+		StreamID:   event.StreamID,
+		RemoteAddr: event.RemoteAddr,
+		Details:    event.Details,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+func (s *fileSink) reopen() error { return s.f.Reopen() }
+func (s *fileSink) close() error  { return s.f.Close() }
+
+type storageSink struct{}
+
+func (s *storageSink) write(event *model.AuditEvent) error {
+	return storage.InsertAuditEvent(context.Background(), event)
+}
+
+func (s *storageSink) reopen() error { return nil }
+func (s *storageSink) close() error  { return nil }
@@ -19,6 +19,10 @@ type Authenticator interface {
 	// authentication process has been completed.
 	Username() string
 
+	// AttemptedUsername returns the username the peer tried to authenticate as,
+	// even if authentication failed or hasn't been completed yet.
+	AttemptedUsername() string
+
 	// Authenticated returns whether or not user has been authenticated.
 	Authenticated() bool
 
@@ -53,6 +57,9 @@ func (se *SASLError) Error() string {
 }
 
 var (
+	// ErrSASLAccountDisabled represents a 'account-disabled' authentication error.
+	ErrSASLAccountDisabled = newSASLError("account-disabled")
+
 	// ErrSASLIncorrectEncoding represents a 'incorrect-encoding' authentication error.
 	ErrSASLIncorrectEncoding = newSASLError("incorrect-encoding")
 
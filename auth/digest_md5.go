@@ -77,10 +77,11 @@ func (r *digestMD5Parameters) setParameter(p string) {
 
 // DigestMD5 represents a DIGEST-MD5 authenticator.
 type DigestMD5 struct {
-	stm           stream.C2S
-	state         digestMD5State
-	username      string
-	authenticated bool
+	stm               stream.C2S
+	state             digestMD5State
+	username          string
+	attemptedUsername string
+	authenticated     bool
 }
 
 // NewDigestMD5 returns a new digest-md5 authenticator instance.
@@ -102,6 +103,11 @@ func (d *DigestMD5) Username() string {
 	return d.username
 }
 
+// AttemptedUsername returns the username the peer tried to authenticate as.
+func (d *DigestMD5) AttemptedUsername() string {
+	return d.attemptedUsername
+}
+
 // Authenticated returns whether or not user has been authenticated.
 func (d *DigestMD5) Authenticated() bool {
 	return d.authenticated
@@ -139,6 +145,7 @@ func (d *DigestMD5) ProcessElement(elem xmpp.XElement) error {
 func (d *DigestMD5) Reset() {
 	d.state = startDigestMD5State
 	d.username = ""
+	d.attemptedUsername = ""
 	d.authenticated = false
 }
 
@@ -164,6 +171,7 @@ func (d *DigestMD5) handleChallenged(elem xmpp.XElement) error {
 		return ErrSASLIncorrectEncoding
 	}
 	params := d.parseParameters(string(b))
+	d.attemptedUsername = params.username
 
 	// validate realm
 	if params.realm != d.stm.Domain() {
@@ -186,7 +194,7 @@ func (d *DigestMD5) handleChallenged(elem xmpp.XElement) error {
 		return ErrSASLNotAuthorized
 	}
 	// validate user
-	user, err := storage.FetchUser(params.username)
+	user, err := storage.FetchUser(d.stm.Context(), params.username)
 	if err != nil {
 		return err
 	}
@@ -198,6 +206,9 @@ func (d *DigestMD5) handleChallenged(elem xmpp.XElement) error {
 	if clientResp != params.response {
 		return ErrSASLNotAuthorized
 	}
+	if user.Disabled {
+		return ErrSASLAccountDisabled
+	}
 
 	// authenticated... compute and send server response
 	serverResp := d.computeResponse(params, user, false)
@@ -16,9 +16,10 @@ import (
 
 // Plain represents a PLAIN authenticator.
 type Plain struct {
-	stm           stream.C2S
-	username      string
-	authenticated bool
+	stm               stream.C2S
+	username          string
+	attemptedUsername string
+	authenticated     bool
 }
 
 // NewPlain returns a new plain authenticator instance.
@@ -37,6 +38,11 @@ func (p *Plain) Username() string {
 	return p.username
 }
 
+// AttemptedUsername returns the username the peer tried to authenticate as.
+func (p *Plain) AttemptedUsername() string {
+	return p.attemptedUsername
+}
+
 // Authenticated returns whether or not user has been authenticated.
 func (p *Plain) Authenticated() bool {
 	return p.authenticated
@@ -66,15 +72,19 @@ func (p *Plain) ProcessElement(elem xmpp.XElement) error {
 	}
 	username := string(s[1])
 	password := string(s[2])
+	p.attemptedUsername = username
 
 	// validate user and password
-	user, err := storage.FetchUser(username)
+	user, err := storage.FetchUser(p.stm.Context(), username)
 	if err != nil {
 		return err
 	}
 	if user == nil || user.Password != password {
 		return ErrSASLNotAuthorized
 	}
+	if user.Disabled {
+		return ErrSASLAccountDisabled
+	}
 	p.username = username
 	p.authenticated = true
 
@@ -85,5 +95,6 @@ func (p *Plain) ProcessElement(elem xmpp.XElement) error {
 // Reset resets plain authenticator internal state.
 func (p *Plain) Reset() {
 	p.username = ""
+	p.attemptedUsername = ""
 	p.authenticated = false
 }
@@ -7,6 +7,7 @@ package auth
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"testing"
 
@@ -88,6 +89,8 @@ func TestAuthPlainAuthentication(t *testing.T) {
 	authr.Reset()
 	err = authr.ProcessElement(elem)
 	require.Equal(t, ErrSASLNotAuthorized, err)
+	require.Equal(t, "ortuman", authr.AttemptedUsername())
+	require.Equal(t, "", authr.Username())
 
 	// incorrect password
 	buf.Reset()
@@ -100,4 +103,18 @@ func TestAuthPlainAuthentication(t *testing.T) {
 	authr.Reset()
 	err = authr.ProcessElement(elem)
 	require.Equal(t, ErrSASLNotAuthorized, err)
+
+	// disabled account
+	s.InsertOrUpdateUser(context.Background(), &model.User{Username: "mariana", Password: "1234", Disabled: true})
+
+	buf.Reset()
+	buf.WriteByte(0)
+	buf.WriteString("mariana")
+	buf.WriteByte(0)
+	buf.WriteString("1234")
+	elem.SetText(base64.StdEncoding.EncodeToString(buf.Bytes()))
+
+	authr.Reset()
+	err = authr.ProcessElement(elem)
+	require.Equal(t, ErrSASLAccountDisabled, err)
 }
@@ -79,19 +79,20 @@ func (s *scramParameters) String() string {
 
 // Scram represents a SCRAM authenticator.
 type Scram struct {
-	stm           stream.C2S
-	tr            transport.Transport
-	tp            ScramType
-	usesCb        bool
-	h             func() hash.Hash
-	hKeyLen       int
-	state         scramState
-	params        *scramParameters
-	user          *model.User
-	salt          []byte
-	srvNonce      string
-	firstMessage  string
-	authenticated bool
+	stm               stream.C2S
+	tr                transport.Transport
+	tp                ScramType
+	usesCb            bool
+	h                 func() hash.Hash
+	hKeyLen           int
+	state             scramState
+	params            *scramParameters
+	user              *model.User
+	salt              []byte
+	srvNonce          string
+	firstMessage      string
+	attemptedUsername string
+	authenticated     bool
 }
 
 // NewScram returns a new scram authenticator instance.
@@ -140,6 +141,11 @@ func (s *Scram) Username() string {
 	return ""
 }
 
+// AttemptedUsername returns the username the peer tried to authenticate as.
+func (s *Scram) AttemptedUsername() string {
+	return s.attemptedUsername
+}
+
 // Authenticated returns whether or not user has been authenticated.
 func (s *Scram) Authenticated() bool {
 	return s.authenticated
@@ -176,6 +182,7 @@ func (s *Scram) Reset() {
 	s.state = startScramState
 	s.params = nil
 	s.user = nil
+	s.attemptedUsername = ""
 	s.salt = nil
 	s.srvNonce = ""
 	s.firstMessage = ""
@@ -191,11 +198,12 @@ func (s *Scram) handleStart(elem xmpp.XElement) error {
 	}
 	username := s.params.getParameter("n")
 	cNonce := s.params.getParameter("r")
+	s.attemptedUsername = username
 
 	if len(username) == 0 || len(cNonce) == 0 {
 		return ErrSASLMalformedRequest
 	}
-	user, err := storage.FetchUser(username)
+	user, err := storage.FetchUser(s.stm.Context(), username)
 	if err != nil {
 		return err
 	}
@@ -243,6 +251,9 @@ func (s *Scram) handleChallenged(elem xmpp.XElement) error {
 	if clientFinalMessage != p {
 		return ErrSASLNotAuthorized
 	}
+	if s.user.Disabled {
+		return ErrSASLAccountDisabled
+	}
 	v := "v=" + base64.StdEncoding.EncodeToString(serverSignature)
 
 	respElem := xmpp.NewElementNamespace("success", saslNamespace)
@@ -56,7 +56,7 @@ func New(configs []Config, mods *module.Modules, comps *component.Components, ro
 func (c *C2S) Start() {
 	if atomic.CompareAndSwapUint32(&c.started, 0, 1) {
 		for _, srv := range c.servers {
-			go srv.start()
+			srv.start()
 		}
 	}
 }
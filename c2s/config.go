@@ -74,6 +74,7 @@ type TransportConfig struct {
 	Port        int
 	KeepAlive   time.Duration
 	URLPath     string
+	DirectTLS   bool
 }
 
 type transportProxyType struct {
@@ -82,6 +83,7 @@ type transportProxyType struct {
 	Port        int    `yaml:"port"`
 	KeepAlive   int    `yaml:"keep_alive"`
 	URLPath     string `yaml:"url_path"`
+	DirectTLS   bool   `yaml:"direct_tls"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -101,6 +103,11 @@ func (t *TransportConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 	default:
 		return fmt.Errorf("c2s.TransportConfig: unrecognized transport type: %s", p.Type)
 	}
+	// websocket connections are always established over TLS
+	if p.DirectTLS && t.Type != transport.Socket {
+		return fmt.Errorf("c2s.TransportConfig: direct TLS not supported by %s transport", p.Type)
+	}
+	t.DirectTLS = p.DirectTLS
 	t.BindAddress = p.BindAddress
 	t.Port = p.Port
 
@@ -194,10 +201,12 @@ func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 type streamConfig struct {
 	transport        transport.Transport
+	remoteAddr       string
 	connectTimeout   time.Duration
 	maxStanzaSize    int
 	resourceConflict ResourceConflictPolicy
 	sasl             []string
 	compression      CompressConfig
+	directTLS        bool
 	onDisconnect     func(s stream.C2S)
 }
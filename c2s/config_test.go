@@ -54,6 +54,13 @@ func TestTransportConfig(t *testing.T) {
 	require.Equal(t, transport.WebSocket, s.Type)
 	require.Equal(t, 5222, s.Port)
 	require.Equal(t, time.Second*time.Duration(120), s.KeepAlive)
+
+	err = yaml.Unmarshal([]byte("{type: socket, port: 5223, direct_tls: true}"), &s)
+	require.Nil(t, err)
+	require.True(t, s.DirectTLS)
+
+	err = yaml.Unmarshal([]byte("{type: websocket, direct_tls: true}"), &s)
+	require.NotNil(t, err)
 }
 
 func TestConfig(t *testing.T) {
@@ -11,10 +11,12 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/ortuman/jackal/audit"
 	"github.com/ortuman/jackal/auth"
 	"github.com/ortuman/jackal/component"
 	"github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/session"
@@ -49,6 +51,7 @@ type inStream struct {
 	activeAuth     auth.Authenticator
 	actorCh        chan func()
 	iqResultCh     chan xmpp.Stanza
+	readSuspended  bool
 
 	mu            sync.RWMutex
 	jid           *jid.JID
@@ -71,7 +74,7 @@ func newStream(id string, config *streamConfig, mods *module.Modules, comps *com
 	}
 
 	// initialize stream context
-	secured := !(config.transport.Type() == transport.Socket)
+	secured := config.directTLS || !(config.transport.Type() == transport.Socket)
 	s.setSecured(secured)
 	s.setJID(&jid.JID{})
 
@@ -354,7 +357,7 @@ func (s *inStream) handleAuthenticating(elem xmpp.XElement) {
 	authr := s.activeAuth
 	s.continueAuthentication(elem, authr)
 	if authr.Authenticated() {
-		s.finishAuthentication(authr.Username())
+		s.finishAuthentication(authr)
 	}
 }
 
@@ -420,7 +423,7 @@ func (s *inStream) proceedStartTLS(elem xmpp.XElement) {
 
 	s.cfg.transport.StartTLS(&tls.Config{Certificates: s.router.Certificates()}, false)
 
-	log.Infof("secured stream... id: %s", s.id)
+	s.logger().Infof("secured stream...")
 	s.restartSession()
 }
 
@@ -448,7 +451,7 @@ func (s *inStream) compress(elem xmpp.XElement) {
 
 	s.cfg.transport.EnableCompression(s.cfg.compression.Level)
 
-	log.Infof("compressed stream... id: %s", s.id)
+	s.logger().Infof("compressed stream...")
 
 	s.restartSession()
 }
@@ -465,7 +468,7 @@ func (s *inStream) startAuthentication(elem xmpp.XElement) {
 				return
 			}
 			if authr.Authenticated() {
-				s.finishAuthentication(authr.Username())
+				s.finishAuthentication(authr)
 			} else {
 				s.activeAuth = authr
 				s.setState(authenticating)
@@ -474,6 +477,8 @@ func (s *inStream) startAuthentication(elem xmpp.XElement) {
 		}
 	}
 	// ...mechanism not found...
+	s.recordAudit(audit.LoginFailure, "", map[string]string{"mechanism": mechanism, "reason": "invalid-mechanism"})
+
 	failure := xmpp.NewElementNamespace("failure", saslNamespace)
 	failure.AppendElement(xmpp.NewElementName("invalid-mechanism"))
 	s.writeElement(failure)
@@ -481,16 +486,20 @@ func (s *inStream) startAuthentication(elem xmpp.XElement) {
 
 func (s *inStream) continueAuthentication(elem xmpp.XElement, authr auth.Authenticator) error {
 	err := authr.ProcessElement(elem)
+	if err != nil {
+		s.recordAudit(audit.LoginFailure, authr.AttemptedUsername(), map[string]string{"mechanism": authr.Mechanism(), "reason": err.Error()})
+	}
 	if saslErr, ok := err.(*auth.SASLError); ok {
 		s.failAuthentication(saslErr.Element())
 	} else if err != nil {
-		log.Error(err)
+		s.logger().Error(err)
 		s.failAuthentication(auth.ErrSASLTemporaryAuthFailure.(*auth.SASLError).Element())
 	}
 	return err
 }
 
-func (s *inStream) finishAuthentication(username string) {
+func (s *inStream) finishAuthentication(authr auth.Authenticator) {
+	username := authr.Username()
 	if s.activeAuth != nil {
 		s.activeAuth.Reset()
 		s.activeAuth = nil
@@ -499,6 +508,8 @@ func (s *inStream) finishAuthentication(username string) {
 	s.setJID(j)
 	s.setAuthenticated(true)
 
+	s.recordAudit(audit.Login, username, map[string]string{"mechanism": authr.Mechanism()})
+
 	s.restartSession()
 }
 
@@ -541,7 +552,11 @@ func (s *inStream) bindResource(iq *xmpp.IQ) {
 			resource = uuid.New()
 		case Replace:
 			// terminate the session of the currently connected client...
-			stm.Disconnect(streamerror.ErrResourceConstraint)
+			if err := stream.Disconnect(stm, streamerror.ErrResourceConstraint); err != nil {
+				s.logger().Error(err)
+				s.writeElement(iq.ConflictError())
+				return
+			}
 		default:
 			// disallow resource binding attempt...
 			s.writeElement(iq.ConflictError())
@@ -600,6 +615,11 @@ func (s *inStream) processStanza(elem xmpp.Stanza) {
 		s.writeElement(resp)
 		return
 	}
+	// XEP-0033: extended stanza addressing
+	if mc := s.mods.Multicast; mc != nil && mc.MatchesStanza(elem) {
+		mc.ProcessStanza(elem, s)
+		return
+	}
 	switch stanza := elem.(type) {
 	case *xmpp.Presence:
 		s.processPresence(stanza)
@@ -632,6 +652,25 @@ func (s *inStream) processIQ(iq *xmpp.IQ) {
 }
 
 func (s *inStream) processPresence(presence *xmpp.Presence) {
+	// announce current avatar hash (XEP-0153), suspending
+	// incoming stanzas processing until it gets injected
+	if vCard := s.mods.VCard; vCard != nil && presence.IsAvailable() {
+		s.readSuspended = true
+		vCard.InjectPhotoHash(s.Context(), presence, func() {
+			if s.getState() == disconnected {
+				return
+			}
+			s.actorCh <- func() {
+				s.routePresence(presence)
+				s.resumeRead()
+			}
+		})
+		return
+	}
+	s.routePresence(presence)
+}
+
+func (s *inStream) routePresence(presence *xmpp.Presence) {
 	if presence.ToJID().IsFullWithUser() {
 		s.router.Route(presence)
 		return
@@ -639,8 +678,11 @@ func (s *inStream) processPresence(presence *xmpp.Presence) {
 	replyOnBehalf := s.JID().Matches(presence.ToJID(), jid.MatchesBare)
 
 	// update context presence
+	var initialPresence bool
 	if replyOnBehalf && (presence.IsAvailable() || presence.IsUnavailable()) {
+		initialPresence = s.Presence() == nil && presence.IsAvailable()
 		s.setPresence(presence)
+		s.router.UpdatePresence(s)
 	}
 	// deliver presence to roster module
 	if r := s.mods.Roster; r != nil {
@@ -652,9 +694,19 @@ func (s *inStream) processPresence(presence *xmpp.Presence) {
 			off.DeliverOfflineMessages(s)
 		}
 	}
+	// deliver message of the day
+	if initialPresence {
+		if motd := s.mods.MOTD; motd != nil {
+			motd.DeliverMOTD(s)
+		}
+	}
 }
 
 func (s *inStream) processMessage(message *xmpp.Message) {
+	// XEP-0359: stamp messages addressed to local users
+	if toJID := message.ToJID(); len(toJID.Node()) > 0 && s.router.IsLocalHost(toJID.Domain()) {
+		message.SetStanzaID(toJID.ToBareJID().String(), uuid.New())
+	}
 	msg := message
 
 sendMessage:
@@ -677,7 +729,7 @@ sendMessage:
 	case router.ErrFailedRemoteConnect:
 		s.writeElement(message.RemoteServerNotFoundError())
 	default:
-		log.Error(err)
+		s.logger().Error(err)
 	}
 }
 
@@ -724,7 +776,7 @@ func (s *inStream) handleSessionError(sErr *session.Error) {
 	case *xmpp.StanzaError:
 		s.writeStanzaErrorResponse(sErr.Element, err)
 	default:
-		log.Error(err)
+		s.logger().Error(err)
 		s.disconnectWithStreamError(streamerror.ErrUndefinedCondition)
 	}
 }
@@ -746,6 +798,16 @@ func (s *inStream) readElement(elem xmpp.XElement) {
 	if elem != nil {
 		s.handleElement(elem)
 	}
+	if s.readSuspended {
+		return // resumed once element processing completes
+	}
+	if s.getState() != disconnected {
+		go s.doRead() // keep reading...
+	}
+}
+
+func (s *inStream) resumeRead() {
+	s.readSuspended = false
 	if s.getState() != disconnected {
 		go s.doRead() // keep reading...
 	}
@@ -757,13 +819,13 @@ func (s *inStream) disconnect(err error) {
 	}
 	switch err {
 	case nil:
-		s.disconnectClosingSession(false, true)
+		s.disconnectClosingSession(false)
 	default:
 		if stmErr, ok := err.(*streamerror.Error); ok {
 			s.disconnectWithStreamError(stmErr)
 		} else {
-			log.Error(err)
-			s.disconnectClosingSession(false, true)
+			s.logger().Error(err)
+			s.disconnectClosingSession(false)
 		}
 	}
 }
@@ -774,11 +836,10 @@ func (s *inStream) disconnectWithStreamError(err *streamerror.Error) {
 	}
 	s.writeElement(err.Element())
 
-	unregister := err != streamerror.ErrSystemShutdown
-	s.disconnectClosingSession(true, unregister)
+	s.disconnectClosingSession(true)
 }
 
-func (s *inStream) disconnectClosingSession(closeSession, unbind bool) {
+func (s *inStream) disconnectClosingSession(closeSession bool) {
 	// stop pinging...
 	if p := s.mods.Ping; p != nil {
 		p.CancelPing(s)
@@ -792,10 +853,12 @@ func (s *inStream) disconnectClosingSession(closeSession, unbind bool) {
 	if closeSession {
 		s.sess.Close()
 	}
-	// unregister stream
-	if unbind {
-		s.router.Unbind(s)
+	if s.IsAuthenticated() {
+		s.recordAudit(audit.Logout, s.Username(), nil)
 	}
+	// unregister stream... even when shutting down, so that
+	// stanzas routed while draining get archived as offline messages.
+	s.router.Unbind(s)
 	// notify disconnection
 	if s.cfg.onDisconnect != nil {
 		s.cfg.onDisconnect(s)
@@ -803,6 +866,9 @@ func (s *inStream) disconnectClosingSession(closeSession, unbind bool) {
 
 	s.setState(disconnected)
 	s.cfg.transport.Close()
+
+	// cancel any in-flight operation performed on behalf of the stream
+	s.ctx.Cancel()
 }
 
 func (s *inStream) isBlockedJID(j *jid.JID) bool {
@@ -839,6 +905,26 @@ func (s *inStream) setAuthenticated(authenticated bool) {
 	s.authenticated = authenticated
 }
 
+// logger returns a log entry carrying stream context fields.
+func (s *inStream) logger() *log.Entry {
+	return log.WithFields(log.Fields{
+		"stream_id":   s.id,
+		"jid":         s.JID().String(),
+		"remote_addr": s.cfg.remoteAddr,
+	})
+}
+
+func (s *inStream) recordAudit(eventType, username string, details map[string]string) {
+	audit.Record(&model.AuditEvent{
+		Type:       eventType,
+		Username:   username,
+		JID:        s.JID().String(),
+		StreamID:   s.id,
+		RemoteAddr: s.cfg.remoteAddr,
+		Details:    details,
+	})
+}
+
 func (s *inStream) setCompressed(compressed bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -6,9 +6,11 @@
 package c2s
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/ortuman/jackal/audit"
 	"github.com/ortuman/jackal/component"
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/module"
@@ -72,13 +74,30 @@ func TestStream_Features(t *testing.T) {
 	elem = conn2.outboundRead()
 	require.Equal(t, "stream:features", elem.Name())
 	require.NotNil(t, elem.Elements().ChildNamespace("mechanisms", saslNamespace))
+
+	// direct TLS features
+	conn3 := newFakeSocketConn()
+	cfg := tUtilInStreamDefaultConfig(transport.NewSocketTransport(conn3, 4096))
+	cfg.directTLS = true
+	stm3 := newStream("abcd1234", cfg, tUtilInitModules(r), &component.Components{}, r)
+	defer stm3.Disconnect(nil)
+
+	tUtilStreamOpen(conn3)
+
+	elem = conn3.outboundRead()
+	require.Equal(t, "stream:stream", elem.Name())
+
+	elem = conn3.outboundRead()
+	require.Equal(t, "stream:features", elem.Name())
+	require.Nil(t, elem.Elements().ChildNamespace("starttls", tlsNamespace))
+	require.NotNil(t, elem.Elements().ChildNamespace("mechanisms", saslNamespace))
 }
 
 func TestStream_TLS(t *testing.T) {
 	r, _, shutdown := setupTest("localhost")
 	defer shutdown()
 
-	storage.InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r)
 	tUtilStreamOpen(conn)
@@ -100,7 +119,12 @@ func TestStream_FailAuthenticate(t *testing.T) {
 	r, _, shutdown := setupTest("localhost")
 	defer shutdown()
 
-	storage.InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
+
+	a, err := audit.New(&audit.Config{Type: audit.StorageSink})
+	require.Nil(t, err)
+	audit.Set(a)
+	defer audit.Unset()
 
 	_, conn := tUtilStreamInit(r)
 	tUtilStreamOpen(conn)
@@ -123,6 +147,14 @@ func TestStream_FailAuthenticate(t *testing.T) {
 	elem = conn.outboundRead()
 	require.Equal(t, "failure", elem.Name())
 
+	// failed attempts are audited along with the attempted username
+	require.Nil(t, a.Close())
+	events, err := storage.FetchAuditEvents(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(events))
+	require.Equal(t, audit.LoginFailure, events[0].Type)
+	require.Equal(t, "DIGEST-MD5", events[0].Details["mechanism"])
+
 	// non-SASL
 	conn.inboundWrite([]byte(`<iq type='set' id='auth2'><query xmlns='jabber:iq:auth'>
 <username>bill</username>
@@ -140,7 +172,7 @@ func TestStream_Compression(t *testing.T) {
 	r, _, shutdown := setupTest("localhost")
 	defer shutdown()
 
-	storage.InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r)
 	tUtilStreamOpen(conn)
@@ -183,7 +215,7 @@ func TestStream_StartSession(t *testing.T) {
 	r, _, shutdown := setupTest("localhost")
 	defer shutdown()
 
-	storage.InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r)
 	tUtilStreamOpen(conn)
@@ -205,7 +237,7 @@ func TestStream_SendIQ(t *testing.T) {
 	r, _, shutdown := setupTest("localhost")
 	defer shutdown()
 
-	storage.InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r)
 	tUtilStreamOpen(conn)
@@ -241,7 +273,7 @@ func TestStream_SendPresence(t *testing.T) {
 	r, _, shutdown := setupTest("localhost")
 	defer shutdown()
 
-	storage.InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r)
 	tUtilStreamOpen(conn)
@@ -278,14 +310,48 @@ func TestStream_SendPresence(t *testing.T) {
 	require.NotNil(t, x.Elements().Child("show"))
 	require.NotNil(t, x.Elements().Child("status"))
 	require.NotNil(t, x.Elements().Child("priority"))
-	require.NotNil(t, x.Elements().Child("x"))
+
+	// forged avatar hash replaced by stored one
+	update := x.Elements().ChildNamespace("x", "vcard-temp:x:update")
+	require.NotNil(t, update)
+	require.Equal(t, "", update.Elements().Child("photo").Text())
+}
+
+func TestStream_DeliverMOTD(t *testing.T) {
+	r, _, shutdown := setupTest("localhost")
+	defer shutdown()
+
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
+	storage.InsertOrUpdateMOTD(context.Background(), &model.MOTD{Host: "localhost", Body: "Welcome!"})
+
+	stm, conn := tUtilStreamInit(r)
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamAuthenticate(conn, t)
+
+	tUtilStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+
+	tUtilStreamStartSession(conn, t)
+
+	require.Equal(t, sessionStarted, stm.getState())
+
+	conn.inboundWrite([]byte(`<presence/>`))
+
+	elem := conn.outboundRead()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "localhost", elem.From())
+	require.Equal(t, "Welcome!", elem.Elements().Child("body").Text())
 }
 
 func TestStream_SendMessage(t *testing.T) {
 	r, _, shutdown := setupTest("localhost")
 	defer shutdown()
 
-	storage.InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r)
 	tUtilStreamOpen(conn)
@@ -330,13 +396,22 @@ func TestStream_SendMessage(t *testing.T) {
 	elem = stm2.FetchElement()
 	require.Equal(t, "message", elem.Name())
 	require.Equal(t, msgID, elem.ID())
+
+	// forged stanza ID...
+	msg.SetStanzaID("ortuman@localhost", "forged")
+	conn.inboundWrite([]byte(msg.String()))
+	elem = stm2.FetchElement()
+	sids := elem.Elements().ChildrenNamespace("stanza-id", "urn:xmpp:sid:0")
+	require.Equal(t, 1, len(sids))
+	require.Equal(t, "ortuman@localhost", sids[0].Attributes().Get("by"))
+	require.NotEqual(t, "forged", sids[0].Attributes().Get("id"))
 }
 
 func TestStream_SendToBlockedJID(t *testing.T) {
 	r, _, shutdown := setupTest("localhost")
 	defer shutdown()
 
-	storage.InsertOrUpdateUser(&model.User{Username: "user", Password: "pencil"})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "user", Password: "pencil"})
 
 	stm, conn := tUtilStreamInit(r)
 	tUtilStreamOpen(conn)
@@ -353,7 +428,7 @@ func TestStream_SendToBlockedJID(t *testing.T) {
 
 	require.Equal(t, sessionStarted, stm.getState())
 
-	storage.InsertBlockListItems([]model.BlockListItem{{
+	storage.InsertBlockListItems(context.Background(), []model.BlockListItem{{
 		Username: "user",
 		JID:      "hamlet@localhost",
 	}})
@@ -437,6 +512,8 @@ func tUtilInitModules(r *router.Router) *module.Modules {
 	modules := map[string]struct{}{}
 	modules["roster"] = struct{}{}
 	modules["blocking_command"] = struct{}{}
+	modules["motd"] = struct{}{}
+	modules["vcard"] = struct{}{}
 
 	return module.New(&module.Config{Enabled: modules}, r)
 }
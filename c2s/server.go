@@ -18,6 +18,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/ortuman/jackal/component"
 	"github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/listener"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
@@ -25,7 +26,7 @@ import (
 	"github.com/ortuman/jackal/transport"
 )
 
-var listenerProvider = net.Listen
+var listenerProvider = listener.Listen
 
 type server struct {
 	cfg        *Config
@@ -40,6 +41,8 @@ type server struct {
 	listening  uint32
 }
 
+// start starts listening at the configured address,
+// serving incoming connections on a separate goroutine.
 func (s *server) start() {
 	bindAddr := s.cfg.Transport.BindAddress
 	port := s.cfg.Transport.Port
@@ -67,15 +70,34 @@ func (s *server) listenSocketConn(address string) error {
 	}
 	s.ln = ln
 
+	// XEP-0368: direct TLS connections
+	var tlsCfg *tls.Config
+	if s.cfg.Transport.DirectTLS {
+		tlsCfg = &tls.Config{
+			Certificates: s.router.Certificates(),
+			NextProtos:   []string{"xmpp-client"},
+		}
+	}
 	atomic.StoreUint32(&s.listening, 1)
+	go s.acceptSocketConns(ln, tlsCfg)
+	return nil
+}
+
+// runs on its own goroutine
+func (s *server) acceptSocketConns(ln net.Listener, tlsCfg *tls.Config) {
 	for atomic.LoadUint32(&s.listening) == 1 {
 		conn, err := ln.Accept()
 		if err == nil {
-			go s.startStream(transport.NewSocketTransport(conn, s.cfg.Transport.KeepAlive))
+			if tlsCfg != nil {
+				conn = tls.Server(conn, tlsCfg)
+			}
+			go s.startStream(transport.NewSocketTransport(conn, s.cfg.Transport.KeepAlive), conn.RemoteAddr().String())
 			continue
 		}
+		if err == listener.ErrClosed {
+			break // no longer accepting connections
+		}
 	}
-	return nil
 }
 
 func (s *server) listenWebSocketConn(address string) error {
@@ -93,7 +115,12 @@ func (s *server) listenWebSocketConn(address string) error {
 		return err
 	}
 	atomic.StoreUint32(&s.listening, 1)
-	return s.wsSrv.ServeTLS(ln, "", "")
+	go func() {
+		if err := s.wsSrv.ServeTLS(ln, "", ""); err != listener.ErrClosed && err != http.ErrServerClosed {
+			log.Fatalf("%v", err)
+		}
+	}()
+	return nil
 }
 
 func (s *server) websocketUpgrade(w http.ResponseWriter, r *http.Request) {
@@ -102,7 +129,7 @@ func (s *server) websocketUpgrade(w http.ResponseWriter, r *http.Request) {
 		log.Error(err)
 		return
 	}
-	s.startStream(transport.NewWebSocketTransport(conn, s.cfg.Transport.KeepAlive))
+	s.startStream(transport.NewWebSocketTransport(conn, s.cfg.Transport.KeepAlive), r.RemoteAddr)
 }
 
 func (s *server) shutdown(ctx context.Context) error {
@@ -128,14 +155,16 @@ func (s *server) shutdown(ctx context.Context) error {
 	return nil
 }
 
-func (s *server) startStream(tr transport.Transport) {
+func (s *server) startStream(tr transport.Transport, remoteAddr string) {
 	cfg := &streamConfig{
 		transport:        tr,
+		remoteAddr:       remoteAddr,
 		resourceConflict: s.cfg.ResourceConflict,
 		connectTimeout:   s.cfg.ConnectTimeout,
 		maxStanzaSize:    s.cfg.MaxStanzaSize,
 		sasl:             s.cfg.SASL,
 		compression:      s.cfg.Compression,
+		directTLS:        s.cfg.Transport.DirectTLS,
 		onDisconnect:     s.unregisterStream,
 	}
 	stm := newStream(s.nextID(), cfg, s.mods, s.comps, s.router)
@@ -8,6 +8,7 @@ package c2s
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"net"
 	"net/http"
 	"testing"
@@ -71,6 +72,71 @@ func TestC2SSocketServer(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestC2SDirectTLSServer(t *testing.T) {
+	privKeyFile := "../testdata/cert/test.server.key"
+	certFile := "../testdata/cert/test.server.crt"
+	cer, err := util.LoadCertificate(privKeyFile, certFile, "localhost")
+	require.Nil(t, err)
+
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: "localhost", Certificate: cer}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	defer storage.Unset()
+
+	errCh := make(chan error)
+	cfg := Config{
+		ID:               "srv-1234",
+		ConnectTimeout:   time.Second * time.Duration(5),
+		MaxStanzaSize:    8192,
+		ResourceConflict: Reject,
+		Transport: TransportConfig{
+			Type:      transport.Socket,
+			Port:      9997,
+			DirectTLS: true,
+		},
+	}
+	srv := server{cfg: &cfg, router: r, mods: &module.Modules{}, comps: &component.Components{}}
+	go srv.start()
+
+	go func() {
+		time.Sleep(time.Millisecond * 150)
+
+		// test direct TLS port...
+		conn, err := tls.Dial("tcp", "127.0.0.1:9997", &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"xmpp-client"},
+		})
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer conn.Close()
+
+		if conn.ConnectionState().NegotiatedProtocol != "xmpp-client" {
+			errCh <- errors.New("unexpected negotiated protocol")
+			return
+		}
+		xmlHdr := []byte(`<?xml version="1.0" encoding="UTF-8">`)
+		_, err = conn.Write(xmlHdr)
+		if err != nil {
+			errCh <- err
+			return
+		}
+
+		time.Sleep(time.Millisecond * 150) // wait until disconnected
+
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Second*5))
+		defer cancel()
+
+		srv.shutdown(ctx)
+		errCh <- nil
+	}()
+	err = <-errCh
+	require.Nil(t, err)
+}
+
 func TestC2SWebSocketServer(t *testing.T) {
 	privKeyFile := "../testdata/cert/test.server.key"
 	certFile := "../testdata/cert/test.server.crt"
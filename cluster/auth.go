@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+const challengeSize = 32
+
+// connection roles, bound into every authentication proof
+// so that a proof can never be reflected back to its sender.
+const (
+	dialerRole   = "dialer"
+	acceptorRole = "acceptor"
+)
+
+var errAuthFailed = errors.New("cluster: authentication failed")
+
+// newChallenge returns a random nonce to be answered
+// by the remote node in order to prove its knowledge of the shared secret.
+func newChallenge() (string, error) {
+	b := make([]byte, challengeSize)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// authProof computes the HMAC-SHA256 proof a node sends in reply
+// to its counterpart challenge, covering both connection nonces.
+func authProof(secret, role, node, challenge, nonce string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	for _, s := range []string{role, node, challenge, nonce} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func verifyAuthProof(proof, secret, role, node, challenge, nonce string) bool {
+	expected := authProof(secret, role, node, challenge, nonce)
+	return hmac.Equal([]byte(proof), []byte(expected))
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"sync"
+
+	"github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// remoteC2S represents a c2s stream bound to a different cluster node.
+type remoteC2S struct {
+	node     string
+	jid      *jid.JID
+	ctx      *stream.Context
+	cluster  *Cluster
+	mu       sync.RWMutex
+	presence *xmpp.Presence
+}
+
+func newRemoteC2S(node string, jid *jid.JID, cluster *Cluster) *remoteC2S {
+	return &remoteC2S{
+		node:    node,
+		jid:     jid,
+		ctx:     stream.NewContext(),
+		cluster: cluster,
+	}
+}
+
+func (s *remoteC2S) ID() string {
+	return s.node + ":" + s.jid.String()
+}
+
+func (s *remoteC2S) Context() *stream.Context {
+	return s.ctx
+}
+
+func (s *remoteC2S) Username() string {
+	return s.jid.Node()
+}
+
+func (s *remoteC2S) Domain() string {
+	return s.jid.Domain()
+}
+
+func (s *remoteC2S) Resource() string {
+	return s.jid.Resource()
+}
+
+func (s *remoteC2S) JID() *jid.JID {
+	return s.jid
+}
+
+func (s *remoteC2S) IsSecured() bool {
+	return true
+}
+
+func (s *remoteC2S) IsAuthenticated() bool {
+	return true
+}
+
+func (s *remoteC2S) IsCompressed() bool {
+	return false
+}
+
+func (s *remoteC2S) Presence() *xmpp.Presence {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.presence
+}
+
+// SendElement forwards an element to the node the stream is bound to.
+func (s *remoteC2S) SendElement(elem xmpp.XElement) {
+	if err := s.ForwardElement(elem); err != nil {
+		log.Warnf("cluster: failed to forward element to %s: %v", s.ID(), err)
+	}
+}
+
+// ForwardElement forwards an element to the node the stream is bound to,
+// returning an error in case it couldn't be handed over.
+func (s *remoteC2S) ForwardElement(elem xmpp.XElement) error {
+	return s.cluster.sendTo(s.node, &message{
+		typ:  msgRoute,
+		jid:  s.jid.String(),
+		elem: xmpp.NewElementFromElement(elem),
+	})
+}
+
+// Disconnect requests the owner node to disconnect the stream.
+func (s *remoteC2S) Disconnect(err error) {
+	if tErr := s.Terminate(err); tErr != nil {
+		log.Warnf("cluster: failed to disconnect %s: %v", s.ID(), tErr)
+	}
+}
+
+// Terminate requests the owner node to disconnect the stream,
+// returning an error in case the request couldn't be handed over.
+func (s *remoteC2S) Terminate(err error) error {
+	var reason string
+	if stmErr, ok := err.(*streamerror.Error); ok {
+		reason = stmErr.Error()
+	}
+	return s.cluster.sendTo(s.node, &message{
+		typ:  msgDisconnect,
+		jid:  s.jid.String(),
+		text: reason,
+	})
+}
+
+func (s *remoteC2S) setPresence(presence *xmpp.Presence) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.presence = presence
+}
@@ -0,0 +1,441 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/listener"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const handshakeTimeout = time.Duration(5) * time.Second
+
+var errInvalidHandshake = errors.New("cluster: invalid handshake")
+
+// disconnection reasons that can be requested by a remote node
+var streamErrors = map[string]*streamerror.Error{
+	streamerror.ErrResourceConstraint.Error(): streamerror.ErrResourceConstraint,
+	streamerror.ErrSystemShutdown.Error():     streamerror.ErrSystemShutdown,
+	streamerror.ErrPolicyViolation.Error():    streamerror.ErrPolicyViolation,
+	streamerror.ErrNotAuthorized.Error():      streamerror.ErrNotAuthorized,
+}
+
+// member represents a cluster node connected to the local one.
+type member struct {
+	name string
+	conn net.Conn
+}
+
+// Cluster represents a set of jackal nodes serving the same domains.
+// Every node shares its bound c2s streams with the rest of them, so that
+// stanzas can be forwarded to a recipient bound at any other node.
+type Cluster struct {
+	cfg        *Config
+	ln         net.Listener
+	peers      []*peer
+	mu         sync.RWMutex
+	localStms  map[string]stream.C2S
+	remoteStms map[string][]*remoteC2S
+	members    map[string]*member
+	started    uint32
+	shutdownCh chan struct{}
+}
+
+// New returns a new cluster node instance.
+func New(config *Config) *Cluster {
+	c := &Cluster{
+		cfg:        config,
+		localStms:  make(map[string]stream.C2S),
+		remoteStms: make(map[string][]*remoteC2S),
+		members:    make(map[string]*member),
+		shutdownCh: make(chan struct{}),
+	}
+	for _, addr := range config.Peers {
+		c.peers = append(c.peers, newPeer(addr, c))
+	}
+	return c
+}
+
+// Start starts listening for incoming node connections
+// and connects to every configured cluster peer.
+func (c *Cluster) Start() error {
+	if !atomic.CompareAndSwapUint32(&c.started, 0, 1) {
+		return nil
+	}
+	address := c.cfg.BindAddress + ":" + strconv.Itoa(c.cfg.Port)
+	ln, err := listener.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	c.ln = ln
+	log.Infof("cluster: node %s listening at %s", c.cfg.Name, address)
+
+	go c.accept()
+	for _, p := range c.peers {
+		go p.loop()
+	}
+	return nil
+}
+
+// Shutdown leaves the cluster closing every node connection.
+func (c *Cluster) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapUint32(&c.started, 1, 0) {
+		return nil
+	}
+	close(c.shutdownCh)
+	if err := c.ln.Close(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	for _, m := range c.members {
+		m.conn.Close()
+	}
+	c.mu.Unlock()
+
+	// wait until peer connections have been closed
+	for _, p := range c.peers {
+		select {
+		case <-p.done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// BindStream shares a locally bound c2s stream with the rest of the cluster nodes.
+func (c *Cluster) BindStream(stm stream.C2S) {
+	c.mu.Lock()
+	c.localStms[stm.JID().String()] = stm
+	c.mu.Unlock()
+
+	c.broadcast(bindMessage(stm))
+}
+
+// UnbindStream notifies the rest of the cluster nodes that a local c2s stream has been unbound.
+func (c *Cluster) UnbindStream(stm stream.C2S) {
+	c.mu.Lock()
+	delete(c.localStms, stm.JID().String())
+	c.mu.Unlock()
+
+	c.broadcast(&message{typ: msgUnbind, jid: stm.JID().String()})
+}
+
+// UpdatePresence propagates a local c2s stream presence change.
+func (c *Cluster) UpdatePresence(stm stream.C2S) {
+	presence := stm.Presence()
+	if presence == nil {
+		return
+	}
+	c.broadcast(&message{typ: msgPresence, jid: stm.JID().String(), elem: xmpp.NewElementFromElement(presence)})
+}
+
+// UserStreams returns all user streams bound to any other cluster node.
+func (c *Cluster) UserStreams(username string) []stream.C2S {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var ret []stream.C2S
+	for _, stm := range c.remoteStms[username] {
+		ret = append(ret, stm)
+	}
+	return ret
+}
+
+// Streams returns every stream bound to any other cluster node.
+func (c *Cluster) Streams() []stream.C2S {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var ret []stream.C2S
+	for _, stms := range c.remoteStms {
+		for _, stm := range stms {
+			ret = append(ret, stm)
+		}
+	}
+	return ret
+}
+
+// Members returns the names of all currently connected cluster nodes.
+func (c *Cluster) Members() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var ret []string
+	for name := range c.members {
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+func (c *Cluster) broadcast(msg *message) {
+	for _, p := range c.peers {
+		p.send(msg)
+	}
+}
+
+func (c *Cluster) sendTo(node string, msg *message) error {
+	for _, p := range c.peers {
+		if p.getName() == node {
+			return p.send(msg)
+		}
+	}
+	return errPeerNotConnected
+}
+
+// localSnapshot returns bind messages for every local stream.
+func (c *Cluster) localSnapshot() []*message {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var ret []*message
+	for _, stm := range c.localStms {
+		ret = append(ret, bindMessage(stm))
+	}
+	return ret
+}
+
+// runs on its own goroutine
+func (c *Cluster) accept() {
+	for {
+		conn, err := c.ln.Accept()
+		if err != nil {
+			if err == listener.ErrClosed {
+				return
+			}
+			log.Error(err)
+			continue
+		}
+		go c.handleConn(conn)
+	}
+}
+
+// runs on its own goroutine
+func (c *Cluster) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	enc := gob.NewEncoder(conn)
+	dec := gob.NewDecoder(conn)
+
+	// handshake...
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	hello, err := c.handshake(enc, dec)
+	if err != nil {
+		log.Errorf("cluster: %s handshake failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	m := &member{name: hello.node, conn: conn}
+	c.registerMember(m)
+	defer c.unregisterMember(m)
+
+	for {
+		msg := &message{}
+		if err := msg.decode(dec); err != nil {
+			return
+		}
+		c.handleMessage(m.name, msg)
+	}
+}
+
+// handshake authenticates an incoming node connection by answering
+// each other's challenge, returning the remote node hello message.
+// The shared secret itself is never sent over the wire.
+func (c *Cluster) handshake(enc *gob.Encoder, dec *gob.Decoder) (*message, error) {
+	hello := &message{}
+	if err := hello.decode(dec); err != nil {
+		return nil, err
+	}
+	if hello.typ != msgHello || len(hello.node) == 0 || hello.node == c.cfg.Name || len(hello.text) == 0 {
+		return nil, errInvalidHandshake
+	}
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, err
+	}
+	reply := &message{typ: msgHello, node: c.cfg.Name, text: challenge}
+	if err := reply.encode(enc); err != nil {
+		return nil, err
+	}
+	auth := &message{}
+	if err := auth.decode(dec); err != nil {
+		return nil, err
+	}
+	if auth.typ != msgAuth || !verifyAuthProof(auth.text, c.cfg.Secret, dialerRole, hello.node, challenge, hello.text) {
+		return nil, errAuthFailed
+	}
+	authReply := &message{typ: msgAuth, text: authProof(c.cfg.Secret, acceptorRole, c.cfg.Name, hello.text, challenge)}
+	if err := authReply.encode(enc); err != nil {
+		return nil, err
+	}
+	return hello, nil
+}
+
+func (c *Cluster) handleMessage(node string, msg *message) {
+	switch msg.typ {
+	case msgBind:
+		j, err := jid.NewWithString(msg.jid, true)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		stm := newRemoteC2S(node, j, c)
+		stm.setPresence(presenceFromElement(msg.elem, j))
+		c.registerRemoteStream(stm)
+
+	case msgUnbind:
+		j, err := jid.NewWithString(msg.jid, true)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		c.unregisterRemoteStream(node, j)
+
+	case msgPresence:
+		j, err := jid.NewWithString(msg.jid, true)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		if stm := c.remoteStream(node, j); stm != nil {
+			stm.setPresence(presenceFromElement(msg.elem, j))
+		}
+
+	case msgRoute:
+		stanza, err := msg.stanza()
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		if stm := c.localStream(msg.jid); stm != nil {
+			stm.SendElement(stanza)
+		}
+
+	case msgDisconnect:
+		if stm := c.localStream(msg.jid); stm != nil {
+			stmErr, ok := streamErrors[msg.text]
+			if !ok {
+				stmErr = streamerror.ErrUndefinedCondition
+			}
+			go stm.Disconnect(stmErr)
+		}
+	}
+}
+
+func (c *Cluster) registerMember(m *member) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old := c.members[m.name]; old != nil {
+		old.conn.Close() // node reconnected... discard previous connection
+	}
+	c.members[m.name] = m
+	c.removeRemoteStreams(m.name)
+	log.Infof("cluster: node %s joined", m.name)
+}
+
+func (c *Cluster) unregisterMember(m *member) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.members[m.name] != m {
+		return // already replaced
+	}
+	delete(c.members, m.name)
+	c.removeRemoteStreams(m.name)
+	log.Infof("cluster: node %s left", m.name)
+}
+
+func (c *Cluster) localStream(j string) stream.C2S {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.localStms[j]
+}
+
+func (c *Cluster) remoteStream(node string, j *jid.JID) *remoteC2S {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, stm := range c.remoteStms[j.Node()] {
+		if stm.node == node && stm.Resource() == j.Resource() {
+			return stm
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) registerRemoteStream(stm *remoteC2S) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stms := c.remoteStms[stm.Username()]
+	for i, s := range stms {
+		if s.node == stm.node && s.Resource() == stm.Resource() {
+			stms[i] = stm
+			return
+		}
+	}
+	c.remoteStms[stm.Username()] = append(stms, stm)
+}
+
+func (c *Cluster) unregisterRemoteStream(node string, j *jid.JID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stms := c.remoteStms[j.Node()]
+	for i, s := range stms {
+		if s.node == node && s.Resource() == j.Resource() {
+			stms = append(stms[:i], stms[i+1:]...)
+			break
+		}
+	}
+	if len(stms) > 0 {
+		c.remoteStms[j.Node()] = stms
+	} else {
+		delete(c.remoteStms, j.Node())
+	}
+}
+
+// removeRemoteStreams must be invoked holding write lock
+func (c *Cluster) removeRemoteStreams(node string) {
+	for username, stms := range c.remoteStms {
+		var res []*remoteC2S
+		for _, stm := range stms {
+			if stm.node != node {
+				res = append(res, stm)
+			}
+		}
+		if len(res) > 0 {
+			c.remoteStms[username] = res
+		} else {
+			delete(c.remoteStms, username)
+		}
+	}
+}
+
+func bindMessage(stm stream.C2S) *message {
+	msg := &message{typ: msgBind, jid: stm.JID().String()}
+	if presence := stm.Presence(); presence != nil {
+		msg.elem = xmpp.NewElementFromElement(presence)
+	}
+	return msg
+}
+
+func presenceFromElement(elem *xmpp.Element, j *jid.JID) *xmpp.Presence {
+	if elem == nil {
+		return nil
+	}
+	presence, err := xmpp.NewPresenceFromElement(elem, j, j.ToBareJID())
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+	return presence
+}
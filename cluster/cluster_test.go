@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"context"
+	"encoding/gob"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCluster_Routing(t *testing.T) {
+	c1, c2 := tUtilClusterPair(t)
+	defer tUtilClusterShutdown(c1, c2)
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	c1.BindStream(stm1)
+
+	tUtilClusterWaitStreams(t, c2, "ortuman", 1)
+	remoteStms := c2.UserStreams("ortuman")
+	require.Equal(t, j1.String(), remoteStms[0].JID().String())
+	require.Equal(t, 1, len(c2.Streams()))
+
+	// forward stanza to owner node
+	msgID := uuid.New()
+	j2, _ := jid.NewWithString("noelia@jackal.im/garden", true)
+	msg := xmpp.NewMessageType(msgID, xmpp.ChatType)
+	msg.SetFromJID(j2)
+	msg.SetToJID(j1)
+	remoteStms[0].SendElement(msg)
+
+	elem := stm1.FetchElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, msgID, elem.ID())
+	_, ok := elem.(*xmpp.Message)
+	require.True(t, ok)
+
+	// presence update
+	p := xmpp.NewPresence(j1, j1.ToBareJID(), xmpp.AvailableType)
+	pr := xmpp.NewElementName("priority")
+	pr.SetText("8")
+	p.AppendElement(pr)
+	stm1.SetPresence(p)
+	c1.UpdatePresence(stm1)
+
+	tUtilClusterWait(t, func() bool {
+		presence := remoteStms[0].Presence()
+		return presence != nil && presence.Priority() == 8
+	})
+
+	// unbind
+	c1.UnbindStream(stm1)
+	tUtilClusterWaitStreams(t, c2, "ortuman", 0)
+}
+
+func TestCluster_Disconnect(t *testing.T) {
+	c1, c2 := tUtilClusterPair(t)
+	defer tUtilClusterShutdown(c1, c2)
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	c1.BindStream(stm1)
+
+	tUtilClusterWaitStreams(t, c2, "ortuman", 1)
+
+	// resource conflict at remote node
+	c2.UserStreams("ortuman")[0].Disconnect(streamerror.ErrResourceConstraint)
+	require.Equal(t, streamerror.ErrResourceConstraint, stm1.WaitDisconnection())
+}
+
+func TestCluster_Snapshot(t *testing.T) {
+	p1, p2 := tUtilClusterFreePort(t), tUtilClusterFreePort(t)
+	c1 := New(&Config{
+		Name:          "node1",
+		BindAddress:   "127.0.0.1",
+		Port:          p1,
+		Secret:        "s3cr3t",
+		Peers:         []string{"127.0.0.1:" + strconv.Itoa(p2)},
+		DialTimeout:   time.Second,
+		RetryInterval: time.Millisecond * 50,
+	})
+	require.Nil(t, c1.Start())
+	defer tUtilClusterShutdown(c1)
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	j2, _ := jid.NewWithString("ortuman@jackal.im/garden", true)
+	c1.BindStream(stream.NewMockC2S(uuid.New(), j1))
+	c1.BindStream(stream.NewMockC2S(uuid.New(), j2))
+
+	// a joining node should receive every already bound stream
+	c2 := New(&Config{
+		Name:          "node2",
+		BindAddress:   "127.0.0.1",
+		Port:          p2,
+		Secret:        "s3cr3t",
+		Peers:         []string{"127.0.0.1:" + strconv.Itoa(p1)},
+		DialTimeout:   time.Second,
+		RetryInterval: time.Millisecond * 50,
+	})
+	require.Nil(t, c2.Start())
+	defer tUtilClusterShutdown(c2)
+
+	tUtilClusterWaitStreams(t, c2, "ortuman", 2)
+}
+
+func TestCluster_NodeLeave(t *testing.T) {
+	c1, c2 := tUtilClusterPair(t)
+	defer tUtilClusterShutdown(c2)
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	c1.BindStream(stream.NewMockC2S(uuid.New(), j1))
+
+	tUtilClusterWaitStreams(t, c2, "ortuman", 1)
+
+	tUtilClusterShutdown(c1)
+	tUtilClusterWaitStreams(t, c2, "ortuman", 0)
+	tUtilClusterWait(t, func() bool { return len(c2.Members()) == 0 })
+}
+
+func TestCluster_InvalidSecret(t *testing.T) {
+	c1 := New(&Config{
+		Name:          "node1",
+		BindAddress:   "127.0.0.1",
+		Port:          tUtilClusterFreePort(t),
+		Secret:        "s3cr3t",
+		DialTimeout:   time.Second,
+		RetryInterval: time.Millisecond * 50,
+	})
+	require.Nil(t, c1.Start())
+	defer tUtilClusterShutdown(c1)
+
+	c2 := New(&Config{
+		Name:          "node2",
+		BindAddress:   "127.0.0.1",
+		Port:          tUtilClusterFreePort(t),
+		Secret:        "wrong",
+		Peers:         []string{tUtilClusterAddress(c1)},
+		DialTimeout:   time.Second,
+		RetryInterval: time.Millisecond * 50,
+	})
+	require.Nil(t, c2.Start())
+	defer tUtilClusterShutdown(c2)
+
+	time.Sleep(time.Millisecond * 250)
+	require.Equal(t, 0, len(c1.Members()))
+	require.False(t, c2.peers[0].isConnected())
+}
+
+func TestCluster_UnauthenticatedNode(t *testing.T) {
+	c1 := New(&Config{
+		Name:          "node1",
+		BindAddress:   "127.0.0.1",
+		Port:          tUtilClusterFreePort(t),
+		Secret:        "s3cr3t",
+		DialTimeout:   time.Second,
+		RetryInterval: time.Millisecond * 50,
+	})
+	require.Nil(t, c1.Start())
+	defer tUtilClusterShutdown(c1)
+
+	conn, err := net.Dial("tcp", tUtilClusterAddress(c1))
+	require.Nil(t, err)
+	defer conn.Close()
+
+	enc := gob.NewEncoder(conn)
+	dec := gob.NewDecoder(conn)
+
+	// the shared secret is never disclosed
+	hello := &message{typ: msgHello, node: "node2", text: "n0nc3"}
+	require.Nil(t, hello.encode(enc))
+
+	reply := &message{}
+	require.Nil(t, reply.decode(dec))
+	require.Equal(t, msgHello, reply.typ)
+	require.NotEqual(t, "s3cr3t", reply.text)
+
+	auth := &message{typ: msgAuth, text: authProof("wrong", dialerRole, "node2", reply.text, "n0nc3")}
+	require.Nil(t, auth.encode(enc))
+
+	// connection closed by remote node
+	require.NotNil(t, (&message{}).decode(dec))
+	require.Equal(t, 0, len(c1.Members()))
+}
+
+func TestCluster_PeerSendOverflow(t *testing.T) {
+	c := New(&Config{Name: "node1", Secret: "s3cr3t"})
+	p := newPeer("127.0.0.1:5999", c)
+	require.Equal(t, errPeerNotConnected, p.send(&message{typ: msgUnbind, jid: "ortuman@jackal.im/balcony"}))
+
+	p.connected = true
+
+	// a stuck peer never blocks its sender
+	doneCh := make(chan struct{})
+	var errs []error
+	go func() {
+		for i := 0; i < peerSendQueueSize+2; i++ {
+			if err := p.send(&message{typ: msgUnbind, jid: "ortuman@jackal.im/balcony"}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+		break
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "peer send blocked")
+	}
+	require.Equal(t, 1, len(p.resync))
+	require.Equal(t, []error{errPeerQueueFull, errPeerQueueFull}, errs)
+}
+
+func tUtilClusterPair(t *testing.T) (*Cluster, *Cluster) {
+	p1, p2 := tUtilClusterFreePort(t), tUtilClusterFreePort(t)
+	c1 := New(&Config{
+		Name:          "node1",
+		BindAddress:   "127.0.0.1",
+		Port:          p1,
+		Secret:        "s3cr3t",
+		Peers:         []string{"127.0.0.1:" + strconv.Itoa(p2)},
+		DialTimeout:   time.Second,
+		RetryInterval: time.Millisecond * 50,
+	})
+	c2 := New(&Config{
+		Name:          "node2",
+		BindAddress:   "127.0.0.1",
+		Port:          p2,
+		Secret:        "s3cr3t",
+		Peers:         []string{"127.0.0.1:" + strconv.Itoa(p1)},
+		DialTimeout:   time.Second,
+		RetryInterval: time.Millisecond * 50,
+	})
+	require.Nil(t, c1.Start())
+	require.Nil(t, c2.Start())
+
+	tUtilClusterWait(t, func() bool {
+		return c1.peers[0].isConnected() && c2.peers[0].isConnected() && len(c1.Members()) == 1 && len(c2.Members()) == 1
+	})
+	return c1, c2
+}
+
+func tUtilClusterWaitStreams(t *testing.T, c *Cluster, username string, count int) {
+	tUtilClusterWait(t, func() bool { return len(c.UserStreams(username)) == count })
+}
+
+func tUtilClusterWait(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second * 5)
+	for !cond() {
+		if time.Now().After(deadline) {
+			require.FailNow(t, "condition not satisfied")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func tUtilClusterShutdown(cs ...*Cluster) {
+	for _, c := range cs {
+		c.Shutdown(context.Background())
+	}
+}
+
+func tUtilClusterAddress(c *Cluster) string {
+	return c.cfg.BindAddress + ":" + strconv.Itoa(c.cfg.Port)
+}
+
+func tUtilClusterFreePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
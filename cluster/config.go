@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultBindAddress   = "127.0.0.1"
+	defaultPort          = 5999
+	defaultDialTimeout   = time.Duration(5) * time.Second
+	defaultRetryInterval = time.Duration(3) * time.Second
+)
+
+// Config represents a cluster node configuration.
+type Config struct {
+	Name          string
+	BindAddress   string
+	Port          int
+	Secret        string
+	Peers         []string
+	DialTimeout   time.Duration
+	RetryInterval time.Duration
+}
+
+type configProxy struct {
+	Name          string   `yaml:"name"`
+	BindAddress   string   `yaml:"bind_addr"`
+	Port          int      `yaml:"port"`
+	Secret        string   `yaml:"secret"`
+	Peers         []string `yaml:"peers"`
+	DialTimeout   int      `yaml:"dial_timeout"`
+	RetryInterval int      `yaml:"retry_interval"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.Name = p.Name
+	if len(c.Name) == 0 {
+		return errors.New("cluster.Config: node name must be specified")
+	}
+	c.BindAddress = p.BindAddress
+	if len(c.BindAddress) == 0 {
+		c.BindAddress = defaultBindAddress
+	}
+	c.Port = p.Port
+	if c.Port == 0 {
+		c.Port = defaultPort
+	}
+	c.Secret = p.Secret
+	if len(c.Secret) == 0 {
+		return errors.New("cluster.Config: secret must be specified")
+	}
+	c.Peers = p.Peers
+	c.DialTimeout = time.Duration(p.DialTimeout) * time.Second
+	if c.DialTimeout == 0 {
+		c.DialTimeout = defaultDialTimeout
+	}
+	c.RetryInterval = time.Duration(p.RetryInterval) * time.Second
+	if c.RetryInterval == 0 {
+		c.RetryInterval = defaultRetryInterval
+	}
+	return nil
+}
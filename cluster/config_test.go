@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig(t *testing.T) {
+	cfg := Config{}
+	rawCfg := `
+port: 6000
+`
+	err := yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.NotNil(t, err) // missing node name
+
+	rawCfg = `
+name: node1
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.NotNil(t, err) // missing secret
+
+	rawCfg = `
+name: node1
+secret: s3cr3t
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err) // defaults
+	require.Equal(t, "node1", cfg.Name)
+	require.Equal(t, defaultBindAddress, cfg.BindAddress)
+	require.Equal(t, defaultPort, cfg.Port)
+	require.Equal(t, defaultDialTimeout, cfg.DialTimeout)
+	require.Equal(t, defaultRetryInterval, cfg.RetryInterval)
+	require.Equal(t, 0, len(cfg.Peers))
+
+	rawCfg = `
+name: node2
+bind_addr: 127.0.0.1
+port: 6000
+secret: s3cr3t
+dial_timeout: 10
+retry_interval: 1
+peers:
+  - 127.0.0.1:5999
+  - 127.0.0.1:6001
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, "node2", cfg.Name)
+	require.Equal(t, "127.0.0.1", cfg.BindAddress)
+	require.Equal(t, 6000, cfg.Port)
+	require.Equal(t, "s3cr3t", cfg.Secret)
+	require.Equal(t, time.Duration(10)*time.Second, cfg.DialTimeout)
+	require.Equal(t, time.Duration(1)*time.Second, cfg.RetryInterval)
+	require.Equal(t, []string{"127.0.0.1:5999", "127.0.0.1:6001"}, cfg.Peers)
+}
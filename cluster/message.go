@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"encoding/gob"
+	"fmt"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+type messageType uint8
+
+const (
+	// handshake message exchanged as soon as a node connection is established
+	msgHello messageType = iota
+
+	// a c2s stream has been bound to the sender node
+	msgBind
+
+	// a c2s stream has been unbound from the sender node
+	msgUnbind
+
+	// a c2s stream presence has been updated
+	msgPresence
+
+	// deliver a stanza to a c2s stream bound to the receiver node
+	msgRoute
+
+	// disconnect a c2s stream bound to the receiver node
+	msgDisconnect
+
+	// handshake message carrying the sender answer to the receiver challenge
+	msgAuth
+)
+
+// message represents an inter-node message.
+type message struct {
+	typ  messageType
+	node string
+	jid  string
+	text string
+	elem *xmpp.Element
+}
+
+func (m *message) decode(dec *gob.Decoder) error {
+	if err := dec.Decode(&m.typ); err != nil {
+		return err
+	}
+	if err := dec.Decode(&m.node); err != nil {
+		return err
+	}
+	if err := dec.Decode(&m.jid); err != nil {
+		return err
+	}
+	if err := dec.Decode(&m.text); err != nil {
+		return err
+	}
+	var hasElem bool
+	if err := dec.Decode(&hasElem); err != nil {
+		return err
+	}
+	if hasElem {
+		m.elem = &xmpp.Element{}
+		m.elem.FromGob(dec)
+	}
+	return nil
+}
+
+func (m *message) encode(enc *gob.Encoder) error {
+	if err := enc.Encode(&m.typ); err != nil {
+		return err
+	}
+	if err := enc.Encode(&m.node); err != nil {
+		return err
+	}
+	if err := enc.Encode(&m.jid); err != nil {
+		return err
+	}
+	if err := enc.Encode(&m.text); err != nil {
+		return err
+	}
+	hasElem := m.elem != nil
+	if err := enc.Encode(&hasElem); err != nil {
+		return err
+	}
+	if hasElem {
+		m.elem.ToGob(enc)
+	}
+	return nil
+}
+
+// stanza returns the message element as a typed stanza.
+func (m *message) stanza() (xmpp.Stanza, error) {
+	if m.elem == nil {
+		return nil, fmt.Errorf("cluster: missing stanza element")
+	}
+	fromJID, err := jid.NewWithString(m.elem.From(), true)
+	if err != nil {
+		return nil, err
+	}
+	toJID, err := jid.NewWithString(m.elem.To(), true)
+	if err != nil {
+		return nil, err
+	}
+	switch m.elem.Name() {
+	case "iq":
+		return xmpp.NewIQFromElement(m.elem, fromJID, toJID)
+	case "message":
+		return xmpp.NewMessageFromElement(m.elem, fromJID, toJID)
+	case "presence":
+		return xmpp.NewPresenceFromElement(m.elem, fromJID, toJID)
+	}
+	return nil, fmt.Errorf("cluster: unsupported stanza: %s", m.elem.Name())
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package cluster
+
+import (
+	"encoding/gob"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+)
+
+const peerSendQueueSize = 1024
+
+var (
+	errPeerNotConnected = errors.New("cluster: peer not connected")
+	errPeerQueueFull    = errors.New("cluster: peer send queue is full")
+)
+
+// peer represents an outgoing connection to a statically configured cluster node.
+// Local stream bindings and forwarded stanzas are always sent through it,
+// while the incoming connection accepted from the same node is used to receive them.
+type peer struct {
+	addr    string
+	cluster *Cluster
+	sendCh  chan *message
+	resync  chan struct{}
+	doneCh  chan struct{}
+
+	mu        sync.RWMutex
+	name      string
+	connected bool
+}
+
+func newPeer(addr string, cluster *Cluster) *peer {
+	return &peer{
+		addr:    addr,
+		cluster: cluster,
+		sendCh:  make(chan *message, peerSendQueueSize),
+		resync:  make(chan struct{}, 1),
+		doneCh:  make(chan struct{}),
+	}
+}
+
+func (p *peer) getName() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if !p.connected {
+		return ""
+	}
+	return p.name
+}
+
+func (p *peer) isConnected() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.connected
+}
+
+func (p *peer) done() <-chan struct{} {
+	return p.doneCh
+}
+
+// send enqueues a message to be delivered to the peer node, returning an error
+// in case it has been discarded. Messages are discarded while the peer is not
+// connected, as the whole binding state will be sent again once the connection
+// is reestablished. send never blocks: in case the peer can't keep up and its
+// queue gets full the connection is dropped, forcing a resync on reconnection.
+func (p *peer) send(msg *message) error {
+	if !p.isConnected() {
+		return errPeerNotConnected
+	}
+	select {
+	case p.sendCh <- msg:
+		return nil
+	default:
+		select {
+		case p.resync <- struct{}{}:
+			log.Warnf("cluster: node %s send queue is full... resyncing", p.addr)
+		default:
+			break // resync already requested
+		}
+		return errPeerQueueFull
+	}
+}
+
+// runs on its own goroutine
+func (p *peer) loop() {
+	defer close(p.doneCh)
+	for {
+		conn, err := p.connect()
+		if err != nil {
+			log.Warnf("cluster: failed to connect to %s: %v", p.addr, err)
+		} else {
+			p.serve(conn)
+		}
+		select {
+		case <-time.After(p.cluster.cfg.RetryInterval):
+			break
+		case <-p.cluster.shutdownCh:
+			return
+		}
+	}
+}
+
+func (p *peer) connect() (net.Conn, error) {
+	cfg := p.cluster.cfg
+	conn, err := net.DialTimeout("tcp", p.addr, cfg.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	enc := gob.NewEncoder(conn)
+	dec := gob.NewDecoder(conn)
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	reply, err := p.handshake(enc, dec)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	p.mu.Lock()
+	p.name = reply.node
+	p.connected = true
+	p.mu.Unlock()
+	log.Infof("cluster: connected to node %s (%s)", reply.node, p.addr)
+	return &peerConn{Conn: conn, enc: enc}, nil
+}
+
+// handshake authenticates both nodes by answering each other's challenge,
+// returning the remote node hello message.
+func (p *peer) handshake(enc *gob.Encoder, dec *gob.Decoder) (*message, error) {
+	cfg := p.cluster.cfg
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, err
+	}
+	hello := &message{typ: msgHello, node: cfg.Name, text: challenge}
+	if err := hello.encode(enc); err != nil {
+		return nil, err
+	}
+	reply := &message{}
+	if err := reply.decode(dec); err != nil {
+		return nil, err
+	}
+	if reply.typ != msgHello || len(reply.node) == 0 || len(reply.text) == 0 {
+		return nil, errInvalidHandshake
+	}
+	auth := &message{typ: msgAuth, text: authProof(cfg.Secret, dialerRole, cfg.Name, reply.text, challenge)}
+	if err := auth.encode(enc); err != nil {
+		return nil, err
+	}
+	authReply := &message{}
+	if err := authReply.decode(dec); err != nil {
+		return nil, err
+	}
+	if authReply.typ != msgAuth || !verifyAuthProof(authReply.text, cfg.Secret, acceptorRole, reply.node, challenge, reply.text) {
+		return nil, errAuthFailed
+	}
+	return reply, nil
+}
+
+func (p *peer) serve(conn net.Conn) {
+	defer p.disconnect(conn)
+
+	pc := conn.(*peerConn)
+
+	// detect remote connection close
+	closeCh := make(chan struct{})
+	go func() {
+		var b [1]byte
+		conn.Read(b[:])
+		close(closeCh)
+	}()
+
+	// share local bindings snapshot
+	for _, msg := range p.cluster.localSnapshot() {
+		if err := msg.encode(pc.enc); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+	for {
+		select {
+		case msg := <-p.sendCh:
+			if err := msg.encode(pc.enc); err != nil {
+				log.Error(err)
+				return
+			}
+		case <-p.resync:
+			return
+		case <-closeCh:
+			return
+		case <-p.cluster.shutdownCh:
+			return
+		}
+	}
+}
+
+func (p *peer) disconnect(conn net.Conn) {
+	p.mu.Lock()
+	p.connected = false
+	p.mu.Unlock()
+
+	conn.Close()
+
+	// drain pending messages
+	for {
+		select {
+		case <-p.sendCh:
+		case <-p.resync:
+		default:
+			log.Infof("cluster: disconnected from node %s (%s)", p.name, p.addr)
+			return
+		}
+	}
+}
+
+type peerConn struct {
+	net.Conn
+	enc *gob.Encoder
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package listener
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+)
+
+// ErrHandoffFailed will be returned by Handoff if the new process
+// exited before notifying it was ready to take over.
+var ErrHandoffFailed = errors.New("listener: new process failed to start")
+
+// ErrHandoffTimeout will be returned by Handoff if the new process
+// didn't notify it was ready within the specified timeout.
+var ErrHandoffTimeout = errors.New("listener: new process start timed out")
+
+// Handoff starts a new instance of the running executable passing every active
+// listener to it, and waits until it notifies it's ready to accept connections.
+// The new process will be killed in case it doesn't get ready before timeout expires.
+func Handoff(args []string, timeout time.Duration) error {
+	files, addresses, err := activeFiles()
+	if err != nil {
+		return err
+	}
+	defer closeFiles(files)
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, readyW)
+	cmd.Env = append(environ(),
+		listenersEnv+"="+strings.Join(addresses, ","),
+		readyFdEnv+"="+strconv.Itoa(firstInheritedFd+len(files)),
+	)
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return err
+	}
+	go cmd.Wait()
+
+	log.Infof("listener: handing off %d listener(s) to process %d", len(files), cmd.Process.Pid)
+
+	readyR.SetReadDeadline(time.Now().Add(timeout))
+	var b [1]byte
+	if n, err := readyR.Read(b[:]); n == 0 {
+		cmd.Process.Kill()
+		if os.IsTimeout(err) {
+			return ErrHandoffTimeout
+		}
+		return ErrHandoffFailed
+	}
+	return nil
+}
+
+// environ returns current process environment excluding handoff variables.
+func environ() []string {
+	var ret []string
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, listenersEnv+"=") || strings.HasPrefix(kv, readyFdEnv+"=") {
+			continue
+		}
+		ret = append(ret, kv)
+	}
+	return ret
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package listener
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ortuman/jackal/log"
+)
+
+const (
+	listenersEnv = "JACKAL_LISTENERS"
+	readyFdEnv   = "JACKAL_READY_FD"
+)
+
+// first file descriptor passed to a child process through ExtraFiles
+const firstInheritedFd = 3
+
+// ErrClosed will be returned by Accept once a listener has been closed.
+var ErrClosed = errors.New("listener: closed")
+
+var (
+	mu          sync.Mutex
+	active      = make(map[string]*trackedListener)
+	inherited   map[string]net.Listener
+	inheritOnce sync.Once
+)
+
+type trackedListener struct {
+	net.Listener
+	address string
+	closed  uint32
+}
+
+func (l *trackedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil && atomic.LoadUint32(&l.closed) == 1 {
+		return nil, ErrClosed
+	}
+	return conn, err
+}
+
+// Close closes the listener. Closing an already closed listener is a no-op.
+func (l *trackedListener) Close() error {
+	if !atomic.CompareAndSwapUint32(&l.closed, 0, 1) {
+		return nil
+	}
+	mu.Lock()
+	if active[l.address] == l {
+		delete(active, l.address)
+	}
+	mu.Unlock()
+	return l.Listener.Close()
+}
+
+// Listen announces on the local network address.
+// In case the address listener was inherited from a parent process
+// it will be reused instead of creating a new one.
+func Listen(network, address string) (net.Listener, error) {
+	inheritOnce.Do(loadInherited)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	ln, ok := inherited[address]
+	if ok {
+		delete(inherited, address)
+		log.Infof("listener: reusing inherited listener at %s", address)
+	} else {
+		var err error
+		ln, err = net.Listen(network, address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tl := &trackedListener{Listener: ln, address: address}
+	active[address] = tl
+	return tl, nil
+}
+
+// CloseAll closes every active listener, so that no more connections are accepted.
+func CloseAll() {
+	mu.Lock()
+	var lns []*trackedListener
+	for _, ln := range active {
+		lns = append(lns, ln)
+	}
+	mu.Unlock()
+
+	for _, ln := range lns {
+		if err := ln.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// CloseUnclaimed closes every listener inherited from a parent process
+// that hasn't been reused, which happens whenever its address
+// has been removed from the configuration before restarting.
+func CloseUnclaimed() {
+	inheritOnce.Do(loadInherited)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for address, ln := range inherited {
+		if err := ln.Close(); err != nil {
+			log.Error(err)
+		}
+		delete(inherited, address)
+		log.Infof("listener: closed unclaimed inherited listener at %s", address)
+	}
+}
+
+// NotifyReady notifies the parent process that handed off its listeners
+// that this process is ready to take over.
+func NotifyReady() error {
+	fdStr := os.Getenv(readyFdEnv)
+	if len(fdStr) == 0 {
+		return nil
+	}
+	os.Unsetenv(readyFdEnv)
+
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil {
+		return err
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// activeFiles returns a duplicated file descriptor for every active listener.
+func activeFiles() ([]*os.File, []string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var addresses []string
+	for address := range active {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	var files []*os.File
+	for _, address := range addresses {
+		filer, ok := active[address].Listener.(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			closeFiles(files)
+			return nil, nil, errors.New("listener: unsupported listener type at " + address)
+		}
+		f, err := filer.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, nil, err
+		}
+		files = append(files, f)
+	}
+	return files, addresses, nil
+}
+
+func loadInherited() {
+	inherited = make(map[string]net.Listener)
+
+	addrStr := os.Getenv(listenersEnv)
+	if len(addrStr) == 0 {
+		return
+	}
+	os.Unsetenv(listenersEnv)
+
+	for i, address := range strings.Split(addrStr, ",") {
+		f := os.NewFile(uintptr(firstInheritedFd+i), address)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		inherited[address] = ln
+	}
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
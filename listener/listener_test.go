@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package listener
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	helperAddrEnv = "JACKAL_TEST_HANDOFF_ADDR"
+	helperFailEnv = "JACKAL_TEST_HANDOFF_FAIL"
+)
+
+func TestListener_CloseAll(t *testing.T) {
+	ln, err := Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := ln.Accept()
+		errCh <- err
+	}()
+	CloseAll()
+
+	select {
+	case err := <-errCh:
+		require.Equal(t, ErrClosed, err)
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "accept not interrupted")
+	}
+	require.Nil(t, ln.Close()) // already closed
+
+	files, addresses, err := activeFiles()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(files))
+	require.Equal(t, 0, len(addresses))
+}
+
+func TestListener_Handoff(t *testing.T) {
+	addr := tUtilListenerFreeAddress(t)
+	ln, err := Listen("tcp", addr)
+	require.Nil(t, err)
+	defer ln.Close()
+
+	os.Setenv(helperAddrEnv, addr)
+	defer os.Unsetenv(helperAddrEnv)
+
+	require.Nil(t, Handoff(tUtilListenerHelperArgs(), time.Second*10))
+
+	// stop accepting... new process should take over
+	ln.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	b, err := ioutil.ReadAll(conn)
+	require.Nil(t, err)
+	require.Equal(t, "handoff", string(b))
+}
+
+func TestListener_HandoffFailed(t *testing.T) {
+	addr := tUtilListenerFreeAddress(t)
+	ln, err := Listen("tcp", addr)
+	require.Nil(t, err)
+	defer ln.Close()
+
+	os.Setenv(helperAddrEnv, addr)
+	os.Setenv(helperFailEnv, "1")
+	defer os.Unsetenv(helperAddrEnv)
+	defer os.Unsetenv(helperFailEnv)
+
+	require.Equal(t, ErrHandoffFailed, Handoff(tUtilListenerHelperArgs(), time.Second*10))
+}
+
+func TestListener_CloseUnclaimed(t *testing.T) {
+	inheritOnce.Do(loadInherited)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := ln.Addr().String()
+
+	mu.Lock()
+	inherited[addr] = ln
+	mu.Unlock()
+
+	CloseUnclaimed()
+
+	mu.Lock()
+	require.Equal(t, 0, len(inherited))
+	mu.Unlock()
+
+	_, err = net.Dial("tcp", addr)
+	require.NotNil(t, err)
+}
+
+// TestListener_HelperProcess is not a real test. It's used as
+// the new process instance when testing listener handoff.
+func TestListener_HelperProcess(t *testing.T) {
+	addr := os.Getenv(helperAddrEnv)
+	if len(addr) == 0 || len(os.Getenv(listenersEnv)) == 0 {
+		return
+	}
+	if len(os.Getenv(helperFailEnv)) > 0 {
+		os.Exit(1)
+	}
+	// parent process is still listening... so listener must be inherited
+	ln, err := Listen("tcp", addr)
+	if err != nil {
+		os.Exit(1)
+	}
+	CloseUnclaimed()
+	if err := NotifyReady(); err != nil {
+		os.Exit(1)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		os.Exit(1)
+	}
+	conn.Write([]byte("handoff"))
+	conn.Close()
+	os.Exit(0)
+}
+
+func tUtilListenerHelperArgs() []string {
+	return []string{os.Args[0], "-test.run=TestListener_HelperProcess"}
+}
+
+func tUtilListenerFreeAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
@@ -11,7 +11,7 @@ func (_ *disabledLogger) Level() Level {
 	return OffLevel
 }
 
-func (_ *disabledLogger) Log(level Level, pkg string, file string, line int, format string, args ...interface{}) {
+func (_ *disabledLogger) Log(level Level, pkg string, file string, line int, fields Fields, format string, args ...interface{}) {
 }
 
 func (_ *disabledLogger) Close() error { return nil }
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package log
+
+// Entry represents a set of structured fields to be attached
+// to every message logged through it.
+type Entry struct {
+	fields Fields
+}
+
+// WithFields returns a new log entry carrying the given fields.
+func WithFields(fields Fields) *Entry {
+	return (&Entry{}).WithFields(fields)
+}
+
+// WithFields returns a new log entry carrying both the entry and the given fields.
+func (e *Entry) WithFields(fields Fields) *Entry {
+	f := make(Fields, len(e.fields)+len(fields))
+	for k, v := range e.fields {
+		f[k] = v
+	}
+	for k, v := range fields {
+		f[k] = v
+	}
+	return &Entry{fields: f}
+}
+
+// Debugf writes a 'debug' message to configured logger.
+func (e *Entry) Debugf(format string, args ...interface{}) {
+	if inst := instance(); inst.Level() <= DebugLevel {
+		ci := getCallerInfo()
+		inst.Log(DebugLevel, ci.pkg, ci.filename, ci.line, e.fields, format, args...)
+	}
+}
+
+// Infof writes a 'info' message to configured logger.
+func (e *Entry) Infof(format string, args ...interface{}) {
+	if inst := instance(); inst.Level() <= InfoLevel {
+		ci := getCallerInfo()
+		inst.Log(InfoLevel, ci.pkg, ci.filename, ci.line, e.fields, format, args...)
+	}
+}
+
+// Warnf writes a 'warning' message to configured logger.
+func (e *Entry) Warnf(format string, args ...interface{}) {
+	if inst := instance(); inst.Level() <= WarningLevel {
+		ci := getCallerInfo()
+		inst.Log(WarningLevel, ci.pkg, ci.filename, ci.line, e.fields, format, args...)
+	}
+}
+
+// Errorf writes an 'error' message to configured logger.
+func (e *Entry) Errorf(format string, args ...interface{}) {
+	if inst := instance(); inst.Level() <= ErrorLevel {
+		ci := getCallerInfo()
+		inst.Log(ErrorLevel, ci.pkg, ci.filename, ci.line, e.fields, format, args...)
+	}
+}
+
+// Error writes an error value to configured logger.
+func (e *Entry) Error(err error) {
+	if inst := instance(); inst.Level() <= ErrorLevel {
+		ci := getCallerInfo()
+		inst.Log(ErrorLevel, ci.pkg, ci.filename, ci.line, e.fields, "%v", err)
+	}
+}
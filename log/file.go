@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// RotationConfig represents a log file rotation configuration.
+type RotationConfig struct {
+	// MaxSize is the size in bytes a log file can reach before being rotated.
+	MaxSize int64
+
+	// Interval is the maximum amount of time a log file is written to before being rotated.
+	Interval time.Duration
+
+	// MaxBackups is the maximum number of rotated log files to retain.
+	MaxBackups int
+}
+
+// File represents a log file supporting size and time based rotation.
+type File struct {
+	path         string
+	cfg          RotationConfig
+	mu           sync.Mutex
+	f            *os.File
+	size         int64
+	openedAt     time.Time
+	rotateFailed bool
+}
+
+// OpenFile opens a log file in append mode, creating it if necessary.
+func OpenFile(path string, cfg RotationConfig) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	lf := &File{path: path, cfg: cfg}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+// Write writes a log line to the file, rotating it beforehand if needed.
+func (lf *File) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if lf.shouldRotate(len(p)) {
+		// keep on writing to the current file in case of failure,
+		// rotation will be retried on next write
+		err := lf.rotate()
+		if err != nil && !lf.rotateFailed {
+			fmt.Fprintf(os.Stderr, "log: failed to rotate %s: %v\n", lf.path, err)
+		}
+		lf.rotateFailed = err != nil
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// Reopen closes and reopens the log file.
+// Intended to be used after log file has been moved by an external tool.
+func (lf *File) Reopen() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	old := lf.f
+	if err := lf.open(); err != nil {
+		return err
+	}
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Close closes the log file.
+func (lf *File) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return nil
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
+
+func (lf *File) open() error {
+	f, err := os.OpenFile(lf.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	lf.f = f
+	lf.size = fi.Size()
+	lf.openedAt = time.Now()
+	return nil
+}
+
+func (lf *File) shouldRotate(n int) bool {
+	if lf.cfg.MaxSize > 0 && lf.size > 0 && lf.size+int64(n) > lf.cfg.MaxSize {
+		return true
+	}
+	return lf.cfg.Interval > 0 && time.Since(lf.openedAt) >= lf.cfg.Interval
+}
+
+// rotate moves current log file to a backup one, only replacing
+// the file being written to once a new one has been opened.
+func (lf *File) rotate() error {
+	backupPath := lf.path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(lf.path, backupPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	old := lf.f
+	if err := lf.open(); err != nil {
+		return err
+	}
+	old.Close()
+	lf.removeExpiredBackups()
+	return nil
+}
+
+func (lf *File) removeExpiredBackups() {
+	if lf.cfg.MaxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(lf.path + ".*")
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, m := range matches {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(m, lf.path+".")); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	if len(backups) <= lf.cfg.MaxBackups {
+		return
+	}
+	// backup file names are time ordered
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-lf.cfg.MaxBackups] {
+		os.Remove(backup)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile_SizeRotation(t *testing.T) {
+	dir, path := tUtilLogFilePath(t)
+	defer os.RemoveAll(dir)
+
+	f, err := OpenFile(path, RotationConfig{MaxSize: 16, MaxBackups: 2})
+	require.Nil(t, err)
+	defer f.Close()
+
+	for i := 0; i < 5; i++ {
+		_, err := f.Write([]byte("0123456789\n"))
+		require.Nil(t, err)
+		time.Sleep(time.Millisecond * 5) // guarantee distinct backup names
+	}
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	require.Equal(t, "0123456789\n", string(b))
+
+	// only two backups should be retained
+	backups, _ := filepath.Glob(path + ".*")
+	require.Equal(t, 2, len(backups))
+}
+
+func TestFile_RotationFailure(t *testing.T) {
+	dir, path := tUtilLogFilePath(t)
+	defer os.RemoveAll(dir)
+
+	f, err := OpenFile(path, RotationConfig{MaxSize: 16})
+	require.Nil(t, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte("0123456789\n"))
+	require.Nil(t, err)
+
+	// log directory removed... keep on writing to current file
+	require.Nil(t, os.RemoveAll(filepath.Dir(path)))
+	_, err = f.Write([]byte("0123456789\n"))
+	require.Nil(t, err)
+
+	// rotation gets retried on next write
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	_, err = f.Write([]byte("abcdefghij\n"))
+	require.Nil(t, err)
+
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	require.Equal(t, "abcdefghij\n", string(b))
+}
+
+func TestFile_TimeRotation(t *testing.T) {
+	dir, path := tUtilLogFilePath(t)
+	defer os.RemoveAll(dir)
+
+	f, err := OpenFile(path, RotationConfig{Interval: time.Millisecond * 50})
+	require.Nil(t, err)
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+	time.Sleep(time.Millisecond * 100)
+	f.Write([]byte("second\n"))
+
+	b, _ := ioutil.ReadFile(path)
+	require.Equal(t, "second\n", string(b))
+
+	backups, _ := filepath.Glob(path + ".*")
+	require.Equal(t, 1, len(backups))
+	b, _ = ioutil.ReadFile(backups[0])
+	require.Equal(t, "first\n", string(b))
+}
+
+func TestFile_Reopen(t *testing.T) {
+	dir, path := tUtilLogFilePath(t)
+	defer os.RemoveAll(dir)
+
+	f, err := OpenFile(path, RotationConfig{})
+	require.Nil(t, err)
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+
+	// externally rotated
+	require.Nil(t, os.Rename(path, path+".1"))
+	f.Write([]byte("second\n"))
+
+	output := newWriterBuffer()
+	l, _ := New("info", "", output, f)
+	Set(l)
+	defer Unset()
+
+	require.Nil(t, Reopen())
+	f.Write([]byte("third\n"))
+
+	b, _ := ioutil.ReadFile(path + ".1")
+	require.Equal(t, "first\nsecond\n", string(b))
+	b, _ = ioutil.ReadFile(path)
+	require.Equal(t, "third\n", string(b))
+}
+
+func tUtilLogFilePath(t *testing.T) (string, string) {
+	dir, err := ioutil.TempDir("", "jackal-log")
+	require.Nil(t, err)
+	return dir, filepath.Join(dir, "jackal.log")
+}
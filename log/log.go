@@ -6,12 +6,14 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -47,18 +49,32 @@ const (
 	OffLevel
 )
 
+// Format represents log output format type.
+type Format int
+
+const (
+	// TextFormat represents a human readable log output format.
+	TextFormat Format = iota
+
+	// JSONFormat represents a JSON lines log output format.
+	JSONFormat
+)
+
+// Fields represents a set of structured fields attached to a log message.
+type Fields map[string]interface{}
+
 type Logger interface {
 	io.Closer
 
 	Level() Level
-	Log(level Level, pkg string, file string, line int, format string, args ...interface{})
+	Log(level Level, pkg string, file string, line int, fields Fields, format string, args ...interface{})
 }
 
 // Debugf writes a 'debug' message to configured logger.
 func Debugf(format string, args ...interface{}) {
 	if inst := instance(); inst.Level() <= DebugLevel {
 		ci := getCallerInfo()
-		inst.Log(DebugLevel, ci.pkg, ci.filename, ci.line, format, args...)
+		inst.Log(DebugLevel, ci.pkg, ci.filename, ci.line, nil, format, args...)
 	}
 }
 
@@ -66,7 +82,7 @@ func Debugf(format string, args ...interface{}) {
 func Infof(format string, args ...interface{}) {
 	if inst := instance(); inst.Level() <= InfoLevel {
 		ci := getCallerInfo()
-		inst.Log(InfoLevel, ci.pkg, ci.filename, ci.line, format, args...)
+		inst.Log(InfoLevel, ci.pkg, ci.filename, ci.line, nil, format, args...)
 	}
 }
 
@@ -74,7 +90,7 @@ func Infof(format string, args ...interface{}) {
 func Warnf(format string, args ...interface{}) {
 	if inst := instance(); inst.Level() <= WarningLevel {
 		ci := getCallerInfo()
-		inst.Log(WarningLevel, ci.pkg, ci.filename, ci.line, format, args...)
+		inst.Log(WarningLevel, ci.pkg, ci.filename, ci.line, nil, format, args...)
 	}
 }
 
@@ -82,7 +98,7 @@ func Warnf(format string, args ...interface{}) {
 func Errorf(format string, args ...interface{}) {
 	if inst := instance(); inst.Level() <= ErrorLevel {
 		ci := getCallerInfo()
-		inst.Log(ErrorLevel, ci.pkg, ci.filename, ci.line, format, args...)
+		inst.Log(ErrorLevel, ci.pkg, ci.filename, ci.line, nil, format, args...)
 	}
 }
 
@@ -91,7 +107,7 @@ func Errorf(format string, args ...interface{}) {
 func Fatalf(format string, args ...interface{}) {
 	if inst := instance(); inst.Level() <= FatalLevel {
 		ci := getCallerInfo()
-		inst.Log(FatalLevel, ci.pkg, ci.filename, ci.line, format, args...)
+		inst.Log(FatalLevel, ci.pkg, ci.filename, ci.line, nil, format, args...)
 	}
 	return
 }
@@ -100,7 +116,7 @@ func Fatalf(format string, args ...interface{}) {
 func Error(err error) {
 	if inst := instance(); inst.Level() <= ErrorLevel {
 		ci := getCallerInfo()
-		inst.Log(ErrorLevel, ci.pkg, ci.filename, ci.line, "%v", err)
+		inst.Log(ErrorLevel, ci.pkg, ci.filename, ci.line, nil, "%v", err)
 	}
 }
 
@@ -109,10 +125,19 @@ func Error(err error) {
 func Fatal(err error) {
 	if inst := instance(); inst.Level() <= FatalLevel {
 		ci := getCallerInfo()
-		inst.Log(FatalLevel, ci.pkg, ci.filename, ci.line, "%v", err)
+		inst.Log(FatalLevel, ci.pkg, ci.filename, ci.line, nil, "%v", err)
 	}
 }
 
+// Reopen reopens every configured log file.
+// Intended to be used after log files have been externally rotated.
+func Reopen() error {
+	if r, ok := instance().(reopener); ok {
+		return r.Reopen()
+	}
+	return nil
+}
+
 var (
 	instMu sync.RWMutex
 	inst   Logger
@@ -148,30 +173,41 @@ type callerInfo struct {
 	line     int
 }
 
+type reopener interface {
+	Reopen() error
+}
+
 type record struct {
 	level      Level
 	pkg        string
 	file       string
 	line       int
+	fields     Fields
 	log        string
 	continueCh chan struct{}
 }
 
 type logger struct {
 	level  Level
+	format Format
 	output io.Writer
 	files  []io.WriteCloser
 	b      strings.Builder
 	recCh  chan record
 }
 
-func New(level string, output io.Writer, files ...io.WriteCloser) (Logger, error) {
+func New(level string, format string, output io.Writer, files ...io.WriteCloser) (Logger, error) {
 	lvl, err := levelFromString(level)
 	if err != nil {
 		return nil, err
 	}
+	frm, err := formatFromString(format)
+	if err != nil {
+		return nil, err
+	}
 	l := &logger{
 		level:  lvl,
+		format: frm,
 		output: output,
 		files:  files,
 	}
@@ -184,12 +220,13 @@ func (l *logger) Level() Level {
 	return l.level
 }
 
-func (l *logger) Log(level Level, pkg string, file string, line int, format string, args ...interface{}) {
+func (l *logger) Log(level Level, pkg string, file string, line int, fields Fields, format string, args ...interface{}) {
 	entry := record{
 		level:      level,
 		pkg:        pkg,
 		file:       file,
 		line:       line,
+		fields:     fields,
 		log:        fmt.Sprintf(format, args...),
 		continueCh: make(chan struct{}),
 	}
@@ -208,6 +245,18 @@ func (l *logger) Close() error {
 	return nil
 }
 
+// Reopen reopens every log file supporting it.
+func (l *logger) Reopen() error {
+	for _, w := range l.files {
+		if r, ok := w.(reopener); ok {
+			if err := r.Reopen(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (l *logger) loop() {
 	for {
 		select {
@@ -219,31 +268,16 @@ func (l *logger) loop() {
 				}
 				return
 			}
-			l.b.Reset()
-
-			l.b.WriteString(time.Now().Format("2006-01-02 15:04:05"))
-			l.b.WriteString(" ")
-			l.b.WriteString(logLevelGlyph(rec.level))
-			l.b.WriteString(" [")
-			l.b.WriteString(logLevelAbbreviation(rec.level))
-			l.b.WriteString("] ")
-
-			l.b.WriteString(rec.pkg)
-			if len(rec.pkg) > 0 {
-				l.b.WriteString("/")
+			var line string
+			switch l.format {
+			case JSONFormat:
+				line = l.jsonLine(&rec)
+			default:
+				line = l.textLine(&rec)
 			}
-			l.b.WriteString(rec.file)
-			l.b.WriteString(":")
-			l.b.WriteString(strconv.Itoa(rec.line))
-			l.b.WriteString(" - ")
-			l.b.WriteString(rec.log)
-			l.b.WriteString("\n")
-
-			line := l.b.String()
-
-			fmt.Fprintf(l.output, line)
+			io.WriteString(l.output, line)
 			for _, w := range l.files {
-				fmt.Fprintf(w, line)
+				io.WriteString(w, line)
 			}
 			if rec.level == FatalLevel {
 				exitHandler()
@@ -253,6 +287,70 @@ func (l *logger) loop() {
 	}
 }
 
+func (l *logger) textLine(rec *record) string {
+	l.b.Reset()
+
+	l.b.WriteString(time.Now().Format("2006-01-02 15:04:05"))
+	l.b.WriteString(" ")
+	l.b.WriteString(logLevelGlyph(rec.level))
+	l.b.WriteString(" [")
+	l.b.WriteString(logLevelAbbreviation(rec.level))
+	l.b.WriteString("] ")
+
+	l.b.WriteString(callerString(rec))
+	l.b.WriteString(" - ")
+	l.b.WriteString(rec.log)
+
+	if len(rec.fields) > 0 {
+		keys := make([]string, 0, len(rec.fields))
+		for k := range rec.fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			l.b.WriteString(" ")
+			l.b.WriteString(k)
+			l.b.WriteString("=")
+			l.b.WriteString(fmt.Sprintf("%v", rec.fields[k]))
+		}
+	}
+	l.b.WriteString("\n")
+	return l.b.String()
+}
+
+func (l *logger) jsonLine(rec *record) string {
+	m := make(map[string]interface{}, len(rec.fields)+4)
+	for k, v := range rec.fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		m[k] = v
+	}
+	m["time"] = time.Now().Format(time.RFC3339Nano)
+	m["level"] = logLevelName(rec.level)
+	m["caller"] = callerString(rec)
+	m["msg"] = rec.log
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{
+			"time":   m["time"],
+			"level":  m["level"],
+			"caller": m["caller"],
+			"msg":    rec.log,
+		})
+	}
+	return string(b) + "\n"
+}
+
+func callerString(rec *record) string {
+	var ret string
+	if len(rec.pkg) > 0 {
+		ret = rec.pkg + "/"
+	}
+	return ret + rec.file + ":" + strconv.Itoa(rec.line)
+}
+
 func getCallerInfo() callerInfo {
 	ci := callerInfo{}
 	_, file, ln, ok := runtime.Caller(2)
@@ -288,6 +386,23 @@ func logLevelAbbreviation(level Level) string {
 	}
 }
 
+func logLevelName(level Level) string {
+	switch level {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarningLevel:
+		return "warning"
+	case ErrorLevel:
+		return "error"
+	case FatalLevel:
+		return "fatal"
+	default:
+		return ""
+	}
+}
+
 func logLevelGlyph(level Level) string {
 	switch level {
 	case DebugLevel:
@@ -322,3 +437,13 @@ func levelFromString(level string) (Level, error) {
 	}
 	return Level(-1), fmt.Errorf("log: unrecognized level: %s", level)
 }
+
+func formatFromString(format string) (Format, error) {
+	switch strings.ToLower(format) {
+	case "", "text":
+		return TextFormat, nil
+	case "json":
+		return JSONFormat, nil
+	}
+	return Format(-1), fmt.Errorf("log: unrecognized format: %s", format)
+}
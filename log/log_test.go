@@ -7,6 +7,7 @@ package log
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"strings"
 	"sync"
@@ -162,10 +163,44 @@ func TestLogFile(t *testing.T) {
 	}
 }
 
+func TestLogFields(t *testing.T) {
+	bw, _, tearDown := setupTest("info")
+	defer tearDown()
+
+	WithFields(Fields{"stream_id": "c2s:1"}).WithFields(Fields{"jid": "ortuman@jackal.im"}).Infof("test fields log!")
+	time.Sleep(time.Millisecond * 250)
+
+	l := bw.String()
+	require.True(t, strings.Contains(l, "test fields log! jid=ortuman@jackal.im stream_id=c2s:1"))
+}
+
+func TestJSONLog(t *testing.T) {
+	_, err := New("info", "xml", newWriterBuffer())
+	require.NotNil(t, err)
+
+	output := newWriterBuffer()
+	l, err := New("info", "json", output)
+	require.Nil(t, err)
+	Set(l)
+	defer Unset()
+
+	WithFields(Fields{"module": "roster", "err": errors.New("some error")}).Warnf("test %s log!", "json")
+	time.Sleep(time.Millisecond * 250)
+
+	var m map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(output.String()), &m))
+	require.Equal(t, "warning", m["level"])
+	require.Equal(t, "test json log!", m["msg"])
+	require.Equal(t, "roster", m["module"])
+	require.Equal(t, "some error", m["err"])
+	require.True(t, strings.HasPrefix(m["caller"].(string), "log/log_test:"))
+	require.NotEmpty(t, m["time"])
+}
+
 func setupTest(level string) (*writerBuffer, *writerBuffer, func()) {
 	output := newWriterBuffer()
 	logFile := newWriterBuffer()
-	l, _ := New(level, output, logFile)
+	l, _ := New(level, "", output, logFile)
 	Set(l)
 	return output, logFile, func() { Unset() }
 }
@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"encoding/gob"
+	"time"
+)
+
+// AuditEvent represents a security relevant event storage entity.
+type AuditEvent struct {
+	Type       string
+	Username   string
+	JID        string
+	StreamID   string
+	RemoteAddr string
+	Details    map[string]string
+	CreatedAt  time.Time
+}
+
+// FromGob deserializes an AuditEvent entity
+// from it's gob binary representation.
+func (ae *AuditEvent) FromGob(dec *gob.Decoder) {
+	dec.Decode(&ae.Type)
+	dec.Decode(&ae.Username)
+	dec.Decode(&ae.JID)
+	dec.Decode(&ae.StreamID)
+	dec.Decode(&ae.RemoteAddr)
+	dec.Decode(&ae.Details)
+	dec.Decode(&ae.CreatedAt)
+}
+
+// ToGob converts an AuditEvent entity
+// to it's gob binary representation.
+func (ae *AuditEvent) ToGob(enc *gob.Encoder) {
+	enc.Encode(&ae.Type)
+	enc.Encode(&ae.Username)
+	enc.Encode(&ae.JID)
+	enc.Encode(&ae.StreamID)
+	enc.Encode(&ae.RemoteAddr)
+	enc.Encode(&ae.Details)
+	enc.Encode(&ae.CreatedAt)
+}
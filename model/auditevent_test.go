@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditEvent(t *testing.T) {
+	var ae1, ae2 AuditEvent
+	ae1 = AuditEvent{
+		Type:       "login",
+		Username:   "ortuman",
+		JID:        "ortuman@jackal.im",
+		StreamID:   "c2s:default:1",
+		RemoteAddr: "127.0.0.1:52432",
+		Details:    map[string]string{"mechanism": "PLAIN"},
+		CreatedAt:  time.Now(),
+	}
+	buf := new(bytes.Buffer)
+	ae1.ToGob(gob.NewEncoder(buf))
+	ae2.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, ae1.Type, ae2.Type)
+	require.Equal(t, ae1.Username, ae2.Username)
+	require.Equal(t, ae1.JID, ae2.JID)
+	require.Equal(t, ae1.StreamID, ae2.StreamID)
+	require.Equal(t, ae1.RemoteAddr, ae2.RemoteAddr)
+	require.Equal(t, ae1.Details, ae2.Details)
+	require.True(t, ae1.CreatedAt.Equal(ae2.CreatedAt))
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"encoding/gob"
+
+	"github.com/ortuman/jackal/xmpp"
+)
+
+// Bookmark represents a user conference bookmark storage entity.
+type Bookmark struct {
+	Username string
+	JID      string
+	Name     string
+	Autojoin bool
+	Nick     string
+	Password string
+}
+
+// ConferenceElement returns the XEP-0048 conference
+// element representation of a Bookmark entity.
+func (b *Bookmark) ConferenceElement() xmpp.XElement {
+	conference := xmpp.NewElementName("conference")
+	conference.SetAttribute("jid", b.JID)
+	if len(b.Name) > 0 {
+		conference.SetAttribute("name", b.Name)
+	}
+	if b.Autojoin {
+		conference.SetAttribute("autojoin", "true")
+	}
+	if len(b.Nick) > 0 {
+		nick := xmpp.NewElementName("nick")
+		nick.SetText(b.Nick)
+		conference.AppendElement(nick)
+	}
+	if len(b.Password) > 0 {
+		password := xmpp.NewElementName("password")
+		password.SetText(b.Password)
+		conference.AppendElement(password)
+	}
+	return conference
+}
+
+// FromGob deserializes a Bookmark entity
+// from it's gob binary representation.
+func (b *Bookmark) FromGob(dec *gob.Decoder) {
+	dec.Decode(&b.Username)
+	dec.Decode(&b.JID)
+	dec.Decode(&b.Name)
+	dec.Decode(&b.Autojoin)
+	dec.Decode(&b.Nick)
+	dec.Decode(&b.Password)
+}
+
+// ToGob converts a Bookmark entity
+// to it's gob binary representation.
+func (b *Bookmark) ToGob(enc *gob.Encoder) {
+	enc.Encode(&b.Username)
+	enc.Encode(&b.JID)
+	enc.Encode(&b.Name)
+	enc.Encode(&b.Autojoin)
+	enc.Encode(&b.Nick)
+	enc.Encode(&b.Password)
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookmark(t *testing.T) {
+	var b1, b2 Bookmark
+	b1 = Bookmark{Username: "ortuman", JID: "jdev@conference.jabber.org", Name: "jdev", Autojoin: true, Nick: "ortuman", Password: "1234"}
+	buf := new(bytes.Buffer)
+	b1.ToGob(gob.NewEncoder(buf))
+	b2.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, b1, b2)
+}
+
+func TestBookmark_ConferenceElement(t *testing.T) {
+	b := Bookmark{JID: "jdev@conference.jabber.org", Name: "jdev", Autojoin: true, Nick: "ortuman", Password: "1234"}
+	elem := b.ConferenceElement()
+	require.Equal(t, "conference", elem.Name())
+	require.Equal(t, "jdev@conference.jabber.org", elem.Attributes().Get("jid"))
+	require.Equal(t, "jdev", elem.Attributes().Get("name"))
+	require.Equal(t, "true", elem.Attributes().Get("autojoin"))
+	require.Equal(t, "ortuman", elem.Elements().Child("nick").Text())
+	require.Equal(t, "1234", elem.Elements().Child("password").Text())
+
+	elem = (&Bookmark{JID: "jdev@conference.jabber.org"}).ConferenceElement()
+	require.Equal(t, "", elem.Attributes().Get("autojoin"))
+	require.Equal(t, 0, len(elem.Elements().All()))
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"encoding/gob"
+	"strings"
+)
+
+// DirectoryEntry represents a user directory storage entity,
+// built from the searchable fields of a user vCard.
+type DirectoryEntry struct {
+	Username string
+	FN       string
+	Nickname string
+	Email    string
+	Org      string
+
+	// Listed reports whether or not the user opted in
+	// to be found when directory is restricted to opt-in users.
+	Listed bool
+}
+
+// FromGob deserializes a DirectoryEntry entity
+// from it's gob binary representation.
+func (de *DirectoryEntry) FromGob(dec *gob.Decoder) {
+	dec.Decode(&de.Username)
+	dec.Decode(&de.FN)
+	dec.Decode(&de.Nickname)
+	dec.Decode(&de.Email)
+	dec.Decode(&de.Org)
+	dec.Decode(&de.Listed)
+}
+
+// ToGob converts a DirectoryEntry entity
+// to it's gob binary representation.
+func (de *DirectoryEntry) ToGob(enc *gob.Encoder) {
+	enc.Encode(&de.Username)
+	enc.Encode(&de.FN)
+	enc.Encode(&de.Nickname)
+	enc.Encode(&de.Email)
+	enc.Encode(&de.Org)
+	enc.Encode(&de.Listed)
+}
+
+// DirectoryQuery represents a user directory search criteria.
+// Empty fields match any value, while the rest of them match
+// entries containing the given text, ignoring case.
+type DirectoryQuery struct {
+	FN         string
+	Nickname   string
+	Email      string
+	Org        string
+	ListedOnly bool
+}
+
+// Matches returns whether or not a directory entry satisfies the query.
+func (dq *DirectoryQuery) Matches(de *DirectoryEntry) bool {
+	if dq.ListedOnly && !de.Listed {
+		return false
+	}
+	return containsFold(de.FN, dq.FN) &&
+		containsFold(de.Nickname, dq.Nickname) &&
+		containsFold(de.Email, dq.Email) &&
+		containsFold(de.Org, dq.Org)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
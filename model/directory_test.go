@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryEntry(t *testing.T) {
+	var de1, de2 DirectoryEntry
+	de1 = DirectoryEntry{Username: "ortuman", FN: "Miguel Ángel", Nickname: "ortuman", Email: "ortuman@jackal.im", Org: "jackal", Listed: true}
+	buf := new(bytes.Buffer)
+	de1.ToGob(gob.NewEncoder(buf))
+	de2.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, de1, de2)
+}
+
+func TestDirectoryQuery(t *testing.T) {
+	de := &DirectoryEntry{Username: "ortuman", FN: "Miguel Ángel", Email: "ortuman@jackal.im", Org: "jackal"}
+
+	require.True(t, (&DirectoryQuery{}).Matches(de))
+	require.True(t, (&DirectoryQuery{FN: "miguel"}).Matches(de))
+	require.True(t, (&DirectoryQuery{FN: "ÁNGEL", Org: "jack"}).Matches(de))
+	require.False(t, (&DirectoryQuery{FN: "miguel", Org: "prosody"}).Matches(de))
+	require.False(t, (&DirectoryQuery{Nickname: "ortuman"}).Matches(de))
+	require.False(t, (&DirectoryQuery{ListedOnly: true}).Matches(de))
+
+	de.Listed = true
+	require.True(t, (&DirectoryQuery{ListedOnly: true}).Matches(de))
+}
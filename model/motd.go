@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"encoding/gob"
+	"time"
+)
+
+// MOTD represents a host message of the day storage entity.
+type MOTD struct {
+	Host      string
+	Subject   string
+	Body      string
+	UpdatedAt time.Time
+}
+
+// FromGob deserializes a MOTD entity
+// from it's gob binary representation.
+func (m *MOTD) FromGob(dec *gob.Decoder) {
+	dec.Decode(&m.Host)
+	dec.Decode(&m.Subject)
+	dec.Decode(&m.Body)
+	dec.Decode(&m.UpdatedAt)
+}
+
+// ToGob converts a MOTD entity
+// to it's gob binary representation.
+func (m *MOTD) ToGob(enc *gob.Encoder) {
+	enc.Encode(&m.Host)
+	enc.Encode(&m.Subject)
+	enc.Encode(&m.Body)
+	enc.Encode(&m.UpdatedAt)
+}
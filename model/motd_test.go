@@ -0,0 +1,24 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMOTD(t *testing.T) {
+	var m1, m2 MOTD
+	m1 = MOTD{Host: "jackal.im", Subject: "Maintenance", Body: "Server will restart at 23:00", UpdatedAt: time.Now().UTC()}
+	buf := new(bytes.Buffer)
+	m1.ToGob(gob.NewEncoder(buf))
+	m2.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, m1, m2)
+}
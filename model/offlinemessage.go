@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"encoding/gob"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// OfflineMessage represents an offline message storage entity.
+type OfflineMessage struct {
+	ID        string
+	Username  string
+	Message   *xmpp.Message
+	CreatedAt time.Time
+}
+
+// FromGob deserializes an OfflineMessage entity
+// from it's gob binary representation.
+func (om *OfflineMessage) FromGob(dec *gob.Decoder) {
+	dec.Decode(&om.ID)
+	dec.Decode(&om.Username)
+	el := &xmpp.Element{}
+	el.FromGob(dec)
+	fromJID, _ := jid.NewWithString(el.From(), true)
+	toJID, _ := jid.NewWithString(el.To(), true)
+	om.Message, _ = xmpp.NewMessageFromElement(el, fromJID, toJID)
+	dec.Decode(&om.CreatedAt)
+}
+
+// ToGob converts an OfflineMessage entity
+// to it's gob binary representation.
+func (om *OfflineMessage) ToGob(enc *gob.Encoder) {
+	enc.Encode(&om.ID)
+	enc.Encode(&om.Username)
+	om.Message.ToGob(enc)
+	enc.Encode(&om.CreatedAt)
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelOfflineMessage(t *testing.T) {
+	var om1, om2 OfflineMessage
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	j2, _ := jid.NewWithString("noelia@jackal.im", true)
+
+	body := xmpp.NewElementName("body")
+	body.SetText("Hi buddy!")
+	msg := xmpp.NewElementName("message")
+	msg.SetID(uuid.New())
+	msg.SetFrom(j1.String())
+	msg.SetTo(j2.String())
+	msg.AppendElement(body)
+
+	om1.ID = uuid.New()
+	om1.Username = "noelia"
+	om1.Message, _ = xmpp.NewMessageFromElement(msg, j1, j2)
+	om1.CreatedAt = time.Now()
+
+	buf := new(bytes.Buffer)
+	om1.ToGob(gob.NewEncoder(buf))
+	om2.FromGob(gob.NewDecoder(buf))
+	require.Equal(t, om1.ID, om2.ID)
+	require.Equal(t, om1.Username, om2.Username)
+	require.Equal(t, om1.Message.String(), om2.Message.String())
+	require.Equal(t, j1.String(), om2.Message.FromJID().String())
+	require.True(t, om1.CreatedAt.Equal(om2.CreatedAt))
+}
@@ -18,6 +18,7 @@ type User struct {
 	Password       string
 	LastPresence   *xmpp.Presence
 	LastPresenceAt time.Time
+	Disabled       bool
 }
 
 // FromGob deserializes a User entity from it's gob binary representation.
@@ -32,6 +33,7 @@ func (u *User) FromGob(dec *gob.Decoder) {
 		u.LastPresence = p
 		dec.Decode(&u.LastPresenceAt)
 	}
+	dec.Decode(&u.Disabled)
 }
 
 // ToGob converts a User entity to it's gob binary representation.
@@ -45,4 +47,5 @@ func (u *User) ToGob(enc *gob.Encoder) {
 		u.LastPresenceAt = time.Now()
 		enc.Encode(&u.LastPresenceAt)
 	}
+	enc.Encode(&u.Disabled)
 }
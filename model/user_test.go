@@ -25,6 +25,7 @@ func TestModelUser(t *testing.T) {
 	usr1.Username = "ortuman"
 	usr1.Password = "1234"
 	usr1.LastPresence = xmpp.NewPresence(j1, j2, xmpp.AvailableType)
+	usr1.Disabled = true
 
 	buf := new(bytes.Buffer)
 	usr1.ToGob(gob.NewEncoder(buf))
@@ -34,4 +35,5 @@ func TestModelUser(t *testing.T) {
 	require.Equal(t, usr1.Password, usr2.Password)
 	require.Equal(t, usr1.LastPresence.String(), usr2.LastPresence.String())
 	require.NotEqual(t, time.Time{}, usr2.LastPresenceAt)
+	require.True(t, usr2.Disabled)
 }
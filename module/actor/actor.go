@@ -0,0 +1,20 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package actor
+
+// Drain runs every function still queued into a module actor channel.
+// Modules invoke it before acknowledging a shutdown request, so that
+// no pending operation gets lost while the server is being drained.
+func Drain(actorCh chan func()) {
+	for {
+		select {
+		case f := <-actorCh:
+			f()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,28 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package actor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestActor_Drain(t *testing.T) {
+	actorCh := make(chan func(), 8)
+
+	var calls []int
+	for i := 0; i < 3; i++ {
+		i := i
+		actorCh <- func() { calls = append(calls, i) }
+	}
+	Drain(actorCh)
+	require.Equal(t, []int{0, 1, 2}, calls)
+	require.Equal(t, 0, len(actorCh))
+
+	Drain(actorCh) // nothing pending
+	require.Equal(t, 3, len(calls))
+}
@@ -6,10 +6,15 @@
 package module
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/ortuman/jackal/module/offline"
 	"github.com/ortuman/jackal/module/roster"
+	"github.com/ortuman/jackal/module/xep0033"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/module/xep0054"
+	"github.com/ortuman/jackal/module/xep0055"
 	"github.com/ortuman/jackal/module/xep0077"
 	"github.com/ortuman/jackal/module/xep0092"
 	"github.com/ortuman/jackal/module/xep0199"
@@ -20,6 +25,10 @@ type Config struct {
 	Enabled      map[string]struct{}
 	Roster       roster.Config
 	Offline      offline.Config
+	Multicast    xep0033.Config
+	AdHoc        xep0050.Config
+	VCard        xep0054.Config
+	Search       xep0055.Config
 	Registration xep0077.Config
 	Version      xep0092.Config
 	Ping         xep0199.Config
@@ -29,6 +38,10 @@ type configProxy struct {
 	Enabled      []string       `yaml:"enabled"`
 	Roster       roster.Config  `yaml:"mod_roster"`
 	Offline      offline.Config `yaml:"mod_offline"`
+	Multicast    xep0033.Config `yaml:"mod_multicast"`
+	AdHoc        xep0050.Config `yaml:"mod_adhoc"`
+	VCard        xep0054.Config `yaml:"mod_vcard"`
+	Search       xep0055.Config `yaml:"mod_search"`
 	Registration xep0077.Config `yaml:"mod_registration"`
 	Version      xep0092.Config `yaml:"mod_version"`
 	Ping         xep0199.Config `yaml:"mod_ping"`
@@ -45,16 +58,25 @@ func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	for _, mod := range p.Enabled {
 		switch mod {
 		case "roster", "last_activity", "private", "vcard", "registration", "version", "blocking_command",
-			"ping", "offline":
+			"ping", "offline", "adhoc", "admin", "motd", "search", "bookmarks", "time", "multicast":
 			break
 		default:
 			return fmt.Errorf("module.Config: unrecognized module: %s", mod)
 		}
 		enabled[mod] = struct{}{}
 	}
+	if _, ok := enabled["admin"]; ok {
+		if _, ok := enabled["adhoc"]; !ok {
+			return errors.New("module.Config: admin module requires adhoc module to be enabled")
+		}
+	}
 	cfg.Enabled = enabled
 	cfg.Roster = p.Roster
 	cfg.Offline = p.Offline
+	cfg.Multicast = p.Multicast
+	cfg.AdHoc = p.AdHoc
+	cfg.VCard = p.VCard
+	cfg.Search = p.Search
 	cfg.Registration = p.Registration
 	cfg.Version = p.Version
 	cfg.Ping = p.Ping
@@ -23,4 +23,39 @@ func TestModuleConfig(t *testing.T) {
 	validMod := `enabled: [roster]`
 	err = yaml.Unmarshal([]byte(validMod), &cfg)
 	require.Nil(t, err)
+	missingDep := `enabled: [admin]`
+	err = yaml.Unmarshal([]byte(missingDep), &cfg)
+	require.NotNil(t, err)
+	validDep := `enabled: [adhoc, admin]`
+	err = yaml.Unmarshal([]byte(validDep), &cfg)
+	require.Nil(t, err)
+	badSearch := "enabled: [search]\nmod_search:\n  visibility: nobody"
+	err = yaml.Unmarshal([]byte(badSearch), &cfg)
+	require.NotNil(t, err)
+	validSearch := "enabled: [vcard, search]\nmod_search:\n  visibility: opt_in"
+	err = yaml.Unmarshal([]byte(validSearch), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, "opt_in", cfg.Search.Visibility)
+	badVCard := "enabled: [vcard]\nmod_vcard:\n  max_photo_size: -1"
+	err = yaml.Unmarshal([]byte(badVCard), &cfg)
+	require.NotNil(t, err)
+	validVCard := "enabled: [vcard]\nmod_vcard:\n  max_photo_size: 65536"
+	err = yaml.Unmarshal([]byte(validVCard), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 65536, cfg.VCard.MaxPhotoSize)
+	validBookmarks := `enabled: [private, bookmarks]`
+	err = yaml.Unmarshal([]byte(validBookmarks), &cfg)
+	require.Nil(t, err)
+	validTime := `enabled: [time]`
+	err = yaml.Unmarshal([]byte(validTime), &cfg)
+	require.Nil(t, err)
+	_, ok := cfg.Enabled["time"]
+	require.True(t, ok)
+	badMulticast := "enabled: [multicast]\nmod_multicast:\n  max_recipients: -1"
+	err = yaml.Unmarshal([]byte(badMulticast), &cfg)
+	require.NotNil(t, err)
+	validMulticast := "enabled: [multicast]\nmod_multicast:\n  max_recipients: 20"
+	err = yaml.Unmarshal([]byte(validMulticast), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 20, cfg.Multicast.MaxRecipients)
 }
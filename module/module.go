@@ -8,16 +8,23 @@ package module
 import (
 	"context"
 
+	"github.com/ortuman/jackal/module/motd"
 	"github.com/ortuman/jackal/module/offline"
 	"github.com/ortuman/jackal/module/roster"
 	"github.com/ortuman/jackal/module/xep0012"
 	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/module/xep0033"
 	"github.com/ortuman/jackal/module/xep0049"
+	"github.com/ortuman/jackal/module/xep0050"
 	"github.com/ortuman/jackal/module/xep0054"
+	"github.com/ortuman/jackal/module/xep0055"
 	"github.com/ortuman/jackal/module/xep0077"
 	"github.com/ortuman/jackal/module/xep0092"
+	"github.com/ortuman/jackal/module/xep0133"
 	"github.com/ortuman/jackal/module/xep0191"
 	"github.com/ortuman/jackal/module/xep0199"
+	"github.com/ortuman/jackal/module/xep0202"
+	"github.com/ortuman/jackal/module/xep0402"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
@@ -27,7 +34,8 @@ import (
 type Module interface {
 }
 
-// IQHandler represents an IQ handler module.
+// IQHandler represents an IQ handler module
+// able to process IQs from any origin (c2s, s2s or component).
 type IQHandler interface {
 	Module
 
@@ -37,6 +45,20 @@ type IQHandler interface {
 
 	// ProcessIQ processes a module IQ taking according actions
 	// over the associated stream.
+	ProcessIQ(iq *xmpp.IQ, stm stream.InOutStream)
+}
+
+// C2SIQHandler represents an IQ handler module
+// exclusively serving local client streams.
+type C2SIQHandler interface {
+	Module
+
+	// MatchesIQ returns whether or not an IQ should be
+	// processed by the module.
+	MatchesIQ(iq *xmpp.IQ) bool
+
+	// ProcessIQ processes a module IQ taking according actions
+	// over the associated client stream.
 	ProcessIQ(iq *xmpp.IQ, stm stream.C2S)
 }
 
@@ -44,18 +66,26 @@ type IQHandler interface {
 type Modules struct {
 	Roster       *roster.Roster
 	Offline      *offline.Offline
+	MOTD         *motd.MOTD
 	LastActivity *xep0012.LastActivity
 	Private      *xep0049.Private
+	AdHoc        *xep0050.AdHoc
 	DiscoInfo    *xep0030.DiscoInfo
+	Multicast    *xep0033.Multicast
 	VCard        *xep0054.VCard
+	Search       *xep0055.Search
 	Register     *xep0077.Register
 	Version      *xep0092.Version
+	Admin        *xep0133.Admin
 	BlockingCmd  *xep0191.BlockingCommand
 	Ping         *xep0199.Ping
+	Time         *xep0202.Time
+	Bookmarks    *xep0402.Bookmarks
 
-	iqHandlers  []IQHandler
-	all         []Module
-	shutdownChs []chan<- chan bool
+	iqHandlers    []IQHandler
+	c2sIQHandlers []C2SIQHandler
+	all           []Module
+	shutdownChs   []chan<- chan bool
 }
 
 // New returns a set of modules derived from a concrete configuration.
@@ -69,10 +99,18 @@ func New(config *Config, router *router.Router) *Modules {
 	m.all = append(m.all, m.DiscoInfo)
 	m.shutdownChs = append(m.shutdownChs, shutdownCh)
 
+	// XEP-0050: Ad-Hoc Commands (https://xmpp.org/extensions/xep-0050.html)
+	if _, ok := config.Enabled["adhoc"]; ok {
+		m.AdHoc, shutdownCh = xep0050.New(&config.AdHoc, m.DiscoInfo)
+		m.iqHandlers = append(m.iqHandlers, m.AdHoc)
+		m.all = append(m.all, m.AdHoc)
+		m.shutdownChs = append(m.shutdownChs, shutdownCh)
+	}
+
 	// Roster (https://xmpp.org/rfcs/rfc3921.html#roster)
 	if _, ok := config.Enabled["roster"]; ok {
 		m.Roster, shutdownCh = roster.New(&config.Roster, router)
-		m.iqHandlers = append(m.iqHandlers, m.Roster)
+		m.c2sIQHandlers = append(m.c2sIQHandlers, m.Roster)
 		m.all = append(m.all, m.Roster)
 		m.shutdownChs = append(m.shutdownChs, shutdownCh)
 	}
@@ -85,17 +123,34 @@ func New(config *Config, router *router.Router) *Modules {
 		m.shutdownChs = append(m.shutdownChs, shutdownCh)
 	}
 
+	// XEP-0402: PEP Native Bookmarks (https://xmpp.org/extensions/xep-0402.html)
+	// XEP-0411: Bookmarks Conversion (https://xmpp.org/extensions/xep-0411.html)
+	if _, ok := config.Enabled["bookmarks"]; ok {
+		m.Bookmarks, shutdownCh = xep0402.New(m.DiscoInfo, router)
+		m.c2sIQHandlers = append(m.c2sIQHandlers, m.Bookmarks)
+		m.all = append(m.all, m.Bookmarks)
+		m.shutdownChs = append(m.shutdownChs, shutdownCh)
+	}
+
 	// XEP-0049: Private XML Storage (https://xmpp.org/extensions/xep-0049.html)
 	if _, ok := config.Enabled["private"]; ok {
-		m.Private, shutdownCh = xep0049.New()
-		m.iqHandlers = append(m.iqHandlers, m.Private)
+		m.Private, shutdownCh = xep0049.New(m.Bookmarks)
+		m.c2sIQHandlers = append(m.c2sIQHandlers, m.Private)
 		m.all = append(m.all, m.Private)
 		m.shutdownChs = append(m.shutdownChs, shutdownCh)
 	}
 
+	// XEP-0055: Jabber Search (https://xmpp.org/extensions/xep-0055.html)
+	if _, ok := config.Enabled["search"]; ok {
+		m.Search, shutdownCh = xep0055.New(&config.Search, m.DiscoInfo, m.AdHoc, router)
+		m.iqHandlers = append(m.iqHandlers, m.Search)
+		m.all = append(m.all, m.Search)
+		m.shutdownChs = append(m.shutdownChs, shutdownCh)
+	}
+
 	// XEP-0054: vcard-temp (https://xmpp.org/extensions/xep-0054.html)
 	if _, ok := config.Enabled["vcard"]; ok {
-		m.VCard, shutdownCh = xep0054.New(m.DiscoInfo)
+		m.VCard, shutdownCh = xep0054.New(&config.VCard, m.DiscoInfo, m.Search)
 		m.iqHandlers = append(m.iqHandlers, m.VCard)
 		m.all = append(m.all, m.VCard)
 		m.shutdownChs = append(m.shutdownChs, shutdownCh)
@@ -104,7 +159,7 @@ func New(config *Config, router *router.Router) *Modules {
 	// XEP-0077: In-band registration (https://xmpp.org/extensions/xep-0077.html)
 	if _, ok := config.Enabled["registration"]; ok {
 		m.Register, shutdownCh = xep0077.New(&config.Registration, m.DiscoInfo)
-		m.iqHandlers = append(m.iqHandlers, m.Register)
+		m.c2sIQHandlers = append(m.c2sIQHandlers, m.Register)
 		m.all = append(m.all, m.Register)
 		m.shutdownChs = append(m.shutdownChs, shutdownCh)
 	}
@@ -117,17 +172,39 @@ func New(config *Config, router *router.Router) *Modules {
 		m.shutdownChs = append(m.shutdownChs, shutdownCh)
 	}
 
+	// Message of the day
+	if _, ok := config.Enabled["motd"]; ok {
+		m.MOTD, shutdownCh = motd.New(router)
+		m.all = append(m.all, m.MOTD)
+		m.shutdownChs = append(m.shutdownChs, shutdownCh)
+	}
+
+	// XEP-0133: Service Administration (https://xmpp.org/extensions/xep-0133.html)
+	if _, ok := config.Enabled["admin"]; ok {
+		m.Admin = xep0133.New(m.AdHoc, m.MOTD, router)
+		m.all = append(m.all, m.Admin)
+	}
+
 	// XEP-0160: Offline message storage (https://xmpp.org/extensions/xep-0160.html)
+	// XEP-0013: Flexible Offline Message Retrieval (https://xmpp.org/extensions/xep-0013.html)
 	if _, ok := config.Enabled["offline"]; ok {
 		m.Offline, shutdownCh = offline.New(&config.Offline, m.DiscoInfo, router)
+		m.c2sIQHandlers = append(m.c2sIQHandlers, m.Offline)
 		m.all = append(m.all, m.Offline)
 		m.shutdownChs = append(m.shutdownChs, shutdownCh)
 	}
 
+	// XEP-0033: Extended Stanza Addressing (https://xmpp.org/extensions/xep-0033.html)
+	if _, ok := config.Enabled["multicast"]; ok {
+		m.Multicast, shutdownCh = xep0033.New(&config.Multicast, m.DiscoInfo, m.Offline, router)
+		m.all = append(m.all, m.Multicast)
+		m.shutdownChs = append(m.shutdownChs, shutdownCh)
+	}
+
 	// XEP-0191: Blocking Command (https://xmpp.org/extensions/xep-0191.html)
 	if _, ok := config.Enabled["blocking_command"]; ok {
 		m.BlockingCmd, shutdownCh = xep0191.New(m.DiscoInfo, m.Roster, router)
-		m.iqHandlers = append(m.iqHandlers, m.BlockingCmd)
+		m.c2sIQHandlers = append(m.c2sIQHandlers, m.BlockingCmd)
 		m.all = append(m.all, m.BlockingCmd)
 		m.shutdownChs = append(m.shutdownChs, shutdownCh)
 	}
@@ -139,12 +216,33 @@ func New(config *Config, router *router.Router) *Modules {
 		m.all = append(m.all, m.Ping)
 		m.shutdownChs = append(m.shutdownChs, shutdownCh)
 	}
+
+	// XEP-0202: Entity Time (https://xmpp.org/extensions/xep-0202.html)
+	// XEP-0090: Legacy Entity Time (https://xmpp.org/extensions/xep-0090.html)
+	if _, ok := config.Enabled["time"]; ok {
+		m.Time, shutdownCh = xep0202.New(m.DiscoInfo)
+		m.iqHandlers = append(m.iqHandlers, m.Time)
+		m.all = append(m.all, m.Time)
+		m.shutdownChs = append(m.shutdownChs, shutdownCh)
+	}
 	return m
 }
 
+// MatchesIQ returns whether or not an IQ would be handled by
+// any module regardless of the stream it comes from.
+func (m *Modules) MatchesIQ(iq *xmpp.IQ) bool {
+	for _, handler := range m.iqHandlers {
+		if handler.MatchesIQ(iq) {
+			return true
+		}
+	}
+	return false
+}
+
 // ProcessIQ process a module IQ returning 'service unavailable'
 // in case it can't be properly handled.
-func (m *Modules) ProcessIQ(iq *xmpp.IQ, stm stream.C2S) {
+// Client only modules will be skipped if the IQ doesn't come from a c2s stream.
+func (m *Modules) ProcessIQ(iq *xmpp.IQ, stm stream.InOutStream) {
 	for _, handler := range m.iqHandlers {
 		if !handler.MatchesIQ(iq) {
 			continue
@@ -152,6 +250,15 @@ func (m *Modules) ProcessIQ(iq *xmpp.IQ, stm stream.C2S) {
 		handler.ProcessIQ(iq, stm)
 		return
 	}
+	if c2sStm, ok := stm.(stream.C2S); ok {
+		for _, handler := range m.c2sIQHandlers {
+			if !handler.MatchesIQ(iq) {
+				continue
+			}
+			handler.ProcessIQ(iq, c2sStm)
+			return
+		}
+	}
 
 	// ...IQ not handled...
 	if iq.IsGet() || iq.IsSet() {
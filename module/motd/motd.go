@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package motd
+
+import (
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/actor"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const mailboxSize = 2048
+
+var logger = log.WithFields(log.Fields{"module": "motd"})
+
+// MOTD represents a message of the day server stream module.
+// Messages are kept in storage per host, so that any change
+// is applied to the very next login.
+type MOTD struct {
+	router     *router.Router
+	actorCh    chan func()
+	shutdownCh chan chan bool
+}
+
+// New returns a message of the day server stream module.
+func New(router *router.Router) (*MOTD, chan<- chan bool) {
+	x := &MOTD{
+		router:     router,
+		actorCh:    make(chan func(), mailboxSize),
+		shutdownCh: make(chan chan bool),
+	}
+	go x.loop()
+	return x, x.shutdownCh
+}
+
+// DeliverMOTD sends the stream host message of the day, if any,
+// to a recently logged in client stream.
+func (x *MOTD) DeliverMOTD(stm stream.C2S) {
+	x.actorCh <- func() { x.deliverMOTD(stm) }
+}
+
+// runs on it's own goroutine
+func (x *MOTD) loop() {
+	for {
+		select {
+		case f := <-x.actorCh:
+			f()
+		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
+			c <- true
+			return
+		}
+	}
+}
+
+func (x *MOTD) deliverMOTD(stm stream.C2S) {
+	motd, err := storage.FetchMOTD(stm.Context(), stm.Domain())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if motd == nil {
+		return
+	}
+	srvJID, _ := jid.New("", stm.Domain(), "", true)
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.NormalType)
+	msg.SetFromJID(srvJID)
+	msg.SetToJID(stm.JID())
+	if len(motd.Subject) > 0 {
+		subject := xmpp.NewElementName("subject")
+		subject.SetText(motd.Subject)
+		msg.AppendElement(subject)
+	}
+	body := xmpp.NewElementName("body")
+	body.SetText(motd.Body)
+	msg.AppendElement(body)
+	if err := x.router.Route(msg); err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package motd
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMOTD_Deliver(t *testing.T) {
+	s := memstorage.New()
+	storage.Set(s)
+	defer storage.Unset()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("hamlet", "jabber.org", "garden", true)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	defer stm1.Disconnect(nil)
+	defer stm2.Disconnect(nil)
+
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{
+			{Name: "jackal.im", Certificate: tls.Certificate{}},
+			{Name: "jabber.org", Certificate: tls.Certificate{}},
+		},
+	})
+	r.Bind(stm1)
+	r.Bind(stm2)
+
+	x, shutdownCh := New(r)
+	defer close(shutdownCh)
+
+	s.InsertOrUpdateMOTD(context.Background(), &model.MOTD{Host: "jackal.im", Subject: "Hi", Body: "Welcome!"})
+
+	x.DeliverMOTD(stm1)
+	elem := stm1.FetchElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, "jackal.im", elem.From())
+	require.Equal(t, j1.String(), elem.To())
+	require.Equal(t, "Hi", elem.Elements().Child("subject").Text())
+	require.Equal(t, "Welcome!", elem.Elements().Child("body").Text())
+	require.NotEqual(t, "", elem.Elements().ChildNamespace("stanza-id", "urn:xmpp:sid:0").Attributes().Get("id"))
+
+	// edited without restarting
+	s.InsertOrUpdateMOTD(context.Background(), &model.MOTD{Host: "jackal.im", Body: "Maintenance tonight"})
+
+	x.DeliverMOTD(stm2) // no message of the day for this host
+	x.DeliverMOTD(stm1)
+	elem = stm1.FetchElement()
+	require.Nil(t, elem.Elements().Child("subject"))
+	require.Equal(t, "Maintenance tonight", elem.Elements().Child("body").Text())
+
+	stm2.SendElement(xmpp.NewElementName("marker"))
+	require.Equal(t, "marker", stm2.FetchElement().Name())
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package offline
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const flexibleOfflineNamespace = "http://jabber.org/protocol/offline"
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the offline module.
+func (o *Offline) MatchesIQ(iq *xmpp.IQ) bool {
+	return iq.Elements().ChildNamespace("offline", flexibleOfflineNamespace) != nil
+}
+
+// ProcessIQ processes a flexible offline message retrieval IQ
+// taking according actions over the associated stream.
+func (o *Offline) ProcessIQ(iq *xmpp.IQ, stm stream.C2S) {
+	o.actorCh <- func() { o.processIQ(iq, stm) }
+}
+
+func (o *Offline) processIQ(iq *xmpp.IQ, stm stream.C2S) {
+	toJID := iq.ToJID()
+	validTo := toJID.IsServer() || toJID.Node() == stm.Username()
+	if !validTo {
+		stm.SendElement(iq.ForbiddenError())
+		return
+	}
+	// from now on messages will only be delivered on client request
+	stm.Context().SetBool(true, offlineFlexibleCtxKey)
+
+	off := iq.Elements().ChildNamespace("offline", flexibleOfflineNamespace)
+	switch {
+	case off.Elements().Child("fetch") != nil:
+		if !iq.IsGet() {
+			stm.SendElement(iq.BadRequestError())
+			return
+		}
+		o.fetchAllMessages(iq, stm)
+
+	case off.Elements().Child("purge") != nil:
+		if !iq.IsSet() {
+			stm.SendElement(iq.BadRequestError())
+			return
+		}
+		o.purgeMessages(iq, stm)
+
+	default:
+		o.processItems(iq, off.Elements().Children("item"), stm)
+	}
+}
+
+func (o *Offline) fetchAllMessages(iq *xmpp.IQ, stm stream.C2S) {
+	msgs, err := o.fetchMessages(stm.Context(), stm.Username())
+	if err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	for _, m := range msgs {
+		o.sendMessage(&m, stm)
+	}
+	stm.SendElement(iq.ResultIQ())
+}
+
+func (o *Offline) purgeMessages(iq *xmpp.IQ, stm stream.C2S) {
+	if err := storage.DeleteOfflineMessages(stm.Context(), stm.Username()); err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	stm.SendElement(iq.ResultIQ())
+}
+
+func (o *Offline) processItems(iq *xmpp.IQ, items []xmpp.XElement, stm stream.C2S) {
+	if len(items) == 0 {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	var action string
+	for _, item := range items {
+		act := item.Attributes().Get("action")
+		node := item.Attributes().Get("node")
+		if len(node) == 0 || (act != "view" && act != "remove") || (len(action) > 0 && act != action) {
+			stm.SendElement(iq.BadRequestError())
+			return
+		}
+		action = act
+	}
+	if (action == "view" && !iq.IsGet()) || (action == "remove" && !iq.IsSet()) {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	msgs, err := o.fetchMessages(stm.Context(), stm.Username())
+	if err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	msgsByNode := make(map[string]*model.OfflineMessage, len(msgs))
+	for i := 0; i < len(msgs); i++ {
+		msgsByNode[msgs[i].ID] = &msgs[i]
+	}
+	for _, item := range items {
+		if msgsByNode[item.Attributes().Get("node")] == nil {
+			stm.SendElement(iq.ItemNotFoundError())
+			return
+		}
+	}
+	for _, item := range items {
+		m := msgsByNode[item.Attributes().Get("node")]
+		switch action {
+		case "view":
+			o.sendMessage(m, stm)
+		case "remove":
+			if err := storage.DeleteOfflineMessage(stm.Context(), stm.Username(), m.ID); err != nil {
+				logger.Error(err)
+				stm.SendElement(iq.InternalServerError())
+				return
+			}
+		}
+	}
+	stm.SendElement(iq.ResultIQ())
+}
+
+func (o *Offline) sendMessage(m *model.OfflineMessage, stm stream.C2S) {
+	msg := xmpp.NewElementFromElement(stampMessage(m))
+	msg.SetTo(stm.JID().String())
+
+	item := xmpp.NewElementName("item")
+	item.SetAttribute("node", m.ID)
+	off := xmpp.NewElementNamespace("offline", flexibleOfflineNamespace)
+	off.AppendElement(item)
+	msg.AppendElement(off)
+
+	stm.SendElement(msg)
+}
+
+func (o *Offline) markFlexibleRetrieval(userJID *jid.JID) {
+	for _, stm := range o.router.UserStreams(userJID.Node()) {
+		if stm.Resource() == userJID.Resource() {
+			stm.Context().SetBool(true, offlineFlexibleCtxKey)
+			return
+		}
+	}
+}
+
+// nodeProvider exposes user's offline queue through
+// service discovery 'http://jabber.org/protocol/offline' node.
+type nodeProvider struct {
+	offline *Offline
+}
+
+func (np *nodeProvider) Identities(toJID, fromJID *jid.JID, node string) []xep0030.Identity {
+	return []xep0030.Identity{{Category: "automation", Type: "message-list"}}
+}
+
+func (np *nodeProvider) Items(toJID, fromJID *jid.JID, node string) ([]xep0030.Item, *xmpp.StanzaError) {
+	if !np.isOwner(toJID, fromJID) {
+		return nil, xmpp.ErrForbidden
+	}
+	msgs, err := np.offline.fetchMessages(context.Background(), fromJID.Node())
+	if err != nil {
+		logger.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	// requesting message headers disables automatic delivery
+	np.offline.markFlexibleRetrieval(fromJID)
+
+	var items []xep0030.Item
+	for _, m := range msgs {
+		items = append(items, xep0030.Item{
+			Jid:  fromJID.ToBareJID().String(),
+			Node: m.ID,
+			Name: m.Message.FromJID().String(),
+		})
+	}
+	return items, nil
+}
+
+func (np *nodeProvider) Features(toJID, fromJID *jid.JID, node string) ([]xep0030.Feature, *xmpp.StanzaError) {
+	if !np.isOwner(toJID, fromJID) {
+		return nil, xmpp.ErrForbidden
+	}
+	return []xep0030.Feature{flexibleOfflineNamespace}, nil
+}
+
+func (np *nodeProvider) Form(toJID, fromJID *jid.JID, node string) (*xep0004.DataForm, *xmpp.StanzaError) {
+	if !np.isOwner(toJID, fromJID) {
+		return nil, xmpp.ErrForbidden
+	}
+	msgs, err := np.offline.fetchMessages(context.Background(), fromJID.Node())
+	if err != nil {
+		logger.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	return &xep0004.DataForm{
+		Type: xep0004.Result,
+		Fields: []xep0004.Field{
+			{Var: "FORM_TYPE", Type: xep0004.Hidden, Values: []string{flexibleOfflineNamespace}},
+			{Var: "number_of_messages", Values: []string{strconv.Itoa(len(msgs))}},
+		},
+	}, nil
+}
+
+func (np *nodeProvider) isOwner(toJID, fromJID *jid.JID) bool {
+	if !np.offline.router.IsLocalHost(fromJID.Domain()) || len(fromJID.Node()) == 0 {
+		return false
+	}
+	return toJID.IsServer() || toJID.Node() == fromJID.Node()
+}
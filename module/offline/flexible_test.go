@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package offline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffline_FlexibleMatching(t *testing.T) {
+	x := &Offline{}
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	require.False(t, x.MatchesIQ(iq))
+
+	off := xmpp.NewElementNamespace("offline", flexibleOfflineNamespace)
+	off.AppendElement(xmpp.NewElementName("fetch"))
+	iq.AppendElement(off)
+	require.True(t, x.MatchesIQ(iq))
+}
+
+func TestOffline_FlexibleDiscoNode(t *testing.T) {
+	r, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("juliet", "jackal.im", "garden", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage(uuid.New(), j1, j2, time.Now()))
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage(uuid.New(), j1, j2, time.Now()))
+
+	stm := stream.NewMockC2S(uuid.New(), j2)
+	r.Bind(stm)
+
+	disco, discoShutdownCh := xep0030.New(r)
+	defer close(discoShutdownCh)
+
+	x, shutdownCh := New(&Config{QueueSize: 10}, disco, r)
+	defer close(shutdownCh)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j2)
+	iq.SetToJID(srvJID)
+	q := xmpp.NewElementNamespace("query", "http://jabber.org/protocol/disco#info")
+	q.SetAttribute("node", flexibleOfflineNamespace)
+	iq.AppendElement(q)
+
+	disco.ProcessIQ(iq, stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	query := elem.Elements().Child("query")
+	require.NotNil(t, query)
+	require.Equal(t, "message-list", query.Elements().Child("identity").Attributes().Get("type"))
+	require.NotNil(t, query.Elements().ChildNamespace("x", "jabber:x:data"))
+
+	iq = xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j2)
+	iq.SetToJID(j2.ToBareJID())
+	q = xmpp.NewElementNamespace("query", "http://jabber.org/protocol/disco#items")
+	q.SetAttribute("node", flexibleOfflineNamespace)
+	iq.AppendElement(q)
+
+	disco.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	items := elem.Elements().Child("query").Elements().Children("item")
+	require.Equal(t, 2, len(items))
+	require.Equal(t, j1.String(), items[0].Attributes().Get("name"))
+
+	// automatic delivery must be skipped after requesting headers
+	require.True(t, stm.Context().Bool(offlineFlexibleCtxKey))
+
+	x.DeliverOfflineMessages(stm)
+	time.Sleep(time.Millisecond * 250)
+
+	cnt, _ := storage.CountOfflineMessages(context.Background(), "juliet")
+	require.Equal(t, 2, cnt)
+
+	// another user's queue cannot be inspected
+	iq.SetFromJID(j1)
+	iq.SetToJID(j2.ToBareJID())
+	disco.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestOffline_FlexibleRetrieval(t *testing.T) {
+	r, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("juliet", "jackal.im", "garden", true)
+
+	id1, id2, id3 := uuid.New(), uuid.New(), uuid.New()
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage(id1, j1, j2, time.Now()))
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage(id2, j1, j2, time.Now()))
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage(id3, j1, j2, time.Now()))
+
+	stm := stream.NewMockC2S(uuid.New(), j2)
+	r.Bind(stm)
+
+	x, shutdownCh := New(&Config{QueueSize: 10}, nil, r)
+	defer close(shutdownCh)
+
+	// view a single message
+	iq := tUtilFlexibleItemsIQ(xmpp.GetType, j2, j2, "view", id2)
+	x.ProcessIQ(iq, stm)
+	elem := stm.FetchElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, id2, elem.ID())
+	require.Equal(t, j2.String(), elem.To())
+	item := elem.Elements().ChildNamespace("offline", flexibleOfflineNamespace).Elements().Child("item")
+	require.Equal(t, id2, item.Attributes().Get("node"))
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.True(t, stm.Context().Bool(offlineFlexibleCtxKey))
+
+	// unknown node
+	iq = tUtilFlexibleItemsIQ(xmpp.GetType, j2, j2, "view", uuid.New())
+	x.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	// wrong IQ type
+	iq = tUtilFlexibleItemsIQ(xmpp.GetType, j2, j2, "remove", id2)
+	x.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	// remove a single message
+	iq = tUtilFlexibleItemsIQ(xmpp.SetType, j2, j2, "remove", id2)
+	x.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	cnt, _ := storage.CountOfflineMessages(context.Background(), "juliet")
+	require.Equal(t, 2, cnt)
+
+	// fetch all messages
+	iq = tUtilFlexibleIQ(xmpp.GetType, j2, j2, "fetch")
+	x.ProcessIQ(iq, stm)
+	require.Equal(t, id1, stm.FetchElement().ID())
+	require.Equal(t, id3, stm.FetchElement().ID())
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// fetched messages remain stored until purged
+	cnt, _ = storage.CountOfflineMessages(context.Background(), "juliet")
+	require.Equal(t, 2, cnt)
+
+	iq = tUtilFlexibleIQ(xmpp.SetType, j2, j2, "purge")
+	x.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	cnt, _ = storage.CountOfflineMessages(context.Background(), "juliet")
+	require.Equal(t, 0, cnt)
+
+	// forbidden target
+	iq = tUtilFlexibleIQ(xmpp.SetType, j2, j1, "purge")
+	x.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func tUtilFlexibleIQ(iqType string, fromJID, toJID *jid.JID, action string) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), iqType)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(toJID.ToBareJID())
+	off := xmpp.NewElementNamespace("offline", flexibleOfflineNamespace)
+	off.AppendElement(xmpp.NewElementName(action))
+	iq.AppendElement(off)
+	return iq
+}
+
+func tUtilFlexibleItemsIQ(iqType string, fromJID, toJID *jid.JID, action string, nodes ...string) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), iqType)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(toJID.ToBareJID())
+	off := xmpp.NewElementNamespace("offline", flexibleOfflineNamespace)
+	for _, node := range nodes {
+		item := xmpp.NewElementName("item")
+		item.SetAttribute("action", action)
+		item.SetAttribute("node", node)
+		off.AppendElement(item)
+	}
+	iq.AppendElement(off)
+	return iq
+}
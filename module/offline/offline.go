@@ -6,44 +6,117 @@
 package offline
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/actor"
 	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
+	"github.com/pborman/uuid"
 )
 
 const mailboxSize = 2048
 
+var logger = log.WithFields(log.Fields{"module": "offline"})
+
+const defaultSweepInterval = time.Minute * 5
+
 const offlineNamespace = "msgoffline"
 
-const offlineDeliveredCtxKey = "offline:delivered"
+const (
+	offlineDeliveredCtxKey = "offline:delivered"
+	offlineFlexibleCtxKey  = "offline:flexible"
+)
 
 // Config represents Offline Storage module configuration.
 type Config struct {
-	QueueSize int `yaml:"queue_size"`
+	QueueSize     int
+	UserQuotas    map[string]int
+	ExpireAfter   time.Duration
+	SweepInterval time.Duration
+
+	// StoreNamespaces contains the payload namespaces that make a
+	// bodiless chat message archivable. If nil, defaultStoreNamespaces are used.
+	StoreNamespaces []string
+}
+
+type configProxy struct {
+	QueueSize       int            `yaml:"queue_size"`
+	UserQuotas      map[string]int `yaml:"user_quotas"`
+	ExpireAfter     int            `yaml:"expire_after"`
+	SweepInterval   int            `yaml:"sweep_interval"`
+	StoreNamespaces []string       `yaml:"store_namespaces"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.ExpireAfter < 0 {
+		return fmt.Errorf("offline.Config: expire after must be 0 or higher")
+	}
+	if p.SweepInterval < 0 {
+		return fmt.Errorf("offline.Config: sweep interval must be 0 or higher")
+	}
+	for username, quota := range p.UserQuotas {
+		if quota < 0 {
+			return fmt.Errorf("offline.Config: invalid quota for user %s: %d", username, quota)
+		}
+	}
+	for _, ns := range p.StoreNamespaces {
+		if len(ns) == 0 {
+			return fmt.Errorf("offline.Config: store namespace must not be empty")
+		}
+	}
+	c.QueueSize = p.QueueSize
+	c.UserQuotas = p.UserQuotas
+	c.ExpireAfter = time.Second * time.Duration(p.ExpireAfter)
+	c.SweepInterval = time.Second * time.Duration(p.SweepInterval)
+	c.StoreNamespaces = p.StoreNamespaces
+	if c.ExpireAfter > 0 && c.SweepInterval == 0 {
+		c.SweepInterval = defaultSweepInterval
+	}
+	return nil
 }
 
 // Offline represents an offline server stream module.
 type Offline struct {
-	cfg        *Config
-	router     *router.Router
-	actorCh    chan func()
-	shutdownCh chan chan bool
+	cfg             *Config
+	router          *router.Router
+	storeNamespaces map[string]bool
+	actorCh         chan func()
+	shutdownCh      chan chan bool
 }
 
 // New returns an offline server stream module.
 func New(config *Config, disco *xep0030.DiscoInfo, router *router.Router) (*Offline, chan<- chan bool) {
 	r := &Offline{
-		cfg:        config,
-		router:     router,
-		actorCh:    make(chan func(), mailboxSize),
-		shutdownCh: make(chan chan bool),
+		cfg:             config,
+		router:          router,
+		storeNamespaces: make(map[string]bool),
+		actorCh:         make(chan func(), mailboxSize),
+		shutdownCh:      make(chan chan bool),
+	}
+	storeNamespaces := config.StoreNamespaces
+	if storeNamespaces == nil {
+		storeNamespaces = defaultStoreNamespaces
+	}
+	for _, ns := range storeNamespaces {
+		r.storeNamespaces[ns] = true
 	}
 	go r.loop()
 	if disco != nil {
 		disco.RegisterServerFeature(offlineNamespace)
+		disco.RegisterServerFeature(flexibleOfflineNamespace)
+		disco.RegisterNodeProvider(flexibleOfflineNamespace, &nodeProvider{offline: r})
 	}
 	return r, r.shutdownCh
 }
@@ -55,17 +128,33 @@ func (o *Offline) ArchiveMessage(message *xmpp.Message) {
 
 // DeliverOfflineMessages delivers every archived offline messages to the peer
 // deleting them from storage.
+// In case the peer requested flexible offline message retrieval
+// no message will be delivered automatically.
 func (o *Offline) DeliverOfflineMessages(stm stream.C2S) {
 	o.actorCh <- func() { o.deliverOfflineMessages(stm) }
 }
 
 // runs on it's own goroutine
 func (o *Offline) loop() {
+	var sweepCh <-chan time.Time
+	if o.cfg.ExpireAfter > 0 {
+		interval := o.cfg.SweepInterval
+		if interval == 0 {
+			interval = defaultSweepInterval
+		}
+		tc := time.NewTicker(interval)
+		defer tc.Stop()
+		sweepCh = tc.C
+	}
 	for {
 		select {
 		case f := <-o.actorCh:
 			f()
+		case <-sweepCh:
+			o.deleteExpiredMessages()
 		case c := <-o.shutdownCh:
+			// make sure every pending message gets archived
+			actor.Drain(o.actorCh)
 			c <- true
 			return
 		}
@@ -73,54 +162,138 @@ func (o *Offline) loop() {
 }
 
 func (o *Offline) archiveMessage(message *xmpp.Message) {
-	if !isMessageArchivable(message) {
+	if !o.isMessageArchivable(message) {
+		if isBounceable(message) {
+			o.router.Route(message.ServiceUnavailableError())
+		}
 		return
 	}
 	toJID := message.ToJID()
-	queueSize, err := storage.CountOfflineMessages(toJID.Node())
+	queueSize, err := storage.CountOfflineMessages(context.Background(), toJID.Node())
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
+		o.router.Route(message.InternalServerError())
 		return
 	}
-	if queueSize >= o.cfg.QueueSize {
+	if queueSize >= o.userQuota(toJID.Node()) {
 		o.router.Route(message.ServiceUnavailableError())
 		return
 	}
+	// keep stanza ID (XEP-0359) so that clients can reference stored message
+	by := toJID.ToBareJID().String()
+	id := message.StanzaID(by)
+	if len(id) == 0 {
+		id = uuid.New()
+	}
 	delayed, _ := xmpp.NewMessageFromElement(message, message.FromJID(), message.ToJID())
 	delayed.Delay(message.FromJID().Domain(), "Offline Storage")
-	if err := storage.InsertOfflineMessage(delayed, toJID.Node()); err != nil {
-		log.Error(err)
+	delayed.SetStanzaID(by, id)
+
+	om := &model.OfflineMessage{
+		ID:        id,
+		Username:  toJID.Node(),
+		Message:   delayed,
+		CreatedAt: time.Now(),
+	}
+	if err := storage.InsertOfflineMessage(context.Background(), om); err != nil {
+		logger.Error(err)
 		o.router.Route(message.InternalServerError())
 		return
 	}
-	log.Infof("archived offline message... id: %s", message.ID())
+	logger.Infof("archived offline message... id: %s", message.ID())
 }
 
 func (o *Offline) deliverOfflineMessages(stm stream.C2S) {
 	if stm.Context().Bool(offlineDeliveredCtxKey) {
 		return // already delivered
 	}
+	if stm.Context().Bool(offlineFlexibleCtxKey) {
+		return // flexible offline message retrieval requested
+	}
 	// deliver offline messages
 	userJID := stm.JID()
-	msgs, err := storage.FetchOfflineMessages(userJID.Node())
+	expiredAt := o.expirationTime()
+
+	var cnt int
+	err := storage.ForEachOfflineMessage(stm.Context(), userJID.Node(), func(m *model.OfflineMessage) error {
+		if m.CreatedAt.Before(expiredAt) {
+			return nil
+		}
+		o.router.Route(stampMessage(m))
+		cnt++
+		return nil
+	})
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return
 	}
-	if len(msgs) == 0 {
+	if cnt == 0 {
 		return
 	}
-	log.Infof("delivering offline msgs: %s... count: %d", userJID, len(msgs))
+	logger.Infof("delivered offline msgs: %s... count: %d", userJID, cnt)
 
+	// messages have already been routed, so their deletion must not be
+	// aborted by a stream disconnection, or they would be delivered again.
+	if err := storage.DeleteOfflineMessages(context.Background(), userJID.Node()); err != nil {
+		logger.Error(err)
+	}
+	stm.Context().SetBool(true, offlineDeliveredCtxKey)
+}
+
+// stampMessage returns an archived message, assigning its offline identifier
+// as stanza ID (XEP-0359) in case it was archived before they were assigned.
+func stampMessage(m *model.OfflineMessage) *xmpp.Message {
+	by := m.Message.ToJID().ToBareJID().String()
+	if len(m.Message.StanzaID(by)) == 0 {
+		m.Message.SetStanzaID(by, m.ID)
+	}
+	return m.Message
+}
+
+func (o *Offline) deleteExpiredMessages() {
+	cnt, err := storage.DeleteOfflineMessagesOlderThan(context.Background(), time.Now().Add(-o.cfg.ExpireAfter))
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if cnt > 0 {
+		logger.Infof("deleted %d expired offline messages", cnt)
+	}
+}
+
+// fetchMessages returns user's offline queue, filtering out
+// those messages that expired since the last sweep.
+func (o *Offline) fetchMessages(ctx context.Context, username string) ([]model.OfflineMessage, error) {
+	msgs, err := storage.FetchOfflineMessages(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if o.cfg.ExpireAfter == 0 {
+		return msgs, nil
+	}
+	expiredAt := o.expirationTime()
+	ret := msgs[:0]
 	for _, m := range msgs {
-		o.router.Route(m)
+		if m.CreatedAt.Before(expiredAt) {
+			continue
+		}
+		ret = append(ret, m)
 	}
-	if err := storage.DeleteOfflineMessages(userJID.Node()); err != nil {
-		log.Error(err)
+	return ret, nil
+}
+
+// expirationTime returns the creation time before which offline
+// messages are considered expired, or the zero time if they never expire.
+func (o *Offline) expirationTime() time.Time {
+	if o.cfg.ExpireAfter == 0 {
+		return time.Time{}
 	}
-	stm.Context().SetBool(true, offlineDeliveredCtxKey)
+	return time.Now().Add(-o.cfg.ExpireAfter)
 }
 
-func isMessageArchivable(message *xmpp.Message) bool {
-	return message.IsNormal() || (message.IsChat() && message.IsMessageWithBody())
+func (o *Offline) userQuota(username string) int {
+	if quota, ok := o.cfg.UserQuotas[username]; ok {
+		return quota
+	}
+	return o.cfg.QueueSize
 }
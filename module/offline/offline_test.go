@@ -6,10 +6,12 @@
 package offline
 
 import (
+	"context"
 	"crypto/tls"
 	"testing"
 	"time"
 
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/storage/memstorage"
@@ -18,8 +20,33 @@ import (
 	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 )
 
+func TestOffline_Config(t *testing.T) {
+	cfg := Config{}
+	err := yaml.Unmarshal([]byte(`{queue_size: 10, expire_after: -1}`), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte(`{queue_size: 10, user_quotas: {ortuman: -5}}`), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte(`{queue_size: 10, expire_after: 3600, user_quotas: {ortuman: 50}}`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 10, cfg.QueueSize)
+	require.Equal(t, time.Hour, cfg.ExpireAfter)
+	require.Equal(t, defaultSweepInterval, cfg.SweepInterval)
+	require.Equal(t, 50, cfg.UserQuotas["ortuman"])
+	require.Nil(t, cfg.StoreNamespaces)
+
+	err = yaml.Unmarshal([]byte(`{queue_size: 10, store_namespaces: [""]}`), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte(`{queue_size: 10, store_namespaces: ["urn:xmpp:receipts"]}`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, []string{"urn:xmpp:receipts"}, cfg.StoreNamespaces)
+}
+
 func TestOffline_ArchiveMessage(t *testing.T) {
 	r, _, shutdown := setupTest("jackal.im")
 	defer shutdown()
@@ -42,7 +69,7 @@ func TestOffline_ArchiveMessage(t *testing.T) {
 	// wait for insertion...
 	time.Sleep(time.Millisecond * 250)
 
-	msgs, err := storage.FetchOfflineMessages("juliet")
+	msgs, err := storage.FetchOfflineMessages(context.Background(), "juliet")
 	require.Nil(t, err)
 	require.Equal(t, 1, len(msgs))
 
@@ -68,6 +95,166 @@ func TestOffline_ArchiveMessage(t *testing.T) {
 	require.Equal(t, msgID, elem.ID())
 }
 
+func TestOffline_StanzaID(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("juliet", "jackal.im", "garden", true)
+
+	x, shutdownCh := New(&Config{QueueSize: 10}, nil, r)
+	defer close(shutdownCh)
+
+	stanzaID := uuid.New()
+	msg := xmpp.NewMessageType(uuid.New(), "normal")
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+	msg.SetStanzaID("juliet@jackal.im", stanzaID)
+	x.ArchiveMessage(msg)
+
+	// missing stanza ID gets assigned on archiving
+	msg = xmpp.NewMessageType(uuid.New(), "normal")
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+	x.ArchiveMessage(msg)
+
+	// wait for insertion...
+	time.Sleep(time.Millisecond * 250)
+
+	msgs, err := storage.FetchOfflineMessages(context.Background(), "juliet")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, stanzaID, msgs[0].ID)
+	require.Equal(t, stanzaID, msgs[0].Message.StanzaID("juliet@jackal.im"))
+	require.NotEqual(t, "", msgs[1].ID)
+	require.Equal(t, msgs[1].ID, msgs[1].Message.StanzaID("juliet@jackal.im"))
+}
+
+func TestOffline_UserQuota(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("juliet", "jackal.im", "garden", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j1)
+	r.Bind(stm)
+
+	x, shutdownCh := New(&Config{QueueSize: 1, UserQuotas: map[string]int{"juliet": 2}}, nil, r)
+	defer close(shutdownCh)
+
+	for i := 0; i < 2; i++ {
+		msg := xmpp.NewMessageType(uuid.New(), "normal")
+		msg.SetFromJID(j1)
+		msg.SetToJID(j2)
+		x.ArchiveMessage(msg)
+	}
+	// wait for insertion...
+	time.Sleep(time.Millisecond * 250)
+
+	cnt, err := storage.CountOfflineMessages(context.Background(), "juliet")
+	require.Nil(t, err)
+	require.Equal(t, 2, cnt)
+
+	msg := xmpp.NewMessageType(uuid.New(), "normal")
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+	x.ArchiveMessage(msg)
+
+	elem := stm.FetchElement()
+	require.NotNil(t, elem)
+	require.Equal(t, xmpp.ErrServiceUnavailable.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestOffline_StorageError(t *testing.T) {
+	r, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("juliet", "jackal.im", "garden", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j1)
+	r.Bind(stm)
+
+	x, shutdownCh := New(&Config{QueueSize: 10}, nil, r)
+	defer close(shutdownCh)
+
+	s.EnableMockedError()
+	defer s.DisableMockedError()
+
+	msg := xmpp.NewMessageType(uuid.New(), "normal")
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+	x.ArchiveMessage(msg)
+
+	elem := stm.FetchElement()
+	require.NotNil(t, elem)
+	require.Equal(t, xmpp.ErrInternalServerError.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestOffline_ExpireMessages(t *testing.T) {
+	r, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("juliet", "jackal.im", "garden", true)
+
+	expiredID := uuid.New()
+	validID := uuid.New()
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage(expiredID, j1, j2, time.Now().Add(-time.Hour)))
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage(validID, j1, j2, time.Now()))
+
+	x, shutdownCh := New(&Config{QueueSize: 10, ExpireAfter: time.Minute, SweepInterval: time.Millisecond * 100}, nil, r)
+	defer close(shutdownCh)
+
+	// wait for sweep...
+	time.Sleep(time.Millisecond * 250)
+
+	msgs, err := storage.FetchOfflineMessages(context.Background(), "juliet")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, validID, msgs[0].ID)
+
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	r.Bind(stm2)
+
+	x.DeliverOfflineMessages(stm2)
+
+	elem := stm2.FetchElement()
+	require.Equal(t, validID, elem.ID())
+}
+
+func TestOffline_ShutdownFlush(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("juliet", "jackal.im", "garden", true)
+
+	x, shutdownCh := New(&Config{QueueSize: 100}, nil, r)
+	for i := 0; i < 50; i++ {
+		msg := xmpp.NewMessageType(uuid.New(), "normal")
+		msg.SetFromJID(j1)
+		msg.SetToJID(j2)
+		x.ArchiveMessage(msg)
+	}
+	// every pending message should be archived before shutting down
+	c := make(chan bool)
+	shutdownCh <- c
+	<-c
+
+	cnt, err := storage.CountOfflineMessages(context.Background(), "juliet")
+	require.Nil(t, err)
+	require.Equal(t, 50, cnt)
+}
+
+func tUtilOfflineMessage(id string, from, to *jid.JID, createdAt time.Time) *model.OfflineMessage {
+	msg := xmpp.NewMessageType(id, "normal")
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+	return &model.OfflineMessage{ID: id, Username: to.Node(), Message: msg, CreatedAt: createdAt}
+}
+
 func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
 	r, _ := router.New(&router.Config{
 		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package offline
+
+import "github.com/ortuman/jackal/xmpp"
+
+const (
+	hintsNamespace    = "urn:xmpp:hints"
+	receiptsNamespace = "urn:xmpp:receipts"
+)
+
+// defaultStoreNamespaces contains the payloads that make a bodiless chat
+// message worth archiving: delivery receipts (XEP-0184), chat markers (XEP-0333)
+// and end-to-end encrypted content (XEP-0384, XEP-0373 and XEP-0027).
+var defaultStoreNamespaces = []string{
+	receiptsNamespace,
+	"urn:xmpp:chat-markers:0",
+	"eu.siacs.conversations.axolotl",
+	"urn:xmpp:omemo:2",
+	"urn:xmpp:openpgp:0",
+	"jabber:x:encrypted",
+}
+
+// isMessageArchivable returns whether or not a message should be stored.
+// Processing hints (XEP-0334) take precedence over any other rule,
+// then normal messages and chat messages carrying a body or any of the
+// configured payload namespaces are archived.
+func (o *Offline) isMessageArchivable(message *xmpp.Message) bool {
+	if !message.IsNormal() && !message.IsChat() {
+		return false
+	}
+	if hasHint(message, "no-store") {
+		return false
+	}
+	if hasHint(message, "store") || message.IsNormal() || message.IsMessageWithBody() {
+		return true
+	}
+	for _, elem := range message.Elements().All() {
+		if o.storeNamespaces[elem.Namespace()] {
+			return true
+		}
+	}
+	return false
+}
+
+// isBounceable returns whether or not a sender should be notified
+// about a message that couldn't be stored, that is, it had content
+// or the sender was expecting a delivery receipt.
+func isBounceable(message *xmpp.Message) bool {
+	if !message.IsNormal() && !message.IsChat() {
+		return false
+	}
+	return message.IsMessageWithBody() || message.Elements().ChildNamespace("request", receiptsNamespace) != nil
+}
+
+func hasHint(message *xmpp.Message, hint string) bool {
+	return message.Elements().ChildNamespace(hint, hintsNamespace) != nil
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package offline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffline_IsMessageArchivable(t *testing.T) {
+	x, shutdownCh := New(&Config{}, nil, nil)
+	defer close(shutdownCh)
+
+	require.True(t, x.isMessageArchivable(tUtilMessage(xmpp.NormalType)))
+	require.False(t, x.isMessageArchivable(tUtilMessage(xmpp.ChatType)))
+	require.False(t, x.isMessageArchivable(tUtilMessage(xmpp.HeadlineType)))
+	require.False(t, x.isMessageArchivable(tUtilMessage(xmpp.GroupChatType, xmpp.NewElementName("body"))))
+	require.True(t, x.isMessageArchivable(tUtilMessage(xmpp.ChatType, xmpp.NewElementName("body"))))
+
+	// receipts, markers and encrypted payloads
+	require.True(t, x.isMessageArchivable(tUtilMessage(xmpp.ChatType, xmpp.NewElementNamespace("received", receiptsNamespace))))
+	require.True(t, x.isMessageArchivable(tUtilMessage(xmpp.ChatType, xmpp.NewElementNamespace("displayed", "urn:xmpp:chat-markers:0"))))
+	require.True(t, x.isMessageArchivable(tUtilMessage(xmpp.ChatType, xmpp.NewElementNamespace("encrypted", "eu.siacs.conversations.axolotl"))))
+	require.False(t, x.isMessageArchivable(tUtilMessage(xmpp.ChatType, xmpp.NewElementNamespace("composing", "http://jabber.org/protocol/chatstates"))))
+
+	// processing hints
+	require.True(t, x.isMessageArchivable(tUtilMessage(xmpp.ChatType, xmpp.NewElementNamespace("store", hintsNamespace))))
+	require.False(t, x.isMessageArchivable(tUtilMessage(xmpp.NormalType, xmpp.NewElementNamespace("no-store", hintsNamespace))))
+	require.True(t, x.isMessageArchivable(tUtilMessage(xmpp.ChatType, xmpp.NewElementName("body"), xmpp.NewElementNamespace("no-permanent-store", hintsNamespace))))
+
+	// custom namespaces
+	x2, shutdownCh2 := New(&Config{StoreNamespaces: []string{"http://jabber.org/protocol/chatstates"}}, nil, nil)
+	defer close(shutdownCh2)
+
+	require.True(t, x2.isMessageArchivable(tUtilMessage(xmpp.ChatType, xmpp.NewElementNamespace("composing", "http://jabber.org/protocol/chatstates"))))
+	require.False(t, x2.isMessageArchivable(tUtilMessage(xmpp.ChatType, xmpp.NewElementNamespace("received", receiptsNamespace))))
+}
+
+func TestOffline_Bounce(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("juliet", "jackal.im", "garden", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j1)
+	r.Bind(stm)
+
+	x, shutdownCh := New(&Config{QueueSize: 10}, nil, r)
+	defer close(shutdownCh)
+
+	// silently discarded
+	msg := tUtilMessage(xmpp.ChatType, xmpp.NewElementNamespace("composing", "http://jabber.org/protocol/chatstates"))
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+	x.ArchiveMessage(msg)
+
+	// sender expects a receipt
+	msgID := uuid.New()
+	msg = tUtilMessage(xmpp.ChatType, xmpp.NewElementNamespace("request", receiptsNamespace), xmpp.NewElementNamespace("no-store", hintsNamespace))
+	msg.SetID(msgID)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+	x.ArchiveMessage(msg)
+
+	elem := stm.FetchElement()
+	require.Equal(t, msgID, elem.ID())
+	require.Equal(t, xmpp.ErrServiceUnavailable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// wait for insertion...
+	time.Sleep(time.Millisecond * 250)
+
+	cnt, err := storage.CountOfflineMessages(context.Background(), "juliet")
+	require.Nil(t, err)
+	require.Equal(t, 0, cnt)
+}
+
+func tUtilMessage(typ string, elems ...xmpp.XElement) *xmpp.Message {
+	msg := xmpp.NewMessageType(uuid.New(), typ)
+	msg.AppendElements(elems)
+	return msg
+}
@@ -6,12 +6,17 @@
 package roster
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"sync"
 
+	"github.com/ortuman/jackal/audit"
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/module/actor"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
@@ -22,13 +27,42 @@ import (
 
 const mailboxSize = 2048
 
+var logger = log.WithFields(log.Fields{"module": "roster"})
+
 const rosterNamespace = "jabber:iq:roster"
 
 const rosterRequestedCtxKey = "roster:requested"
 
+const defaultMaxItems = 2500
+
+var errRosterFull = errors.New("roster: maximum number of items reached")
+
 // Config represents a roster configuration.
 type Config struct {
+	Versioning bool
+
+	// MaxItems is the maximum number of items a user roster can hold,
+	// bounding the size of roster results. If zero, defaultMaxItems is used.
+	MaxItems int
+}
+
+type configProxy struct {
 	Versioning bool `yaml:"versioning"`
+	MaxItems   int  `yaml:"max_items"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.MaxItems < 0 {
+		return errors.New("roster.Config: max items must be 0 or higher")
+	}
+	c.Versioning = p.Versioning
+	c.MaxItems = p.MaxItems
+	return nil
 }
 
 // Roster represents a roster server stream module.
@@ -62,8 +96,8 @@ func (r *Roster) MatchesIQ(iq *xmpp.IQ) bool {
 // over the associated stream.
 func (r *Roster) ProcessIQ(iq *xmpp.IQ, stm stream.C2S) {
 	r.actorCh <- func() {
-		if err := r.processIQ(iq, stm); err != nil {
-			log.Error(err)
+		if err := r.processIQ(stm.Context(), iq, stm); err != nil {
+			logger.Error(err)
 		}
 	}
 }
@@ -71,8 +105,9 @@ func (r *Roster) ProcessIQ(iq *xmpp.IQ, stm stream.C2S) {
 // ProcessPresence process an incoming roster presence.
 func (r *Roster) ProcessPresence(presence *xmpp.Presence) {
 	r.actorCh <- func() {
-		if err := r.processPresence(presence); err != nil {
-			log.Error(err)
+		// not bound to any stream, as the sender could be already disconnected
+		if err := r.processPresence(context.Background(), presence); err != nil {
+			logger.Error(err)
 		}
 	}
 }
@@ -99,58 +134,56 @@ func (r *Roster) loop() {
 		case f := <-r.actorCh:
 			f()
 		case c := <-r.shutdownCh:
+			actor.Drain(r.actorCh)
 			c <- true
 			return
 		}
 	}
 }
 
-func (r *Roster) processIQ(iq *xmpp.IQ, stm stream.C2S) error {
+func (r *Roster) processIQ(ctx context.Context, iq *xmpp.IQ, stm stream.C2S) error {
 	var err error
 	q := iq.Elements().ChildNamespace("query", rosterNamespace)
 	if iq.IsGet() {
-		err = r.sendRoster(iq, q, stm)
+		err = r.sendRoster(ctx, iq, q, stm)
 	} else if iq.IsSet() {
-		err = r.updateRoster(iq, q, stm)
+		err = r.updateRoster(ctx, iq, q, stm)
 	} else {
 		stm.SendElement(iq.BadRequestError())
 	}
 	return err
 }
 
-func (r *Roster) sendRoster(iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S) error {
+func (r *Roster) sendRoster(ctx context.Context, iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S) error {
 	if query.Elements().Count() > 0 {
 		stm.SendElement(iq.BadRequestError())
 		return nil
 	}
 	userJID := stm.JID()
 
-	log.Infof("retrieving user roster... (%s)", userJID)
+	logger.Infof("retrieving user roster... (%s)", userJID)
 
-	itms, ver, err := storage.FetchRosterItems(userJID.Node())
+	itms, ver, err := storage.FetchRosterItemsPage(ctx, userJID.Node(), "", storage.PageSize)
 	if err != nil {
 		stm.SendElement(iq.InternalServerError())
 		return err
 	}
 	v := r.parseVer(query.Attributes().Get("ver"))
+	pushAll := v == 0 || v < ver.DeletionVer
 
 	res := iq.ResultIQ()
-	if v == 0 || v < ver.DeletionVer {
-		// push all roster items
-		q := xmpp.NewElementNamespace("query", rosterNamespace)
-		if r.cfg.Versioning {
-			q.SetAttribute("ver", fmt.Sprintf("v%d", ver.Ver))
-		}
-		for _, itm := range itms {
-			q.AppendElement(itm.Element())
-		}
-		res.AppendElement(q)
-		stm.SendElement(res)
-	} else {
+	q := xmpp.NewElementNamespace("query", rosterNamespace)
+	if !pushAll {
 		// push roster changes
 		stm.SendElement(res)
+	} else if r.cfg.Versioning {
+		q.SetAttribute("ver", fmt.Sprintf("v%d", ver.Ver))
+	}
+	for {
 		for _, itm := range itms {
-			if itm.Ver > v {
+			if pushAll {
+				q.AppendElement(itm.Element())
+			} else if itm.Ver > v {
 				iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
 				q := xmpp.NewElementNamespace("query", rosterNamespace)
 				q.SetAttribute("ver", fmt.Sprintf("v%d", itm.Ver))
@@ -159,12 +192,27 @@ func (r *Roster) sendRoster(iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S) er
 				stm.SendElement(iq)
 			}
 		}
+		if len(itms) < storage.PageSize {
+			break
+		}
+		itms, _, err = storage.FetchRosterItemsPage(ctx, userJID.Node(), itms[len(itms)-1].JID, storage.PageSize)
+		if err != nil {
+			if pushAll {
+				stm.SendElement(iq.InternalServerError())
+			}
+			return err
+		}
+	}
+	if pushAll {
+		// push all roster items
+		res.AppendElement(q)
+		stm.SendElement(res)
 	}
 	stm.Context().SetBool(true, rosterRequestedCtxKey)
 	return nil
 }
 
-func (r *Roster) updateRoster(iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S) error {
+func (r *Roster) updateRoster(ctx context.Context, iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S) error {
 	itms := query.Elements().Children("item")
 	if len(itms) != 1 {
 		stm.SendElement(iq.BadRequestError())
@@ -177,12 +225,18 @@ func (r *Roster) updateRoster(iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S)
 	}
 	switch ri.Subscription {
 	case rostermodel.SubscriptionRemove:
-		if err := r.removeItem(ri, stm); err != nil {
+		if err := r.removeItem(ctx, ri, stm); err != nil {
 			stm.SendElement(iq.InternalServerError())
 			return err
 		}
 	default:
-		if err := r.updateItem(ri, stm); err != nil {
+		switch err := r.updateItem(ctx, ri, stm); err {
+		case nil:
+			break
+		case errRosterFull:
+			stm.SendElement(iq.NotAllowedError())
+			return nil
+		default:
 			stm.SendElement(iq.InternalServerError())
 			return err
 		}
@@ -191,13 +245,13 @@ func (r *Roster) updateRoster(iq *xmpp.IQ, query xmpp.XElement, stm stream.C2S)
 	return nil
 }
 
-func (r *Roster) updateItem(ri *rostermodel.Item, stm stream.C2S) error {
+func (r *Roster) updateItem(ctx context.Context, ri *rostermodel.Item, stm stream.C2S) error {
 	userJID := stm.JID().ToBareJID()
 	contactJID := ri.ContactJID()
 
-	log.Infof("updating roster item - contact: %s (%s)", contactJID, userJID)
+	logger.Infof("updating roster item - contact: %s (%s)", contactJID, userJID)
 
-	usrRi, err := storage.FetchRosterItem(userJID.Node(), contactJID.String())
+	usrRi, err := storage.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
 	if err != nil {
 		return err
 	}
@@ -209,6 +263,9 @@ func (r *Roster) updateItem(ri *rostermodel.Item, stm stream.C2S) error {
 		usrRi.Groups = ri.Groups
 
 	} else {
+		if err := r.checkRosterSize(ctx, userJID.Node()); err != nil {
+			return err
+		}
 		usrRi = &rostermodel.Item{
 			Username:     userJID.Node(),
 			JID:          ri.JID,
@@ -221,15 +278,16 @@ func (r *Roster) updateItem(ri *rostermodel.Item, stm stream.C2S) error {
 	return r.insertItem(usrRi, userJID)
 }
 
-func (r *Roster) removeItem(ri *rostermodel.Item, stm stream.C2S) error {
+func (r *Roster) removeItem(ctx context.Context, ri *rostermodel.Item, stm stream.C2S) error {
 	var unsubscribe, unsubscribed *xmpp.Presence
 
 	userJID := stm.JID().ToBareJID()
 	contactJID := ri.ContactJID()
 
-	log.Infof("removing roster item: %v (%s)", contactJID, userJID)
+	logger.Infof("removing roster item: %v (%s)", contactJID, userJID)
+	r.recordSubscriptionChange(userJID, contactJID, rostermodel.SubscriptionRemove)
 
-	usrRi, err := storage.FetchRosterItem(userJID.Node(), contactJID.String())
+	usrRi, err := storage.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
 	if err != nil {
 		return err
 	}
@@ -248,7 +306,7 @@ func (r *Roster) removeItem(ri *rostermodel.Item, stm stream.C2S) error {
 		usrRi.Subscription = rostermodel.SubscriptionRemove
 		usrRi.Ask = false
 
-		_, err := r.deleteNotification(contactJID.Node(), userJID)
+		_, err := r.deleteNotification(ctx, contactJID.Node(), userJID)
 		if err != nil {
 			return err
 		}
@@ -257,7 +315,7 @@ func (r *Roster) removeItem(ri *rostermodel.Item, stm stream.C2S) error {
 		}
 	}
 	if r.router.IsLocalHost(contactJID.Domain()) {
-		cntRi, err := storage.FetchRosterItem(contactJID.Node(), userJID.String())
+		cntRi, err := storage.FetchRosterItem(ctx, contactJID.Node(), userJID.String())
 		if err != nil {
 			return err
 		}
@@ -294,32 +352,36 @@ func (r *Roster) removeItem(ri *rostermodel.Item, stm stream.C2S) error {
 	return nil
 }
 
-func (r *Roster) processPresence(presence *xmpp.Presence) error {
+func (r *Roster) processPresence(ctx context.Context, presence *xmpp.Presence) error {
+	switch presence.Type() {
+	case xmpp.SubscribeType, xmpp.SubscribedType, xmpp.UnsubscribeType, xmpp.UnsubscribedType:
+		r.recordSubscriptionChange(presence.FromJID().ToBareJID(), presence.ToJID().ToBareJID(), presence.Type())
+	}
 	switch presence.Type() {
 	case xmpp.SubscribeType:
-		return r.processSubscribe(presence)
+		return r.processSubscribe(ctx, presence)
 	case xmpp.SubscribedType:
-		return r.processSubscribed(presence)
+		return r.processSubscribed(ctx, presence)
 	case xmpp.UnsubscribeType:
-		return r.processUnsubscribe(presence)
+		return r.processUnsubscribe(ctx, presence)
 	case xmpp.UnsubscribedType:
-		return r.processUnsubscribed(presence)
+		return r.processUnsubscribed(ctx, presence)
 	case xmpp.ProbeType:
-		return r.processProbePresence(presence)
+		return r.processProbePresence(ctx, presence)
 	case xmpp.AvailableType, xmpp.UnavailableType:
-		return r.processAvailablePresence(presence)
+		return r.processAvailablePresence(ctx, presence)
 	}
 	return nil
 }
 
-func (r *Roster) processSubscribe(presence *xmpp.Presence) error {
+func (r *Roster) processSubscribe(ctx context.Context, presence *xmpp.Presence) error {
 	userJID := presence.FromJID().ToBareJID()
 	contactJID := presence.ToJID().ToBareJID()
 
-	log.Infof("processing 'subscribe' - contact: %s (%s)", contactJID, userJID)
+	logger.Infof("processing 'subscribe' - contact: %s (%s)", contactJID, userJID)
 
 	if r.router.IsLocalHost(userJID.Domain()) {
-		usrRi, err := storage.FetchRosterItem(userJID.Node(), contactJID.String())
+		usrRi, err := storage.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
 		if err != nil {
 			return err
 		}
@@ -335,6 +397,15 @@ func (r *Roster) processSubscribe(presence *xmpp.Presence) error {
 				}
 			}
 		} else {
+			switch err := r.checkRosterSize(ctx, userJID.Node()); err {
+			case nil:
+				break
+			case errRosterFull:
+				r.router.Route(presence.NotAllowedError())
+				return nil
+			default:
+				return err
+			}
 			// create roster item if not previously created
 			usrRi = &rostermodel.Item{
 				Username:     userJID.Node(),
@@ -361,18 +432,18 @@ func (r *Roster) processSubscribe(presence *xmpp.Presence) error {
 	return nil
 }
 
-func (r *Roster) processSubscribed(presence *xmpp.Presence) error {
+func (r *Roster) processSubscribed(ctx context.Context, presence *xmpp.Presence) error {
 	userJID := presence.ToJID().ToBareJID()
 	contactJID := presence.FromJID().ToBareJID()
 
-	log.Infof("processing 'subscribed' - user: %s (%s)", userJID, contactJID)
+	logger.Infof("processing 'subscribed' - user: %s (%s)", userJID, contactJID)
 
 	if r.router.IsLocalHost(contactJID.Domain()) {
-		_, err := r.deleteNotification(contactJID.Node(), userJID)
+		_, err := r.deleteNotification(ctx, contactJID.Node(), userJID)
 		if err != nil {
 			return err
 		}
-		cntRi, err := storage.FetchRosterItem(contactJID.Node(), userJID.String())
+		cntRi, err := storage.FetchRosterItem(ctx, contactJID.Node(), userJID.String())
 		if err != nil {
 			return err
 		}
@@ -384,6 +455,15 @@ func (r *Roster) processSubscribed(presence *xmpp.Presence) error {
 				cntRi.Subscription = rostermodel.SubscriptionFrom
 			}
 		} else {
+			switch err := r.checkRosterSize(ctx, contactJID.Node()); err {
+			case nil:
+				break
+			case errRosterFull:
+				r.router.Route(presence.NotAllowedError())
+				return nil
+			default:
+				return err
+			}
 			// create roster item if not previously created
 			cntRi = &rostermodel.Item{
 				Username:     contactJID.Node(),
@@ -401,7 +481,7 @@ func (r *Roster) processSubscribed(presence *xmpp.Presence) error {
 	p.AppendElements(presence.Elements().All())
 
 	if r.router.IsLocalHost(userJID.Domain()) {
-		usrRi, err := storage.FetchRosterItem(userJID.Node(), contactJID.String())
+		usrRi, err := storage.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
 		if err != nil {
 			return err
 		}
@@ -425,15 +505,15 @@ func (r *Roster) processSubscribed(presence *xmpp.Presence) error {
 	return nil
 }
 
-func (r *Roster) processUnsubscribe(presence *xmpp.Presence) error {
+func (r *Roster) processUnsubscribe(ctx context.Context, presence *xmpp.Presence) error {
 	userJID := presence.FromJID().ToBareJID()
 	contactJID := presence.ToJID().ToBareJID()
 
-	log.Infof("processing 'unsubscribe' - contact: %s (%s)", contactJID, userJID)
+	logger.Infof("processing 'unsubscribe' - contact: %s (%s)", contactJID, userJID)
 
 	var usrSub string
 	if r.router.IsLocalHost(userJID.Domain()) {
-		usrRi, err := storage.FetchRosterItem(userJID.Node(), contactJID.String())
+		usrRi, err := storage.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
 		if err != nil {
 			return err
 		}
@@ -456,7 +536,7 @@ func (r *Roster) processUnsubscribe(presence *xmpp.Presence) error {
 	p.AppendElements(presence.Elements().All())
 
 	if r.router.IsLocalHost(contactJID.Domain()) {
-		cntRi, err := storage.FetchRosterItem(contactJID.Node(), userJID.String())
+		cntRi, err := storage.FetchRosterItem(ctx, contactJID.Node(), userJID.String())
 		if err != nil {
 			return err
 		}
@@ -480,15 +560,15 @@ func (r *Roster) processUnsubscribe(presence *xmpp.Presence) error {
 	return nil
 }
 
-func (r *Roster) processUnsubscribed(presence *xmpp.Presence) error {
+func (r *Roster) processUnsubscribed(ctx context.Context, presence *xmpp.Presence) error {
 	userJID := presence.ToJID().ToBareJID()
 	contactJID := presence.FromJID().ToBareJID()
 
-	log.Infof("processing 'unsubscribed' - user: %s (%s)", userJID, contactJID)
+	logger.Infof("processing 'unsubscribed' - user: %s (%s)", userJID, contactJID)
 
 	var cntSub string
 	if r.router.IsLocalHost(contactJID.Domain()) {
-		deleted, err := r.deleteNotification(contactJID.Node(), userJID)
+		deleted, err := r.deleteNotification(ctx, contactJID.Node(), userJID)
 		if err != nil {
 			return err
 		}
@@ -496,7 +576,7 @@ func (r *Roster) processUnsubscribed(presence *xmpp.Presence) error {
 		if deleted {
 			goto routePresence
 		}
-		cntRi, err := storage.FetchRosterItem(contactJID.Node(), userJID.String())
+		cntRi, err := storage.FetchRosterItem(ctx, contactJID.Node(), userJID.String())
 		if err != nil {
 			return err
 		}
@@ -520,7 +600,7 @@ routePresence:
 	p.AppendElements(presence.Elements().All())
 
 	if r.router.IsLocalHost(userJID.Domain()) {
-		usrRi, err := storage.FetchRosterItem(userJID.Node(), contactJID.String())
+		usrRi, err := storage.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
 		if err != nil {
 			return err
 		}
@@ -547,17 +627,17 @@ routePresence:
 	return nil
 }
 
-func (r *Roster) processProbePresence(presence *xmpp.Presence) error {
+func (r *Roster) processProbePresence(ctx context.Context, presence *xmpp.Presence) error {
 	userJID := presence.ToJID().ToBareJID()
 	contactJID := presence.FromJID().ToBareJID()
 
-	log.Infof("processing 'probe' - user: %s (%s)", userJID, contactJID)
+	logger.Infof("processing 'probe' - user: %s (%s)", userJID, contactJID)
 
-	ri, err := storage.FetchRosterItem(userJID.Node(), contactJID.String())
+	ri, err := storage.FetchRosterItem(ctx, userJID.Node(), contactJID.String())
 	if err != nil {
 		return err
 	}
-	usr, err := storage.FetchUser(userJID.Node())
+	usr, err := storage.FetchUser(ctx, userJID.Node())
 	if err != nil {
 		return err
 	}
@@ -573,7 +653,7 @@ func (r *Roster) processProbePresence(presence *xmpp.Presence) error {
 	return nil
 }
 
-func (r *Roster) processAvailablePresence(presence *xmpp.Presence) error {
+func (r *Roster) processAvailablePresence(ctx context.Context, presence *xmpp.Presence) error {
 	fromJID := presence.FromJID()
 
 	userJID := fromJID.ToBareJID()
@@ -583,27 +663,27 @@ func (r *Roster) processAvailablePresence(presence *xmpp.Presence) error {
 
 	// keep track of available presences
 	if presence.IsAvailable() {
-		log.Infof("processing 'available' - user: %s", fromJID)
+		logger.Infof("processing 'available' - user: %s", fromJID)
 		if _, loaded := r.onlineJIDs.LoadOrStore(fromJID.String(), presence); !loaded {
 			if replyOnBehalf {
-				if err := r.deliverRosterPresences(userJID); err != nil {
+				if err := r.deliverRosterPresences(ctx, userJID); err != nil {
 					return err
 				}
 			}
 		}
 	} else {
-		log.Infof("processing 'unavailable' - user: %s", fromJID)
+		logger.Infof("processing 'unavailable' - user: %s", fromJID)
 		r.onlineJIDs.Delete(fromJID.String())
 	}
 	if replyOnBehalf {
-		return r.broadcastPresence(presence)
+		return r.broadcastPresence(ctx, presence)
 	}
 	return r.router.Route(presence)
 }
 
-func (r *Roster) deliverRosterPresences(userJID *jid.JID) error {
+func (r *Roster) deliverRosterPresences(ctx context.Context, userJID *jid.JID) error {
 	// first, deliver pending approval notifications...
-	rns, err := storage.FetchRosterNotifications(userJID.Node())
+	rns, err := storage.FetchRosterNotifications(ctx, userJID.Node())
 	if err != nil {
 		return err
 	}
@@ -615,45 +695,41 @@ func (r *Roster) deliverRosterPresences(userJID *jid.JID) error {
 	}
 
 	// deliver roster online presences
-	items, _, err := storage.FetchRosterItems(userJID.Node())
-	if err != nil {
-		return err
-	}
-	for _, item := range items {
+	return storage.ForEachRosterItem(ctx, userJID.Node(), func(item *rostermodel.Item) error {
 		switch item.Subscription {
 		case rostermodel.SubscriptionTo, rostermodel.SubscriptionBoth:
 			contactJID := item.ContactJID()
 			if !r.router.IsLocalHost(contactJID.Domain()) {
 				r.router.Route(xmpp.NewPresence(userJID, contactJID, xmpp.ProbeType))
-				continue
+				return nil
 			}
 			r.routePresencesFrom(contactJID, userJID, xmpp.AvailableType)
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
-func (r *Roster) broadcastPresence(presence *xmpp.Presence) error {
+func (r *Roster) broadcastPresence(ctx context.Context, presence *xmpp.Presence) error {
 	fromJID := presence.FromJID()
-	itms, _, err := storage.FetchRosterItems(fromJID.Node())
-	if err != nil {
-		return err
-	}
-	for _, itm := range itms {
+	err := storage.ForEachRosterItem(ctx, fromJID.Node(), func(itm *rostermodel.Item) error {
 		switch itm.Subscription {
 		case rostermodel.SubscriptionFrom, rostermodel.SubscriptionBoth:
 			p := xmpp.NewPresence(fromJID, itm.ContactJID(), presence.Type())
 			p.AppendElements(presence.Elements().All())
 			r.router.Route(p)
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	// update last received presence
-	if usr, err := storage.FetchUser(fromJID.Node()); err != nil {
+	if usr, err := storage.FetchUser(ctx, fromJID.Node()); err != nil {
 		return err
 	} else if usr != nil {
 		usr.LastPresence = presence
-		return storage.InsertOrUpdateUser(usr)
+		return storage.InsertOrUpdateUser(ctx, usr)
 	}
 	return nil
 }
@@ -669,8 +745,43 @@ func (r *Roster) onlineJIDMatchesJID(onlineJID, j *jid.JID) bool {
 	return onlineJID.Matches(j, jid.MatchesDomain)
 }
 
+func (r *Roster) recordSubscriptionChange(userJID, contactJID *jid.JID, change string) {
+	event := &model.AuditEvent{
+		Type:    audit.RosterSubscription,
+		JID:     userJID.String(),
+		Details: map[string]string{"contact": contactJID.String(), "change": change},
+	}
+	// attribute event to the local party
+	if r.router.IsLocalHost(userJID.Domain()) {
+		event.Username = userJID.Node()
+	} else {
+		event.Username = contactJID.Node()
+	}
+	audit.Record(event)
+}
+
+// checkRosterSize returns errRosterFull in case a new item
+// can't be added to a user roster without exceeding its maximum size.
+func (r *Roster) checkRosterSize(ctx context.Context, username string) error {
+	maxItems := r.cfg.MaxItems
+	if maxItems == 0 {
+		maxItems = defaultMaxItems
+	}
+	var cnt int
+	return storage.ForEachRosterItem(ctx, username, func(_ *rostermodel.Item) error {
+		cnt++
+		if cnt >= maxItems {
+			return errRosterFull
+		}
+		return nil
+	})
+}
+
+// insertItem stores a roster item pushing it afterwards. As every other roster
+// write, it's detached from the requesting stream context so that a disconnection
+// can't leave a subscription half updated, being only bounded by storage timeout.
 func (r *Roster) insertItem(ri *rostermodel.Item, pushTo *jid.JID) error {
-	v, err := storage.InsertOrUpdateRosterItem(ri)
+	v, err := storage.InsertOrUpdateRosterItem(context.Background(), ri)
 	if err != nil {
 		return err
 	}
@@ -679,7 +790,7 @@ func (r *Roster) insertItem(ri *rostermodel.Item, pushTo *jid.JID) error {
 }
 
 func (r *Roster) deleteItem(ri *rostermodel.Item, pushTo *jid.JID) error {
-	v, err := storage.DeleteRosterItem(ri.Username, ri.JID)
+	v, err := storage.DeleteRosterItem(context.Background(), ri.Username, ri.JID)
 	if err != nil {
 		return err
 	}
@@ -707,15 +818,15 @@ func (r *Roster) pushItem(ri *rostermodel.Item, to *jid.JID) error {
 	return nil
 }
 
-func (r *Roster) deleteNotification(contact string, userJID *jid.JID) (deleted bool, err error) {
-	rn, err := storage.FetchRosterNotification(contact, userJID.String())
+func (r *Roster) deleteNotification(ctx context.Context, contact string, userJID *jid.JID) (deleted bool, err error) {
+	rn, err := storage.FetchRosterNotification(ctx, contact, userJID.String())
 	if err != nil {
 		return false, err
 	}
 	if rn == nil {
 		return false, nil
 	}
-	if err := storage.DeleteRosterNotification(contact, userJID.String()); err != nil {
+	if err := storage.DeleteRosterNotification(context.Background(), contact, userJID.String()); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -727,7 +838,7 @@ func (r *Roster) insertOrUpdateNotification(contact string, userJID *jid.JID, pr
 		JID:      userJID.String(),
 		Presence: presence,
 	}
-	return storage.InsertOrUpdateRosterNotification(rn)
+	return storage.InsertOrUpdateRosterNotification(context.Background(), rn)
 }
 
 func (r *Roster) routePresencesFrom(from *jid.JID, to *jid.JID, presenceType string) {
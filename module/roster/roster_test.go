@@ -6,6 +6,7 @@
 package roster
 
 import (
+	"context"
 	"crypto/tls"
 	"testing"
 	"time"
@@ -20,8 +21,20 @@ import (
 	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 )
 
+func TestRoster_Config(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte(`{versioning: true, max_items: 100}`), &cfg)
+	require.Nil(t, err)
+	require.True(t, cfg.Versioning)
+	require.Equal(t, 100, cfg.MaxItems)
+
+	err = yaml.Unmarshal([]byte(`{max_items: -1}`), &cfg)
+	require.NotNil(t, err)
+}
+
 func TestRoster_MatchesIQ(t *testing.T) {
 	rtr, _, shutdown := setupTest("jackal.im")
 	defer shutdown()
@@ -84,7 +97,7 @@ func TestRoster_FetchRoster(t *testing.T) {
 		Ask:          true,
 		Groups:       []string{"people", "friends"},
 	}
-	storage.InsertOrUpdateRosterItem(ri1)
+	storage.InsertOrUpdateRosterItem(context.Background(), ri1)
 
 	ri2 := &rostermodel.Item{
 		Username:     "ortuman",
@@ -94,7 +107,7 @@ func TestRoster_FetchRoster(t *testing.T) {
 		Ask:          true,
 		Groups:       []string{"others"},
 	}
-	storage.InsertOrUpdateRosterItem(ri2)
+	storage.InsertOrUpdateRosterItem(context.Background(), ri2)
 
 	r, shutdownCh = New(&Config{Versioning: true}, rtr)
 	defer close(shutdownCh)
@@ -130,6 +143,19 @@ func TestRoster_FetchRoster(t *testing.T) {
 	item := query2.Elements().Child("item")
 	require.Equal(t, "romeo@jackal.im", item.Attributes().Get("jid"))
 
+	// roster spanning several storage pages
+	pageSize := storage.PageSize
+	storage.PageSize = 1
+	defer func() { storage.PageSize = pageSize }()
+
+	q.RemoveAttribute("ver")
+	r.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	query2 = elem.Elements().ChildNamespace("query", rosterNamespace)
+	require.Equal(t, 2, query2.Elements().Count())
+	require.Equal(t, "v2", query2.Attributes().Get("ver"))
+
 	s.EnableMockedError()
 	r, shutdownCh = New(&Config{}, rtr)
 	defer close(shutdownCh)
@@ -199,7 +225,7 @@ func TestRoster_Update(t *testing.T) {
 	require.Equal(t, xmpp.ResultType, elem.Type())
 	require.Equal(t, iqID, elem.ID())
 
-	ri, err := storage.FetchRosterItem("ortuman", "noelia@jackal.im")
+	ri, err := storage.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
 	require.Nil(t, err)
 	require.NotNil(t, ri)
 	require.Equal(t, "ortuman", ri.Username)
@@ -207,18 +233,67 @@ func TestRoster_Update(t *testing.T) {
 	require.Equal(t, "My Girl", ri.Name)
 }
 
+func TestRoster_MaxItems(t *testing.T) {
+	rtr, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "garden", true)
+
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm1.SetAuthenticated(true)
+
+	r, shutdownCh := New(&Config{MaxItems: 2}, rtr)
+	defer close(shutdownCh)
+
+	rtr.Bind(stm1)
+
+	setItem := func(contact string) xmpp.XElement {
+		iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+		iq.SetFromJID(j1)
+		iq.SetToJID(j1.ToBareJID())
+		q := xmpp.NewElementNamespace("query", rosterNamespace)
+		item := xmpp.NewElementName("item")
+		item.SetAttribute("jid", contact)
+		q.AppendElement(item)
+		iq.AppendElement(q)
+		r.ProcessIQ(iq, stm1)
+		return stm1.FetchElement()
+	}
+	require.Equal(t, xmpp.ResultType, setItem("noelia@jackal.im").Type())
+	require.Equal(t, xmpp.ResultType, setItem("romeo@jackal.im").Type())
+
+	elem := setItem("juliet@jackal.im")
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, xmpp.ErrNotAllowed.Error(), elem.Error().Elements().All()[0].Name())
+
+	// existing items can still be updated
+	require.Equal(t, xmpp.ResultType, setItem("romeo@jackal.im").Type())
+
+	// subscription requests can't add new items either
+	j3, _ := jid.New("juliet", "jackal.im", "", true)
+	p := xmpp.NewPresence(j1, j3, xmpp.SubscribeType)
+	r.ProcessPresence(p)
+	elem = stm1.FetchElement()
+	require.Equal(t, "presence", elem.Name())
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+
+	ri, err := storage.FetchRosterItem(context.Background(), "ortuman", "juliet@jackal.im")
+	require.Nil(t, err)
+	require.Nil(t, ri)
+}
+
 func TestRoster_RemoveItem(t *testing.T) {
 	rtr, _, shutdown := setupTest("jackal.im")
 	defer shutdown()
 
 	// insert contact's roster item
-	storage.InsertOrUpdateRosterItem(&rostermodel.Item{
+	storage.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
 		JID:          "noelia@jackal.im",
 		Name:         "My Juliet",
 		Subscription: rostermodel.SubscriptionBoth,
 	})
-	storage.InsertOrUpdateRosterItem(&rostermodel.Item{
+	storage.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "noelia",
 		JID:          "ortuman@jackal.im",
 		Name:         "My Romeo",
@@ -249,7 +324,7 @@ func TestRoster_RemoveItem(t *testing.T) {
 	elem := stm.FetchElement()
 	require.Equal(t, iqID, elem.ID())
 
-	ri, err := storage.FetchRosterItem("ortuman", "noelia@jackal.im")
+	ri, err := storage.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
 	require.Nil(t, err)
 	require.Nil(t, ri)
 }
@@ -273,25 +348,25 @@ func TestRoster_OnlineJIDs(t *testing.T) {
 	rtr.Bind(stm2)
 
 	// user entity
-	storage.InsertOrUpdateUser(&model.User{
+	storage.InsertOrUpdateUser(context.Background(), &model.User{
 		Username:     "ortuman",
 		LastPresence: xmpp.NewPresence(j1, j1.ToBareJID(), xmpp.UnavailableType),
 	})
 
 	// roster items
-	storage.InsertOrUpdateRosterItem(&rostermodel.Item{
+	storage.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "noelia",
 		JID:          "ortuman@jackal.im",
 		Subscription: rostermodel.SubscriptionBoth,
 	})
-	storage.InsertOrUpdateRosterItem(&rostermodel.Item{
+	storage.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
 		JID:          "noelia@jackal.im",
 		Subscription: rostermodel.SubscriptionBoth,
 	})
 
 	// pending notification
-	storage.InsertOrUpdateRosterNotification(&rostermodel.Notification{
+	storage.InsertOrUpdateRosterNotification(context.Background(), &rostermodel.Notification{
 		Contact:  "ortuman",
 		JID:      j3.ToBareJID().String(),
 		Presence: xmpp.NewPresence(j3.ToBareJID(), j1.ToBareJID(), xmpp.SubscribeType),
@@ -316,7 +391,7 @@ func TestRoster_OnlineJIDs(t *testing.T) {
 	require.Equal(t, xmpp.AvailableType, elem.Type())
 
 	// check if last presence was updated
-	usr, err := storage.FetchUser("ortuman")
+	usr, err := storage.FetchUser(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.NotNil(t, usr)
 	require.NotNil(t, usr.LastPresence)
@@ -382,7 +457,7 @@ func TestRoster_Probe(t *testing.T) {
 	require.Equal(t, "noelia@jackal.im", elem.From())
 	require.Equal(t, xmpp.UnsubscribedType, elem.Type())
 
-	storage.InsertOrUpdateUser(&model.User{
+	storage.InsertOrUpdateUser(context.Background(), &model.User{
 		Username:     "noelia",
 		LastPresence: xmpp.NewPresence(j2.ToBareJID(), j2.ToBareJID(), xmpp.UnavailableType),
 	})
@@ -392,7 +467,7 @@ func TestRoster_Probe(t *testing.T) {
 	elem = stm.FetchElement()
 	require.Equal(t, xmpp.UnsubscribedType, elem.Type())
 
-	storage.InsertOrUpdateRosterItem(&rostermodel.Item{
+	storage.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "noelia",
 		JID:          "ortuman@jackal.im",
 		Subscription: rostermodel.SubscriptionFrom,
@@ -403,7 +478,7 @@ func TestRoster_Probe(t *testing.T) {
 
 	// test available presence...
 	p2 := xmpp.NewPresence(j2, j2.ToBareJID(), xmpp.AvailableType)
-	storage.InsertOrUpdateUser(&model.User{
+	storage.InsertOrUpdateUser(context.Background(), &model.User{
 		Username:     "noelia",
 		LastPresence: p2,
 	})
@@ -426,7 +501,7 @@ func TestRoster_Subscription(t *testing.T) {
 	r.ProcessPresence(xmpp.NewPresence(j1.ToBareJID(), j2.ToBareJID(), xmpp.SubscribeType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	rns, err := storage.FetchRosterNotifications("noelia")
+	rns, err := storage.FetchRosterNotifications(context.Background(), "noelia")
 	require.Nil(t, err)
 	require.Equal(t, 1, len(rns))
 
@@ -437,11 +512,11 @@ func TestRoster_Subscription(t *testing.T) {
 	r.ProcessPresence(xmpp.NewPresence(j2.ToBareJID(), j1.ToBareJID(), xmpp.UnsubscribedType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	rns, err = storage.FetchRosterNotifications("noelia")
+	rns, err = storage.FetchRosterNotifications(context.Background(), "noelia")
 	require.Nil(t, err)
 	require.Equal(t, 0, len(rns))
 
-	ri, err := storage.FetchRosterItem("ortuman", "noelia@jackal.im")
+	ri, err := storage.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionNone, ri.Subscription)
 
@@ -450,7 +525,7 @@ func TestRoster_Subscription(t *testing.T) {
 	r.ProcessPresence(xmpp.NewPresence(j2.ToBareJID(), j1.ToBareJID(), xmpp.SubscribedType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	ri, err = storage.FetchRosterItem("ortuman", "noelia@jackal.im")
+	ri, err = storage.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionTo, ri.Subscription)
 
@@ -459,7 +534,7 @@ func TestRoster_Subscription(t *testing.T) {
 	r.ProcessPresence(xmpp.NewPresence(j1.ToBareJID(), j2.ToBareJID(), xmpp.SubscribedType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	ri, err = storage.FetchRosterItem("noelia", "ortuman@jackal.im")
+	ri, err = storage.FetchRosterItem(context.Background(), "noelia", "ortuman@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionBoth, ri.Subscription)
 
@@ -467,7 +542,7 @@ func TestRoster_Subscription(t *testing.T) {
 	r.ProcessPresence(xmpp.NewPresence(j1.ToBareJID(), j2.ToBareJID(), xmpp.UnsubscribeType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	ri, err = storage.FetchRosterItem("ortuman", "noelia@jackal.im")
+	ri, err = storage.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionFrom, ri.Subscription)
 
@@ -475,11 +550,11 @@ func TestRoster_Subscription(t *testing.T) {
 	r.ProcessPresence(xmpp.NewPresence(j1.ToBareJID(), j2.ToBareJID(), xmpp.UnsubscribedType))
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	ri, err = storage.FetchRosterItem("ortuman", "noelia@jackal.im")
+	ri, err = storage.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionNone, ri.Subscription)
 
-	ri, err = storage.FetchRosterItem("noelia", "ortuman@jackal.im")
+	ri, err = storage.FetchRosterItem(context.Background(), "noelia", "ortuman@jackal.im")
 	require.Nil(t, err)
 	require.Equal(t, rostermodel.SubscriptionNone, ri.Subscription)
 }
@@ -6,11 +6,13 @@
 package xep0012
 
 import (
+	"context"
 	"strconv"
 	"time"
 
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/module/actor"
 	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
@@ -21,6 +23,8 @@ import (
 
 const mailboxSize = 2048
 
+var logger = log.WithFields(log.Fields{"module": "last_activity"})
+
 const lastActivityNamespace = "jabber:iq:last"
 
 // LastActivity represents a last activity stream module.
@@ -55,7 +59,7 @@ func (x *LastActivity) MatchesIQ(iq *xmpp.IQ) bool {
 
 // ProcessIQ processes a last activity IQ taking
 // according actions over the associated stream.
-func (x *LastActivity) ProcessIQ(iq *xmpp.IQ, stm stream.C2S) {
+func (x *LastActivity) ProcessIQ(iq *xmpp.IQ, stm stream.InOutStream) {
 	x.actorCh <- func() { x.processIQ(iq, stm) }
 }
 
@@ -66,21 +70,22 @@ func (x *LastActivity) loop() {
 		case f := <-x.actorCh:
 			f()
 		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
 			c <- true
 			return
 		}
 	}
 }
 
-func (x *LastActivity) processIQ(iq *xmpp.IQ, stm stream.C2S) {
+func (x *LastActivity) processIQ(iq *xmpp.IQ, stm stream.InOutStream) {
 	fromJID := iq.FromJID()
 	toJID := iq.ToJID()
 	if toJID.IsServer() {
 		x.sendServerUptime(iq, stm)
 	} else if toJID.IsBare() {
-		ok, err := x.isSubscribedTo(toJID, fromJID)
+		ok, err := x.isSubscribedTo(stm.Context(), toJID, fromJID)
 		if err != nil {
-			log.Error(err)
+			logger.Error(err)
 			stm.SendElement(iq.InternalServerError())
 			return
 		}
@@ -94,19 +99,19 @@ func (x *LastActivity) processIQ(iq *xmpp.IQ, stm stream.C2S) {
 	}
 }
 
-func (x *LastActivity) sendServerUptime(iq *xmpp.IQ, stm stream.C2S) {
+func (x *LastActivity) sendServerUptime(iq *xmpp.IQ, stm stream.InOutStream) {
 	secs := int(time.Duration(time.Now().UnixNano()-x.startTime.UnixNano()) / time.Second)
 	x.sendReply(iq, secs, "", stm)
 }
 
-func (x *LastActivity) sendUserLastActivity(iq *xmpp.IQ, to *jid.JID, stm stream.C2S) {
+func (x *LastActivity) sendUserLastActivity(iq *xmpp.IQ, to *jid.JID, stm stream.InOutStream) {
 	if len(x.router.UserStreams(to.Node())) > 0 { // user is online
 		x.sendReply(iq, 0, "", stm)
 		return
 	}
-	usr, err := storage.FetchUser(to.Node())
+	usr, err := storage.FetchUser(stm.Context(), to.Node())
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
@@ -125,7 +130,7 @@ func (x *LastActivity) sendUserLastActivity(iq *xmpp.IQ, to *jid.JID, stm stream
 	x.sendReply(iq, secs, status, stm)
 }
 
-func (x *LastActivity) sendReply(iq *xmpp.IQ, secs int, status string, stm stream.C2S) {
+func (x *LastActivity) sendReply(iq *xmpp.IQ, secs int, status string, stm stream.InOutStream) {
 	q := xmpp.NewElementNamespace("query", lastActivityNamespace)
 	q.SetText(status)
 	q.SetAttribute("seconds", strconv.Itoa(secs))
@@ -134,11 +139,11 @@ func (x *LastActivity) sendReply(iq *xmpp.IQ, secs int, status string, stm strea
 	stm.SendElement(res)
 }
 
-func (x *LastActivity) isSubscribedTo(contact *jid.JID, userJID *jid.JID) (bool, error) {
+func (x *LastActivity) isSubscribedTo(ctx context.Context, contact *jid.JID, userJID *jid.JID) (bool, error) {
 	if contact.Matches(userJID, jid.MatchesBare) {
 		return true, nil
 	}
-	ri, err := storage.FetchRosterItem(userJID.Node(), contact.ToBareJID().String())
+	ri, err := storage.FetchRosterItem(ctx, userJID.Node(), contact.ToBareJID().String())
 	if err != nil {
 		return false, err
 	}
@@ -6,6 +6,7 @@
 package xep0012
 
 import (
+	"context"
 	"crypto/tls"
 	"testing"
 
@@ -104,11 +105,11 @@ func TestXEP0012_GetOnlineUserLastActivity(t *testing.T) {
 	st.SetText("Gone!")
 	p.AppendElement(st)
 
-	storage.InsertOrUpdateUser(&model.User{
+	storage.InsertOrUpdateUser(context.Background(), &model.User{
 		Username:     "noelia",
 		LastPresence: p,
 	})
-	storage.InsertOrUpdateRosterItem(&rostermodel.Item{
+	storage.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
 		JID:          "noelia@jackal.im",
 		Subscription: "both",
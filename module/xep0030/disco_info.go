@@ -8,6 +8,8 @@ package xep0030
 import (
 	"sync"
 
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/actor"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
@@ -16,9 +18,12 @@ import (
 
 const mailboxSize = 2048
 
+var logger = log.WithFields(log.Fields{"module": "disco"})
+
 const (
 	discoInfoNamespace  = "http://jabber.org/protocol/disco#info"
 	discoItemsNamespace = "http://jabber.org/protocol/disco#items"
+	stanzaIDNamespace   = "urn:xmpp:sid:0"
 )
 
 // DiscoInfo represents a disco info server stream module.
@@ -27,6 +32,7 @@ type DiscoInfo struct {
 	router      *router.Router
 	srvProvider *serverProvider
 	providers   map[string]InfoProvider
+	nodes       map[string]InfoProvider
 	actorCh     chan func()
 	shutdownCh  chan chan bool
 }
@@ -37,6 +43,7 @@ func New(router *router.Router) (*DiscoInfo, chan<- chan bool) {
 		router:      router,
 		srvProvider: &serverProvider{router: router},
 		providers:   make(map[string]InfoProvider),
+		nodes:       make(map[string]InfoProvider),
 		actorCh:     make(chan func(), mailboxSize),
 		shutdownCh:  make(chan chan bool),
 	}
@@ -45,6 +52,9 @@ func New(router *router.Router) (*DiscoInfo, chan<- chan bool) {
 	di.RegisterServerFeature(discoInfoNamespace)
 	di.RegisterAccountFeature(discoItemsNamespace)
 	di.RegisterAccountFeature(discoInfoNamespace)
+
+	// every message delivered to a local account gets stamped (XEP-0359)
+	di.RegisterAccountFeature(stanzaIDNamespace)
 	return di, di.shutdownCh
 }
 
@@ -92,6 +102,21 @@ func (di *DiscoInfo) UnregisterProvider(domain string) {
 	delete(di.providers, domain)
 }
 
+// RegisterNodeProvider registers a new disco info provider associated
+// to a node of any local domain or account.
+func (di *DiscoInfo) RegisterNodeProvider(node string, provider InfoProvider) {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	di.nodes[node] = provider
+}
+
+// UnregisterNodeProvider unregisters a previously registered node disco info provider.
+func (di *DiscoInfo) UnregisterNodeProvider(node string) {
+	di.mu.Lock()
+	defer di.mu.Unlock()
+	delete(di.nodes, node)
+}
+
 // MatchesIQ returns whether or not an IQ should be
 // processed by the disco info module.
 func (di *DiscoInfo) MatchesIQ(iq *xmpp.IQ) bool {
@@ -104,7 +129,7 @@ func (di *DiscoInfo) MatchesIQ(iq *xmpp.IQ) bool {
 
 // ProcessIQ processes a disco info IQ taking according actions
 // over the associated stream.
-func (di *DiscoInfo) ProcessIQ(iq *xmpp.IQ, stm stream.C2S) {
+func (di *DiscoInfo) ProcessIQ(iq *xmpp.IQ, stm stream.InOutStream) {
 	di.actorCh <- func() { di.processIQ(iq, stm) }
 }
 
@@ -115,46 +140,62 @@ func (di *DiscoInfo) loop() {
 		case f := <-di.actorCh:
 			f()
 		case c := <-di.shutdownCh:
+			actor.Drain(di.actorCh)
 			c <- true
 			return
 		}
 	}
 }
 
-func (di *DiscoInfo) processIQ(iq *xmpp.IQ, stm stream.C2S) {
+func (di *DiscoInfo) processIQ(iq *xmpp.IQ, stm stream.InOutStream) {
 	fromJID := iq.FromJID()
 	toJID := iq.ToJID()
 
+	q := iq.Elements().Child("query")
+	if q == nil {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	node := q.Attributes().Get("node")
+
 	var prov InfoProvider
 	if di.router.IsLocalHost(toJID.Domain()) {
 		prov = di.srvProvider
-	} else {
-		prov = di.providers[toJID.Domain()]
-		if prov == nil {
-			stm.SendElement(iq.ItemNotFoundError())
-			return
+		if len(node) > 0 {
+			if nodeProv := di.nodeProvider(node); nodeProv != nil {
+				prov = nodeProv
+			}
 		}
+	} else {
+		prov = di.domainProvider(toJID.Domain())
 	}
 	if prov == nil {
 		stm.SendElement(iq.ItemNotFoundError())
 		return
 	}
-	q := iq.Elements().Child("query")
-	node := q.Attributes().Get("node")
-	if q != nil {
-		switch q.Namespace() {
-		case discoInfoNamespace:
-			di.sendDiscoInfo(prov, toJID, fromJID, node, iq, stm)
-			return
-		case discoItemsNamespace:
-			di.sendDiscoItems(prov, toJID, fromJID, node, iq, stm)
-			return
-		}
+	switch q.Namespace() {
+	case discoInfoNamespace:
+		di.sendDiscoInfo(prov, toJID, fromJID, node, iq, stm)
+	case discoItemsNamespace:
+		di.sendDiscoItems(prov, toJID, fromJID, node, iq, stm)
+	default:
+		stm.SendElement(iq.BadRequestError())
 	}
-	stm.SendElement(iq.BadRequestError())
 }
 
-func (di *DiscoInfo) sendDiscoInfo(prov InfoProvider, toJID, fromJID *jid.JID, node string, iq *xmpp.IQ, stm stream.C2S) {
+func (di *DiscoInfo) domainProvider(domain string) InfoProvider {
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+	return di.providers[domain]
+}
+
+func (di *DiscoInfo) nodeProvider(node string) InfoProvider {
+	di.mu.RLock()
+	defer di.mu.RUnlock()
+	return di.nodes[node]
+}
+
+func (di *DiscoInfo) sendDiscoInfo(prov InfoProvider, toJID, fromJID *jid.JID, node string, iq *xmpp.IQ, stm stream.InOutStream) {
 	features, sErr := prov.Features(toJID, fromJID, node)
 	if sErr != nil {
 		stm.SendElement(xmpp.NewErrorStanzaFromStanza(iq, sErr, nil))
@@ -195,7 +236,7 @@ func (di *DiscoInfo) sendDiscoInfo(prov InfoProvider, toJID, fromJID *jid.JID, n
 	stm.SendElement(result)
 }
 
-func (di *DiscoInfo) sendDiscoItems(prov InfoProvider, toJID, fromJID *jid.JID, node string, iq *xmpp.IQ, stm stream.C2S) {
+func (di *DiscoInfo) sendDiscoItems(prov InfoProvider, toJID, fromJID *jid.JID, node string, iq *xmpp.IQ, stm stream.InOutStream) {
 	items, sErr := prov.Items(toJID, fromJID, node)
 	if sErr != nil {
 		stm.SendElement(xmpp.NewErrorStanzaFromStanza(iq, sErr, nil))
@@ -103,7 +103,13 @@ func TestXEP0030_SendFeatures(t *testing.T) {
 	q = elem.Elements().ChildNamespace("query", discoInfoNamespace)
 
 	require.NotNil(t, q)
-	require.Equal(t, 4, q.Elements().Count())
+	require.Equal(t, 5, q.Elements().Count())
+
+	var hasStanzaID bool
+	for _, f := range q.Elements().Children("feature") {
+		hasStanzaID = hasStanzaID || f.Attributes().Get("var") == stanzaIDNamespace
+	}
+	require.True(t, hasStanzaID)
 }
 
 func TestXEP0030_SendItems(t *testing.T) {
@@ -190,6 +196,50 @@ func TestXEP0030_Provider(t *testing.T) {
 	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
 }
 
+func TestXEP0030_NodeProvider(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	r.Bind(stm)
+
+	x, shutdownCh := New(r)
+	defer close(shutdownCh)
+
+	iq1 := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq1.SetFromJID(j)
+	iq1.SetToJID(srvJID)
+	query := xmpp.NewElementNamespace("query", discoItemsNamespace)
+	query.SetAttribute("node", "test_node")
+	iq1.AppendElement(query)
+
+	// server provider does not expose any node items
+	x.ProcessIQ(iq1, stm)
+	elem := stm.FetchElement()
+	q := elem.Elements().ChildNamespace("query", discoItemsNamespace)
+	require.NotNil(t, q)
+	require.Equal(t, 0, len(q.Elements().Children("item")))
+
+	x.RegisterNodeProvider("test_node", &testDiscoInfoProvider{})
+
+	x.ProcessIQ(iq1, stm)
+	elem = stm.FetchElement()
+	q = elem.Elements().ChildNamespace("query", discoItemsNamespace)
+	require.NotNil(t, q)
+	require.Equal(t, 1, len(q.Elements().Children("item")))
+
+	x.UnregisterNodeProvider("test_node")
+
+	x.ProcessIQ(iq1, stm)
+	elem = stm.FetchElement()
+	q = elem.Elements().ChildNamespace("query", discoItemsNamespace)
+	require.NotNil(t, q)
+	require.Equal(t, 0, len(q.Elements().Children("item")))
+}
+
 func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
 	r, _ := router.New(&router.Config{
 		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
@@ -6,9 +6,9 @@
 package xep0030
 
 import (
+	"context"
 	"sync"
 
-	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/model/rostermodel"
 	"github.com/ortuman/jackal/module/xep0004"
 	"github.com/ortuman/jackal/router"
@@ -148,9 +148,9 @@ func (sp *serverProvider) isSubscribedTo(contact *jid.JID, userJID *jid.JID) boo
 	if contact.Matches(userJID, jid.MatchesBare) {
 		return true
 	}
-	ri, err := storage.FetchRosterItem(userJID.Node(), contact.ToBareJID().String())
+	ri, err := storage.FetchRosterItem(context.Background(), userJID.Node(), contact.ToBareJID().String())
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		return false
 	}
 	if ri == nil {
@@ -6,6 +6,7 @@
 package xep0030
 
 import (
+	"context"
 	"sort"
 	"testing"
 
@@ -104,7 +105,7 @@ func TestServerProvider_Items(t *testing.T) {
 	require.Nil(t, items)
 	require.Equal(t, sErr, xmpp.ErrSubscriptionRequired)
 
-	storage.InsertOrUpdateRosterItem(&rostermodel.Item{
+	storage.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
 		JID:          "noelia@jackal.im",
 		Subscription: "both",
@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0033
+
+import (
+	"errors"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/actor"
+	"github.com/ortuman/jackal/module/offline"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const mailboxSize = 2048
+
+var logger = log.WithFields(log.Fields{"module": "multicast"})
+
+const addressNamespace = "http://jabber.org/protocol/address"
+
+const defaultMaxRecipients = 50
+
+// Config represents Extended Stanza Addressing module (XEP-0033) configuration.
+type Config struct {
+	MaxRecipients int
+}
+
+type configProxy struct {
+	MaxRecipients int `yaml:"max_recipients"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.MaxRecipients < 0 {
+		return errors.New("xep0033.Config: max recipients must not be negative")
+	}
+	c.MaxRecipients = p.MaxRecipients
+	return nil
+}
+
+// Multicast represents a stanza multicast server stream module.
+// Messages and presences addressed to a local domain carrying an
+// addresses element are fanned out to every listed recipient.
+type Multicast struct {
+	cfg        *Config
+	offline    *offline.Offline
+	router     *router.Router
+	actorCh    chan func()
+	shutdownCh chan chan bool
+}
+
+// New returns a multicast server stream module.
+func New(config *Config, disco *xep0030.DiscoInfo, offline *offline.Offline, router *router.Router) (*Multicast, chan<- chan bool) {
+	x := &Multicast{
+		cfg:        config,
+		offline:    offline,
+		router:     router,
+		actorCh:    make(chan func(), mailboxSize),
+		shutdownCh: make(chan chan bool),
+	}
+	go x.loop()
+	if disco != nil {
+		disco.RegisterServerFeature(addressNamespace)
+	}
+	return x, x.shutdownCh
+}
+
+// MatchesStanza returns whether or not a stanza should be
+// processed by the multicast module.
+func (x *Multicast) MatchesStanza(stanza xmpp.Stanza) bool {
+	switch stanza.(type) {
+	case *xmpp.Message, *xmpp.Presence:
+		break
+	default:
+		return false
+	}
+	toJID := stanza.ToJID()
+	if !toJID.IsServer() || !x.router.IsLocalHost(toJID.Domain()) {
+		return false
+	}
+	return stanza.Elements().ChildNamespace("addresses", addressNamespace) != nil
+}
+
+// ProcessStanza delivers a multicast stanza to all of its recipients,
+// replying with an error over the associated stream in case it's not acceptable.
+func (x *Multicast) ProcessStanza(stanza xmpp.Stanza, stm stream.C2S) {
+	x.actorCh <- func() { x.processStanza(stanza, stm) }
+}
+
+// runs on it's own goroutine
+func (x *Multicast) loop() {
+	for {
+		select {
+		case f := <-x.actorCh:
+			f()
+		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
+			c <- true
+			return
+		}
+	}
+}
+
+func (x *Multicast) processStanza(stanza xmpp.Stanza, stm stream.C2S) {
+	addresses := stanza.Elements().ChildNamespace("addresses", addressNamespace)
+
+	// every forwarded copy carries all addresses marked as delivered,
+	// so that no receiving entity will ever deliver it again.
+	resAddresses := xmpp.NewElementNamespace("addresses", addressNamespace)
+
+	var recipients []*jid.JID
+	seen := make(map[string]bool)
+	for _, addr := range addresses.Elements().Children("address") {
+		typ := addr.Attributes().Get("type")
+		switch typ {
+		case "to", "cc", "bcc":
+			break
+		case "replyto", "replyroom", "noreply", "ofrom":
+			resAddresses.AppendElement(addr)
+			continue
+		default:
+			stm.SendElement(xmpp.NewErrorStanzaFromStanza(stanza, xmpp.ErrBadRequest, nil))
+			return
+		}
+		if addr.Attributes().Get("delivered") == "true" {
+			if typ != "bcc" {
+				resAddresses.AppendElement(addr)
+			}
+			continue
+		}
+		jidStr := addr.Attributes().Get("jid")
+		if len(jidStr) == 0 {
+			// URI addressing is not supported
+			stm.SendElement(xmpp.NewErrorStanzaFromStanza(stanza, xmpp.ErrFeatureNotImplemented, nil))
+			return
+		}
+		rcpJID, err := jid.NewWithString(jidStr, false)
+		if err != nil {
+			stm.SendElement(xmpp.NewErrorStanzaFromStanza(stanza, xmpp.ErrJidMalformed, nil))
+			return
+		}
+		if typ != "bcc" {
+			delivered := xmpp.NewElementFromElement(addr)
+			delivered.SetAttribute("delivered", "true")
+			resAddresses.AppendElement(delivered)
+		}
+		// never deliver back to a multicast service
+		if rcpJID.IsServer() && x.router.IsLocalHost(rcpJID.Domain()) {
+			continue
+		}
+		if seen[rcpJID.String()] {
+			continue
+		}
+		seen[rcpJID.String()] = true
+		recipients = append(recipients, rcpJID)
+	}
+	if len(recipients) > x.maxRecipients() {
+		stm.SendElement(xmpp.NewErrorStanzaFromStanza(stanza, xmpp.ErrNotAcceptable, nil))
+		return
+	}
+	for _, rcpJID := range recipients {
+		if x.router.IsBlockedJID(rcpJID, stm.Username()) {
+			continue
+		}
+		elem := xmpp.NewElementFromElement(stanza)
+		elem.RemoveElementsNamespace("addresses", addressNamespace)
+		elem.AppendElement(resAddresses)
+
+		switch stanza.(type) {
+		case *xmpp.Message:
+			msg, _ := xmpp.NewMessageFromElement(elem, stm.JID(), rcpJID)
+			x.deliverMessage(msg, stm)
+		case *xmpp.Presence:
+			presence, _ := xmpp.NewPresenceFromElement(elem, stm.JID(), rcpJID)
+			x.router.Route(presence)
+		}
+	}
+	logger.Infof("multicast %s delivered to %d recipients (%s)", stanza.Name(), len(recipients), stm.JID())
+}
+
+func (x *Multicast) deliverMessage(message *xmpp.Message, stm stream.C2S) {
+	// XEP-0359: stamp messages addressed to local users
+	if toJID := message.ToJID(); len(toJID.Node()) > 0 && x.router.IsLocalHost(toJID.Domain()) {
+		message.SetStanzaID(toJID.ToBareJID().String(), uuid.New())
+	}
+	msg := message
+
+sendMessage:
+	err := x.router.Route(msg)
+	switch err {
+	case nil:
+		break
+	case router.ErrResourceNotFound:
+		// treat the stanza as if it were addressed to <node@domain>
+		msg, _ = xmpp.NewMessageFromElement(msg, msg.FromJID(), msg.ToJID().ToBareJID())
+		goto sendMessage
+	case router.ErrNotAuthenticated:
+		if x.offline != nil {
+			x.offline.ArchiveMessage(message)
+			return
+		}
+		fallthrough
+	case router.ErrNotExistingAccount, router.ErrBlockedJID:
+		stm.SendElement(message.ServiceUnavailableError())
+	case router.ErrFailedRemoteConnect:
+		stm.SendElement(message.RemoteServerNotFoundError())
+	default:
+		logger.Error(err)
+	}
+}
+
+func (x *Multicast) maxRecipients() int {
+	if x.cfg.MaxRecipients == 0 {
+		return defaultMaxRecipients
+	}
+	return x.cfg.MaxRecipients
+}
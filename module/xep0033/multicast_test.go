@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0033
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/offline"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestXEP0033_Config(t *testing.T) {
+	cfg := Config{}
+	err := yaml.Unmarshal([]byte(`{max_recipients: -1}`), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte(`{max_recipients: 10}`), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 10, cfg.MaxRecipients)
+}
+
+func TestXEP0033_Matching(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	remoteJID, _ := jid.New("", "jabber.org", "", true)
+
+	x, shutdownCh := New(&Config{}, nil, nil, r)
+	defer close(shutdownCh)
+
+	msg := tUtilMulticastMessage(j, srvJID)
+	require.True(t, x.MatchesStanza(msg))
+
+	msg.SetToJID(remoteJID)
+	require.False(t, x.MatchesStanza(msg))
+
+	msg.SetToJID(j.ToBareJID())
+	require.False(t, x.MatchesStanza(msg))
+
+	msg = xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(j)
+	msg.SetToJID(srvJID)
+	require.False(t, x.MatchesStanza(msg))
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xmpp.NewElementNamespace("addresses", addressNamespace))
+	require.False(t, x.MatchesStanza(iq))
+}
+
+func TestXEP0033_Multicast(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+	j3, _ := jid.New("romeo", "jackal.im", "orchard", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm3 := stream.NewMockC2S(uuid.New(), j3)
+	defer stm1.Disconnect(nil)
+	defer stm2.Disconnect(nil)
+	defer stm3.Disconnect(nil)
+	r.Bind(stm2)
+	r.Bind(stm3)
+
+	x, shutdownCh := New(&Config{}, nil, nil, r)
+	defer close(shutdownCh)
+
+	msg := tUtilMulticastMessage(j1, srvJID,
+		tUtilAddress("to", "noelia@jackal.im", false),
+		tUtilAddress("to", "noelia@jackal.im", false),
+		tUtilAddress("bcc", "romeo@jackal.im", false),
+		tUtilAddress("cc", "juliet@jackal.im", true),
+		tUtilAddress("cc", "jackal.im", false),
+	)
+	x.ProcessStanza(msg, stm1)
+
+	for _, stm := range []*stream.MockC2S{stm2, stm3} {
+		elem := stm.FetchElement()
+		require.Equal(t, "message", elem.Name())
+		require.Equal(t, j1.String(), elem.From())
+		require.Equal(t, "Hi all!", elem.Elements().Child("body").Text())
+
+		// bcc recipients are hidden
+		addrs := elem.Elements().ChildNamespace("addresses", addressNamespace).Elements().Children("address")
+		require.Equal(t, 4, len(addrs))
+		for _, addr := range addrs {
+			require.NotEqual(t, "bcc", addr.Attributes().Get("type"))
+			require.Equal(t, "true", addr.Attributes().Get("delivered"))
+		}
+		require.NotEqual(t, "", elem.Elements().ChildNamespace("stanza-id", "urn:xmpp:sid:0").Attributes().Get("id"))
+	}
+	// delivered once
+	stm2.SendElement(xmpp.NewElementName("marker"))
+	require.Equal(t, "marker", stm2.FetchElement().Name())
+
+	// already delivered addresses are ignored
+	msg = tUtilMulticastMessage(j1, srvJID, tUtilAddress("to", "noelia@jackal.im", true))
+	x.ProcessStanza(msg, stm1)
+
+	stm2.SendElement(xmpp.NewElementName("marker"))
+	require.Equal(t, "marker", stm2.FetchElement().Name())
+}
+
+func TestXEP0033_Offline(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	_ = storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "noelia", Password: "pencil"})
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	off, offShutdownCh := offline.New(&offline.Config{QueueSize: 10}, nil, r)
+	defer close(offShutdownCh)
+
+	x, shutdownCh := New(&Config{}, nil, off, r)
+	defer close(shutdownCh)
+
+	x.ProcessStanza(tUtilMulticastMessage(j, srvJID, tUtilAddress("to", "noelia@jackal.im/garden", false)), stm)
+
+	// wait for insertion...
+	time.Sleep(time.Millisecond * 250)
+
+	msgs, err := storage.FetchOfflineMessages(context.Background(), "noelia")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, msgs[0].ID, msgs[0].Message.StanzaID("noelia@jackal.im"))
+}
+
+func TestXEP0033_Errors(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	x, shutdownCh := New(&Config{MaxRecipients: 1}, nil, nil, r)
+	defer close(shutdownCh)
+
+	// recipients limit
+	x.ProcessStanza(tUtilMulticastMessage(j, srvJID,
+		tUtilAddress("to", "noelia@jackal.im", false),
+		tUtilAddress("cc", "romeo@jackal.im", false),
+	), stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// unknown address type
+	x.ProcessStanza(tUtilMulticastMessage(j, srvJID, tUtilAddress("from", "noelia@jackal.im", false)), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	// URI addresses
+	uri := xmpp.NewElementName("address")
+	uri.SetAttribute("type", "to")
+	uri.SetAttribute("uri", "mailto:noelia@jackal.im")
+	x.ProcessStanza(tUtilMulticastMessage(j, srvJID, uri), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrFeatureNotImplemented.Error(), elem.Error().Elements().All()[0].Name())
+
+	// non existing account
+	x.ProcessStanza(tUtilMulticastMessage(j, srvJID, tUtilAddress("to", "romeo@jackal.im", false)), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, "romeo@jackal.im", elem.From())
+	require.Equal(t, xmpp.ErrServiceUnavailable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// offline recipient and no offline storage
+	_ = storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "noelia", Password: "pencil"})
+	x.ProcessStanza(tUtilMulticastMessage(j, srvJID, tUtilAddress("to", "noelia@jackal.im/garden", false)), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, "noelia@jackal.im/garden", elem.From())
+	require.Equal(t, xmpp.ErrServiceUnavailable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// unreachable remote server
+	x.ProcessStanza(tUtilMulticastMessage(j, srvJID, tUtilAddress("to", "romeo@example.org", false)), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, "romeo@example.org", elem.From())
+	require.Equal(t, xmpp.ErrRemoteServerNotFound.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func tUtilAddress(typ, j string, delivered bool) xmpp.XElement {
+	addr := xmpp.NewElementName("address")
+	addr.SetAttribute("type", typ)
+	addr.SetAttribute("jid", j)
+	if delivered {
+		addr.SetAttribute("delivered", "true")
+	}
+	return addr
+}
+
+func tUtilMulticastMessage(from, to *jid.JID, addrs ...xmpp.XElement) *xmpp.Message {
+	addresses := xmpp.NewElementNamespace("addresses", addressNamespace)
+	addresses.AppendElements(addrs)
+
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(from)
+	msg.SetToJID(to)
+	msg.AppendElement(xmpp.NewElementName("body").SetText("Hi all!"))
+	msg.AppendElement(addresses)
+	return msg
+}
+
+func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, s, func() {
+		storage.Unset()
+	}
+}
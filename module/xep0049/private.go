@@ -9,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/actor"
+	"github.com/ortuman/jackal/module/xep0402"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
@@ -16,17 +18,26 @@ import (
 
 const mailboxSize = 2048
 
-const privateNamespace = "jabber:iq:private"
+var logger = log.WithFields(log.Fields{"module": "private"})
+
+const (
+	privateNamespace   = "jabber:iq:private"
+	bookmarksNamespace = "storage:bookmarks"
+)
 
 // Private represents a private storage server stream module.
 type Private struct {
+	bookmarks  *xep0402.Bookmarks
 	actorCh    chan func()
 	shutdownCh chan chan bool
 }
 
 // New returns a private storage IQ handler module.
-func New() (*Private, chan<- chan bool) {
+// In case bookmarks module is enabled, storage:bookmarks elements
+// are delegated to it so that they're kept in sync with PEP bookmarks.
+func New(bookmarks *xep0402.Bookmarks) (*Private, chan<- chan bool) {
 	x := &Private{
+		bookmarks:  bookmarks,
 		actorCh:    make(chan func(), mailboxSize),
 		shutdownCh: make(chan chan bool),
 	}
@@ -53,6 +64,7 @@ func (x *Private) loop() {
 		case f := <-x.actorCh:
 			f()
 		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
 			c <- true
 			return
 		}
@@ -90,11 +102,11 @@ func (x *Private) getPrivate(iq *xmpp.IQ, q xmpp.XElement, stm stream.C2S) {
 		stm.SendElement(iq.NotAcceptableError())
 		return
 	}
-	log.Infof("retrieving private element. ns: %s... (%s/%s)", privNS, stm.Username(), stm.Resource())
+	logger.Infof("retrieving private element. ns: %s... (%s/%s)", privNS, stm.Username(), stm.Resource())
 
-	privElements, err := storage.FetchPrivateXML(privNS, stm.Username())
+	privElements, err := x.fetchPrivateXML(privNS, stm)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
@@ -132,10 +144,10 @@ func (x *Private) setPrivate(iq *xmpp.IQ, q xmpp.XElement, stm stream.C2S) {
 		nsElements[ns] = elems
 	}
 	for ns, elements := range nsElements {
-		log.Infof("saving private element. ns: %s... (%s/%s)", ns, stm.Username(), stm.Resource())
+		logger.Infof("saving private element. ns: %s... (%s/%s)", ns, stm.Username(), stm.Resource())
 
-		if err := storage.InsertOrUpdatePrivateXML(elements, ns, stm.Username()); err != nil {
-			log.Error(err)
+		if err := x.storePrivateXML(elements, ns, stm); err != nil {
+			logger.Error(err)
 			stm.SendElement(iq.InternalServerError())
 			return
 		}
@@ -143,6 +155,25 @@ func (x *Private) setPrivate(iq *xmpp.IQ, q xmpp.XElement, stm stream.C2S) {
 	stm.SendElement(iq.ResultIQ())
 }
 
+func (x *Private) fetchPrivateXML(ns string, stm stream.C2S) ([]xmpp.XElement, error) {
+	if ns != bookmarksNamespace || x.bookmarks == nil {
+		return storage.FetchPrivateXML(stm.Context(), ns, stm.Username())
+	}
+	st, err := x.bookmarks.PrivateStorage(stm.Context(), stm.Username())
+	if err != nil {
+		return nil, err
+	}
+	return []xmpp.XElement{st}, nil
+}
+
+func (x *Private) storePrivateXML(elements []xmpp.XElement, ns string, stm stream.C2S) error {
+	if ns != bookmarksNamespace || x.bookmarks == nil {
+		return storage.InsertOrUpdatePrivateXML(stm.Context(), elements, ns, stm.Username())
+	}
+	// only last storage element is taken into account
+	return x.bookmarks.SetPrivateStorage(stm.Context(), stm.JID(), elements[len(elements)-1])
+}
+
 func (x *Private) isValidNamespace(ns string) bool {
 	return !strings.HasPrefix(ns, "jabber:") && !strings.HasPrefix(ns, "http://jabber.org/") && ns != "vcard-temp"
 }
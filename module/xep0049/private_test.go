@@ -6,8 +6,12 @@
 package xep0049
 
 import (
+	"context"
+	"crypto/tls"
 	"testing"
 
+	"github.com/ortuman/jackal/module/xep0402"
+	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/storage/memstorage"
 	"github.com/ortuman/jackal/stream"
@@ -24,7 +28,7 @@ func TestXEP0049_Matching(t *testing.T) {
 	stm := stream.NewMockC2S("abcd", j1)
 	defer stm.Disconnect(nil)
 
-	x, shutdownCh := New()
+	x, shutdownCh := New(nil)
 	defer close(shutdownCh)
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
@@ -43,7 +47,7 @@ func TestXEP0049_InvalidIQ(t *testing.T) {
 	stm := stream.NewMockC2S("abcd", j1)
 	defer stm.Disconnect(nil)
 
-	x, shutdownCh := New()
+	x, shutdownCh := New(nil)
 	defer close(shutdownCh)
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
@@ -96,7 +100,7 @@ func TestXEP0049_SetAndGetPrivate(t *testing.T) {
 	stm := stream.NewMockC2S("abcd", j)
 	defer stm.Disconnect(nil)
 
-	x, shutdownCh := New()
+	x, shutdownCh := New(nil)
 	defer close(shutdownCh)
 
 	iqID := uuid.New()
@@ -155,6 +159,56 @@ func TestXEP0049_SetAndGetPrivate(t *testing.T) {
 	require.Equal(t, "exodus:ns:2", q3.Elements().All()[0].Namespace())
 }
 
+func TestXEP0049_Bookmarks(t *testing.T) {
+	_, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: "jackal.im", Certificate: tls.Certificate{}}},
+	})
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	bookmarks, bookmarksShutdownCh := xep0402.New(nil, r)
+	defer close(bookmarksShutdownCh)
+
+	x, shutdownCh := New(bookmarks)
+	defer close(shutdownCh)
+
+	conference := xmpp.NewElementName("conference")
+	conference.SetAttribute("jid", "room@conference.jackal.im")
+	st := xmpp.NewElementNamespace("storage", bookmarksNamespace)
+	st.AppendElement(conference)
+	q := xmpp.NewElementNamespace("query", privateNamespace)
+	q.AppendElement(st)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(q)
+	x.ProcessIQ(iq, stm)
+	require.Equal(t, xmpp.ResultType, stm.FetchElement().Type())
+
+	// natively stored
+	bs, _ := storage.FetchBookmarks(context.Background(), "ortuman")
+	require.Equal(t, 1, len(bs))
+	require.Equal(t, "room@conference.jackal.im", bs[0].JID)
+
+	q = xmpp.NewElementNamespace("query", privateNamespace)
+	q.AppendElement(xmpp.NewElementNamespace("storage", bookmarksNamespace))
+	iq = xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(q)
+	x.ProcessIQ(iq, stm)
+	elem := stm.FetchElement()
+	st2 := elem.Elements().ChildNamespace("query", privateNamespace).Elements().ChildNamespace("storage", bookmarksNamespace)
+	require.NotNil(t, st2)
+	require.Equal(t, "room@conference.jackal.im", st2.Elements().Child("conference").Attributes().Get("jid"))
+}
+
 func setupTest(domain string) (*memstorage.Storage, func()) {
 	s := memstorage.New()
 	storage.Set(s)
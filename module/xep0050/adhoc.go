@@ -0,0 +1,350 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/actor"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const mailboxSize = 2048
+
+var logger = log.WithFields(log.Fields{"module": "adhoc"})
+
+const (
+	commandsNamespace = "http://jabber.org/protocol/commands"
+	dataFormNamespace = "jabber:x:data"
+)
+
+const defaultSessionTimeout = time.Minute * 10
+
+// Config represents Ad-Hoc Commands module (XEP-0050) configuration.
+type Config struct {
+	SessionTimeout time.Duration
+}
+
+type configProxy struct {
+	SessionTimeout int `yaml:"session_timeout"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.SessionTimeout < 0 {
+		return errors.New("xep0050.Config: session timeout must not be negative")
+	}
+	c.SessionTimeout = time.Second * time.Duration(p.SessionTimeout)
+	return nil
+}
+
+// AdHoc represents an ad-hoc commands server stream module.
+type AdHoc struct {
+	mu             sync.RWMutex
+	commands       []Command
+	sessions       map[string]*Session
+	sessionTimeout time.Duration
+	actorCh        chan func()
+	shutdownCh     chan chan bool
+	disco          *xep0030.DiscoInfo
+}
+
+// New returns an ad-hoc commands IQ handler module.
+func New(config *Config, disco *xep0030.DiscoInfo) (*AdHoc, chan<- chan bool) {
+	x := &AdHoc{
+		sessions:       make(map[string]*Session),
+		sessionTimeout: config.SessionTimeout,
+		actorCh:        make(chan func(), mailboxSize),
+		shutdownCh:     make(chan chan bool),
+		disco:          disco,
+	}
+	if x.sessionTimeout == 0 {
+		x.sessionTimeout = defaultSessionTimeout
+	}
+	go x.loop()
+	if disco != nil {
+		disco.RegisterServerFeature(commandsNamespace)
+		disco.RegisterNodeProvider(commandsNamespace, &nodeProvider{adHoc: x})
+	}
+	return x, x.shutdownCh
+}
+
+// RegisterCommand registers a new ad-hoc command,
+// replacing any previously registered one under the same node.
+func (x *AdHoc) RegisterCommand(cmd Command) {
+	x.mu.Lock()
+	for i, c := range x.commands {
+		if c.Node() == cmd.Node() {
+			x.commands = append(x.commands[:i], x.commands[i+1:]...)
+			break
+		}
+	}
+	x.commands = append(x.commands, cmd)
+	x.mu.Unlock()
+
+	if x.disco != nil {
+		x.disco.RegisterNodeProvider(cmd.Node(), &nodeProvider{adHoc: x})
+	}
+}
+
+// UnregisterCommand unregisters a previously registered ad-hoc command.
+func (x *AdHoc) UnregisterCommand(node string) {
+	x.mu.Lock()
+	for i, c := range x.commands {
+		if c.Node() == node {
+			x.commands = append(x.commands[:i], x.commands[i+1:]...)
+			break
+		}
+	}
+	x.mu.Unlock()
+
+	if x.disco != nil {
+		x.disco.UnregisterNodeProvider(node)
+	}
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the ad-hoc commands module.
+func (x *AdHoc) MatchesIQ(iq *xmpp.IQ) bool {
+	return iq.IsSet() && iq.Elements().ChildNamespace("command", commandsNamespace) != nil && iq.ToJID().IsServer()
+}
+
+// ProcessIQ processes an ad-hoc command IQ taking according actions
+// over the associated stream.
+func (x *AdHoc) ProcessIQ(iq *xmpp.IQ, stm stream.InOutStream) {
+	x.actorCh <- func() { x.processIQ(iq, stm) }
+}
+
+// runs on it's own goroutine
+func (x *AdHoc) loop() {
+	tc := time.NewTicker(x.sessionTimeout)
+	defer tc.Stop()
+
+	for {
+		select {
+		case f := <-x.actorCh:
+			f()
+		case <-tc.C:
+			x.expireSessions()
+		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
+			c <- true
+			return
+		}
+	}
+}
+
+func (x *AdHoc) processIQ(iq *xmpp.IQ, stm stream.InOutStream) {
+	fromJID := iq.FromJID()
+	c := iq.Elements().ChildNamespace("command", commandsNamespace)
+
+	node := c.Attributes().Get("node")
+	cmd := x.command(node)
+	if cmd == nil {
+		stm.SendElement(iq.ItemNotFoundError())
+		return
+	}
+	if !cmd.IsAllowed(fromJID) {
+		stm.SendElement(iq.ForbiddenError())
+		return
+	}
+	action := c.Attributes().Get("action")
+	if len(action) == 0 {
+		action = Execute
+	}
+	var sess *Session
+	if sessionID := c.Attributes().Get("sessionid"); len(sessionID) == 0 {
+		if action != Execute {
+			x.sendCommandError(iq, xmpp.ErrBadRequest, "malformed-action", stm)
+			return
+		}
+		sess = &Session{
+			ID:        uuid.New(),
+			Node:      node,
+			Requester: fromJID,
+			Values:    make(map[string]interface{}),
+		}
+	} else {
+		sess = x.sessions[sessionID]
+		if sess == nil || sess.Node != node || !sess.Requester.Matches(fromJID, jid.MatchesNode|jid.MatchesDomain|jid.MatchesResource) {
+			x.sendCommandError(iq, xmpp.ErrBadRequest, "bad-sessionid", stm)
+			return
+		}
+		if time.Now().After(sess.expiresAt) {
+			delete(x.sessions, sess.ID)
+			x.sendCommandError(iq, xmpp.ErrNotAllowed, "session-expired", stm)
+			return
+		}
+		switch action {
+		case Cancel:
+			delete(x.sessions, sess.ID)
+			stm.SendElement(x.resultIQ(iq, sess, &Response{Status: Canceled}))
+			return
+		case Execute:
+			action = sess.defaultAction
+		}
+		if !sess.isAllowedAction(action) {
+			x.sendCommandError(iq, xmpp.ErrBadRequest, "bad-action", stm)
+			return
+		}
+	}
+	var form *xep0004.DataForm
+	if formEl := c.Elements().ChildNamespace("x", dataFormNamespace); formEl != nil {
+		f, err := xep0004.NewFormFromElement(formEl)
+		if err != nil {
+			stm.SendElement(iq.BadRequestError())
+			return
+		}
+		form = f
+	}
+	resp, sErr := cmd.Execute(stm.Context(), sess, action, form)
+	if sErr != nil {
+		delete(x.sessions, sess.ID)
+		stm.SendElement(xmpp.NewErrorStanzaFromStanza(iq, sErr, nil))
+		return
+	}
+	if len(resp.Status) == 0 {
+		resp.Status = Completed
+	}
+	if resp.Status == Executing {
+		sess.actions = resp.Actions
+		sess.defaultAction = resp.DefaultAction
+		if len(sess.actions) == 0 {
+			sess.actions = []string{Complete}
+		}
+		if len(sess.defaultAction) == 0 {
+			sess.defaultAction = sess.actions[len(sess.actions)-1]
+		}
+		sess.expiresAt = time.Now().Add(x.sessionTimeout)
+		x.sessions[sess.ID] = sess
+	} else {
+		delete(x.sessions, sess.ID)
+	}
+	stm.SendElement(x.resultIQ(iq, sess, resp))
+}
+
+func (x *AdHoc) resultIQ(iq *xmpp.IQ, sess *Session, resp *Response) *xmpp.IQ {
+	c := xmpp.NewElementNamespace("command", commandsNamespace)
+	c.SetAttribute("node", sess.Node)
+	c.SetAttribute("sessionid", sess.ID)
+	c.SetAttribute("status", resp.Status)
+
+	if resp.Status == Executing {
+		actions := xmpp.NewElementName("actions")
+		actions.SetAttribute("execute", sess.defaultAction)
+		for _, action := range sess.actions {
+			actions.AppendElement(xmpp.NewElementName(action))
+		}
+		c.AppendElement(actions)
+	}
+	for _, note := range resp.Notes {
+		n := xmpp.NewElementName("note")
+		n.SetAttribute("type", note.Type)
+		n.SetText(note.Text)
+		c.AppendElement(n)
+	}
+	if resp.Form != nil {
+		c.AppendElement(resp.Form.Element())
+	}
+	res := iq.ResultIQ()
+	res.AppendElement(c)
+	return res
+}
+
+func (x *AdHoc) sendCommandError(iq *xmpp.IQ, sErr *xmpp.StanzaError, condition string, stm stream.InOutStream) {
+	errEl := xmpp.NewElementNamespace(condition, commandsNamespace)
+	stm.SendElement(xmpp.NewErrorStanzaFromStanza(iq, sErr, []xmpp.XElement{errEl}))
+}
+
+func (x *AdHoc) expireSessions() {
+	now := time.Now()
+	for id, sess := range x.sessions {
+		if now.After(sess.expiresAt) {
+			delete(x.sessions, id)
+		}
+	}
+}
+
+func (x *AdHoc) command(node string) Command {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	for _, c := range x.commands {
+		if c.Node() == node {
+			return c
+		}
+	}
+	return nil
+}
+
+func (x *AdHoc) allowedCommands(fromJID *jid.JID) []Command {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var ret []Command
+	for _, c := range x.commands {
+		if c.IsAllowed(fromJID) {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// nodeProvider exposes the command list through service discovery
+// 'http://jabber.org/protocol/commands' node, as well as every command node.
+type nodeProvider struct {
+	adHoc *AdHoc
+}
+
+func (np *nodeProvider) Identities(toJID, fromJID *jid.JID, node string) []xep0030.Identity {
+	if node == commandsNamespace {
+		return []xep0030.Identity{{Category: "automation", Type: "command-list"}}
+	}
+	cmd := np.adHoc.command(node)
+	if cmd == nil || !cmd.IsAllowed(fromJID) {
+		return nil
+	}
+	return []xep0030.Identity{{Category: "automation", Type: "command-node", Name: cmd.Name()}}
+}
+
+func (np *nodeProvider) Items(toJID, fromJID *jid.JID, node string) ([]xep0030.Item, *xmpp.StanzaError) {
+	if node != commandsNamespace || !toJID.IsServer() {
+		return nil, nil
+	}
+	var items []xep0030.Item
+	for _, cmd := range np.adHoc.allowedCommands(fromJID) {
+		items = append(items, xep0030.Item{Jid: toJID.String(), Node: cmd.Node(), Name: cmd.Name()})
+	}
+	return items, nil
+}
+
+func (np *nodeProvider) Features(toJID, fromJID *jid.JID, node string) ([]xep0030.Feature, *xmpp.StanzaError) {
+	if node == commandsNamespace {
+		return nil, nil
+	}
+	cmd := np.adHoc.command(node)
+	if cmd == nil {
+		return nil, xmpp.ErrItemNotFound
+	}
+	if !cmd.IsAllowed(fromJID) {
+		return nil, xmpp.ErrForbidden
+	}
+	return []xep0030.Feature{commandsNamespace, dataFormNamespace}, nil
+}
+
+func (np *nodeProvider) Form(toJID, fromJID *jid.JID, node string) (*xep0004.DataForm, *xmpp.StanzaError) {
+	return nil, nil
+}
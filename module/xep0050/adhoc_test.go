@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+type greetCommand struct{}
+
+func (c *greetCommand) Node() string { return "greet" }
+func (c *greetCommand) Name() string { return "Greet" }
+
+func (c *greetCommand) IsAllowed(fromJID *jid.JID) bool { return fromJID.Node() == "ortuman" }
+
+func (c *greetCommand) Execute(_ context.Context, sess *Session, action string, form *xep0004.DataForm) (*Response, *xmpp.StanzaError) {
+	switch sess.Stage {
+	case 0:
+		sess.Stage++
+		return &Response{
+			Status:  Executing,
+			Actions: []string{Complete},
+			Form: &xep0004.DataForm{
+				Type:   xep0004.Form,
+				Fields: []xep0004.Field{{Var: "name", Type: xep0004.TextSingle, Required: true}},
+			},
+		}, nil
+	default:
+		if form == nil || len(form.Fields) == 0 || len(form.Fields[0].Values) == 0 {
+			return nil, xmpp.ErrBadRequest
+		}
+		return &Response{Notes: []Note{{Type: InfoNote, Text: "Hi " + form.Fields[0].Values[0] + "!"}}}, nil
+	}
+}
+
+func TestXEP0050_Config(t *testing.T) {
+	var cfg Config
+	require.Nil(t, yaml.Unmarshal([]byte("session_timeout: 60"), &cfg))
+	require.Equal(t, time.Minute, cfg.SessionTimeout)
+	require.NotNil(t, yaml.Unmarshal([]byte("session_timeout: -1"), &cfg))
+}
+
+func TestXEP0050_Matching(t *testing.T) {
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	x, shutdownCh := New(&Config{}, nil)
+	defer close(shutdownCh)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	require.False(t, x.MatchesIQ(iq))
+
+	iq.AppendElement(xmpp.NewElementNamespace("command", commandsNamespace))
+	require.True(t, x.MatchesIQ(iq))
+
+	iq.SetToJID(j.ToBareJID())
+	require.False(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0050_Execute(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	x, shutdownCh := New(&Config{}, nil)
+	defer close(shutdownCh)
+
+	// unknown command
+	x.ProcessIQ(tUtilCommandIQ(j, "greet", "", "", nil), stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.RegisterCommand(&greetCommand{})
+
+	// not allowed
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+	x.ProcessIQ(tUtilCommandIQ(j2, "greet", "", "", nil), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	// first stage
+	x.ProcessIQ(tUtilCommandIQ(j, "greet", "", "", nil), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	c := elem.Elements().ChildNamespace("command", commandsNamespace)
+	require.NotNil(t, c)
+	require.Equal(t, Executing, c.Attributes().Get("status"))
+	require.Equal(t, Complete, c.Elements().Child("actions").Attributes().Get("execute"))
+	require.NotNil(t, c.Elements().ChildNamespace("x", dataFormNamespace))
+	sessionID := c.Attributes().Get("sessionid")
+	require.True(t, len(sessionID) > 0)
+
+	// bad action
+	x.ProcessIQ(tUtilCommandIQ(j, "greet", sessionID, Next, nil), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("bad-action", commandsNamespace))
+
+	// session bound to requester
+	j3, _ := jid.New("ortuman", "jackal.im", "yard", true)
+	x.ProcessIQ(tUtilCommandIQ(j3, "greet", sessionID, Complete, nil), stm)
+	elem = stm.FetchElement()
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("bad-sessionid", commandsNamespace))
+
+	// complete using default action
+	form := &xep0004.DataForm{
+		Type:   xep0004.Submit,
+		Fields: []xep0004.Field{{Var: "name", Values: []string{"Miguel"}}},
+	}
+	x.ProcessIQ(tUtilCommandIQ(j, "greet", sessionID, Execute, form), stm)
+	elem = stm.FetchElement()
+	c = elem.Elements().ChildNamespace("command", commandsNamespace)
+	require.Equal(t, Completed, c.Attributes().Get("status"))
+	require.Equal(t, "Hi Miguel!", c.Elements().Child("note").Text())
+
+	// completed session is gone
+	x.ProcessIQ(tUtilCommandIQ(j, "greet", sessionID, Complete, form), stm)
+	elem = stm.FetchElement()
+	require.NotNil(t, elem.Error().Elements().ChildNamespace("bad-sessionid", commandsNamespace))
+
+	// cancel
+	x.ProcessIQ(tUtilCommandIQ(j, "greet", "", "", nil), stm)
+	elem = stm.FetchElement()
+	sessionID = elem.Elements().ChildNamespace("command", commandsNamespace).Attributes().Get("sessionid")
+
+	x.ProcessIQ(tUtilCommandIQ(j, "greet", sessionID, Cancel, nil), stm)
+	elem = stm.FetchElement()
+	c = elem.Elements().ChildNamespace("command", commandsNamespace)
+	require.Equal(t, Canceled, c.Attributes().Get("status"))
+}
+
+func TestXEP0050_SessionExpiration(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	x, shutdownCh := New(&Config{SessionTimeout: time.Millisecond * 50}, nil)
+	defer close(shutdownCh)
+
+	x.RegisterCommand(&greetCommand{})
+
+	x.ProcessIQ(tUtilCommandIQ(j, "greet", "", "", nil), stm)
+	elem := stm.FetchElement()
+	sessionID := elem.Elements().ChildNamespace("command", commandsNamespace).Attributes().Get("sessionid")
+
+	time.Sleep(time.Millisecond * 75)
+
+	x.ProcessIQ(tUtilCommandIQ(j, "greet", sessionID, Complete, nil), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+}
+
+func TestXEP0050_DiscoItems(t *testing.T) {
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+
+	x, shutdownCh := New(&Config{}, nil)
+	defer close(shutdownCh)
+
+	x.RegisterCommand(&greetCommand{})
+
+	np := &nodeProvider{adHoc: x}
+	items, sErr := np.Items(srvJID, j, commandsNamespace)
+	require.Nil(t, sErr)
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "greet", items[0].Node)
+	require.Equal(t, "Greet", items[0].Name)
+
+	items, _ = np.Items(srvJID, j2, commandsNamespace)
+	require.Equal(t, 0, len(items))
+
+	features, sErr := np.Features(srvJID, j, "greet")
+	require.Nil(t, sErr)
+	require.Equal(t, []string{commandsNamespace, dataFormNamespace}, features)
+
+	_, sErr = np.Features(srvJID, j2, "greet")
+	require.Equal(t, xmpp.ErrForbidden, sErr)
+
+	x.UnregisterCommand("greet")
+	items, _ = np.Items(srvJID, j, commandsNamespace)
+	require.Equal(t, 0, len(items))
+}
+
+func tUtilCommandIQ(fromJID *jid.JID, node, sessionID, action string, form *xep0004.DataForm) *xmpp.IQ {
+	srvJID, _ := jid.New("", fromJID.Domain(), "", true)
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(srvJID)
+
+	c := xmpp.NewElementNamespace("command", commandsNamespace)
+	c.SetAttribute("node", node)
+	if len(sessionID) > 0 {
+		c.SetAttribute("sessionid", sessionID)
+	}
+	if len(action) > 0 {
+		c.SetAttribute("action", action)
+	}
+	if form != nil {
+		c.AppendElement(form.Element())
+	}
+	iq.AppendElement(c)
+	return iq
+}
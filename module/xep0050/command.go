@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0050
+
+import (
+	"context"
+	"time"
+
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	// Execute represents the 'execute' command action.
+	Execute = "execute"
+
+	// Next represents the 'next' command action.
+	Next = "next"
+
+	// Prev represents the 'prev' command action.
+	Prev = "prev"
+
+	// Complete represents the 'complete' command action.
+	Complete = "complete"
+
+	// Cancel represents the 'cancel' command action.
+	Cancel = "cancel"
+)
+
+const (
+	// Executing represents the status of a command awaiting further stages.
+	Executing = "executing"
+
+	// Completed represents the status of a finished command.
+	Completed = "completed"
+
+	// Canceled represents the status of a canceled command.
+	Canceled = "canceled"
+)
+
+const (
+	// InfoNote represents an informative note.
+	InfoNote = "info"
+
+	// WarnNote represents a warning note.
+	WarnNote = "warn"
+
+	// ErrorNote represents an error note.
+	ErrorNote = "error"
+)
+
+// Command represents an ad-hoc command.
+type Command interface {
+	// Node returns the disco node identifying the command.
+	Node() string
+
+	// Name returns the command human-readable name.
+	Name() string
+
+	// IsAllowed returns whether or not an entity is allowed
+	// to discover and execute the command.
+	IsAllowed(fromJID *jid.JID) bool
+
+	// Execute processes a command stage, being form nil
+	// in case the requester didn't submit any data form.
+	// A proper stanza error should be returned in case an error occurs.
+	Execute(ctx context.Context, sess *Session, action string, form *xep0004.DataForm) (*Response, *xmpp.StanzaError)
+}
+
+// Session represents a command execution session.
+// Its state is kept between stages until the command
+// gets completed, canceled or expired.
+type Session struct {
+	ID        string
+	Node      string
+	Requester *jid.JID
+
+	// Stage and Values can be freely used by commands
+	// to keep track of a multi-stage execution.
+	Stage  int
+	Values map[string]interface{}
+
+	actions       []string
+	defaultAction string
+	expiresAt     time.Time
+}
+
+// Note represents a command note.
+type Note struct {
+	Type string
+	Text string
+}
+
+// Response represents the outcome of a command stage.
+type Response struct {
+	// Status defaults to Completed if left empty.
+	Status string
+
+	// Actions contains the actions allowed in the next stage,
+	// being DefaultAction the one taken on a plain 'execute'.
+	// Only meaningful when status is Executing.
+	Actions       []string
+	DefaultAction string
+
+	Notes []Note
+	Form  *xep0004.DataForm
+}
+
+func (s *Session) isAllowedAction(action string) bool {
+	for _, a := range s.actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0054
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+const vCardUpdateNamespace = "vcard-temp:x:update"
+
+const defaultPhotoType = "image/png"
+
+// photo represents a decoded vCard avatar.
+type photo struct {
+	data     []byte
+	mimeType string
+}
+
+func (p *photo) hash() string {
+	h := sha1.Sum(p.data)
+	return hex.EncodeToString(h[:])
+}
+
+// vCardPhoto returns the avatar contained into a vCard,
+// or nil in case it doesn't contain any.
+func vCardPhoto(vCard xmpp.XElement) (*photo, error) {
+	if vCard == nil {
+		return nil, nil
+	}
+	ph := vCard.Elements().Child("PHOTO")
+	if ph == nil {
+		return nil, nil
+	}
+	binVal := ph.Elements().Child("BINVAL")
+	if binVal == nil {
+		return nil, nil
+	}
+	// BINVAL content is usually split into several lines
+	b64 := strings.Join(strings.Fields(binVal.Text()), "")
+	if len(b64) == 0 {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, err
+	}
+	p := &photo{data: data, mimeType: defaultPhotoType}
+	if typ := ph.Elements().Child("TYPE"); typ != nil && len(typ.Text()) > 0 {
+		p.mimeType = typ.Text()
+	}
+	return p, nil
+}
+
+// photoElement returns the vCard PHOTO representation of an avatar.
+func photoElement(p *photo) xmpp.XElement {
+	ph := xmpp.NewElementName("PHOTO")
+	typ := xmpp.NewElementName("TYPE")
+	typ.SetText(p.mimeType)
+	ph.AppendElement(typ)
+	binVal := xmpp.NewElementName("BINVAL")
+	binVal.SetText(base64.StdEncoding.EncodeToString(p.data))
+	ph.AppendElement(binVal)
+	return ph
+}
+
+// InjectPhotoHash replaces any vcard-temp:x:update element contained
+// into an available presence with the one matching the sender stored avatar,
+// so that contacts always get notified about its current hash.
+// Storage is accessed from the module goroutine, invoking f once done.
+func (x *VCard) InjectPhotoHash(ctx context.Context, presence *xmpp.Presence, f func()) {
+	if !presence.IsAvailable() {
+		f()
+		return
+	}
+	x.actorCh <- func() {
+		x.injectPhotoHash(ctx, presence)
+		f()
+	}
+}
+
+func (x *VCard) injectPhotoHash(ctx context.Context, presence *xmpp.Presence) {
+	hash, err := x.photoHash(ctx, presence.FromJID().Node())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	update := xmpp.NewElementNamespace("x", vCardUpdateNamespace)
+	ph := xmpp.NewElementName("photo")
+	ph.SetText(hash)
+	update.AppendElement(ph)
+
+	presence.RemoveElementsNamespace("x", vCardUpdateNamespace)
+	presence.AppendElement(update)
+}
+
+func (x *VCard) isAcceptedPhoto(p *photo) bool {
+	return p == nil || x.cfg.MaxPhotoSize == 0 || len(p.data) <= x.cfg.MaxPhotoSize
+}
+
+// photoHash returns a user avatar hash, being empty in case no avatar was set.
+// It's always computed out of the stored vCard, so that it can't get stale
+// across cluster nodes, relying on storage cache to avoid database round trips.
+func (x *VCard) photoHash(ctx context.Context, username string) (string, error) {
+	vCard, err := storage.FetchVCard(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	p, err := vCardPhoto(vCard)
+	if err != nil || p == nil {
+		return "", err
+	}
+	return p.hash(), nil
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0054
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+var testPhoto = []byte("\x89PNG\r\n\x1a\nnot really a png")
+
+func TestXEP0054_InjectPhotoHash(t *testing.T) {
+	_, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	x, shutdownCh := New(&Config{}, nil, nil)
+	defer close(shutdownCh)
+
+	// no avatar
+	p := xmpp.NewPresence(j, j.ToBareJID(), xmpp.AvailableType)
+	tUtilInjectPhotoHash(x, p)
+	update := p.Elements().ChildNamespace("x", vCardUpdateNamespace)
+	require.NotNil(t, update)
+	require.Equal(t, "", update.Elements().Child("photo").Text())
+
+	// forged hashes are replaced
+	x.ProcessIQ(tUtilVCardIQ(j, tUtilPhotoVCard(testPhoto)), stm)
+	require.Equal(t, xmpp.ResultType, stm.FetchElement().Type())
+
+	p = xmpp.NewPresence(j, j.ToBareJID(), xmpp.AvailableType)
+	forged := xmpp.NewElementNamespace("x", vCardUpdateNamespace)
+	forged.AppendElement(xmpp.NewElementName("photo").SetText("0123"))
+	p.AppendElement(forged)
+	tUtilInjectPhotoHash(x, p)
+	updates := p.Elements().ChildrenNamespace("x", vCardUpdateNamespace)
+	require.Equal(t, 1, len(updates))
+	require.Equal(t, tUtilSHA1(testPhoto), updates[0].Elements().Child("photo").Text())
+
+	// vCards updated by any other cluster node are taken into account
+	_ = storage.InsertOrUpdateVCard(context.Background(), tUtilPhotoVCard([]byte("another photo")), "ortuman")
+	p = xmpp.NewPresence(j, j.ToBareJID(), xmpp.AvailableType)
+	tUtilInjectPhotoHash(x, p)
+	update = p.Elements().ChildNamespace("x", vCardUpdateNamespace)
+	require.Equal(t, tUtilSHA1([]byte("another photo")), update.Elements().Child("photo").Text())
+
+	// unavailable presences are left untouched
+	p = xmpp.NewPresence(j, j.ToBareJID(), xmpp.UnavailableType)
+	tUtilInjectPhotoHash(x, p)
+	require.Nil(t, p.Elements().ChildNamespace("x", vCardUpdateNamespace))
+}
+
+func TestXEP0054_MaxPhotoSize(t *testing.T) {
+	_, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	x, shutdownCh := New(&Config{MaxPhotoSize: 8}, nil, nil)
+	defer close(shutdownCh)
+
+	x.ProcessIQ(tUtilVCardIQ(j, tUtilPhotoVCard(testPhoto)), stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessIQ(tUtilAvatarDataIQ(j, testPhoto), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	vCard, _ := storage.FetchVCard(context.Background(), "ortuman")
+	require.Nil(t, vCard)
+}
+
+func TestXEP0054_PEPConversion(t *testing.T) {
+	_, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	x, shutdownCh := New(&Config{}, nil, nil)
+	defer close(shutdownCh)
+
+	hash := tUtilSHA1(testPhoto)
+
+	// publish avatar through PEP
+	x.ProcessIQ(tUtilVCardIQ(j, testVCard()), stm)
+	_ = stm.FetchElement()
+
+	iq := tUtilAvatarDataIQ(j, testPhoto)
+	require.True(t, x.MatchesIQ(iq))
+	x.ProcessIQ(iq, stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	iq = tUtilPubSubIQ(j, xmpp.SetType, "publish", avatarMetadataNamespace, hash, avatarMetadata(&photo{data: testPhoto, mimeType: "image/jpeg"}))
+	x.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	vCard, _ := storage.FetchVCard(context.Background(), "ortuman")
+	require.Equal(t, "Forrest Gump", vCard.Elements().Child("FN").Text())
+	p, _ := vCardPhoto(vCard)
+	require.NotNil(t, p)
+	require.Equal(t, testPhoto, p.data)
+	require.Equal(t, "image/jpeg", p.mimeType)
+
+	// retrieve vCard avatar through PEP
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+	iq = tUtilPubSubIQ(j2, xmpp.GetType, "items", avatarMetadataNamespace, "", nil)
+	iq.SetToJID(j.ToBareJID())
+	x.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	items := elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("items")
+	item := items.Elements().Child("item")
+	require.Equal(t, hash, item.Attributes().Get("id"))
+	info := item.Elements().ChildNamespace("metadata", avatarMetadataNamespace).Elements().Child("info")
+	require.Equal(t, "image/jpeg", info.Attributes().Get("type"))
+
+	iq = tUtilPubSubIQ(j2, xmpp.GetType, "items", avatarDataNamespace, "", nil)
+	iq.SetToJID(j.ToBareJID())
+	x.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	items = elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("items")
+	data := items.Elements().Child("item").Elements().ChildNamespace("data", avatarDataNamespace)
+	require.Equal(t, base64.StdEncoding.EncodeToString(testPhoto), data.Text())
+
+	// only owner is allowed to publish
+	iq = tUtilAvatarDataIQ(j2, testPhoto)
+	iq.SetToJID(j.ToBareJID())
+	x.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	// disable avatar
+	x.ProcessIQ(tUtilPubSubIQ(j, xmpp.SetType, "publish", avatarMetadataNamespace, "current", xmpp.NewElementNamespace("metadata", avatarMetadataNamespace)), stm)
+	_ = stm.FetchElement()
+
+	vCard, _ = storage.FetchVCard(context.Background(), "ortuman")
+	require.Nil(t, vCard.Elements().Child("PHOTO"))
+	require.NotNil(t, vCard.Elements().Child("FN"))
+
+	hashValue, _ := x.photoHash(context.Background(), "ortuman")
+	require.Equal(t, "", hashValue)
+}
+
+func tUtilInjectPhotoHash(x *VCard, p *xmpp.Presence) {
+	doneCh := make(chan struct{})
+	x.InjectPhotoHash(context.Background(), p, func() { close(doneCh) })
+	<-doneCh
+}
+
+func tUtilSHA1(b []byte) string {
+	h := sha1.Sum(b)
+	return hex.EncodeToString(h[:])
+}
+
+func tUtilPhotoVCard(data []byte) xmpp.XElement {
+	vCard := xmpp.NewElementNamespace("vCard", vCardNamespace)
+	vCard.AppendElement(photoElement(&photo{data: data, mimeType: "image/png"}))
+	return vCard
+}
+
+func tUtilVCardIQ(j *jid.JID, vCard xmpp.XElement) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(vCard)
+	return iq
+}
+
+func tUtilAvatarDataIQ(j *jid.JID, b []byte) *xmpp.IQ {
+	data := xmpp.NewElementNamespace("data", avatarDataNamespace)
+	data.SetText(base64.StdEncoding.EncodeToString(b))
+	return tUtilPubSubIQ(j, xmpp.SetType, "publish", avatarDataNamespace, tUtilSHA1(b), data)
+}
+
+func tUtilPubSubIQ(j *jid.JID, typ, action, node, itemID string, payload xmpp.XElement) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), typ)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+
+	elem := xmpp.NewElementName(action)
+	elem.SetAttribute("node", node)
+	if payload != nil {
+		item := xmpp.NewElementName("item")
+		item.SetAttribute("id", itemID)
+		item.AppendElement(payload)
+		elem.AppendElement(item)
+	}
+	pubSub := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	pubSub.AppendElement(elem)
+	iq.AppendElement(pubSub)
+	return iq
+}
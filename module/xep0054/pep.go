@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0054
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	pubSubNamespace             = "http://jabber.org/protocol/pubsub"
+	avatarDataNamespace         = "urn:xmpp:avatar:data"
+	avatarMetadataNamespace     = "urn:xmpp:avatar:metadata"
+	pepVCardConversionNamespace = "urn:xmpp:pep-vcard-conversion:0"
+)
+
+// isAvatarIQ returns whether or not an IQ targets any of the
+// XEP-0084 avatar nodes, which are backed by the user vCard (XEP-0398).
+func isAvatarIQ(iq *xmpp.IQ) bool {
+	pubSub := iq.Elements().ChildNamespace("pubsub", pubSubNamespace)
+	if pubSub == nil {
+		return false
+	}
+	var elem xmpp.XElement
+	if iq.IsGet() {
+		elem = pubSub.Elements().Child("items")
+	} else {
+		elem = pubSub.Elements().Child("publish")
+	}
+	if elem == nil {
+		return false
+	}
+	switch elem.Attributes().Get("node") {
+	case avatarDataNamespace, avatarMetadataNamespace:
+		return true
+	}
+	return false
+}
+
+func (x *VCard) processAvatarIQ(pubSub xmpp.XElement, iq *xmpp.IQ, stm stream.InOutStream) {
+	if iq.IsGet() {
+		x.getAvatarItems(pubSub.Elements().Child("items"), iq, stm)
+		return
+	}
+	fromJID := iq.FromJID()
+	toJID := iq.ToJID()
+	// only account owner is allowed to publish its avatar
+	if !(toJID.IsServer() && toJID.Domain() == fromJID.Domain()) && !toJID.Matches(fromJID, jid.MatchesBare) {
+		stm.SendElement(iq.ForbiddenError())
+		return
+	}
+	publish := pubSub.Elements().Child("publish")
+	item := publish.Elements().Child("item")
+	if item == nil {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	switch publish.Attributes().Get("node") {
+	case avatarDataNamespace:
+		x.publishAvatarData(item, iq, stm)
+	default:
+		x.publishAvatarMetadata(item, iq, stm)
+	}
+}
+
+func (x *VCard) getAvatarItems(items xmpp.XElement, iq *xmpp.IQ, stm stream.InOutStream) {
+	node := items.Attributes().Get("node")
+	vCard, err := storage.FetchVCard(stm.Context(), iq.ToJID().Node())
+	if err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	p, err := vCardPhoto(vCard)
+	if err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	resItems := xmpp.NewElementName("items")
+	resItems.SetAttribute("node", node)
+	if p != nil {
+		item := xmpp.NewElementName("item")
+		item.SetAttribute("id", p.hash())
+		if node == avatarDataNamespace {
+			data := xmpp.NewElementNamespace("data", avatarDataNamespace)
+			data.SetText(base64.StdEncoding.EncodeToString(p.data))
+			item.AppendElement(data)
+		} else {
+			item.AppendElement(avatarMetadata(p))
+		}
+		resItems.AppendElement(item)
+	}
+	resPubSub := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	resPubSub.AppendElement(resItems)
+
+	result := iq.ResultIQ()
+	result.AppendElement(resPubSub)
+	stm.SendElement(result)
+}
+
+// publishAvatarData stores a published avatar into its owner vCard,
+// keeping current photo type until metadata gets published.
+func (x *VCard) publishAvatarData(item xmpp.XElement, iq *xmpp.IQ, stm stream.InOutStream) {
+	dataElem := item.Elements().ChildNamespace("data", avatarDataNamespace)
+	if dataElem == nil {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(dataElem.Text()), ""))
+	if err != nil {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	p := &photo{data: data, mimeType: defaultPhotoType}
+	if id := item.Attributes().Get("id"); len(id) > 0 && id != p.hash() {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	if !x.isAcceptedPhoto(p) {
+		stm.SendElement(iq.NotAcceptableError())
+		return
+	}
+	username := iq.FromJID().Node()
+	vCard, err := storage.FetchVCard(stm.Context(), username)
+	if err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	if current, _ := vCardPhoto(vCard); current != nil {
+		p.mimeType = current.mimeType
+	}
+	if err := x.storePhoto(stm, username, vCard, p); err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	stm.SendElement(publishResult(iq, avatarDataNamespace, p.hash()))
+}
+
+// publishAvatarMetadata updates the photo type of its owner vCard,
+// removing the photo in case avatar publishing has been disabled.
+func (x *VCard) publishAvatarMetadata(item xmpp.XElement, iq *xmpp.IQ, stm stream.InOutStream) {
+	metadata := item.Elements().ChildNamespace("metadata", avatarMetadataNamespace)
+	if metadata == nil {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	username := iq.FromJID().Node()
+	vCard, err := storage.FetchVCard(stm.Context(), username)
+	if err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	p, err := vCardPhoto(vCard)
+	if err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	infos := metadata.Elements().Children("info")
+	if len(infos) == 0 {
+		p = nil
+	} else if p != nil {
+		hash := p.hash()
+		for _, info := range infos {
+			typ := info.Attributes().Get("type")
+			if info.Attributes().Get("id") == hash && len(typ) > 0 && len(info.Attributes().Get("url")) == 0 {
+				p.mimeType = typ
+				break
+			}
+		}
+	}
+	if err := x.storePhoto(stm, username, vCard, p); err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	stm.SendElement(publishResult(iq, avatarMetadataNamespace, item.Attributes().Get("id")))
+}
+
+// storePhoto replaces a user vCard photo, creating the vCard if needed.
+// A nil p value removes the current photo.
+func (x *VCard) storePhoto(stm stream.InOutStream, username string, vCard xmpp.XElement, p *photo) error {
+	newVCard := xmpp.NewElementNamespace("vCard", vCardNamespace)
+	if vCard != nil {
+		newVCard = xmpp.NewElementFromElement(vCard)
+		newVCard.RemoveElements("PHOTO")
+	}
+	if p != nil {
+		newVCard.AppendElement(photoElement(p))
+	}
+	return storage.InsertOrUpdateVCard(stm.Context(), newVCard, username)
+}
+
+func avatarMetadata(p *photo) xmpp.XElement {
+	info := xmpp.NewElementName("info")
+	info.SetAttribute("bytes", strconv.Itoa(len(p.data)))
+	info.SetAttribute("id", p.hash())
+	info.SetAttribute("type", p.mimeType)
+
+	metadata := xmpp.NewElementNamespace("metadata", avatarMetadataNamespace)
+	metadata.AppendElement(info)
+	return metadata
+}
+
+func publishResult(iq *xmpp.IQ, node, itemID string) xmpp.XElement {
+	item := xmpp.NewElementName("item")
+	if len(itemID) > 0 {
+		item.SetAttribute("id", itemID)
+	}
+	publish := xmpp.NewElementName("publish")
+	publish.SetAttribute("node", node)
+	publish.AppendElement(item)
+
+	pubSub := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	pubSub.AppendElement(publish)
+
+	result := iq.ResultIQ()
+	result.AppendElement(pubSub)
+	return result
+}
@@ -6,26 +6,62 @@
 package xep0054
 
 import (
+	"errors"
+
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/actor"
 	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/module/xep0055"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
 )
 
 const mailboxSize = 2048
 
+var logger = log.WithFields(log.Fields{"module": "vcard"})
+
 const vCardNamespace = "vcard-temp"
 
+// Config represents vCard module (XEP-0054) configuration.
+type Config struct {
+	// MaxPhotoSize is the largest accepted avatar size in bytes.
+	// Zero value means no limit.
+	MaxPhotoSize int
+}
+
+type configProxy struct {
+	MaxPhotoSize int `yaml:"max_photo_size"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.MaxPhotoSize < 0 {
+		return errors.New("xep0054.Config: max photo size must not be negative")
+	}
+	c.MaxPhotoSize = p.MaxPhotoSize
+	return nil
+}
+
 // VCard represents a vCard server stream module.
 type VCard struct {
+	cfg        *Config
+	search     *xep0055.Search
 	actorCh    chan func()
 	shutdownCh chan chan bool
 }
 
 // New returns a vCard IQ handler module.
-func New(disco *xep0030.DiscoInfo) (*VCard, chan<- chan bool) {
+// Stored vCards will be indexed into the user directory in case search is not nil.
+func New(config *Config, disco *xep0030.DiscoInfo, search *xep0055.Search) (*VCard, chan<- chan bool) {
 	v := &VCard{
+		cfg:        config,
+		search:     search,
 		actorCh:    make(chan func(), mailboxSize),
 		shutdownCh: make(chan chan bool),
 	}
@@ -33,6 +69,7 @@ func New(disco *xep0030.DiscoInfo) (*VCard, chan<- chan bool) {
 	if disco != nil {
 		disco.RegisterServerFeature(vCardNamespace)
 		disco.RegisterAccountFeature(vCardNamespace)
+		disco.RegisterAccountFeature(pepVCardConversionNamespace)
 	}
 	return v, v.shutdownCh
 }
@@ -40,12 +77,15 @@ func New(disco *xep0030.DiscoInfo) (*VCard, chan<- chan bool) {
 // MatchesIQ returns whether or not an IQ should be
 // processed by the vCard module.
 func (x *VCard) MatchesIQ(iq *xmpp.IQ) bool {
-	return (iq.IsGet() || iq.IsSet()) && iq.Elements().ChildNamespace("vCard", vCardNamespace) != nil
+	if !iq.IsGet() && !iq.IsSet() {
+		return false
+	}
+	return iq.Elements().ChildNamespace("vCard", vCardNamespace) != nil || isAvatarIQ(iq)
 }
 
 // ProcessIQ processes a vCard IQ taking according actions
 // over the associated stream.
-func (x *VCard) ProcessIQ(iq *xmpp.IQ, stm stream.C2S) {
+func (x *VCard) ProcessIQ(iq *xmpp.IQ, stm stream.InOutStream) {
 	x.actorCh <- func() { x.processIQ(iq, stm) }
 }
 
@@ -56,13 +96,18 @@ func (x *VCard) loop() {
 		case f := <-x.actorCh:
 			f()
 		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
 			c <- true
 			return
 		}
 	}
 }
 
-func (x *VCard) processIQ(iq *xmpp.IQ, stm stream.C2S) {
+func (x *VCard) processIQ(iq *xmpp.IQ, stm stream.InOutStream) {
+	if pubSub := iq.Elements().ChildNamespace("pubsub", pubSubNamespace); pubSub != nil {
+		x.processAvatarIQ(pubSub, iq, stm)
+		return
+	}
 	vCard := iq.Elements().ChildNamespace("vCard", vCardNamespace)
 	if vCard != nil {
 		if iq.IsGet() {
@@ -76,19 +121,19 @@ func (x *VCard) processIQ(iq *xmpp.IQ, stm stream.C2S) {
 	stm.SendElement(iq.BadRequestError())
 }
 
-func (x *VCard) getVCard(vCard xmpp.XElement, iq *xmpp.IQ, stm stream.C2S) {
+func (x *VCard) getVCard(vCard xmpp.XElement, iq *xmpp.IQ, stm stream.InOutStream) {
 	if vCard.Elements().Count() > 0 {
 		stm.SendElement(iq.BadRequestError())
 		return
 	}
 	toJID := iq.ToJID()
-	resElem, err := storage.FetchVCard(toJID.Node())
+	resElem, err := storage.FetchVCard(stm.Context(), toJID.Node())
 	if err != nil {
-		log.Errorf("%v", err)
+		logger.Errorf("%v", err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
-	log.Infof("retrieving vcard... (%s/%s)", toJID.Node(), toJID.Resource())
+	logger.Infof("retrieving vcard... (%s/%s)", toJID.Node(), toJID.Resource())
 
 	resultIQ := iq.ResultIQ()
 	if resElem != nil {
@@ -100,18 +145,34 @@ func (x *VCard) getVCard(vCard xmpp.XElement, iq *xmpp.IQ, stm stream.C2S) {
 	stm.SendElement(resultIQ)
 }
 
-func (x *VCard) setVCard(vCard xmpp.XElement, iq *xmpp.IQ, stm stream.C2S) {
+func (x *VCard) setVCard(vCard xmpp.XElement, iq *xmpp.IQ, stm stream.InOutStream) {
+	fromJID := iq.FromJID()
 	toJID := iq.ToJID()
-	if toJID.IsServer() || (toJID.Node() == stm.Username()) {
-		log.Infof("saving vcard... (%s/%s)", toJID.Node(), toJID.Resource())
+	// only local entities are allowed to update a vCard
+	if (toJID.IsServer() && toJID.Domain() == fromJID.Domain()) || toJID.Matches(fromJID, jid.MatchesBare) {
+		logger.Infof("saving vcard... (%s/%s)", toJID.Node(), toJID.Resource())
 
-		err := storage.InsertOrUpdateVCard(vCard, toJID.Node())
+		p, err := vCardPhoto(vCard)
 		if err != nil {
-			log.Error(err)
+			stm.SendElement(iq.BadRequestError())
+			return
+		}
+		if !x.isAcceptedPhoto(p) {
+			stm.SendElement(iq.NotAcceptableError())
+			return
+		}
+		err = storage.InsertOrUpdateVCard(stm.Context(), vCard, toJID.Node())
+		if err != nil {
+			logger.Error(err)
 			stm.SendElement(iq.InternalServerError())
 			return
 
 		}
+		if x.search != nil && len(toJID.Node()) > 0 {
+			if err := x.search.IndexVCard(stm.Context(), toJID.Node(), vCard); err != nil {
+				logger.Error(err)
+			}
+		}
 		stm.SendElement(iq.ResultIQ())
 	} else {
 		stm.SendElement(iq.ForbiddenError())
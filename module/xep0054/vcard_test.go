@@ -6,9 +6,11 @@
 package xep0054
 
 import (
+	"context"
 	"crypto/tls"
 	"testing"
 
+	"github.com/ortuman/jackal/module/xep0055"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/storage/memstorage"
@@ -22,7 +24,7 @@ import (
 func TestXEP0054_Matching(t *testing.T) {
 	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
 
-	x, shutdownCh := New(nil)
+	x, shutdownCh := New(&Config{}, nil, nil)
 	defer close(shutdownCh)
 
 	// test MatchesIQ
@@ -58,7 +60,7 @@ func TestXEP0054_Set(t *testing.T) {
 	iq.SetToJID(j.ToBareJID())
 	iq.AppendElement(testVCard())
 
-	x, shutdownCh := New(nil)
+	x, shutdownCh := New(&Config{}, nil, nil)
 	defer close(shutdownCh)
 
 	x.ProcessIQ(iq, stm)
@@ -81,6 +83,35 @@ func TestXEP0054_Set(t *testing.T) {
 	require.Equal(t, iq2ID, elem.ID())
 }
 
+func TestXEP0054_SetIndexesDirectory(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	search, searchShutdownCh := xep0055.New(&xep0055.Config{}, nil, nil, r)
+	defer close(searchShutdownCh)
+
+	x, shutdownCh := New(&Config{}, nil, search)
+	defer close(shutdownCh)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(testVCard())
+
+	x.ProcessIQ(iq, stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	entry, _ := storage.FetchDirectoryEntry(context.Background(), "ortuman")
+	require.NotNil(t, entry)
+	require.Equal(t, "Forrest Gump", entry.FN)
+}
+
 func TestXEP0054_SetError(t *testing.T) {
 	_, s, shutdown := setupTest("jackal.im")
 	defer shutdown()
@@ -91,7 +122,7 @@ func TestXEP0054_SetError(t *testing.T) {
 	stm := stream.NewMockC2S("abcd", j)
 	defer stm.Disconnect(nil)
 
-	x, shutdownCh := New(nil)
+	x, shutdownCh := New(&Config{}, nil, nil)
 	defer close(shutdownCh)
 
 	// set other user vCard...
@@ -133,7 +164,7 @@ func TestXEP0054_Get(t *testing.T) {
 	iqSet.SetToJID(j.ToBareJID())
 	iqSet.AppendElement(testVCard())
 
-	x, shutdownCh := New(nil)
+	x, shutdownCh := New(&Config{}, nil, nil)
 	defer close(shutdownCh)
 
 	x.ProcessIQ(iqSet, stm)
@@ -180,7 +211,7 @@ func TestXEP0054_GetError(t *testing.T) {
 	iqSet.SetToJID(j.ToBareJID())
 	iqSet.AppendElement(testVCard())
 
-	x, shutdownCh := New(nil)
+	x, shutdownCh := New(&Config{}, nil, nil)
 	defer close(shutdownCh)
 
 	x.ProcessIQ(iqSet, stm)
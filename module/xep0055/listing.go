@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0055
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const listingNode = searchNamespace + "#listing"
+
+// listingCommand lets local users choose whether or not
+// they should be found when directory visibility is opt-in.
+type listingCommand struct {
+	x *Search
+}
+
+func (c *listingCommand) Node() string { return listingNode }
+func (c *listingCommand) Name() string { return "Directory Listing" }
+
+func (c *listingCommand) IsAllowed(fromJID *jid.JID) bool {
+	return len(fromJID.Node()) > 0 && c.x.router.IsLocalHost(fromJID.Domain())
+}
+
+func (c *listingCommand) Execute(ctx context.Context, sess *xep0050.Session, action string, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	username := sess.Requester.Node()
+	entry, err := storage.FetchDirectoryEntry(ctx, username)
+	if err != nil {
+		logger.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	if entry == nil {
+		entry = &model.DirectoryEntry{Username: username}
+	}
+	if sess.Stage == 0 {
+		sess.Stage++
+		return &xep0050.Response{
+			Status:  xep0050.Executing,
+			Actions: []string{xep0050.Complete},
+			Form: &xep0004.DataForm{
+				Type:  xep0004.Form,
+				Title: c.Name(),
+				Fields: []xep0004.Field{
+					formTypeField(),
+					{Var: "listed", Type: xep0004.Boolean, Label: "List me in the user directory", Values: []string{strconv.FormatBool(entry.Listed)}},
+				},
+			},
+		}, nil
+	}
+	if form == nil || form.Type != xep0004.Submit {
+		return nil, xmpp.ErrBadRequest
+	}
+	listed, err := strconv.ParseBool(fieldValue(form, "listed"))
+	if err != nil {
+		return nil, xmpp.ErrBadRequest
+	}
+	entry.Listed = listed
+	if err := storage.InsertOrUpdateDirectoryEntry(ctx, entry); err != nil {
+		logger.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	return &xep0050.Response{
+		Notes: []xep0050.Note{{Type: xep0050.InfoNote, Text: "Directory listing preference has been updated."}},
+	}, nil
+}
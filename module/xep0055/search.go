@@ -0,0 +1,309 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0055
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/actor"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+const mailboxSize = 2048
+
+var logger = log.WithFields(log.Fields{"module": "search"})
+
+const (
+	searchNamespace   = "jabber:iq:search"
+	dataFormNamespace = "jabber:x:data"
+	rsmNamespace      = "http://jabber.org/protocol/rsm"
+)
+
+const (
+	// AllVisibility makes every indexed user searchable.
+	AllVisibility = "all"
+
+	// OptInVisibility restricts search results to users
+	// that explicitly opted in to be listed.
+	OptInVisibility = "opt_in"
+)
+
+const defaultMaxResults = 50
+
+const searchInstructions = "Fill in one or more fields to search for any matching users."
+
+// Config represents Jabber Search module (XEP-0055) configuration.
+type Config struct {
+	Visibility string
+	MaxResults int
+}
+
+type configProxy struct {
+	Visibility string `yaml:"visibility"`
+	MaxResults int    `yaml:"max_results"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	switch p.Visibility {
+	case "":
+		c.Visibility = AllVisibility
+	case AllVisibility, OptInVisibility:
+		c.Visibility = p.Visibility
+	default:
+		return fmt.Errorf("xep0055.Config: unrecognized visibility: %s", p.Visibility)
+	}
+	if p.MaxResults < 0 {
+		return errors.New("xep0055.Config: max results must not be negative")
+	}
+	c.MaxResults = p.MaxResults
+	return nil
+}
+
+// Search represents a user directory search server stream module.
+type Search struct {
+	cfg        *Config
+	router     *router.Router
+	actorCh    chan func()
+	shutdownCh chan chan bool
+}
+
+// New returns a user directory search IQ handler module.
+// In case directory visibility is restricted to opt-in users, a listing
+// command will be registered into the ad-hoc commands module, if available.
+func New(config *Config, disco *xep0030.DiscoInfo, adHoc *xep0050.AdHoc, router *router.Router) (*Search, chan<- chan bool) {
+	x := &Search{
+		cfg:        config,
+		router:     router,
+		actorCh:    make(chan func(), mailboxSize),
+		shutdownCh: make(chan chan bool),
+	}
+	go x.loop()
+	if disco != nil {
+		disco.RegisterServerFeature(searchNamespace)
+	}
+	if adHoc != nil && x.cfg.Visibility == OptInVisibility {
+		adHoc.RegisterCommand(&listingCommand{x: x})
+	}
+	return x, x.shutdownCh
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the search module.
+func (x *Search) MatchesIQ(iq *xmpp.IQ) bool {
+	return (iq.IsGet() || iq.IsSet()) && iq.Elements().ChildNamespace("query", searchNamespace) != nil && iq.ToJID().IsServer()
+}
+
+// ProcessIQ processes a search IQ taking according actions
+// over the associated stream.
+func (x *Search) ProcessIQ(iq *xmpp.IQ, stm stream.InOutStream) {
+	x.actorCh <- func() { x.processIQ(iq, stm) }
+}
+
+// IndexVCard updates the directory entry of a user from its vCard searchable fields,
+// keeping any previously set listing preference.
+func (x *Search) IndexVCard(ctx context.Context, username string, vCard xmpp.XElement) error {
+	entry, err := storage.FetchDirectoryEntry(ctx, username)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		entry = &model.DirectoryEntry{Username: username}
+	}
+	entry.FN = childText(vCard, "FN")
+	entry.Nickname = childText(vCard, "NICKNAME")
+	entry.Email = ""
+	if email := vCard.Elements().Child("EMAIL"); email != nil {
+		entry.Email = childText(email, "USERID")
+	}
+	entry.Org = ""
+	if org := vCard.Elements().Child("ORG"); org != nil {
+		entry.Org = childText(org, "ORGNAME")
+	}
+	return storage.InsertOrUpdateDirectoryEntry(ctx, entry)
+}
+
+// runs on it's own goroutine
+func (x *Search) loop() {
+	for {
+		select {
+		case f := <-x.actorCh:
+			f()
+		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
+			c <- true
+			return
+		}
+	}
+}
+
+func (x *Search) processIQ(iq *xmpp.IQ, stm stream.InOutStream) {
+	// directory is only available to local users
+	if !x.router.IsLocalHost(iq.FromJID().Domain()) {
+		stm.SendElement(iq.ForbiddenError())
+		return
+	}
+	q := iq.Elements().ChildNamespace("query", searchNamespace)
+	if iq.IsGet() {
+		x.sendSearchForm(iq, stm)
+		return
+	}
+	x.search(q, iq, stm)
+}
+
+func (x *Search) sendSearchForm(iq *xmpp.IQ, stm stream.InOutStream) {
+	form := &xep0004.DataForm{
+		Type:         xep0004.Form,
+		Title:        "User Directory Search",
+		Instructions: searchInstructions,
+		Fields: []xep0004.Field{
+			formTypeField(),
+			{Var: "fn", Type: xep0004.TextSingle, Label: "Full Name"},
+			{Var: "nick", Type: xep0004.TextSingle, Label: "Nickname"},
+			{Var: "email", Type: xep0004.TextSingle, Label: "Email"},
+			{Var: "org", Type: xep0004.TextSingle, Label: "Organization"},
+		},
+	}
+	query := xmpp.NewElementNamespace("query", searchNamespace)
+	instructions := xmpp.NewElementName("instructions")
+	instructions.SetText(searchInstructions)
+	query.AppendElement(instructions)
+	query.AppendElement(form.Element())
+
+	result := iq.ResultIQ()
+	result.AppendElement(query)
+	stm.SendElement(result)
+}
+
+func (x *Search) search(q xmpp.XElement, iq *xmpp.IQ, stm stream.InOutStream) {
+	formElem := q.Elements().ChildNamespace("x", dataFormNamespace)
+	if formElem == nil {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	form, err := xep0004.NewFormFromElement(formElem)
+	if err != nil || form.Type != xep0004.Submit {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	dq := &model.DirectoryQuery{
+		FN:         fieldValue(form, "fn"),
+		Nickname:   fieldValue(form, "nick"),
+		Email:      fieldValue(form, "email"),
+		Org:        fieldValue(form, "org"),
+		ListedOnly: x.cfg.Visibility == OptInVisibility,
+	}
+	if len(dq.FN) == 0 && len(dq.Nickname) == 0 && len(dq.Email) == 0 && len(dq.Org) == 0 {
+		stm.SendElement(iq.NotAcceptableError())
+		return
+	}
+	limit := x.maxResults()
+	var after string
+	if set := q.Elements().ChildNamespace("set", rsmNamespace); set != nil {
+		if max := set.Elements().Child("max"); max != nil {
+			n, err := strconv.Atoi(max.Text())
+			if err != nil || n < 0 {
+				stm.SendElement(iq.BadRequestError())
+				return
+			}
+			if n < limit {
+				limit = n
+			}
+		}
+		if a := set.Elements().Child("after"); a != nil {
+			after = a.Text()
+		}
+	}
+	entries, err := storage.SearchDirectoryEntries(stm.Context(), dq, after, limit)
+	if err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	logger.Infof("searched user directory: %d results (%s)", len(entries), iq.FromJID().String())
+
+	query := xmpp.NewElementNamespace("query", searchNamespace)
+	query.AppendElement(x.resultForm(entries, iq.ToJID().Domain()).Element())
+	if len(entries) > 0 {
+		set := xmpp.NewElementNamespace("set", rsmNamespace)
+		first := xmpp.NewElementName("first")
+		first.SetText(entries[0].Username)
+		set.AppendElement(first)
+		last := xmpp.NewElementName("last")
+		last.SetText(entries[len(entries)-1].Username)
+		set.AppendElement(last)
+		query.AppendElement(set)
+	}
+	result := iq.ResultIQ()
+	result.AppendElement(query)
+	stm.SendElement(result)
+}
+
+func (x *Search) resultForm(entries []model.DirectoryEntry, domain string) *xep0004.DataForm {
+	form := &xep0004.DataForm{
+		Type:   xep0004.Result,
+		Fields: []xep0004.Field{formTypeField()},
+		Reported: []xep0004.Field{
+			{Var: "jid", Type: xep0004.JidSingle, Label: "JID"},
+			{Var: "fn", Type: xep0004.TextSingle, Label: "Full Name"},
+			{Var: "nick", Type: xep0004.TextSingle, Label: "Nickname"},
+			{Var: "email", Type: xep0004.TextSingle, Label: "Email"},
+			{Var: "org", Type: xep0004.TextSingle, Label: "Organization"},
+		},
+	}
+	for _, entry := range entries {
+		form.Items = append(form.Items, []xep0004.Field{
+			{Var: "jid", Values: []string{entry.Username + "@" + domain}},
+			{Var: "fn", Values: []string{entry.FN}},
+			{Var: "nick", Values: []string{entry.Nickname}},
+			{Var: "email", Values: []string{entry.Email}},
+			{Var: "org", Values: []string{entry.Org}},
+		})
+	}
+	return form
+}
+
+func (x *Search) maxResults() int {
+	if x.cfg.MaxResults > 0 {
+		return x.cfg.MaxResults
+	}
+	return defaultMaxResults
+}
+
+func childText(elem xmpp.XElement, name string) string {
+	if child := elem.Elements().Child(name); child != nil {
+		return child.Text()
+	}
+	return ""
+}
+
+func formTypeField() xep0004.Field {
+	return xep0004.Field{Var: "FORM_TYPE", Type: xep0004.Hidden, Values: []string{searchNamespace}}
+}
+
+func fieldValue(form *xep0004.DataForm, fieldVar string) string {
+	for _, f := range form.Fields {
+		if f.Var == fieldVar && len(f.Values) > 0 {
+			return f.Values[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,293 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0055
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestXEP0055_Config(t *testing.T) {
+	var cfg Config
+	require.Nil(t, yaml.Unmarshal([]byte("max_results: 10"), &cfg))
+	require.Equal(t, AllVisibility, cfg.Visibility)
+	require.Equal(t, 10, cfg.MaxResults)
+
+	require.Nil(t, yaml.Unmarshal([]byte("visibility: opt_in"), &cfg))
+	require.Equal(t, OptInVisibility, cfg.Visibility)
+
+	require.NotNil(t, yaml.Unmarshal([]byte("visibility: nobody"), &cfg))
+	require.NotNil(t, yaml.Unmarshal([]byte("max_results: -1"), &cfg))
+}
+
+func TestXEP0055_Matching(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	x, shutdownCh := New(&Config{}, nil, nil, r)
+	defer close(shutdownCh)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+	iq.AppendElement(xmpp.NewElementNamespace("query", searchNamespace))
+	require.False(t, x.MatchesIQ(iq))
+
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	iq.SetToJID(srvJID)
+	require.True(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0055_IndexVCard(t *testing.T) {
+	r, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	x, shutdownCh := New(&Config{}, nil, nil, r)
+	defer close(shutdownCh)
+
+	s.InsertOrUpdateDirectoryEntry(context.Background(), &model.DirectoryEntry{Username: "ortuman", Listed: true})
+
+	require.Nil(t, x.IndexVCard(context.Background(), "ortuman", tUtilVCard("Miguel Ángel", "ortuman", "ortuman@jackal.im", "jackal")))
+
+	entry, _ := s.FetchDirectoryEntry(context.Background(), "ortuman")
+	require.Equal(t, &model.DirectoryEntry{
+		Username: "ortuman",
+		FN:       "Miguel Ángel",
+		Nickname: "ortuman",
+		Email:    "ortuman@jackal.im",
+		Org:      "jackal",
+		Listed:   true,
+	}, entry)
+
+	s.EnableMockedError()
+	require.Equal(t, memstorage.ErrMockedError, x.IndexVCard(context.Background(), "ortuman", tUtilVCard("", "", "", "")))
+	s.DisableMockedError()
+}
+
+func TestXEP0055_SearchForm(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	x, shutdownCh := New(&Config{}, nil, nil, r)
+	defer close(shutdownCh)
+
+	x.ProcessIQ(tUtilSearchIQ(j, xmpp.GetType, nil, nil), stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	q := elem.Elements().ChildNamespace("query", searchNamespace)
+	require.NotNil(t, q.Elements().Child("instructions"))
+
+	form, err := xep0004.NewFormFromElement(q.Elements().ChildNamespace("x", dataFormNamespace))
+	require.Nil(t, err)
+	require.Equal(t, xep0004.Form, form.Type)
+	require.Equal(t, 5, len(form.Fields))
+
+	// remote users can't access directory
+	j2, _ := jid.New("romeo", "jabber.org", "garden", true)
+	x.ProcessIQ(tUtilSearchIQ(j2, xmpp.GetType, nil, nil), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestXEP0055_Search(t *testing.T) {
+	r, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	x, shutdownCh := New(&Config{MaxResults: 2}, nil, nil, r)
+	defer close(shutdownCh)
+
+	for _, username := range []string{"noelia", "ortuman", "romeo"} {
+		s.InsertOrUpdateDirectoryEntry(context.Background(), &model.DirectoryEntry{Username: username, FN: username, Org: "Jackal"})
+	}
+	s.InsertOrUpdateDirectoryEntry(context.Background(), &model.DirectoryEntry{Username: "juliet", Org: "Capulet"})
+
+	// empty query
+	x.ProcessIQ(tUtilSearchIQ(j, xmpp.SetType, []xep0004.Field{{Var: "org"}}, nil), stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ErrNotAcceptable.Error(), elem.Error().Elements().All()[0].Name())
+
+	// first page limited by max results
+	x.ProcessIQ(tUtilSearchIQ(j, xmpp.SetType, []xep0004.Field{{Var: "org", Values: []string{"jackal"}}}, nil), stm)
+	form, set := tUtilSearchResult(t, stm.FetchElement())
+	require.Equal(t, 2, len(form.Items))
+	require.Equal(t, []string{"noelia@jackal.im"}, form.Items[0][0].Values)
+	require.Equal(t, "noelia", set.Elements().Child("first").Text())
+	require.Equal(t, "ortuman", set.Elements().Child("last").Text())
+
+	// next page
+	x.ProcessIQ(tUtilSearchIQ(j, xmpp.SetType, []xep0004.Field{{Var: "org", Values: []string{"jackal"}}}, tUtilRSMSet("10", "ortuman")), stm)
+	form, set = tUtilSearchResult(t, stm.FetchElement())
+	require.Equal(t, 1, len(form.Items))
+	require.Equal(t, []string{"romeo@jackal.im"}, form.Items[0][0].Values)
+
+	// no more results
+	x.ProcessIQ(tUtilSearchIQ(j, xmpp.SetType, []xep0004.Field{{Var: "org", Values: []string{"jackal"}}}, tUtilRSMSet("1", "romeo")), stm)
+	form, set = tUtilSearchResult(t, stm.FetchElement())
+	require.Equal(t, 0, len(form.Items))
+	require.Nil(t, set)
+
+	s.EnableMockedError()
+	x.ProcessIQ(tUtilSearchIQ(j, xmpp.SetType, []xep0004.Field{{Var: "fn", Values: []string{"romeo"}}}, nil), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ErrInternalServerError.Error(), elem.Error().Elements().All()[0].Name())
+	s.DisableMockedError()
+}
+
+func TestXEP0055_OptIn(t *testing.T) {
+	r, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	adHoc, adHocShutdownCh := xep0050.New(&xep0050.Config{}, nil)
+	defer close(adHocShutdownCh)
+
+	x, shutdownCh := New(&Config{Visibility: OptInVisibility}, nil, adHoc, r)
+	defer close(shutdownCh)
+
+	s.InsertOrUpdateDirectoryEntry(context.Background(), &model.DirectoryEntry{Username: "ortuman", FN: "Miguel Ángel"})
+
+	x.ProcessIQ(tUtilSearchIQ(j, xmpp.SetType, []xep0004.Field{{Var: "fn", Values: []string{"miguel"}}}, nil), stm)
+	form, _ := tUtilSearchResult(t, stm.FetchElement())
+	require.Equal(t, 0, len(form.Items))
+
+	// opt in
+	adHoc.ProcessIQ(tUtilCommandIQ(j, "", nil), stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	sessionID := elem.Elements().ChildNamespace("command", "http://jabber.org/protocol/commands").Attributes().Get("sessionid")
+
+	adHoc.ProcessIQ(tUtilCommandIQ(j, sessionID, &xep0004.DataForm{
+		Type:   xep0004.Submit,
+		Fields: []xep0004.Field{formTypeField(), {Var: "listed", Values: []string{"1"}}},
+	}), stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	entry, _ := s.FetchDirectoryEntry(context.Background(), "ortuman")
+	require.True(t, entry.Listed)
+
+	x.ProcessIQ(tUtilSearchIQ(j, xmpp.SetType, []xep0004.Field{{Var: "fn", Values: []string{"miguel"}}}, nil), stm)
+	form, _ = tUtilSearchResult(t, stm.FetchElement())
+	require.Equal(t, 1, len(form.Items))
+}
+
+func tUtilVCard(fn, nickname, email, org string) xmpp.XElement {
+	vCard := xmpp.NewElementNamespace("vCard", "vcard-temp")
+	fnElem := xmpp.NewElementName("FN")
+	fnElem.SetText(fn)
+	vCard.AppendElement(fnElem)
+	nickElem := xmpp.NewElementName("NICKNAME")
+	nickElem.SetText(nickname)
+	vCard.AppendElement(nickElem)
+	emailElem := xmpp.NewElementName("EMAIL")
+	userID := xmpp.NewElementName("USERID")
+	userID.SetText(email)
+	emailElem.AppendElement(xmpp.NewElementName("INTERNET"))
+	emailElem.AppendElement(userID)
+	vCard.AppendElement(emailElem)
+	orgElem := xmpp.NewElementName("ORG")
+	orgName := xmpp.NewElementName("ORGNAME")
+	orgName.SetText(org)
+	orgElem.AppendElement(orgName)
+	vCard.AppendElement(orgElem)
+	return vCard
+}
+
+func tUtilSearchIQ(fromJID *jid.JID, typ string, fields []xep0004.Field, set xmpp.XElement) *xmpp.IQ {
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	iq := xmpp.NewIQType(uuid.New(), typ)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(srvJID)
+
+	q := xmpp.NewElementNamespace("query", searchNamespace)
+	if fields != nil {
+		form := &xep0004.DataForm{Type: xep0004.Submit, Fields: append([]xep0004.Field{formTypeField()}, fields...)}
+		q.AppendElement(form.Element())
+	}
+	if set != nil {
+		q.AppendElement(set)
+	}
+	iq.AppendElement(q)
+	return iq
+}
+
+func tUtilRSMSet(max, after string) xmpp.XElement {
+	set := xmpp.NewElementNamespace("set", rsmNamespace)
+	maxElem := xmpp.NewElementName("max")
+	maxElem.SetText(max)
+	set.AppendElement(maxElem)
+	afterElem := xmpp.NewElementName("after")
+	afterElem.SetText(after)
+	set.AppendElement(afterElem)
+	return set
+}
+
+func tUtilSearchResult(t *testing.T, elem xmpp.XElement) (*xep0004.DataForm, xmpp.XElement) {
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	q := elem.Elements().ChildNamespace("query", searchNamespace)
+	require.NotNil(t, q)
+	form, err := xep0004.NewFormFromElement(q.Elements().ChildNamespace("x", dataFormNamespace))
+	require.Nil(t, err)
+	require.Equal(t, xep0004.Result, form.Type)
+	return form, q.Elements().ChildNamespace("set", rsmNamespace)
+}
+
+func tUtilCommandIQ(fromJID *jid.JID, sessionID string, form *xep0004.DataForm) *xmpp.IQ {
+	srvJID, _ := jid.New("", fromJID.Domain(), "", true)
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(srvJID)
+
+	c := xmpp.NewElementNamespace("command", "http://jabber.org/protocol/commands")
+	c.SetAttribute("node", listingNode)
+	if len(sessionID) > 0 {
+		c.SetAttribute("sessionid", sessionID)
+		c.SetAttribute("action", xep0050.Complete)
+	}
+	if form != nil {
+		c.AppendElement(form.Element())
+	}
+	iq.AppendElement(c)
+	return iq
+}
+
+func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, s, func() {
+		storage.Unset()
+	}
+}
@@ -6,8 +6,10 @@
 package xep0077
 
 import (
+	"github.com/ortuman/jackal/audit"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/actor"
 	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
@@ -17,6 +19,8 @@ import (
 
 const mailboxSize = 2048
 
+var logger = log.WithFields(log.Fields{"module": "registration"})
+
 const registerNamespace = "jabber:iq:register"
 
 const xep077RegisteredCtxKey = "xep0077:registered"
@@ -68,6 +72,7 @@ func (x *Register) loop() {
 		case f := <-x.actorCh:
 			f()
 		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
 			c <- true
 			return
 		}
@@ -138,9 +143,9 @@ func (x *Register) registerNewUser(iq *xmpp.IQ, query xmpp.XElement, stm stream.
 		stm.SendElement(iq.BadRequestError())
 		return
 	}
-	exists, err := storage.UserExists(userEl.Text())
+	exists, err := storage.UserExists(stm.Context(), userEl.Text())
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
@@ -153,8 +158,8 @@ func (x *Register) registerNewUser(iq *xmpp.IQ, query xmpp.XElement, stm stream.
 		Password:     passwordEl.Text(),
 		LastPresence: xmpp.NewPresence(stm.JID(), stm.JID(), xmpp.UnavailableType),
 	}
-	if err := storage.InsertOrUpdateUser(&user); err != nil {
-		log.Error(err)
+	if err := storage.InsertOrUpdateUser(stm.Context(), &user); err != nil {
+		logger.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
@@ -171,11 +176,12 @@ func (x *Register) cancelRegistration(iq *xmpp.IQ, query xmpp.XElement, stm stre
 		stm.SendElement(iq.BadRequestError())
 		return
 	}
-	if err := storage.DeleteUser(stm.Username()); err != nil {
-		log.Error(err)
+	if err := storage.DeleteUser(stm.Context(), stm.Username()); err != nil {
+		logger.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
+	audit.RecordC2S(audit.AccountCancel, stm, nil)
 	stm.SendElement(iq.ResultIQ())
 }
 
@@ -193,9 +199,9 @@ func (x *Register) changePassword(password string, username string, iq *xmpp.IQ,
 		stm.SendElement(iq.NotAuthorizedError())
 		return
 	}
-	user, err := storage.FetchUser(username)
+	user, err := storage.FetchUser(stm.Context(), username)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
@@ -205,11 +211,12 @@ func (x *Register) changePassword(password string, username string, iq *xmpp.IQ,
 	}
 	if user.Password != password {
 		user.Password = password
-		if err := storage.InsertOrUpdateUser(user); err != nil {
-			log.Error(err)
+		if err := storage.InsertOrUpdateUser(stm.Context(), user); err != nil {
+			logger.Error(err)
 			stm.SendElement(iq.InternalServerError())
 			return
 		}
+		audit.RecordC2S(audit.PasswordChange, stm, nil)
 	}
 	stm.SendElement(iq.ResultIQ())
 }
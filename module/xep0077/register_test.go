@@ -6,9 +6,11 @@
 package xep0077
 
 import (
+	"context"
 	"crypto/tls"
 	"testing"
 
+	"github.com/ortuman/jackal/audit"
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/storage"
@@ -167,7 +169,7 @@ func TestXEP0077_RegisterUser(t *testing.T) {
 	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
 
 	// already existing user...
-	storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"})
 	username.SetText("ortuman")
 	password.SetText("5678")
 	x.ProcessIQ(iq, stm)
@@ -186,7 +188,7 @@ func TestXEP0077_RegisterUser(t *testing.T) {
 	elem = stm.FetchElement()
 	require.Equal(t, xmpp.ResultType, elem.Type())
 
-	usr, _ := storage.FetchUser("ortuman")
+	usr, _ := storage.FetchUser(context.Background(), "ortuman")
 	require.NotNil(t, usr)
 }
 
@@ -205,7 +207,7 @@ func TestXEP0077_CancelRegistration(t *testing.T) {
 	x, shutdownCh := New(&Config{}, nil)
 	defer close(shutdownCh)
 
-	storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"})
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
 	iq.SetFromJID(srvJid)
@@ -240,7 +242,7 @@ func TestXEP0077_CancelRegistration(t *testing.T) {
 	elem = stm.FetchElement()
 	require.Equal(t, xmpp.ResultType, elem.Type())
 
-	usr, _ := storage.FetchUser("ortuman")
+	usr, _ := storage.FetchUser(context.Background(), "ortuman")
 	require.Nil(t, usr)
 }
 
@@ -259,7 +261,11 @@ func TestXEP0077_ChangePassword(t *testing.T) {
 	x, shutdownCh := New(&Config{}, nil)
 	defer close(shutdownCh)
 
-	storage.InsertOrUpdateUser(&model.User{Username: "ortuman", Password: "1234"})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"})
+
+	auditor, _ := audit.New(&audit.Config{Type: audit.StorageSink})
+	audit.Set(auditor)
+	defer audit.Unset()
 
 	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
 	iq.SetFromJID(srvJid)
@@ -304,9 +310,16 @@ func TestXEP0077_ChangePassword(t *testing.T) {
 	elem = stm.FetchElement()
 	require.Equal(t, xmpp.ResultType, elem.Type())
 
-	usr, _ := storage.FetchUser("ortuman")
+	usr, _ := storage.FetchUser(context.Background(), "ortuman")
 	require.NotNil(t, usr)
 	require.Equal(t, "5678", usr.Password)
+
+	// password change must be audited
+	auditor.Close()
+	events, _ := storage.FetchAuditEvents(context.Background(), "ortuman")
+	require.Equal(t, 1, len(events))
+	require.Equal(t, audit.PasswordChange, events[0].Type)
+	require.Equal(t, "abcd1234", events[0].StreamID)
 }
 
 func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/actor"
 	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/version"
@@ -18,6 +19,8 @@ import (
 
 const mailboxSize = 2048
 
+var logger = log.WithFields(log.Fields{"module": "version"})
+
 const versionNamespace = "jabber:iq:version"
 
 var osString string
@@ -61,7 +64,7 @@ func (x *Version) MatchesIQ(iq *xmpp.IQ) bool {
 
 // ProcessIQ processes a version IQ taking according actions
 // over the associated stream.
-func (x *Version) ProcessIQ(iq *xmpp.IQ, stm stream.C2S) {
+func (x *Version) ProcessIQ(iq *xmpp.IQ, stm stream.InOutStream) {
 	x.actorCh <- func() { x.processIQ(iq, stm) }
 }
 
@@ -72,13 +75,14 @@ func (x *Version) loop() {
 		case f := <-x.actorCh:
 			f()
 		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
 			c <- true
 			return
 		}
 	}
 }
 
-func (x *Version) processIQ(iq *xmpp.IQ, stm stream.C2S) {
+func (x *Version) processIQ(iq *xmpp.IQ, stm stream.InOutStream) {
 	q := iq.Elements().ChildNamespace("query", versionNamespace)
 	if q == nil || q.Elements().Count() != 0 {
 		stm.SendElement(iq.BadRequestError())
@@ -87,11 +91,8 @@ func (x *Version) processIQ(iq *xmpp.IQ, stm stream.C2S) {
 	x.sendSoftwareVersion(iq, stm)
 }
 
-func (x *Version) sendSoftwareVersion(iq *xmpp.IQ, stm stream.C2S) {
-	userJID := stm.JID()
-	username := userJID.Node()
-	resource := userJID.Resource()
-	log.Infof("retrieving software version: %v (%s/%s)", version.ApplicationVersion, username, resource)
+func (x *Version) sendSoftwareVersion(iq *xmpp.IQ, stm stream.InOutStream) {
+	logger.Infof("retrieving software version: %v (%s)", version.ApplicationVersion, iq.FromJID().String())
 
 	result := iq.ResultIQ()
 	query := xmpp.NewElementNamespace("query", versionNamespace)
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/motd"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+var logger = log.WithFields(log.Fields{"module": "admin"})
+
+const adminNamespace = "http://jabber.org/protocol/admin"
+
+// Admin represents a service administration server stream module.
+// Commands are executed within the ad-hoc commands module context,
+// so it doesn't hold any state of its own.
+type Admin struct {
+	router *router.Router
+}
+
+// New returns a service administration module registering
+// every administrative command into the ad-hoc commands module.
+// Account management commands are only registered when serving a single host,
+// as user storage is shared among all of them, while message of the day
+// commands are only registered if motd module is enabled.
+func New(adHoc *xep0050.AdHoc, motd *motd.MOTD, router *router.Router) *Admin {
+	x := &Admin{router: router}
+	if adHoc != nil {
+		var cmds []*command
+		if len(router.HostNames()) == 1 {
+			cmds = append(cmds, x.accountCommands()...)
+		}
+		cmds = append(cmds, x.commands()...)
+		if motd != nil {
+			cmds = append(cmds, x.motdCommands()...)
+		}
+		for _, cmd := range cmds {
+			adHoc.RegisterCommand(cmd)
+		}
+	}
+	return x
+}
+
+func (x *Admin) announcement(domain, subject, body string) *xmpp.Message {
+	srvJID, _ := jid.New("", domain, "", true)
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.NormalType)
+	msg.SetFromJID(srvJID)
+	msg.SetToJID(srvJID)
+	if len(subject) > 0 {
+		s := xmpp.NewElementName("subject")
+		s.SetText(subject)
+		msg.AppendElement(s)
+	}
+	b := xmpp.NewElementName("body")
+	b.SetText(body)
+	msg.AppendElement(b)
+	return msg
+}
+
+// userStreams returns the streams matching a user JID,
+// restricting them to a single resource if j is a full JID.
+func (x *Admin) userStreams(j *jid.JID) []stream.C2S {
+	var ret []stream.C2S
+	for _, stm := range x.router.UserStreams(j.Node()) {
+		if stm.Domain() != j.Domain() {
+			continue
+		}
+		if len(j.Resource()) > 0 && stm.Resource() != j.Resource() {
+			continue
+		}
+		ret = append(ret, stm)
+	}
+	return ret
+}
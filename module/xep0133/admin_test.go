@@ -0,0 +1,317 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/motd"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const commandsNamespace = "http://jabber.org/protocol/commands"
+
+func TestXEP0133_NotAllowed(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("noelia", "jackal.im", "garden", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	adHoc, _ := tUtilAdminModules(r)
+
+	adHoc.ProcessIQ(tUtilCommandIQ(j, addUserNode, "", nil), stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+}
+
+func TestXEP0133_ManageUsers(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	adHoc, _ := tUtilAdminModules(r)
+
+	// add user
+	tUtilExecuteCommand(t, adHoc, stm, addUserNode, []xep0004.Field{
+		{Var: "accountjid", Values: []string{"noelia@jackal.im"}},
+		{Var: "password", Values: []string{"1234"}},
+		{Var: "password-verify", Values: []string{"1234"}},
+	})
+	usr, _ := storage.FetchUser(context.Background(), "noelia")
+	require.NotNil(t, usr)
+	require.Equal(t, "1234", usr.Password)
+
+	// foreign domain
+	sessionID := tUtilBeginCommand(t, adHoc, stm, changeUserPasswordNode)
+	adHoc.ProcessIQ(tUtilCommandIQ(j, changeUserPasswordNode, sessionID, tUtilSubmitForm([]xep0004.Field{
+		{Var: "accountjid", Values: []string{"noelia@jabber.org"}},
+		{Var: "password", Values: []string{"4321"}},
+	})), stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ErrNotAllowed.Error(), elem.Error().Elements().All()[0].Name())
+
+	// change password
+	tUtilExecuteCommand(t, adHoc, stm, changeUserPasswordNode, []xep0004.Field{
+		{Var: "accountjid", Values: []string{"noelia@jackal.im"}},
+		{Var: "password", Values: []string{"4321"}},
+	})
+	usr, _ = storage.FetchUser(context.Background(), "noelia")
+	require.Equal(t, "4321", usr.Password)
+
+	// disable user
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	r.Bind(stm2)
+
+	tUtilExecuteCommand(t, adHoc, stm, disableUserNode, []xep0004.Field{
+		{Var: "accountjids", Values: []string{"noelia@jackal.im"}},
+	})
+	usr, _ = storage.FetchUser(context.Background(), "noelia")
+	require.True(t, usr.Disabled)
+	require.True(t, stm2.IsDisconnected())
+	r.Unbind(stm2)
+
+	// re-enable user
+	tUtilExecuteCommand(t, adHoc, stm, reenableUserNode, []xep0004.Field{
+		{Var: "accountjids", Values: []string{"noelia@jackal.im"}},
+	})
+	usr, _ = storage.FetchUser(context.Background(), "noelia")
+	require.False(t, usr.Disabled)
+
+	// delete user
+	tUtilExecuteCommand(t, adHoc, stm, deleteUserNode, []xep0004.Field{
+		{Var: "accountjids", Values: []string{"noelia@jackal.im"}},
+	})
+	usr, _ = storage.FetchUser(context.Background(), "noelia")
+	require.Nil(t, usr)
+}
+
+func TestXEP0133_OnlineUsers(t *testing.T) {
+	r, s, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("noelia", "jackal.im", "garden", true)
+	j3, _ := jid.New("noelia", "jackal.im", "yard", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm3 := stream.NewMockC2S(uuid.New(), j3)
+	defer stm.Disconnect(nil)
+
+	s.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"})
+	s.InsertOrUpdateUser(context.Background(), &model.User{Username: "noelia", Password: "1234"})
+	r.Bind(stm)
+	r.Bind(stm2)
+	r.Bind(stm3)
+
+	adHoc, _ := tUtilAdminModules(r)
+
+	adHoc.ProcessIQ(tUtilCommandIQ(j, getOnlineUsersNumNode, "", nil), stm)
+	form := tUtilResultForm(t, stm.FetchElement())
+	require.Equal(t, []string{"2"}, fieldValues(form, "onlineusersnum"))
+
+	adHoc.ProcessIQ(tUtilCommandIQ(j, getOnlineUsersListNode, "", nil), stm)
+	form = tUtilResultForm(t, stm.FetchElement())
+	require.Equal(t, []string{"noelia@jackal.im", "ortuman@jackal.im"}, fieldValues(form, "onlineuserjids"))
+
+	// announcement
+	sessionID := tUtilBeginCommand(t, adHoc, stm, announceNode)
+	adHoc.ProcessIQ(tUtilCommandIQ(j, announceNode, sessionID, tUtilSubmitForm([]xep0004.Field{
+		{Var: "subject", Values: []string{"Maintenance"}},
+		{Var: "announcement", Values: []string{"Server will restart", "in 5 minutes"}},
+	})), stm)
+	for _, s := range []*stream.MockC2S{stm, stm2, stm3} {
+		elem := s.FetchElement()
+		require.Equal(t, "message", elem.Name())
+		require.Equal(t, "jackal.im", elem.From())
+		require.Equal(t, "Maintenance", elem.Elements().Child("subject").Text())
+		require.Equal(t, "Server will restart\nin 5 minutes", elem.Elements().Child("body").Text())
+	}
+	require.Equal(t, xmpp.ResultType, stm.FetchElement().Type())
+
+	// end a single session
+	tUtilExecuteCommand(t, adHoc, stm, endUserSessionNode, []xep0004.Field{
+		{Var: "accountjids", Values: []string{"noelia@jackal.im/yard"}},
+	})
+	require.True(t, stm3.IsDisconnected())
+	require.False(t, stm2.IsDisconnected())
+}
+
+func TestXEP0133_MOTD(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	adHoc, _ := tUtilAdminModules(r)
+
+	tUtilExecuteCommand(t, adHoc, stm, setMOTDNode, []xep0004.Field{
+		{Var: "subject", Values: []string{"Hi"}},
+		{Var: "motd", Values: []string{"Welcome!", "Enjoy"}},
+	})
+	motd, _ := storage.FetchMOTD(context.Background(), "jackal.im")
+	require.NotNil(t, motd)
+	require.Equal(t, "Hi", motd.Subject)
+	require.Equal(t, "Welcome!\nEnjoy", motd.Body)
+
+	// edit form is prefilled with current message
+	adHoc.ProcessIQ(tUtilCommandIQ(j, editMOTDNode, "", nil), stm)
+	form := tUtilResultForm(t, stm.FetchElement())
+	require.Equal(t, []string{"Hi"}, fieldValues(form, "subject"))
+	require.Equal(t, []string{"Welcome!", "Enjoy"}, fieldValues(form, "motd"))
+
+	tUtilExecuteCommand(t, adHoc, stm, deleteMOTDNode, nil)
+
+	motd, _ = storage.FetchMOTD(context.Background(), "jackal.im")
+	require.Nil(t, motd)
+}
+
+func TestXEP0133_MultipleHosts(t *testing.T) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{
+			{Name: "jackal.im", Certificate: tls.Certificate{}, Admins: []string{"ortuman"}},
+			{Name: "jabber.org", Certificate: tls.Certificate{}, Admins: []string{"noelia"}},
+		},
+	})
+	storage.Set(memstorage.New())
+	defer storage.Unset()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	adHoc, _ := xep0050.New(&xep0050.Config{}, nil)
+	New(adHoc, nil, r)
+
+	// user storage is shared among hosts
+	for _, node := range []string{addUserNode, deleteUserNode, disableUserNode, reenableUserNode, changeUserPasswordNode} {
+		adHoc.ProcessIQ(tUtilCommandIQ(j, node, "", nil), stm)
+		elem := stm.FetchElement()
+		require.Equal(t, xmpp.ErrorType, elem.Type())
+		require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+	}
+	adHoc.ProcessIQ(tUtilCommandIQ(j, getOnlineUsersNumNode, "", nil), stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+}
+
+func TestXEP0133_MOTDDisabled(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+
+	adHoc, _ := xep0050.New(&xep0050.Config{}, nil)
+	New(adHoc, nil, r)
+
+	for _, node := range []string{setMOTDNode, editMOTDNode, deleteMOTDNode} {
+		adHoc.ProcessIQ(tUtilCommandIQ(j, node, "", nil), stm)
+		elem := stm.FetchElement()
+		require.Equal(t, xmpp.ErrorType, elem.Type())
+		require.Equal(t, xmpp.ErrItemNotFound.Error(), elem.Error().Elements().All()[0].Name())
+	}
+}
+
+func tUtilAdminModules(r *router.Router) (*xep0050.AdHoc, *Admin) {
+	adHoc, _ := xep0050.New(&xep0050.Config{}, nil)
+	m, _ := motd.New(r)
+	x := New(adHoc, m, r)
+	return adHoc, x
+}
+
+// tUtilBeginCommand starts a command execution returning the assigned session identifier.
+func tUtilBeginCommand(t *testing.T, adHoc *xep0050.AdHoc, stm *stream.MockC2S, node string) string {
+	adHoc.ProcessIQ(tUtilCommandIQ(stm.JID(), node, "", nil), stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	c := elem.Elements().ChildNamespace("command", commandsNamespace)
+	require.Equal(t, xep0050.Executing, c.Attributes().Get("status"))
+	return c.Attributes().Get("sessionid")
+}
+
+// tUtilExecuteCommand runs a command to completion, submitting fields if any were required.
+func tUtilExecuteCommand(t *testing.T, adHoc *xep0050.AdHoc, stm *stream.MockC2S, node string, fields []xep0004.Field) {
+	if len(fields) > 0 {
+		sessionID := tUtilBeginCommand(t, adHoc, stm, node)
+		adHoc.ProcessIQ(tUtilCommandIQ(stm.JID(), node, sessionID, tUtilSubmitForm(fields)), stm)
+	} else {
+		adHoc.ProcessIQ(tUtilCommandIQ(stm.JID(), node, "", nil), stm)
+	}
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	c := elem.Elements().ChildNamespace("command", commandsNamespace)
+	require.Equal(t, xep0050.Completed, c.Attributes().Get("status"))
+}
+
+func tUtilResultForm(t *testing.T, elem xmpp.XElement) *xep0004.DataForm {
+	c := elem.Elements().ChildNamespace("command", commandsNamespace)
+	require.NotNil(t, c)
+	form, err := xep0004.NewFormFromElement(c.Elements().ChildNamespace("x", "jabber:x:data"))
+	require.Nil(t, err)
+	return form
+}
+
+func tUtilSubmitForm(fields []xep0004.Field) *xep0004.DataForm {
+	return &xep0004.DataForm{
+		Type:   xep0004.Submit,
+		Fields: append([]xep0004.Field{formTypeField()}, fields...),
+	}
+}
+
+func tUtilCommandIQ(fromJID *jid.JID, node, sessionID string, form *xep0004.DataForm) *xmpp.IQ {
+	srvJID, _ := jid.New("", fromJID.Domain(), "", true)
+	iq := xmpp.NewIQType(uuid.New(), xmpp.SetType)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(srvJID)
+
+	c := xmpp.NewElementNamespace("command", commandsNamespace)
+	c.SetAttribute("node", node)
+	if len(sessionID) > 0 {
+		c.SetAttribute("sessionid", sessionID)
+		c.SetAttribute("action", xep0050.Complete)
+	}
+	if form != nil {
+		c.AppendElement(form.Element())
+	}
+	iq.AppendElement(c)
+	return iq
+}
+
+func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}, Admins: []string{"ortuman"}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, s, func() {
+		storage.Unset()
+	}
+}
@@ -0,0 +1,523 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0133
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ortuman/jackal/audit"
+	"github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/xep0004"
+	"github.com/ortuman/jackal/module/xep0050"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const (
+	addUserNode            = adminNamespace + "#add-user"
+	deleteUserNode         = adminNamespace + "#delete-user"
+	disableUserNode        = adminNamespace + "#disable-user"
+	reenableUserNode       = adminNamespace + "#reenable-user"
+	changeUserPasswordNode = adminNamespace + "#change-user-password"
+	endUserSessionNode     = adminNamespace + "#end-user-session"
+	getOnlineUsersNumNode  = adminNamespace + "#get-online-users-num"
+	getOnlineUsersListNode = adminNamespace + "#get-online-users-list"
+	announceNode           = adminNamespace + "#announce"
+	setMOTDNode            = adminNamespace + "#set-motd"
+	editMOTDNode           = adminNamespace + "#edit-motd"
+	deleteMOTDNode         = adminNamespace + "#delete-motd"
+)
+
+type executeFunc func(ctx context.Context, requester *jid.JID, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError)
+
+type valuesFunc func(ctx context.Context, requester *jid.JID) (map[string][]string, *xmpp.StanzaError)
+
+// command represents a service administration command.
+// Commands declaring fields are executed in two stages: the first one
+// returns the form to be filled in, optionally prefilled with current values,
+// while the second one submits it.
+type command struct {
+	x       *Admin
+	node    string
+	name    string
+	fields  []xep0004.Field
+	values  valuesFunc
+	execute executeFunc
+}
+
+func (c *command) Node() string { return c.node }
+func (c *command) Name() string { return c.name }
+
+func (c *command) IsAllowed(fromJID *jid.JID) bool {
+	return c.x.router.IsAdmin(fromJID)
+}
+
+func (c *command) Execute(ctx context.Context, sess *xep0050.Session, action string, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	if len(c.fields) > 0 {
+		if sess.Stage == 0 {
+			fields, sErr := c.formFields(ctx, sess.Requester)
+			if sErr != nil {
+				return nil, sErr
+			}
+			sess.Stage++
+			return &xep0050.Response{
+				Status:  xep0050.Executing,
+				Actions: []string{xep0050.Complete},
+				Form: &xep0004.DataForm{
+					Type:   xep0004.Form,
+					Title:  c.name,
+					Fields: fields,
+				},
+			}, nil
+		}
+		if form == nil || form.Type != xep0004.Submit {
+			return nil, xmpp.ErrBadRequest
+		}
+	}
+	resp, sErr := c.execute(ctx, sess.Requester, form)
+	if sErr != nil {
+		return nil, sErr
+	}
+	details := map[string]string{"command": c.node}
+	if accounts := append(fieldValues(form, "accountjid"), fieldValues(form, "accountjids")...); len(accounts) > 0 {
+		details["accounts"] = strings.Join(accounts, ",")
+	}
+	audit.Record(&model.AuditEvent{
+		Type:     audit.AdminAction,
+		Username: sess.Requester.Node(),
+		JID:      sess.Requester.String(),
+		Details:  details,
+	})
+	return resp, nil
+}
+
+func (c *command) formFields(ctx context.Context, requester *jid.JID) ([]xep0004.Field, *xmpp.StanzaError) {
+	fields := append([]xep0004.Field{formTypeField()}, c.fields...)
+	if c.values == nil {
+		return fields, nil
+	}
+	values, sErr := c.values(ctx, requester)
+	if sErr != nil {
+		return nil, sErr
+	}
+	for i := range fields {
+		if v, ok := values[fields[i].Var]; ok {
+			fields[i].Values = v
+		}
+	}
+	return fields, nil
+}
+
+// accountCommands returns the account management commands, only registered
+// whenever a single host is served as user storage is not host aware.
+func (x *Admin) accountCommands() []*command {
+	return []*command{
+		{
+			x:    x,
+			node: addUserNode,
+			name: "Add User",
+			fields: []xep0004.Field{
+				{Var: "accountjid", Type: xep0004.JidSingle, Label: "The Jabber ID for the account to be added", Required: true},
+				{Var: "password", Type: xep0004.TextPrivate, Label: "The password for this account", Required: true},
+				{Var: "password-verify", Type: xep0004.TextPrivate, Label: "Retype password", Required: true},
+			},
+			execute: x.addUser,
+		},
+		{
+			x:    x,
+			node: deleteUserNode,
+			name: "Delete User",
+			fields: []xep0004.Field{
+				{Var: "accountjids", Type: xep0004.JidMulti, Label: "The Jabber ID(s) to delete", Required: true},
+			},
+			execute: x.deleteUsers,
+		},
+		{
+			x:    x,
+			node: disableUserNode,
+			name: "Disable User",
+			fields: []xep0004.Field{
+				{Var: "accountjids", Type: xep0004.JidMulti, Label: "The Jabber ID(s) to disable", Required: true},
+			},
+			execute: x.disableUsers,
+		},
+		{
+			x:    x,
+			node: reenableUserNode,
+			name: "Re-Enable User",
+			fields: []xep0004.Field{
+				{Var: "accountjids", Type: xep0004.JidMulti, Label: "The Jabber ID(s) to re-enable", Required: true},
+			},
+			execute: x.reenableUsers,
+		},
+		{
+			x:    x,
+			node: changeUserPasswordNode,
+			name: "Change User Password",
+			fields: []xep0004.Field{
+				{Var: "accountjid", Type: xep0004.JidSingle, Label: "The Jabber ID for this account", Required: true},
+				{Var: "password", Type: xep0004.TextPrivate, Label: "The password for this account", Required: true},
+			},
+			execute: x.changeUserPassword,
+		},
+	}
+}
+
+func (x *Admin) commands() []*command {
+	return []*command{
+		{
+			x:    x,
+			node: endUserSessionNode,
+			name: "End User Session",
+			fields: []xep0004.Field{
+				{Var: "accountjids", Type: xep0004.JidMulti, Label: "The Jabber ID(s) for which to end sessions", Required: true},
+			},
+			execute: x.endUserSessions,
+		},
+		{
+			x:       x,
+			node:    getOnlineUsersNumNode,
+			name:    "Get Number of Online Users",
+			execute: x.getOnlineUsersNum,
+		},
+		{
+			x:       x,
+			node:    getOnlineUsersListNode,
+			name:    "Get List of Online Users",
+			execute: x.getOnlineUsersList,
+		},
+		{
+			x:    x,
+			node: announceNode,
+			name: "Send Announcement to Online Users",
+			fields: []xep0004.Field{
+				{Var: "subject", Type: xep0004.TextSingle, Label: "Subject"},
+				{Var: "announcement", Type: xep0004.TextMulti, Label: "Announcement", Required: true},
+			},
+			execute: x.announce,
+		},
+	}
+}
+
+// motdCommands returns the message of the day administration commands,
+// only registered whenever the motd module is enabled.
+func (x *Admin) motdCommands() []*command {
+	return []*command{
+		{
+			x:    x,
+			node: setMOTDNode,
+			name: "Set Message of the Day",
+			fields: []xep0004.Field{
+				{Var: "subject", Type: xep0004.TextSingle, Label: "Subject"},
+				{Var: "motd", Type: xep0004.TextMulti, Label: "Message of the Day", Required: true},
+			},
+			execute: x.setMOTD,
+		},
+		{
+			x:    x,
+			node: editMOTDNode,
+			name: "Edit Message of the Day",
+			fields: []xep0004.Field{
+				{Var: "subject", Type: xep0004.TextSingle, Label: "Subject"},
+				{Var: "motd", Type: xep0004.TextMulti, Label: "Message of the Day", Required: true},
+			},
+			values:  x.motdValues,
+			execute: x.setMOTD,
+		},
+		{
+			x:       x,
+			node:    deleteMOTDNode,
+			name:    "Delete Message of the Day",
+			execute: x.deleteMOTD,
+		},
+	}
+}
+
+func (x *Admin) addUser(ctx context.Context, requester *jid.JID, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	accounts, sErr := accountJIDs(requester, form, "accountjid")
+	if sErr != nil {
+		return nil, sErr
+	}
+	password := fieldValue(form, "password")
+	if len(accounts) != 1 || len(password) == 0 || password != fieldValue(form, "password-verify") {
+		return nil, xmpp.ErrNotAcceptable
+	}
+	username := accounts[0].Node()
+	exists, err := storage.UserExists(ctx, username)
+	if err != nil {
+		logger.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	if exists {
+		return nil, xmpp.ErrConflict
+	}
+	if err := storage.InsertOrUpdateUser(ctx, &model.User{Username: username, Password: password}); err != nil {
+		logger.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	return infoResponse("User successfully added."), nil
+}
+
+func (x *Admin) deleteUsers(ctx context.Context, requester *jid.JID, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	accounts, sErr := accountJIDs(requester, form, "accountjids")
+	if sErr != nil {
+		return nil, sErr
+	}
+	for _, j := range accounts {
+		if err := storage.DeleteUser(ctx, j.Node()); err != nil {
+			logger.Error(err)
+			return nil, xmpp.ErrInternalServerError
+		}
+		if err := x.disconnect(j.ToBareJID()); err != nil {
+			logger.Error(err)
+			return nil, xmpp.ErrInternalServerError
+		}
+	}
+	return infoResponse("User(s) successfully deleted."), nil
+}
+
+func (x *Admin) disableUsers(ctx context.Context, requester *jid.JID, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	accounts, sErr := x.setDisabled(ctx, requester, form, true)
+	if sErr != nil {
+		return nil, sErr
+	}
+	for _, j := range accounts {
+		if err := x.disconnect(j.ToBareJID()); err != nil {
+			logger.Error(err)
+			return nil, xmpp.ErrInternalServerError
+		}
+	}
+	return infoResponse("User(s) successfully disabled."), nil
+}
+
+func (x *Admin) reenableUsers(ctx context.Context, requester *jid.JID, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	if _, sErr := x.setDisabled(ctx, requester, form, false); sErr != nil {
+		return nil, sErr
+	}
+	return infoResponse("User(s) successfully re-enabled."), nil
+}
+
+func (x *Admin) setDisabled(ctx context.Context, requester *jid.JID, form *xep0004.DataForm, disabled bool) ([]*jid.JID, *xmpp.StanzaError) {
+	accounts, sErr := accountJIDs(requester, form, "accountjids")
+	if sErr != nil {
+		return nil, sErr
+	}
+	for _, j := range accounts {
+		user, err := storage.FetchUser(ctx, j.Node())
+		if err != nil {
+			logger.Error(err)
+			return nil, xmpp.ErrInternalServerError
+		}
+		if user == nil {
+			return nil, xmpp.ErrItemNotFound
+		}
+		if user.Disabled == disabled {
+			continue
+		}
+		user.Disabled = disabled
+		if err := storage.InsertOrUpdateUser(ctx, user); err != nil {
+			logger.Error(err)
+			return nil, xmpp.ErrInternalServerError
+		}
+	}
+	return accounts, nil
+}
+
+func (x *Admin) changeUserPassword(ctx context.Context, requester *jid.JID, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	accounts, sErr := accountJIDs(requester, form, "accountjid")
+	if sErr != nil {
+		return nil, sErr
+	}
+	password := fieldValue(form, "password")
+	if len(accounts) != 1 || len(password) == 0 {
+		return nil, xmpp.ErrNotAcceptable
+	}
+	user, err := storage.FetchUser(ctx, accounts[0].Node())
+	if err != nil {
+		logger.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	if user == nil {
+		return nil, xmpp.ErrItemNotFound
+	}
+	user.Password = password
+	if err := storage.InsertOrUpdateUser(ctx, user); err != nil {
+		logger.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	return infoResponse("Password successfully changed."), nil
+}
+
+func (x *Admin) endUserSessions(_ context.Context, requester *jid.JID, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	accounts, sErr := accountJIDs(requester, form, "accountjids")
+	if sErr != nil {
+		return nil, sErr
+	}
+	for _, j := range accounts {
+		if err := x.disconnect(j); err != nil {
+			logger.Error(err)
+			return nil, xmpp.ErrInternalServerError
+		}
+	}
+	return infoResponse("User session(s) successfully ended."), nil
+}
+
+func (x *Admin) getOnlineUsersNum(_ context.Context, requester *jid.JID, _ *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	users := x.onlineUsers(requester.Domain())
+	return &xep0050.Response{
+		Form: &xep0004.DataForm{
+			Type: xep0004.Result,
+			Fields: []xep0004.Field{
+				formTypeField(),
+				{Var: "onlineusersnum", Label: "The number of online users", Values: []string{strconv.Itoa(len(users))}},
+			},
+		},
+	}, nil
+}
+
+func (x *Admin) getOnlineUsersList(_ context.Context, requester *jid.JID, _ *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	users := x.onlineUsers(requester.Domain())
+	return &xep0050.Response{
+		Form: &xep0004.DataForm{
+			Type: xep0004.Result,
+			Fields: []xep0004.Field{
+				formTypeField(),
+				{Var: "onlineuserjids", Type: xep0004.JidMulti, Label: "The list of all online users", Values: users},
+			},
+		},
+	}, nil
+}
+
+func (x *Admin) announce(_ context.Context, requester *jid.JID, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	body := strings.Join(fieldValues(form, "announcement"), "\n")
+	if len(body) == 0 {
+		return nil, xmpp.ErrNotAcceptable
+	}
+	x.router.Broadcast(x.announcement(requester.Domain(), fieldValue(form, "subject"), body))
+	return infoResponse("Announcement successfully sent."), nil
+}
+
+func (x *Admin) setMOTD(ctx context.Context, requester *jid.JID, form *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	body := strings.Join(fieldValues(form, "motd"), "\n")
+	if len(body) == 0 {
+		return nil, xmpp.ErrNotAcceptable
+	}
+	motd := &model.MOTD{
+		Host:    requester.Domain(),
+		Subject: fieldValue(form, "subject"),
+		Body:    body,
+	}
+	if err := storage.InsertOrUpdateMOTD(ctx, motd); err != nil {
+		logger.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	return infoResponse("Message of the day successfully set."), nil
+}
+
+func (x *Admin) motdValues(ctx context.Context, requester *jid.JID) (map[string][]string, *xmpp.StanzaError) {
+	motd, err := storage.FetchMOTD(ctx, requester.Domain())
+	if err != nil {
+		logger.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	if motd == nil {
+		return nil, nil
+	}
+	return map[string][]string{
+		"subject": {motd.Subject},
+		"motd":    strings.Split(motd.Body, "\n"),
+	}, nil
+}
+
+func (x *Admin) deleteMOTD(ctx context.Context, requester *jid.JID, _ *xep0004.DataForm) (*xep0050.Response, *xmpp.StanzaError) {
+	if err := storage.DeleteMOTD(ctx, requester.Domain()); err != nil {
+		logger.Error(err)
+		return nil, xmpp.ErrInternalServerError
+	}
+	return infoResponse("Message of the day successfully deleted."), nil
+}
+
+// onlineUsers returns the sorted bare JID of every domain user having at
+// least one bound stream, including the ones bound to any other cluster node.
+func (x *Admin) onlineUsers(domain string) []string {
+	var ret []string
+	seen := make(map[string]struct{})
+	for _, stm := range x.router.DomainStreams(domain) {
+		if _, ok := seen[stm.Username()]; ok {
+			continue
+		}
+		seen[stm.Username()] = struct{}{}
+		ret = append(ret, stm.JID().ToBareJID().String())
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// disconnect ends every session matching j, returning an error in case any
+// of them is bound to a cluster node the request couldn't be handed over to.
+func (x *Admin) disconnect(j *jid.JID) error {
+	var ret error
+	for _, stm := range x.userStreams(j) {
+		if err := stream.Disconnect(stm, streamerror.ErrPolicyViolation); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+// accountJIDs parses the account JIDs contained into a form field,
+// restricting them to the requester administered domain.
+func accountJIDs(requester *jid.JID, form *xep0004.DataForm, fieldVar string) ([]*jid.JID, *xmpp.StanzaError) {
+	values := fieldValues(form, fieldVar)
+	if len(values) == 0 {
+		return nil, xmpp.ErrNotAcceptable
+	}
+	var ret []*jid.JID
+	for _, v := range values {
+		j, err := jid.NewWithString(v, false)
+		if err != nil || len(j.Node()) == 0 {
+			return nil, xmpp.ErrJidMalformed
+		}
+		if j.Domain() != requester.Domain() {
+			return nil, xmpp.ErrNotAllowed
+		}
+		ret = append(ret, j)
+	}
+	return ret, nil
+}
+
+func infoResponse(text string) *xep0050.Response {
+	return &xep0050.Response{Notes: []xep0050.Note{{Type: xep0050.InfoNote, Text: text}}}
+}
+
+func formTypeField() xep0004.Field {
+	return xep0004.Field{Var: "FORM_TYPE", Type: xep0004.Hidden, Values: []string{adminNamespace}}
+}
+
+func fieldValues(form *xep0004.DataForm, fieldVar string) []string {
+	if form == nil {
+		return nil
+	}
+	for _, f := range form.Fields {
+		if f.Var == fieldVar {
+			return f.Values
+		}
+	}
+	return nil
+}
+
+func fieldValue(form *xep0004.DataForm, fieldVar string) string {
+	if values := fieldValues(form, fieldVar); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
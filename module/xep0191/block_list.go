@@ -6,9 +6,11 @@
 package xep0191
 
 import (
+	"github.com/ortuman/jackal/audit"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/module/actor"
 	"github.com/ortuman/jackal/module/roster"
 	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/router"
@@ -21,6 +23,8 @@ import (
 
 const mailboxSize = 2048
 
+var logger = log.WithFields(log.Fields{"module": "blocking_command"})
+
 const blockingCommandNamespace = "urn:xmpp:blocking"
 
 const (
@@ -74,6 +78,7 @@ func (x *BlockingCommand) loop() {
 		case f := <-x.actorCh:
 			f()
 		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
 			c <- true
 			return
 		}
@@ -95,9 +100,9 @@ func (x *BlockingCommand) processIQ(iq *xmpp.IQ, stm stream.C2S) {
 
 func (x *BlockingCommand) sendBlockList(iq *xmpp.IQ, stm stream.C2S) {
 	fromJID := iq.FromJID()
-	blItms, err := storage.FetchBlockListItems(fromJID.Node())
+	blItms, err := storage.FetchBlockListItems(stm.Context(), fromJID.Node())
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
@@ -124,13 +129,13 @@ func (x *BlockingCommand) block(iq *xmpp.IQ, block xmpp.XElement, stm stream.C2S
 	}
 	jds, err := x.extractItemJIDs(items)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		stm.SendElement(iq.JidMalformedError())
 		return
 	}
 	blItems, ris, err := x.fetchBlockListAndRosterItems(stm)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
@@ -141,13 +146,16 @@ func (x *BlockingCommand) block(iq *xmpp.IQ, block xmpp.XElement, stm stream.C2S
 			bl = append(bl, model.BlockListItem{Username: username, JID: j.String()})
 		}
 	}
-	if err := storage.InsertBlockListItems(bl); err != nil {
-		log.Error(err)
+	if err := storage.InsertBlockListItems(stm.Context(), bl); err != nil {
+		logger.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
 	x.router.ReloadBlockList(username)
 
+	for _, item := range bl {
+		audit.RecordC2S(audit.Block, stm, map[string]string{"jid": item.JID})
+	}
 	stm.SendElement(iq.ResultIQ())
 	x.pushIQ(block, stm)
 }
@@ -156,13 +164,13 @@ func (x *BlockingCommand) unblock(iq *xmpp.IQ, unblock xmpp.XElement, stm stream
 	items := unblock.Elements().Children("item")
 	jds, err := x.extractItemJIDs(items)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		stm.SendElement(iq.JidMalformedError())
 		return
 	}
 	blItems, ris, err := x.fetchBlockListAndRosterItems(stm)
 	if err != nil {
-		log.Error(err)
+		logger.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
@@ -183,13 +191,16 @@ func (x *BlockingCommand) unblock(iq *xmpp.IQ, unblock xmpp.XElement, stm stream
 			}
 		}
 	}
-	if err := storage.DeleteBlockListItems(bl); err != nil {
-		log.Error(err)
+	if err := storage.DeleteBlockListItems(stm.Context(), bl); err != nil {
+		logger.Error(err)
 		stm.SendElement(iq.InternalServerError())
 		return
 	}
 	x.router.ReloadBlockList(username)
 
+	for _, item := range bl {
+		audit.RecordC2S(audit.Unblock, stm, map[string]string{"jid": item.JID})
+	}
 	stm.SendElement(iq.ResultIQ())
 	x.pushIQ(unblock, stm)
 }
@@ -245,11 +256,11 @@ func (x *BlockingCommand) isSubscribedTo(jid *jid.JID, ris []rostermodel.Item) b
 
 func (x *BlockingCommand) fetchBlockListAndRosterItems(stm stream.C2S) ([]model.BlockListItem, []rostermodel.Item, error) {
 	username := stm.Username()
-	blItms, err := storage.FetchBlockListItems(username)
+	blItms, err := storage.FetchBlockListItems(stm.Context(), username)
 	if err != nil {
 		return nil, nil, err
 	}
-	ris, _, err := storage.FetchRosterItems(username)
+	ris, _, err := storage.FetchRosterItems(stm.Context(), username)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -6,6 +6,7 @@
 package xep0191
 
 import (
+	"context"
 	"crypto/tls"
 	"testing"
 	"time"
@@ -70,7 +71,7 @@ func TestXEP0191_GetBlockList(t *testing.T) {
 	x, shutdownCh := New(nil, r, rtr)
 	defer close(shutdownCh)
 
-	storage.InsertBlockListItems([]model.BlockListItem{{
+	storage.InsertBlockListItems(context.Background(), []model.BlockListItem{{
 		Username: "ortuman",
 		JID:      "hamlet@jackal.im/garden",
 	}, {
@@ -141,7 +142,7 @@ func TestXEP191_BlockAndUnblock(t *testing.T) {
 	stm1.Context().SetBool(true, xep191RequestedContextKey)
 	stm2.Context().SetBool(true, xep191RequestedContextKey)
 
-	storage.InsertOrUpdateRosterItem(&rostermodel.Item{
+	storage.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{
 		Username:     "ortuman",
 		JID:          "romeo@jackal.im",
 		Subscription: "both",
@@ -205,7 +206,7 @@ func TestXEP191_BlockAndUnblock(t *testing.T) {
 	require.Equal(t, xmpp.SetType, elem.Type())
 
 	// check storage
-	bl, _ := storage.FetchBlockListItems("ortuman")
+	bl, _ := storage.FetchBlockListItems(context.Background(), "ortuman")
 	require.NotNil(t, bl)
 	require.Equal(t, 1, len(bl))
 	require.Equal(t, "jackal.im/jail", bl[0].JID)
@@ -251,7 +252,7 @@ func TestXEP191_BlockAndUnblock(t *testing.T) {
 	require.NotNil(t, item2)
 
 	// test full unblock
-	storage.InsertBlockListItems([]model.BlockListItem{{
+	storage.InsertBlockListItems(context.Background(), []model.BlockListItem{{
 		Username: "ortuman",
 		JID:      "hamlet@jackal.im/garden",
 	}, {
@@ -270,7 +271,7 @@ func TestXEP191_BlockAndUnblock(t *testing.T) {
 
 	time.Sleep(time.Millisecond * 150) // wait until processed...
 
-	blItms, _ := storage.FetchBlockListItems("ortuman")
+	blItms, _ := storage.FetchBlockListItems(context.Background(), "ortuman")
 	require.Equal(t, 0, len(blItms))
 }
 
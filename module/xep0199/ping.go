@@ -11,6 +11,7 @@ import (
 
 	"github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/actor"
 	"github.com/ortuman/jackal/module/xep0030"
 	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
@@ -20,6 +21,8 @@ import (
 
 const mailboxSize = 2048
 
+var logger = log.WithFields(log.Fields{"module": "ping"})
+
 const pingNamespace = "urn:xmpp:ping"
 
 // Config represents XMPP Ping module (XEP-0199) configuration.
@@ -87,7 +90,7 @@ func (x *Ping) MatchesIQ(iq *xmpp.IQ) bool {
 
 // ProcessIQ processes a ping IQ taking according actions
 // over the associated stream.
-func (x *Ping) ProcessIQ(iq *xmpp.IQ, stm stream.C2S) {
+func (x *Ping) ProcessIQ(iq *xmpp.IQ, stm stream.InOutStream) {
 	x.actorCh <- func() { x.processIQ(iq, stm) }
 }
 
@@ -109,6 +112,7 @@ func (x *Ping) loop() {
 		case f := <-x.actorCh:
 			f()
 		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
 			for _, pi := range x.pings {
 				pi.timer.Stop()
 			}
@@ -118,13 +122,13 @@ func (x *Ping) loop() {
 	}
 }
 
-func (x *Ping) processIQ(iq *xmpp.IQ, stm stream.C2S) {
+func (x *Ping) processIQ(iq *xmpp.IQ, stm stream.InOutStream) {
 	if x.isPongIQ(iq) {
 		x.handlePongIQ(iq, stm)
 		return
 	}
 	toJid := iq.ToJID()
-	if !toJid.IsServer() && toJid.Node() != stm.Username() {
+	if !toJid.IsServer() && !toJid.Matches(iq.FromJID(), jid.MatchesBare) {
 		stm.SendElement(iq.ForbiddenError())
 		return
 	}
@@ -133,9 +137,9 @@ func (x *Ping) processIQ(iq *xmpp.IQ, stm stream.C2S) {
 		stm.SendElement(iq.BadRequestError())
 		return
 	}
-	log.Infof("received ping... id: %s", iq.ID())
+	logger.Infof("received ping... id: %s", iq.ID())
 	if iq.IsGet() {
-		log.Infof("sent pong... id: %s", iq.ID())
+		logger.Infof("sent pong... id: %s", iq.ID())
 		stm.SendElement(iq.ResultIQ())
 	} else {
 		stm.SendElement(iq.BadRequestError())
@@ -184,13 +188,13 @@ func (x *Ping) schedulePingTimer(stm stream.C2S) {
 	x.pings[stm.JID().String()] = pi
 }
 
-func (x *Ping) handlePongIQ(iq *xmpp.IQ, stm stream.C2S) {
+func (x *Ping) handlePongIQ(iq *xmpp.IQ, stm stream.InOutStream) {
 	pongID := iq.ID()
 	if pi := x.activePings[pongID]; pi != nil && pi.stm == stm {
-		log.Infof("received pong... id: %s", pongID)
+		logger.Infof("received pong... id: %s", pongID)
 
 		pi.timer.Stop()
-		x.schedulePingTimer(stm)
+		x.schedulePingTimer(pi.stm)
 	}
 }
 
@@ -204,7 +208,7 @@ func (x *Ping) sendPing(pi *ping) {
 
 	pi.stm.SendElement(iq)
 
-	log.Infof("sent ping... id: %s", pi.identifier)
+	logger.Infof("sent ping... id: %s", pi.identifier)
 
 	pi.timer = time.AfterFunc(x.cfg.SendInterval/3, func() {
 		x.actorCh <- func() { x.disconnectStream(pi) }
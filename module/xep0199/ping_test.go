@@ -45,7 +45,7 @@ func TestXEP0199_ReceivePing(t *testing.T) {
 
 	iqID := uuid.New()
 	iq := xmpp.NewIQType(iqID, xmpp.SetType)
-	iq.SetFromJID(j2)
+	iq.SetFromJID(j1)
 	iq.SetToJID(j2)
 
 	x.ProcessIQ(iq, stm)
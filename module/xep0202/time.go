@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0202
+
+import (
+	"time"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/module/actor"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+const mailboxSize = 2048
+
+var logger = log.WithFields(log.Fields{"module": "time"})
+
+const (
+	timeNamespace       = "urn:xmpp:time"
+	legacyTimeNamespace = "jabber:iq:time"
+)
+
+const (
+	utcLayout       = "2006-01-02T15:04:05.000Z"
+	tzoLayout       = "-07:00"
+	legacyUTCLayout = "20060102T15:04:05"
+)
+
+// Time represents an entity time server stream module.
+type Time struct {
+	actorCh    chan func()
+	shutdownCh chan chan bool
+}
+
+// New returns an entity time IQ handler module.
+func New(disco *xep0030.DiscoInfo) (*Time, chan<- chan bool) {
+	x := &Time{
+		actorCh:    make(chan func(), mailboxSize),
+		shutdownCh: make(chan chan bool),
+	}
+	go x.loop()
+	if disco != nil {
+		disco.RegisterServerFeature(timeNamespace)
+		disco.RegisterServerFeature(legacyTimeNamespace)
+	}
+	return x, x.shutdownCh
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the entity time module.
+func (x *Time) MatchesIQ(iq *xmpp.IQ) bool {
+	if !iq.IsGet() || !iq.ToJID().IsServer() {
+		return false
+	}
+	return iq.Elements().ChildNamespace("time", timeNamespace) != nil ||
+		iq.Elements().ChildNamespace("query", legacyTimeNamespace) != nil
+}
+
+// ProcessIQ processes an entity time IQ taking according actions
+// over the associated stream.
+func (x *Time) ProcessIQ(iq *xmpp.IQ, stm stream.InOutStream) {
+	x.actorCh <- func() { x.processIQ(iq, stm) }
+}
+
+// runs on it's own goroutine
+func (x *Time) loop() {
+	for {
+		select {
+		case f := <-x.actorCh:
+			f()
+		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
+			c <- true
+			return
+		}
+	}
+}
+
+func (x *Time) processIQ(iq *xmpp.IQ, stm stream.InOutStream) {
+	now := time.Now()
+	if t := iq.Elements().ChildNamespace("time", timeNamespace); t != nil {
+		if t.Elements().Count() != 0 {
+			stm.SendElement(iq.BadRequestError())
+			return
+		}
+		x.sendTime(now, iq, stm)
+		return
+	}
+	q := iq.Elements().ChildNamespace("query", legacyTimeNamespace)
+	if q == nil || q.Elements().Count() != 0 {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	x.sendLegacyTime(now, iq, stm)
+}
+
+func (x *Time) sendTime(now time.Time, iq *xmpp.IQ, stm stream.InOutStream) {
+	logger.Infof("retrieving entity time (%s)", iq.FromJID().String())
+
+	t := xmpp.NewElementNamespace("time", timeNamespace)
+	tzo := xmpp.NewElementName("tzo")
+	tzo.SetText(now.Format(tzoLayout))
+	t.AppendElement(tzo)
+
+	utc := xmpp.NewElementName("utc")
+	utc.SetText(now.UTC().Format(utcLayout))
+	t.AppendElement(utc)
+
+	result := iq.ResultIQ()
+	result.AppendElement(t)
+	stm.SendElement(result)
+}
+
+// sendLegacyTime replies using deprecated XEP-0090 format,
+// still requested by some older clients.
+func (x *Time) sendLegacyTime(now time.Time, iq *xmpp.IQ, stm stream.InOutStream) {
+	logger.Infof("retrieving legacy entity time (%s)", iq.FromJID().String())
+
+	q := xmpp.NewElementNamespace("query", legacyTimeNamespace)
+	utc := xmpp.NewElementName("utc")
+	utc.SetText(now.UTC().Format(legacyUTCLayout))
+	q.AppendElement(utc)
+
+	tzName, _ := now.Zone()
+	tz := xmpp.NewElementName("tz")
+	tz.SetText(tzName)
+	q.AppendElement(tz)
+
+	display := xmpp.NewElementName("display")
+	display.SetText(now.Format(time.ANSIC))
+	q.AppendElement(display)
+
+	result := iq.ResultIQ()
+	result.AppendElement(q)
+	stm.SendElement(result)
+}
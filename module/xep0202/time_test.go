@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0202
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0202_Matching(t *testing.T) {
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	x, shutdownCh := New(nil)
+	defer close(shutdownCh)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(j)
+	iq.AppendElement(xmpp.NewElementNamespace("time", timeNamespace))
+	require.False(t, x.MatchesIQ(iq))
+
+	iq.SetToJID(srvJID)
+	require.True(t, x.MatchesIQ(iq))
+
+	iq.ClearElements()
+	iq.AppendElement(xmpp.NewElementNamespace("query", legacyTimeNamespace))
+	require.True(t, x.MatchesIQ(iq))
+
+	iq.SetType(xmpp.SetType)
+	require.False(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0202_Time(t *testing.T) {
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	x, shutdownCh := New(nil)
+	defer close(shutdownCh)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	tm := xmpp.NewElementNamespace("time", timeNamespace)
+	tm.AppendElement(xmpp.NewElementName("utc"))
+	iq.AppendElement(tm)
+
+	x.ProcessIQ(iq, stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ErrBadRequest.Error(), elem.Error().Elements().All()[0].Name())
+
+	tm.ClearElements()
+	x.ProcessIQ(iq, stm)
+	elem = stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	res := elem.Elements().ChildNamespace("time", timeNamespace)
+	require.NotNil(t, res)
+	utc, err := time.Parse(time.RFC3339, res.Elements().Child("utc").Text())
+	require.Nil(t, err)
+	require.True(t, time.Since(utc) < time.Minute)
+	require.Equal(t, time.Now().Format(tzoLayout), res.Elements().Child("tzo").Text())
+}
+
+func TestXEP0202_LegacyTime(t *testing.T) {
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	stm := stream.NewMockC2S("abcd", j)
+	defer stm.Disconnect(nil)
+
+	x, shutdownCh := New(nil)
+	defer close(shutdownCh)
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	iq.SetFromJID(j)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xmpp.NewElementNamespace("query", legacyTimeNamespace))
+
+	x.ProcessIQ(iq, stm)
+	elem := stm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	q := elem.Elements().ChildNamespace("query", legacyTimeNamespace)
+	require.NotNil(t, q)
+	utc, err := time.Parse(legacyUTCLayout, q.Elements().Child("utc").Text())
+	require.Nil(t, err)
+	require.True(t, time.Since(utc) < time.Minute)
+	require.NotNil(t, q.Elements().Child("tz"))
+	require.NotEqual(t, "", q.Elements().Child("display").Text())
+}
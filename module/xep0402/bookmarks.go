@@ -0,0 +1,353 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0402
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/module/actor"
+	"github.com/ortuman/jackal/module/xep0030"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const mailboxSize = 2048
+
+var logger = log.WithFields(log.Fields{"module": "bookmarks"})
+
+const (
+	bookmarksNamespace           = "urn:xmpp:bookmarks:1"
+	bookmarksCompatNamespace     = "urn:xmpp:bookmarks:1#compat"
+	bookmarksConversionNamespace = "urn:xmpp:bookmarks-conversion:0"
+	pubSubNamespace              = "http://jabber.org/protocol/pubsub"
+	pubSubEventNamespace         = "http://jabber.org/protocol/pubsub#event"
+)
+
+// Bookmarks represents a conference bookmarks server stream module.
+// Bookmarks are natively stored and served both through the
+// urn:xmpp:bookmarks:1 PEP node and storage:bookmarks private XML,
+// so that any change made through one of them is visible through the other.
+type Bookmarks struct {
+	router     *router.Router
+	actorCh    chan func()
+	shutdownCh chan chan bool
+}
+
+// New returns a bookmarks IQ handler module.
+func New(disco *xep0030.DiscoInfo, router *router.Router) (*Bookmarks, chan<- chan bool) {
+	x := &Bookmarks{
+		router:     router,
+		actorCh:    make(chan func(), mailboxSize),
+		shutdownCh: make(chan chan bool),
+	}
+	go x.loop()
+	if disco != nil {
+		disco.RegisterAccountFeature(bookmarksCompatNamespace)
+		disco.RegisterAccountFeature(bookmarksConversionNamespace)
+	}
+	return x, x.shutdownCh
+}
+
+// MatchesIQ returns whether or not an IQ should be
+// processed by the bookmarks module.
+func (x *Bookmarks) MatchesIQ(iq *xmpp.IQ) bool {
+	pubSub := iq.Elements().ChildNamespace("pubsub", pubSubNamespace)
+	if pubSub == nil {
+		return false
+	}
+	var elem xmpp.XElement
+	switch {
+	case iq.IsGet():
+		elem = pubSub.Elements().Child("items")
+	case iq.IsSet():
+		if elem = pubSub.Elements().Child("publish"); elem == nil {
+			elem = pubSub.Elements().Child("retract")
+		}
+	}
+	return elem != nil && elem.Attributes().Get("node") == bookmarksNamespace
+}
+
+// ProcessIQ processes a bookmarks IQ taking according actions
+// over the associated stream.
+func (x *Bookmarks) ProcessIQ(iq *xmpp.IQ, stm stream.C2S) {
+	x.actorCh <- func() { x.processIQ(iq, stm) }
+}
+
+// runs on it's own goroutine
+func (x *Bookmarks) loop() {
+	for {
+		select {
+		case f := <-x.actorCh:
+			f()
+		case c := <-x.shutdownCh:
+			actor.Drain(x.actorCh)
+			c <- true
+			return
+		}
+	}
+}
+
+func (x *Bookmarks) processIQ(iq *xmpp.IQ, stm stream.C2S) {
+	toJID := iq.ToJID()
+	if toJID.IsServer() || toJID.Node() != stm.Username() {
+		stm.SendElement(iq.ForbiddenError())
+		return
+	}
+	if err := migrateLegacy(stm.Context(), stm.Username()); err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	pubSub := iq.Elements().ChildNamespace("pubsub", pubSubNamespace)
+	if iq.IsGet() {
+		x.getItems(pubSub.Elements().Child("items"), iq, stm)
+		return
+	}
+	if publish := pubSub.Elements().Child("publish"); publish != nil {
+		x.publishItem(publish, iq, stm)
+		return
+	}
+	x.retractItem(pubSub.Elements().Child("retract"), iq, stm)
+}
+
+func (x *Bookmarks) getItems(items xmpp.XElement, iq *xmpp.IQ, stm stream.C2S) {
+	bookmarks, err := storage.FetchBookmarks(stm.Context(), stm.Username())
+	if err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	// requested item identifiers, if any
+	ids := make(map[string]bool)
+	for _, item := range items.Elements().Children("item") {
+		ids[item.Attributes().Get("id")] = true
+	}
+	resItems := xmpp.NewElementName("items")
+	resItems.SetAttribute("node", bookmarksNamespace)
+	for _, b := range bookmarks {
+		if len(ids) > 0 && !ids[b.JID] {
+			continue
+		}
+		resItems.AppendElement(bookmarkItem(&b))
+	}
+	pubSub := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	pubSub.AppendElement(resItems)
+
+	result := iq.ResultIQ()
+	result.AppendElement(pubSub)
+	stm.SendElement(result)
+}
+
+func (x *Bookmarks) publishItem(publish xmpp.XElement, iq *xmpp.IQ, stm stream.C2S) {
+	item := publish.Elements().Child("item")
+	if item == nil {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	conference := item.Elements().ChildNamespace("conference", bookmarksNamespace)
+	if conference == nil {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	roomJID, err := jid.NewWithString(item.Attributes().Get("id"), false)
+	if err != nil || !roomJID.IsBare() || len(roomJID.Node()) == 0 {
+		stm.SendElement(iq.JidMalformedError())
+		return
+	}
+	b := &model.Bookmark{
+		Username: stm.Username(),
+		JID:      roomJID.String(),
+		Name:     conference.Attributes().Get("name"),
+		Autojoin: isTrue(conference.Attributes().Get("autojoin")),
+	}
+	if nick := conference.Elements().Child("nick"); nick != nil {
+		b.Nick = nick.Text()
+	}
+	if password := conference.Elements().Child("password"); password != nil {
+		b.Password = password.Text()
+	}
+	if err := storage.InsertOrUpdateBookmark(stm.Context(), b); err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	logger.Infof("published bookmark: %s (%s/%s)", b.JID, stm.Username(), stm.Resource())
+
+	resItem := xmpp.NewElementName("item")
+	resItem.SetAttribute("id", b.JID)
+	resPublish := xmpp.NewElementName("publish")
+	resPublish.SetAttribute("node", bookmarksNamespace)
+	resPublish.AppendElement(resItem)
+	pubSub := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	pubSub.AppendElement(resPublish)
+
+	result := iq.ResultIQ()
+	result.AppendElement(pubSub)
+	stm.SendElement(result)
+
+	x.notify(stm.JID(), []model.Bookmark{*b}, nil)
+}
+
+func (x *Bookmarks) retractItem(retract xmpp.XElement, iq *xmpp.IQ, stm stream.C2S) {
+	item := retract.Elements().Child("item")
+	if item == nil {
+		stm.SendElement(iq.BadRequestError())
+		return
+	}
+	id := item.Attributes().Get("id")
+	if err := storage.DeleteBookmark(stm.Context(), stm.Username(), id); err != nil {
+		logger.Error(err)
+		stm.SendElement(iq.InternalServerError())
+		return
+	}
+	logger.Infof("retracted bookmark: %s (%s/%s)", id, stm.Username(), stm.Resource())
+
+	stm.SendElement(iq.ResultIQ())
+
+	x.notify(stm.JID(), nil, []string{id})
+}
+
+// PrivateStorage returns the storage:bookmarks private XML representation
+// of a user bookmarks, keeping any URL bookmark previously stored by legacy clients.
+func (x *Bookmarks) PrivateStorage(ctx context.Context, username string) (xmpp.XElement, error) {
+	if err := migrateLegacy(ctx, username); err != nil {
+		return nil, err
+	}
+	bookmarks, err := storage.FetchBookmarks(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	elems, err := storage.FetchPrivateXML(ctx, legacyBookmarksNamespace, username)
+	if err != nil {
+		return nil, err
+	}
+	st := xmpp.NewElementNamespace("storage", legacyBookmarksNamespace)
+	for _, b := range bookmarks {
+		st.AppendElement(b.ConferenceElement())
+	}
+	for _, elem := range elems {
+		st.AppendElements(elem.Elements().Children("url"))
+	}
+	return st, nil
+}
+
+// SetPrivateStorage replaces a user bookmarks with the ones contained into
+// a storage:bookmarks private XML element, notifying any change to the user resources.
+func (x *Bookmarks) SetPrivateStorage(ctx context.Context, userJID *jid.JID, st xmpp.XElement) error {
+	username := userJID.Node()
+	current, err := storage.FetchBookmarks(ctx, username)
+	if err != nil {
+		return err
+	}
+	var updated []model.Bookmark
+	retained := make(map[string]bool)
+	for _, conference := range st.Elements().Children("conference") {
+		b, ok := bookmarkFromLegacyConference(username, conference)
+		if !ok {
+			continue
+		}
+		retained[b.JID] = true
+		if isStored(current, b) {
+			continue
+		}
+		if err := storage.InsertOrUpdateBookmark(ctx, b); err != nil {
+			return err
+		}
+		updated = append(updated, *b)
+	}
+	var retracted []string
+	for _, b := range current {
+		if retained[b.JID] {
+			continue
+		}
+		if err := storage.DeleteBookmark(ctx, username, b.JID); err != nil {
+			return err
+		}
+		retracted = append(retracted, b.JID)
+	}
+	// URL bookmarks have no PEP counterpart
+	urls := xmpp.NewElementNamespace("storage", legacyBookmarksNamespace)
+	urls.AppendElements(st.Elements().Children("url"))
+	if err := storage.InsertOrUpdatePrivateXML(ctx, []xmpp.XElement{urls}, legacyBookmarksNamespace, username); err != nil {
+		return err
+	}
+	x.notify(userJID, updated, retracted)
+	return nil
+}
+
+// notify sends a PEP event notification to every user resource
+// in case any bookmark has been published or retracted.
+func (x *Bookmarks) notify(userJID *jid.JID, updated []model.Bookmark, retracted []string) {
+	if len(updated) == 0 && len(retracted) == 0 {
+		return
+	}
+	items := xmpp.NewElementName("items")
+	items.SetAttribute("node", bookmarksNamespace)
+	for _, b := range updated {
+		items.AppendElement(bookmarkItem(&b))
+	}
+	for _, id := range retracted {
+		retract := xmpp.NewElementName("retract")
+		retract.SetAttribute("id", id)
+		items.AppendElement(retract)
+	}
+	event := xmpp.NewElementNamespace("event", pubSubEventNamespace)
+	event.AppendElement(items)
+
+	for _, stm := range x.router.UserStreams(userJID.Node()) {
+		if stm.Domain() != userJID.Domain() {
+			continue
+		}
+		msg := xmpp.NewMessageType(uuid.New(), xmpp.HeadlineType)
+		msg.SetFromJID(userJID.ToBareJID())
+		msg.SetToJID(stm.JID())
+		msg.AppendElement(event)
+		stm.SendElement(msg)
+	}
+}
+
+func bookmarkItem(b *model.Bookmark) xmpp.XElement {
+	conference := xmpp.NewElementNamespace("conference", bookmarksNamespace)
+	if len(b.Name) > 0 {
+		conference.SetAttribute("name", b.Name)
+	}
+	if b.Autojoin {
+		conference.SetAttribute("autojoin", "true")
+	}
+	if len(b.Nick) > 0 {
+		nick := xmpp.NewElementName("nick")
+		nick.SetText(b.Nick)
+		conference.AppendElement(nick)
+	}
+	if len(b.Password) > 0 {
+		password := xmpp.NewElementName("password")
+		password.SetText(b.Password)
+		conference.AppendElement(password)
+	}
+	item := xmpp.NewElementName("item")
+	item.SetAttribute("id", b.JID)
+	item.AppendElement(conference)
+	return item
+}
+
+func isStored(bookmarks []model.Bookmark, b *model.Bookmark) bool {
+	for _, stored := range bookmarks {
+		if stored == *b {
+			return true
+		}
+	}
+	return false
+}
+
+func isTrue(s string) bool {
+	return s == "true" || s == "1"
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0402
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXEP0402_Matching(t *testing.T) {
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+
+	x, shutdownCh := New(nil, nil)
+	defer close(shutdownCh)
+
+	require.True(t, x.MatchesIQ(tUtilPubSubIQ(j, xmpp.GetType, "items", nil)))
+	require.True(t, x.MatchesIQ(tUtilPubSubIQ(j, xmpp.SetType, "publish", tUtilConferenceItem("room@conference.jackal.im", "Room"))))
+	require.True(t, x.MatchesIQ(tUtilPubSubIQ(j, xmpp.SetType, "retract", tUtilItem("room@conference.jackal.im"))))
+	require.False(t, x.MatchesIQ(tUtilPubSubIQ(j, xmpp.SetType, "items", nil)))
+
+	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
+	items := xmpp.NewElementName("items")
+	items.SetAttribute("node", "urn:xmpp:avatar:data")
+	pubSub := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	pubSub.AppendElement(items)
+	iq.AppendElement(pubSub)
+	require.False(t, x.MatchesIQ(iq))
+}
+
+func TestXEP0402_PublishAndRetract(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j1, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	j2, _ := jid.New("ortuman", "jackal.im", "garden", true)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	defer stm1.Disconnect(nil)
+	defer stm2.Disconnect(nil)
+	r.Bind(stm1)
+	r.Bind(stm2)
+
+	x, shutdownCh := New(nil, r)
+	defer close(shutdownCh)
+
+	// only account owner is allowed
+	j3, _ := jid.New("noelia", "jackal.im", "balcony", true)
+	iq := tUtilPubSubIQ(j1, xmpp.GetType, "items", nil)
+	iq.SetToJID(j3.ToBareJID())
+	x.ProcessIQ(iq, stm1)
+	elem := stm1.FetchElement()
+	require.Equal(t, xmpp.ErrForbidden.Error(), elem.Error().Elements().All()[0].Name())
+
+	// malformed room JID
+	x.ProcessIQ(tUtilPubSubIQ(j1, xmpp.SetType, "publish", tUtilConferenceItem("conference.jackal.im", "Room")), stm1)
+	elem = stm1.FetchElement()
+	require.Equal(t, xmpp.ErrJidMalformed.Error(), elem.Error().Elements().All()[0].Name())
+
+	x.ProcessIQ(tUtilPubSubIQ(j1, xmpp.SetType, "publish", tUtilConferenceItem("room@conference.jackal.im", "Room")), stm1)
+	elem = stm1.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	// every user resource gets notified
+	for _, stm := range []*stream.MockC2S{stm1, stm2} {
+		elem = stm.FetchElement()
+		require.Equal(t, "message", elem.Name())
+		items := elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("items")
+		require.Equal(t, bookmarksNamespace, items.Attributes().Get("node"))
+		require.Equal(t, "room@conference.jackal.im", items.Elements().Child("item").Attributes().Get("id"))
+	}
+	bookmarks, _ := storage.FetchBookmarks(context.Background(), "ortuman")
+	require.Equal(t, 1, len(bookmarks))
+	require.Equal(t, "Room", bookmarks[0].Name)
+	require.True(t, bookmarks[0].Autojoin)
+	require.Equal(t, "ortuman", bookmarks[0].Nick)
+
+	x.ProcessIQ(tUtilPubSubIQ(j1, xmpp.GetType, "items", nil), stm1)
+	elem = stm1.FetchElement()
+	items := elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("items")
+	require.Equal(t, 1, items.Elements().Count())
+	conference := items.Elements().Child("item").Elements().ChildNamespace("conference", bookmarksNamespace)
+	require.NotNil(t, conference)
+	require.Equal(t, "ortuman", conference.Elements().Child("nick").Text())
+
+	x.ProcessIQ(tUtilPubSubIQ(j1, xmpp.SetType, "retract", tUtilItem("room@conference.jackal.im")), stm1)
+	elem = stm1.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+
+	elem = stm2.FetchElement()
+	retract := elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("items").Elements().Child("retract")
+	require.Equal(t, "room@conference.jackal.im", retract.Attributes().Get("id"))
+
+	bookmarks, _ = storage.FetchBookmarks(context.Background(), "ortuman")
+	require.Equal(t, 0, len(bookmarks))
+}
+
+func TestXEP0402_PrivateStorage(t *testing.T) {
+	r, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	j, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	stm := stream.NewMockC2S(uuid.New(), j)
+	defer stm.Disconnect(nil)
+	r.Bind(stm)
+
+	x, shutdownCh := New(nil, r)
+	defer close(shutdownCh)
+
+	// legacy client stores bookmarks
+	st := xmpp.NewElementNamespace("storage", legacyBookmarksNamespace)
+	st.AppendElement((&model.Bookmark{JID: "room1@conference.jackal.im", Name: "Room 1", Autojoin: true}).ConferenceElement())
+	st.AppendElement((&model.Bookmark{JID: "room2@conference.jackal.im", Nick: "ortuman"}).ConferenceElement())
+	url := xmpp.NewElementName("url")
+	url.SetAttribute("url", "https://jackal.im")
+	st.AppendElement(url)
+	require.Nil(t, x.SetPrivateStorage(context.Background(), j, st))
+
+	elem := stm.FetchElement()
+	items := elem.Elements().ChildNamespace("event", pubSubEventNamespace).Elements().Child("items")
+	require.Equal(t, 2, len(items.Elements().Children("item")))
+
+	// bookmarks are visible through PEP
+	x.ProcessIQ(tUtilPubSubIQ(j, xmpp.GetType, "items", nil), stm)
+	elem = stm.FetchElement()
+	items = elem.Elements().ChildNamespace("pubsub", pubSubNamespace).Elements().Child("items")
+	require.Equal(t, 2, len(items.Elements().Children("item")))
+
+	// PEP changes are visible through private XML
+	x.ProcessIQ(tUtilPubSubIQ(j, xmpp.SetType, "retract", tUtilItem("room2@conference.jackal.im")), stm)
+	_ = stm.FetchElement()
+	_ = stm.FetchElement()
+
+	elem, err := x.PrivateStorage(context.Background(), "ortuman")
+	require.Nil(t, err)
+	conferences := elem.Elements().Children("conference")
+	require.Equal(t, 1, len(conferences))
+	require.Equal(t, "room1@conference.jackal.im", conferences[0].Attributes().Get("jid"))
+	require.Equal(t, "true", conferences[0].Attributes().Get("autojoin"))
+	require.Equal(t, 1, len(elem.Elements().Children("url")))
+
+	// unchanged bookmarks are not notified
+	st = xmpp.NewElementNamespace("storage", legacyBookmarksNamespace)
+	st.AppendElement(conferences[0])
+	require.Nil(t, x.SetPrivateStorage(context.Background(), j, st))
+
+	elem, err = x.PrivateStorage(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(elem.Elements().Children("conference")))
+	require.Equal(t, 0, len(elem.Elements().Children("url")))
+
+	stm.SendElement(xmpp.NewElementName("marker"))
+	require.Equal(t, "marker", stm.FetchElement().Name())
+}
+
+func TestXEP0402_MigrateLegacy(t *testing.T) {
+	_, _, shutdown := setupTest("jackal.im")
+	defer shutdown()
+
+	st := xmpp.NewElementNamespace("storage", legacyBookmarksNamespace)
+	st.AppendElement((&model.Bookmark{JID: "room@conference.jackal.im", Name: "Room"}).ConferenceElement())
+	url := xmpp.NewElementName("url")
+	url.SetAttribute("url", "https://jackal.im")
+	st.AppendElement(url)
+	_ = storage.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{st}, legacyBookmarksNamespace, "ortuman")
+
+	require.Nil(t, migrateLegacy(context.Background(), "ortuman"))
+
+	bookmarks, _ := storage.FetchBookmarks(context.Background(), "ortuman")
+	require.Equal(t, 1, len(bookmarks))
+	require.Equal(t, "Room", bookmarks[0].Name)
+
+	elems, _ := storage.FetchPrivateXML(context.Background(), legacyBookmarksNamespace, "ortuman")
+	require.Equal(t, 1, len(elems))
+	require.Equal(t, 0, len(elems[0].Elements().Children("conference")))
+	require.Equal(t, 1, len(elems[0].Elements().Children("url")))
+}
+
+func tUtilItem(id string) *xmpp.Element {
+	item := xmpp.NewElementName("item")
+	item.SetAttribute("id", id)
+	return item
+}
+
+func tUtilConferenceItem(id, name string) xmpp.XElement {
+	conference := xmpp.NewElementNamespace("conference", bookmarksNamespace)
+	conference.SetAttribute("name", name)
+	conference.SetAttribute("autojoin", "true")
+	conference.AppendElement(xmpp.NewElementName("nick").SetText("ortuman"))
+
+	item := tUtilItem(id)
+	item.AppendElement(conference)
+	return item
+}
+
+func tUtilPubSubIQ(j *jid.JID, typ, action string, item xmpp.XElement) *xmpp.IQ {
+	iq := xmpp.NewIQType(uuid.New(), typ)
+	iq.SetFromJID(j)
+	iq.SetToJID(j.ToBareJID())
+
+	elem := xmpp.NewElementName(action)
+	elem.SetAttribute("node", bookmarksNamespace)
+	if item != nil {
+		elem.AppendElement(item)
+	}
+	pubSub := xmpp.NewElementNamespace("pubsub", pubSubNamespace)
+	pubSub.AppendElement(elem)
+	iq.AppendElement(pubSub)
+	return iq
+}
+
+func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
+	})
+	s := memstorage.New()
+	storage.Set(s)
+	return r, s, func() {
+		storage.Unset()
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xep0402
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const legacyBookmarksNamespace = "storage:bookmarks"
+
+// migrateLegacy moves into native storage any conference bookmark stored
+// as private XML before the module was enabled, keeping URL bookmarks in place.
+func migrateLegacy(ctx context.Context, username string) error {
+	elems, err := storage.FetchPrivateXML(ctx, legacyBookmarksNamespace, username)
+	if err != nil {
+		return err
+	}
+	var conferences, urls []xmpp.XElement
+	for _, elem := range elems {
+		conferences = append(conferences, elem.Elements().Children("conference")...)
+		urls = append(urls, elem.Elements().Children("url")...)
+	}
+	if len(conferences) == 0 {
+		return nil
+	}
+	for _, conference := range conferences {
+		b, ok := bookmarkFromLegacyConference(username, conference)
+		if !ok {
+			continue
+		}
+		if err := storage.InsertOrUpdateBookmark(ctx, b); err != nil {
+			return err
+		}
+	}
+	st := xmpp.NewElementNamespace("storage", legacyBookmarksNamespace)
+	st.AppendElements(urls)
+	return storage.InsertOrUpdatePrivateXML(ctx, []xmpp.XElement{st}, legacyBookmarksNamespace, username)
+}
+
+func bookmarkFromLegacyConference(username string, conference xmpp.XElement) (*model.Bookmark, bool) {
+	roomJID, err := jid.NewWithString(conference.Attributes().Get("jid"), false)
+	if err != nil || len(roomJID.Node()) == 0 {
+		return nil, false
+	}
+	b := &model.Bookmark{
+		Username: username,
+		JID:      roomJID.ToBareJID().String(),
+		Name:     conference.Attributes().Get("name"),
+		Autojoin: isTrue(conference.Attributes().Get("autojoin")),
+	}
+	if nick := conference.Elements().Child("nick"); nick != nil {
+		b.Nick = nick.Text()
+	}
+	if password := conference.Elements().Child("password"); password != nil {
+		b.Password = password.Text()
+	}
+	return b, true
+}
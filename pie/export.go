@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pie
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+// Export writes to w the XEP-0227 representation of the accounts hosted under domain.
+// Only the specified usernames will be exported, or every account if none was specified.
+// Returns the number of exported accounts.
+func Export(ctx context.Context, w io.Writer, s storage.Storage, domain string, usernames ...string) (int, error) {
+	if len(usernames) == 0 {
+		var err error
+		if usernames, err = s.FetchUsernames(ctx); err != nil {
+			return 0, err
+		}
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(bw, `<server-data xmlns="%s">`+"\n", pieNamespace)
+	bw.WriteString(`<host jid="`)
+	xml.EscapeText(bw, []byte(domain))
+	bw.WriteString(`">` + "\n")
+
+	var count int
+	for _, username := range usernames {
+		acc, err := fetchAccount(ctx, s, username)
+		if err != nil {
+			return count, err
+		}
+		if acc == nil {
+			return count, fmt.Errorf("pie: user not found: %s", username)
+		}
+		acc.element().ToXML(bw, true)
+		bw.WriteString("\n")
+		count++
+	}
+	bw.WriteString("</host>\n</server-data>\n")
+	return count, bw.Flush()
+}
+
+func (acc *account) element() xmpp.XElement {
+	user := xmpp.NewElementName("user")
+	user.SetAttribute("name", acc.user.Username)
+	user.SetAttribute("password", acc.user.Password)
+
+	if len(acc.rosterItems) > 0 {
+		query := xmpp.NewElementNamespace("query", rosterNamespace)
+		for _, ri := range acc.rosterItems {
+			query.AppendElement(ri.Element())
+		}
+		user.AppendElement(query)
+	}
+	// pending subscription requests
+	for _, rn := range acc.rosterNotifications {
+		user.AppendElement(rn.Presence)
+	}
+	if acc.vCard != nil {
+		user.AppendElement(acc.vCard)
+	}
+	if len(acc.privateNamespaces) > 0 || len(acc.bookmarks) > 0 {
+		query := xmpp.NewElementNamespace("query", privateNamespace)
+		for _, namespace := range acc.privateNamespaces {
+			if namespace != bookmarksNamespace {
+				query.AppendElements(acc.privateXML[namespace])
+			}
+		}
+		if st := acc.bookmarksElement(); st != nil {
+			query.AppendElement(st)
+		}
+		user.AppendElement(query)
+	}
+	if len(acc.blockListItems) > 0 {
+		blockList := xmpp.NewElementNamespace("blocklist", blockingCommandNamespace)
+		for _, bli := range acc.blockListItems {
+			item := xmpp.NewElementName("item")
+			item.SetAttribute("jid", bli.JID)
+			blockList.AppendElement(item)
+		}
+		user.AppendElement(blockList)
+	}
+	if len(acc.offlineMessages) > 0 {
+		offlineMessages := xmpp.NewElementName("offline-messages")
+		for _, om := range acc.offlineMessages {
+			offlineMessages.AppendElement(om.Message)
+		}
+		user.AppendElement(offlineMessages)
+	}
+	return user
+}
+
+// bookmarksElement merges natively stored conference bookmarks into
+// the legacy private XML storage, which is where XEP-0227 expects them.
+func (acc *account) bookmarksElement() xmpp.XElement {
+	elems := acc.privateXML[bookmarksNamespace]
+	if len(elems) == 0 && len(acc.bookmarks) == 0 {
+		return nil
+	}
+	st := xmpp.NewElementNamespace("storage", bookmarksNamespace)
+	for _, elem := range elems {
+		st.AppendElements(elem.Elements().All())
+	}
+	for _, b := range acc.bookmarks {
+		st.AppendElement(b.ConferenceElement())
+	}
+	return st
+}
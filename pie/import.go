@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+)
+
+const delayNamespace = "urn:xmpp:delay"
+
+// Import reads a XEP-0227 document from r storing every contained account,
+// returning the number of imported accounts.
+func Import(ctx context.Context, r io.Reader, s storage.Storage) (int, error) {
+	p := xmpp.NewParser(r, xmpp.DefaultMode, 0)
+
+	var root xmpp.XElement
+	for root == nil {
+		var err error
+		if root, err = p.ParseElement(); err != nil {
+			return 0, err
+		}
+	}
+	if root.Name() != "server-data" || root.Namespace() != pieNamespace {
+		return 0, errors.New("pie: invalid server-data element")
+	}
+	var count int
+	for _, host := range root.Elements().Children("host") {
+		domain := host.Attributes().Get("jid")
+		if len(domain) == 0 {
+			return count, errors.New("pie: host 'jid' attribute is required")
+		}
+		for _, user := range host.Elements().Children("user") {
+			acc, err := parseAccount(user, domain)
+			if err != nil {
+				return count, err
+			}
+			if err := storeAccount(ctx, s, acc); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+func parseAccount(user xmpp.XElement, domain string) (*account, error) {
+	username := user.Attributes().Get("name")
+	userJID, err := jid.New(username, domain, "", false)
+	if err != nil || len(username) == 0 {
+		return nil, fmt.Errorf("pie: invalid user name: %s", username)
+	}
+	acc := &account{
+		user: &model.User{
+			Username:     username,
+			Password:     user.Attributes().Get("password"),
+			LastPresence: xmpp.NewPresence(userJID, userJID, xmpp.UnavailableType),
+		},
+		privateXML: make(map[string][]xmpp.XElement),
+	}
+	for _, elem := range user.Elements().All() {
+		switch {
+		case elem.Name() == "query" && elem.Namespace() == rosterNamespace:
+			for _, item := range elem.Elements().Children("item") {
+				ri, err := rostermodel.NewItem(item)
+				if err != nil {
+					return nil, fmt.Errorf("pie: %s: %v", username, err)
+				}
+				ri.Username = username
+				acc.rosterItems = append(acc.rosterItems, *ri)
+			}
+
+		case elem.Name() == "presence" && elem.Type() == xmpp.SubscribeType:
+			fromJID, err := jid.NewWithString(elem.From(), false)
+			if err != nil {
+				return nil, fmt.Errorf("pie: %s: %v", username, err)
+			}
+			presence, err := xmpp.NewPresenceFromElement(elem, fromJID, userJID)
+			if err != nil {
+				return nil, fmt.Errorf("pie: %s: %v", username, err)
+			}
+			acc.rosterNotifications = append(acc.rosterNotifications, rostermodel.Notification{
+				Contact:  username,
+				JID:      fromJID.ToBareJID().String(),
+				Presence: presence,
+			})
+
+		case elem.Name() == "vCard" && elem.Namespace() == vCardNamespace:
+			acc.vCard = elem
+
+		case elem.Name() == "query" && elem.Namespace() == privateNamespace:
+			for _, prv := range elem.Elements().All() {
+				namespace := prv.Namespace()
+				if _, ok := acc.privateXML[namespace]; !ok {
+					acc.privateNamespaces = append(acc.privateNamespaces, namespace)
+				}
+				acc.privateXML[namespace] = append(acc.privateXML[namespace], prv)
+			}
+
+		case elem.Name() == "blocklist" && elem.Namespace() == blockingCommandNamespace:
+			for _, item := range elem.Elements().Children("item") {
+				j, err := jid.NewWithString(item.Attributes().Get("jid"), false)
+				if err != nil {
+					return nil, fmt.Errorf("pie: %s: %v", username, err)
+				}
+				acc.blockListItems = append(acc.blockListItems, model.BlockListItem{Username: username, JID: j.String()})
+			}
+
+		case elem.Name() == "offline-messages":
+			for _, msg := range elem.Elements().Children("message") {
+				om, err := parseOfflineMessage(msg, userJID)
+				if err != nil {
+					return nil, err
+				}
+				acc.offlineMessages = append(acc.offlineMessages, *om)
+			}
+		}
+	}
+	return acc, nil
+}
+
+func parseOfflineMessage(elem xmpp.XElement, userJID *jid.JID) (*model.OfflineMessage, error) {
+	username := userJID.Node()
+	fromJID, err := jid.NewWithString(elem.From(), false)
+	if err != nil {
+		return nil, fmt.Errorf("pie: %s: %v", username, err)
+	}
+	toJID, err := jid.NewWithString(elem.To(), false)
+	if err != nil {
+		return nil, fmt.Errorf("pie: %s: %v", username, err)
+	}
+	message, err := xmpp.NewMessageFromElement(elem, fromJID, toJID)
+	if err != nil {
+		return nil, fmt.Errorf("pie: %s: %v", username, err)
+	}
+	createdAt := time.Now()
+	if delay := elem.Elements().ChildNamespace("delay", delayNamespace); delay != nil {
+		if stamp, err := time.Parse(time.RFC3339, delay.Attributes().Get("stamp")); err == nil {
+			createdAt = stamp
+		}
+	}
+	// keep stanza ID (XEP-0359) so that clients can reference imported message
+	by := userJID.ToBareJID().String()
+	id := message.StanzaID(by)
+	if len(id) == 0 {
+		id = uuid.New()
+		message.SetStanzaID(by, id)
+	}
+	return &model.OfflineMessage{
+		ID:        id,
+		Username:  username,
+		Message:   message,
+		CreatedAt: createdAt,
+	}, nil
+}
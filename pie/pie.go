@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+// Package pie implements account data portability
+// by means of XEP-0227 (Portable Import/Export Format for XMPP-IM Servers).
+package pie
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+const (
+	pieNamespace             = "urn:xmpp:pie:0"
+	rosterNamespace          = "jabber:iq:roster"
+	vCardNamespace           = "vcard-temp"
+	privateNamespace         = "jabber:iq:private"
+	bookmarksNamespace       = "storage:bookmarks"
+	blockingCommandNamespace = "urn:xmpp:blocking"
+)
+
+// account holds the whole data set associated to a single user.
+type account struct {
+	user                *model.User
+	rosterItems         []rostermodel.Item
+	rosterNotifications []rostermodel.Notification
+	vCard               xmpp.XElement
+	privateNamespaces   []string
+	privateXML          map[string][]xmpp.XElement
+	blockListItems      []model.BlockListItem
+	offlineMessages     []model.OfflineMessage
+	bookmarks           []model.Bookmark
+}
+
+// Copy copies every account from src storage into dst storage,
+// returning the number of copied accounts.
+func Copy(ctx context.Context, dst, src storage.Storage) (int, error) {
+	usernames, err := src.FetchUsernames(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for _, username := range usernames {
+		acc, err := fetchAccount(ctx, src, username)
+		if err != nil {
+			return count, err
+		}
+		if acc == nil {
+			continue // deleted meanwhile
+		}
+		if err := storeAccount(ctx, dst, acc); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func fetchAccount(ctx context.Context, s storage.Storage, username string) (*account, error) {
+	user, err := s.FetchUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, nil
+	}
+	acc := &account{user: user, privateXML: make(map[string][]xmpp.XElement)}
+
+	if acc.rosterItems, _, err = s.FetchRosterItems(ctx, username); err != nil {
+		return nil, err
+	}
+	if acc.rosterNotifications, err = s.FetchRosterNotifications(ctx, username); err != nil {
+		return nil, err
+	}
+	if acc.vCard, err = s.FetchVCard(ctx, username); err != nil {
+		return nil, err
+	}
+	if acc.privateNamespaces, err = s.FetchPrivateXMLNamespaces(ctx, username); err != nil {
+		return nil, err
+	}
+	for _, namespace := range acc.privateNamespaces {
+		if acc.privateXML[namespace], err = s.FetchPrivateXML(ctx, namespace, username); err != nil {
+			return nil, err
+		}
+	}
+	if acc.blockListItems, err = s.FetchBlockListItems(ctx, username); err != nil {
+		return nil, err
+	}
+	if acc.offlineMessages, err = s.FetchOfflineMessages(ctx, username); err != nil {
+		return nil, err
+	}
+	if acc.bookmarks, err = s.FetchBookmarks(ctx, username); err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+func storeAccount(ctx context.Context, s storage.Storage, acc *account) error {
+	if err := s.InsertOrUpdateUser(ctx, acc.user); err != nil {
+		return err
+	}
+	for i := range acc.rosterItems {
+		if _, err := s.InsertOrUpdateRosterItem(ctx, &acc.rosterItems[i]); err != nil {
+			return err
+		}
+	}
+	for i := range acc.rosterNotifications {
+		if err := s.InsertOrUpdateRosterNotification(ctx, &acc.rosterNotifications[i]); err != nil {
+			return err
+		}
+	}
+	if acc.vCard != nil {
+		if err := s.InsertOrUpdateVCard(ctx, acc.vCard, acc.user.Username); err != nil {
+			return err
+		}
+	}
+	for _, namespace := range acc.privateNamespaces {
+		if err := s.InsertOrUpdatePrivateXML(ctx, acc.privateXML[namespace], namespace, acc.user.Username); err != nil {
+			return err
+		}
+	}
+	if len(acc.blockListItems) > 0 {
+		if err := s.InsertBlockListItems(ctx, acc.blockListItems); err != nil {
+			return err
+		}
+	}
+	for i := range acc.offlineMessages {
+		if err := s.InsertOfflineMessage(ctx, &acc.offlineMessages[i]); err != nil {
+			return err
+		}
+	}
+	for i := range acc.bookmarks {
+		if err := s.InsertOrUpdateBookmark(ctx, &acc.bookmarks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
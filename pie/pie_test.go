@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package pie
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPIE_ExportImport(t *testing.T) {
+	src := memstorage.New()
+	tUtilPIEPopulate(t, src)
+
+	buf := bytes.NewBuffer(nil)
+	n, err := Export(context.Background(), buf, src, "jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, 2, n)
+	require.True(t, strings.Contains(buf.String(), `<server-data xmlns="urn:xmpp:pie:0">`))
+
+	dst := memstorage.New()
+	n, err = Import(context.Background(), buf, dst)
+	require.Nil(t, err)
+	require.Equal(t, 2, n)
+
+	tUtilPIEVerify(t, dst)
+
+	oms, _ := dst.FetchOfflineMessages(context.Background(), "ortuman")
+	require.Equal(t, "om1", oms[0].ID) // stanza IDs are preserved
+
+	// conference bookmarks are imported as legacy private XML
+	prvs, _ := dst.FetchPrivateXML(context.Background(), bookmarksNamespace, "ortuman")
+	require.Equal(t, 1, len(prvs))
+	require.NotNil(t, prvs[0].Elements().Child("url"))
+	conference := prvs[0].Elements().Child("conference")
+	require.NotNil(t, conference)
+	require.Equal(t, "jdev@conference.jabber.org", conference.Attributes().Get("jid"))
+	require.Equal(t, "true", conference.Attributes().Get("autojoin"))
+
+	// single user
+	buf.Reset()
+	n, err = Export(context.Background(), buf, src, "jackal.im", "noelia")
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+	require.False(t, strings.Contains(buf.String(), `name="ortuman"`))
+
+	_, err = Export(context.Background(), buf, src, "jackal.im", "romeo")
+	require.NotNil(t, err)
+}
+
+func TestPIE_ImportOfflineStanzaID(t *testing.T) {
+	s := memstorage.New()
+	n, err := Import(context.Background(), strings.NewReader(`<server-data xmlns="urn:xmpp:pie:0"><host jid="jackal.im"><user name="ortuman" password="1234"><offline-messages><message from="romeo@example.org" to="ortuman@jackal.im"><body>Hi</body></message></offline-messages></user></host></server-data>`), s)
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+
+	// missing stanza ID gets assigned on import
+	oms, _ := s.FetchOfflineMessages(context.Background(), "ortuman")
+	require.Equal(t, 1, len(oms))
+	require.NotEqual(t, "", oms[0].ID)
+	require.Equal(t, oms[0].ID, oms[0].Message.StanzaID("ortuman@jackal.im"))
+}
+
+func TestPIE_ImportInvalid(t *testing.T) {
+	s := memstorage.New()
+	_, err := Import(context.Background(), strings.NewReader(`<server-data xmlns="urn:xmpp:pie:1"/>`), s)
+	require.NotNil(t, err)
+
+	_, err = Import(context.Background(), strings.NewReader(`<server-data xmlns="urn:xmpp:pie:0"><host><user name="ortuman"/></host></server-data>`), s)
+	require.NotNil(t, err)
+
+	_, err = Import(context.Background(), strings.NewReader(`<server-data xmlns="urn:xmpp:pie:0"><host jid="jackal.im"><user/></host></server-data>`), s)
+	require.NotNil(t, err)
+}
+
+func TestPIE_Copy(t *testing.T) {
+	src := memstorage.New()
+	tUtilPIEPopulate(t, src)
+
+	dst := memstorage.New()
+	n, err := Copy(context.Background(), dst, src)
+	require.Nil(t, err)
+	require.Equal(t, 2, n)
+
+	tUtilPIEVerify(t, dst)
+
+	oms, _ := dst.FetchOfflineMessages(context.Background(), "ortuman")
+	require.Equal(t, "om1", oms[0].ID) // identifiers are preserved
+
+	bookmarks, _ := dst.FetchBookmarks(context.Background(), "ortuman")
+	require.Equal(t, []model.Bookmark{{Username: "ortuman", JID: "jdev@conference.jabber.org", Name: "jdev", Autojoin: true}}, bookmarks)
+}
+
+func tUtilPIEPopulate(t *testing.T, s *memstorage.Storage) {
+	j1, _ := jid.New("ortuman", "jackal.im", "", true)
+	j2, _ := jid.New("noelia", "jackal.im", "", true)
+	j3, _ := jid.New("romeo", "example.org", "", true)
+
+	require.Nil(t, s.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"}))
+	require.Nil(t, s.InsertOrUpdateUser(context.Background(), &model.User{Username: "noelia", Password: "5678"}))
+
+	_, err := s.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{
+		Username:     "ortuman",
+		JID:          j2.String(),
+		Name:         "Noelia",
+		Subscription: rostermodel.SubscriptionBoth,
+		Groups:       []string{"Family"},
+	})
+	require.Nil(t, err)
+	require.Nil(t, s.InsertOrUpdateRosterNotification(context.Background(), &rostermodel.Notification{
+		Contact:  "ortuman",
+		JID:      j3.String(),
+		Presence: xmpp.NewPresence(j3, j1, xmpp.SubscribeType),
+	}))
+
+	vCard := xmpp.NewElementNamespace("vCard", vCardNamespace)
+	fn := xmpp.NewElementName("FN")
+	fn.SetText("Miguel Ángel")
+	vCard.AppendElement(fn)
+	require.Nil(t, s.InsertOrUpdateVCard(context.Background(), vCard, "ortuman"))
+
+	require.Nil(t, s.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{xmpp.NewElementNamespace("exodus", "exodus:ns")}, "exodus:ns", "ortuman"))
+	require.Nil(t, s.InsertBlockListItems(context.Background(), []model.BlockListItem{{Username: "ortuman", JID: "romeo@example.org"}}))
+
+	st := xmpp.NewElementNamespace("storage", bookmarksNamespace)
+	url := xmpp.NewElementName("url")
+	url.SetAttribute("url", "https://jackal.im")
+	st.AppendElement(url)
+	require.Nil(t, s.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{st}, bookmarksNamespace, "ortuman"))
+	require.Nil(t, s.InsertOrUpdateBookmark(context.Background(), &model.Bookmark{
+		Username: "ortuman",
+		JID:      "jdev@conference.jabber.org",
+		Name:     "jdev",
+		Autojoin: true,
+	}))
+
+	msg := xmpp.NewElementName("message")
+	msg.SetFrom(j3.String())
+	msg.SetTo(j1.String())
+	msg.Delay("example.org", "Offline Storage")
+	msg.SetStanzaID("ortuman@jackal.im", "om1")
+	message, _ := xmpp.NewMessageFromElement(msg, j3, j1)
+	require.Nil(t, s.InsertOfflineMessage(context.Background(), &model.OfflineMessage{
+		ID:        "om1",
+		Username:  "ortuman",
+		Message:   message,
+		CreatedAt: time.Now(),
+	}))
+}
+
+func tUtilPIEVerify(t *testing.T, s *memstorage.Storage) {
+	usr, _ := s.FetchUser(context.Background(), "ortuman")
+	require.NotNil(t, usr)
+	require.Equal(t, "1234", usr.Password)
+	usr, _ = s.FetchUser(context.Background(), "noelia")
+	require.NotNil(t, usr)
+	require.Equal(t, "5678", usr.Password)
+
+	ris, _, _ := s.FetchRosterItems(context.Background(), "ortuman")
+	require.Equal(t, 1, len(ris))
+	require.Equal(t, "noelia@jackal.im", ris[0].JID)
+	require.Equal(t, "Noelia", ris[0].Name)
+	require.Equal(t, rostermodel.SubscriptionBoth, ris[0].Subscription)
+	require.Equal(t, []string{"Family"}, ris[0].Groups)
+
+	rns, _ := s.FetchRosterNotifications(context.Background(), "ortuman")
+	require.Equal(t, 1, len(rns))
+	require.Equal(t, "romeo@example.org", rns[0].JID)
+
+	vCard, _ := s.FetchVCard(context.Background(), "ortuman")
+	require.NotNil(t, vCard)
+	require.Equal(t, "Miguel Ángel", vCard.Elements().Child("FN").Text())
+
+	prvs, _ := s.FetchPrivateXML(context.Background(), "exodus:ns", "ortuman")
+	require.Equal(t, 1, len(prvs))
+
+	bl, _ := s.FetchBlockListItems(context.Background(), "ortuman")
+	require.Equal(t, []model.BlockListItem{{Username: "ortuman", JID: "romeo@example.org"}}, bl)
+
+	oms, _ := s.FetchOfflineMessages(context.Background(), "ortuman")
+	require.Equal(t, 1, len(oms))
+	require.Equal(t, "romeo@example.org", oms[0].Message.From())
+	require.NotNil(t, oms[0].Message.Elements().ChildNamespace("delay", delayNamespace))
+}
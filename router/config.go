@@ -23,11 +23,13 @@ type tlsConfig struct {
 type HostConfig struct {
 	Name        string
 	Certificate tls.Certificate
+	Admins      []string
 }
 
 type hostConfigProxy struct {
-	Name string    `yaml:"name"`
-	TLS  tlsConfig `yaml:"tls"`
+	Name   string    `yaml:"name"`
+	TLS    tlsConfig `yaml:"tls"`
+	Admins []string  `yaml:"admins"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -37,6 +39,7 @@ func (c *HostConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 	c.Name = p.Name
+	c.Admins = p.Admins
 	cer, err := util.LoadCertificate(p.TLS.PrivKeyFile, p.TLS.CertFile, c.Name)
 	if err != nil {
 		return err
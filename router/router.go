@@ -6,6 +6,7 @@
 package router
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"sync"
@@ -13,9 +14,11 @@ import (
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/storage"
 	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/trace"
 	"github.com/ortuman/jackal/util"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
 )
 
 const defaultDomain = "localhost"
@@ -48,11 +51,31 @@ type S2SOutProvider interface {
 	GetS2SOut(localDomain, remoteDomain string) (stream.S2SOut, error)
 }
 
+// Cluster shares c2s stream bindings among all nodes serving the same domains.
+type Cluster interface {
+	// BindStream shares a locally bound stream with the rest of the cluster nodes.
+	BindStream(stm stream.C2S)
+
+	// UnbindStream notifies the rest of the cluster nodes that a local stream has been unbound.
+	UnbindStream(stm stream.C2S)
+
+	// UpdatePresence propagates a local stream presence change.
+	UpdatePresence(stm stream.C2S)
+
+	// UserStreams returns all user streams bound to any other cluster node.
+	UserStreams(username string) []stream.C2S
+
+	// Streams returns every stream bound to any other cluster node.
+	Streams() []stream.C2S
+}
+
 // Router represents an XMPP stanza router.
 type Router struct {
 	mu             sync.RWMutex
 	s2sOutProvider S2SOutProvider
+	cluster        Cluster
 	hosts          map[string]tls.Certificate
+	admins         map[string][]string
 	localStreams   map[string][]stream.C2S
 
 	blockListsMu sync.RWMutex
@@ -63,12 +86,14 @@ type Router struct {
 func New(config *Config) (*Router, error) {
 	r := &Router{
 		hosts:        make(map[string]tls.Certificate),
+		admins:       make(map[string][]string),
 		blockLists:   make(map[string][]*jid.JID),
 		localStreams: make(map[string][]stream.C2S),
 	}
 	if len(config.Hosts) > 0 {
 		for _, h := range config.Hosts {
 			r.hosts[h.Name] = h.Certificate
+			r.admins[h.Name] = h.Admins
 		}
 	} else {
 		cer, err := util.LoadCertificate("", "", defaultDomain)
@@ -99,6 +124,31 @@ func (r *Router) IsLocalHost(domain string) bool {
 	return ok
 }
 
+// IsAdmin returns true if jid belongs to one of
+// its local server domain configured administrators.
+func (r *Router) IsAdmin(j *jid.JID) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, username := range r.admins[j.Domain()] {
+		if username == j.Node() {
+			return true
+		}
+	}
+	return false
+}
+
+// Certificate returns the certificate configured for a local
+// domain, or nil if domain is not served by this router.
+func (r *Router) Certificate(domain string) *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cer, ok := r.hosts[domain]
+	if !ok {
+		return nil
+	}
+	return &cer
+}
+
 // Certificates returns an array of all configured domain certificates.
 func (r *Router) Certificates() []tls.Certificate {
 	r.mu.RLock()
@@ -117,6 +167,13 @@ func (r *Router) SetS2SOutProvider(s2sOutProvider S2SOutProvider) {
 	r.s2sOutProvider = s2sOutProvider
 }
 
+// SetCluster sets the cluster used to share c2s stream bindings with other nodes.
+func (r *Router) SetCluster(cluster Cluster) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cluster = cluster
+}
+
 // Bind marks a c2s stream as binded.
 // An error will be returned in case no assigned resource is found.
 func (r *Router) Bind(stm stream.C2S) {
@@ -124,13 +181,17 @@ func (r *Router) Bind(stm stream.C2S) {
 		return
 	}
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	if authenticated := r.localStreams[stm.Username()]; authenticated != nil {
 		r.localStreams[stm.Username()] = append(authenticated, stm)
 	} else {
 		r.localStreams[stm.Username()] = []stream.C2S{stm}
 	}
+	cluster := r.cluster
+	r.mu.Unlock()
+
+	if cluster != nil {
+		cluster.BindStream(stm)
+	}
 	log.Infof("binded c2s stream... (%s/%s)", stm.Username(), stm.Resource())
 	return
 }
@@ -142,8 +203,6 @@ func (r *Router) Unbind(stm stream.C2S) {
 		return
 	}
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	if resources := r.localStreams[stm.Username()]; resources != nil {
 		res := stm.Resource()
 		for i := 0; i < len(resources); i++ {
@@ -158,14 +217,79 @@ func (r *Router) Unbind(stm stream.C2S) {
 			delete(r.localStreams, stm.Username())
 		}
 	}
+	cluster := r.cluster
+	r.mu.Unlock()
+
+	if cluster != nil {
+		cluster.UnbindStream(stm)
+	}
 	log.Infof("unbinded c2s stream... (%s/%s)", stm.Username(), stm.Resource())
 }
 
-// UserStreams returns all streams associated to a user.
+// UpdatePresence notifies the cluster that a bound c2s stream presence has changed.
+func (r *Router) UpdatePresence(stm stream.C2S) {
+	r.mu.RLock()
+	cluster := r.cluster
+	r.mu.RUnlock()
+
+	if cluster != nil {
+		cluster.UpdatePresence(stm)
+	}
+}
+
+// UserStreams returns all streams associated to a user,
+// including the ones bound to any other cluster node.
 func (r *Router) UserStreams(username string) []stream.C2S {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	return r.localStreams[username]
+	r.mu.RLock()
+	stms := r.localStreams[username]
+	cluster := r.cluster
+	r.mu.RUnlock()
+
+	if cluster == nil {
+		return stms
+	}
+	remoteStms := cluster.UserStreams(username)
+	if len(remoteStms) == 0 {
+		return stms
+	}
+	ret := make([]stream.C2S, 0, len(stms)+len(remoteStms))
+	ret = append(ret, stms...)
+	return append(ret, remoteStms...)
+}
+
+// DomainStreams returns all streams bound to a domain,
+// including the ones bound to any other cluster node.
+func (r *Router) DomainStreams(domain string) []stream.C2S {
+	var ret []stream.C2S
+	r.mu.RLock()
+	for _, stms := range r.localStreams {
+		for _, stm := range stms {
+			if stm.Domain() == domain {
+				ret = append(ret, stm)
+			}
+		}
+	}
+	cluster := r.cluster
+	r.mu.RUnlock()
+
+	if cluster == nil {
+		return ret
+	}
+	for _, stm := range cluster.Streams() {
+		if stm.Domain() == domain {
+			ret = append(ret, stm)
+		}
+	}
+	return ret
+}
+
+// Broadcast delivers a copy of a message to every stream bound to its
+// recipient domain, including the ones bound to any other cluster node.
+func (r *Router) Broadcast(msg *xmpp.Message) {
+	for _, stm := range r.DomainStreams(msg.ToJID().Domain()) {
+		m, _ := xmpp.NewMessageFromElement(msg, msg.FromJID(), stm.JID())
+		sendElement(stm, m)
+	}
 }
 
 // IsBlockedJID returns whether or not the passed jid matches any
@@ -220,7 +344,7 @@ func (r *Router) getBlockList(username string) []*jid.JID {
 	if bl != nil {
 		return bl
 	}
-	blItms, err := storage.FetchBlockListItems(username)
+	blItms, err := storage.FetchBlockListItems(context.Background(), username)
 	if err != nil {
 		log.Error(err)
 		return nil
@@ -237,6 +361,14 @@ func (r *Router) getBlockList(username string) []*jid.JID {
 }
 
 func (r *Router) route(element xmpp.Stanza, ignoreBlocking bool) error {
+	err := r.deliver(element, ignoreBlocking)
+	if err != nil {
+		trace.Route(element, err.Error())
+	}
+	return err
+}
+
+func (r *Router) deliver(element xmpp.Stanza, ignoreBlocking bool) error {
 	toJID := element.ToJID()
 	if !ignoreBlocking && !toJID.IsServer() {
 		if r.IsBlockedJID(element.FromJID(), toJID.Node()) {
@@ -248,7 +380,7 @@ func (r *Router) route(element xmpp.Stanza, ignoreBlocking bool) error {
 	}
 	rcps := r.UserStreams(toJID.Node())
 	if len(rcps) == 0 {
-		exists, err := storage.UserExists(toJID.Node())
+		exists, err := storage.UserExists(context.Background(), toJID.Node())
 		if err != nil {
 			return err
 		}
@@ -260,7 +392,10 @@ func (r *Router) route(element xmpp.Stanza, ignoreBlocking bool) error {
 	if toJID.IsFullWithUser() {
 		for _, stm := range rcps {
 			if stm.Resource() == toJID.Resource() {
-				stm.SendElement(element)
+				if err := sendElement(stm, element); err != nil {
+					return ErrNotAuthenticated
+				}
+				trace.Route(element, "delivered to stream "+stm.ID())
 				return nil
 			}
 		}
@@ -268,27 +403,71 @@ func (r *Router) route(element xmpp.Stanza, ignoreBlocking bool) error {
 	}
 	switch element.(type) {
 	case *xmpp.Message:
-		// send to highest priority stream
-		stm := rcps[0]
-		var highestPriority int8
-		if p := stm.Presence(); p != nil {
-			highestPriority = p.Priority()
-		}
-		for i := 1; i < len(rcps); i++ {
-			rcp := rcps[i]
-			if p := rcp.Presence(); p != nil && p.Priority() > highestPriority {
-				stm = rcp
-				highestPriority = p.Priority()
+		// send to highest priority stream, falling back to the next one
+		// in case it's bound to an unreachable cluster node
+		for len(rcps) > 0 {
+			idx := highestPriorityStream(rcps)
+			stm := rcps[idx]
+			if err := sendElement(stm, element); err != nil {
+				rcps = append(rcps[:idx:idx], rcps[idx+1:]...)
+				continue
 			}
+			trace.Route(element, "delivered to highest priority stream "+stm.ID())
+			return nil
 		}
-		stm.SendElement(element)
+		return ErrNotAuthenticated
 
 	default:
 		// broadcast toJID all streams
+		var delivered bool
 		for _, stm := range rcps {
-			stm.SendElement(element)
+			if err := sendElement(stm, element); err != nil {
+				continue
+			}
+			trace.Route(element, "delivered to stream "+stm.ID())
+			delivered = true
+		}
+		if !delivered {
+			return ErrNotAuthenticated
+		}
+	}
+	return nil
+}
+
+func highestPriorityStream(stms []stream.C2S) int {
+	var idx int
+	var highestPriority int8
+	if p := stms[0].Presence(); p != nil {
+		highestPriority = p.Priority()
+	}
+	for i := 1; i < len(stms); i++ {
+		if p := stms[i].Presence(); p != nil && p.Priority() > highestPriority {
+			idx = i
+			highestPriority = p.Priority()
+		}
+	}
+	return idx
+}
+
+// sendElement sends an element over a stream, returning an error in case
+// it's bound to a different cluster node and couldn't be handed over.
+// Messages lacking a stanza ID (XEP-0359) assigned by the receiving
+// account are stamped, so that every delivered message carries one.
+func sendElement(stm stream.C2S, elem xmpp.XElement) error {
+	if msg, ok := elem.(*xmpp.Message); ok {
+		by := stm.JID().ToBareJID().String()
+		if len(msg.StanzaID(by)) == 0 {
+			msg.SetStanzaID(by, uuid.New())
 		}
 	}
+	if rs, ok := stm.(stream.RemoteC2S); ok {
+		if err := rs.ForwardElement(elem); err != nil {
+			log.Warnf("router: failed to forward element to %s: %v", stm.ID(), err)
+			return err
+		}
+		return nil
+	}
+	stm.SendElement(elem)
 	return nil
 }
 
@@ -304,6 +483,7 @@ func (r *Router) remoteRoute(elem xmpp.Stanza) error {
 		log.Error(err)
 		return ErrFailedRemoteConnect
 	}
+	trace.Route(elem, "routed to remote domain "+remoteDomain)
 	out.SendElement(elem)
 	return nil
 }
@@ -6,7 +6,9 @@
 package router
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"testing"
 
 	"github.com/ortuman/jackal/model"
@@ -25,6 +27,7 @@ type fakeS2SOut struct {
 
 func (f *fakeS2SOut) ID() string                     { return uuid.New() }
 func (f *fakeS2SOut) SendElement(elem xmpp.XElement) { f.elems = append(f.elems, elem) }
+func (f *fakeS2SOut) Context() *stream.Context       { return stream.NewContext() }
 func (f *fakeS2SOut) Disconnect(err error)           {}
 
 type fakeS2SProvider struct {
@@ -35,6 +38,27 @@ func (f *fakeS2SProvider) GetS2SOut(localDomain, remoteDomain string) (stream.S2
 	return f.s2sOut, nil
 }
 
+type fakeCluster struct {
+	binded    []stream.C2S
+	unbinded  []stream.C2S
+	presences []stream.C2S
+	remote    map[string][]stream.C2S
+}
+
+func (f *fakeCluster) BindStream(stm stream.C2S)     { f.binded = append(f.binded, stm) }
+func (f *fakeCluster) UnbindStream(stm stream.C2S)   { f.unbinded = append(f.unbinded, stm) }
+func (f *fakeCluster) UpdatePresence(stm stream.C2S) { f.presences = append(f.presences, stm) }
+func (f *fakeCluster) UserStreams(username string) []stream.C2S {
+	return f.remote[username]
+}
+func (f *fakeCluster) Streams() []stream.C2S {
+	var ret []stream.C2S
+	for _, stms := range f.remote {
+		ret = append(ret, stms...)
+	}
+	return ret
+}
+
 func TestC2SManager(t *testing.T) {
 	r, _, shutdown := setupTest()
 	defer shutdown()
@@ -111,7 +135,7 @@ func TestC2SManager_Routing(t *testing.T) {
 	require.Equal(t, memstorage.ErrMockedError, r.Route(iq))
 	s.DisableMockedError()
 
-	storage.InsertOrUpdateUser(&model.User{Username: "hamlet", Password: ""})
+	storage.InsertOrUpdateUser(context.Background(), &model.User{Username: "hamlet", Password: ""})
 	require.Equal(t, ErrNotAuthenticated, r.Route(iq))
 
 	stm4 := stream.NewMockC2S(uuid.New(), j4)
@@ -179,53 +203,53 @@ func TestC2SManager_BlockedJID(t *testing.T) {
 		Username: "ortuman",
 		JID:      "hamlet@jackal.im/garden",
 	}}
-	storage.InsertBlockListItems(bl1)
+	storage.InsertBlockListItems(context.Background(), bl1)
 	require.False(t, r.IsBlockedJID(j2, "ortuman"))
 	require.True(t, r.IsBlockedJID(j3, "ortuman"))
 
-	storage.DeleteBlockListItems(bl1)
+	storage.DeleteBlockListItems(context.Background(), bl1)
 
 	// node + domain
 	bl2 := []model.BlockListItem{{
 		Username: "ortuman",
 		JID:      "hamlet@jackal.im",
 	}}
-	storage.InsertBlockListItems(bl2)
+	storage.InsertBlockListItems(context.Background(), bl2)
 	r.ReloadBlockList("ortuman")
 
 	require.True(t, r.IsBlockedJID(j2, "ortuman"))
 	require.True(t, r.IsBlockedJID(j3, "ortuman"))
 	require.False(t, r.IsBlockedJID(j4, "ortuman"))
 
-	storage.DeleteBlockListItems(bl2)
+	storage.DeleteBlockListItems(context.Background(), bl2)
 
 	// domain + resource
 	bl3 := []model.BlockListItem{{
 		Username: "ortuman",
 		JID:      "jackal.im/balcony",
 	}}
-	storage.InsertBlockListItems(bl3)
+	storage.InsertBlockListItems(context.Background(), bl3)
 	r.ReloadBlockList("ortuman")
 
 	require.True(t, r.IsBlockedJID(j2, "ortuman"))
 	require.False(t, r.IsBlockedJID(j3, "ortuman"))
 	require.False(t, r.IsBlockedJID(j4, "ortuman"))
 
-	storage.DeleteBlockListItems(bl3)
+	storage.DeleteBlockListItems(context.Background(), bl3)
 
 	// domain
 	bl4 := []model.BlockListItem{{
 		Username: "ortuman",
 		JID:      "jackal.im",
 	}}
-	storage.InsertBlockListItems(bl4)
+	storage.InsertBlockListItems(context.Background(), bl4)
 	r.ReloadBlockList("ortuman")
 
 	require.True(t, r.IsBlockedJID(j2, "ortuman"))
 	require.True(t, r.IsBlockedJID(j3, "ortuman"))
 	require.True(t, r.IsBlockedJID(j4, "ortuman"))
 
-	storage.DeleteBlockListItems(bl4)
+	storage.DeleteBlockListItems(context.Background(), bl4)
 
 	// test blocked routing
 	iq := xmpp.NewIQType(uuid.New(), xmpp.GetType)
@@ -234,9 +258,166 @@ func TestC2SManager_BlockedJID(t *testing.T) {
 	require.Equal(t, ErrBlockedJID, r.Route(iq))
 }
 
+type fakeRemoteC2S struct {
+	*stream.MockC2S
+	err error
+}
+
+func (f *fakeRemoteC2S) ForwardElement(elem xmpp.XElement) error { return f.err }
+func (f *fakeRemoteC2S) Terminate(err error) error               { return f.err }
+
+func TestC2SManager_ClusterUnreachable(t *testing.T) {
+	r, _, shutdown := setupTest()
+	defer shutdown()
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	j2, _ := jid.NewWithString("ortuman@jackal.im/garden", false)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm2 := &fakeRemoteC2S{MockC2S: stream.NewMockC2S(uuid.New(), j2), err: errors.New("node not connected")}
+
+	p := xmpp.NewElementName("presence")
+	pr := xmpp.NewElementName("priority")
+	pr.SetText("8")
+	p.AppendElement(pr)
+	presence, _ := xmpp.NewPresenceFromElement(p, j2, j2)
+	stm2.SetPresence(presence)
+
+	r.SetCluster(&fakeCluster{remote: map[string][]stream.C2S{"ortuman": {stm2}}})
+
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetToJID(j2)
+	require.Equal(t, ErrNotAuthenticated, r.Route(msg))
+
+	require.NotNil(t, stream.Disconnect(stm2, nil))
+
+	// fall back to next highest priority stream
+	r.Bind(stm1)
+	msgID := uuid.New()
+	msg = xmpp.NewMessageType(msgID, xmpp.ChatType)
+	msg.SetToJID(j2.ToBareJID())
+	require.Nil(t, r.Route(msg))
+	require.Equal(t, msgID, stm1.FetchElement().ID())
+	require.Equal(t, 2, len(r.UserStreams("ortuman")))
+}
+
+func TestC2SManager_Cluster(t *testing.T) {
+	r, _, shutdown := setupTest()
+	defer shutdown()
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	j2, _ := jid.NewWithString("ortuman@jackal.im/garden", false)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+
+	cluster := &fakeCluster{remote: map[string][]stream.C2S{"ortuman": {stm2}}}
+	r.SetCluster(cluster)
+
+	r.Bind(stm1)
+	require.Equal(t, 1, len(cluster.binded))
+
+	r.UpdatePresence(stm1)
+	require.Equal(t, 1, len(cluster.presences))
+
+	// remote streams should be considered when routing
+	require.Equal(t, 2, len(r.UserStreams("ortuman")))
+	require.Equal(t, 2, len(r.DomainStreams("jackal.im")))
+	require.Equal(t, 0, len(r.DomainStreams("jabber.org")))
+
+	iqID := uuid.New()
+	iq := xmpp.NewIQType(iqID, xmpp.GetType)
+	iq.SetFromJID(j1)
+	iq.SetToJID(j2)
+	require.Nil(t, r.Route(iq))
+	elem := stm2.FetchElement()
+	require.Equal(t, iqID, elem.ID())
+
+	r.Unbind(stm1)
+	require.Equal(t, 1, len(cluster.unbinded))
+	require.Equal(t, 1, len(r.UserStreams("ortuman")))
+}
+
+func TestC2SManager_StanzaID(t *testing.T) {
+	r, _, shutdown := setupTest()
+	defer shutdown()
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	j2, _ := jid.NewWithString("noelia@jackal.im/garden", false)
+	stm := stream.NewMockC2S(uuid.New(), j2)
+	r.Bind(stm)
+
+	// missing stanza IDs get assigned on delivery
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2.ToBareJID())
+	require.Nil(t, r.Route(msg))
+	elem := stm.FetchElement().(*xmpp.Message)
+	require.NotEqual(t, "", elem.StanzaID("noelia@jackal.im"))
+
+	// while already assigned ones are preserved
+	msg = xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(j1)
+	msg.SetToJID(j2)
+	msg.SetStanzaID("noelia@jackal.im", "sid1")
+	require.Nil(t, r.Route(msg))
+	elem = stm.FetchElement().(*xmpp.Message)
+	require.Equal(t, "sid1", elem.StanzaID("noelia@jackal.im"))
+}
+
+func TestC2SManager_IsAdmin(t *testing.T) {
+	r, _, shutdown := setupTest()
+	defer shutdown()
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	j2, _ := jid.NewWithString("noelia@jackal.im/balcony", false)
+	j3, _ := jid.NewWithString("ortuman@jabber.org/balcony", false)
+	j4, _ := jid.NewWithString("jackal.im", false)
+	require.True(t, r.IsAdmin(j1))
+	require.True(t, r.IsAdmin(j1.ToBareJID()))
+	require.False(t, r.IsAdmin(j2))
+	require.False(t, r.IsAdmin(j3))
+	require.False(t, r.IsAdmin(j4))
+}
+
+func TestC2SManager_Broadcast(t *testing.T) {
+	r, _, shutdown := setupTest()
+	defer shutdown()
+
+	j1, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
+	j2, _ := jid.NewWithString("noelia@jackal.im/garden", false)
+	j3, _ := jid.NewWithString("hamlet@jabber.org/garden", false)
+	stm1 := stream.NewMockC2S(uuid.New(), j1)
+	stm2 := stream.NewMockC2S(uuid.New(), j2)
+	stm3 := stream.NewMockC2S(uuid.New(), j3)
+
+	r.Bind(stm1)
+	r.Bind(stm2)
+	r.Bind(stm3)
+
+	srvJID, _ := jid.NewWithString("jackal.im", false)
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.HeadlineType)
+	msg.SetFromJID(srvJID)
+	msg.SetToJID(srvJID)
+	body := xmpp.NewElementName("body")
+	body.SetText("Maintenance at 23:00")
+	msg.AppendElement(body)
+
+	r.Broadcast(msg)
+
+	for _, stm := range []*stream.MockC2S{stm1, stm2} {
+		elem := stm.FetchElement()
+		require.Equal(t, "jackal.im", elem.From())
+		require.Equal(t, stm.JID().String(), elem.To())
+		require.Equal(t, "Maintenance at 23:00", elem.Elements().Child("body").Text())
+		require.NotEqual(t, "", elem.(*xmpp.Message).StanzaID(stm.JID().ToBareJID().String()))
+	}
+	// other domain streams shouldn't have received anything
+	stm3.SendElement(xmpp.NewElementName("marker"))
+	require.Equal(t, "marker", stm3.FetchElement().Name())
+}
+
 func setupTest() (*Router, *memstorage.Storage, func()) {
 	r, _ := New(&Config{
-		Hosts: []HostConfig{{Name: "jackal.im", Certificate: tls.Certificate{}}},
+		Hosts: []HostConfig{{Name: "jackal.im", Certificate: tls.Certificate{}, Admins: []string{"ortuman"}}},
 	})
 	s := memstorage.New()
 	storage.Set(s)
@@ -7,6 +7,8 @@ package s2s
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
 	"time"
 
 	"github.com/ortuman/jackal/module"
@@ -21,6 +23,7 @@ const (
 	defaultTransportKeepAlive = time.Duration(10) * time.Minute
 	defaultDialTimeout        = time.Duration(15) * time.Second
 	defaultConnectTimeout     = time.Duration(5) * time.Second
+	defaultIdleTimeout        = time.Duration(10) * time.Minute
 	defaultMaxStanzaSize      = 131072
 )
 
@@ -29,12 +32,14 @@ type TransportConfig struct {
 	BindAddress string
 	Port        int
 	KeepAlive   time.Duration
+	DirectTLS   bool
 }
 
 type transportConfigProxy struct {
 	BindAddress string `yaml:"bind_addr"`
 	Port        int    `yaml:"port"`
 	KeepAlive   int    `yaml:"keep_alive"`
+	DirectTLS   bool   `yaml:"direct_tls"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -44,6 +49,7 @@ func (c *TransportConfig) UnmarshalYAML(unmarshal func(interface{}) error) error
 		return err
 	}
 	c.BindAddress = p.BindAddress
+	c.DirectTLS = p.DirectTLS
 	c.Port = p.Port
 	if c.Port == 0 {
 		c.Port = defaultTransportPort
@@ -67,8 +73,10 @@ type Config struct {
 	ID             string
 	DialTimeout    time.Duration
 	ConnectTimeout time.Duration
+	IdleTimeout    time.Duration
 	DialbackSecret string
 	MaxStanzaSize  int
+	RootCAs        *x509.CertPool
 	Transport      TransportConfig
 }
 
@@ -76,8 +84,10 @@ type configProxy struct {
 	ID             string          `yaml:"id"`
 	DialTimeout    int             `yaml:"dial_timeout"`
 	ConnectTimeout int             `yaml:"connect_timeout"`
+	IdleTimeout    int             `yaml:"idle_timeout"`
 	DialbackSecret string          `yaml:"dialback_secret"`
 	MaxStanzaSize  int             `yaml:"max_stanza_size"`
+	CAPath         string          `yaml:"ca_path"`
 	Transport      TransportConfig `yaml:"transport"`
 }
 
@@ -100,11 +110,26 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if c.ConnectTimeout == 0 {
 		c.ConnectTimeout = defaultConnectTimeout
 	}
+	c.IdleTimeout = time.Duration(p.IdleTimeout) * time.Second
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = defaultIdleTimeout
+	}
 	c.Transport = p.Transport
 	c.MaxStanzaSize = p.MaxStanzaSize
 	if c.MaxStanzaSize == 0 {
 		c.MaxStanzaSize = defaultMaxStanzaSize
 	}
+	// use system root CAs in case no pool has been specified
+	if len(p.CAPath) > 0 {
+		pemCerts, err := ioutil.ReadFile(p.CAPath)
+		if err != nil {
+			return err
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pemCerts) {
+			return errors.New("s2s.Config: no valid certificates found in CA file")
+		}
+	}
 	return nil
 }
 
@@ -114,11 +139,16 @@ type streamConfig struct {
 	localDomain     string
 	remoteDomain    string
 	connectTimeout  time.Duration
+	idleTimeout     time.Duration
+	directTLS       bool
 	tls             *tls.Config
+	rootCAs         *x509.CertPool
 	transport       transport.Transport
+	remoteAddr      string
 	maxStanzaSize   int
 	dbVerify        xmpp.XElement
 	dialer          *dialer
 	onInDisconnect  func(s stream.S2SIn)
 	onOutDisconnect func(s stream.S2SOut)
+	onOutPairFailed func(localDomain, remoteDomain string)
 }
@@ -40,6 +40,17 @@ keep_alive: 200
 	require.Equal(t, "127.0.0.1", trCfg.BindAddress)
 	require.Equal(t, 5999, trCfg.Port)
 	require.Equal(t, time.Duration(200)*time.Second, trCfg.KeepAlive)
+	require.False(t, trCfg.DirectTLS)
+
+	rawCfg = `
+bind_addr: 0.0.0.0
+port: 5270
+direct_tls: true
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &trCfg)
+	require.Nil(t, err)
+	require.Equal(t, 5270, trCfg.Port)
+	require.True(t, trCfg.DirectTLS)
 }
 
 func TestConfig(t *testing.T) {
@@ -59,17 +70,36 @@ dialback_secret: s3cr3t
 	require.Nil(t, err) // defaults
 	require.Equal(t, defaultDialTimeout, cfg.DialTimeout)
 	require.Equal(t, defaultConnectTimeout, cfg.ConnectTimeout)
+	require.Equal(t, defaultIdleTimeout, cfg.IdleTimeout)
 	require.Equal(t, defaultMaxStanzaSize, cfg.MaxStanzaSize)
 
 	rawCfg = `
 dialback_secret: s3cr3t
 dial_timeout: 300
 connect_timeout: 250
+idle_timeout: 120
 max_stanza_size: 8192
 `
 	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
 	require.Nil(t, err) // defaults
 	require.Equal(t, time.Duration(300)*time.Second, cfg.DialTimeout)
 	require.Equal(t, time.Duration(250)*time.Second, cfg.ConnectTimeout)
+	require.Equal(t, time.Duration(120)*time.Second, cfg.IdleTimeout)
 	require.Equal(t, 8192, cfg.MaxStanzaSize)
+
+	rawCfg = `
+dialback_secret: s3cr3t
+ca_path: ../testdata/cert/test.server.key
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.NotNil(t, err) // no valid certificates
+
+	rawCfg = `
+dialback_secret: s3cr3t
+ca_path: ../testdata/cert/test.server.crt
+`
+	cfg = Config{}
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.NotNil(t, cfg.RootCAs)
 }
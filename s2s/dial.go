@@ -7,15 +7,33 @@ package s2s
 
 import (
 	"crypto/tls"
+	"fmt"
+	"math/rand"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/xmpp"
 )
 
+const defaultServerPort = 5269
+
+// dialTarget represents a remote server address to be tried when establishing an outgoing connection.
+type dialTarget struct {
+	address   string
+	directTLS bool // XEP-0368: SRV records for XMPP over TLS
+}
+
+type srvRecord struct {
+	*net.SRV
+	directTLS bool
+}
+
 type dialer struct {
 	cfg         *Config
 	router      *router.Router
@@ -28,31 +46,170 @@ func newDialer(cfg *Config, router *router.Router) *dialer {
 }
 
 func (d *dialer) dial(localDomain, remoteDomain string) (*streamConfig, error) {
-	_, addrs, err := d.srvResolve("xmpp-server", "tcp", remoteDomain)
+	targets, err := d.resolveTargets(remoteDomain)
 	if err != nil {
 		return nil, err
 	}
-	var target string
-	if len(addrs) == 1 && addrs[0].Target == "." {
-		target = remoteDomain + ":5269"
-	} else {
-		target = strings.TrimSuffix(addrs[0].Target, ".")
+	// remote certificate chain will be validated once the
+	// TLS negotiation has been completed, falling back to dialback
+	// authentication in case it's not trusted.
+	tlsConfig := &tls.Config{
+		ServerName:           remoteDomain,
+		GetClientCertificate: d.clientCertificate(localDomain),
+		InsecureSkipVerify:   true,
+	}
+	// try every target until a connection is established
+	var conn net.Conn
+	var target dialTarget
+	for _, target = range targets {
+		conn, err = d.dialTarget(target, tlsConfig)
+		if err == nil {
+			break
+		}
+		log.Infof("s2s: failed to connect to %s (domain: %s): %v", target.address, remoteDomain, err)
 	}
-	conn, err := d.dialTimeout("tcp", target+":"+strconv.Itoa(int(addrs[0].Port)), d.cfg.DialTimeout)
 	if err != nil {
 		return nil, err
 	}
-	tlsConfig := &tls.Config{
-		ServerName:   remoteDomain,
-		Certificates: d.router.Certificates(),
-	}
 	tr := transport.NewSocketTransport(conn, d.cfg.Transport.KeepAlive)
 	return &streamConfig{
-		keyGen:        &keyGen{secret: d.cfg.DialbackSecret},
-		localDomain:   localDomain,
-		remoteDomain:  remoteDomain,
-		transport:     tr,
-		tls:           tlsConfig,
-		maxStanzaSize: d.cfg.MaxStanzaSize,
+		keyGen:         &keyGen{secret: d.cfg.DialbackSecret},
+		localDomain:    localDomain,
+		remoteDomain:   remoteDomain,
+		connectTimeout: d.cfg.ConnectTimeout,
+		idleTimeout:    d.cfg.IdleTimeout,
+		directTLS:      target.directTLS,
+		transport:      tr,
+		remoteAddr:     conn.RemoteAddr().String(),
+		tls:            tlsConfig,
+		rootCAs:        d.cfg.RootCAs,
+		maxStanzaSize:  d.cfg.MaxStanzaSize,
 	}, nil
 }
+
+// clientCertificate returns a callback presenting the certificate
+// of the originating local domain when the remote server requests one.
+func (d *dialer) clientCertificate(localDomain string) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		if cer := d.router.Certificate(localDomain); cer != nil {
+			return cer, nil
+		}
+		return &tls.Certificate{}, nil // no client certificate
+	}
+}
+
+func (d *dialer) dialTarget(target dialTarget, tlsConfig *tls.Config) (net.Conn, error) {
+	conn, err := d.dialTimeout("tcp", target.address, d.cfg.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if !target.directTLS {
+		return conn, nil
+	}
+	cfg := tlsConfig.Clone()
+	cfg.NextProtos = []string{"xmpp-server"}
+
+	tlsConn := tls.Client(conn, cfg)
+	tlsConn.SetDeadline(time.Now().Add(d.cfg.DialTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// resolveTargets returns the ordered list of addresses to connect to a remote domain,
+// as described in RFC 6120 (section 3.2) and XEP-0368.
+func (d *dialer) resolveTargets(remoteDomain string) ([]dialTarget, error) {
+	var records []srvRecord
+	var unavailable bool
+
+	for _, service := range []string{"xmpps-server", "xmpp-server"} {
+		_, addrs, err := d.srvResolve(service, "tcp", remoteDomain)
+		if err != nil {
+			continue
+		}
+		if len(addrs) == 1 && addrs[0].Target == "." {
+			// service decidedly not available at this domain,
+			// which only means refusing s2s for the plain one
+			unavailable = unavailable || service == "xmpp-server"
+			continue
+		}
+		for _, addr := range addrs {
+			records = append(records, srvRecord{SRV: addr, directTLS: service == "xmpps-server"})
+		}
+	}
+	if len(records) == 0 {
+		if unavailable {
+			return nil, fmt.Errorf("s2s: xmpp service not available at %s", remoteDomain)
+		}
+		// fallback to address record resolution
+		return []dialTarget{{address: net.JoinHostPort(remoteDomain, strconv.Itoa(defaultServerPort))}}, nil
+	}
+	var targets []dialTarget
+	for _, rec := range sortSRVRecords(records) {
+		host := strings.TrimSuffix(rec.Target, ".")
+		targets = append(targets, dialTarget{
+			address:   net.JoinHostPort(host, strconv.Itoa(int(rec.Port))),
+			directTLS: rec.directTLS,
+		})
+	}
+	return targets, nil
+}
+
+// sortSRVRecords orders records by priority, choosing among same priority
+// records by means of a weighted random selection (RFC 2782).
+func sortSRVRecords(records []srvRecord) []srvRecord {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Priority < records[j].Priority
+	})
+	var ret []srvRecord
+	for i := 0; i < len(records); {
+		j := i
+		for j < len(records) && records[j].Priority == records[i].Priority {
+			j++
+		}
+		ret = append(ret, weightedShuffle(records[i:j])...)
+		i = j
+	}
+	return ret
+}
+
+func weightedShuffle(records []srvRecord) []srvRecord {
+	pending := make([]srvRecord, len(records))
+	copy(pending, records)
+
+	// zero weight records should have a very small chance of being selected
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Weight == 0 && pending[j].Weight > 0
+	})
+	var ret []srvRecord
+	for len(pending) > 0 {
+		var sum int
+		for _, rec := range pending {
+			sum += int(rec.Weight)
+		}
+		n := rand.Intn(sum + 1)
+
+		var i, acc int
+		for i = 0; i < len(pending); i++ {
+			acc += int(pending[i].Weight)
+			if acc >= n {
+				break
+			}
+		}
+		ret = append(ret, pending[i])
+		pending = append(pending[:i], pending[i+1:]...)
+	}
+	return ret
+}
+
+// dialStanzaError returns the stanza error to be bounced to senders
+// when a remote server couldn't be reached.
+func dialStanzaError(err error) *xmpp.StanzaError {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return xmpp.ErrRemoteServerTimeout
+	}
+	return xmpp.ErrRemoteServerNotFound
+}
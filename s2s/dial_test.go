@@ -6,11 +6,14 @@
 package s2s
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"net"
 	"testing"
 	"time"
 
+	"github.com/ortuman/jackal/router"
 	"github.com/stretchr/testify/require"
 )
 
@@ -30,31 +33,171 @@ func TestS2SDial(t *testing.T) {
 	// not enabled
 	d := newDialer(cfg, r)
 
-	// resolver error...
+	// resolver error... fallback to address record
 	mockedErr := errors.New("dialer mocked error")
 	d.srvResolve = func(_, _, _ string) (cname string, addrs []*net.SRV, err error) {
 		return "", nil, mockedErr
 	}
+	var dialedAddrs []string
+	d.dialTimeout = func(_, address string, _ time.Duration) (net.Conn, error) {
+		dialedAddrs = append(dialedAddrs, address)
+		return nil, mockedErr
+	}
 	out, err := d.dial("jackal.im", "jabber.org")
 	require.Nil(t, out)
 	require.Equal(t, mockedErr, err)
+	require.Equal(t, []string{"jabber.org:5269"}, dialedAddrs)
 
-	// dialer error...
+	// service not available...
+	dialedAddrs = nil
 	d.srvResolve = func(service, proto, name string) (cname string, addrs []*net.SRV, err error) {
-		return "", []*net.SRV{{Target: "xmpp.jabber.org", Port: 5269}}, nil
+		return "", []*net.SRV{{Target: "."}}, nil
 	}
-	d.dialTimeout = func(_, _ string, _ time.Duration) (net.Conn, error) {
-		return nil, mockedErr
+	out, err = d.dial("jackal.im", "jabber.org")
+	require.Nil(t, out)
+	require.NotNil(t, err)
+	require.Equal(t, 0, len(dialedAddrs))
+
+	// direct TLS service not available... fallback to address record
+	dialedAddrs = nil
+	d.srvResolve = func(service, proto, name string) (cname string, addrs []*net.SRV, err error) {
+		if service == "xmpps-server" {
+			return "", []*net.SRV{{Target: "."}}, nil
+		}
+		return "", nil, mockedErr
 	}
 	out, err = d.dial("jackal.im", "jabber.org")
 	require.Nil(t, out)
 	require.Equal(t, mockedErr, err)
+	require.Equal(t, []string{"jabber.org:5269"}, dialedAddrs)
 
-	// success
-	d.dialTimeout = func(_, _ string, _ time.Duration) (net.Conn, error) {
+	// dialer error... try every target
+	dialedAddrs = nil
+	d.srvResolve = func(service, proto, name string) (cname string, addrs []*net.SRV, err error) {
+		if service != "xmpp-server" {
+			return "", nil, mockedErr
+		}
+		return "", []*net.SRV{
+			{Target: "xmpp2.jabber.org.", Port: 5269, Priority: 20},
+			{Target: "xmpp1.jabber.org.", Port: 5269, Priority: 10},
+		}, nil
+	}
+	out, err = d.dial("jackal.im", "jabber.org")
+	require.Nil(t, out)
+	require.Equal(t, mockedErr, err)
+	require.Equal(t, []string{"xmpp1.jabber.org:5269", "xmpp2.jabber.org:5269"}, dialedAddrs)
+
+	// success... fallback to next target
+	dialedAddrs = nil
+	d.dialTimeout = func(_, address string, _ time.Duration) (net.Conn, error) {
+		dialedAddrs = append(dialedAddrs, address)
+		if address == "xmpp1.jabber.org:5269" {
+			return nil, mockedErr
+		}
 		return newFakeSocketConn(), nil
 	}
 	out, err = d.dial("jackal.im", "jabber.org")
 	require.NotNil(t, out)
 	require.Nil(t, err)
+	require.False(t, out.directTLS)
+	require.Equal(t, []string{"xmpp1.jabber.org:5269", "xmpp2.jabber.org:5269"}, dialedAddrs)
+}
+
+func TestS2SDial_DirectTLS(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	cer, _ := tUtilFederationCertificate(t, []string{"jabber.org"})
+
+	cfg := &Config{DialTimeout: time.Second * time.Duration(5)}
+	d := newDialer(cfg, r)
+	d.srvResolve = func(service, proto, name string) (cname string, addrs []*net.SRV, err error) {
+		switch service {
+		case "xmpps-server":
+			return "", []*net.SRV{{Target: "xmpps.jabber.org.", Port: 5270, Priority: 5}}, nil
+		default:
+			return "", []*net.SRV{{Target: "xmpp.jabber.org.", Port: 5269, Priority: 10}}, nil
+		}
+	}
+	var dialedAddrs []string
+	d.dialTimeout = func(_, address string, _ time.Duration) (net.Conn, error) {
+		dialedAddrs = append(dialedAddrs, address)
+		c1, c2 := net.Pipe()
+		go func() {
+			srv := tls.Server(c2, &tls.Config{Certificates: []tls.Certificate{cer}, NextProtos: []string{"xmpp-server"}})
+			srv.Handshake()
+		}()
+		return c1, nil
+	}
+	out, err := d.dial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	require.NotNil(t, out)
+	require.True(t, out.directTLS)
+	require.Equal(t, []string{"xmpps.jabber.org:5270"}, dialedAddrs)
+	require.Equal(t, 1, len(out.transport.PeerCertificates()))
+}
+
+func TestS2SDial_ClientCertificate(t *testing.T) {
+	jackalCer, _ := tUtilFederationCertificate(t, []string{"jackal.im"})
+	jackalNetCer, _ := tUtilFederationCertificate(t, []string{"jackal.net"})
+	r, _ := router.New(&router.Config{
+		Hosts: []router.HostConfig{
+			{Name: "jackal.im", Certificate: jackalCer},
+			{Name: "jackal.net", Certificate: jackalNetCer},
+		},
+	})
+	serverCer, _ := tUtilFederationCertificate(t, []string{"jabber.org"})
+
+	cfg := &Config{DialTimeout: time.Second * time.Duration(5)}
+	d := newDialer(cfg, r)
+	d.srvResolve = func(service, proto, name string) (cname string, addrs []*net.SRV, err error) {
+		if service == "xmpps-server" {
+			return "", []*net.SRV{{Target: "xmpps.jabber.org.", Port: 5270}}, nil
+		}
+		return "", nil, errors.New("no such host")
+	}
+	clientCerts := make(chan []*x509.Certificate, 1)
+	d.dialTimeout = func(_, address string, _ time.Duration) (net.Conn, error) {
+		c1, c2 := net.Pipe()
+		go func() {
+			srv := tls.Server(c2, &tls.Config{
+				Certificates: []tls.Certificate{serverCer},
+				ClientAuth:   tls.RequestClientCert,
+				NextProtos:   []string{"xmpp-server"},
+			})
+			srv.Handshake()
+			clientCerts <- srv.ConnectionState().PeerCertificates
+		}()
+		return c1, nil
+	}
+	// only the originating domain certificate is presented
+	_, err := d.dial("jackal.net", "jabber.org")
+	require.Nil(t, err)
+	certs := <-clientCerts
+	require.Equal(t, 1, len(certs))
+	require.Equal(t, []string{"jackal.net"}, certs[0].DNSNames)
+
+	// unknown local domain
+	_, err = d.dial("jackal.org", "jabber.org")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(<-clientCerts))
+}
+
+func TestS2SDial_SortSRVRecords(t *testing.T) {
+	records := []srvRecord{
+		{SRV: &net.SRV{Target: "c", Priority: 20, Weight: 0}},
+		{SRV: &net.SRV{Target: "a", Priority: 10, Weight: 60}},
+		{SRV: &net.SRV{Target: "b", Priority: 10, Weight: 40}},
+		{SRV: &net.SRV{Target: "d", Priority: 30, Weight: 10}, directTLS: true},
+	}
+	for i := 0; i < 16; i++ {
+		sorted := sortSRVRecords(records)
+		require.Equal(t, 4, len(sorted))
+		require.Contains(t, []string{"a", "b"}, sorted[0].Target)
+		require.Contains(t, []string{"a", "b"}, sorted[1].Target)
+		require.NotEqual(t, sorted[0].Target, sorted[1].Target)
+		require.Equal(t, "c", sorted[2].Target)
+		require.Equal(t, "d", sorted[3].Target)
+		require.True(t, sorted[3].directTLS)
+	}
 }
@@ -10,6 +10,9 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
 )
 
 type keyGen struct {
@@ -23,3 +26,36 @@ func (kg *keyGen) generate(from, to, streamID string) string {
 	hm.Write([]byte(fmt.Sprintf("%s %s %s", to, from, streamID)))
 	return hex.EncodeToString(hm.Sum(nil))
 }
+
+// newDialbackError returns a dialback error element (XEP-0220) in response
+// to a db:result or db:verify element. Dialback key is never included.
+func newDialbackError(elem xmpp.XElement, stanzaErr *xmpp.StanzaError) xmpp.XElement {
+	resp := xmpp.NewElementName(elem.Name())
+	resp.SetFrom(elem.To())
+	resp.SetTo(elem.From())
+	if id := elem.ID(); len(id) > 0 {
+		resp.SetID(id)
+	}
+	resp.SetType(xmpp.ErrorType)
+	resp.AppendElement(stanzaErr.Element())
+	return resp
+}
+
+// dialbackErrorReason returns the error condition associated
+// to a dialback error element.
+func dialbackErrorReason(elem xmpp.XElement) string {
+	if errEl := elem.Elements().Child("error"); errEl != nil {
+		if conds := errEl.Elements().All(); len(conds) > 0 {
+			return conds[0].Name()
+		}
+	}
+	return "undefined-condition"
+}
+
+func domainOf(address string) string {
+	j, err := jid.NewWithString(address, true)
+	if err != nil {
+		return ""
+	}
+	return j.Domain()
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/module"
+	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/storage"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/stream"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// fedInstance represents an in-process jackal instance taking part in a federation test.
+type fedInstance struct {
+	router *router.Router
+	s2s    *S2S
+	certs  []*x509.Certificate
+	port   uint16
+}
+
+func TestFederation_Dialback(t *testing.T) {
+	storage.Set(memstorage.New())
+	defer storage.Unset()
+
+	a := tUtilFederationInstance(t, []string{"jackal.im"})
+	b := tUtilFederationInstance(t, []string{"jabber.org"})
+	tUtilFederationStart(t, a, b)
+	defer tUtilFederationShutdown(a, b)
+
+	tUtilFederationRouteMessage(t, a, b, "jackal.im", "jabber.org")
+
+	// remote certificate is not trusted... authenticated by means of dialback
+	stm := tUtilFederationOutStream(t, a, "jackal.im", "jabber.org")
+	require.True(t, stm.dialbackOffered)
+	require.Equal(t, uint32(0), atomic.LoadUint32(&stm.authenticated))
+}
+
+func TestFederation_External(t *testing.T) {
+	storage.Set(memstorage.New())
+	defer storage.Unset()
+
+	a := tUtilFederationInstance(t, []string{"jackal.im"})
+	b := tUtilFederationInstance(t, []string{"jabber.org"})
+	tUtilFederationTrust(a, b)
+	tUtilFederationStart(t, a, b)
+	defer tUtilFederationShutdown(a, b)
+
+	tUtilFederationRouteMessage(t, a, b, "jackal.im", "jabber.org")
+
+	stm := tUtilFederationOutStream(t, a, "jackal.im", "jabber.org")
+	require.Equal(t, uint32(1), atomic.LoadUint32(&stm.authenticated))
+}
+
+func TestFederation_Piggyback(t *testing.T) {
+	storage.Set(memstorage.New())
+	defer storage.Unset()
+
+	a := tUtilFederationInstance(t, []string{"jackal.im", "jackal.org"})
+	b := tUtilFederationInstance(t, []string{"jabber.org"})
+	tUtilFederationStart(t, a, b)
+	defer tUtilFederationShutdown(a, b)
+
+	tUtilFederationRouteMessage(t, a, b, "jackal.im", "jabber.org")
+	tUtilFederationRouteMessage(t, a, b, "jackal.org", "jabber.org")
+
+	// both domain pairs should be multiplexed over the same connection
+	stm1 := tUtilFederationOutStream(t, a, "jackal.im", "jabber.org")
+	stm2 := tUtilFederationOutStream(t, a, "jackal.org", "jabber.org")
+	require.Equal(t, stm1.ID(), stm2.ID())
+}
+
+func tUtilFederationInstance(t *testing.T, domains []string) *fedInstance {
+	cer, certs := tUtilFederationCertificate(t, domains)
+
+	var hosts []router.HostConfig
+	for _, domain := range domains {
+		hosts = append(hosts, router.HostConfig{Name: domain, Certificate: cer})
+	}
+	r, err := router.New(&router.Config{Hosts: hosts})
+	require.Nil(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	cfg := &Config{
+		DialTimeout:    time.Second * 5,
+		ConnectTimeout: time.Second * 5,
+		MaxStanzaSize:  32768,
+		DialbackSecret: uuid.New(),
+		Transport: TransportConfig{
+			BindAddress: "127.0.0.1",
+			Port:        port,
+			KeepAlive:   time.Duration(600) * time.Second,
+		},
+	}
+	s := New(cfg, &module.Modules{}, r)
+	r.SetS2SOutProvider(s)
+
+	return &fedInstance{router: r, s2s: s, certs: certs, port: uint16(port)}
+}
+
+// tUtilFederationStart makes every instance domain resolvable to its local
+// listening address and starts accepting incoming connections.
+func tUtilFederationStart(t *testing.T, instances ...*fedInstance) {
+	tUtilFederationResolve(instances...)
+	for _, inst := range instances {
+		inst.s2s.Start()
+	}
+	// wait until listening...
+	deadline := time.Now().Add(time.Second * 5)
+	for _, inst := range instances {
+		for atomic.LoadUint32(&inst.s2s.srv.listening) == 0 {
+			if time.Now().After(deadline) {
+				require.Fail(t, "s2s server not listening")
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+}
+
+func tUtilFederationResolve(instances ...*fedInstance) {
+	ports := make(map[string]uint16)
+	for _, inst := range instances {
+		for _, domain := range inst.router.HostNames() {
+			ports[domain] = inst.port
+		}
+	}
+	for _, inst := range instances {
+		inst.s2s.srv.dialer.srvResolve = func(service, _, name string) (string, []*net.SRV, error) {
+			port, ok := ports[name]
+			if !ok || service != "xmpp-server" {
+				return "", nil, errors.New("federation: unknown domain")
+			}
+			return "", []*net.SRV{{Target: "127.0.0.1.", Port: port}}, nil
+		}
+	}
+}
+
+// tUtilFederationTrust makes every instance trust the others certificates.
+func tUtilFederationTrust(instances ...*fedInstance) {
+	rootCAs := x509.NewCertPool()
+	for _, inst := range instances {
+		for _, cert := range inst.certs {
+			rootCAs.AddCert(cert)
+		}
+	}
+	for _, inst := range instances {
+		inst.s2s.srv.cfg.RootCAs = rootCAs
+	}
+}
+
+func tUtilFederationShutdown(instances ...*fedInstance) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for _, inst := range instances {
+		inst.s2s.Shutdown(ctx)
+	}
+}
+
+func tUtilFederationRouteMessage(t *testing.T, from, to *fedInstance, fromDomain, toDomain string) {
+	fromJID, _ := jid.New("ortuman", fromDomain, "balcony", true)
+	toJID, _ := jid.New("noelia", toDomain, "garden", true)
+
+	stm := stream.NewMockC2S(uuid.New(), toJID)
+	to.router.Bind(stm)
+	defer to.router.Unbind(stm)
+
+	msgID := uuid.New()
+	msg := xmpp.NewMessageType(msgID, xmpp.ChatType)
+	msg.SetFromJID(fromJID)
+	msg.SetToJID(toJID)
+	require.Nil(t, from.router.Route(msg))
+
+	elem := stm.FetchElement()
+	require.NotNil(t, elem)
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, msgID, elem.ID())
+	require.Equal(t, fromJID.String(), elem.From())
+}
+
+func tUtilFederationOutStream(t *testing.T, inst *fedInstance, localDomain, remoteDomain string) *outStream {
+	stm, ok := inst.s2s.srv.outConns.Load(localDomain + ":" + remoteDomain)
+	require.True(t, ok)
+	return stm.(*outStream)
+}
+
+// tUtilFederationCertificate generates a self-signed certificate valid for a set of domains.
+func tUtilFederationCertificate(t *testing.T, domains []string) (tls.Certificate, []*x509.Certificate) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	require.Nil(t, err)
+
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: domains[0]},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              domains,
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	require.Nil(t, err)
+
+	cert, err := x509.ParseCertificate(derBytes)
+	require.Nil(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{derBytes}, PrivateKey: priv}, []*x509.Certificate{cert}
+}
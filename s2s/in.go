@@ -11,13 +11,17 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/ortuman/jackal/audit"
 	"github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
 	"github.com/ortuman/jackal/session"
+	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/pborman/uuid"
 )
 
 const (
@@ -38,16 +42,23 @@ type inStream struct {
 	sess          *session.Session
 	secured       uint32
 	authenticated uint32
+	authPairs     map[string]bool
+	ctx           *stream.Context
 	actorCh       chan func()
 }
 
 func newInStream(config *streamConfig, mods *module.Modules, router *router.Router) *inStream {
 	s := &inStream{
-		id:      nextInID(),
-		cfg:     config,
-		router:  router,
-		mods:    mods,
-		actorCh: make(chan func(), streamMailboxSize),
+		id:        nextInID(),
+		cfg:       config,
+		router:    router,
+		mods:      mods,
+		authPairs: make(map[string]bool),
+		ctx:       stream.NewContext(),
+		actorCh:   make(chan func(), streamMailboxSize),
+	}
+	if config.directTLS {
+		atomic.StoreUint32(&s.secured, 1)
 	}
 	// start s2s in session
 	s.restartSession()
@@ -64,6 +75,32 @@ func (s *inStream) ID() string {
 	return s.id
 }
 
+func (s *inStream) Context() *stream.Context {
+	return s.ctx
+}
+
+// logger returns a log entry carrying stream context fields.
+func (s *inStream) logger() *log.Entry {
+	return log.WithFields(log.Fields{
+		"stream_id":     s.id,
+		"remote_domain": s.remoteDomain,
+		"remote_addr":   s.cfg.remoteAddr,
+	})
+}
+
+// SendElement sends an element back to the remote server.
+// Server-to-server streams are unidirectional, so it will be
+// delivered by means of the corresponding outgoing stream.
+func (s *inStream) SendElement(elem xmpp.XElement) {
+	stanza, ok := elem.(xmpp.Stanza)
+	if !ok {
+		return
+	}
+	if err := s.router.Route(stanza); err != nil {
+		log.Error(err)
+	}
+}
+
 func (s *inStream) Disconnect(err error) {
 	if s.getState() == inDisconnected {
 		return
@@ -188,6 +225,10 @@ func (s *inStream) handleConnected(elem xmpp.XElement) {
 }
 
 func (s *inStream) processStanza(stanza xmpp.Stanza) {
+	if !s.isAuthorizedPair(stanza.ToJID().Domain(), stanza.FromJID().Domain()) {
+		s.disconnectWithStreamError(streamerror.ErrInvalidFrom)
+		return
+	}
 	switch stanza := stanza.(type) {
 	case *xmpp.Presence:
 		s.processPresence(stanza)
@@ -210,10 +251,31 @@ func (s *inStream) processPresence(presence *xmpp.Presence) {
 }
 
 func (s *inStream) processIQ(iq *xmpp.IQ) {
-	s.router.Route(iq)
+	toJID := iq.ToJID()
+	isRequest := iq.IsGet() || iq.IsSet()
+	switch {
+	case toJID.IsFullWithUser():
+		break
+	case s.mods.MatchesIQ(iq), toJID.IsServer() && isRequest:
+		// reply on behalf of local domain or bare account,
+		// or hand over a response to the module awaiting it
+		s.mods.ProcessIQ(iq, s)
+		return
+	}
+	switch s.router.Route(iq) {
+	case router.ErrResourceNotFound, router.ErrNotAuthenticated, router.ErrNotExistingAccount:
+		if isRequest {
+			s.SendElement(iq.ServiceUnavailableError())
+		}
+	}
 }
 
 func (s *inStream) processMessage(message *xmpp.Message) {
+	// XEP-0359: stamp messages addressed to local users,
+	// replacing any stanza ID forged by the remote entity
+	if toJID := message.ToJID(); len(toJID.Node()) > 0 {
+		message.SetStanzaID(toJID.ToBareJID().String(), uuid.New())
+	}
 	msg := message
 
 sendMessage:
@@ -247,14 +309,16 @@ func (s *inStream) proceedStartTLS(elem xmpp.XElement) {
 	}
 	s.writeElement(xmpp.NewElementNamespace("proceed", tlsNamespace))
 
+	// peer certificate chain is verified during external authentication,
+	// so that non trusted peers are still able to authenticate using dialback.
 	s.cfg.transport.StartTLS(&tls.Config{
 		ServerName:   s.localDomain,
-		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientAuth:   tls.RequestClientCert,
 		Certificates: s.router.Certificates(),
 	}, false)
 	atomic.StoreUint32(&s.secured, 1)
 
-	log.Infof("secured stream... id: %s", s.id)
+	s.logger().Infof("secured stream...")
 	s.restartSession()
 }
 
@@ -269,20 +333,18 @@ func (s *inStream) startAuthentication(elem xmpp.XElement) {
 	}
 	// validate initiating server certificate
 	certs := s.cfg.transport.PeerCertificates()
-	for _, cert := range certs {
-		for _, dnsName := range cert.DNSNames {
-			if dnsName == s.remoteDomain {
-				s.finishAuthentication()
-				return
-			}
-		}
+	if err := verifyPeerCertificate(certs, s.remoteDomain, s.cfg.rootCAs); err != nil {
+		s.failAuthentication("not-authorized", err.Error())
+		return
 	}
-	s.failAuthentication("bad-protocol", "failed to get peer certificate")
+	s.finishAuthentication()
 }
 
 func (s *inStream) finishAuthentication() {
-	log.Infof("s2s in stream authenticated")
+	s.logger().Infof("s2s in stream authenticated")
+	s.recordAudit(audit.S2SAuth, s.localDomain, s.remoteDomain, map[string]string{"method": "EXTERNAL"})
 	atomic.StoreUint32(&s.authenticated, 1)
+	s.authPairs[s.localDomain+":"+s.remoteDomain] = true
 
 	success := xmpp.NewElementNamespace("success", saslNamespace)
 	s.writeElement(success)
@@ -290,7 +352,8 @@ func (s *inStream) finishAuthentication() {
 }
 
 func (s *inStream) failAuthentication(reason, text string) {
-	log.Infof("failed s2s in stream authentication: %s (text: %s)", reason, text)
+	s.logger().Infof("failed s2s in stream authentication: %s (text: %s)", reason, text)
+	s.recordAudit(audit.S2SAuthFailure, s.localDomain, s.remoteDomain, map[string]string{"method": "EXTERNAL", "reason": reason})
 	failure := xmpp.NewElementNamespace("failure", saslNamespace)
 	failure.AppendElement(xmpp.NewElementName(reason))
 	if len(text) > 0 {
@@ -303,15 +366,19 @@ func (s *inStream) failAuthentication(reason, text string) {
 
 func (s *inStream) authorizeDialbackKey(elem xmpp.XElement) {
 	if !s.router.IsLocalHost(elem.To()) {
-		s.writeStanzaErrorResponse(elem, xmpp.ErrItemNotFound)
+		s.writeElement(newDialbackError(elem, xmpp.ErrItemNotFound))
 		return
 	}
-	log.Infof("authorizing dialback key: %s...", elem.Text())
+	if len(elem.From()) == 0 {
+		s.writeElement(newDialbackError(elem, xmpp.ErrBadRequest))
+		return
+	}
+	s.logger().Infof("authorizing dialback key: %s...", elem.Text())
 
 	outCfg, err := s.cfg.dialer.dial(elem.To(), elem.From())
 	if err != nil {
-		log.Error(err)
-		s.writeStanzaErrorResponse(elem, xmpp.ErrRemoteServerNotFound)
+		s.logger().Error(err)
+		s.writeElement(newDialbackError(elem, xmpp.ErrRemoteServerNotFound))
 		return
 	}
 	// create verify element
@@ -322,7 +389,7 @@ func (s *inStream) authorizeDialbackKey(elem xmpp.XElement) {
 	dbVerify.SetText(elem.Text())
 	outCfg.dbVerify = dbVerify
 
-	outStm := newOutStream(s.router)
+	outStm := newOutStream(s.router, elem.To(), elem.From())
 	outStm.start(outCfg)
 
 	// wait remote server verification
@@ -333,24 +400,26 @@ func (s *inStream) authorizeDialbackKey(elem xmpp.XElement) {
 		reply.SetTo(elem.From())
 		if valid {
 			reply.SetType("valid")
-			atomic.StoreUint32(&s.authenticated, 1)
+			s.authorizePair(elem.To(), elem.From())
+			s.recordAudit(audit.S2SAuth, elem.To(), elem.From(), map[string]string{"method": "dialback"})
 
 		} else {
 			reply.SetType("invalid")
+			s.recordAudit(audit.S2SAuthFailure, elem.To(), elem.From(), map[string]string{"method": "dialback", "reason": "invalid"})
 		}
 		s.writeElement(reply)
 		outStm.Disconnect(nil)
 
 	case <-outStm.done():
 		// remote server closed connection unexpectedly
-		s.writeStanzaErrorResponse(elem, xmpp.ErrRemoteServerTimeout)
+		s.writeElement(newDialbackError(elem, xmpp.ErrRemoteServerTimeout))
 		break
 	}
 }
 
 func (s *inStream) verifyDialbackKey(elem xmpp.XElement) {
 	if !s.router.IsLocalHost(elem.To()) {
-		s.writeStanzaErrorResponse(elem, xmpp.ErrItemNotFound)
+		s.writeElement(newDialbackError(elem, xmpp.ErrItemNotFound))
 		return
 	}
 	dbVerify := xmpp.NewElementName("db:verify")
@@ -360,15 +429,40 @@ func (s *inStream) verifyDialbackKey(elem xmpp.XElement) {
 
 	expectedKey := s.cfg.keyGen.generate(elem.From(), elem.To(), elem.ID())
 	if expectedKey == elem.Text() {
-		log.Infof("dialback key successfully verified... (key: %s)", elem.Text())
+		s.logger().Infof("dialback key successfully verified... (key: %s)", elem.Text())
 		dbVerify.SetType("valid")
 	} else {
-		log.Infof("failed dialback key verification... (expected: %s, got: %s)", expectedKey, elem.Text())
+		s.logger().Infof("failed dialback key verification... (expected: %s, got: %s)", expectedKey, elem.Text())
 		dbVerify.SetType("invalid")
 	}
 	s.writeElement(dbVerify)
 }
 
+func (s *inStream) authorizePair(localDomain, remoteDomain string) {
+	s.authPairs[localDomain+":"+remoteDomain] = true
+	if localDomain == s.localDomain && remoteDomain == s.remoteDomain {
+		atomic.StoreUint32(&s.authenticated, 1)
+	}
+}
+
+func (s *inStream) recordAudit(eventType, localDomain, remoteDomain string, details map[string]string) {
+	details["local_domain"] = localDomain
+	audit.Record(&model.AuditEvent{
+		Type:       eventType,
+		JID:        remoteDomain,
+		StreamID:   s.id,
+		RemoteAddr: s.cfg.remoteAddr,
+		Details:    details,
+	})
+}
+
+func (s *inStream) isAuthorizedPair(localDomain, remoteDomain string) bool {
+	if localDomain == s.localDomain && remoteDomain == s.remoteDomain && s.isAuthenticated() {
+		return true
+	}
+	return s.authPairs[localDomain+":"+remoteDomain]
+}
+
 func (s *inStream) writeStanzaErrorResponse(elem xmpp.XElement, stanzaErr *xmpp.StanzaError) {
 	resp := xmpp.NewElementFromElement(elem)
 	resp.SetType(xmpp.ErrorType)
@@ -400,7 +494,7 @@ func (s *inStream) handleSessionError(sErr *session.Error) {
 	case *xmpp.StanzaError:
 		s.writeStanzaErrorResponse(sErr.Element, err)
 	default:
-		log.Error(err)
+		s.logger().Error(err)
 		s.disconnectWithStreamError(streamerror.ErrUndefinedCondition)
 	}
 }
@@ -416,7 +510,7 @@ func (s *inStream) disconnect(err error) {
 		if stmErr, ok := err.(*streamerror.Error); ok {
 			s.disconnectWithStreamError(stmErr)
 		} else {
-			log.Error(err)
+			s.logger().Error(err)
 			s.disconnectClosingSession(false)
 		}
 	}
@@ -440,6 +534,7 @@ func (s *inStream) disconnectClosingSession(closeSession bool) {
 
 	s.setState(inDisconnected)
 	s.cfg.transport.Close()
+	s.ctx.Cancel()
 }
 
 func (s *inStream) restartSession() {
@@ -6,6 +6,7 @@
 package s2s
 
 import (
+	"context"
 	"crypto/x509"
 	"fmt"
 	"net"
@@ -91,6 +92,20 @@ func TestStream_Features(t *testing.T) {
 	require.Nil(t, elem.Elements().ChildNamespace("mechanisms", saslNamespace))
 	require.NotNil(t, elem.Elements().ChildNamespace("dialback", dialbackNamespace))
 	require.Equal(t, inConnected, stm.getState())
+
+	// direct TLS features
+	cfg, conn := tUtilInStreamDefaultConfig(t, false)
+	cfg.directTLS = true
+	stm = newInStream(cfg, &module.Modules{}, r)
+	tUtilInStreamOpen(conn)
+
+	elem = conn.outboundRead()
+	require.Equal(t, "stream:stream", elem.Name())
+
+	elem = conn.outboundRead()
+	require.Nil(t, elem.Elements().ChildNamespace("starttls", tlsNamespace))
+	require.NotNil(t, elem.Elements().ChildNamespace("mechanisms", saslNamespace))
+	require.Equal(t, inConnected, stm.getState())
 }
 
 func TestStream_TLS(t *testing.T) {
@@ -162,6 +177,21 @@ func TestStream_Authenticate(t *testing.T) {
 	require.Equal(t, "failure", elem.Name())
 	require.Equal(t, saslNamespace, elem.Namespace())
 
+	// untrusted peer certificate...
+	cfg, conn := tUtilInStreamDefaultConfig(t, true)
+	cfg.rootCAs = x509.NewCertPool()
+	stm = newInStream(cfg, &module.Modules{}, r)
+	tUtilInStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+	atomic.StoreUint32(&stm.secured, 1)
+
+	conn.inboundWriteString(`<auth xmlns="urn:ietf:params:xml:ns:xmpp-sasl" mechanism="EXTERNAL">=</auth>`)
+	elem = conn.outboundRead()
+	require.Equal(t, "failure", elem.Name())
+	require.NotNil(t, elem.Elements().Child("not-authorized"))
+	require.False(t, stm.isAuthenticated())
+
 	// invalid mechanism...
 	stm, conn = tUtilInStreamInit(t, r, true)
 	tUtilInStreamOpen(conn)
@@ -225,17 +255,28 @@ func TestStream_DialbackAuthorize(t *testing.T) {
 	atomic.StoreUint32(&stm.secured, 1)
 	atomic.StoreUint32(&stm.authenticated, 1)
 
-	conn.inboundWriteString(`<db:result to="foo.org">abcd</db:result>`)
+	conn.inboundWriteString(`<db:result from="localhost" to="foo.org">abcd</db:result>`)
 	elem := conn.outboundRead()
 	require.Equal(t, "db:result", elem.Name())
 	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, "", elem.Text()) // dialback key must not be echoed
 	require.NotNil(t, elem.Elements().Child("error"))
 	require.NotNil(t, elem.Elements().Child("error").Elements().Child("item-not-found"))
 
+	// missing from...
+	conn.inboundWriteString(`<db:result to="jackal.im">abcd</db:result>`)
+	elem = conn.outboundRead()
+	require.Equal(t, "db:result", elem.Name())
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Elements().Child("error").Elements().Child("bad-request"))
+
 	cfg, conn := tUtilInStreamDefaultConfig(t, false)
-	cfg.dialer = &dialer{router: r}
+	cfg.dialer = &dialer{cfg: &Config{DialTimeout: time.Second}, router: r}
 	cfg.dialer.srvResolve = func(_, _, _ string) (cname string, addrs []*net.SRV, err error) {
-		return "", nil, errors.New("mocked dialer error")
+		return "", nil, errors.New("mocked resolver error")
+	}
+	cfg.dialer.dialTimeout = func(_, _ string, _ time.Duration) (net.Conn, error) {
+		return nil, errors.New("mocked dialer error")
 	}
 	stm = newInStream(cfg, &module.Modules{}, r)
 
@@ -245,7 +286,7 @@ func TestStream_DialbackAuthorize(t *testing.T) {
 	atomic.StoreUint32(&stm.secured, 1)
 	atomic.StoreUint32(&stm.authenticated, 1)
 
-	conn.inboundWriteString(`<db:result to="jackal.im">abcd</db:result>`)
+	conn.inboundWriteString(`<db:result from="localhost" to="jackal.im">abcd</db:result>`)
 	elem = conn.outboundRead()
 	require.Equal(t, "db:result", elem.Name())
 	require.Equal(t, xmpp.ErrorType, elem.Type())
@@ -254,9 +295,7 @@ func TestStream_DialbackAuthorize(t *testing.T) {
 
 	cfg, conn = tUtilInStreamDefaultConfig(t, false)
 	cfg.dialer = &dialer{cfg: &Config{DialTimeout: time.Second}, router: r}
-	cfg.dialer.srvResolve = func(_, _, _ string) (cname string, addrs []*net.SRV, err error) {
-		return "", []*net.SRV{{Target: "jackal.im", Port: 5269}}, nil
-	}
+	cfg.dialer.srvResolve = tUtilSRVResolve("jackal.im", 5269)
 	outConn := newFakeSocketConn()
 	cfg.dialer.dialTimeout = func(_, _ string, _ time.Duration) (net.Conn, error) {
 		return outConn, nil
@@ -269,7 +308,7 @@ func TestStream_DialbackAuthorize(t *testing.T) {
 	atomic.StoreUint32(&stm.secured, 1)
 	atomic.StoreUint32(&stm.authenticated, 1)
 
-	conn.inboundWriteString(`<db:result to="jackal.im">abcd</db:result>`)
+	conn.inboundWriteString(`<db:result from="localhost" to="jackal.im">abcd</db:result>`)
 	outConn.Close()
 	elem = conn.outboundRead()
 	require.Equal(t, "db:result", elem.Name())
@@ -280,9 +319,7 @@ func TestStream_DialbackAuthorize(t *testing.T) {
 	// authorize dialback key
 	cfg, conn = tUtilInStreamDefaultConfig(t, false)
 	cfg.dialer = &dialer{cfg: &Config{DialTimeout: time.Second}, router: r}
-	cfg.dialer.srvResolve = func(_, _, _ string) (cname string, addrs []*net.SRV, err error) {
-		return "", []*net.SRV{{Target: "jackal.im", Port: 5269}}, nil
-	}
+	cfg.dialer.srvResolve = tUtilSRVResolve("jackal.im", 5269)
 	outConn = newFakeSocketConn()
 	cfg.dialer.dialTimeout = func(_, _ string, _ time.Duration) (net.Conn, error) {
 		return outConn, nil
@@ -295,7 +332,7 @@ func TestStream_DialbackAuthorize(t *testing.T) {
 	atomic.StoreUint32(&stm.secured, 1)
 	atomic.StoreUint32(&stm.authenticated, 1)
 
-	conn.inboundWriteString(`<db:result to="jackal.im">abcd</db:result>`)
+	conn.inboundWriteString(`<db:result from="localhost" to="jackal.im">abcd</db:result>`)
 
 	outConn.inboundWriteString(`
 <?xml version="1.0"?>
@@ -365,12 +402,127 @@ func TestStream_SendElement(t *testing.T) {
 	require.Equal(t, xmpp.ResultType, elem.Type())
 	require.Equal(t, iqID, elem.ID())
 
+	// messages get stamped...
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(fromJID)
+	msg.SetToJID(toJID)
+	msg.SetStanzaID("ortuman@jackal.im", "forged")
+	conn.inboundWriteString(msg.String())
+
+	elem = stm2.FetchElement()
+	require.Equal(t, "message", elem.Name())
+	sids := elem.Elements().ChildrenNamespace("stanza-id", "urn:xmpp:sid:0")
+	require.Equal(t, 1, len(sids))
+	require.NotEqual(t, "forged", sids[0].Attributes().Get("id"))
+
 	// invalid from...
 	iq.SetFrom("foo.org")
 	conn.inboundWriteString(iq.String())
 	require.True(t, conn.waitClose())
 }
 
+type fakeS2SOut struct {
+	elemCh chan xmpp.XElement
+}
+
+func (f *fakeS2SOut) ID() string                     { return "s2s:out:fake" }
+func (f *fakeS2SOut) SendElement(elem xmpp.XElement) { f.elemCh <- elem }
+func (f *fakeS2SOut) Context() *stream.Context       { return stream.NewContext() }
+func (f *fakeS2SOut) Disconnect(err error)           {}
+
+func (f *fakeS2SOut) GetS2SOut(localDomain, remoteDomain string) (stream.S2SOut, error) {
+	return f, nil
+}
+
+func TestStream_ProcessIQ(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	out := &fakeS2SOut{elemCh: make(chan xmpp.XElement, 8)}
+	r.SetS2SOutProvider(out)
+
+	mods := module.New(&module.Config{
+		Enabled: map[string]struct{}{"roster": {}, "version": {}, "ping": {}},
+	}, r)
+	defer mods.Shutdown(context.Background())
+
+	cfg, conn := tUtilInStreamDefaultConfig(t, false)
+	stm := newInStream(cfg, mods, r)
+	tUtilInStreamOpen(conn)
+	_ = conn.outboundRead() // read stream opening...
+	_ = conn.outboundRead() // read stream features...
+	atomic.StoreUint32(&stm.secured, 1)
+	atomic.StoreUint32(&stm.authenticated, 1)
+
+	fromJID, _ := jid.New("ortuman", "localhost", "garden", true)
+	srvJID, _ := jid.New("", "jackal.im", "", true)
+
+	// server ping
+	iqID := uuid.New()
+	iq := xmpp.NewIQType(iqID, xmpp.GetType)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xmpp.NewElementNamespace("ping", "urn:xmpp:ping"))
+	conn.inboundWriteString(iq.String())
+
+	elem := <-out.elemCh
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Equal(t, iqID, elem.ID())
+	require.Equal(t, fromJID.String(), elem.To())
+
+	// software version
+	iqID = uuid.New()
+	iq = xmpp.NewIQType(iqID, xmpp.GetType)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(srvJID)
+	iq.AppendElement(xmpp.NewElementNamespace("query", "jabber:iq:version"))
+	conn.inboundWriteString(iq.String())
+
+	elem = <-out.elemCh
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.NotNil(t, elem.Elements().ChildNamespace("query", "jabber:iq:version"))
+
+	// client only module
+	toJID, _ := jid.New("noelia", "jackal.im", "", true)
+	iqID = uuid.New()
+	iq = xmpp.NewIQType(iqID, xmpp.GetType)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(toJID)
+	iq.AppendElement(xmpp.NewElementNamespace("query", "jabber:iq:roster"))
+	conn.inboundWriteString(iq.String())
+
+	elem = <-out.elemCh
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Elements().Child("error").Elements().Child("service-unavailable"))
+
+	// responses and unclaimed requests addressed to a bare account are routed
+	noeliaJID, _ := jid.New("noelia", "jackal.im", "balcony", true)
+	noeliaStm := stream.NewMockC2S(uuid.New(), noeliaJID)
+	r.Bind(noeliaStm)
+
+	iqID = uuid.New()
+	iq = xmpp.NewIQType(iqID, xmpp.ResultType)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(toJID)
+	conn.inboundWriteString(iq.String())
+
+	elem = noeliaStm.FetchElement()
+	require.Equal(t, xmpp.ResultType, elem.Type())
+	require.Equal(t, iqID, elem.ID())
+
+	iqID = uuid.New()
+	iq = xmpp.NewIQType(iqID, xmpp.GetType)
+	iq.SetFromJID(fromJID)
+	iq.SetToJID(toJID)
+	iq.AppendElement(xmpp.NewElementNamespace("query", "urn:xmpp:custom"))
+	conn.inboundWriteString(iq.String())
+
+	elem = noeliaStm.FetchElement()
+	require.Equal(t, xmpp.GetType, elem.Type())
+	require.Equal(t, iqID, elem.ID())
+}
+
 func tUtilInStreamInit(t *testing.T, router *router.Router, loadPeerCertificate bool) (*inStream, *fakeSocketConn) {
 	cfg, conn := tUtilInStreamDefaultConfig(t, loadPeerCertificate)
 	stm := newInStream(cfg, &module.Modules{}, router)
@@ -403,12 +555,14 @@ func tUtilInStreamDefaultConfig(t *testing.T, loadPeerCertificate bool) (*stream
 	require.Nil(t, err)
 
 	var peerCerts []*x509.Certificate
+	rootCAs := x509.NewCertPool()
 	if loadPeerCertificate {
 		for _, asn1Data := range cer.Certificate {
 			cr, err := x509.ParseCertificate(asn1Data)
 			require.Nil(t, err)
 			cr.DNSNames = []string{"localhost"}
 			peerCerts = append(peerCerts, cr)
+			rootCAs.AddCert(cr)
 		}
 	}
 
@@ -424,6 +578,7 @@ func tUtilInStreamDefaultConfig(t *testing.T, loadPeerCertificate bool) (*stream
 		},
 		connectTimeout: time.Second,
 		transport:      tr,
+		rootCAs:        rootCAs,
 		maxStanzaSize:  8192,
 		keyGen:         &keyGen{secret: "s3cr3t"},
 	}, conn
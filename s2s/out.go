@@ -8,6 +8,7 @@ package s2s
 import (
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
@@ -19,7 +20,8 @@ import (
 )
 
 const (
-	outConnecting uint32 = iota
+	outDialing uint32 = iota
+	outConnecting
 	outConnected
 	outSecuring
 	outAuthenticating
@@ -30,34 +32,68 @@ const (
 )
 
 type outStream struct {
-	started       uint32
-	id            string
-	cfg           *streamConfig
-	router        *router.Router
-	state         uint32
-	sess          *session.Session
-	secured       uint32
-	authenticated uint32
-	actorCh       chan func()
-	sendQueue     []xmpp.XElement
-	verified      chan xmpp.XElement
-	verifyCh      chan bool
-	discCh        chan *streamerror.Error
-	onDisconnect  func(s stream.S2SOut)
-}
-
-func newOutStream(router *router.Router) *outStream {
-	return &outStream{
-		id:       nextOutID(),
-		router:   router,
-		actorCh:  make(chan func(), streamMailboxSize),
-		verifyCh: make(chan bool, 1),
-		discCh:   make(chan *streamerror.Error, 1),
+	started          uint32
+	id               string
+	localDomain      string
+	remoteDomain     string
+	cfg              *streamConfig
+	router           *router.Router
+	state            uint32
+	sess             *session.Session
+	secured          uint32
+	authenticated    uint32
+	dialbackOffered  bool
+	externalFailed   bool
+	connectTm        *time.Timer
+	idleTm           *time.Timer
+	lastActivity     time.Time
+	ctx              *stream.Context
+	actorCh          chan func()
+	sendQueue        []xmpp.XElement
+	pendingDomains   map[string][]xmpp.XElement
+	authorizedDomain map[string]bool // false value denotes a rejected domain
+	verified         chan xmpp.XElement
+	verifyCh         chan bool
+	discCh           chan *streamerror.Error
+	onDisconnect     func(s stream.S2SOut)
+}
+
+func newOutStream(router *router.Router, localDomain, remoteDomain string) *outStream {
+	s := &outStream{
+		id:               nextOutID(),
+		localDomain:      localDomain,
+		remoteDomain:     remoteDomain,
+		router:           router,
+		ctx:              stream.NewContext(),
+		actorCh:          make(chan func(), streamMailboxSize),
+		pendingDomains:   make(map[string][]xmpp.XElement),
+		authorizedDomain: make(map[string]bool),
+		verifyCh:         make(chan bool, 1),
+		discCh:           make(chan *streamerror.Error, 1),
 	}
+	// elements will be queued until the remote server connection has been established
+	go s.loop()
+	return s
 }
 
 func (s *outStream) ID() string {
-	return s.cfg.localDomain + ":" + s.cfg.remoteDomain
+	return s.localDomain + ":" + s.remoteDomain
+}
+
+func (s *outStream) Context() *stream.Context {
+	return s.ctx
+}
+
+// logger returns a log entry carrying stream context fields.
+func (s *outStream) logger() *log.Entry {
+	if s.cfg == nil {
+		return log.WithFields(nil) // still dialing
+	}
+	return log.WithFields(log.Fields{
+		"local_domain":  s.cfg.localDomain,
+		"remote_domain": s.cfg.remoteDomain,
+		"remote_addr":   s.cfg.remoteAddr,
+	})
 }
 
 func (s *outStream) SendElement(elem xmpp.XElement) {
@@ -65,6 +101,15 @@ func (s *outStream) SendElement(elem xmpp.XElement) {
 		return
 	}
 	s.actorCh <- func() {
+		localDomain := domainOf(elem.From())
+		if q, ok := s.pendingDomains[localDomain]; ok {
+			// send element after domain pair has been authorized
+			s.pendingDomains[localDomain] = append(q, elem)
+			return
+		}
+		if authorized, ok := s.authorizedDomain[localDomain]; ok && !authorized {
+			return // domain pair not authorized by remote server
+		}
 		if s.getState() != outVerified {
 			// send element after verification has been completed
 			s.sendQueue = append(s.sendQueue, elem)
@@ -86,27 +131,96 @@ func (s *outStream) Disconnect(err error) {
 	<-waitCh
 }
 
+// authorizeDomain requests remote server to authorize an additional
+// local domain to be multiplexed over this connection (XEP-0220 piggybacking).
+func (s *outStream) authorizeDomain(localDomain string) {
+	if s.getState() == outDisconnected {
+		return
+	}
+	s.actorCh <- func() {
+		if _, ok := s.pendingDomains[localDomain]; ok {
+			return // authorization already requested
+		}
+		if localDomain == s.cfg.localDomain || s.authorizedDomain[localDomain] {
+			return
+		}
+		s.pendingDomains[localDomain] = nil
+		if s.getState() == outVerified {
+			s.requestDomainAuthorization(localDomain)
+		}
+	}
+}
+
 func (s *outStream) start(cfg *streamConfig) error {
 	if cfg.dbVerify != nil && cfg.dbVerify.Name() != "db:verify" {
 		return fmt.Errorf("wrong dialback verification element name: %s", cfg.dbVerify.Name())
 	}
 	if !atomic.CompareAndSwapUint32(&s.started, 0, 1) {
-		return fmt.Errorf("stream already started (domainpair: %s)", s.ID())
+		return fmt.Errorf("stream already started (domainpair: %s:%s)", cfg.localDomain, cfg.remoteDomain)
 	}
-	s.cfg = cfg
-
-	// start s2s out session
-	s.restartSession()
+	s.actorCh <- func() {
+		if s.getState() == outDisconnected {
+			cfg.transport.Close() // disconnected while dialing...
+			return
+		}
+		s.cfg = cfg
+		if cfg.directTLS {
+			atomic.StoreUint32(&s.secured, 1)
+		}
+		// start s2s out session
+		s.restartSession()
 
-	go s.loop()
-	go s.doRead() // start reading transport...
+		if cfg.connectTimeout > 0 {
+			s.connectTm = time.AfterFunc(cfg.connectTimeout, s.connectTimeout)
+		}
+		go s.doRead() // start reading transport...
 
-	s.actorCh <- func() {
 		s.sess.Open()
 	}
 	return nil
 }
 
+// dialFailed bounces every queued stanza back to its
+// sender in case remote server couldn't be reached.
+func (s *outStream) dialFailed(stanzaErr *xmpp.StanzaError) {
+	if s.getState() == outDisconnected {
+		return
+	}
+	s.actorCh <- func() {
+		s.abort(stanzaErr)
+	}
+}
+
+func (s *outStream) connectTimeout() {
+	if s.getState() == outDisconnected {
+		return
+	}
+	s.actorCh <- func() {
+		if s.getState() == outDisconnected || s.getState() == outVerified {
+			return
+		}
+		s.bounceQueued(xmpp.ErrRemoteServerTimeout)
+		s.disconnectWithStreamError(streamerror.ErrConnectionTimeout)
+	}
+}
+
+func (s *outStream) idleTimeout() {
+	if s.getState() == outDisconnected {
+		return
+	}
+	s.actorCh <- func() {
+		if s.getState() != outVerified {
+			return
+		}
+		if elapsed := time.Since(s.lastActivity); elapsed < s.cfg.idleTimeout {
+			s.idleTm.Reset(s.cfg.idleTimeout - elapsed)
+			return
+		}
+		s.logger().Infof("closing idle s2s out stream...")
+		s.disconnectClosingSession(true)
+	}
+}
+
 func (s *outStream) verify() <-chan bool {
 	return s.verifyCh
 }
@@ -156,6 +270,8 @@ func (s *outStream) handleElement(elem xmpp.XElement) {
 		s.handleValidatingDialbackKey(elem)
 	case outAuthorizingDialbackKey:
 		s.handleAuthorizingDialbackKey(elem)
+	case outVerified:
+		s.handleVerified(elem)
 	}
 }
 
@@ -194,20 +310,18 @@ func (s *outStream) handleConnected(elem xmpp.XElement) {
 					}
 				}
 			}
-			if hasExternalAuth {
+			s.dialbackOffered = elem.Elements().ChildNamespace("dialback", dialbackNamespace) != nil
+
+			// only attempt external authentication if remote server identity can be verified
+			if hasExternalAuth && !s.externalFailed && s.isRemoteCertificateTrusted() {
 				auth := xmpp.NewElementNamespace("auth", saslNamespace)
 				auth.SetAttribute("mechanism", "EXTERNAL")
 				auth.SetText("=")
 				s.writeElement(auth)
 				s.setState(outAuthenticating)
 
-			} else if elem.Elements().ChildrenNamespace("dialback", dialbackNamespace) != nil {
-				db := xmpp.NewElementName("db:result")
-				db.SetFrom(s.cfg.localDomain)
-				db.SetTo(s.cfg.remoteDomain)
-				db.SetText(s.cfg.keyGen.generate(s.cfg.remoteDomain, s.cfg.localDomain, s.sess.StreamID()))
-				s.writeElement(db)
-				s.setState(outValidatingDialbackKey)
+			} else if s.dialbackOffered {
+				s.startDialback()
 
 			} else {
 				// no verification mechanism found... do not allow remote connection
@@ -219,6 +333,15 @@ func (s *outStream) handleConnected(elem xmpp.XElement) {
 	}
 }
 
+func (s *outStream) startDialback() {
+	db := xmpp.NewElementName("db:result")
+	db.SetFrom(s.cfg.localDomain)
+	db.SetTo(s.cfg.remoteDomain)
+	db.SetText(s.cfg.keyGen.generate(s.cfg.remoteDomain, s.cfg.localDomain, s.sess.StreamID()))
+	s.writeElement(db)
+	s.setState(outValidatingDialbackKey)
+}
+
 func (s *outStream) handleSecuring(elem xmpp.XElement) {
 	if elem.Name() != "proceed" {
 		s.disconnectWithStreamError(streamerror.ErrUnsupportedStanzaType)
@@ -247,7 +370,13 @@ func (s *outStream) handleAuthenticating(elem xmpp.XElement) {
 		atomic.StoreUint32(&s.authenticated, 1)
 
 	case "failure":
-		s.disconnectWithStreamError(streamerror.ErrRemoteConnectionFailed)
+		s.externalFailed = true
+		if !s.dialbackOffered {
+			s.disconnectWithStreamError(streamerror.ErrRemoteConnectionFailed)
+			return
+		}
+		s.logger().Infof("s2s out stream external authentication failed... falling back to dialback")
+		s.startDialback()
 
 	default:
 		s.disconnectWithStreamError(streamerror.ErrUnsupportedStanzaType)
@@ -263,11 +392,15 @@ func (s *outStream) handleValidatingDialbackKey(elem xmpp.XElement) {
 		}
 		switch elem.Type() {
 		case "valid":
-			log.Infof("s2s out stream successfully validated... (domainpair: %s)", s.ID())
+			s.logger().Infof("s2s out stream successfully validated...")
 			s.finishVerification()
 
+		case xmpp.ErrorType:
+			s.logger().Infof("s2s out stream validation error: %s", dialbackErrorReason(elem))
+			s.disconnectWithStreamError(streamerror.ErrRemoteConnectionFailed)
+
 		default:
-			log.Infof("failed s2s out stream validation... (domainpair: %s)", s.ID())
+			s.logger().Infof("failed s2s out stream validation...")
 			s.disconnectWithStreamError(streamerror.ErrRemoteConnectionFailed)
 		}
 	}
@@ -276,6 +409,9 @@ func (s *outStream) handleValidatingDialbackKey(elem xmpp.XElement) {
 func (s *outStream) handleAuthorizingDialbackKey(elem xmpp.XElement) {
 	switch elem.Name() {
 	case "db:verify":
+		if elem.Type() == xmpp.ErrorType {
+			s.logger().Infof("s2s out stream dialback verification error: %s", dialbackErrorReason(elem))
+		}
 		s.verifyCh <- elem.Type() == "valid"
 
 	default:
@@ -283,13 +419,103 @@ func (s *outStream) handleAuthorizingDialbackKey(elem xmpp.XElement) {
 	}
 }
 
+func (s *outStream) handleVerified(elem xmpp.XElement) {
+	switch elem.Name() {
+	case "db:result":
+		localDomain := elem.To()
+		q, ok := s.pendingDomains[localDomain]
+		if !ok || elem.From() != s.cfg.remoteDomain {
+			s.disconnectWithStreamError(streamerror.ErrInvalidFrom)
+			return
+		}
+		delete(s.pendingDomains, localDomain)
+
+		switch elem.Type() {
+		case "valid":
+			s.logger().Infof("s2s out stream domain pair successfully validated... (domainpair: %s:%s)", localDomain, s.cfg.remoteDomain)
+			s.authorizedDomain[localDomain] = true
+			for _, el := range q {
+				s.writeElement(el)
+			}
+
+		case xmpp.ErrorType:
+			s.logger().Infof("s2s out stream domain pair validation error: %s (domainpair: %s:%s)", dialbackErrorReason(elem), localDomain, s.cfg.remoteDomain)
+			s.discardDomain(localDomain, q)
+
+		default:
+			s.logger().Infof("failed s2s out stream domain pair validation... (domainpair: %s:%s)", localDomain, s.cfg.remoteDomain)
+			s.discardDomain(localDomain, q)
+		}
+	}
+}
+
 func (s *outStream) finishVerification() {
+	if s.connectTm != nil {
+		s.connectTm.Stop()
+	}
+	if s.cfg.idleTimeout > 0 {
+		s.lastActivity = time.Now()
+		s.idleTm = time.AfterFunc(s.cfg.idleTimeout, s.idleTimeout)
+	}
 	// send pending elements...
 	for _, el := range s.sendQueue {
 		s.writeElement(el)
 	}
 	s.sendQueue = nil
 	s.setState(outVerified)
+
+	// request pending domain pairs authorization
+	for localDomain := range s.pendingDomains {
+		s.requestDomainAuthorization(localDomain)
+	}
+}
+
+func (s *outStream) requestDomainAuthorization(localDomain string) {
+	db := xmpp.NewElementName("db:result")
+	db.SetFrom(localDomain)
+	db.SetTo(s.cfg.remoteDomain)
+	db.SetText(s.cfg.keyGen.generate(s.cfg.remoteDomain, localDomain, s.sess.StreamID()))
+	s.writeElement(db)
+}
+
+func (s *outStream) discardDomain(localDomain string, queue []xmpp.XElement) {
+	s.authorizedDomain[localDomain] = false
+	s.bounce(queue, xmpp.ErrRemoteServerNotFound)
+	if s.cfg.onOutPairFailed != nil {
+		s.cfg.onOutPairFailed(localDomain, s.cfg.remoteDomain)
+	}
+}
+
+// bounceQueued returns an error to the senders of every
+// element not yet delivered to the remote server.
+func (s *outStream) bounceQueued(stanzaErr *xmpp.StanzaError) {
+	s.bounce(s.sendQueue, stanzaErr)
+	s.sendQueue = nil
+	for localDomain, q := range s.pendingDomains {
+		s.bounce(q, stanzaErr)
+		s.pendingDomains[localDomain] = nil
+	}
+}
+
+func (s *outStream) bounce(elems []xmpp.XElement, stanzaErr *xmpp.StanzaError) {
+	for _, elem := range elems {
+		stanza, ok := elem.(xmpp.Stanza)
+		if !ok || stanza.Type() == xmpp.ErrorType {
+			continue // never bounce an error
+		}
+		if err := s.router.Route(xmpp.NewErrorStanzaFromStanza(stanza, stanzaErr, nil)); err != nil {
+			s.logger().Infof("couldn't bounce s2s out stanza: %v", err)
+		}
+	}
+}
+
+func (s *outStream) isRemoteCertificateTrusted() bool {
+	err := verifyPeerCertificate(s.cfg.transport.PeerCertificates(), s.cfg.remoteDomain, s.cfg.rootCAs)
+	if err != nil {
+		s.logger().Infof("untrusted s2s remote certificate: %v", err)
+		return false
+	}
+	return true
 }
 
 func (s *outStream) writeStanzaErrorResponse(elem xmpp.XElement, stanzaErr *xmpp.StanzaError) {
@@ -302,11 +528,13 @@ func (s *outStream) writeStanzaErrorResponse(elem xmpp.XElement, stanzaErr *xmpp
 }
 
 func (s *outStream) writeElement(elem xmpp.XElement) {
+	s.lastActivity = time.Now()
 	s.sess.Send(elem)
 }
 
 func (s *outStream) readElement(elem xmpp.XElement) {
 	if elem != nil {
+		s.lastActivity = time.Now()
 		s.handleElement(elem)
 	}
 	if s.getState() != outDisconnected {
@@ -323,12 +551,16 @@ func (s *outStream) handleSessionError(sErr *session.Error) {
 	case *xmpp.StanzaError:
 		s.writeStanzaErrorResponse(sErr.Element, err)
 	default:
-		log.Error(err)
+		s.logger().Error(err)
 		s.disconnectWithStreamError(streamerror.ErrUndefinedCondition)
 	}
 }
 
 func (s *outStream) disconnect(err error) {
+	if s.getState() == outDialing {
+		s.abort(xmpp.ErrRemoteServerNotFound)
+		return
+	}
 	switch err {
 	case nil:
 		s.disconnectClosingSession(false)
@@ -336,7 +568,7 @@ func (s *outStream) disconnect(err error) {
 		if stmErr, ok := err.(*streamerror.Error); ok {
 			s.disconnectWithStreamError(stmErr)
 		} else {
-			log.Error(err)
+			s.logger().Error(err)
 			s.disconnectClosingSession(false)
 		}
 	}
@@ -349,6 +581,15 @@ func (s *outStream) disconnectWithStreamError(err *streamerror.Error) {
 }
 
 func (s *outStream) disconnectClosingSession(closeSession bool) {
+	if s.connectTm != nil {
+		s.connectTm.Stop()
+	}
+	if s.idleTm != nil {
+		s.idleTm.Stop()
+	}
+	// elements could not be delivered...
+	s.bounceQueued(xmpp.ErrRemoteServerNotFound)
+
 	if closeSession {
 		s.sess.Close()
 	}
@@ -358,10 +599,22 @@ func (s *outStream) disconnectClosingSession(closeSession bool) {
 
 	s.setState(outDisconnected)
 	s.cfg.transport.Close()
+	s.ctx.Cancel()
 
 	close(s.discCh)
 }
 
+// abort terminates a stream that never got connected to the remote server.
+func (s *outStream) abort(stanzaErr *xmpp.StanzaError) {
+	if s.getState() == outDisconnected {
+		return
+	}
+	s.bounceQueued(stanzaErr)
+	s.setState(outDisconnected)
+	s.ctx.Cancel()
+	close(s.discCh)
+}
+
 func (s *outStream) restartSession() {
 	j, _ := jid.New("", s.cfg.localDomain, "", true)
 	s.sess = session.New(s.id, &session.Config{
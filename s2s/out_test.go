@@ -6,6 +6,7 @@
 package s2s
 
 import (
+	"crypto/x509"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -16,8 +17,11 @@ import (
 	"github.com/ortuman/jackal/module/xep0092"
 	"github.com/ortuman/jackal/module/xep0199"
 	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/stream"
 	"github.com/ortuman/jackal/transport"
+	"github.com/ortuman/jackal/util"
 	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/require"
 )
@@ -27,7 +31,7 @@ func TestOutStream_Start(t *testing.T) {
 	defer shutdown()
 
 	cfg, _ := tUtilOutStreamDefaultConfig()
-	stm := newOutStream(r)
+	stm := newOutStream(r, "jackal.im", "jabber.org")
 	defer stm.Disconnect(nil)
 
 	// wrong verification name...
@@ -41,12 +45,22 @@ func TestOutStream_Start(t *testing.T) {
 	require.NotNil(t, err) // already started
 }
 
+func TestOutStream_ID(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	// still dialing
+	stm := newOutStream(r, "jackal.im", "jabber.org")
+	defer stm.Disconnect(nil)
+	require.Equal(t, "jackal.im:jabber.org", stm.ID())
+}
+
 func TestOutStream_Disconnect(t *testing.T) {
 	r, _, shutdown := setupTest(jackaDomain)
 	defer shutdown()
 
 	cfg, conn := tUtilOutStreamDefaultConfig()
-	stm := newOutStream(r)
+	stm := newOutStream(r, "jackal.im", "jabber.org")
 	stm.start(cfg)
 	stm.Disconnect(nil)
 	require.True(t, conn.waitClose())
@@ -230,11 +244,37 @@ func TestOutStream_Authenticate(t *testing.T) {
 	conn.inboundWriteString(securedFeaturesWithExternal)
 	_ = conn.outboundRead()
 
+	// failed external authentication... fallback to dialback
+	conn.inboundWriteString(`
+<failure xmlns="urn:ietf:params:xml:ns:xmpp-sasl"/>
+`)
+	elem = conn.outboundRead()
+	require.Equal(t, "db:result", elem.Name())
+	require.Equal(t, "jabber.org", elem.To())
+
+	// failed external authentication... dialback not offered
+	stm, conn = tUtilOutStreamInit(t, r)
+	tUtilOutStreamOpen(conn)
+	atomic.StoreUint32(&stm.secured, 1)
+	conn.inboundWriteString(securedFeaturesExternalOnly)
+	_ = conn.outboundRead()
+
 	conn.inboundWriteString(`
 <failure xmlns="urn:ietf:params:xml:ns:xmpp-sasl"/>
 `)
 	require.True(t, conn.waitClose())
 
+	// untrusted remote certificate... use dialback
+	cfg, conn := tUtilOutStreamDefaultConfig()
+	cfg.rootCAs = x509.NewCertPool()
+	stm = tUtilOutStreamInitWithConfig(t, r, cfg, conn)
+	tUtilOutStreamOpen(conn)
+	atomic.StoreUint32(&stm.secured, 1)
+	conn.inboundWriteString(securedFeaturesWithExternal)
+
+	elem = conn.outboundRead()
+	require.Equal(t, "db:result", elem.Name())
+
 	stm, conn = tUtilOutStreamInit(t, r)
 	tUtilOutStreamOpen(conn)
 	atomic.StoreUint32(&stm.secured, 1)
@@ -292,6 +332,20 @@ func TestOutStream_Dialback(t *testing.T) {
 `)
 	require.True(t, conn.waitClose())
 
+	// dialback error
+	stm, conn = tUtilOutStreamInit(t, r)
+	tUtilOutStreamOpen(conn)
+	atomic.StoreUint32(&stm.secured, 1)
+	conn.inboundWriteString(securedFeatures)
+	_ = conn.outboundRead()
+
+	conn.inboundWriteString(`
+<db:result from="jabber.org" to="jackal.im" type="error">
+<error type="cancel"><item-not-found xmlns="urn:ietf:params:xml:ns:xmpp-stanzas"/></error>
+</db:result>
+`)
+	require.True(t, conn.waitClose())
+
 	// successful
 	stm, conn = tUtilOutStreamInit(t, r)
 	tUtilOutStreamOpen(conn)
@@ -312,6 +366,130 @@ func TestOutStream_Dialback(t *testing.T) {
 	require.Equal(t, iqID, elem.ID())
 }
 
+func TestOutStream_Piggyback(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	stm, conn := tUtilOutStreamInit(t, r)
+	tUtilOutStreamOpen(conn)
+	atomic.StoreUint32(&stm.secured, 1)
+
+	var failedPairs []string
+	failedCh := make(chan struct{}, 1)
+	stm.cfg.onOutPairFailed = func(localDomain, remoteDomain string) {
+		failedPairs = append(failedPairs, localDomain+":"+remoteDomain)
+		failedCh <- struct{}{}
+	}
+	conn.inboundWriteString(securedFeatures)
+	_ = conn.outboundRead()
+
+	// authorize additional domain before verification completes...
+	stm.authorizeDomain("jackal.org")
+
+	iqID := uuid.New()
+	iq := xmpp.NewIQType(iqID, xmpp.GetType)
+	iq.SetFrom("jackal.org")
+	iq.SetTo("jabber.org")
+	stm.SendElement(iq) //...store pending until authorized...
+
+	conn.inboundWriteString(`
+<db:result from="jabber.org" to="jackal.im" type="valid"/>
+`)
+	elem := conn.outboundRead()
+	require.Equal(t, "db:result", elem.Name())
+	require.Equal(t, "jackal.org", elem.From())
+	require.Equal(t, "jabber.org", elem.To())
+
+	conn.inboundWriteString(`
+<db:result from="jabber.org" to="jackal.org" type="valid"/>
+`)
+	elem = conn.outboundRead()
+	require.Equal(t, "iq", elem.Name())
+	require.Equal(t, iqID, elem.ID())
+
+	// rejected domain pair
+	stm.authorizeDomain("jackal.net")
+	elem = conn.outboundRead()
+	require.Equal(t, "db:result", elem.Name())
+	require.Equal(t, "jackal.net", elem.From())
+
+	conn.inboundWriteString(`
+<db:result from="jabber.org" to="jackal.net" type="invalid"/>
+`)
+	select {
+	case <-failedCh:
+		require.Equal(t, []string{"jackal.net:jabber.org"}, failedPairs)
+	case <-time.After(time.Second):
+		require.Fail(t, "expecting domain pair failure")
+	}
+}
+
+func TestOutStream_Bounce(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	fromJID, _ := jid.New("ortuman", "jackal.im", "balcony", true)
+	toJID, _ := jid.New("noelia", "jabber.org", "garden", true)
+
+	sender := stream.NewMockC2S(uuid.New(), fromJID)
+	r.Bind(sender)
+
+	// remote server not reachable
+	stm := newOutStream(r, "jackal.im", "jabber.org")
+	stm.SendElement(tUtilOutStreamMessage(fromJID, toJID))
+	stm.dialFailed(xmpp.ErrRemoteServerTimeout)
+
+	elem := sender.FetchElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.NotNil(t, elem.Elements().Child("error").Elements().Child("remote-server-timeout"))
+
+	// failed verification
+	stm, conn := tUtilOutStreamInit(t, r)
+	stm.SendElement(tUtilOutStreamMessage(fromJID, toJID))
+	tUtilOutStreamOpen(conn)
+	atomic.StoreUint32(&stm.secured, 1)
+	conn.inboundWriteString(securedFeatures)
+	_ = conn.outboundRead()
+
+	conn.inboundWriteString(`
+<db:result from="jabber.org" to="jackal.im" type="invalid"/>
+`)
+	require.True(t, conn.waitClose())
+
+	elem = sender.FetchElement()
+	require.Equal(t, "message", elem.Name())
+	require.Equal(t, xmpp.ErrorType, elem.Type())
+	require.Equal(t, fromJID.String(), elem.To())
+	require.NotNil(t, elem.Elements().Child("error").Elements().Child("remote-server-not-found"))
+}
+
+func TestOutStream_IdleTimeout(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	cfg, conn := tUtilOutStreamDefaultConfig()
+	cfg.idleTimeout = time.Millisecond * 250
+	stm := tUtilOutStreamInitWithConfig(t, r, cfg, conn)
+	tUtilOutStreamOpen(conn)
+	atomic.StoreUint32(&stm.secured, 1)
+	conn.inboundWriteString(securedFeatures)
+	_ = conn.outboundRead()
+
+	conn.inboundWriteString(`
+<db:result from="jabber.org" to="jackal.im" type="valid"/>
+`)
+	require.True(t, conn.waitClose())
+	require.Equal(t, outDisconnected, stm.getState())
+}
+
+func tUtilOutStreamMessage(fromJID, toJID *jid.JID) *xmpp.Message {
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.ChatType)
+	msg.SetFromJID(fromJID)
+	msg.SetToJID(toJID)
+	return msg
+}
+
 func tUtilOutStreamOpen(conn *fakeSocketConn) {
 	// open stream from remote server...
 	conn.inboundWriteString(`
@@ -323,7 +501,7 @@ func tUtilOutStreamOpen(conn *fakeSocketConn) {
 }
 
 func tUtilOutStreamInitWithConfig(t *testing.T, r *router.Router, cfg *streamConfig, conn *fakeSocketConn) *outStream {
-	stm := newOutStream(r)
+	stm := newOutStream(r, "jackal.im", "jabber.org")
 	stm.start(cfg)
 
 	elem := conn.outboundRead()
@@ -335,7 +513,7 @@ func tUtilOutStreamInitWithConfig(t *testing.T, r *router.Router, cfg *streamCon
 
 func tUtilOutStreamInit(t *testing.T, r *router.Router) (*outStream, *fakeSocketConn) {
 	cfg, conn := tUtilOutStreamDefaultConfig()
-	stm := newOutStream(r)
+	stm := newOutStream(r, "jackal.im", "jabber.org")
 	stm.start(cfg)
 
 	elem := conn.outboundRead()
@@ -357,10 +535,22 @@ func tUtilOutStreamDefaultConfig() (*streamConfig, *fakeSocketConn) {
 	modules["blocking_command"] = struct{}{}
 	modules["offline"] = struct{}{}
 
-	conn := newFakeSocketConn()
+	// remote peer certificate
+	cer, _ := util.LoadCertificate("../testdata/cert/test.server.key", "../testdata/cert/test.server.crt", "localhost")
+	var peerCerts []*x509.Certificate
+	rootCAs := x509.NewCertPool()
+	for _, asn1Data := range cer.Certificate {
+		cr, _ := x509.ParseCertificate(asn1Data)
+		cr.DNSNames = []string{"jabber.org"}
+		peerCerts = append(peerCerts, cr)
+		rootCAs.AddCert(cr)
+	}
+	conn := newFakeSocketConnWithPeerCerts(peerCerts)
 	tr := transport.NewSocketTransport(conn, 4096)
 	return &streamConfig{
+		localDomain:  "jackal.im",
 		remoteDomain: "jabber.org",
+		rootCAs:      rootCAs,
 		modConfig: &module.Config{
 			Enabled:      modules,
 			Offline:      offline.Config{QueueSize: 10},
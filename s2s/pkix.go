@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"crypto/x509"
+	"errors"
+)
+
+var errNoPeerCertificate = errors.New("s2s: no peer certificate provided")
+
+// verifyPeerCertificate validates a remote server certificate chain
+// against the given root CA pool, checking it has been issued for domain.
+// System roots will be used in case no pool is provided.
+func verifyPeerCertificate(certs []*x509.Certificate, domain string, roots *x509.CertPool) error {
+	if len(certs) == 0 {
+		return errNoPeerCertificate
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       domain,
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
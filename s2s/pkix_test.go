@@ -0,0 +1,29 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package s2s
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPeerCertificate(t *testing.T) {
+	_, certs := tUtilFederationCertificate(t, []string{"jackal.im"})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certs[0])
+
+	require.Equal(t, errNoPeerCertificate, verifyPeerCertificate(nil, "jackal.im", roots))
+	require.Nil(t, verifyPeerCertificate(certs, "jackal.im", roots))
+
+	// domain mismatch
+	require.NotNil(t, verifyPeerCertificate(certs, "jabber.org", roots))
+
+	// untrusted chain
+	require.NotNil(t, verifyPeerCertificate(certs, "jackal.im", x509.NewCertPool()))
+}
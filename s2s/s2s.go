@@ -56,7 +56,7 @@ func (s *S2S) GetS2SOut(localDomain, remoteDomain string) (stream.S2SOut, error)
 // Start initializes s2s manager.
 func (s *S2S) Start() {
 	if atomic.CompareAndSwapUint32(&s.started, 0, 1) {
-		go s.srv.start()
+		s.srv.start()
 	}
 }
 
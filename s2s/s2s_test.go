@@ -37,6 +37,12 @@ const securedFeaturesWithExternal = `
 </stream:features>
 `
 
+const securedFeaturesExternalOnly = `
+<stream:features xmlns:stream="http://etherx.jabber.org/streams" version="1.0">
+  <mechanisms xmlns="urn:ietf:params:xml:ns:xmpp-sasl"><mechanism>EXTERNAL</mechanism></mechanisms>
+</stream:features>
+`
+
 const securedFeatures = `
 <stream:features xmlns:stream="http://etherx.jabber.org/streams" version="1.0">
   <dialback xmlns="urn:xmpp:features:dialback"><errors/></dialback>
@@ -137,8 +143,10 @@ func (c *fakeSocketConn) ConnectionState() tls.ConnectionState {
 	return st
 }
 
-func (c *fakeSocketConn) inboundWriteString(s string) (n int, err error) { return c.rd.Write([]byte(s)) }
-func (c *fakeSocketConn) inboundWrite(b []byte) (n int, err error)       { return c.rd.Write(b) }
+func (c *fakeSocketConn) inboundWriteString(s string) (n int, err error) {
+	return c.rd.Write([]byte(s))
+}
+func (c *fakeSocketConn) inboundWrite(b []byte) (n int, err error) { return c.rd.Write(b) }
 
 func (c *fakeSocketConn) outboundRead() xmpp.XElement {
 	var elem xmpp.XElement
@@ -183,6 +191,16 @@ var (
 func (a fakeAddr) Network() string { return "net" }
 func (a fakeAddr) String() string  { return "str" }
 
+// tUtilSRVResolve returns a resolver mock answering 'xmpp-server' SRV lookups with a single target.
+func tUtilSRVResolve(target string, port uint16) func(service, proto, name string) (string, []*net.SRV, error) {
+	return func(service, _, _ string) (string, []*net.SRV, error) {
+		if service != "xmpp-server" {
+			return "", nil, errors.New("resolver mocked error")
+		}
+		return "", []*net.SRV{{Target: target, Port: port}}, nil
+	}
+}
+
 func setupTest(domain string) (*router.Router, *memstorage.Storage, func()) {
 	r, _ := router.New(&router.Config{
 		Hosts: []router.HostConfig{{Name: domain, Certificate: tls.Certificate{}}},
@@ -7,12 +7,15 @@ package s2s
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 
 	"github.com/ortuman/jackal/errors"
+	"github.com/ortuman/jackal/listener"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/module"
 	"github.com/ortuman/jackal/router"
@@ -20,7 +23,7 @@ import (
 	"github.com/ortuman/jackal/transport"
 )
 
-var listenerProvider = net.Listen
+var listenerProvider = listener.Listen
 
 type server struct {
 	cfg       *Config
@@ -28,11 +31,14 @@ type server struct {
 	mods      *module.Modules
 	dialer    *dialer
 	inConns   sync.Map
+	outMu     sync.Mutex
 	outConns  sync.Map
 	ln        net.Listener
 	listening uint32
 }
 
+// start starts listening at the configured address,
+// serving incoming connections on a separate goroutine.
 func (s *server) start() {
 	bindAddr := s.cfg.Transport.BindAddress
 	port := s.cfg.Transport.Port
@@ -74,47 +80,124 @@ func (s *server) listenConn(address string) error {
 	}
 	s.ln = ln
 
+	// XEP-0368: direct TLS connections
+	var tlsCfg *tls.Config
+	if s.cfg.Transport.DirectTLS {
+		// same as in STARTTLS negotiation, peer certificate chain
+		// gets verified later during external authentication.
+		tlsCfg = &tls.Config{
+			ClientAuth:   tls.RequestClientCert,
+			Certificates: s.router.Certificates(),
+			NextProtos:   []string{"xmpp-server"},
+		}
+	}
 	atomic.StoreUint32(&s.listening, 1)
+	go s.acceptConns(ln, tlsCfg)
+	return nil
+}
+
+// runs on its own goroutine
+func (s *server) acceptConns(ln net.Listener, tlsCfg *tls.Config) {
 	for atomic.LoadUint32(&s.listening) == 1 {
 		conn, err := ln.Accept()
 		if err == nil {
-			go s.startInStream(transport.NewSocketTransport(conn, s.cfg.Transport.KeepAlive))
+			if tlsCfg != nil {
+				conn = tls.Server(conn, tlsCfg)
+			}
+			go s.startInStream(transport.NewSocketTransport(conn, s.cfg.Transport.KeepAlive), conn.RemoteAddr().String())
 			continue
 		}
+		if err == listener.ErrClosed {
+			break // no longer accepting connections
+		}
 	}
-	return nil
 }
 
 func (s *server) getOrDial(localDomain, remoteDomain string) (stream.S2SOut, error) {
 	domainPair := localDomain + ":" + remoteDomain
-	stm, loaded := s.outConns.LoadOrStore(domainPair, newOutStream(s.router))
-	if !loaded {
-		outCfg, err := s.dialer.dial(localDomain, remoteDomain)
-		if err != nil {
-			log.Error(err)
-			s.outConns.Delete(domainPair)
-			return nil, err
-		}
-		outCfg.onOutDisconnect = s.unregisterOutStream
+	if stm, ok := s.outConns.Load(domainPair); ok {
+		return stm.(*outStream), nil
+	}
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+
+	if stm, ok := s.outConns.Load(domainPair); ok {
+		return stm.(*outStream), nil
+	}
+	// piggyback domain pair over an already verified connection
+	if stm := s.verifiedOutStream(remoteDomain); stm != nil {
+		s.outConns.Store(domainPair, stm)
+		stm.authorizeDomain(localDomain)
+		log.Infof("registered s2s out stream... (domainpair: %s, via: %s)", domainPair, stm.ID())
+		return stm, nil
+	}
+	stm := newOutStream(s.router, localDomain, remoteDomain)
+	s.outConns.Store(domainPair, stm)
+	log.Infof("registered s2s out stream... (domainpair: %s)", domainPair)
+
+	// stanzas will be queued while dialing...
+	go s.dialOutStream(stm, localDomain, remoteDomain)
+	return stm, nil
+}
 
-		stm.(*outStream).start(outCfg)
-		log.Infof("registered s2s out stream... (domainpair: %s)", domainPair)
+func (s *server) dialOutStream(stm *outStream, localDomain, remoteDomain string) {
+	outCfg, err := s.dialer.dial(localDomain, remoteDomain)
+	if err != nil {
+		log.Error(err)
+		s.unregisterOutStream(stm)
+		stm.dialFailed(dialStanzaError(err))
+		return
+	}
+	outCfg.onOutDisconnect = s.unregisterOutStream
+	outCfg.onOutPairFailed = s.unregisterOutPair
+
+	if err := stm.start(outCfg); err != nil {
+		log.Error(err)
 	}
-	return stm.(*outStream), nil
+}
+
+func (s *server) verifiedOutStream(remoteDomain string) *outStream {
+	var ret *outStream
+	s.outConns.Range(func(k, v interface{}) bool {
+		stm := v.(*outStream)
+		if stm.getState() != outVerified {
+			return true
+		}
+		if strings.HasSuffix(k.(string), ":"+remoteDomain) {
+			ret = stm
+			return false
+		}
+		return true
+	})
+	return ret
 }
 
 func (s *server) unregisterOutStream(stm stream.S2SOut) {
-	domainPair := stm.ID()
+	// unregister every domain pair multiplexed over the stream
+	s.outConns.Range(func(k, v interface{}) bool {
+		if v.(stream.S2SOut) == stm {
+			s.outConns.Delete(k)
+			log.Infof("unregistered s2s out stream... (domainpair: %s)", k)
+		}
+		return true
+	})
+}
+
+func (s *server) unregisterOutPair(localDomain, remoteDomain string) {
+	domainPair := localDomain + ":" + remoteDomain
 	s.outConns.Delete(domainPair)
 	log.Infof("unregistered s2s out stream... (domainpair: %s)", domainPair)
 }
 
-func (s *server) startInStream(tr transport.Transport) {
+func (s *server) startInStream(tr transport.Transport, remoteAddr string) {
 	stm := newInStream(&streamConfig{
 		keyGen:         &keyGen{s.cfg.DialbackSecret},
 		transport:      tr,
+		remoteAddr:     remoteAddr,
 		connectTimeout: s.cfg.ConnectTimeout,
 		maxStanzaSize:  s.cfg.MaxStanzaSize,
+		directTLS:      s.cfg.Transport.DirectTLS,
+		rootCAs:        s.cfg.RootCAs,
 		dialer:         s.dialer,
 		onInDisconnect: s.unregisterInStream,
 	}, s.mods, s.router)
@@ -133,7 +216,7 @@ func (s *server) unregisterInStream(stm stream.S2SIn) {
 
 func closeConnections(connections *sync.Map, ctx context.Context) (count int, err error) {
 	connections.Range(func(_, v interface{}) bool {
-		stm := v.(*inStream)
+		stm := v.(stream.InStream)
 		select {
 		case <-closeConn(stm):
 			count++
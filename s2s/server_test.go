@@ -7,6 +7,7 @@ package s2s
 
 import (
 	"context"
+	"errors"
 	"net"
 	"testing"
 	"time"
@@ -57,3 +58,33 @@ func TestS2SSocketServer(t *testing.T) {
 	err := <-errCh
 	require.Nil(t, err)
 }
+
+func TestS2SServer_AsyncDial(t *testing.T) {
+	r, _, shutdown := setupTest(jackaDomain)
+	defer shutdown()
+
+	dialCh := make(chan struct{})
+	cfg := Config{DialTimeout: time.Second}
+	srv := server{cfg: &cfg, router: r, dialer: newDialer(&cfg, r)}
+	srv.dialer.srvResolve = tUtilSRVResolve("xmpp.jabber.org", 5269)
+	srv.dialer.dialTimeout = func(_, _ string, _ time.Duration) (net.Conn, error) {
+		<-dialCh
+		return nil, errors.New("dialer mocked error")
+	}
+	// dialing should not block caller
+	stm1, err := srv.getOrDial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	stm2, err := srv.getOrDial("jackal.im", "jabber.org")
+	require.Nil(t, err)
+	require.Equal(t, stm1, stm2)
+
+	close(dialCh)
+	select {
+	case <-stm1.(*outStream).done():
+		break
+	case <-time.After(time.Second):
+		require.Fail(t, "expecting stream disconnection")
+	}
+	_, ok := srv.outConns.Load("jackal.im:jabber.org")
+	require.False(t, ok)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/ortuman/jackal/errors"
 	"github.com/ortuman/jackal/log"
 	"github.com/ortuman/jackal/router"
+	"github.com/ortuman/jackal/trace"
 	"github.com/ortuman/jackal/transport"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
@@ -177,6 +178,7 @@ func (s *Session) Open() error {
 
 	openStr := buf.String()
 	log.Debugf("SEND(%s): %s", s.id, openStr)
+	trace.Send(s.id, s.jid(), ops)
 
 	_, err := io.Copy(s.tr, strings.NewReader(openStr))
 	return err
@@ -204,6 +206,7 @@ func (s *Session) Send(elem xmpp.XElement) {
 		e.SetNamespace("")
 	}
 	log.Debugf("SEND(%s): %v", s.id, elem)
+	trace.Send(s.id, s.jid(), elem)
 	elem.ToXML(s.tr, true)
 }
 
@@ -214,6 +217,7 @@ func (s *Session) Receive() (xmpp.XElement, *Error) {
 		return nil, s.mapErrorToSessionError(err)
 	} else if elem != nil {
 		log.Debugf("RECV(%s): %v", s.id, elem)
+		trace.Receive(s.id, s.jid(), elem)
 
 		if atomic.LoadUint32(&s.started) == 0 {
 			if err := s.validateStreamElement(elem); err != nil {
@@ -287,8 +291,10 @@ func (s *Session) extractAddresses(elem xmpp.XElement) (*jid.JID, *jid.JID, *Err
 		}
 		fromJID = s.jid()
 	} else {
+		// multiple domain pairs could be multiplexed over a server session,
+		// so domain pair authorization is left to the stream.
 		j, err := jid.NewWithString(from, false)
-		if err != nil || j.Domain() != s.remoteDomain {
+		if err != nil {
 			return nil, nil, &Error{UnderlyingErr: streamerror.ErrInvalidFrom}
 		}
 		fromJID = j
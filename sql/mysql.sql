@@ -8,6 +8,7 @@ CREATE TABLE IF NOT EXISTS users (
     password TEXT NOT NULL,
     last_presence TEXT NOT NULL,
     last_presence_at DATETIME NOT NULL,
+    disabled BOOL NOT NULL DEFAULT FALSE,
     updated_at DATETIME NOT NULL,
     created_at DATETIME NOT NULL
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
@@ -76,9 +77,58 @@ CREATE TABLE IF NOT EXISTS vcards (
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
 
 CREATE TABLE IF NOT EXISTS offline_messages (
+    id VARCHAR(36) NOT NULL,
     username VARCHAR(256) NOT NULL,
     data MEDIUMTEXT NOT NULL,
-    created_at DATETIME NOT NULL
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (username, id)
 ) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
 
 CREATE INDEX i_offline_messages_username ON offline_messages(username);
+CREATE INDEX i_offline_messages_created_at ON offline_messages(created_at);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    type VARCHAR(64) NOT NULL,
+    username VARCHAR(256) NOT NULL,
+    jid VARCHAR(512) NOT NULL,
+    stream_id VARCHAR(256) NOT NULL,
+    remote_addr VARCHAR(256) NOT NULL,
+    details TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+CREATE INDEX i_audit_events_username ON audit_events(username);
+CREATE INDEX i_audit_events_created_at ON audit_events(created_at);
+
+CREATE TABLE IF NOT EXISTS motds (
+    host VARCHAR(256) PRIMARY KEY,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    updated_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS directory_entries (
+    username VARCHAR(256) PRIMARY KEY,
+    fn VARCHAR(512) NOT NULL,
+    nickname VARCHAR(512) NOT NULL,
+    email VARCHAR(512) NOT NULL,
+    org VARCHAR(512) NOT NULL,
+    listed BOOL NOT NULL DEFAULT FALSE,
+    updated_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS bookmarks (
+    username VARCHAR(256) NOT NULL,
+    jid VARCHAR(512) NOT NULL,
+    name TEXT NOT NULL,
+    autojoin BOOL NOT NULL DEFAULT FALSE,
+    nick TEXT NOT NULL,
+    password TEXT NOT NULL,
+    updated_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    PRIMARY KEY (username, jid)
+) ENGINE=InnoDB CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
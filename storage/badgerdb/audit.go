@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
+	"github.com/pborman/uuid"
+)
+
+// InsertAuditEvent appends a new audit event entity into storage.
+func (b *Storage) InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
+		return b.insertOrUpdate(event, b.auditEventKey(event), tx)
+	})
+}
+
+// FetchAuditEvents retrieves from storage all audit event entities
+// associated to a given user sorted by creation date.
+func (b *Storage) FetchAuditEvents(ctx context.Context, username string) ([]model.AuditEvent, error) {
+	var events []model.AuditEvent
+	if err := b.fetchAll(ctx, &events, b.auditEventsPrefix(username)); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+	return events, nil
+}
+
+func (b *Storage) auditEventsPrefix(username string) []byte {
+	return []byte("auditEvents:" + username + ":")
+}
+
+func (b *Storage) auditEventKey(event *model.AuditEvent) []byte {
+	return []byte(fmt.Sprintf("auditEvents:%s:%020d:%s", event.Username, event.CreatedAt.UnixNano(), uuid.New()))
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_AuditEvents(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	now := time.Now()
+	e1 := model.AuditEvent{Type: "login", Username: "ortuman", Details: map[string]string{"mechanism": "PLAIN"}, CreatedAt: now}
+	e2 := model.AuditEvent{Type: "logout", Username: "ortuman", CreatedAt: now.Add(time.Second)}
+	e3 := model.AuditEvent{Type: "login", Username: "noelia", CreatedAt: now}
+
+	require.Nil(t, h.db.InsertAuditEvent(context.Background(), &e2))
+	require.Nil(t, h.db.InsertAuditEvent(context.Background(), &e1))
+	require.Nil(t, h.db.InsertAuditEvent(context.Background(), &e3))
+
+	events, err := h.db.FetchAuditEvents(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(events))
+	require.Equal(t, "login", events[0].Type)
+	require.Equal(t, "PLAIN", events[0].Details["mechanism"])
+	require.Equal(t, "logout", events[1].Type)
+
+	events, err = h.db.FetchAuditEvents(context.Background(), "romeo")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(events))
+}
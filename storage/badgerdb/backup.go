@@ -0,0 +1,399 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/log"
+)
+
+const (
+	backupOpEnd byte = iota
+	backupOpSet
+	backupOpDelete
+)
+
+const (
+	backupTimeFormat  = "20060102T150405.000"
+	fullBackupSuffix  = ".full.bak"
+	incrBackupSuffix  = ".incr.bak"
+	backupMagicHeader = "JKLBKP01"
+)
+
+var (
+	errBadgerDBInvalidBackup  = errors.New("badgerdb: invalid backup file")
+	errBadgerDBBackupChecksum = errors.New("badgerdb: backup checksum mismatch")
+)
+
+// BackupInfo describes a verified backup file.
+type BackupInfo struct {
+	// Since is the version after which backed up entries were modified.
+	// A zero value identifies a full backup.
+	Since uint64
+
+	// Version is the version the backup was taken at.
+	Version uint64
+
+	// Entries is the number of backed up entries.
+	Entries uint64
+}
+
+// Backup writes a consistent snapshot of every entry modified after version since
+// to w, returning the version it has been taken at. A zero since value produces a full
+// backup, while passing a previously returned version produces an incremental one.
+// It's safe to call Backup while the storage is being used.
+func (b *Storage) Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error) {
+	h := sha256.New()
+	bw := bufio.NewWriter(io.MultiWriter(w, h))
+
+	var hdr [8]byte
+	bw.WriteString(backupMagicHeader)
+	binary.LittleEndian.PutUint64(hdr[:], since)
+	bw.Write(hdr[:])
+
+	version := since
+	var entries uint64
+	err := b.view(ctx, func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.AllVersions = true // deleted entries are only visible this way
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+
+		var lastKey []byte
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			it := iter.Item()
+			if lastKey != nil && bytes.Equal(it.Key(), lastKey) {
+				continue // older version of an already processed key
+			}
+			lastKey = it.KeyCopy(lastKey)
+			if it.Version() <= since {
+				continue
+			}
+			if it.Version() > version {
+				version = it.Version()
+			}
+			if it.IsDeletedOrExpired() {
+				if since == 0 {
+					continue
+				}
+				writeBackupRecord(bw, backupOpDelete, it.Key(), nil)
+			} else {
+				val, err := it.Value()
+				if err != nil {
+					return err
+				}
+				writeBackupRecord(bw, backupOpSet, it.Key(), val)
+			}
+			entries++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	var ftr [16]byte
+	binary.LittleEndian.PutUint64(ftr[:8], version)
+	binary.LittleEndian.PutUint64(ftr[8:], entries)
+	bw.WriteByte(backupOpEnd)
+	bw.Write(ftr[:])
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(h.Sum(nil)); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// VerifyBackup checks the integrity of a backup file, returning its description.
+func VerifyBackup(path string) (*BackupInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readBackup(f, nil)
+}
+
+// Restore rebuilds an empty data directory out of a full backup file followed by
+// every subsequent incremental backup file. All of them are verified beforehand,
+// and it must not be used while a storage instance is using the data directory.
+func Restore(dataDir string, paths ...string) error {
+	if len(paths) == 0 {
+		return errors.New("badgerdb: no backup files to restore")
+	}
+	var prev *BackupInfo
+	for i, path := range paths {
+		info, err := VerifyBackup(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if i == 0 && info.Since != 0 {
+			return fmt.Errorf("badgerdb: %s is not a full backup", path)
+		}
+		if i > 0 && info.Since != prev.Version {
+			return fmt.Errorf("badgerdb: %s does not follow %s", path, paths[i-1])
+		}
+		prev = info
+	}
+	fis, err := ioutil.ReadDir(dataDir)
+	switch {
+	case err == nil && len(fis) > 0:
+		return fmt.Errorf("badgerdb: data directory %s is not empty", dataDir)
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+	if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+		return err
+	}
+	opts := badger.DefaultOptions
+	opts.Dir = dataDir
+	opts.ValueDir = dataDir
+	db, err := badger.Open(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, path := range paths {
+		if err := restoreFile(db, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackupChain returns the most recent full backup file contained in dir
+// followed by every incremental backup file taken after it.
+func BackupChain(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range fis {
+		if strings.HasSuffix(fi.Name(), fullBackupSuffix) || strings.HasSuffix(fi.Name(), incrBackupSuffix) {
+			names = append(names, fi.Name())
+		}
+	}
+	// backup file names are time ordered
+	sort.Strings(names)
+
+	var chain []string
+	for _, name := range names {
+		if strings.HasSuffix(name, fullBackupSuffix) {
+			chain = chain[:0]
+		} else if len(chain) == 0 {
+			continue
+		}
+		chain = append(chain, filepath.Join(dir, name))
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("badgerdb: no full backup found at %s", dir)
+	}
+	return chain, nil
+}
+
+func (b *Storage) scheduledBackup() error {
+	full := b.backupVersion == 0 || b.backupCount%b.backupCfg.FullEvery == 0
+	since := b.backupVersion
+	suffix := incrBackupSuffix
+	if full {
+		since = 0
+		suffix = fullBackupSuffix
+	}
+	if err := os.MkdirAll(b.backupCfg.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	path := filepath.Join(b.backupCfg.Dir, time.Now().UTC().Format(backupTimeFormat)+suffix)
+	tmpPath := path + ".tmp"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	version, err := b.Backup(context.Background(), f, since)
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	b.backupVersion = version
+	b.backupCount++
+	log.Infof("badgerdb: backup written to %s (version: %d)", path, version)
+	return nil
+}
+
+func restoreFile(db *badger.DB, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	txn := db.NewTransaction(true)
+	defer func() { txn.Discard() }()
+
+	apply := func(op byte, key, val []byte) error {
+		err := applyBackupRecord(txn, op, key, val)
+		if err != badger.ErrTxnTooBig {
+			return err
+		}
+		// commit current batch and start a new one
+		if err := txn.Commit(nil); err != nil {
+			return err
+		}
+		txn = db.NewTransaction(true)
+		return applyBackupRecord(txn, op, key, val)
+	}
+	if _, err := readBackup(f, apply); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return txn.Commit(nil)
+}
+
+func applyBackupRecord(txn *badger.Txn, op byte, key, val []byte) error {
+	if op == backupOpDelete {
+		return txn.Delete(key)
+	}
+	return txn.Set(key, val)
+}
+
+func writeBackupRecord(w *bufio.Writer, op byte, key, val []byte) {
+	var lb [binary.MaxVarintLen64]byte
+
+	w.WriteByte(op)
+	w.Write(lb[:binary.PutUvarint(lb[:], uint64(len(key)))])
+	w.Write(key)
+	if op == backupOpSet {
+		w.Write(lb[:binary.PutUvarint(lb[:], uint64(len(val)))])
+		w.Write(val)
+	}
+}
+
+// readBackup reads a whole backup stream passing every record to f,
+// verifying its checksum once its end is reached.
+func readBackup(r io.Reader, f func(op byte, key, val []byte) error) (*BackupInfo, error) {
+	br := bufio.NewReader(r)
+	hr := &hashReader{r: br, h: sha256.New()}
+
+	var hdr [16]byte
+	if _, err := io.ReadFull(hr, hdr[:]); err != nil {
+		return nil, errBadgerDBInvalidBackup
+	}
+	if string(hdr[:8]) != backupMagicHeader {
+		return nil, errBadgerDBInvalidBackup
+	}
+	info := &BackupInfo{Since: binary.LittleEndian.Uint64(hdr[8:])}
+
+	var entries uint64
+	for {
+		op, err := hr.ReadByte()
+		if err != nil {
+			return nil, errBadgerDBInvalidBackup
+		}
+		if op == backupOpEnd {
+			break
+		}
+		if op != backupOpSet && op != backupOpDelete {
+			return nil, errBadgerDBInvalidBackup
+		}
+		key, err := readBackupBytes(hr)
+		if err != nil {
+			return nil, err
+		}
+		var val []byte
+		if op == backupOpSet {
+			if val, err = readBackupBytes(hr); err != nil {
+				return nil, err
+			}
+		}
+		if f != nil {
+			if err := f(op, key, val); err != nil {
+				return nil, err
+			}
+		}
+		entries++
+	}
+	var ftr [16]byte
+	if _, err := io.ReadFull(hr, ftr[:]); err != nil {
+		return nil, errBadgerDBInvalidBackup
+	}
+	info.Version = binary.LittleEndian.Uint64(ftr[:8])
+	info.Entries = binary.LittleEndian.Uint64(ftr[8:])
+
+	var sum [sha256.Size]byte
+	if _, err := io.ReadFull(br, sum[:]); err != nil {
+		return nil, errBadgerDBInvalidBackup
+	}
+	if !bytes.Equal(sum[:], hr.h.Sum(nil)) || info.Entries != entries {
+		return nil, errBadgerDBBackupChecksum
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errBadgerDBInvalidBackup
+	}
+	return info, nil
+}
+
+func readBackupBytes(hr *hashReader) ([]byte, error) {
+	l, err := binary.ReadUvarint(hr)
+	if err != nil {
+		return nil, errBadgerDBInvalidBackup
+	}
+	if l > uint64(badger.DefaultOptions.ValueLogFileSize) {
+		return nil, errBadgerDBInvalidBackup
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(hr, b); err != nil {
+		return nil, errBadgerDBInvalidBackup
+	}
+	return b, nil
+}
+
+// hashReader computes the hash of every byte read from the underlying reader.
+type hashReader struct {
+	r *bufio.Reader
+	h hash.Hash
+}
+
+func (hr *hashReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	return n, err
+}
+
+func (hr *hashReader) ReadByte() (byte, error) {
+	b, err := hr.r.ReadByte()
+	if err == nil {
+		hr.h.Write([]byte{b})
+	}
+	return b, err
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestBadgerDB_BackupRestore(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	backupDir := tUtilBadgerDBTempDir()
+	defer os.RemoveAll(backupDir)
+	require.Nil(t, os.MkdirAll(backupDir, os.ModePerm))
+
+	require.Nil(t, h.db.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"}))
+	require.Nil(t, h.db.InsertOrUpdateUser(context.Background(), &model.User{Username: "noelia", Password: "5678"}))
+
+	fullPath := filepath.Join(backupDir, "1"+fullBackupSuffix)
+	version := tUtilBadgerDBBackup(t, h.db, fullPath, 0)
+	require.True(t, version > 0)
+
+	require.Nil(t, h.db.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "4321"}))
+	require.Nil(t, h.db.InsertOrUpdateUser(context.Background(), &model.User{Username: "romeo", Password: "abcd"}))
+	require.Nil(t, h.db.DeleteUser(context.Background(), "noelia"))
+
+	incrPath := filepath.Join(backupDir, "2"+incrBackupSuffix)
+	version2 := tUtilBadgerDBBackup(t, h.db, incrPath, version)
+	require.True(t, version2 > version)
+
+	info, err := VerifyBackup(fullPath)
+	require.Nil(t, err)
+	require.Equal(t, uint64(0), info.Since)
+	require.Equal(t, version, info.Version)
+	require.Equal(t, uint64(3), info.Entries) // including offline messages index marker
+
+	info, err = VerifyBackup(incrPath)
+	require.Nil(t, err)
+	require.Equal(t, version, info.Since)
+	require.Equal(t, uint64(4), info.Entries) // including deleted user vCard
+
+	// incremental backup must follow a full one
+	require.NotNil(t, Restore(tUtilBadgerDBTempDir(), incrPath))
+
+	chain, err := BackupChain(backupDir)
+	require.Nil(t, err)
+	require.Equal(t, []string{fullPath, incrPath}, chain)
+
+	restoreDir := tUtilBadgerDBTempDir()
+	defer os.RemoveAll(restoreDir)
+	require.Nil(t, Restore(restoreDir, chain...))
+
+	// data dir must be empty
+	require.NotNil(t, Restore(restoreDir, chain...))
+
+	db := New(&Config{DataDir: restoreDir})
+	defer db.Close()
+
+	usernames, err := db.FetchUsernames(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, []string{"ortuman", "romeo"}, usernames)
+
+	usr, err := db.FetchUser(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, "4321", usr.Password)
+}
+
+func TestBadgerDB_BackupCorrupted(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	require.Nil(t, h.db.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"}))
+
+	buf := bytes.NewBuffer(nil)
+	_, err := h.db.Backup(context.Background(), buf, 0)
+	require.Nil(t, err)
+
+	b := buf.Bytes()
+	_, err = readBackup(bytes.NewReader(b), nil)
+	require.Nil(t, err)
+
+	corrupted := make([]byte, len(b))
+	copy(corrupted, b)
+	corrupted[len(corrupted)-40] ^= 0xff
+	_, err = readBackup(bytes.NewReader(corrupted), nil)
+	require.Equal(t, errBadgerDBBackupChecksum, err)
+
+	_, err = readBackup(bytes.NewReader(b[:len(b)-8]), nil)
+	require.Equal(t, errBadgerDBInvalidBackup, err)
+
+	_, err = readBackup(bytes.NewReader([]byte("jackal")), nil)
+	require.Equal(t, errBadgerDBInvalidBackup, err)
+}
+
+func TestBadgerDB_ScheduledBackup(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	backupDir := tUtilBadgerDBTempDir()
+	defer os.RemoveAll(backupDir)
+
+	h.db.backupCfg = &BackupConfig{Dir: backupDir, Interval: time.Hour, FullEvery: 2}
+
+	for i := 0; i < 3; i++ {
+		require.Nil(t, h.db.InsertOrUpdateUser(context.Background(), &model.User{Username: uuid.New(), Password: "1234"}))
+		require.Nil(t, h.db.scheduledBackup())
+		time.Sleep(time.Millisecond * 5) // ensure different file names
+	}
+	chain, err := BackupChain(backupDir)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(chain)) // third backup is a full one
+
+	fis, err := ioutil.ReadDir(backupDir)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(fis))
+}
+
+func TestBadgerDB_BackupConfig(t *testing.T) {
+	var cfg Config
+	err := yaml.Unmarshal([]byte("data_dir: ./data\nbackup:\n  dir: ./backups\n  interval: 3600\n"), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, "./backups", cfg.Backup.Dir)
+	require.Equal(t, time.Hour, cfg.Backup.Interval)
+	require.Equal(t, defaultFullBackupEvery, cfg.Backup.FullEvery)
+
+	err = yaml.Unmarshal([]byte("backup:\n  interval: 3600\n"), &cfg)
+	require.NotNil(t, err)
+
+	err = yaml.Unmarshal([]byte("backup:\n  dir: ./backups\n"), &cfg)
+	require.NotNil(t, err)
+}
+
+func tUtilBadgerDBBackup(t *testing.T, db *Storage, path string, since uint64) uint64 {
+	f, err := os.Create(path)
+	require.Nil(t, err)
+	defer f.Close()
+	version, err := db.Backup(context.Background(), f, since)
+	require.Nil(t, err)
+	return version
+}
+
+func tUtilBadgerDBTempDir() string {
+	dir, _ := ioutil.TempDir("", "")
+	return filepath.Join(dir, "com.jackal.tests.badgerdb."+uuid.New())
+}
@@ -7,6 +7,7 @@ package badgerdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"errors"
 	"fmt"
@@ -24,11 +25,49 @@ import (
 var (
 	errBadgerDBWrongEntityType = errors.New("badgerdb: wrong entity type")
 	errBadgerDBEntityNotFound  = errors.New("badgerdb: entity not found")
+	errBadgerDBPageFilled      = errors.New("badgerdb: page filled")
 )
 
+const defaultFullBackupEvery = 24
+
 // Config represents BadgerDB storage configuration.
 type Config struct {
-	DataDir string `yaml:"data_dir"`
+	DataDir string        `yaml:"data_dir"`
+	Backup  *BackupConfig `yaml:"backup"`
+}
+
+// BackupConfig represents BadgerDB scheduled backups configuration.
+type BackupConfig struct {
+	Dir       string
+	Interval  time.Duration
+	FullEvery int
+}
+
+type backupConfigProxy struct {
+	Dir       string `yaml:"dir"`
+	Interval  int    `yaml:"interval"`
+	FullEvery int    `yaml:"full_every"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *BackupConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := backupConfigProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.Dir = p.Dir
+	if len(c.Dir) == 0 {
+		return errors.New("badgerdb.BackupConfig: backup dir must be specified")
+	}
+	c.Interval = time.Duration(p.Interval) * time.Second
+	if c.Interval <= 0 {
+		return errors.New("badgerdb.BackupConfig: backup interval must be specified")
+	}
+	c.FullEvery = p.FullEvery
+	if c.FullEvery <= 0 {
+		c.FullEvery = defaultFullBackupEvery
+	}
+	return nil
 }
 
 // Storage represents a BadgerDB storage sub system.
@@ -36,13 +75,18 @@ type Storage struct {
 	db     *badger.DB
 	pool   *pool.BufferPool
 	doneCh chan chan bool
+
+	backupCfg     *BackupConfig
+	backupVersion uint64
+	backupCount   int
 }
 
 // New returns a new BadgerDB storage instance.
 func New(cfg *Config) *Storage {
 	b := &Storage{
-		pool:   pool.NewBufferPool(),
-		doneCh: make(chan chan bool),
+		pool:      pool.NewBufferPool(),
+		doneCh:    make(chan chan bool),
+		backupCfg: cfg.Backup,
 	}
 	if err := os.MkdirAll(filepath.Dir(cfg.DataDir), os.ModePerm); err != nil {
 		log.Fatalf("%v", err)
@@ -55,6 +99,9 @@ func New(cfg *Config) *Storage {
 		log.Fatalf("%v", err)
 	}
 	b.db = db
+	if err := b.indexOfflineMessages(); err != nil {
+		log.Fatalf("%v", err)
+	}
 	go b.loop()
 	return b
 }
@@ -70,10 +117,21 @@ func (b *Storage) Close() error {
 func (b *Storage) loop() {
 	tc := time.NewTicker(time.Minute)
 	defer tc.Stop()
+
+	var backupCh <-chan time.Time
+	if b.backupCfg != nil {
+		bt := time.NewTicker(b.backupCfg.Interval)
+		defer bt.Stop()
+		backupCh = bt.C
+	}
 	for {
 		select {
 		case <-tc.C:
 			b.db.RunValueLogGC(0.5)
+		case <-backupCh:
+			if err := b.scheduledBackup(); err != nil {
+				log.Error(err)
+			}
 		case ch := <-b.doneCh:
 			b.db.Close()
 			close(ch)
@@ -82,6 +140,22 @@ func (b *Storage) loop() {
 	}
 }
 
+// update runs f within a read-write transaction, unless ctx is already done.
+func (b *Storage) update(ctx context.Context, f func(tx *badger.Txn) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.Update(f)
+}
+
+// view runs f within a read-only transaction, unless ctx is already done.
+func (b *Storage) view(ctx context.Context, f func(tx *badger.Txn) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.View(f)
+}
+
 func (b *Storage) insertOrUpdate(entity interface{}, key []byte, tx *badger.Txn) error {
 	gs, ok := entity.(model.GobSerializer)
 	if !ok {
@@ -101,10 +175,12 @@ func (b *Storage) delete(key []byte, txn *badger.Txn) error {
 	return txn.Delete(key)
 }
 
-func (b *Storage) deletePrefix(prefix []byte, txn *badger.Txn) error {
+func (b *Storage) deletePrefix(ctx context.Context, prefix []byte, txn *badger.Txn) error {
 	var keys [][]byte
-	if err := b.forEachKey(prefix, func(key []byte) error {
-		keys = append(keys, key)
+	if err := b.forEachKey(ctx, prefix, func(key []byte) error {
+		k := make([]byte, len(key)) // only valid until iterator moves on
+		copy(k, key)
+		keys = append(keys, k)
 		return nil
 	}); err != nil {
 		return err
@@ -117,8 +193,8 @@ func (b *Storage) deletePrefix(prefix []byte, txn *badger.Txn) error {
 	return nil
 }
 
-func (b *Storage) fetch(entity interface{}, key []byte) error {
-	return b.db.View(func(tx *badger.Txn) error {
+func (b *Storage) fetch(ctx context.Context, entity interface{}, key []byte) error {
+	return b.view(ctx, func(tx *badger.Txn) error {
 		val, err := b.getVal(key, tx)
 		if err != nil {
 			return err
@@ -137,23 +213,51 @@ func (b *Storage) fetch(entity interface{}, key []byte) error {
 	})
 }
 
-func (b *Storage) fetchAll(v interface{}, prefix []byte) error {
+func (b *Storage) fetchAll(ctx context.Context, v interface{}, prefix []byte) error {
 	t := reflect.TypeOf(v).Elem()
 	if t.Kind() != reflect.Slice {
 		return fmt.Errorf("%v: %T", errBadgerDBWrongEntityType, v)
 	}
 	s := reflect.ValueOf(v).Elem()
-	return b.forEachKeyAndValue(prefix, func(k, val []byte) error {
-		e := reflect.New(t.Elem()).Elem()
-		i := e.Addr().Interface()
-		gd, ok := i.(model.GobDeserializer)
-		if !ok {
-			return fmt.Errorf("%v: %T", errBadgerDBWrongEntityType, i)
+	return b.forEachKeyAndValue(ctx, prefix, func(k, val []byte) error {
+		return b.appendEntity(s, val)
+	})
+}
+
+// fetchPage fills v with up to limit entities stored under prefix,
+// resuming right after the key formed by prefix and after, if any.
+func (b *Storage) fetchPage(ctx context.Context, v interface{}, prefix, after []byte, limit int) error {
+	t := reflect.TypeOf(v).Elem()
+	if t.Kind() != reflect.Slice {
+		return fmt.Errorf("%v: %T", errBadgerDBWrongEntityType, v)
+	}
+	s := reflect.ValueOf(v).Elem()
+	start := append(append([]byte{}, prefix...), after...)
+	err := b.forEachKeyAndValueFrom(ctx, prefix, start, func(k, val []byte) error {
+		if len(after) > 0 && bytes.Equal(k, start) {
+			return nil
 		}
-		gd.FromGob(gob.NewDecoder(bytes.NewReader(val)))
-		s.Set(reflect.Append(s, e))
-		return nil
+		if s.Len() == limit {
+			return errBadgerDBPageFilled
+		}
+		return b.appendEntity(s, val)
 	})
+	if err == errBadgerDBPageFilled {
+		return nil
+	}
+	return err
+}
+
+func (b *Storage) appendEntity(s reflect.Value, val []byte) error {
+	e := reflect.New(s.Type().Elem()).Elem()
+	i := e.Addr().Interface()
+	gd, ok := i.(model.GobDeserializer)
+	if !ok {
+		return fmt.Errorf("%v: %T", errBadgerDBWrongEntityType, i)
+	}
+	gd.FromGob(gob.NewDecoder(bytes.NewReader(val)))
+	s.Set(reflect.Append(s, e))
+	return nil
 }
 
 func (b *Storage) getVal(key []byte, txn *badger.Txn) ([]byte, error) {
@@ -169,14 +273,17 @@ func (b *Storage) getVal(key []byte, txn *badger.Txn) ([]byte, error) {
 	return item.ValueCopy(nil)
 }
 
-func (b *Storage) forEachKey(prefix []byte, f func(k []byte) error) error {
-	return b.db.View(func(txn *badger.Txn) error {
+func (b *Storage) forEachKey(ctx context.Context, prefix []byte, f func(k []byte) error) error {
+	return b.view(ctx, func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchValues = false
 		iter := txn.NewIterator(opts)
 		defer iter.Close()
 
 		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			it := iter.Item()
 			if err := f(it.Key()); err != nil {
 				return err
@@ -186,12 +293,19 @@ func (b *Storage) forEachKey(prefix []byte, f func(k []byte) error) error {
 	})
 }
 
-func (b *Storage) forEachKeyAndValue(prefix []byte, f func(k, v []byte) error) error {
-	return b.db.View(func(txn *badger.Txn) error {
+func (b *Storage) forEachKeyAndValue(ctx context.Context, prefix []byte, f func(k, v []byte) error) error {
+	return b.forEachKeyAndValueFrom(ctx, prefix, prefix, f)
+}
+
+func (b *Storage) forEachKeyAndValueFrom(ctx context.Context, prefix, start []byte, f func(k, v []byte) error) error {
+	return b.view(ctx, func(txn *badger.Txn) error {
 		iter := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer iter.Close()
 
-		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		for iter.Seek(start); iter.ValidForPrefix(prefix); iter.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			it := iter.Item()
 			val, err := it.ValueCopy(nil)
 			if err != nil {
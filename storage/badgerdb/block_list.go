@@ -6,14 +6,16 @@
 package badgerdb
 
 import (
+	"context"
+
 	"github.com/dgraph-io/badger"
 	"github.com/ortuman/jackal/model"
 )
 
 // InsertBlockListItems inserts a set of block list item entities
 // into storage, only in case they haven't been previously inserted.
-func (b *Storage) InsertBlockListItems(items []model.BlockListItem) error {
-	return b.db.Update(func(tx *badger.Txn) error {
+func (b *Storage) InsertBlockListItems(ctx context.Context, items []model.BlockListItem) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
 		for _, item := range items {
 			if err := b.insertOrUpdate(&item, b.blockListItemKey(item.Username, item.JID), tx); err != nil {
 				return err
@@ -24,8 +26,8 @@ func (b *Storage) InsertBlockListItems(items []model.BlockListItem) error {
 }
 
 // DeleteBlockListItems deletes a set of block list item entities from storage.
-func (b *Storage) DeleteBlockListItems(items []model.BlockListItem) error {
-	return b.db.Update(func(tx *badger.Txn) error {
+func (b *Storage) DeleteBlockListItems(ctx context.Context, items []model.BlockListItem) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
 		for _, item := range items {
 			if err := b.delete(b.blockListItemKey(item.Username, item.JID), tx); err != nil {
 				return err
@@ -37,9 +39,19 @@ func (b *Storage) DeleteBlockListItems(items []model.BlockListItem) error {
 
 // FetchBlockListItems retrieves from storage all block list item entities
 // associated to a given user.
-func (b *Storage) FetchBlockListItems(username string) ([]model.BlockListItem, error) {
+func (b *Storage) FetchBlockListItems(ctx context.Context, username string) ([]model.BlockListItem, error) {
+	var blItems []model.BlockListItem
+	if err := b.fetchAll(ctx, &blItems, []byte("blockListItems:"+username)); err != nil {
+		return nil, err
+	}
+	return blItems, nil
+}
+
+// FetchBlockListItemsPage retrieves from storage up to limit block list item entities
+// associated to a given user, sorted by JID and starting right after afterJID.
+func (b *Storage) FetchBlockListItemsPage(ctx context.Context, username, afterJID string, limit int) ([]model.BlockListItem, error) {
 	var blItems []model.BlockListItem
-	if err := b.fetchAll(&blItems, []byte("blockListItems:"+username)); err != nil {
+	if err := b.fetchPage(ctx, &blItems, b.blockListItemKey(username, ""), []byte(afterJID), limit); err != nil {
 		return nil, err
 	}
 	return blItems, nil
@@ -6,6 +6,7 @@
 package badgerdb
 
 import (
+	"context"
 	"sort"
 	"testing"
 
@@ -26,24 +27,31 @@ func TestBadgerDB_BlockListItems(t *testing.T) {
 	}
 	sort.Slice(items, func(i, j int) bool { return items[i].JID < items[j].JID })
 
-	err := h.db.InsertBlockListItems(items)
+	err := h.db.InsertBlockListItems(context.Background(), items)
 	require.Nil(t, err)
 
-	sItems, err := h.db.FetchBlockListItems("ortuman")
+	sItems, err := h.db.FetchBlockListItems(context.Background(), "ortuman")
 	sort.Slice(sItems, func(i, j int) bool { return sItems[i].JID < sItems[j].JID })
 	require.Nil(t, err)
 	require.Equal(t, items, sItems)
 
+	sItems, err = h.db.FetchBlockListItemsPage(context.Background(), "ortuman", "", 2)
+	require.Nil(t, err)
+	require.Equal(t, items[:2], sItems)
+	sItems, err = h.db.FetchBlockListItemsPage(context.Background(), "ortuman", sItems[1].JID, 2)
+	require.Nil(t, err)
+	require.Equal(t, items[2:], sItems)
+
 	items = append(items[:1], items[2:]...)
-	h.db.DeleteBlockListItems([]model.BlockListItem{{Username: "ortuman", JID: "romeo@jackal.im"}})
+	h.db.DeleteBlockListItems(context.Background(), []model.BlockListItem{{Username: "ortuman", JID: "romeo@jackal.im"}})
 
-	sItems, err = h.db.FetchBlockListItems("ortuman")
+	sItems, err = h.db.FetchBlockListItems(context.Background(), "ortuman")
 	sort.Slice(items, func(i, j int) bool { return items[i].JID < items[j].JID })
 	require.Nil(t, err)
 	require.Equal(t, items, sItems)
 
-	err = h.db.DeleteBlockListItems(items)
+	err = h.db.DeleteBlockListItems(context.Background(), items)
 	require.Nil(t, err)
-	sItems, _ = h.db.FetchBlockListItems("ortuman")
+	sItems, _ = h.db.FetchBlockListItems(context.Background(), "ortuman")
 	require.Equal(t, 0, len(sItems))
 }
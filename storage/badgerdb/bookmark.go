@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"context"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateBookmark inserts a new bookmark entity into storage,
+// or updates it in case it's been previously inserted.
+func (b *Storage) InsertOrUpdateBookmark(ctx context.Context, bookmark *model.Bookmark) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
+		return b.insertOrUpdate(bookmark, b.bookmarkKey(bookmark.Username, bookmark.JID), tx)
+	})
+}
+
+// DeleteBookmark deletes a bookmark entity from storage.
+func (b *Storage) DeleteBookmark(ctx context.Context, username, jid string) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
+		return b.delete(b.bookmarkKey(username, jid), tx)
+	})
+}
+
+// FetchBookmarks retrieves from storage all bookmark entities
+// associated to a given user sorted by JID.
+func (b *Storage) FetchBookmarks(ctx context.Context, username string) ([]model.Bookmark, error) {
+	var bookmarks []model.Bookmark
+	if err := b.fetchAll(ctx, &bookmarks, b.bookmarkKey(username, "")); err != nil {
+		return nil, err
+	}
+	return bookmarks, nil
+}
+
+func (b *Storage) bookmarkKey(username, jid string) []byte {
+	return []byte("bookmarks:" + username + ":" + jid)
+}
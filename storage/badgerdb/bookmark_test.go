@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_Bookmarks(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	b1 := &model.Bookmark{Username: "ortuman", JID: "xsf@muc.xmpp.org", Name: "xsf"}
+	b2 := &model.Bookmark{Username: "ortuman", JID: "jdev@conference.jabber.org", Name: "jdev", Autojoin: true}
+	b3 := &model.Bookmark{Username: "noelia", JID: "jdev@conference.jabber.org"}
+	require.Nil(t, h.db.InsertOrUpdateBookmark(context.Background(), b1))
+	require.Nil(t, h.db.InsertOrUpdateBookmark(context.Background(), b2))
+	require.Nil(t, h.db.InsertOrUpdateBookmark(context.Background(), b3))
+
+	bookmarks, err := h.db.FetchBookmarks(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, []model.Bookmark{*b2, *b1}, bookmarks)
+
+	require.Nil(t, h.db.DeleteBookmark(context.Background(), "ortuman", b2.JID))
+	bookmarks, err = h.db.FetchBookmarks(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, []model.Bookmark{*b1}, bookmarks)
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateDirectoryEntry inserts a new user directory entry into storage,
+// or updates it in case it's been previously inserted.
+func (b *Storage) InsertOrUpdateDirectoryEntry(ctx context.Context, entry *model.DirectoryEntry) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
+		return b.insertOrUpdate(entry, b.directoryEntryKey(entry.Username), tx)
+	})
+}
+
+// FetchDirectoryEntry retrieves from storage the directory entry of a given user.
+func (b *Storage) FetchDirectoryEntry(ctx context.Context, username string) (*model.DirectoryEntry, error) {
+	var entry model.DirectoryEntry
+	err := b.fetch(ctx, &entry, b.directoryEntryKey(username))
+	switch err {
+	case nil:
+		return &entry, nil
+	case errBadgerDBEntityNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+// SearchDirectoryEntries retrieves from storage up to limit directory entries
+// matching a query, sorted by username and starting right after afterUsername.
+func (b *Storage) SearchDirectoryEntries(ctx context.Context, query *model.DirectoryQuery, afterUsername string, limit int) ([]model.DirectoryEntry, error) {
+	var ret []model.DirectoryEntry
+	prefix := []byte("directoryEntries:")
+	start := b.directoryEntryKey(afterUsername)
+	err := b.forEachKeyAndValueFrom(ctx, prefix, start, func(k, val []byte) error {
+		if len(afterUsername) > 0 && bytes.Equal(k, start) {
+			return nil
+		}
+		var entry model.DirectoryEntry
+		entry.FromGob(gob.NewDecoder(bytes.NewReader(val)))
+		if !query.Matches(&entry) {
+			return nil
+		}
+		if len(ret) == limit {
+			return errBadgerDBPageFilled
+		}
+		ret = append(ret, entry)
+		return nil
+	})
+	if err != nil && err != errBadgerDBPageFilled {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (b *Storage) directoryEntryKey(username string) []byte {
+	return []byte("directoryEntries:" + username)
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_Directory(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	e1 := &model.DirectoryEntry{Username: "ortuman", FN: "Miguel Ángel", Org: "jackal", Listed: true}
+	e2 := &model.DirectoryEntry{Username: "noelia", FN: "Noelia", Org: "Jackal"}
+	e3 := &model.DirectoryEntry{Username: "romeo", FN: "Romeo", Org: "Montague"}
+	require.Nil(t, h.db.InsertOrUpdateDirectoryEntry(context.Background(), e1))
+	require.Nil(t, h.db.InsertOrUpdateDirectoryEntry(context.Background(), e2))
+	require.Nil(t, h.db.InsertOrUpdateDirectoryEntry(context.Background(), e3))
+
+	entry, err := h.db.FetchDirectoryEntry(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, e1, entry)
+
+	entries, err := h.db.SearchDirectoryEntries(context.Background(), &model.DirectoryQuery{Org: "jack"}, "", 10)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, "noelia", entries[0].Username)
+	require.Equal(t, "ortuman", entries[1].Username)
+
+	entries, err = h.db.SearchDirectoryEntries(context.Background(), &model.DirectoryQuery{}, "noelia", 1)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(entries))
+	require.Equal(t, "ortuman", entries[0].Username)
+
+	entries, _ = h.db.SearchDirectoryEntries(context.Background(), &model.DirectoryQuery{ListedOnly: true}, "", 10)
+	require.Equal(t, 1, len(entries))
+
+	require.Nil(t, h.db.DeleteUser(context.Background(), "ortuman"))
+	entry, err = h.db.FetchDirectoryEntry(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Nil(t, entry)
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateMOTD inserts a new host message of the day into storage,
+// or updates it in case it's been previously inserted.
+func (b *Storage) InsertOrUpdateMOTD(ctx context.Context, motd *model.MOTD) error {
+	stored := *motd
+	stored.UpdatedAt = time.Now()
+	return b.update(ctx, func(tx *badger.Txn) error {
+		return b.insertOrUpdate(&stored, b.motdKey(motd.Host), tx)
+	})
+}
+
+// FetchMOTD retrieves from storage the message of the day of a given host.
+func (b *Storage) FetchMOTD(ctx context.Context, host string) (*model.MOTD, error) {
+	var motd model.MOTD
+	err := b.fetch(ctx, &motd, b.motdKey(host))
+	switch err {
+	case nil:
+		return &motd, nil
+	case errBadgerDBEntityNotFound:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+// DeleteMOTD deletes from storage the message of the day of a given host.
+func (b *Storage) DeleteMOTD(ctx context.Context, host string) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
+		return b.delete(b.motdKey(host), tx)
+	})
+}
+
+func (b *Storage) motdKey(host string) []byte {
+	return []byte("motds:" + host)
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package badgerdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerDB_MOTD(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	err := h.db.InsertOrUpdateMOTD(context.Background(), &model.MOTD{Host: "jackal.im", Subject: "Hi", Body: "Welcome!"})
+	require.Nil(t, err)
+
+	motd, err := h.db.FetchMOTD(context.Background(), "jackal.im")
+	require.Nil(t, err)
+	require.NotNil(t, motd)
+	require.Equal(t, "Hi", motd.Subject)
+	require.Equal(t, "Welcome!", motd.Body)
+	require.False(t, motd.UpdatedAt.IsZero())
+
+	motd, err = h.db.FetchMOTD(context.Background(), "jabber.org")
+	require.Nil(t, err)
+	require.Nil(t, motd)
+
+	require.Nil(t, h.db.DeleteMOTD(context.Background(), "jackal.im"))
+	motd, err = h.db.FetchMOTD(context.Background(), "jackal.im")
+	require.Nil(t, err)
+	require.Nil(t, motd)
+}
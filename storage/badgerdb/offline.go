@@ -6,54 +6,290 @@
 package badgerdb
 
 import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/log"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
 )
 
 // InsertOfflineMessage inserts a new message element into
 // user's offline queue.
-func (b *Storage) InsertOfflineMessage(message *xmpp.Message, username string) error {
-	return b.db.Update(func(tx *badger.Txn) error {
-		return b.insertOrUpdate(message, b.offlineMessageKey(username, message.ID()), tx)
+func (b *Storage) InsertOfflineMessage(ctx context.Context, message *model.OfflineMessage) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
+		key := b.offlineMessageKey(message.Username, message.ID)
+		if err := b.deleteOfflineMessageIndex(key, tx); err != nil {
+			return err
+		}
+		if err := b.insertOrUpdate(message, key, tx); err != nil {
+			return err
+		}
+		return tx.Set(b.offlineMessageIndexKey(message.Username, message.CreatedAt, message.ID), nil)
 	})
 }
 
 // CountOfflineMessages returns current length of user's offline queue.
-func (b *Storage) CountOfflineMessages(username string) (int, error) {
+func (b *Storage) CountOfflineMessages(ctx context.Context, username string) (int, error) {
 	cnt := 0
-	prefix := []byte("offlineMessages:" + username)
-	err := b.forEachKey(prefix, func(key []byte) error {
+	err := b.forEachKey(ctx, b.offlineMessagesPrefix(username), func(key []byte) error {
 		cnt++
 		return nil
 	})
 	return cnt, err
 }
 
-// FetchOfflineMessages retrieves from storage current user offline queue.
-func (b *Storage) FetchOfflineMessages(username string) ([]*xmpp.Message, error) {
-	var msgs []xmpp.Message
-	if err := b.fetchAll(&msgs, []byte("offlineMessages:"+username)); err != nil {
+// FetchOfflineMessages retrieves from storage current user offline queue
+// sorted by creation date.
+func (b *Storage) FetchOfflineMessages(ctx context.Context, username string) ([]model.OfflineMessage, error) {
+	var msgs []model.OfflineMessage
+	err := b.forEachKeyAndValue(ctx, b.offlineMessagesPrefix(username), func(k, val []byte) error {
+		if om, ok := decodeOfflineMessage(k, val); ok {
+			msgs = append(msgs, om)
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	switch len(msgs) {
-	case 0:
-		return nil, nil
-	default:
-		ret := make([]*xmpp.Message, len(msgs))
-		for i := 0; i < len(msgs); i++ {
-			ret[i] = &msgs[i]
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+	})
+	return msgs, nil
+}
+
+// FetchOfflineMessagesPage retrieves from storage up to limit messages
+// of a user offline queue sorted by creation date, starting right after
+// the given message or at the head of the queue if after is nil.
+func (b *Storage) FetchOfflineMessagesPage(ctx context.Context, username string, after *model.OfflineMessage, limit int) ([]model.OfflineMessage, error) {
+	// messages are keyed by identifier, so the creation date index
+	// is walked instead, starting right at the cursor position.
+	var msgs []model.OfflineMessage
+	prefix := b.offlineMessagesIndexPrefix(username)
+	start := prefix
+	if after != nil {
+		start = b.offlineMessageIndexKey(username, after.CreatedAt, after.ID)
+	}
+	err := b.view(ctx, func(tx *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		iter := tx.NewIterator(opts)
+		defer iter.Close()
+
+		for iter.Seek(start); iter.ValidForPrefix(prefix) && len(msgs) < limit; iter.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			idxKey := iter.Item().Key()
+			if after != nil && bytes.Equal(idxKey, start) {
+				continue
+			}
+			// index key format: offlineMessagesIndex:<username>:<timestamp>:<identifier>
+			keyParts := strings.SplitN(string(idxKey), ":", 4)
+			if len(keyParts) != 4 {
+				log.Warnf("badgerdb: skipping malformed offline message index key: %s", idxKey)
+				continue
+			}
+			key := b.offlineMessageKey(username, keyParts[3])
+			val, err := b.getVal(key, tx)
+			if err != nil {
+				return err
+			}
+			if val == nil {
+				continue
+			}
+			if om, ok := decodeOfflineMessage(key, val); ok {
+				msgs = append(msgs, om)
+			}
 		}
-		return ret, nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return msgs, nil
+}
+
+// DeleteOfflineMessage deletes a single message from a user offline queue.
+func (b *Storage) DeleteOfflineMessage(ctx context.Context, username, id string) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
+		key := b.offlineMessageKey(username, id)
+		if err := b.deleteOfflineMessageIndex(key, tx); err != nil {
+			return err
+		}
+		return b.delete(key, tx)
+	})
 }
 
 // DeleteOfflineMessages clears a user offline queue.
-func (b *Storage) DeleteOfflineMessages(username string) error {
+func (b *Storage) DeleteOfflineMessages(ctx context.Context, username string) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
+		if err := b.deletePrefix(ctx, b.offlineMessagesIndexPrefix(username), tx); err != nil {
+			return err
+		}
+		return b.deletePrefix(ctx, b.offlineMessagesPrefix(username), tx)
+	})
+}
+
+// DeleteOfflineMessagesOlderThan deletes every offline message
+// archived before t, returning the number of deleted messages.
+func (b *Storage) DeleteOfflineMessagesOlderThan(ctx context.Context, t time.Time) (int, error) {
+	var keys [][]byte
+	err := b.forEachKeyAndValue(ctx, []byte("offlineMessages:"), func(k, val []byte) error {
+		om, ok := decodeOfflineMessage(k, val)
+		if ok && om.CreatedAt.Before(t) {
+			key := make([]byte, len(k))
+			copy(key, k)
+			keys = append(keys, key, b.offlineMessageIndexKey(om.Username, om.CreatedAt, om.ID))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	err = b.update(ctx, func(tx *badger.Txn) error {
+		for _, k := range keys {
+			if err := b.delete(k, tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(keys) / 2, nil
+}
+
+const indexChunkSize = 1000
+
+// indexOfflineMessages builds the creation date index of offline messages
+// archived by previous versions, which only keyed them by identifier.
+func (b *Storage) indexOfflineMessages() error {
+	indexedKey := []byte("offlineMessagesIndexed")
+	var indexed bool
+	err := b.db.View(func(tx *badger.Txn) error {
+		val, err := b.getVal(indexedKey, tx)
+		indexed = val != nil
+		return err
+	})
+	if err != nil || indexed {
+		return err
+	}
+	var idxKeys [][]byte
+	err = b.forEachKeyAndValue(context.Background(), []byte("offlineMessages:"), func(k, val []byte) error {
+		om, ok := decodeOfflineMessage(k, val)
+		if !ok {
+			return nil
+		}
+		idxKeys = append(idxKeys, b.offlineMessageIndexKey(om.Username, om.CreatedAt, om.ID))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// written in chunks, as a single transaction could grow too big
+	for len(idxKeys) > 0 {
+		n := len(idxKeys)
+		if n > indexChunkSize {
+			n = indexChunkSize
+		}
+		err := b.db.Update(func(tx *badger.Txn) error {
+			for _, k := range idxKeys[:n] {
+				if err := tx.Set(k, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		idxKeys = idxKeys[n:]
+	}
 	return b.db.Update(func(tx *badger.Txn) error {
-		return b.deletePrefix([]byte("offlineMessages:"+username), tx)
+		return tx.Set(indexedKey, []byte{1})
 	})
 }
 
+func (b *Storage) deleteOfflineMessageIndex(key []byte, tx *badger.Txn) error {
+	val, err := b.getVal(key, tx)
+	if err != nil || val == nil {
+		return err
+	}
+	om, ok := decodeOfflineMessage(key, val)
+	if !ok {
+		return nil
+	}
+	return b.delete(b.offlineMessageIndexKey(om.Username, om.CreatedAt, om.ID), tx)
+}
+
+// decodeOfflineMessage deserializes an offline message stored under key k,
+// accepting values written by previous versions, where the bare gob
+// representation of the message was stored under its stanza identifier.
+// Returns false in case k is not a well formed offline message key.
+func decodeOfflineMessage(k, val []byte) (model.OfflineMessage, bool) {
+	var om model.OfflineMessage
+
+	// key format: offlineMessages:<username>:<identifier>
+	keyParts := strings.SplitN(string(k), ":", 3)
+	if len(keyParts) != 3 {
+		log.Warnf("badgerdb: skipping malformed offline message key: %s", k)
+		return om, false
+	}
+	username, id := keyParts[1], keyParts[2]
+
+	// new format values start with message identifier and username
+	var s1, s2 string
+	dec := gob.NewDecoder(bytes.NewReader(val))
+	dec.Decode(&s1)
+	dec.Decode(&s2)
+	if s2 == username {
+		om.FromGob(gob.NewDecoder(bytes.NewReader(val)))
+		return om, true
+	}
+	el := &xmpp.Element{}
+	el.FromGob(gob.NewDecoder(bytes.NewReader(val)))
+	fromJID, _ := jid.NewWithString(el.From(), true)
+	toJID, _ := jid.NewWithString(el.To(), true)
+
+	om.ID = id
+	om.Username = username
+	om.Message, _ = xmpp.NewMessageFromElement(el, fromJID, toJID)
+	if delay := el.Elements().ChildNamespace("delay", "urn:xmpp:delay"); delay != nil {
+		om.CreatedAt, _ = time.Parse(time.RFC3339, delay.Attributes().Get("stamp"))
+	}
+	return om, true
+}
+
+func (b *Storage) offlineMessagesPrefix(username string) []byte {
+	return []byte("offlineMessages:" + username + ":")
+}
+
 func (b *Storage) offlineMessageKey(username, identifier string) []byte {
 	return []byte("offlineMessages:" + username + ":" + identifier)
 }
+
+func (b *Storage) offlineMessagesIndexPrefix(username string) []byte {
+	return []byte("offlineMessagesIndex:" + username + ":")
+}
+
+// offlineMessageIndexKey returns a key sorting messages by creation date
+// and identifier, using a fixed width timestamp to preserve its ordering.
+func (b *Storage) offlineMessageIndexKey(username string, createdAt time.Time, identifier string) []byte {
+	var ts int64
+	if createdAt.After(time.Unix(0, 0)) {
+		ts = createdAt.UnixNano()
+	}
+	return []byte(fmt.Sprintf("offlineMessagesIndex:%s:%020d:%s", username, ts, identifier))
+}
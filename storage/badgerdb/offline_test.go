@@ -6,8 +6,14 @@
 package badgerdb
 
 import (
+	"bytes"
+	"context"
+	"encoding/gob"
 	"testing"
+	"time"
 
+	"github.com/dgraph-io/badger"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/require"
@@ -19,6 +25,8 @@ func TestBadgerDB_OfflineMessages(t *testing.T) {
 	h := tUtilBadgerDBSetup()
 	defer tUtilBadgerDBTeardown(h)
 
+	now := time.Now()
+
 	msg1 := xmpp.NewMessageType(uuid.New(), xmpp.NormalType)
 	b1 := xmpp.NewElementName("body")
 	b1.SetText("Hi buddy!")
@@ -27,25 +35,154 @@ func TestBadgerDB_OfflineMessages(t *testing.T) {
 	msg2 := xmpp.NewMessageType(uuid.New(), xmpp.NormalType)
 	b2 := xmpp.NewElementName("body")
 	b2.SetText("what's up?!")
-	msg1.AppendElement(b1)
+	msg2.AppendElement(b2)
 
-	require.NoError(t, h.db.InsertOfflineMessage(msg1, "ortuman"))
-	require.NoError(t, h.db.InsertOfflineMessage(msg2, "ortuman"))
+	om1 := &model.OfflineMessage{ID: uuid.New(), Username: "ortuman", Message: msg1, CreatedAt: now.Add(-time.Hour)}
+	om2 := &model.OfflineMessage{ID: uuid.New(), Username: "ortuman", Message: msg2, CreatedAt: now}
 
-	cnt, err := h.db.CountOfflineMessages("ortuman")
+	require.NoError(t, h.db.InsertOfflineMessage(context.Background(), om2))
+	require.NoError(t, h.db.InsertOfflineMessage(context.Background(), om1))
+
+	cnt, err := h.db.CountOfflineMessages(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.Equal(t, 2, cnt)
 
-	msgs, err := h.db.FetchOfflineMessages("ortuman")
+	msgs, err := h.db.FetchOfflineMessages(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.Equal(t, 2, len(msgs))
+	require.Equal(t, om1.ID, msgs[0].ID)
+	require.Equal(t, om2.ID, msgs[1].ID)
+	require.Equal(t, msg2.String(), msgs[1].Message.String())
 
-	msgs2, err := h.db.FetchOfflineMessages("ortuman2")
+	msgs2, err := h.db.FetchOfflineMessages(context.Background(), "ortuman2")
 	require.Nil(t, err)
 	require.Equal(t, 0, len(msgs2))
 
-	require.NoError(t, h.db.DeleteOfflineMessages("ortuman"))
-	cnt, err = h.db.CountOfflineMessages("ortuman")
+	require.NoError(t, h.db.DeleteOfflineMessage(context.Background(), "ortuman", om2.ID))
+	cnt, err = h.db.CountOfflineMessages(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, cnt)
+
+	require.NoError(t, h.db.InsertOfflineMessage(context.Background(), om2))
+	deleted, err := h.db.DeleteOfflineMessagesOlderThan(context.Background(), now.Add(-time.Minute))
+	require.Nil(t, err)
+	require.Equal(t, 1, deleted)
+
+	msgs, err = h.db.FetchOfflineMessages(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, om2.ID, msgs[0].ID)
+
+	require.NoError(t, h.db.DeleteOfflineMessages(context.Background(), "ortuman"))
+	cnt, err = h.db.CountOfflineMessages(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.Equal(t, 0, cnt)
 }
+
+func TestBadgerDB_OfflineMessagesPage(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	now := time.Now()
+	var oms []*model.OfflineMessage
+	for i := 0; i < 5; i++ {
+		msg := xmpp.NewMessageType(uuid.New(), xmpp.NormalType)
+		oms = append(oms, &model.OfflineMessage{ID: uuid.New(), Username: "ortuman", Message: msg, CreatedAt: now.Add(time.Duration(i) * time.Second)})
+	}
+	for _, i := range []int{3, 0, 4, 1, 2} {
+		require.NoError(t, h.db.InsertOfflineMessage(context.Background(), oms[i]))
+	}
+
+	msgs, err := h.db.FetchOfflineMessagesPage(context.Background(), "ortuman", nil, 2)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, oms[0].ID, msgs[0].ID)
+	require.Equal(t, oms[1].ID, msgs[1].ID)
+
+	msgs, err = h.db.FetchOfflineMessagesPage(context.Background(), "ortuman", &msgs[1], 2)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, oms[2].ID, msgs[0].ID)
+	require.Equal(t, oms[3].ID, msgs[1].ID)
+
+	msgs, err = h.db.FetchOfflineMessagesPage(context.Background(), "ortuman", &msgs[1], 2)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, oms[4].ID, msgs[0].ID)
+
+	// updated messages are moved within the queue
+	oms[0].CreatedAt = now.Add(time.Minute)
+	require.NoError(t, h.db.InsertOfflineMessage(context.Background(), oms[0]))
+	msgs, err = h.db.FetchOfflineMessagesPage(context.Background(), "ortuman", &msgs[0], 5)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, oms[0].ID, msgs[0].ID)
+}
+
+func TestBadgerDB_LegacyOfflineMessages(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	// messages stored by previous versions
+	msg := xmpp.NewMessageType(uuid.New(), xmpp.NormalType)
+	msg.AppendElement(xmpp.NewElementName("body").SetText("Hi buddy!"))
+	msg.Delay("jackal.im", "Offline Storage")
+	err := h.db.db.Update(func(tx *badger.Txn) error {
+		buf := new(bytes.Buffer)
+		msg.ToGob(gob.NewEncoder(buf))
+		if err := tx.Delete([]byte("offlineMessagesIndexed")); err != nil {
+			return err
+		}
+		return tx.Set(h.db.offlineMessageKey("ortuman", msg.ID()), buf.Bytes())
+	})
+	require.Nil(t, err)
+	require.Nil(t, h.db.indexOfflineMessages()) // as done on startup
+
+	om := &model.OfflineMessage{ID: uuid.New(), Username: "ortuman", Message: xmpp.NewMessageType(uuid.New(), xmpp.NormalType), CreatedAt: time.Now().Add(time.Hour)}
+	require.NoError(t, h.db.InsertOfflineMessage(context.Background(), om))
+
+	msgs, err := h.db.FetchOfflineMessages(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, msg.ID(), msgs[0].ID)
+	require.Equal(t, "ortuman", msgs[0].Username)
+	require.Equal(t, msg.String(), msgs[0].Message.String())
+	require.False(t, msgs[0].CreatedAt.IsZero())
+	require.Equal(t, om.ID, msgs[1].ID)
+
+	msgs, err = h.db.FetchOfflineMessagesPage(context.Background(), "ortuman", nil, 1)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, msg.ID(), msgs[0].ID)
+}
+
+func TestBadgerDB_MalformedOfflineMessageKeys(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	om := &model.OfflineMessage{ID: uuid.New(), Username: "ortuman", Message: xmpp.NewMessageType(uuid.New(), xmpp.NormalType), CreatedAt: time.Now()}
+	require.NoError(t, h.db.InsertOfflineMessage(context.Background(), om))
+
+	err := h.db.db.Update(func(tx *badger.Txn) error {
+		if err := tx.Set([]byte("offlineMessages:ortuman"), []byte{1}); err != nil {
+			return err
+		}
+		return tx.Set([]byte("offlineMessagesIndex:ortuman:1"), nil)
+	})
+	require.Nil(t, err)
+
+	msgs, err := h.db.FetchOfflineMessagesPage(context.Background(), "ortuman", nil, 5)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, om.ID, msgs[0].ID)
+
+	n, err := h.db.DeleteOfflineMessagesOlderThan(context.Background(), time.Now().Add(time.Hour))
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+}
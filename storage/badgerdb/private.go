@@ -6,24 +6,27 @@
 package badgerdb
 
 import (
+	"context"
+	"strings"
+
 	"github.com/dgraph-io/badger"
 	"github.com/ortuman/jackal/xmpp"
 )
 
 // InsertOrUpdatePrivateXML inserts a new private element into storage,
 // or updates it in case it's been previously inserted.
-func (b *Storage) InsertOrUpdatePrivateXML(privateXML []xmpp.XElement, namespace string, username string) error {
+func (b *Storage) InsertOrUpdatePrivateXML(ctx context.Context, privateXML []xmpp.XElement, namespace string, username string) error {
 	r := xmpp.NewElementName("r")
 	r.AppendElements(privateXML)
-	return b.db.Update(func(tx *badger.Txn) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
 		return b.insertOrUpdate(r, b.privateStorageKey(username, namespace), tx)
 	})
 }
 
 // FetchPrivateXML retrieves from storage a private element.
-func (b *Storage) FetchPrivateXML(namespace string, username string) ([]xmpp.XElement, error) {
+func (b *Storage) FetchPrivateXML(ctx context.Context, namespace string, username string) ([]xmpp.XElement, error) {
 	var r xmpp.Element
-	err := b.fetch(&r, b.privateStorageKey(username, namespace))
+	err := b.fetch(ctx, &r, b.privateStorageKey(username, namespace))
 	switch err {
 	case nil:
 		return r.Elements().All(), nil
@@ -34,6 +37,18 @@ func (b *Storage) FetchPrivateXML(namespace string, username string) ([]xmpp.XEl
 	}
 }
 
+// FetchPrivateXMLNamespaces retrieves from storage the namespace
+// of every private element associated to a given user.
+func (b *Storage) FetchPrivateXMLNamespaces(ctx context.Context, username string) ([]string, error) {
+	var ret []string
+	prefix := string(b.privateStorageKey(username, ""))
+	err := b.forEachKey(ctx, []byte(prefix), func(k []byte) error {
+		ret = append(ret, strings.TrimPrefix(string(k), prefix))
+		return nil
+	})
+	return ret, err
+}
+
 func (b *Storage) privateStorageKey(username, namespace string) []byte {
 	return []byte("privateElements:" + username + ":" + namespace)
 }
@@ -6,6 +6,7 @@
 package badgerdb
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ortuman/jackal/xmpp"
@@ -21,13 +22,18 @@ func TestBadgerDB_PrivateXML(t *testing.T) {
 	pv1 := xmpp.NewElementNamespace("ex1", "exodus:ns")
 	pv2 := xmpp.NewElementNamespace("ex2", "exodus:ns")
 
-	require.NoError(t, h.db.InsertOrUpdatePrivateXML([]xmpp.XElement{pv1, pv2}, "exodus:ns", "ortuman"))
+	require.NoError(t, h.db.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{pv1, pv2}, "exodus:ns", "ortuman"))
 
-	prvs, err := h.db.FetchPrivateXML("exodus:ns", "ortuman")
+	prvs, err := h.db.FetchPrivateXML(context.Background(), "exodus:ns", "ortuman")
 	require.Nil(t, err)
 	require.Equal(t, 2, len(prvs))
 
-	prvs2, err := h.db.FetchPrivateXML("exodus:ns", "ortuman2")
+	prvs2, err := h.db.FetchPrivateXML(context.Background(), "exodus:ns", "ortuman2")
 	require.Nil(t, prvs2)
 	require.Nil(t, err)
+
+	require.NoError(t, h.db.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{pv1}, "exodus:ns2", "ortuman"))
+	namespaces, err := h.db.FetchPrivateXMLNamespaces(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, []string{"exodus:ns", "exodus:ns2"}, namespaces)
 }
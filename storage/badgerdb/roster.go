@@ -6,46 +6,59 @@
 package badgerdb
 
 import (
+	"context"
+
 	"github.com/dgraph-io/badger"
 	"github.com/ortuman/jackal/model/rostermodel"
 )
 
 // InsertOrUpdateRosterItem inserts a new roster item entity into storage,
 // or updates it in case it's been previously inserted.
-func (b *Storage) InsertOrUpdateRosterItem(ri *rostermodel.Item) (rostermodel.Version, error) {
-	if err := b.db.Update(func(tx *badger.Txn) error {
+func (b *Storage) InsertOrUpdateRosterItem(ctx context.Context, ri *rostermodel.Item) (rostermodel.Version, error) {
+	if err := b.update(ctx, func(tx *badger.Txn) error {
 		return b.insertOrUpdate(ri, b.rosterItemKey(ri.Username, ri.JID), tx)
 	}); err != nil {
 		return rostermodel.Version{}, err
 	}
-	return b.updateRosterVer(ri.Username, false)
+	return b.updateRosterVer(ctx, ri.Username, false)
 }
 
 // DeleteRosterItem deletes a roster item entity from storage.
-func (b *Storage) DeleteRosterItem(user, contact string) (rostermodel.Version, error) {
-	if err := b.db.Update(func(tx *badger.Txn) error {
+func (b *Storage) DeleteRosterItem(ctx context.Context, user, contact string) (rostermodel.Version, error) {
+	if err := b.update(ctx, func(tx *badger.Txn) error {
 		return b.delete(b.rosterItemKey(user, contact), tx)
 	}); err != nil {
 		return rostermodel.Version{}, err
 	}
-	return b.updateRosterVer(user, true)
+	return b.updateRosterVer(ctx, user, true)
 }
 
 // FetchRosterItems retrieves from storage all roster item entities
 // associated to a given user.
-func (b *Storage) FetchRosterItems(user string) ([]rostermodel.Item, rostermodel.Version, error) {
+func (b *Storage) FetchRosterItems(ctx context.Context, user string) ([]rostermodel.Item, rostermodel.Version, error) {
+	var ris []rostermodel.Item
+	if err := b.fetchAll(ctx, &ris, []byte("rosterItems:"+user)); err != nil {
+		return nil, rostermodel.Version{}, err
+	}
+	ver, err := b.fetchRosterVer(ctx, user)
+	return ris, ver, err
+}
+
+// FetchRosterItemsPage retrieves from storage up to limit roster item entities
+// associated to a given user, sorted by contact JID and starting right after afterJID.
+func (b *Storage) FetchRosterItemsPage(ctx context.Context, user, afterJID string, limit int) ([]rostermodel.Item, rostermodel.Version, error) {
 	var ris []rostermodel.Item
-	if err := b.fetchAll(&ris, []byte("rosterItems:"+user)); err != nil {
+	if err := b.fetchPage(ctx, &ris, b.rosterItemKey(user, ""), []byte(afterJID), limit); err != nil {
 		return nil, rostermodel.Version{}, err
 	}
-	ver, err := b.fetchRosterVer(user)
+	ver, err := b.fetchRosterVer(ctx, user)
 	return ris, ver, err
 }
 
 // FetchRosterItem retrieves from storage a roster item entity.
-func (b *Storage) FetchRosterItem(user, contact string) (*rostermodel.Item, error) {
+func (b *Storage) FetchRosterItem(ctx context.Context, user, contact string) (*rostermodel.Item, error) {
 	var ri rostermodel.Item
-	err := b.fetch(&ri, b.rosterItemKey(user, contact))
+	err := b.fetch(ctx, &ri, b.rosterItemKey(user, contact))
 	switch err {
 	case nil:
 		return &ri, nil
@@ -58,23 +71,23 @@ func (b *Storage) FetchRosterItem(user, contact string) (*rostermodel.Item, erro
 
 // InsertOrUpdateRosterNotification inserts a new roster notification entity
 // into storage, or updates it in case it's been previously inserted.
-func (b *Storage) InsertOrUpdateRosterNotification(rn *rostermodel.Notification) error {
-	return b.db.Update(func(tx *badger.Txn) error {
+func (b *Storage) InsertOrUpdateRosterNotification(ctx context.Context, rn *rostermodel.Notification) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
 		return b.insertOrUpdate(rn, b.rosterNotificationKey(rn.Contact, rn.JID), tx)
 	})
 }
 
 // DeleteRosterNotification deletes a roster notification entity from storage.
-func (b *Storage) DeleteRosterNotification(contact, jid string) error {
-	return b.db.Update(func(tx *badger.Txn) error {
+func (b *Storage) DeleteRosterNotification(ctx context.Context, contact, jid string) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
 		return b.delete(b.rosterNotificationKey(contact, jid), tx)
 	})
 }
 
 // FetchRosterNotification retrieves from storage a roster notification entity.
-func (b *Storage) FetchRosterNotification(contact string, jid string) (*rostermodel.Notification, error) {
+func (b *Storage) FetchRosterNotification(ctx context.Context, contact string, jid string) (*rostermodel.Notification, error) {
 	var rn rostermodel.Notification
-	err := b.fetch(&rn, b.rosterNotificationKey(contact, jid))
+	err := b.fetch(ctx, &rn, b.rosterNotificationKey(contact, jid))
 	switch err {
 	case nil:
 		return &rn, nil
@@ -87,16 +100,16 @@ func (b *Storage) FetchRosterNotification(contact string, jid string) (*rostermo
 
 // FetchRosterNotifications retrieves from storage all roster notifications
 // associated to a given user.
-func (b *Storage) FetchRosterNotifications(contact string) ([]rostermodel.Notification, error) {
+func (b *Storage) FetchRosterNotifications(ctx context.Context, contact string) ([]rostermodel.Notification, error) {
 	var rns []rostermodel.Notification
-	if err := b.fetchAll(&rns, []byte("rosterNotifications:"+contact)); err != nil {
+	if err := b.fetchAll(ctx, &rns, []byte("rosterNotifications:"+contact)); err != nil {
 		return nil, err
 	}
 	return rns, nil
 }
 
-func (b *Storage) updateRosterVer(username string, isDeletion bool) (rostermodel.Version, error) {
-	v, err := b.fetchRosterVer(username)
+func (b *Storage) updateRosterVer(ctx context.Context, username string, isDeletion bool) (rostermodel.Version, error) {
+	v, err := b.fetchRosterVer(ctx, username)
 	if err != nil {
 		return rostermodel.Version{}, err
 	}
@@ -104,7 +117,7 @@ func (b *Storage) updateRosterVer(username string, isDeletion bool) (rostermodel
 	if isDeletion {
 		v.DeletionVer = v.Ver
 	}
-	if err := b.db.Update(func(tx *badger.Txn) error {
+	if err := b.update(ctx, func(tx *badger.Txn) error {
 		return b.insertOrUpdate(&v, b.rosterVersionKey(username), tx)
 	}); err != nil {
 		return rostermodel.Version{}, err
@@ -112,9 +125,9 @@ func (b *Storage) updateRosterVer(username string, isDeletion bool) (rostermodel
 	return v, nil
 }
 
-func (b *Storage) fetchRosterVer(username string) (rostermodel.Version, error) {
+func (b *Storage) fetchRosterVer(ctx context.Context, username string) (rostermodel.Version, error) {
 	var ver rostermodel.Version
-	err := b.fetch(&ver, b.rosterVersionKey(username))
+	err := b.fetch(ctx, &ver, b.rosterVersionKey(username))
 	switch err {
 	case nil, errBadgerDBEntityNotFound:
 		return ver, nil
@@ -6,6 +6,7 @@
 package badgerdb
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ortuman/jackal/model/rostermodel"
@@ -29,29 +30,29 @@ func TestBadgerDB_RosterItems(t *testing.T) {
 		JID:          "romeo",
 		Subscription: "both",
 	}
-	_, err := h.db.InsertOrUpdateRosterItem(ri1)
+	_, err := h.db.InsertOrUpdateRosterItem(context.Background(), ri1)
 	require.NoError(t, err)
-	_, err = h.db.InsertOrUpdateRosterItem(ri2)
+	_, err = h.db.InsertOrUpdateRosterItem(context.Background(), ri2)
 	require.NoError(t, err)
 
-	ris, _, err := h.db.FetchRosterItems("ortuman")
+	ris, _, err := h.db.FetchRosterItems(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.Equal(t, 2, len(ris))
 
-	ris2, _, err := h.db.FetchRosterItems("ortuman2")
+	ris2, _, err := h.db.FetchRosterItems(context.Background(), "ortuman2")
 	require.Nil(t, err)
 	require.Equal(t, 0, len(ris2))
 
-	ri3, err := h.db.FetchRosterItem("ortuman", "juliet")
+	ri3, err := h.db.FetchRosterItem(context.Background(), "ortuman", "juliet")
 	require.Nil(t, err)
 	require.Equal(t, ri1, ri3)
 
-	_, err = h.db.DeleteRosterItem("ortuman", "juliet")
+	_, err = h.db.DeleteRosterItem(context.Background(), "ortuman", "juliet")
 	require.NoError(t, err)
-	_, err = h.db.DeleteRosterItem("ortuman", "romeo")
+	_, err = h.db.DeleteRosterItem(context.Background(), "ortuman", "romeo")
 	require.NoError(t, err)
 
-	ris, _, err = h.db.FetchRosterItems("ortuman")
+	ris, _, err = h.db.FetchRosterItems(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.Equal(t, 0, len(ris))
 }
@@ -72,26 +73,57 @@ func TestBadgerDB_RosterNotifications(t *testing.T) {
 		JID:      "romeo@jackal.im",
 		Presence: &xmpp.Presence{},
 	}
-	require.NoError(t, h.db.InsertOrUpdateRosterNotification(&rn1))
-	require.NoError(t, h.db.InsertOrUpdateRosterNotification(&rn2))
+	require.NoError(t, h.db.InsertOrUpdateRosterNotification(context.Background(), &rn1))
+	require.NoError(t, h.db.InsertOrUpdateRosterNotification(context.Background(), &rn2))
 
-	rns, err := h.db.FetchRosterNotifications("ortuman")
+	rns, err := h.db.FetchRosterNotifications(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.Equal(t, 2, len(rns))
 
-	rns2, err := h.db.FetchRosterNotifications("ortuman2")
+	rns2, err := h.db.FetchRosterNotifications(context.Background(), "ortuman2")
 	require.Nil(t, err)
 	require.Equal(t, 0, len(rns2))
 
-	require.NoError(t, h.db.DeleteRosterNotification(rn1.Contact, rn1.JID))
+	require.NoError(t, h.db.DeleteRosterNotification(context.Background(), rn1.Contact, rn1.JID))
 
-	rns, err = h.db.FetchRosterNotifications("ortuman")
+	rns, err = h.db.FetchRosterNotifications(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.Equal(t, 1, len(rns))
 
-	require.NoError(t, h.db.DeleteRosterNotification(rn2.Contact, rn2.JID))
+	require.NoError(t, h.db.DeleteRosterNotification(context.Background(), rn2.Contact, rn2.JID))
 
-	rns, err = h.db.FetchRosterNotifications("ortuman")
+	rns, err = h.db.FetchRosterNotifications(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.Equal(t, 0, len(rns))
 }
+
+func TestBadgerDB_RosterItemsPage(t *testing.T) {
+	t.Parallel()
+
+	h := tUtilBadgerDBSetup()
+	defer tUtilBadgerDBTeardown(h)
+
+	for _, contact := range []string{"romeo", "juliet", "noelia", "mercutio"} {
+		_, err := h.db.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{Username: "ortuman", JID: contact})
+		require.NoError(t, err)
+	}
+	_, err := h.db.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{Username: "ortuman2", JID: "benvolio"})
+	require.NoError(t, err)
+
+	ris, ver, err := h.db.FetchRosterItemsPage(context.Background(), "ortuman", "", 3)
+	require.Nil(t, err)
+	require.Equal(t, 4, ver.Ver)
+	require.Equal(t, 3, len(ris))
+	require.Equal(t, "juliet", ris[0].JID)
+	require.Equal(t, "mercutio", ris[1].JID)
+	require.Equal(t, "noelia", ris[2].JID)
+
+	ris, _, err = h.db.FetchRosterItemsPage(context.Background(), "ortuman", "noelia", 3)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(ris))
+	require.Equal(t, "romeo", ris[0].JID)
+
+	ris, _, err = h.db.FetchRosterItemsPage(context.Background(), "ortuman", "romeo", 3)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(ris))
+}
@@ -6,29 +6,47 @@
 package badgerdb
 
 import (
+	"context"
+	"strings"
+
 	"github.com/dgraph-io/badger"
 	"github.com/ortuman/jackal/model"
 )
 
 // InsertOrUpdateUser inserts a new user entity into storage,
 // or updates it in case it's been previously inserted.
-func (b *Storage) InsertOrUpdateUser(user *model.User) error {
-	return b.db.Update(func(tx *badger.Txn) error {
+func (b *Storage) InsertOrUpdateUser(ctx context.Context, user *model.User) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
 		return b.insertOrUpdate(user, b.userKey(user.Username), tx)
 	})
 }
 
 // DeleteUser deletes a user entity from storage.
-func (b *Storage) DeleteUser(username string) error {
-	return b.db.Update(func(tx *badger.Txn) error {
+func (b *Storage) DeleteUser(ctx context.Context, username string) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
+		entry, err := b.getVal(b.directoryEntryKey(username), tx)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			if err := b.delete(b.directoryEntryKey(username), tx); err != nil {
+				return err
+			}
+		}
+		if err := b.delete(b.vCardKey(username), tx); err != nil {
+			return err
+		}
+		if err := b.deletePrefix(ctx, b.bookmarkKey(username, ""), tx); err != nil {
+			return err
+		}
 		return b.delete(b.userKey(username), tx)
 	})
 }
 
 // FetchUser retrieves from storage a user entity.
-func (b *Storage) FetchUser(username string) (*model.User, error) {
+func (b *Storage) FetchUser(ctx context.Context, username string) (*model.User, error) {
 	var usr model.User
-	err := b.fetch(&usr, b.userKey(username))
+	err := b.fetch(ctx, &usr, b.userKey(username))
 	switch err {
 	case nil:
 		return &usr, nil
@@ -40,8 +58,8 @@ func (b *Storage) FetchUser(username string) (*model.User, error) {
 }
 
 // UserExists returns whether or not a user exists within storage.
-func (b *Storage) UserExists(username string) (bool, error) {
-	err := b.fetch(nil, b.userKey(username))
+func (b *Storage) UserExists(ctx context.Context, username string) (bool, error) {
+	err := b.fetch(ctx, nil, b.userKey(username))
 	switch err {
 	case nil:
 		return true, nil
@@ -52,6 +70,16 @@ func (b *Storage) UserExists(username string) (bool, error) {
 	}
 }
 
+// FetchUsernames retrieves from storage the username of every user entity.
+func (b *Storage) FetchUsernames(ctx context.Context) ([]string, error) {
+	var ret []string
+	err := b.forEachKey(ctx, []byte("users:"), func(k []byte) error {
+		ret = append(ret, strings.TrimPrefix(string(k), "users:"))
+		return nil
+	})
+	return ret, err
+}
+
 func (b *Storage) userKey(username string) []byte {
 	return []byte("users:" + username)
 }
@@ -6,9 +6,11 @@
 package badgerdb
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xmpp"
 	"github.com/stretchr/testify/require"
 )
 
@@ -20,26 +22,42 @@ func TestBadgerDB_User(t *testing.T) {
 
 	usr := model.User{Username: "ortuman", Password: "1234"}
 
-	err := h.db.InsertOrUpdateUser(&usr)
+	err := h.db.InsertOrUpdateUser(context.Background(), &usr)
 	require.Nil(t, err)
 
-	usr2, err := h.db.FetchUser("ortuman")
+	usr2, err := h.db.FetchUser(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.Equal(t, "ortuman", usr2.Username)
 	require.Equal(t, "1234", usr2.Password)
 
-	exists, err := h.db.UserExists("ortuman")
+	exists, err := h.db.UserExists(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.True(t, exists)
 
-	usr3, err := h.db.FetchUser("ortuman2")
+	require.Nil(t, h.db.InsertOrUpdateUser(context.Background(), &model.User{Username: "noelia", Password: "5678"}))
+	usernames, err := h.db.FetchUsernames(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, []string{"noelia", "ortuman"}, usernames)
+
+	usr3, err := h.db.FetchUser(context.Background(), "ortuman2")
 	require.Nil(t, usr3)
 	require.Nil(t, err)
 
-	err = h.db.DeleteUser("ortuman")
+	require.Nil(t, h.db.InsertOrUpdateVCard(context.Background(), xmpp.NewElementNamespace("vCard", "vcard-temp"), "ortuman"))
+	require.Nil(t, h.db.InsertOrUpdateBookmark(context.Background(), &model.Bookmark{Username: "ortuman", JID: "jdev@conference.jabber.org"}))
+
+	err = h.db.DeleteUser(context.Background(), "ortuman")
 	require.Nil(t, err)
 
-	exists, err = h.db.UserExists("ortuman")
+	exists, err = h.db.UserExists(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.False(t, exists)
+
+	vCard, err := h.db.FetchVCard(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Nil(t, vCard)
+
+	bookmarks, err := h.db.FetchBookmarks(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(bookmarks))
 }
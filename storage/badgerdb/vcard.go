@@ -6,23 +6,25 @@
 package badgerdb
 
 import (
+	"context"
+
 	"github.com/dgraph-io/badger"
 	"github.com/ortuman/jackal/xmpp"
 )
 
 // InsertOrUpdateVCard inserts a new vCard element into storage,
 // or updates it in case it's been previously inserted.
-func (b *Storage) InsertOrUpdateVCard(vCard xmpp.XElement, username string) error {
-	return b.db.Update(func(tx *badger.Txn) error {
+func (b *Storage) InsertOrUpdateVCard(ctx context.Context, vCard xmpp.XElement, username string) error {
+	return b.update(ctx, func(tx *badger.Txn) error {
 		return b.insertOrUpdate(vCard, b.vCardKey(username), tx)
 	})
 }
 
 // FetchVCard retrieves from storage a vCard element associated
 // to a given user.
-func (b *Storage) FetchVCard(username string) (xmpp.XElement, error) {
+func (b *Storage) FetchVCard(ctx context.Context, username string) (xmpp.XElement, error) {
 	var vCard xmpp.Element
-	err := b.fetch(&vCard, b.vCardKey(username))
+	err := b.fetch(ctx, &vCard, b.vCardKey(username))
 	switch err {
 	case nil:
 		return &vCard, nil
@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package storage
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/xmpp"
+)
+
+const (
+	usersCacheName       = "users"
+	rosterItemsCacheName = "roster_items"
+	vCardsCacheName      = "vcards"
+	blockListsCacheName  = "block_lists"
+)
+
+type cachedRosterItems struct {
+	items []rostermodel.Item
+	ver   rostermodel.Version
+}
+
+// cachedStorage is a read-through caching decorator of a storage instance.
+// Every write operation is forwarded to the decorated storage before
+// invalidating the affected cache entries.
+type cachedStorage struct {
+	Storage
+	users       *lruCache
+	rosterItems *lruCache
+	vCards      *lruCache
+	blockLists  *lruCache
+}
+
+func newCachedStorage(s Storage, cfg *CacheConfig) *cachedStorage {
+	return &cachedStorage{
+		Storage:     s,
+		users:       newPolicyCache(cfg.Users),
+		rosterItems: newPolicyCache(cfg.RosterItems),
+		vCards:      newPolicyCache(cfg.VCards),
+		blockLists:  newPolicyCache(cfg.BlockLists),
+	}
+}
+
+func newPolicyCache(p *CachePolicy) *lruCache {
+	if p == nil {
+		return nil
+	}
+	return newLRUCache(p.Size, p.TTL)
+}
+
+// CacheStats returns usage statistics of every cached entity type.
+func (s *cachedStorage) CacheStats() map[string]CacheStats {
+	ret := make(map[string]CacheStats)
+	for name, c := range map[string]*lruCache{
+		usersCacheName:       s.users,
+		rosterItemsCacheName: s.rosterItems,
+		vCardsCacheName:      s.vCards,
+		blockListsCacheName:  s.blockLists,
+	} {
+		if c != nil {
+			ret[name] = c.stats()
+		}
+	}
+	return ret
+}
+
+// Backup forwards an online backup request to the decorated storage.
+func (s *cachedStorage) Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error) {
+	bs, ok := s.Storage.(backupStorage)
+	if !ok {
+		return 0, ErrBackupNotSupported
+	}
+	return bs.Backup(ctx, w, since)
+}
+
+func (s *cachedStorage) InsertOrUpdateUser(ctx context.Context, user *model.User) error {
+	err := s.Storage.InsertOrUpdateUser(ctx, user)
+	s.users.invalidate(user.Username)
+	return err
+}
+
+func (s *cachedStorage) DeleteUser(ctx context.Context, username string) error {
+	err := s.Storage.DeleteUser(ctx, username)
+	s.users.invalidate(username)
+	s.rosterItems.invalidate(username)
+	s.vCards.invalidate(username)
+	s.blockLists.invalidate(username)
+	return err
+}
+
+func (s *cachedStorage) FetchUser(ctx context.Context, username string) (*model.User, error) {
+	v, ok, gen := s.users.lookup(username)
+	if !ok {
+		usr, err := s.Storage.FetchUser(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		s.users.store(username, usr, gen)
+		v = usr
+	}
+	usr := v.(*model.User)
+	if usr == nil {
+		return nil, nil
+	}
+	ret := *usr // callers may modify returned entity
+	return &ret, nil
+}
+
+func (s *cachedStorage) UserExists(ctx context.Context, username string) (bool, error) {
+	if v, ok, _ := s.users.lookup(username); ok {
+		return v.(*model.User) != nil, nil
+	}
+	return s.Storage.UserExists(ctx, username)
+}
+
+func (s *cachedStorage) InsertOrUpdateRosterItem(ctx context.Context, ri *rostermodel.Item) (rostermodel.Version, error) {
+	ver, err := s.Storage.InsertOrUpdateRosterItem(ctx, ri)
+	s.rosterItems.invalidate(ri.Username)
+	return ver, err
+}
+
+func (s *cachedStorage) DeleteRosterItem(ctx context.Context, username, jid string) (rostermodel.Version, error) {
+	ver, err := s.Storage.DeleteRosterItem(ctx, username, jid)
+	s.rosterItems.invalidate(username)
+	return ver, err
+}
+
+func (s *cachedStorage) FetchRosterItems(ctx context.Context, username string) ([]rostermodel.Item, rostermodel.Version, error) {
+	v, ok, gen := s.rosterItems.lookup(username)
+	if !ok {
+		items, ver, err := s.Storage.FetchRosterItems(ctx, username)
+		if err != nil {
+			return nil, rostermodel.Version{}, err
+		}
+		v = &cachedRosterItems{items: items, ver: ver}
+		s.rosterItems.store(username, v, gen)
+	}
+	cri := v.(*cachedRosterItems)
+	if cri.items == nil {
+		return nil, cri.ver, nil
+	}
+	items := make([]rostermodel.Item, len(cri.items))
+	copy(items, cri.items)
+	return items, cri.ver, nil
+}
+
+// FetchRosterItemsPage serves a roster page from cache whenever the whole
+// user roster is cached, delegating the request to storage otherwise.
+func (s *cachedStorage) FetchRosterItemsPage(ctx context.Context, username, afterJID string, limit int) ([]rostermodel.Item, rostermodel.Version, error) {
+	v, ok, _ := s.rosterItems.lookup(username)
+	if !ok {
+		return s.Storage.FetchRosterItemsPage(ctx, username, afterJID, limit)
+	}
+	cri := v.(*cachedRosterItems)
+	var items []rostermodel.Item
+	for _, ri := range cri.items {
+		if ri.JID > afterJID {
+			items = append(items, ri)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].JID < items[j].JID })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, cri.ver, nil
+}
+
+func (s *cachedStorage) FetchRosterItem(ctx context.Context, username, jid string) (*rostermodel.Item, error) {
+	v, ok, _ := s.rosterItems.lookup(username)
+	if !ok {
+		return s.Storage.FetchRosterItem(ctx, username, jid)
+	}
+	for _, ri := range v.(*cachedRosterItems).items {
+		if ri.JID == jid {
+			ret := ri
+			return &ret, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *cachedStorage) InsertOrUpdateVCard(ctx context.Context, vCard xmpp.XElement, username string) error {
+	err := s.Storage.InsertOrUpdateVCard(ctx, vCard, username)
+	s.vCards.invalidate(username)
+	return err
+}
+
+func (s *cachedStorage) FetchVCard(ctx context.Context, username string) (xmpp.XElement, error) {
+	v, ok, gen := s.vCards.lookup(username)
+	if !ok {
+		vCard, err := s.Storage.FetchVCard(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		s.vCards.store(username, vCard, gen)
+		v = vCard
+	}
+	vCard, _ := v.(xmpp.XElement)
+	if vCard == nil {
+		return nil, nil
+	}
+	return xmpp.NewElementFromElement(vCard), nil // callers may modify returned element
+}
+
+func (s *cachedStorage) InsertBlockListItems(ctx context.Context, items []model.BlockListItem) error {
+	err := s.Storage.InsertBlockListItems(ctx, items)
+	s.invalidateBlockLists(items)
+	return err
+}
+
+func (s *cachedStorage) DeleteBlockListItems(ctx context.Context, items []model.BlockListItem) error {
+	err := s.Storage.DeleteBlockListItems(ctx, items)
+	s.invalidateBlockLists(items)
+	return err
+}
+
+func (s *cachedStorage) FetchBlockListItems(ctx context.Context, username string) ([]model.BlockListItem, error) {
+	v, ok, gen := s.blockLists.lookup(username)
+	if !ok {
+		items, err := s.Storage.FetchBlockListItems(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		s.blockLists.store(username, items, gen)
+		v = items
+	}
+	cached := v.([]model.BlockListItem)
+	if cached == nil {
+		return nil, nil
+	}
+	items := make([]model.BlockListItem, len(cached))
+	copy(items, cached)
+	return items, nil
+}
+
+// FetchBlockListItemsPage serves a block list page from cache whenever the whole
+// user block list is cached, delegating the request to storage otherwise.
+func (s *cachedStorage) FetchBlockListItemsPage(ctx context.Context, username, afterJID string, limit int) ([]model.BlockListItem, error) {
+	v, ok, _ := s.blockLists.lookup(username)
+	if !ok {
+		return s.Storage.FetchBlockListItemsPage(ctx, username, afterJID, limit)
+	}
+	var items []model.BlockListItem
+	for _, it := range v.([]model.BlockListItem) {
+		if it.JID > afterJID {
+			items = append(items, it)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].JID < items[j].JID })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (s *cachedStorage) invalidateBlockLists(items []model.BlockListItem) {
+	for _, item := range items {
+		s.blockLists.invalidate(item.Username)
+	}
+}
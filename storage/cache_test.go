@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedStorage_User(t *testing.T) {
+	s, ms := tUtilCachedStorage()
+
+	require.Nil(t, s.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"}))
+
+	usr, err := s.FetchUser(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, "1234", usr.Password)
+	usr.Password = "modified"
+
+	// bypass cache invalidation
+	require.Nil(t, ms.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "5678"}))
+
+	usr, err = s.FetchUser(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, "1234", usr.Password)
+	exists, err := s.UserExists(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.True(t, exists)
+
+	require.Nil(t, s.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "4321"}))
+	usr, err = s.FetchUser(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, "4321", usr.Password)
+
+	// not found users are also cached
+	usr, err = s.FetchUser(context.Background(), "noelia")
+	require.Nil(t, err)
+	require.Nil(t, usr)
+	exists, err = s.UserExists(context.Background(), "noelia")
+	require.Nil(t, err)
+	require.False(t, exists)
+
+	require.Nil(t, s.DeleteUser(context.Background(), "ortuman"))
+	usr, err = s.FetchUser(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Nil(t, usr)
+
+	require.Equal(t, CacheStats{Hits: 3, Misses: 4, Entries: 2}, s.CacheStats()[usersCacheName])
+}
+
+func TestCachedStorage_RosterItems(t *testing.T) {
+	s, ms := tUtilCachedStorage()
+
+	ri := rostermodel.Item{Username: "ortuman", JID: "noelia@jackal.im", Subscription: "both"}
+	_, err := s.InsertOrUpdateRosterItem(context.Background(), &ri)
+	require.Nil(t, err)
+
+	items, ver, err := s.FetchRosterItems(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+	require.Equal(t, 1, ver.Ver)
+
+	_, err = ms.DeleteRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
+	require.Nil(t, err)
+
+	items, _, err = s.FetchRosterItems(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+
+	item, err := s.FetchRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
+	require.Nil(t, err)
+	require.Equal(t, "both", item.Subscription)
+	item, err = s.FetchRosterItem(context.Background(), "ortuman", "romeo@jackal.im")
+	require.Nil(t, err)
+	require.Nil(t, item)
+
+	_, err = s.DeleteRosterItem(context.Background(), "ortuman", "noelia@jackal.im")
+	require.Nil(t, err)
+	items, _, err = s.FetchRosterItems(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(items))
+}
+
+func TestCachedStorage_Pages(t *testing.T) {
+	s, ms := tUtilCachedStorage()
+
+	var blItems []model.BlockListItem
+	for _, j := range []string{"romeo@jackal.im", "noelia@jackal.im", "juliet@jackal.im"} {
+		_, err := s.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{Username: "ortuman", JID: j})
+		require.Nil(t, err)
+		blItems = append(blItems, model.BlockListItem{Username: "ortuman", JID: j})
+	}
+	require.Nil(t, s.InsertBlockListItems(context.Background(), blItems))
+
+	// not cached yet, delegated to storage
+	items, ver, err := s.FetchRosterItemsPage(context.Background(), "ortuman", "", 2)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(items))
+	require.Equal(t, 3, ver.Ver)
+	require.Equal(t, "juliet@jackal.im", items[0].JID)
+
+	_, _, err = s.FetchRosterItems(context.Background(), "ortuman")
+	require.Nil(t, err)
+	_, err = s.FetchBlockListItems(context.Background(), "ortuman")
+	require.Nil(t, err)
+
+	// not seen from cached pages
+	_, err = ms.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{Username: "ortuman", JID: "alice@jackal.im"})
+	require.Nil(t, err)
+	require.Nil(t, ms.InsertBlockListItems(context.Background(), []model.BlockListItem{{Username: "ortuman", JID: "alice@jackal.im"}}))
+
+	items, ver, err = s.FetchRosterItemsPage(context.Background(), "ortuman", "", 2)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(items))
+	require.Equal(t, "juliet@jackal.im", items[0].JID)
+	require.Equal(t, 3, ver.Ver)
+	items, _, err = s.FetchRosterItemsPage(context.Background(), "ortuman", "noelia@jackal.im", 2)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+	require.Equal(t, "romeo@jackal.im", items[0].JID)
+
+	blPage, err := s.FetchBlockListItemsPage(context.Background(), "ortuman", "", 2)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(blPage))
+	require.Equal(t, "juliet@jackal.im", blPage[0].JID)
+	require.Equal(t, "noelia@jackal.im", blPage[1].JID)
+	blPage, err = s.FetchBlockListItemsPage(context.Background(), "ortuman", "noelia@jackal.im", 2)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(blPage))
+	require.Equal(t, "romeo@jackal.im", blPage[0].JID)
+}
+
+func TestCachedStorage_VCardAndBlockList(t *testing.T) {
+	s, ms := tUtilCachedStorage()
+
+	vCard := xmpp.NewElementNamespace("vCard", "vcard-temp")
+	require.Nil(t, s.InsertOrUpdateVCard(context.Background(), vCard, "ortuman"))
+	blItems := []model.BlockListItem{{Username: "ortuman", JID: "noelia@jackal.im"}}
+	require.Nil(t, s.InsertBlockListItems(context.Background(), blItems))
+
+	v, err := s.FetchVCard(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, "vcard-temp", v.Namespace())
+	items, err := s.FetchBlockListItems(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+
+	require.Nil(t, ms.InsertOrUpdateVCard(context.Background(), xmpp.NewElementNamespace("vCard", "urn:ietf:params:xml:ns:vcard-4.0"), "ortuman"))
+	require.Nil(t, ms.DeleteBlockListItems(context.Background(), blItems))
+
+	v, err = s.FetchVCard(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, "vcard-temp", v.Namespace())
+
+	// returned vCards must not share state with cached ones
+	v.(*xmpp.Element).AppendElement(xmpp.NewElementName("FN"))
+	v, err = s.FetchVCard(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Nil(t, v.Elements().Child("FN"))
+	items, err = s.FetchBlockListItems(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+
+	require.Nil(t, s.DeleteBlockListItems(context.Background(), blItems))
+	items, err = s.FetchBlockListItems(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, 0, len(items))
+
+	// uncached entity types are always fetched from storage
+	ms.EnableMockedError()
+	_, err = s.FetchPrivateXMLNamespaces(context.Background(), "ortuman")
+	require.Equal(t, memstorage.ErrMockedError, err)
+	ms.DisableMockedError()
+}
+
+func tUtilCachedStorage() (*cachedStorage, *memstorage.Storage) {
+	ms := memstorage.New()
+	p := &CachePolicy{Size: 16, TTL: time.Minute}
+	return newCachedStorage(ms, &CacheConfig{Users: p, RosterItems: p, VCards: p, BlockLists: p}), ms
+}
@@ -8,12 +8,17 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ortuman/jackal/storage/badgerdb"
 	"github.com/ortuman/jackal/storage/sql"
 )
 
-const defaultMySQLPoolSize = 16
+const (
+	defaultMySQLPoolSize = 16
+	defaultCacheSize     = 1024
+	defaultCallTimeout   = time.Duration(10) * time.Second
+)
 
 // StorageType represents a storage manager type.
 type StorageType int
@@ -34,12 +39,16 @@ type Config struct {
 	Type     StorageType
 	MySQL    *sql.Config
 	BadgerDB *badgerdb.Config
+	Cache    *CacheConfig
+	Timeout  time.Duration
 }
 
 type storageProxyType struct {
 	Type     string           `yaml:"type"`
 	MySQL    *sql.Config      `yaml:"mysql"`
 	BadgerDB *badgerdb.Config `yaml:"badgerdb"`
+	Cache    *CacheConfig     `yaml:"cache"`
+	Timeout  int              `yaml:"timeout"`
 }
 
 // UnmarshalYAML satisfies Unmarshaler interface.
@@ -81,5 +90,57 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	default:
 		return fmt.Errorf("storage.Config: unrecognized storage type: %s", p.Type)
 	}
+	c.Cache = p.Cache
+	if p.Timeout < 0 {
+		return errors.New("storage.Config: timeout must not be negative")
+	}
+	c.Timeout = time.Duration(p.Timeout) * time.Second
+	if c.Timeout == 0 {
+		c.Timeout = defaultCallTimeout
+	}
+	return nil
+}
+
+// CacheConfig represents a storage cache configuration.
+// Only entity types with an assigned policy will be cached.
+type CacheConfig struct {
+	Users       *CachePolicy `yaml:"users"`
+	RosterItems *CachePolicy `yaml:"roster_items"`
+	VCards      *CachePolicy `yaml:"vcards"`
+	BlockLists  *CachePolicy `yaml:"block_lists"`
+}
+
+// CachePolicy represents an entity type cache policy.
+type CachePolicy struct {
+	// Size is the maximum number of cached entries, evicting
+	// the least recently used one once reached.
+	Size int
+
+	// TTL is the amount of time an entry remains cached.
+	TTL time.Duration
+}
+
+type cachePolicyProxyType struct {
+	Size int `yaml:"size"`
+	TTL  int `yaml:"ttl"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *CachePolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := cachePolicyProxyType{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	if p.Size < 0 {
+		return errors.New("storage.CachePolicy: size must not be negative")
+	}
+	if p.TTL <= 0 {
+		return errors.New("storage.CachePolicy: ttl must be specified")
+	}
+	c.Size = p.Size
+	if c.Size == 0 {
+		c.Size = defaultCacheSize
+	}
+	c.TTL = time.Duration(p.TTL) * time.Second
 	return nil
 }
@@ -7,6 +7,7 @@ package storage
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v2"
@@ -21,6 +22,7 @@ func TestStorageConfig(t *testing.T) {
 	err := yaml.Unmarshal([]byte(memCfg), &cfg)
 	require.Nil(t, err)
 	require.Equal(t, Memory, cfg.Type)
+	require.Equal(t, defaultCallTimeout, cfg.Timeout)
 
 	mySQLCfg := `
   type: mysql
@@ -30,6 +32,7 @@ func TestStorageConfig(t *testing.T) {
     password: password
     database: jackaldb
     pool_size: 16
+  timeout: 5
 `
 
 	err = yaml.Unmarshal([]byte(mySQLCfg), &cfg)
@@ -39,6 +42,7 @@ func TestStorageConfig(t *testing.T) {
 	require.Equal(t, "password", cfg.MySQL.Password)
 	require.Equal(t, "jackaldb", cfg.MySQL.Database)
 	require.Equal(t, 16, cfg.MySQL.PoolSize)
+	require.Equal(t, 5*time.Second, cfg.Timeout)
 
 	mySQLCfg2 := `
   type: mysql
@@ -65,6 +69,13 @@ func TestStorageConfig(t *testing.T) {
 `
 	err = yaml.Unmarshal([]byte(invalidCfg), &cfg)
 	require.NotNil(t, err)
+
+	invalidTimeoutCfg := `
+  type: memory
+  timeout: -1
+`
+	err = yaml.Unmarshal([]byte(invalidTimeoutCfg), &cfg)
+	require.NotNil(t, err)
 }
 
 func TestStorageBadConfig(t *testing.T) {
@@ -76,3 +87,44 @@ func TestStorageBadConfig(t *testing.T) {
 	err := yaml.Unmarshal([]byte(memCfg), &cfg)
 	require.NotNil(t, err)
 }
+
+func TestStorageCacheConfig(t *testing.T) {
+	cfg := Config{}
+
+	cacheCfg := `
+  type: memory
+  cache:
+    users:
+      size: 512
+      ttl: 60
+    roster_items:
+      ttl: 30
+`
+	err := yaml.Unmarshal([]byte(cacheCfg), &cfg)
+	require.Nil(t, err)
+	require.NotNil(t, cfg.Cache)
+	require.Equal(t, 512, cfg.Cache.Users.Size)
+	require.Equal(t, time.Minute, cfg.Cache.Users.TTL)
+	require.Equal(t, defaultCacheSize, cfg.Cache.RosterItems.Size)
+	require.Equal(t, 30*time.Second, cfg.Cache.RosterItems.TTL)
+	require.Nil(t, cfg.Cache.VCards)
+	require.Nil(t, cfg.Cache.BlockLists)
+
+	invalidCacheCfg := `
+  type: memory
+  cache:
+    users:
+      ttl: -1
+`
+	err = yaml.Unmarshal([]byte(invalidCacheCfg), &cfg)
+	require.NotNil(t, err)
+
+	noTTLCacheCfg := `
+  type: memory
+  cache:
+    users:
+      size: 512
+`
+	err = yaml.Unmarshal([]byte(noTTLCacheCfg), &cfg)
+	require.NotNil(t, err)
+}
@@ -6,6 +6,9 @@
 package storage
 
 import (
+	"context"
+	"time"
+
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/model/rostermodel"
 	"github.com/ortuman/jackal/xmpp"
@@ -13,84 +16,160 @@ import (
 
 type disabledStorage struct{}
 
-func (_ *disabledStorage) InsertOrUpdateUser(user *model.User) error      { return nil }
-func (_ *disabledStorage) DeleteUser(username string) error               { return nil }
-func (_ *disabledStorage) FetchUser(username string) (*model.User, error) { return nil, nil }
-func (_ *disabledStorage) UserExists(username string) (bool, error)       { return false, nil }
+func (_ *disabledStorage) InsertOrUpdateUser(ctx context.Context, user *model.User) error { return nil }
+func (_ *disabledStorage) DeleteUser(ctx context.Context, username string) error          { return nil }
+func (_ *disabledStorage) FetchUser(ctx context.Context, username string) (*model.User, error) {
+	return nil, nil
+}
+func (_ *disabledStorage) UserExists(ctx context.Context, username string) (bool, error) {
+	return false, nil
+}
 
-func (_ *disabledStorage) InsertOrUpdateRosterItem(ri *rostermodel.Item) (rostermodel.Version, error) {
+func (_ *disabledStorage) InsertOrUpdateRosterItem(ctx context.Context, ri *rostermodel.Item) (rostermodel.Version, error) {
 	return rostermodel.Version{}, nil
 }
 
-func (_ *disabledStorage) DeleteRosterItem(username, jid string) (rostermodel.Version, error) {
+func (_ *disabledStorage) DeleteRosterItem(ctx context.Context, username, jid string) (rostermodel.Version, error) {
 	return rostermodel.Version{}, nil
 }
 
-func (_ *disabledStorage) FetchRosterItems(username string) ([]rostermodel.Item, rostermodel.Version, error) {
+func (_ *disabledStorage) FetchRosterItems(ctx context.Context, username string) ([]rostermodel.Item, rostermodel.Version, error) {
 	return nil, rostermodel.Version{}, nil
 }
 
-func (_ *disabledStorage) FetchRosterItem(username, jid string) (*rostermodel.Item, error) {
+func (_ *disabledStorage) FetchRosterItemsPage(ctx context.Context, username, afterJID string, limit int) ([]rostermodel.Item, rostermodel.Version, error) {
+	return nil, rostermodel.Version{}, nil
+}
+
+func (_ *disabledStorage) FetchRosterItem(ctx context.Context, username, jid string) (*rostermodel.Item, error) {
 	return nil, nil
 }
 
-func (_ *disabledStorage) InsertOrUpdateRosterNotification(rn *rostermodel.Notification) error {
+func (_ *disabledStorage) InsertOrUpdateRosterNotification(ctx context.Context, rn *rostermodel.Notification) error {
 	return nil
 }
 
-func (_ *disabledStorage) DeleteRosterNotification(contact, jid string) error {
+func (_ *disabledStorage) DeleteRosterNotification(ctx context.Context, contact, jid string) error {
 	return nil
 }
 
-func (_ *disabledStorage) FetchRosterNotification(contact string, jid string) (*rostermodel.Notification, error) {
+func (_ *disabledStorage) FetchRosterNotification(ctx context.Context, contact string, jid string) (*rostermodel.Notification, error) {
 	return nil, nil
 }
 
-func (_ *disabledStorage) FetchRosterNotifications(contact string) ([]rostermodel.Notification, error) {
+func (_ *disabledStorage) FetchRosterNotifications(ctx context.Context, contact string) ([]rostermodel.Notification, error) {
 	return nil, nil
 }
 
-func (_ *disabledStorage) InsertOfflineMessage(message *xmpp.Message, username string) error {
+func (_ *disabledStorage) InsertOfflineMessage(ctx context.Context, message *model.OfflineMessage) error {
 	return nil
 }
 
-func (_ *disabledStorage) CountOfflineMessages(username string) (int, error) {
+func (_ *disabledStorage) CountOfflineMessages(ctx context.Context, username string) (int, error) {
 	return 0, nil
 }
 
-func (_ *disabledStorage) FetchOfflineMessages(username string) ([]*xmpp.Message, error) {
+func (_ *disabledStorage) FetchOfflineMessages(ctx context.Context, username string) ([]model.OfflineMessage, error) {
+	return nil, nil
+}
+
+func (_ *disabledStorage) FetchOfflineMessagesPage(ctx context.Context, username string, after *model.OfflineMessage, limit int) ([]model.OfflineMessage, error) {
+	return nil, nil
+}
+
+func (_ *disabledStorage) DeleteOfflineMessage(ctx context.Context, username, id string) error {
+	return nil
+}
+
+func (_ *disabledStorage) DeleteOfflineMessages(ctx context.Context, username string) error {
+	return nil
+}
+
+func (_ *disabledStorage) DeleteOfflineMessagesOlderThan(ctx context.Context, t time.Time) (int, error) {
+	return 0, nil
+}
+
+func (_ *disabledStorage) InsertOrUpdateVCard(ctx context.Context, vCard xmpp.XElement, username string) error {
+	return nil
+}
+
+func (_ *disabledStorage) FetchVCard(ctx context.Context, username string) (xmpp.XElement, error) {
+	return nil, nil
+}
+
+func (_ *disabledStorage) FetchPrivateXML(ctx context.Context, namespace string, username string) ([]xmpp.XElement, error) {
+	return nil, nil
+}
+
+func (_ *disabledStorage) InsertOrUpdatePrivateXML(ctx context.Context, privateXML []xmpp.XElement, namespace string, username string) error {
+	return nil
+}
+
+func (_ *disabledStorage) FetchPrivateXMLNamespaces(ctx context.Context, username string) ([]string, error) {
+	return nil, nil
+}
+
+func (_ *disabledStorage) FetchUsernames(ctx context.Context) ([]string, error) {
 	return nil, nil
 }
 
-func (_ *disabledStorage) DeleteOfflineMessages(username string) error {
+func (_ *disabledStorage) InsertBlockListItems(ctx context.Context, items []model.BlockListItem) error {
 	return nil
 }
 
-func (_ *disabledStorage) InsertOrUpdateVCard(vCard xmpp.XElement, username string) error {
+func (_ *disabledStorage) DeleteBlockListItems(ctx context.Context, items []model.BlockListItem) error {
 	return nil
 }
 
-func (_ *disabledStorage) FetchVCard(username string) (xmpp.XElement, error) {
+func (_ *disabledStorage) FetchBlockListItems(ctx context.Context, username string) ([]model.BlockListItem, error) {
 	return nil, nil
 }
 
-func (_ *disabledStorage) FetchPrivateXML(namespace string, username string) ([]xmpp.XElement, error) {
+func (_ *disabledStorage) FetchBlockListItemsPage(ctx context.Context, username, afterJID string, limit int) ([]model.BlockListItem, error) {
 	return nil, nil
 }
 
-func (_ *disabledStorage) InsertOrUpdatePrivateXML(privateXML []xmpp.XElement, namespace string, username string) error {
+func (_ *disabledStorage) InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error {
 	return nil
 }
 
-func (_ *disabledStorage) InsertBlockListItems(items []model.BlockListItem) error {
+func (_ *disabledStorage) FetchAuditEvents(ctx context.Context, username string) ([]model.AuditEvent, error) {
+	return nil, nil
+}
+
+func (_ *disabledStorage) InsertOrUpdateMOTD(ctx context.Context, motd *model.MOTD) error {
+	return nil
+}
+
+func (_ *disabledStorage) FetchMOTD(ctx context.Context, host string) (*model.MOTD, error) {
+	return nil, nil
+}
+
+func (_ *disabledStorage) DeleteMOTD(ctx context.Context, host string) error {
+	return nil
+}
+
+func (_ *disabledStorage) InsertOrUpdateDirectoryEntry(ctx context.Context, entry *model.DirectoryEntry) error {
+	return nil
+}
+
+func (_ *disabledStorage) FetchDirectoryEntry(ctx context.Context, username string) (*model.DirectoryEntry, error) {
+	return nil, nil
+}
+
+func (_ *disabledStorage) SearchDirectoryEntries(ctx context.Context, query *model.DirectoryQuery, afterUsername string, limit int) ([]model.DirectoryEntry, error) {
+	return nil, nil
+}
+
+func (_ *disabledStorage) InsertOrUpdateBookmark(ctx context.Context, bookmark *model.Bookmark) error {
 	return nil
 }
 
-func (_ *disabledStorage) DeleteBlockListItems(items []model.BlockListItem) error {
+func (_ *disabledStorage) DeleteBookmark(ctx context.Context, username, jid string) error {
 	return nil
 }
 
-func (_ *disabledStorage) FetchBlockListItems(username string) ([]model.BlockListItem, error) {
+func (_ *disabledStorage) FetchBookmarks(ctx context.Context, username string) ([]model.Bookmark, error) {
 	return nil, nil
 }
 
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package storage
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rostermodel"
+)
+
+// PageSize is the number of entities retrieved per storage call
+// while iterating over a collection.
+var PageSize = 256
+
+// ForEachRosterItem calls f for every roster item entity associated to a given user,
+// sorted by contact JID. Iteration stops at the first error returned by f.
+func ForEachRosterItem(ctx context.Context, username string, f func(ri *rostermodel.Item) error) error {
+	var afterJID string
+	for {
+		ris, _, err := FetchRosterItemsPage(ctx, username, afterJID, PageSize)
+		if err != nil {
+			return err
+		}
+		for i := range ris {
+			if err := f(&ris[i]); err != nil {
+				return err
+			}
+		}
+		if len(ris) < PageSize {
+			return nil
+		}
+		afterJID = ris[len(ris)-1].JID
+	}
+}
+
+// ForEachOfflineMessage calls f for every message of a user offline queue,
+// sorted by creation date. Iteration stops at the first error returned by f.
+func ForEachOfflineMessage(ctx context.Context, username string, f func(om *model.OfflineMessage) error) error {
+	var after *model.OfflineMessage
+	for {
+		msgs, err := FetchOfflineMessagesPage(ctx, username, after, PageSize)
+		if err != nil {
+			return err
+		}
+		for i := range msgs {
+			if err := f(&msgs[i]); err != nil {
+				return err
+			}
+		}
+		if len(msgs) < PageSize {
+			return nil
+		}
+		after = &msgs[len(msgs)-1]
+	}
+}
+
+// ForEachBlockListItem calls f for every block list item entity associated to a given user,
+// sorted by JID. Iteration stops at the first error returned by f.
+func ForEachBlockListItem(ctx context.Context, username string, f func(item *model.BlockListItem) error) error {
+	var afterJID string
+	for {
+		items, err := FetchBlockListItemsPage(ctx, username, afterJID, PageSize)
+		if err != nil {
+			return err
+		}
+		for i := range items {
+			if err := f(&items[i]); err != nil {
+				return err
+			}
+		}
+		if len(items) < PageSize {
+			return nil
+		}
+		afterJID = items[len(items)-1].JID
+	}
+}
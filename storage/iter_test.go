@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/model/rostermodel"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_ForEach(t *testing.T) {
+	Set(memstorage.New())
+	defer Unset()
+
+	pageSize := PageSize
+	PageSize = 2
+	defer func() { PageSize = pageSize }()
+
+	j, _ := jid.NewWithString("ortuman@jackal.im/balcony", true)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		contact := fmt.Sprintf("contact%d@jackal.im", i)
+		_, err := InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{Username: "ortuman", JID: contact})
+		require.Nil(t, err)
+		require.Nil(t, InsertBlockListItems(context.Background(), []model.BlockListItem{{Username: "ortuman", JID: contact}}))
+		msg, _ := xmpp.NewMessageFromElement(xmpp.NewElementName("message"), j, j)
+		require.Nil(t, InsertOfflineMessage(context.Background(), &model.OfflineMessage{
+			ID:        fmt.Sprintf("%d", i),
+			Username:  "ortuman",
+			Message:   msg,
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+		}))
+	}
+
+	var jids []string
+	require.Nil(t, ForEachRosterItem(context.Background(), "ortuman", func(ri *rostermodel.Item) error {
+		jids = append(jids, ri.JID)
+		return nil
+	}))
+	require.Equal(t, 5, len(jids))
+	require.Equal(t, "contact4@jackal.im", jids[4])
+
+	jids = nil
+	require.Nil(t, ForEachBlockListItem(context.Background(), "ortuman", func(item *model.BlockListItem) error {
+		jids = append(jids, item.JID)
+		return nil
+	}))
+	require.Equal(t, 5, len(jids))
+
+	var ids []string
+	require.Nil(t, ForEachOfflineMessage(context.Background(), "ortuman", func(om *model.OfflineMessage) error {
+		ids = append(ids, om.ID)
+		return nil
+	}))
+	require.Equal(t, []string{"0", "1", "2", "3", "4"}, ids)
+
+	// iteration stops at first error
+	errStop := errors.New("stop")
+	var cnt int
+	err := ForEachRosterItem(context.Background(), "ortuman", func(ri *rostermodel.Item) error {
+		cnt++
+		return errStop
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, 1, cnt)
+}
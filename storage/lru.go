@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package storage
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CacheStats represents an entity cache usage statistics.
+type CacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+type lruEntry struct {
+	key       string
+	val       interface{}
+	expiresAt time.Time
+}
+
+// lruCache is a size bounded LRU cache whose entries expire after a given TTL.
+// A nil *lruCache behaves as an always empty cache.
+type lruCache struct {
+	mu     sync.Mutex
+	size   int
+	ttl    time.Duration
+	ll     *list.List
+	items  map[string]*list.Element
+	gen    uint64
+	hits   uint64
+	misses uint64
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// lookup returns the cached value associated to key, along with current
+// cache generation which must be passed to a subsequent store call on a miss.
+func (c *lruCache) lookup(key string) (interface{}, bool, uint64) {
+	if c == nil {
+		return nil, false, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*lruEntry)
+		if c.ttl == 0 || time.Now().Before(e.expiresAt) {
+			c.ll.MoveToFront(elem)
+			c.hits++
+			return e.val, true, c.gen
+		}
+		c.removeElement(elem)
+	}
+	c.misses++
+	return nil, false, c.gen
+}
+
+// store caches a value fetched from storage, unless any entry has been
+// invalidated since gen was obtained, as the fetched value could be stale.
+func (c *lruCache) store(key string, val interface{}, gen uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	e := &lruEntry{key: key, val: val, expiresAt: time.Now().Add(c.ttl)}
+	if elem, ok := c.items[key]; ok {
+		elem.Value = e
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.ll.PushFront(e)
+	if c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *lruCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *lruCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.ll.Len()}
+}
+
+func (c *lruCache) removeElement(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*lruEntry).key)
+}
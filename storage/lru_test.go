@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCache_Eviction(t *testing.T) {
+	c := newLRUCache(2, 0)
+
+	_, ok, gen := c.lookup("a")
+	require.False(t, ok)
+	c.store("a", 1, gen)
+	c.store("b", 2, gen)
+
+	v, ok, _ := c.lookup("a") // 'b' becomes least recently used
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+
+	c.store("c", 3, gen)
+	_, ok, _ = c.lookup("b")
+	require.False(t, ok)
+	_, ok, _ = c.lookup("c")
+	require.True(t, ok)
+
+	require.Equal(t, CacheStats{Hits: 2, Misses: 2, Entries: 2}, c.stats())
+}
+
+func TestLRUCache_TTL(t *testing.T) {
+	c := newLRUCache(8, time.Millisecond*50)
+
+	_, _, gen := c.lookup("a")
+	c.store("a", 1, gen)
+	_, ok, _ := c.lookup("a")
+	require.True(t, ok)
+
+	time.Sleep(time.Millisecond * 100)
+	_, ok, _ = c.lookup("a")
+	require.False(t, ok)
+	require.Equal(t, 0, c.stats().Entries)
+}
+
+func TestLRUCache_Invalidate(t *testing.T) {
+	c := newLRUCache(8, 0)
+
+	_, _, gen := c.lookup("a")
+	c.store("a", 1, gen)
+	c.invalidate("a")
+	_, ok, _ := c.lookup("a")
+	require.False(t, ok)
+
+	// values fetched before an invalidation must not be cached
+	_, _, gen = c.lookup("b")
+	c.invalidate("a")
+	c.store("b", 2, gen)
+	_, ok, _ = c.lookup("b")
+	require.False(t, ok)
+
+	// nil cache is always empty
+	var nc *lruCache
+	nc.store("a", 1, 0)
+	_, ok, _ = nc.lookup("a")
+	require.False(t, ok)
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"context"
+
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertAuditEvent appends a new audit event entity into storage.
+func (m *Storage) InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	return m.inWriteLock(ctx, func() error {
+		m.auditEvents[event.Username] = append(m.auditEvents[event.Username], *event)
+		return nil
+	})
+}
+
+// FetchAuditEvents retrieves from storage all audit event entities
+// associated to a given user sorted by creation date.
+func (m *Storage) FetchAuditEvents(ctx context.Context, username string) ([]model.AuditEvent, error) {
+	var ret []model.AuditEvent
+	err := m.inReadLock(ctx, func() error {
+		ret = m.auditEvents[username]
+		return nil
+	})
+	return ret, err
+}
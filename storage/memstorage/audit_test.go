@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockStorageInsertAuditEvent(t *testing.T) {
+	events := []model.AuditEvent{
+		{Type: "login", Username: "ortuman", CreatedAt: time.Now()},
+		{Type: "logout", Username: "ortuman", CreatedAt: time.Now()},
+	}
+	s := New()
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.InsertAuditEvent(context.Background(), &events[0]))
+	s.DisableMockedError()
+
+	s.InsertAuditEvent(context.Background(), &events[0])
+	s.InsertAuditEvent(context.Background(), &events[1])
+	s.InsertAuditEvent(context.Background(), &model.AuditEvent{Type: "login", Username: "noelia", CreatedAt: time.Now()})
+
+	s.EnableMockedError()
+	_, err := s.FetchAuditEvents(context.Background(), "ortuman")
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	sEvents, _ := s.FetchAuditEvents(context.Background(), "ortuman")
+	require.Equal(t, events, sEvents)
+}
@@ -5,12 +5,17 @@
 
 package memstorage
 
-import "github.com/ortuman/jackal/model"
+import (
+	"context"
+	"sort"
+
+	"github.com/ortuman/jackal/model"
+)
 
 // InsertBlockListItems inserts a set of block list item entities
 // into storage, only in case they haven't been previously inserted.
-func (m *Storage) InsertBlockListItems(items []model.BlockListItem) error {
-	return m.inWriteLock(func() error {
+func (m *Storage) InsertBlockListItems(ctx context.Context, items []model.BlockListItem) error {
+	return m.inWriteLock(ctx, func() error {
 		for _, item := range items {
 			bl := m.blockListItems[item.Username]
 			if bl != nil {
@@ -30,8 +35,8 @@ func (m *Storage) InsertBlockListItems(items []model.BlockListItem) error {
 }
 
 // DeleteBlockListItems deletes a set of block list item entities from storage.
-func (m *Storage) DeleteBlockListItems(items []model.BlockListItem) error {
-	return m.inWriteLock(func() error {
+func (m *Storage) DeleteBlockListItems(ctx context.Context, items []model.BlockListItem) error {
+	return m.inWriteLock(ctx, func() error {
 		for _, itm := range items {
 			bl := m.blockListItems[itm.Username]
 			for i, blItem := range bl {
@@ -47,11 +52,33 @@ func (m *Storage) DeleteBlockListItems(items []model.BlockListItem) error {
 
 // FetchBlockListItems retrieves from storage all block list item entities
 // associated to a given user.
-func (m *Storage) FetchBlockListItems(username string) ([]model.BlockListItem, error) {
+func (m *Storage) FetchBlockListItems(ctx context.Context, username string) ([]model.BlockListItem, error) {
 	var ret []model.BlockListItem
-	err := m.inReadLock(func() error {
+	err := m.inReadLock(ctx, func() error {
 		ret = m.blockListItems[username]
 		return nil
 	})
 	return ret, err
 }
+
+// FetchBlockListItemsPage retrieves from storage up to limit block list item entities
+// associated to a given user, sorted by JID and starting right after afterJID.
+func (m *Storage) FetchBlockListItemsPage(ctx context.Context, username, afterJID string, limit int) ([]model.BlockListItem, error) {
+	var ret []model.BlockListItem
+	err := m.inReadLock(ctx, func() error {
+		for _, it := range m.blockListItems[username] {
+			if it.JID > afterJID {
+				ret = append(ret, it)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].JID < ret[j].JID })
+	if len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
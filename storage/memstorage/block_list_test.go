@@ -6,6 +6,7 @@
 package memstorage
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ortuman/jackal/model"
@@ -20,17 +21,17 @@ func TestMockStorageInsertOrUpdateBlockListItems(t *testing.T) {
 	}
 	s := New()
 	s.EnableMockedError()
-	require.Equal(t, ErrMockedError, s.InsertBlockListItems(items))
+	require.Equal(t, ErrMockedError, s.InsertBlockListItems(context.Background(), items))
 	s.DisableMockedError()
 
-	s.InsertBlockListItems(items)
+	s.InsertBlockListItems(context.Background(), items)
 
 	s.EnableMockedError()
-	_, err := s.FetchBlockListItems("ortuman")
+	_, err := s.FetchBlockListItems(context.Background(), "ortuman")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
 
-	sItems, _ := s.FetchBlockListItems("ortuman")
+	sItems, _ := s.FetchBlockListItems(context.Background(), "ortuman")
 	require.Equal(t, items, sItems)
 }
 
@@ -41,15 +42,15 @@ func TestMockStorageDeleteBlockListItems(t *testing.T) {
 		{Username: "ortuman", JID: "juliet@jackal.im"},
 	}
 	s := New()
-	s.InsertBlockListItems(items)
+	s.InsertBlockListItems(context.Background(), items)
 
 	delItems := []model.BlockListItem{{Username: "ortuman", JID: "romeo@jackal.im"}}
 	s.EnableMockedError()
-	require.Equal(t, ErrMockedError, s.DeleteBlockListItems(delItems))
+	require.Equal(t, ErrMockedError, s.DeleteBlockListItems(context.Background(), delItems))
 	s.DisableMockedError()
 
-	s.DeleteBlockListItems(delItems)
-	sItems, _ := s.FetchBlockListItems("ortuman")
+	s.DeleteBlockListItems(context.Background(), delItems)
+	sItems, _ := s.FetchBlockListItems(context.Background(), "ortuman")
 	require.Equal(t, []model.BlockListItem{
 		{Username: "ortuman", JID: "user@jackal.im"},
 		{Username: "ortuman", JID: "juliet@jackal.im"},
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateBookmark inserts a new bookmark entity into storage,
+// or updates it in case it's been previously inserted.
+func (m *Storage) InsertOrUpdateBookmark(ctx context.Context, bookmark *model.Bookmark) error {
+	return m.inWriteLock(ctx, func() error {
+		bookmarks := m.bookmarks[bookmark.Username]
+		for i, b := range bookmarks {
+			if b.JID == bookmark.JID {
+				bookmarks[i] = *bookmark
+				return nil
+			}
+		}
+		bookmarks = append(bookmarks, *bookmark)
+		sort.Slice(bookmarks, func(i, j int) bool { return bookmarks[i].JID < bookmarks[j].JID })
+		m.bookmarks[bookmark.Username] = bookmarks
+		return nil
+	})
+}
+
+// DeleteBookmark deletes a bookmark entity from storage.
+func (m *Storage) DeleteBookmark(ctx context.Context, username, jid string) error {
+	return m.inWriteLock(ctx, func() error {
+		bookmarks := m.bookmarks[username]
+		for i, b := range bookmarks {
+			if b.JID == jid {
+				m.bookmarks[username] = append(bookmarks[:i], bookmarks[i+1:]...)
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// FetchBookmarks retrieves from storage all bookmark entities
+// associated to a given user sorted by JID.
+func (m *Storage) FetchBookmarks(ctx context.Context, username string) ([]model.Bookmark, error) {
+	var ret []model.Bookmark
+	err := m.inReadLock(ctx, func() error {
+		ret = append(ret, m.bookmarks[username]...)
+		return nil
+	})
+	return ret, err
+}
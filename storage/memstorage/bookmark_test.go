@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockStorageBookmarks(t *testing.T) {
+	b1 := &model.Bookmark{Username: "ortuman", JID: "xsf@muc.xmpp.org", Name: "xsf"}
+	b2 := &model.Bookmark{Username: "ortuman", JID: "jdev@conference.jabber.org", Name: "jdev"}
+
+	s := New()
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.InsertOrUpdateBookmark(context.Background(), b1))
+	s.DisableMockedError()
+	require.Nil(t, s.InsertOrUpdateBookmark(context.Background(), b1))
+	require.Nil(t, s.InsertOrUpdateBookmark(context.Background(), b2))
+
+	b1.Autojoin = true
+	require.Nil(t, s.InsertOrUpdateBookmark(context.Background(), b1))
+
+	bookmarks, err := s.FetchBookmarks(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, []model.Bookmark{*b2, *b1}, bookmarks)
+
+	s.EnableMockedError()
+	_, err = s.FetchBookmarks(context.Background(), "ortuman")
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	require.Nil(t, s.DeleteBookmark(context.Background(), "ortuman", b2.JID))
+	bookmarks, _ = s.FetchBookmarks(context.Background(), "ortuman")
+	require.Equal(t, []model.Bookmark{*b1}, bookmarks)
+}
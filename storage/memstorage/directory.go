@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateDirectoryEntry inserts a new user directory entry into storage,
+// or updates it in case it's been previously inserted.
+func (m *Storage) InsertOrUpdateDirectoryEntry(ctx context.Context, entry *model.DirectoryEntry) error {
+	return m.inWriteLock(ctx, func() error {
+		m.directoryEntries[entry.Username] = *entry
+		return nil
+	})
+}
+
+// FetchDirectoryEntry retrieves from storage the directory entry of a given user.
+func (m *Storage) FetchDirectoryEntry(ctx context.Context, username string) (*model.DirectoryEntry, error) {
+	var ret *model.DirectoryEntry
+	err := m.inReadLock(ctx, func() error {
+		if entry, ok := m.directoryEntries[username]; ok {
+			ret = &entry
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// SearchDirectoryEntries retrieves from storage up to limit directory entries
+// matching a query, sorted by username and starting right after afterUsername.
+func (m *Storage) SearchDirectoryEntries(ctx context.Context, query *model.DirectoryQuery, afterUsername string, limit int) ([]model.DirectoryEntry, error) {
+	var ret []model.DirectoryEntry
+	err := m.inReadLock(ctx, func() error {
+		for _, entry := range m.directoryEntries {
+			if entry.Username > afterUsername && query.Matches(&entry) {
+				ret = append(ret, entry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Username < ret[j].Username })
+	if len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
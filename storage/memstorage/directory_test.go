@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockStorageDirectory(t *testing.T) {
+	e1 := &model.DirectoryEntry{Username: "ortuman", FN: "Miguel Ángel", Org: "jackal", Listed: true}
+	e2 := &model.DirectoryEntry{Username: "noelia", FN: "Noelia", Org: "Jackal"}
+	e3 := &model.DirectoryEntry{Username: "romeo", FN: "Romeo", Org: "Montague"}
+
+	s := New()
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.InsertOrUpdateDirectoryEntry(context.Background(), e1))
+	s.DisableMockedError()
+	require.Nil(t, s.InsertOrUpdateDirectoryEntry(context.Background(), e1))
+	require.Nil(t, s.InsertOrUpdateDirectoryEntry(context.Background(), e2))
+	require.Nil(t, s.InsertOrUpdateDirectoryEntry(context.Background(), e3))
+
+	entry, err := s.FetchDirectoryEntry(context.Background(), "ortuman")
+	require.Nil(t, err)
+	require.Equal(t, e1, entry)
+
+	entries, err := s.SearchDirectoryEntries(context.Background(), &model.DirectoryQuery{Org: "JACK"}, "", 10)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, "noelia", entries[0].Username)
+	require.Equal(t, "ortuman", entries[1].Username)
+
+	entries, _ = s.SearchDirectoryEntries(context.Background(), &model.DirectoryQuery{}, "noelia", 1)
+	require.Equal(t, 1, len(entries))
+	require.Equal(t, "ortuman", entries[0].Username)
+
+	entries, _ = s.SearchDirectoryEntries(context.Background(), &model.DirectoryQuery{ListedOnly: true}, "", 10)
+	require.Equal(t, 1, len(entries))
+
+	s.EnableMockedError()
+	_, err = s.SearchDirectoryEntries(context.Background(), &model.DirectoryQuery{}, "", 10)
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	require.Nil(t, s.DeleteUser(context.Background(), "ortuman"))
+	entry, _ = s.FetchDirectoryEntry(context.Background(), "ortuman")
+	require.Nil(t, entry)
+}
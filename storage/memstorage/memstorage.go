@@ -6,6 +6,7 @@
 package memstorage
 
 import (
+	"context"
 	"errors"
 	"sync"
 
@@ -31,8 +32,12 @@ type Storage struct {
 	rosterNotifications map[string][]rostermodel.Notification
 	vCards              map[string]xmpp.XElement
 	privateXML          map[string][]xmpp.XElement
-	offlineMessages     map[string][]*xmpp.Message
+	offlineMessages     map[string][]model.OfflineMessage
 	blockListItems      map[string][]model.BlockListItem
+	auditEvents         map[string][]model.AuditEvent
+	motds               map[string]model.MOTD
+	directoryEntries    map[string]model.DirectoryEntry
+	bookmarks           map[string][]model.Bookmark
 }
 
 // New returns a new in memory storage instance.
@@ -44,8 +49,12 @@ func New() *Storage {
 		rosterNotifications: make(map[string][]rostermodel.Notification),
 		vCards:              make(map[string]xmpp.XElement),
 		privateXML:          make(map[string][]xmpp.XElement),
-		offlineMessages:     make(map[string][]*xmpp.Message),
+		offlineMessages:     make(map[string][]model.OfflineMessage),
 		blockListItems:      make(map[string][]model.BlockListItem),
+		auditEvents:         make(map[string][]model.AuditEvent),
+		motds:               make(map[string]model.MOTD),
+		directoryEntries:    make(map[string]model.DirectoryEntry),
+		bookmarks:           make(map[string][]model.Bookmark),
 	}
 }
 
@@ -75,7 +84,10 @@ func (m *Storage) DisableMockedError() {
 	m.mockingErr = false
 }
 
-func (m *Storage) inWriteLock(f func() error) error {
+func (m *Storage) inWriteLock(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	m.mockErrMu.Lock()
 	defer m.mockErrMu.Unlock()
 	m.invokeCount++
@@ -88,7 +100,10 @@ func (m *Storage) inWriteLock(f func() error) error {
 	return err
 }
 
-func (m *Storage) inReadLock(f func() error) error {
+func (m *Storage) inReadLock(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	m.mockErrMu.Lock()
 	defer m.mockErrMu.Unlock()
 	m.invokeCount++
@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateMOTD inserts a new host message of the day into storage,
+// or updates it in case it's been previously inserted.
+func (m *Storage) InsertOrUpdateMOTD(ctx context.Context, motd *model.MOTD) error {
+	return m.inWriteLock(ctx, func() error {
+		stored := *motd
+		stored.UpdatedAt = time.Now()
+		m.motds[motd.Host] = stored
+		return nil
+	})
+}
+
+// FetchMOTD retrieves from storage the message of the day of a given host.
+func (m *Storage) FetchMOTD(ctx context.Context, host string) (*model.MOTD, error) {
+	var ret *model.MOTD
+	err := m.inReadLock(ctx, func() error {
+		if motd, ok := m.motds[host]; ok {
+			ret = &motd
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// DeleteMOTD deletes from storage the message of the day of a given host.
+func (m *Storage) DeleteMOTD(ctx context.Context, host string) error {
+	return m.inWriteLock(ctx, func() error {
+		delete(m.motds, host)
+		return nil
+	})
+}
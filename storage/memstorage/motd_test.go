@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package memstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockStorageMOTD(t *testing.T) {
+	motd := &model.MOTD{Host: "jackal.im", Body: "Welcome!"}
+
+	s := New()
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.InsertOrUpdateMOTD(context.Background(), motd))
+	s.DisableMockedError()
+	require.Nil(t, s.InsertOrUpdateMOTD(context.Background(), motd))
+
+	s.EnableMockedError()
+	_, err := s.FetchMOTD(context.Background(), "jackal.im")
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	m, err := s.FetchMOTD(context.Background(), "jackal.im")
+	require.Nil(t, err)
+	require.NotNil(t, m)
+	require.Equal(t, "Welcome!", m.Body)
+	require.False(t, m.UpdatedAt.IsZero())
+
+	m, _ = s.FetchMOTD(context.Background(), "jabber.org")
+	require.Nil(t, m)
+
+	require.Nil(t, s.DeleteMOTD(context.Background(), "jackal.im"))
+	m, _ = s.FetchMOTD(context.Background(), "jackal.im")
+	require.Nil(t, m)
+}
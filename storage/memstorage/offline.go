@@ -5,44 +5,130 @@
 
 package memstorage
 
-import "github.com/ortuman/jackal/xmpp"
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xmpp"
+)
 
 // InsertOfflineMessage inserts a new message element into
 // user's offline queue.
-func (m *Storage) InsertOfflineMessage(message *xmpp.Message, username string) error {
-	return m.inWriteLock(func() error {
-		msg, _ := xmpp.NewMessageFromElement(message, message.FromJID(), message.ToJID())
-		msgs := m.offlineMessages[username]
-		msgs = append(msgs, msg)
-		m.offlineMessages[username] = msgs
+func (m *Storage) InsertOfflineMessage(ctx context.Context, message *model.OfflineMessage) error {
+	return m.inWriteLock(ctx, func() error {
+		msg, _ := xmpp.NewMessageFromElement(message.Message, message.Message.FromJID(), message.Message.ToJID())
+		om := *message
+		om.Message = msg
+		m.offlineMessages[message.Username] = append(m.offlineMessages[message.Username], om)
 		return nil
 	})
 }
 
 // CountOfflineMessages returns current length of user's offline queue.
-func (m *Storage) CountOfflineMessages(username string) (int, error) {
+func (m *Storage) CountOfflineMessages(ctx context.Context, username string) (int, error) {
 	var ret int
-	err := m.inReadLock(func() error {
+	err := m.inReadLock(ctx, func() error {
 		ret = len(m.offlineMessages[username])
 		return nil
 	})
 	return ret, err
 }
 
-// FetchOfflineMessages retrieves from storage current user offline queue.
-func (m *Storage) FetchOfflineMessages(username string) ([]*xmpp.Message, error) {
-	var ret []*xmpp.Message
-	err := m.inReadLock(func() error {
-		ret = m.offlineMessages[username]
+// FetchOfflineMessages retrieves from storage current user offline queue
+// sorted by creation date.
+func (m *Storage) FetchOfflineMessages(ctx context.Context, username string) ([]model.OfflineMessage, error) {
+	var ret []model.OfflineMessage
+	err := m.inReadLock(ctx, func() error {
+		msgs := m.offlineMessages[username]
+		if len(msgs) > 0 {
+			ret = make([]model.OfflineMessage, len(msgs))
+			copy(ret, msgs)
+		}
 		return nil
 	})
 	return ret, err
 }
 
+// FetchOfflineMessagesPage retrieves from storage up to limit messages
+// of a user offline queue sorted by creation date, starting right after
+// the given message or at the head of the queue if after is nil.
+func (m *Storage) FetchOfflineMessagesPage(ctx context.Context, username string, after *model.OfflineMessage, limit int) ([]model.OfflineMessage, error) {
+	var ret []model.OfflineMessage
+	err := m.inReadLock(ctx, func() error {
+		for _, msg := range m.offlineMessages[username] {
+			if after == nil || offlineMessageLess(after, &msg) {
+				ret = append(ret, msg)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return offlineMessageLess(&ret[i], &ret[j]) })
+	if len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
+
+// DeleteOfflineMessage deletes a single message from a user offline queue.
+func (m *Storage) DeleteOfflineMessage(ctx context.Context, username, id string) error {
+	return m.inWriteLock(ctx, func() error {
+		msgs := m.offlineMessages[username]
+		for i, msg := range msgs {
+			if msg.ID == id {
+				msgs = append(msgs[:i], msgs[i+1:]...)
+				break
+			}
+		}
+		if len(msgs) > 0 {
+			m.offlineMessages[username] = msgs
+		} else {
+			delete(m.offlineMessages, username)
+		}
+		return nil
+	})
+}
+
 // DeleteOfflineMessages clears a user offline queue.
-func (m *Storage) DeleteOfflineMessages(username string) error {
-	return m.inWriteLock(func() error {
+func (m *Storage) DeleteOfflineMessages(ctx context.Context, username string) error {
+	return m.inWriteLock(ctx, func() error {
 		delete(m.offlineMessages, username)
 		return nil
 	})
 }
+
+// DeleteOfflineMessagesOlderThan deletes every offline message
+// archived before t, returning the number of deleted messages.
+func (m *Storage) DeleteOfflineMessagesOlderThan(ctx context.Context, t time.Time) (int, error) {
+	var cnt int
+	err := m.inWriteLock(ctx, func() error {
+		for username, msgs := range m.offlineMessages {
+			var keep []model.OfflineMessage
+			for _, msg := range msgs {
+				if msg.CreatedAt.Before(t) {
+					cnt++
+					continue
+				}
+				keep = append(keep, msg)
+			}
+			if len(keep) > 0 {
+				m.offlineMessages[username] = keep
+			} else {
+				delete(m.offlineMessages, username)
+			}
+		}
+		return nil
+	})
+	return cnt, err
+}
+
+func offlineMessageLess(m1, m2 *model.OfflineMessage) bool {
+	if m1.CreatedAt.Equal(m2.CreatedAt) {
+		return m1.ID < m2.ID
+	}
+	return m1.CreatedAt.Before(m2.CreatedAt)
+}
@@ -6,8 +6,11 @@
 package memstorage
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/pborman/uuid"
@@ -15,70 +18,132 @@ import (
 )
 
 func TestMockStorageInsertOfflineMessage(t *testing.T) {
-	j, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
-	message := xmpp.NewElementName("message")
-	message.SetID(uuid.New())
-	message.AppendElement(xmpp.NewElementName("body"))
-	m, _ := xmpp.NewMessageFromElement(message, j, j)
+	om := tUtilOfflineMessage("ortuman", time.Now())
 
 	s := New()
 	s.EnableMockedError()
-	require.Equal(t, ErrMockedError, s.InsertOfflineMessage(m, "ortuman"))
+	require.Equal(t, ErrMockedError, s.InsertOfflineMessage(context.Background(), om))
 	s.DisableMockedError()
-	require.Nil(t, s.InsertOfflineMessage(m, "ortuman"))
+	require.Nil(t, s.InsertOfflineMessage(context.Background(), om))
 }
 
 func TestMockStorageCountOfflineMessages(t *testing.T) {
-	j, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
-	message := xmpp.NewElementName("message")
-	message.SetID(uuid.New())
-	message.AppendElement(xmpp.NewElementName("body"))
-	m, _ := xmpp.NewMessageFromElement(message, j, j)
-
 	s := New()
-	s.InsertOfflineMessage(m, "ortuman")
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage("ortuman", time.Now()))
 
 	s.EnableMockedError()
-	_, err := s.CountOfflineMessages("ortuman")
+	_, err := s.CountOfflineMessages(context.Background(), "ortuman")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	cnt, _ := s.CountOfflineMessages("ortuman")
+	cnt, _ := s.CountOfflineMessages(context.Background(), "ortuman")
 	require.Equal(t, 1, cnt)
 }
 
 func TestMockStorageFetchOfflineMessages(t *testing.T) {
-	j, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
-	message := xmpp.NewElementName("message")
-	message.SetID(uuid.New())
-	message.AppendElement(xmpp.NewElementName("body"))
-	m, _ := xmpp.NewMessageFromElement(message, j, j)
+	om := tUtilOfflineMessage("ortuman", time.Now())
 
 	s := New()
-	s.InsertOfflineMessage(m, "ortuman")
+	s.InsertOfflineMessage(context.Background(), om)
 
 	s.EnableMockedError()
-	_, err := s.FetchOfflineMessages("ortuman")
+	_, err := s.FetchOfflineMessages(context.Background(), "ortuman")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	elems, _ := s.FetchOfflineMessages("ortuman")
+	elems, _ := s.FetchOfflineMessages(context.Background(), "ortuman")
 	require.Equal(t, 1, len(elems))
+	require.Equal(t, om.ID, elems[0].ID)
+	require.Equal(t, om.Message.String(), elems[0].Message.String())
 }
 
-func TestMockStorageDeleteOfflineMessages(t *testing.T) {
-	j, _ := jid.NewWithString("ortuman@jackal.im/balcony", false)
-	message := xmpp.NewElementName("message")
-	message.SetID(uuid.New())
-	message.AppendElement(xmpp.NewElementName("body"))
-	m, _ := xmpp.NewMessageFromElement(message, j, j)
+func TestMockStorageFetchOfflineMessagesPage(t *testing.T) {
+	now := time.Now()
+	om1 := tUtilOfflineMessage("ortuman", now.Add(-time.Minute))
+	om2 := tUtilOfflineMessage("ortuman", now)
+	om3 := tUtilOfflineMessage("ortuman", now.Add(-time.Hour))
 
 	s := New()
-	s.InsertOfflineMessage(m, "ortuman")
+	s.InsertOfflineMessage(context.Background(), om1)
+	s.InsertOfflineMessage(context.Background(), om2)
+	s.InsertOfflineMessage(context.Background(), om3)
 
 	s.EnableMockedError()
-	require.Equal(t, ErrMockedError, s.DeleteOfflineMessages("ortuman"))
+	_, err := s.FetchOfflineMessagesPage(context.Background(), "ortuman", nil, 2)
+	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	require.Nil(t, s.DeleteOfflineMessages("ortuman"))
 
-	elems, _ := s.FetchOfflineMessages("ortuman")
+	msgs, _ := s.FetchOfflineMessagesPage(context.Background(), "ortuman", nil, 2)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, om3.ID, msgs[0].ID)
+	require.Equal(t, om1.ID, msgs[1].ID)
+
+	msgs, _ = s.FetchOfflineMessagesPage(context.Background(), "ortuman", &msgs[1], 2)
+	require.Equal(t, 1, len(msgs))
+	require.Equal(t, om2.ID, msgs[0].ID)
+}
+
+func TestMockStorageDeleteOfflineMessage(t *testing.T) {
+	om1 := tUtilOfflineMessage("ortuman", time.Now())
+	om2 := tUtilOfflineMessage("ortuman", time.Now())
+
+	s := New()
+	s.InsertOfflineMessage(context.Background(), om1)
+	s.InsertOfflineMessage(context.Background(), om2)
+
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.DeleteOfflineMessage(context.Background(), "ortuman", om1.ID))
+	s.DisableMockedError()
+	require.Nil(t, s.DeleteOfflineMessage(context.Background(), "ortuman", om1.ID))
+
+	elems, _ := s.FetchOfflineMessages(context.Background(), "ortuman")
+	require.Equal(t, 1, len(elems))
+	require.Equal(t, om2.ID, elems[0].ID)
+}
+
+func TestMockStorageDeleteOfflineMessages(t *testing.T) {
+	s := New()
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage("ortuman", time.Now()))
+
+	s.EnableMockedError()
+	require.Equal(t, ErrMockedError, s.DeleteOfflineMessages(context.Background(), "ortuman"))
+	s.DisableMockedError()
+	require.Nil(t, s.DeleteOfflineMessages(context.Background(), "ortuman"))
+
+	elems, _ := s.FetchOfflineMessages(context.Background(), "ortuman")
 	require.Equal(t, 0, len(elems))
 }
+
+func TestMockStorageDeleteOfflineMessagesOlderThan(t *testing.T) {
+	now := time.Now()
+
+	s := New()
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage("ortuman", now.Add(-time.Hour)))
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage("ortuman", now))
+	s.InsertOfflineMessage(context.Background(), tUtilOfflineMessage("noelia", now.Add(-time.Hour)))
+
+	s.EnableMockedError()
+	_, err := s.DeleteOfflineMessagesOlderThan(context.Background(), now.Add(-time.Minute))
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+	cnt, err := s.DeleteOfflineMessagesOlderThan(context.Background(), now.Add(-time.Minute))
+	require.Nil(t, err)
+	require.Equal(t, 2, cnt)
+
+	cnt, _ = s.CountOfflineMessages(context.Background(), "ortuman")
+	require.Equal(t, 1, cnt)
+	cnt, _ = s.CountOfflineMessages(context.Background(), "noelia")
+	require.Equal(t, 0, cnt)
+}
+
+func tUtilOfflineMessage(username string, createdAt time.Time) *model.OfflineMessage {
+	j, _ := jid.NewWithString(username+"@jackal.im/balcony", false)
+	message := xmpp.NewElementName("message")
+	message.SetID(uuid.New())
+	message.AppendElement(xmpp.NewElementName("body"))
+	m, _ := xmpp.NewMessageFromElement(message, j, j)
+	return &model.OfflineMessage{
+		ID:        uuid.New(),
+		Username:  username,
+		Message:   m,
+		CreatedAt: createdAt,
+	}
+}
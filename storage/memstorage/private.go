@@ -5,12 +5,18 @@
 
 package memstorage
 
-import "github.com/ortuman/jackal/xmpp"
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/ortuman/jackal/xmpp"
+)
 
 // InsertOrUpdatePrivateXML inserts a new private element into storage,
 // or updates it in case it's been previously inserted.
-func (m *Storage) InsertOrUpdatePrivateXML(privateXML []xmpp.XElement, namespace string, username string) error {
-	return m.inWriteLock(func() error {
+func (m *Storage) InsertOrUpdatePrivateXML(ctx context.Context, privateXML []xmpp.XElement, namespace string, username string) error {
+	return m.inWriteLock(ctx, func() error {
 		var elems []xmpp.XElement
 		for _, prv := range privateXML {
 			elems = append(elems, xmpp.NewElementFromElement(prv))
@@ -21,11 +27,28 @@ func (m *Storage) InsertOrUpdatePrivateXML(privateXML []xmpp.XElement, namespace
 }
 
 // FetchPrivateXML retrieves from storage a private element.
-func (m *Storage) FetchPrivateXML(namespace string, username string) ([]xmpp.XElement, error) {
+func (m *Storage) FetchPrivateXML(ctx context.Context, namespace string, username string) ([]xmpp.XElement, error) {
 	var ret []xmpp.XElement
-	err := m.inReadLock(func() error {
+	err := m.inReadLock(ctx, func() error {
 		ret = m.privateXML[username+":"+namespace]
 		return nil
 	})
 	return ret, err
 }
+
+// FetchPrivateXMLNamespaces retrieves from storage the namespace
+// of every private element associated to a given user.
+func (m *Storage) FetchPrivateXMLNamespaces(ctx context.Context, username string) ([]string, error) {
+	var ret []string
+	err := m.inReadLock(ctx, func() error {
+		prefix := username + ":"
+		for k := range m.privateXML {
+			if strings.HasPrefix(k, prefix) {
+				ret = append(ret, strings.TrimPrefix(k, prefix))
+			}
+		}
+		return nil
+	})
+	sort.Strings(ret)
+	return ret, err
+}
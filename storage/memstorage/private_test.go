@@ -6,6 +6,7 @@
 package memstorage
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ortuman/jackal/xmpp"
@@ -17,10 +18,10 @@ func TestMockStorageInsertPrivateXML(t *testing.T) {
 
 	s := New()
 	s.EnableMockedError()
-	err := s.InsertOrUpdatePrivateXML([]xmpp.XElement{private}, "exodus:ns", "ortuman")
+	err := s.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{private}, "exodus:ns", "ortuman")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	err = s.InsertOrUpdatePrivateXML([]xmpp.XElement{private}, "exodus:ns", "ortuman")
+	err = s.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{private}, "exodus:ns", "ortuman")
 	require.Nil(t, err)
 }
 
@@ -28,12 +29,26 @@ func TestMockStorageFetchPrivateXML(t *testing.T) {
 	private := xmpp.NewElementNamespace("exodus", "exodus:ns")
 
 	s := New()
-	s.InsertOrUpdatePrivateXML([]xmpp.XElement{private}, "exodus:ns", "ortuman")
+	s.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{private}, "exodus:ns", "ortuman")
 
 	s.EnableMockedError()
-	_, err := s.FetchPrivateXML("exodus:ns", "ortuman")
+	_, err := s.FetchPrivateXML(context.Background(), "exodus:ns", "ortuman")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	elems, _ := s.FetchPrivateXML("exodus:ns", "ortuman")
+	elems, _ := s.FetchPrivateXML(context.Background(), "exodus:ns", "ortuman")
 	require.Equal(t, 1, len(elems))
 }
+
+func TestMockStorageFetchPrivateXMLNamespaces(t *testing.T) {
+	s := New()
+	s.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{xmpp.NewElementNamespace("exodus", "exodus:ns2")}, "exodus:ns2", "ortuman")
+	s.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{xmpp.NewElementNamespace("exodus", "exodus:ns")}, "exodus:ns", "ortuman")
+	s.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{xmpp.NewElementNamespace("exodus", "exodus:ns")}, "exodus:ns", "noelia")
+
+	s.EnableMockedError()
+	_, err := s.FetchPrivateXMLNamespaces(context.Background(), "ortuman")
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+	namespaces, _ := s.FetchPrivateXMLNamespaces(context.Background(), "ortuman")
+	require.Equal(t, []string{"exodus:ns", "exodus:ns2"}, namespaces)
+}
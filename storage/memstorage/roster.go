@@ -6,14 +6,17 @@
 package memstorage
 
 import (
+	"context"
+	"sort"
+
 	"github.com/ortuman/jackal/model/rostermodel"
 )
 
 // InsertOrUpdateRosterItem inserts a new roster item entity into storage,
 // or updates it in case it's been previously inserted.
-func (m *Storage) InsertOrUpdateRosterItem(ri *rostermodel.Item) (rostermodel.Version, error) {
+func (m *Storage) InsertOrUpdateRosterItem(ctx context.Context, ri *rostermodel.Item) (rostermodel.Version, error) {
 	var v rostermodel.Version
-	err := m.inWriteLock(func() error {
+	err := m.inWriteLock(ctx, func() error {
 		ris := m.rosterItems[ri.Username]
 		if ris != nil {
 			for i, r := range ris {
@@ -39,9 +42,9 @@ func (m *Storage) InsertOrUpdateRosterItem(ri *rostermodel.Item) (rostermodel.Ve
 }
 
 // DeleteRosterItem deletes a roster item entity from storage.
-func (m *Storage) DeleteRosterItem(user, contact string) (rostermodel.Version, error) {
+func (m *Storage) DeleteRosterItem(ctx context.Context, user, contact string) (rostermodel.Version, error) {
 	var v rostermodel.Version
-	err := m.inWriteLock(func() error {
+	err := m.inWriteLock(ctx, func() error {
 		ris := m.rosterItems[user]
 		for i, ri := range ris {
 			if ri.JID == contact {
@@ -61,10 +64,10 @@ func (m *Storage) DeleteRosterItem(user, contact string) (rostermodel.Version, e
 
 // FetchRosterItems retrieves from storage all roster item entities
 // associated to a given user.
-func (m *Storage) FetchRosterItems(user string) ([]rostermodel.Item, rostermodel.Version, error) {
+func (m *Storage) FetchRosterItems(ctx context.Context, user string) ([]rostermodel.Item, rostermodel.Version, error) {
 	var ris []rostermodel.Item
 	var v rostermodel.Version
-	err := m.inReadLock(func() error {
+	err := m.inReadLock(ctx, func() error {
 		ris = m.rosterItems[user]
 		v = m.rosterVersions[user]
 		return nil
@@ -72,10 +75,34 @@ func (m *Storage) FetchRosterItems(user string) ([]rostermodel.Item, rostermodel
 	return ris, v, err
 }
 
+// FetchRosterItemsPage retrieves from storage up to limit roster item entities
+// associated to a given user, sorted by contact JID and starting right after afterJID.
+func (m *Storage) FetchRosterItemsPage(ctx context.Context, user, afterJID string, limit int) ([]rostermodel.Item, rostermodel.Version, error) {
+	var ris []rostermodel.Item
+	var v rostermodel.Version
+	err := m.inReadLock(ctx, func() error {
+		for _, ri := range m.rosterItems[user] {
+			if ri.JID > afterJID {
+				ris = append(ris, ri)
+			}
+		}
+		v = m.rosterVersions[user]
+		return nil
+	})
+	if err != nil {
+		return nil, rostermodel.Version{}, err
+	}
+	sort.Slice(ris, func(i, j int) bool { return ris[i].JID < ris[j].JID })
+	if len(ris) > limit {
+		ris = ris[:limit]
+	}
+	return ris, v, nil
+}
+
 // FetchRosterItem retrieves from storage a roster item entity.
-func (m *Storage) FetchRosterItem(user, contact string) (*rostermodel.Item, error) {
+func (m *Storage) FetchRosterItem(ctx context.Context, user, contact string) (*rostermodel.Item, error) {
 	var ret *rostermodel.Item
-	err := m.inReadLock(func() error {
+	err := m.inReadLock(ctx, func() error {
 		ris := m.rosterItems[user]
 		for _, ri := range ris {
 			if ri.JID == contact {
@@ -90,8 +117,8 @@ func (m *Storage) FetchRosterItem(user, contact string) (*rostermodel.Item, erro
 
 // InsertOrUpdateRosterNotification inserts a new roster notification entity
 // into storage, or updates it in case it's been previously inserted.
-func (m *Storage) InsertOrUpdateRosterNotification(rn *rostermodel.Notification) error {
-	return m.inWriteLock(func() error {
+func (m *Storage) InsertOrUpdateRosterNotification(ctx context.Context, rn *rostermodel.Notification) error {
+	return m.inWriteLock(ctx, func() error {
 		rns := m.rosterNotifications[rn.Contact]
 		if rns != nil {
 			for i, r := range rns {
@@ -111,8 +138,8 @@ func (m *Storage) InsertOrUpdateRosterNotification(rn *rostermodel.Notification)
 }
 
 // DeleteRosterNotification deletes a roster notification entity from storage.
-func (m *Storage) DeleteRosterNotification(contact, jid string) error {
-	return m.inWriteLock(func() error {
+func (m *Storage) DeleteRosterNotification(ctx context.Context, contact, jid string) error {
+	return m.inWriteLock(ctx, func() error {
 		rns := m.rosterNotifications[contact]
 		for i, rn := range rns {
 			if rn.JID == jid {
@@ -125,9 +152,9 @@ func (m *Storage) DeleteRosterNotification(contact, jid string) error {
 }
 
 // FetchRosterNotification retrieves from storage a roster notification entity.
-func (m *Storage) FetchRosterNotification(contact string, jid string) (*rostermodel.Notification, error) {
+func (m *Storage) FetchRosterNotification(ctx context.Context, contact string, jid string) (*rostermodel.Notification, error) {
 	var ret *rostermodel.Notification
-	err := m.inReadLock(func() error {
+	err := m.inReadLock(ctx, func() error {
 		rns := m.rosterNotifications[contact]
 		for _, rn := range rns {
 			if rn.JID == jid {
@@ -142,9 +169,9 @@ func (m *Storage) FetchRosterNotification(contact string, jid string) (*rostermo
 
 // FetchRosterNotifications retrieves from storage all roster notifications
 // associated to a given user.
-func (m *Storage) FetchRosterNotifications(contact string) ([]rostermodel.Notification, error) {
+func (m *Storage) FetchRosterNotifications(ctx context.Context, contact string) ([]rostermodel.Notification, error) {
 	var ret []rostermodel.Notification
-	err := m.inReadLock(func() error {
+	err := m.inReadLock(ctx, func() error {
 		ret = m.rosterNotifications[contact]
 		return nil
 	})
@@ -6,6 +6,7 @@
 package memstorage
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ortuman/jackal/model/rostermodel"
@@ -28,13 +29,13 @@ func TestMockStorageInsertRosterItem(t *testing.T) {
 
 	s := New()
 	s.EnableMockedError()
-	_, err := s.InsertOrUpdateRosterItem(&ri)
+	_, err := s.InsertOrUpdateRosterItem(context.Background(), &ri)
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	_, err = s.InsertOrUpdateRosterItem(&ri)
+	_, err = s.InsertOrUpdateRosterItem(context.Background(), &ri)
 	require.Nil(t, err)
 	ri.Subscription = "to"
-	_, err = s.InsertOrUpdateRosterItem(&ri)
+	_, err = s.InsertOrUpdateRosterItem(context.Background(), &ri)
 	require.Nil(t, err)
 }
 
@@ -50,17 +51,17 @@ func TestMockStorageFetchRosterItem(t *testing.T) {
 		Groups:       g,
 	}
 	s := New()
-	s.InsertOrUpdateRosterItem(&ri)
+	s.InsertOrUpdateRosterItem(context.Background(), &ri)
 
 	s.EnableMockedError()
-	_, err := s.FetchRosterItem("user", "contact")
+	_, err := s.FetchRosterItem(context.Background(), "user", "contact")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
 
-	ri3, _ := s.FetchRosterItem("user", "contact2")
+	ri3, _ := s.FetchRosterItem(context.Background(), "user", "contact2")
 	require.Nil(t, ri3)
 
-	ri4, _ := s.FetchRosterItem("user", "contact")
+	ri4, _ := s.FetchRosterItem(context.Background(), "user", "contact")
 	require.NotNil(t, ri4)
 	require.Equal(t, "user", ri4.Username)
 	require.Equal(t, "contact", ri4.JID)
@@ -88,17 +89,39 @@ func TestMockStorageFetchRosterItems(t *testing.T) {
 	}
 
 	s := New()
-	s.InsertOrUpdateRosterItem(&ri)
-	s.InsertOrUpdateRosterItem(&ri2)
+	s.InsertOrUpdateRosterItem(context.Background(), &ri)
+	s.InsertOrUpdateRosterItem(context.Background(), &ri2)
 
 	s.EnableMockedError()
-	_, _, err := s.FetchRosterItems("user")
+	_, _, err := s.FetchRosterItems(context.Background(), "user")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	ris, _, _ := s.FetchRosterItems("user")
+	ris, _, _ := s.FetchRosterItems(context.Background(), "user")
 	require.Equal(t, 2, len(ris))
 }
 
+func TestMockStorageFetchRosterItemsPage(t *testing.T) {
+	s := New()
+	s.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{Username: "user", JID: "contact3"})
+	s.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{Username: "user", JID: "contact1"})
+	s.InsertOrUpdateRosterItem(context.Background(), &rostermodel.Item{Username: "user", JID: "contact2"})
+
+	s.EnableMockedError()
+	_, _, err := s.FetchRosterItemsPage(context.Background(), "user", "", 2)
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+
+	ris, ver, _ := s.FetchRosterItemsPage(context.Background(), "user", "", 2)
+	require.Equal(t, 3, ver.Ver)
+	require.Equal(t, 2, len(ris))
+	require.Equal(t, "contact1", ris[0].JID)
+	require.Equal(t, "contact2", ris[1].JID)
+
+	ris, _, _ = s.FetchRosterItemsPage(context.Background(), "user", "contact2", 2)
+	require.Equal(t, 1, len(ris))
+	require.Equal(t, "contact3", ris[0].JID)
+}
+
 func TestMockStorageDeleteRosterItem(t *testing.T) {
 	g := []string{"general", "friends"}
 	ri := rostermodel.Item{
@@ -111,18 +134,18 @@ func TestMockStorageDeleteRosterItem(t *testing.T) {
 		Groups:       g,
 	}
 	s := New()
-	s.InsertOrUpdateRosterItem(&ri)
+	s.InsertOrUpdateRosterItem(context.Background(), &ri)
 
 	s.EnableMockedError()
-	_, err := s.DeleteRosterItem("user", "contact")
+	_, err := s.DeleteRosterItem(context.Background(), "user", "contact")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	_, err = s.DeleteRosterItem("user", "contact")
+	_, err = s.DeleteRosterItem(context.Background(), "user", "contact")
 	require.Nil(t, err)
-	_, err = s.DeleteRosterItem("user2", "contact")
+	_, err = s.DeleteRosterItem(context.Background(), "user2", "contact")
 	require.Nil(t, err) // delete not existing roster item...
 
-	ri2, _ := s.FetchRosterItem("user", "contact")
+	ri2, _ := s.FetchRosterItem(context.Background(), "user", "contact")
 	require.Nil(t, ri2)
 }
 
@@ -134,9 +157,9 @@ func TestMockStorageInsertRosterNotification(t *testing.T) {
 	}
 	s := New()
 	s.EnableMockedError()
-	require.Equal(t, ErrMockedError, s.InsertOrUpdateRosterNotification(&rn))
+	require.Equal(t, ErrMockedError, s.InsertOrUpdateRosterNotification(context.Background(), &rn))
 	s.DisableMockedError()
-	require.Nil(t, s.InsertOrUpdateRosterNotification(&rn))
+	require.Nil(t, s.InsertOrUpdateRosterNotification(context.Background(), &rn))
 }
 
 func TestMockStorageFetchRosterNotifications(t *testing.T) {
@@ -151,19 +174,19 @@ func TestMockStorageFetchRosterNotifications(t *testing.T) {
 		Presence: &xmpp.Presence{},
 	}
 	s := New()
-	s.InsertOrUpdateRosterNotification(&rn1)
-	s.InsertOrUpdateRosterNotification(&rn2)
+	s.InsertOrUpdateRosterNotification(context.Background(), &rn1)
+	s.InsertOrUpdateRosterNotification(context.Background(), &rn2)
 
 	from, _ := jid.NewWithString("ortuman2@jackal.im", true)
 	to, _ := jid.NewWithString("romeo@jackal.im", true)
 	rn2.Presence = xmpp.NewPresence(from, to, xmpp.SubscribeType)
-	s.InsertOrUpdateRosterNotification(&rn2)
+	s.InsertOrUpdateRosterNotification(context.Background(), &rn2)
 
 	s.EnableMockedError()
-	_, err := s.FetchRosterNotifications("romeo")
+	_, err := s.FetchRosterNotifications(context.Background(), "romeo")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	rns, err := s.FetchRosterNotifications("romeo")
+	rns, err := s.FetchRosterNotifications(context.Background(), "romeo")
 	require.Nil(t, err)
 	require.Equal(t, 2, len(rns))
 	require.Equal(t, "ortuman@jackal.im", rns[0].JID)
@@ -177,16 +200,16 @@ func TestMockStorageDeleteRosterNotification(t *testing.T) {
 		Presence: &xmpp.Presence{},
 	}
 	s := New()
-	s.InsertOrUpdateRosterNotification(&rn1)
+	s.InsertOrUpdateRosterNotification(context.Background(), &rn1)
 
 	s.EnableMockedError()
-	require.Equal(t, ErrMockedError, s.DeleteRosterNotification("ortuman", "romeo@jackal.im"))
+	require.Equal(t, ErrMockedError, s.DeleteRosterNotification(context.Background(), "ortuman", "romeo@jackal.im"))
 	s.DisableMockedError()
-	require.Nil(t, s.DeleteRosterNotification("ortuman", "romeo@jackal.im"))
+	require.Nil(t, s.DeleteRosterNotification(context.Background(), "ortuman", "romeo@jackal.im"))
 
-	rns, err := s.FetchRosterNotifications("romeo")
+	rns, err := s.FetchRosterNotifications(context.Background(), "romeo")
 	require.Nil(t, err)
 	require.Equal(t, 0, len(rns))
 	// delete not existing roster notification...
-	require.Nil(t, s.DeleteRosterNotification("ortuman2", "romeo@jackal.im"))
+	require.Nil(t, s.DeleteRosterNotification(context.Background(), "ortuman2", "romeo@jackal.im"))
 }
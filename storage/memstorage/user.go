@@ -5,29 +5,37 @@
 
 package memstorage
 
-import "github.com/ortuman/jackal/model"
+import (
+	"context"
+	"sort"
+
+	"github.com/ortuman/jackal/model"
+)
 
 // InsertOrUpdateUser inserts a new user entity into storage,
 // or updates it in case it's been previously inserted.
-func (m *Storage) InsertOrUpdateUser(user *model.User) error {
-	return m.inWriteLock(func() error {
+func (m *Storage) InsertOrUpdateUser(ctx context.Context, user *model.User) error {
+	return m.inWriteLock(ctx, func() error {
 		m.users[user.Username] = user
 		return nil
 	})
 }
 
 // DeleteUser deletes a user entity from storage.
-func (m *Storage) DeleteUser(username string) error {
-	return m.inWriteLock(func() error {
+func (m *Storage) DeleteUser(ctx context.Context, username string) error {
+	return m.inWriteLock(ctx, func() error {
 		delete(m.users, username)
+		delete(m.directoryEntries, username)
+		delete(m.vCards, username)
+		delete(m.bookmarks, username)
 		return nil
 	})
 }
 
 // FetchUser retrieves from storage a user entity.
-func (m *Storage) FetchUser(username string) (*model.User, error) {
+func (m *Storage) FetchUser(ctx context.Context, username string) (*model.User, error) {
 	var ret *model.User
-	err := m.inReadLock(func() error {
+	err := m.inReadLock(ctx, func() error {
 		ret = m.users[username]
 		return nil
 	})
@@ -35,11 +43,24 @@ func (m *Storage) FetchUser(username string) (*model.User, error) {
 }
 
 // UserExists returns whether or not a user exists within storage.
-func (m *Storage) UserExists(username string) (bool, error) {
+func (m *Storage) UserExists(ctx context.Context, username string) (bool, error) {
 	var ret bool
-	err := m.inReadLock(func() error {
+	err := m.inReadLock(ctx, func() error {
 		ret = m.users[username] != nil
 		return nil
 	})
 	return ret, err
 }
+
+// FetchUsernames retrieves from storage the username of every user entity.
+func (m *Storage) FetchUsernames(ctx context.Context) ([]string, error) {
+	var ret []string
+	err := m.inReadLock(ctx, func() error {
+		for username := range m.users {
+			ret = append(ret, username)
+		}
+		return nil
+	})
+	sort.Strings(ret)
+	return ret, err
+}
@@ -6,9 +6,11 @@
 package memstorage
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/xmpp"
 	"github.com/stretchr/testify/require"
 )
 
@@ -16,20 +18,20 @@ func TestMockStorageInsertUser(t *testing.T) {
 	u := model.User{Username: "ortuman", Password: "1234"}
 	s := New()
 	s.EnableMockedError()
-	err := s.InsertOrUpdateUser(&u)
+	err := s.InsertOrUpdateUser(context.Background(), &u)
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	err = s.InsertOrUpdateUser(&u)
+	err = s.InsertOrUpdateUser(context.Background(), &u)
 	require.Nil(t, err)
 }
 
 func TestMockStorageUserExists(t *testing.T) {
 	s := New()
 	s.EnableMockedError()
-	ok, err := s.UserExists("ortuman")
+	ok, err := s.UserExists(context.Background(), "ortuman")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	ok, err = s.UserExists("ortuman")
+	ok, err = s.UserExists(context.Background(), "ortuman")
 	require.Nil(t, err)
 	require.False(t, ok)
 }
@@ -37,28 +39,58 @@ func TestMockStorageUserExists(t *testing.T) {
 func TestMockStorageFetchUser(t *testing.T) {
 	u := model.User{Username: "ortuman", Password: "1234"}
 	s := New()
-	_ = s.InsertOrUpdateUser(&u)
+	_ = s.InsertOrUpdateUser(context.Background(), &u)
+	_ = s.InsertOrUpdateVCard(context.Background(), xmpp.NewElementNamespace("vCard", "vcard-temp"), "ortuman")
 
 	s.EnableMockedError()
-	_, err := s.FetchUser("ortuman")
+	_, err := s.FetchUser(context.Background(), "ortuman")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	usr, _ := s.FetchUser("romeo")
+	usr, _ := s.FetchUser(context.Background(), "romeo")
 	require.Nil(t, usr)
-	usr, _ = s.FetchUser("ortuman")
+	usr, _ = s.FetchUser(context.Background(), "ortuman")
 	require.NotNil(t, usr)
 }
 
 func TestMockStorageDeleteUser(t *testing.T) {
 	u := model.User{Username: "ortuman", Password: "1234"}
 	s := New()
-	_ = s.InsertOrUpdateUser(&u)
+	_ = s.InsertOrUpdateUser(context.Background(), &u)
+	_ = s.InsertOrUpdateBookmark(context.Background(), &model.Bookmark{Username: "ortuman", JID: "jdev@conference.jabber.org"})
 
 	s.EnableMockedError()
-	require.Equal(t, ErrMockedError, s.DeleteUser("ortuman"))
+	require.Equal(t, ErrMockedError, s.DeleteUser(context.Background(), "ortuman"))
 	s.DisableMockedError()
-	require.Nil(t, s.DeleteUser("ortuman"))
+	require.Nil(t, s.DeleteUser(context.Background(), "ortuman"))
 
-	usr, _ := s.FetchUser("ortuman")
+	usr, _ := s.FetchUser(context.Background(), "ortuman")
 	require.Nil(t, usr)
+	vCard, _ := s.FetchVCard(context.Background(), "ortuman")
+	require.Nil(t, vCard)
+	bookmarks, _ := s.FetchBookmarks(context.Background(), "ortuman")
+	require.Equal(t, 0, len(bookmarks))
+}
+
+func TestMockStorageFetchUsernames(t *testing.T) {
+	s := New()
+	_ = s.InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"})
+	_ = s.InsertOrUpdateUser(context.Background(), &model.User{Username: "noelia", Password: "5678"})
+
+	s.EnableMockedError()
+	_, err := s.FetchUsernames(context.Background())
+	require.Equal(t, ErrMockedError, err)
+	s.DisableMockedError()
+	usernames, _ := s.FetchUsernames(context.Background())
+	require.Equal(t, []string{"noelia", "ortuman"}, usernames)
+}
+
+func TestMockStorageCanceledContext(t *testing.T) {
+	s := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := s.InsertOrUpdateUser(ctx, &model.User{Username: "ortuman", Password: "1234"})
+	require.Equal(t, context.Canceled, err)
+	_, err = s.FetchUser(ctx, "ortuman")
+	require.Equal(t, context.Canceled, err)
 }
@@ -5,12 +5,16 @@
 
 package memstorage
 
-import "github.com/ortuman/jackal/xmpp"
+import (
+	"context"
+
+	"github.com/ortuman/jackal/xmpp"
+)
 
 // InsertOrUpdateVCard inserts a new vCard element into storage,
 // or updates it in case it's been previously inserted.
-func (m *Storage) InsertOrUpdateVCard(vCard xmpp.XElement, username string) error {
-	return m.inWriteLock(func() error {
+func (m *Storage) InsertOrUpdateVCard(ctx context.Context, vCard xmpp.XElement, username string) error {
+	return m.inWriteLock(ctx, func() error {
 		m.vCards[username] = xmpp.NewElementFromElement(vCard)
 		return nil
 	})
@@ -18,9 +22,9 @@ func (m *Storage) InsertOrUpdateVCard(vCard xmpp.XElement, username string) erro
 
 // FetchVCard retrieves from storage a vCard element associated
 // to a given user.
-func (m *Storage) FetchVCard(username string) (xmpp.XElement, error) {
+func (m *Storage) FetchVCard(ctx context.Context, username string) (xmpp.XElement, error) {
 	var ret xmpp.XElement
-	err := m.inReadLock(func() error {
+	err := m.inReadLock(ctx, func() error {
 		ret = m.vCards[username]
 		return nil
 	})
@@ -6,6 +6,7 @@
 package memstorage
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ortuman/jackal/xmpp"
@@ -20,9 +21,9 @@ func TestMockStorageInsertVCard(t *testing.T) {
 
 	s := New()
 	s.EnableMockedError()
-	require.Equal(t, ErrMockedError, s.InsertOrUpdateVCard(vCard, "ortuman"))
+	require.Equal(t, ErrMockedError, s.InsertOrUpdateVCard(context.Background(), vCard, "ortuman"))
 	s.DisableMockedError()
-	require.Nil(t, s.InsertOrUpdateVCard(vCard, "ortuman"))
+	require.Nil(t, s.InsertOrUpdateVCard(context.Background(), vCard, "ortuman"))
 }
 
 func TestMockStorageFetchVCard(t *testing.T) {
@@ -32,12 +33,12 @@ func TestMockStorageFetchVCard(t *testing.T) {
 	vCard.AppendElement(fn)
 
 	s := New()
-	s.InsertOrUpdateVCard(vCard, "ortuman")
+	s.InsertOrUpdateVCard(context.Background(), vCard, "ortuman")
 
 	s.EnableMockedError()
-	_, err := s.FetchVCard("ortuman")
+	_, err := s.FetchVCard(context.Background(), "ortuman")
 	require.Equal(t, ErrMockedError, err)
 	s.DisableMockedError()
-	elem, _ := s.FetchVCard("ortuman")
+	elem, _ := s.FetchVCard(context.Background(), "ortuman")
 	require.NotNil(t, elem)
 }
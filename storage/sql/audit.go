@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"context"
+	"encoding/json"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertAuditEvent appends a new audit event entity into storage.
+func (s *Storage) InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return err
+	}
+	q := sq.Insert("audit_events").
+		Columns("type", "username", "jid", "stream_id", "remote_addr", "details", "created_at").
+		Values(event.Type, event.Username, event.JID, event.StreamID, event.RemoteAddr, string(details), event.CreatedAt)
+	_, err = q.RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+// FetchAuditEvents retrieves from storage all audit event entities
+// associated to a given user sorted by creation date.
+func (s *Storage) FetchAuditEvents(ctx context.Context, username string) ([]model.AuditEvent, error) {
+	q := sq.Select("type", "username", "jid", "stream_id", "remote_addr", "details", "created_at").
+		From("audit_events").
+		Where(sq.Eq{"username": username}).
+		OrderBy("created_at", "id")
+
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return s.scanAuditEventEntities(rows)
+}
+
+func (s *Storage) scanAuditEventEntities(scanner rowsScanner) ([]model.AuditEvent, error) {
+	var ret []model.AuditEvent
+	for scanner.Next() {
+		var ae model.AuditEvent
+		var details string
+		if err := scanner.Scan(&ae.Type, &ae.Username, &ae.JID, &ae.StreamID, &ae.RemoteAddr, &details, &ae.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(details), &ae.Details); err != nil {
+			return nil, err
+		}
+		ret = append(ret, ae)
+	}
+	return ret, nil
+}
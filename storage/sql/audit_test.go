@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLStorageInsertAuditEvent(t *testing.T) {
+	event := &model.AuditEvent{
+		Type:       "login",
+		Username:   "ortuman",
+		JID:        "ortuman@jackal.im",
+		StreamID:   "c2s:default:1",
+		RemoteAddr: "127.0.0.1:52432",
+		Details:    map[string]string{"mechanism": "PLAIN"},
+		CreatedAt:  time.Now(),
+	}
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO audit_events (.+)").
+		WithArgs("login", "ortuman", "ortuman@jackal.im", "c2s:default:1", "127.0.0.1:52432", `{"mechanism":"PLAIN"}`, event.CreatedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := s.InsertAuditEvent(context.Background(), event)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO audit_events (.+)").WillReturnError(errMySQLStorage)
+
+	err = s.InsertAuditEvent(context.Background(), event)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchAuditEvents(t *testing.T) {
+	var auditColumns = []string{"type", "username", "jid", "stream_id", "remote_addr", "details", "created_at"}
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM audit_events (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(auditColumns).
+			AddRow("login", "ortuman", "ortuman@jackal.im", "c2s:default:1", "127.0.0.1:52432", `{"mechanism":"PLAIN"}`, time.Now()).
+			AddRow("logout", "ortuman", "ortuman@jackal.im/yard", "c2s:default:1", "127.0.0.1:52432", `null`, time.Now()))
+
+	events, err := s.FetchAuditEvents(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(events))
+	require.Equal(t, "PLAIN", events[0].Details["mechanism"])
+	require.Equal(t, "logout", events[1].Type)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM audit_events (.+)").
+		WithArgs("ortuman").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchAuditEvents(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
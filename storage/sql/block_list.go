@@ -6,6 +6,7 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
 
 	sq "github.com/Masterminds/squirrel"
@@ -14,14 +15,14 @@ import (
 
 // InsertBlockListItems inserts a set of block list item entities
 // into storage, only in case they haven't been previously inserted.
-func (s *Storage) InsertBlockListItems(items []model.BlockListItem) error {
-	return s.inTransaction(func(tx *sql.Tx) error {
+func (s *Storage) InsertBlockListItems(ctx context.Context, items []model.BlockListItem) error {
+	return s.inTransaction(ctx, func(tx *sql.Tx) error {
 		for _, item := range items {
 			_, err := sq.Insert("blocklist_items").
 				Options("IGNORE").
 				Columns("username", "jid", "created_at").
 				Values(item.Username, item.JID, nowExpr).
-				RunWith(tx).Exec()
+				RunWith(tx).ExecContext(ctx)
 			if err != nil {
 				return err
 			}
@@ -31,12 +32,12 @@ func (s *Storage) InsertBlockListItems(items []model.BlockListItem) error {
 }
 
 // DeleteBlockListItems deletes a set of block list item entities from storage.
-func (s *Storage) DeleteBlockListItems(items []model.BlockListItem) error {
-	return s.inTransaction(func(tx *sql.Tx) error {
+func (s *Storage) DeleteBlockListItems(ctx context.Context, items []model.BlockListItem) error {
+	return s.inTransaction(ctx, func(tx *sql.Tx) error {
 		for _, item := range items {
 			_, err := sq.Delete("blocklist_items").
 				Where(sq.And{sq.Eq{"username": item.Username}, sq.Eq{"jid": item.JID}}).
-				RunWith(tx).Exec()
+				RunWith(tx).ExecContext(ctx)
 			if err != nil {
 				return err
 			}
@@ -47,13 +48,30 @@ func (s *Storage) DeleteBlockListItems(items []model.BlockListItem) error {
 
 // FetchBlockListItems retrieves from storage all block list item entities
 // associated to a given user.
-func (s *Storage) FetchBlockListItems(username string) ([]model.BlockListItem, error) {
+func (s *Storage) FetchBlockListItems(ctx context.Context, username string) ([]model.BlockListItem, error) {
 	q := sq.Select("username", "jid").
 		From("blocklist_items").
 		Where(sq.Eq{"username": username}).
 		OrderBy("created_at")
 
-	rows, err := q.RunWith(s.db).Query()
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return s.scanBlockListItemEntities(rows)
+}
+
+// FetchBlockListItemsPage retrieves from storage up to limit block list item entities
+// associated to a given user, sorted by JID and starting right after afterJID.
+func (s *Storage) FetchBlockListItemsPage(ctx context.Context, username, afterJID string, limit int) ([]model.BlockListItem, error) {
+	q := sq.Select("username", "jid").
+		From("blocklist_items").
+		Where(sq.And{sq.Eq{"username": username}, sq.Gt{"jid": afterJID}}).
+		OrderBy("jid").
+		Limit(uint64(limit))
+
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
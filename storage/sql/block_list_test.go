@@ -6,6 +6,7 @@
 package sql
 
 import (
+	"context"
 	"testing"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
@@ -20,7 +21,7 @@ func TestMySQLStorageInsertBlockListItems(t *testing.T) {
 		WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
-	err := s.InsertBlockListItems([]model.BlockListItem{{Username: "ortuman", JID: "noelia@jackal.im"}})
+	err := s.InsertBlockListItems(context.Background(), []model.BlockListItem{{Username: "ortuman", JID: "noelia@jackal.im"}})
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
@@ -29,7 +30,7 @@ func TestMySQLStorageInsertBlockListItems(t *testing.T) {
 	mock.ExpectExec("INSERT IGNORE INTO blocklist_items (.+)").WillReturnError(errMySQLStorage)
 	mock.ExpectRollback()
 
-	err = s.InsertBlockListItems([]model.BlockListItem{{Username: "ortuman", JID: "noelia@jackal.im"}})
+	err = s.InsertBlockListItems(context.Background(), []model.BlockListItem{{Username: "ortuman", JID: "noelia@jackal.im"}})
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -41,7 +42,7 @@ func TestMySQLFetchBlockListItems(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows(blockListColumns).AddRow("ortuman", "noelia@jackal.im"))
 
-	_, err := s.FetchBlockListItems("ortuman")
+	_, err := s.FetchBlockListItems(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
@@ -50,7 +51,29 @@ func TestMySQLFetchBlockListItems(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnError(errMySQLStorage)
 
-	_, err = s.FetchBlockListItems("ortuman")
+	_, err = s.FetchBlockListItems(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLFetchBlockListItemsPage(t *testing.T) {
+	var blockListColumns = []string{"username", "jid"}
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM blocklist_items WHERE \\(username = \\? AND jid > \\?\\) ORDER BY jid LIMIT 10").
+		WithArgs("ortuman", "juliet@jackal.im").
+		WillReturnRows(sqlmock.NewRows(blockListColumns).AddRow("ortuman", "noelia@jackal.im"))
+
+	items, err := s.FetchBlockListItemsPage(context.Background(), "ortuman", "juliet@jackal.im", 10)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 1, len(items))
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM blocklist_items (.+)").
+		WithArgs("ortuman", "").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchBlockListItemsPage(context.Background(), "ortuman", "", 10)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -71,7 +94,7 @@ func TestMySQLStorageDeleteBlockListItems(t *testing.T) {
 	mock.ExpectCommit()
 
 	delItems := []model.BlockListItem{{Username: "ortuman", JID: "noelia@jackal.im"}}
-	err := s.DeleteBlockListItems(delItems)
+	err := s.DeleteBlockListItems(context.Background(), delItems)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
@@ -81,7 +104,7 @@ func TestMySQLStorageDeleteBlockListItems(t *testing.T) {
 		WillReturnError(errMySQLStorage)
 	mock.ExpectRollback()
 
-	err = s.DeleteBlockListItems(delItems)
+	err = s.DeleteBlockListItems(context.Background(), delItems)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"context"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateBookmark inserts a new bookmark entity into storage,
+// or updates it in case it's been previously inserted.
+func (s *Storage) InsertOrUpdateBookmark(ctx context.Context, bookmark *model.Bookmark) error {
+	q := sq.Insert("bookmarks").
+		Columns("username", "jid", "name", "autojoin", "nick", "password", "updated_at", "created_at").
+		Values(bookmark.Username, bookmark.JID, bookmark.Name, bookmark.Autojoin, bookmark.Nick, bookmark.Password, nowExpr, nowExpr).
+		Suffix("ON DUPLICATE KEY UPDATE name = ?, autojoin = ?, nick = ?, password = ?, updated_at = NOW()",
+			bookmark.Name, bookmark.Autojoin, bookmark.Nick, bookmark.Password)
+
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+// DeleteBookmark deletes a bookmark entity from storage.
+func (s *Storage) DeleteBookmark(ctx context.Context, username, jid string) error {
+	_, err := sq.Delete("bookmarks").
+		Where(sq.And{sq.Eq{"username": username}, sq.Eq{"jid": jid}}).
+		RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+// FetchBookmarks retrieves from storage all bookmark entities
+// associated to a given user sorted by JID.
+func (s *Storage) FetchBookmarks(ctx context.Context, username string) ([]model.Bookmark, error) {
+	q := sq.Select("username", "jid", "name", "autojoin", "nick", "password").
+		From("bookmarks").
+		Where(sq.Eq{"username": username}).
+		OrderBy("jid")
+
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []model.Bookmark
+	for rows.Next() {
+		var b model.Bookmark
+		if err := rows.Scan(&b.Username, &b.JID, &b.Name, &b.Autojoin, &b.Nick, &b.Password); err != nil {
+			return nil, err
+		}
+		ret = append(ret, b)
+	}
+	return ret, rows.Err()
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLStorageInsertBookmark(t *testing.T) {
+	b := &model.Bookmark{Username: "ortuman", JID: "jdev@conference.jabber.org", Name: "jdev", Autojoin: true, Nick: "ortuman"}
+
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO bookmarks (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("ortuman", "jdev@conference.jabber.org", "jdev", true, "ortuman", "", "jdev", true, "ortuman", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := s.InsertOrUpdateBookmark(context.Background(), b)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO bookmarks (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WillReturnError(errMySQLStorage)
+
+	err = s.InsertOrUpdateBookmark(context.Background(), b)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageDeleteBookmark(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectExec("DELETE FROM bookmarks (.+)").
+		WithArgs("ortuman", "jdev@conference.jabber.org").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.DeleteBookmark(context.Background(), "ortuman", "jdev@conference.jabber.org")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("DELETE FROM bookmarks (.+)").
+		WithArgs("ortuman", "jdev@conference.jabber.org").
+		WillReturnError(errMySQLStorage)
+
+	err = s.DeleteBookmark(context.Background(), "ortuman", "jdev@conference.jabber.org")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchBookmarks(t *testing.T) {
+	var bookmarkColumns = []string{"username", "jid", "name", "autojoin", "nick", "password"}
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM bookmarks (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(bookmarkColumns).
+			AddRow("ortuman", "jdev@conference.jabber.org", "jdev", true, "ortuman", "").
+			AddRow("ortuman", "xsf@muc.xmpp.org", "xsf", false, "", ""))
+
+	bookmarks, err := s.FetchBookmarks(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(bookmarks))
+	require.True(t, bookmarks[0].Autojoin)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM bookmarks (.+)").
+		WithArgs("ortuman").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchBookmarks(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// InsertOrUpdateDirectoryEntry inserts a new user directory entry into storage,
+// or updates it in case it's been previously inserted.
+func (s *Storage) InsertOrUpdateDirectoryEntry(ctx context.Context, entry *model.DirectoryEntry) error {
+	q := sq.Insert("directory_entries").
+		Columns("username", "fn", "nickname", "email", "org", "listed", "updated_at", "created_at").
+		Values(entry.Username, entry.FN, entry.Nickname, entry.Email, entry.Org, entry.Listed, nowExpr, nowExpr).
+		Suffix("ON DUPLICATE KEY UPDATE fn = ?, nickname = ?, email = ?, org = ?, listed = ?, updated_at = NOW()",
+			entry.FN, entry.Nickname, entry.Email, entry.Org, entry.Listed)
+
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+// FetchDirectoryEntry retrieves from storage the directory entry of a given user.
+func (s *Storage) FetchDirectoryEntry(ctx context.Context, username string) (*model.DirectoryEntry, error) {
+	q := sq.Select("username", "fn", "nickname", "email", "org", "listed").
+		From("directory_entries").
+		Where(sq.Eq{"username": username})
+
+	var entry model.DirectoryEntry
+	err := q.RunWith(s.db).QueryRowContext(ctx).Scan(&entry.Username, &entry.FN, &entry.Nickname, &entry.Email, &entry.Org, &entry.Listed)
+	switch err {
+	case nil:
+		return &entry, nil
+	case sql.ErrNoRows:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+// SearchDirectoryEntries retrieves from storage up to limit directory entries
+// matching a query, sorted by username and starting right after afterUsername.
+func (s *Storage) SearchDirectoryEntries(ctx context.Context, query *model.DirectoryQuery, afterUsername string, limit int) ([]model.DirectoryEntry, error) {
+	q := sq.Select("username", "fn", "nickname", "email", "org", "listed").
+		From("directory_entries").
+		OrderBy("username").
+		Limit(uint64(limit))
+
+	if len(afterUsername) > 0 {
+		q = q.Where(sq.Gt{"username": afterUsername})
+	}
+	likes := []struct{ column, value string }{
+		{"fn", query.FN}, {"nickname", query.Nickname}, {"email", query.Email}, {"org", query.Org},
+	}
+	for _, l := range likes {
+		if len(l.value) > 0 {
+			q = q.Where(l.column+" LIKE ?", "%"+likeEscaper.Replace(l.value)+"%")
+		}
+	}
+	if query.ListedOnly {
+		q = q.Where(sq.Eq{"listed": true})
+	}
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.DirectoryEntry
+	for rows.Next() {
+		var entry model.DirectoryEntry
+		if err := rows.Scan(&entry.Username, &entry.FN, &entry.Nickname, &entry.Email, &entry.Org, &entry.Listed); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
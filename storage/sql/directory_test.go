@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+var directoryEntryColumns = []string{"username", "fn", "nickname", "email", "org", "listed"}
+
+func TestMySQLStorageInsertDirectoryEntry(t *testing.T) {
+	entry := &model.DirectoryEntry{Username: "ortuman", FN: "Miguel Ángel", Nickname: "ortuman", Email: "ortuman@jackal.im", Org: "jackal", Listed: true}
+
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO directory_entries (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("ortuman", "Miguel Ángel", "ortuman", "ortuman@jackal.im", "jackal", true, "Miguel Ángel", "ortuman", "ortuman@jackal.im", "jackal", true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := s.InsertOrUpdateDirectoryEntry(context.Background(), entry)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO directory_entries (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WillReturnError(errMySQLStorage)
+
+	err = s.InsertOrUpdateDirectoryEntry(context.Background(), entry)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchDirectoryEntry(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM directory_entries (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(directoryEntryColumns).AddRow("ortuman", "Miguel Ángel", "", "", "", true))
+
+	entry, err := s.FetchDirectoryEntry(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.NotNil(t, entry)
+	require.Equal(t, "Miguel Ángel", entry.FN)
+	require.True(t, entry.Listed)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM directory_entries (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(directoryEntryColumns))
+
+	entry, err = s.FetchDirectoryEntry(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Nil(t, entry)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM directory_entries (.+)").
+		WithArgs("ortuman").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchDirectoryEntry(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageSearchDirectoryEntries(t *testing.T) {
+	query := &model.DirectoryQuery{FN: "100%", Org: "jack", ListedOnly: true}
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM directory_entries WHERE username > \\? AND fn LIKE \\? AND org LIKE \\? AND listed = \\? ORDER BY username LIMIT 2").
+		WithArgs("noelia", `%100\%%`, "%jack%", true).
+		WillReturnRows(sqlmock.NewRows(directoryEntryColumns).
+			AddRow("ortuman", "100% Miguel", "", "", "jackal", true).
+			AddRow("romeo", "100% Romeo", "", "", "jackal", true))
+
+	entries, err := s.SearchDirectoryEntries(context.Background(), query, "noelia", 2)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, "ortuman", entries[0].Username)
+	require.Equal(t, "romeo", entries[1].Username)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM directory_entries (.+)").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.SearchDirectoryEntries(context.Background(), &model.DirectoryQuery{}, "", 10)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
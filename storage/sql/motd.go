@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
+)
+
+// InsertOrUpdateMOTD inserts a new host message of the day into storage,
+// or updates it in case it's been previously inserted.
+func (s *Storage) InsertOrUpdateMOTD(ctx context.Context, motd *model.MOTD) error {
+	q := sq.Insert("motds").
+		Columns("host", "subject", "body", "updated_at", "created_at").
+		Values(motd.Host, motd.Subject, motd.Body, nowExpr, nowExpr).
+		Suffix("ON DUPLICATE KEY UPDATE subject = ?, body = ?, updated_at = NOW()", motd.Subject, motd.Body)
+
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+// FetchMOTD retrieves from storage the message of the day of a given host.
+func (s *Storage) FetchMOTD(ctx context.Context, host string) (*model.MOTD, error) {
+	q := sq.Select("host", "subject", "body", "updated_at").
+		From("motds").
+		Where(sq.Eq{"host": host})
+
+	var motd model.MOTD
+	err := q.RunWith(s.db).QueryRowContext(ctx).Scan(&motd.Host, &motd.Subject, &motd.Body, &motd.UpdatedAt)
+	switch err {
+	case nil:
+		return &motd, nil
+	case sql.ErrNoRows:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+// DeleteMOTD deletes from storage the message of the day of a given host.
+func (s *Storage) DeleteMOTD(ctx context.Context, host string) error {
+	_, err := sq.Delete("motds").Where(sq.Eq{"host": host}).RunWith(s.db).ExecContext(ctx)
+	return err
+}
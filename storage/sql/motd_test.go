@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package sql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQLStorageInsertMOTD(t *testing.T) {
+	motd := &model.MOTD{Host: "jackal.im", Subject: "Maintenance", Body: "Server will restart"}
+
+	s, mock := NewMock()
+	mock.ExpectExec("INSERT INTO motds (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("jackal.im", "Maintenance", "Server will restart", "Maintenance", "Server will restart").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := s.InsertOrUpdateMOTD(context.Background(), motd)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("INSERT INTO motds (.+) ON DUPLICATE KEY UPDATE (.+)").
+		WithArgs("jackal.im", "Maintenance", "Server will restart", "Maintenance", "Server will restart").
+		WillReturnError(errMySQLStorage)
+
+	err = s.InsertOrUpdateMOTD(context.Background(), motd)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchMOTD(t *testing.T) {
+	var motdColumns = []string{"host", "subject", "body", "updated_at"}
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM motds (.+)").
+		WithArgs("jackal.im").
+		WillReturnRows(sqlmock.NewRows(motdColumns).AddRow("jackal.im", "", "Welcome!", time.Now()))
+
+	motd, err := s.FetchMOTD(context.Background(), "jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.NotNil(t, motd)
+	require.Equal(t, "Welcome!", motd.Body)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM motds (.+)").
+		WithArgs("jackal.im").
+		WillReturnRows(sqlmock.NewRows(motdColumns))
+
+	motd, err = s.FetchMOTD(context.Background(), "jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Nil(t, motd)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM motds (.+)").
+		WithArgs("jackal.im").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchMOTD(context.Background(), "jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageDeleteMOTD(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectExec("DELETE FROM motds (.+)").
+		WithArgs("jackal.im").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.DeleteMOTD(context.Background(), "jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("DELETE FROM motds (.+)").
+		WithArgs("jackal.im").
+		WillReturnError(errMySQLStorage)
+
+	err = s.DeleteMOTD(context.Background(), "jackal.im")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
@@ -6,30 +6,34 @@
 package sql
 
 import (
+	"context"
+	"strings"
+	"time"
+
 	sq "github.com/Masterminds/squirrel"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 )
 
 // InsertOfflineMessage inserts a new message element into
 // user's offline queue.
-func (s *Storage) InsertOfflineMessage(message *xmpp.Message, username string) error {
+func (s *Storage) InsertOfflineMessage(ctx context.Context, message *model.OfflineMessage) error {
 	q := sq.Insert("offline_messages").
-		Columns("username", "data", "created_at").
-		Values(username, message.String(), nowExpr)
-	_, err := q.RunWith(s.db).Exec()
+		Columns("id", "username", "data", "created_at").
+		Values(message.ID, message.Username, message.Message.String(), message.CreatedAt)
+	_, err := q.RunWith(s.db).ExecContext(ctx)
 	return err
 }
 
 // CountOfflineMessages returns current length of user's offline queue.
-func (s *Storage) CountOfflineMessages(username string) (int, error) {
+func (s *Storage) CountOfflineMessages(ctx context.Context, username string) (int, error) {
 	q := sq.Select("COUNT(*)").
 		From("offline_messages").
-		Where(sq.Eq{"username": username}).
-		OrderBy("created_at")
+		Where(sq.Eq{"username": username})
 
 	var count int
-	err := q.RunWith(s.db).Scan(&count)
+	err := q.RunWith(s.db).ScanContext(ctx, &count)
 	switch err {
 	case nil:
 		return count, nil
@@ -38,53 +42,99 @@ func (s *Storage) CountOfflineMessages(username string) (int, error) {
 	}
 }
 
-// FetchOfflineMessages retrieves from storage current user offline queue.
-func (s *Storage) FetchOfflineMessages(username string) ([]*xmpp.Message, error) {
-	q := sq.Select("data").
+// FetchOfflineMessages retrieves from storage current user offline queue
+// sorted by creation date.
+func (s *Storage) FetchOfflineMessages(ctx context.Context, username string) ([]model.OfflineMessage, error) {
+	q := sq.Select("id", "username", "data", "created_at").
 		From("offline_messages").
 		Where(sq.Eq{"username": username}).
 		OrderBy("created_at")
 
-	rows, err := q.RunWith(s.db).Query()
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	return s.scanOfflineMessageEntities(rows)
+}
 
-	buf := s.pool.Get()
-	defer s.pool.Put(buf)
+// FetchOfflineMessagesPage retrieves from storage up to limit messages
+// of a user offline queue sorted by creation date, starting right after
+// the given message or at the head of the queue if after is nil.
+func (s *Storage) FetchOfflineMessagesPage(ctx context.Context, username string, after *model.OfflineMessage, limit int) ([]model.OfflineMessage, error) {
+	q := sq.Select("id", "username", "data", "created_at").
+		From("offline_messages").
+		Where(sq.Eq{"username": username}).
+		OrderBy("created_at", "id").
+		Limit(uint64(limit))
 
-	buf.WriteString("<r>")
-	for rows.Next() {
-		var msg string
-		rows.Scan(&msg)
-		buf.WriteString(msg)
+	if after != nil {
+		q = q.Where(sq.Or{
+			sq.Gt{"created_at": after.CreatedAt},
+			sq.And{sq.Eq{"created_at": after.CreatedAt}, sq.Gt{"id": after.ID}},
+		})
 	}
-	buf.WriteString("</r>")
-
-	parser := xmpp.NewParser(buf, xmpp.DefaultMode, 0)
-	rootEl, err := parser.ParseElement()
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	elems := rootEl.Elements().All()
+	defer rows.Close()
+	return s.scanOfflineMessageEntities(rows)
+}
+
+// DeleteOfflineMessage deletes a single message from a user offline queue.
+func (s *Storage) DeleteOfflineMessage(ctx context.Context, username, id string) error {
+	q := sq.Delete("offline_messages").Where(sq.And{sq.Eq{"username": username}, sq.Eq{"id": id}})
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+// DeleteOfflineMessages clears a user offline queue.
+func (s *Storage) DeleteOfflineMessages(ctx context.Context, username string) error {
+	q := sq.Delete("offline_messages").Where(sq.Eq{"username": username})
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+	return err
+}
+
+// DeleteOfflineMessagesOlderThan deletes every offline message
+// archived before t, returning the number of deleted messages.
+func (s *Storage) DeleteOfflineMessagesOlderThan(ctx context.Context, t time.Time) (int, error) {
+	q := sq.Delete("offline_messages").Where(sq.Lt{"created_at": t})
+	res, err := q.RunWith(s.db).ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(cnt), nil
+}
 
-	var msgs []*xmpp.Message
-	for _, el := range elems {
-		fromJID, _ := jid.NewWithString(el.From(), true)
-		toJID, _ := jid.NewWithString(el.To(), true)
-		msg, err := xmpp.NewMessageFromElement(el, fromJID, toJID)
-		if err != nil {
+func (s *Storage) scanOfflineMessageEntities(scanner rowsScanner) ([]model.OfflineMessage, error) {
+	var ret []model.OfflineMessage
+	for scanner.Next() {
+		var om model.OfflineMessage
+		if err := s.scanOfflineMessageEntity(&om, scanner); err != nil {
 			return nil, err
 		}
-		msgs = append(msgs, msg)
+		ret = append(ret, om)
 	}
-	return msgs, nil
+	return ret, nil
 }
 
-// DeleteOfflineMessages clears a user offline queue.
-func (s *Storage) DeleteOfflineMessages(username string) error {
-	q := sq.Delete("offline_messages").Where(sq.Eq{"username": username})
-	_, err := q.RunWith(s.db).Exec()
+func (s *Storage) scanOfflineMessageEntity(om *model.OfflineMessage, scanner rowScanner) error {
+	var messageXML string
+	if err := scanner.Scan(&om.ID, &om.Username, &messageXML, &om.CreatedAt); err != nil {
+		return err
+	}
+	parser := xmpp.NewParser(strings.NewReader(messageXML), xmpp.DefaultMode, 0)
+	elem, err := parser.ParseElement()
+	if err != nil {
+		return err
+	}
+	fromJID, _ := jid.NewWithString(elem.From(), true)
+	toJID, _ := jid.NewWithString(elem.To(), true)
+	om.Message, err = xmpp.NewMessageFromElement(elem, fromJID, toJID)
 	return err
 }
@@ -6,9 +6,12 @@
 package sql
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/xmpp"
 	"github.com/ortuman/jackal/xmpp/jid"
 	"github.com/pborman/uuid"
@@ -23,21 +26,23 @@ func TestMySQLStorageInsertOfflineMessages(t *testing.T) {
 	m, _ := xmpp.NewMessageFromElement(message, j, j)
 	messageXML := m.String()
 
+	om := &model.OfflineMessage{ID: uuid.New(), Username: "ortuman", Message: m, CreatedAt: time.Now()}
+
 	s, mock := NewMock()
 	mock.ExpectExec("INSERT INTO offline_messages (.+)").
-		WithArgs("ortuman", messageXML).
+		WithArgs(om.ID, "ortuman", messageXML, om.CreatedAt).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := s.InsertOfflineMessage(m, "ortuman")
+	err := s.InsertOfflineMessage(context.Background(), om)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
 	s, mock = NewMock()
 	mock.ExpectExec("INSERT INTO offline_messages (.+)").
-		WithArgs("ortuman", messageXML).
+		WithArgs(om.ID, "ortuman", messageXML, om.CreatedAt).
 		WillReturnError(errMySQLStorage)
 
-	err = s.InsertOfflineMessage(m, "ortuman")
+	err = s.InsertOfflineMessage(context.Background(), om)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.NotNil(t, err)
 }
@@ -50,7 +55,7 @@ func TestMySQLStorageCountOfflineMessages(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows(countColums).AddRow(1))
 
-	cnt, _ := s.CountOfflineMessages("ortuman")
+	cnt, _ := s.CountOfflineMessages(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, 1, cnt)
 
@@ -59,7 +64,7 @@ func TestMySQLStorageCountOfflineMessages(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows(countColums))
 
-	cnt, _ = s.CountOfflineMessages("ortuman")
+	cnt, _ = s.CountOfflineMessages(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, 0, cnt)
 
@@ -68,38 +73,42 @@ func TestMySQLStorageCountOfflineMessages(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnError(errMySQLStorage)
 
-	_, err := s.CountOfflineMessages("ortuman")
+	_, err := s.CountOfflineMessages(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
 
 func TestMySQLStorageFetchOfflineMessages(t *testing.T) {
-	var offlineMessagesColumns = []string{"data"}
+	var offlineMessagesColumns = []string{"id", "username", "data", "created_at"}
+
+	now := time.Now()
 
 	s, mock := NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM offline_messages (.+)").
 		WithArgs("ortuman").
-		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns).AddRow("<message id='abc'><body>Hi!</body></message>"))
+		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns).AddRow("1234", "ortuman", "<message id='abc'><body>Hi!</body></message>", now))
 
-	msgs, _ := s.FetchOfflineMessages("ortuman")
+	msgs, _ := s.FetchOfflineMessages(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, 1, len(msgs))
+	require.Equal(t, "1234", msgs[0].ID)
+	require.Equal(t, "abc", msgs[0].Message.ID())
 
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM offline_messages (.+)").
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns))
 
-	msgs, _ = s.FetchOfflineMessages("ortuman")
+	msgs, _ = s.FetchOfflineMessages(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, 0, len(msgs))
 
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM offline_messages (.+)").
 		WithArgs("ortuman").
-		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns).AddRow("<message id='abc'><body>Hi!"))
+		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns).AddRow("1234", "ortuman", "<message id='abc'><body>Hi!", now))
 
-	_, err := s.FetchOfflineMessages("ortuman")
+	_, err := s.FetchOfflineMessages(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.NotNil(t, err)
 
@@ -108,7 +117,60 @@ func TestMySQLStorageFetchOfflineMessages(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnError(errMySQLStorage)
 
-	_, err = s.FetchOfflineMessages("ortuman")
+	_, err = s.FetchOfflineMessages(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchOfflineMessagesPage(t *testing.T) {
+	var offlineMessagesColumns = []string{"id", "username", "data", "created_at"}
+
+	now := time.Now()
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM offline_messages WHERE username = \\? ORDER BY created_at, id LIMIT 5").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns).AddRow("1234", "ortuman", "<message id='abc'><body>Hi!</body></message>", now))
+
+	msgs, err := s.FetchOfflineMessagesPage(context.Background(), "ortuman", nil, 5)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM offline_messages WHERE username = \\? AND \\(created_at > \\? OR \\(created_at = \\? AND id > \\?\\)\\) ORDER BY created_at, id LIMIT 5").
+		WithArgs("ortuman", now, now, "1234").
+		WillReturnRows(sqlmock.NewRows(offlineMessagesColumns))
+
+	msgs, err = s.FetchOfflineMessagesPage(context.Background(), "ortuman", &msgs[0], 5)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 0, len(msgs))
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM offline_messages (.+)").
+		WithArgs("ortuman").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchOfflineMessagesPage(context.Background(), "ortuman", nil, 5)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageDeleteOfflineMessage(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectExec("DELETE FROM offline_messages (.+)").
+		WithArgs("ortuman", "1234").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := s.DeleteOfflineMessage(context.Background(), "ortuman", "1234")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+
+	s, mock = NewMock()
+	mock.ExpectExec("DELETE FROM offline_messages (.+)").
+		WithArgs("ortuman", "1234").WillReturnError(errMySQLStorage)
+
+	err = s.DeleteOfflineMessage(context.Background(), "ortuman", "1234")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -118,7 +180,7 @@ func TestMySQLStorageDeleteOfflineMessages(t *testing.T) {
 	mock.ExpectExec("DELETE FROM offline_messages (.+)").
 		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
 
-	err := s.DeleteOfflineMessages("ortuman")
+	err := s.DeleteOfflineMessages(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
@@ -126,7 +188,28 @@ func TestMySQLStorageDeleteOfflineMessages(t *testing.T) {
 	mock.ExpectExec("DELETE FROM offline_messages (.+)").
 		WithArgs("ortuman").WillReturnError(errMySQLStorage)
 
-	err = s.DeleteOfflineMessages("ortuman")
+	err = s.DeleteOfflineMessages(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageDeleteOfflineMessagesOlderThan(t *testing.T) {
+	tm := time.Now()
+
+	s, mock := NewMock()
+	mock.ExpectExec("DELETE FROM offline_messages (.+)").
+		WithArgs(tm).WillReturnResult(sqlmock.NewResult(0, 3))
+
+	cnt, err := s.DeleteOfflineMessagesOlderThan(context.Background(), tm)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 3, cnt)
+
+	s, mock = NewMock()
+	mock.ExpectExec("DELETE FROM offline_messages (.+)").
+		WithArgs(tm).WillReturnError(errMySQLStorage)
+
+	_, err = s.DeleteOfflineMessagesOlderThan(context.Background(), tm)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -6,6 +6,7 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
 
 	sq "github.com/Masterminds/squirrel"
@@ -14,7 +15,7 @@ import (
 
 // InsertOrUpdatePrivateXML inserts a new private element into storage,
 // or updates it in case it's been previously inserted.
-func (s *Storage) InsertOrUpdatePrivateXML(privateXML []xmpp.XElement, namespace string, username string) error {
+func (s *Storage) InsertOrUpdatePrivateXML(ctx context.Context, privateXML []xmpp.XElement, namespace string, username string) error {
 	buf := s.pool.Get()
 	defer s.pool.Put(buf)
 	for _, elem := range privateXML {
@@ -27,18 +28,18 @@ func (s *Storage) InsertOrUpdatePrivateXML(privateXML []xmpp.XElement, namespace
 		Values(username, namespace, rawXML, nowExpr, nowExpr).
 		Suffix("ON DUPLICATE KEY UPDATE data = ?, updated_at = NOW()", rawXML)
 
-	_, err := q.RunWith(s.db).Exec()
+	_, err := q.RunWith(s.db).ExecContext(ctx)
 	return err
 }
 
 // FetchPrivateXML retrieves from storage a private element.
-func (s *Storage) FetchPrivateXML(namespace string, username string) ([]xmpp.XElement, error) {
+func (s *Storage) FetchPrivateXML(ctx context.Context, namespace string, username string) ([]xmpp.XElement, error) {
 	q := sq.Select("data").
 		From("private_storage").
 		Where(sq.And{sq.Eq{"username": username}, sq.Eq{"namespace": namespace}})
 
 	var privateXML string
-	err := q.RunWith(s.db).QueryRow().Scan(&privateXML)
+	err := q.RunWith(s.db).QueryRowContext(ctx).Scan(&privateXML)
 	switch err {
 	case nil:
 		buf := s.pool.Get()
@@ -60,3 +61,19 @@ func (s *Storage) FetchPrivateXML(namespace string, username string) ([]xmpp.XEl
 		return nil, err
 	}
 }
+
+// FetchPrivateXMLNamespaces retrieves from storage the namespace
+// of every private element associated to a given user.
+func (s *Storage) FetchPrivateXMLNamespaces(ctx context.Context, username string) ([]string, error) {
+	q := sq.Select("namespace").
+		From("private_storage").
+		Where(sq.Eq{"username": username}).
+		OrderBy("namespace")
+
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return s.scanStrings(rows)
+}
@@ -6,6 +6,7 @@
 package sql
 
 import (
+	"context"
 	"testing"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
@@ -22,7 +23,7 @@ func TestMySQLStorageInsertPrivateXML(t *testing.T) {
 		WithArgs("ortuman", "exodus:ns", rawXML, rawXML).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := s.InsertOrUpdatePrivateXML([]xmpp.XElement{private}, "exodus:ns", "ortuman")
+	err := s.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{private}, "exodus:ns", "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
@@ -31,7 +32,7 @@ func TestMySQLStorageInsertPrivateXML(t *testing.T) {
 		WithArgs("ortuman", "exodus:ns", rawXML, rawXML).
 		WillReturnError(errMySQLStorage)
 
-	err = s.InsertOrUpdatePrivateXML([]xmpp.XElement{private}, "exodus:ns", "ortuman")
+	err = s.InsertOrUpdatePrivateXML(context.Background(), []xmpp.XElement{private}, "exodus:ns", "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -44,7 +45,7 @@ func TestMySQLStorageFetchPrivateXML(t *testing.T) {
 		WithArgs("ortuman", "exodus:ns").
 		WillReturnRows(sqlmock.NewRows(privateColumns).AddRow("<exodus xmlns='exodus:ns'><stuff/></exodus>"))
 
-	elems, err := s.FetchPrivateXML("exodus:ns", "ortuman")
+	elems, err := s.FetchPrivateXML(context.Background(), "exodus:ns", "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 	require.Equal(t, 1, len(elems))
@@ -54,7 +55,7 @@ func TestMySQLStorageFetchPrivateXML(t *testing.T) {
 		WithArgs("ortuman", "exodus:ns").
 		WillReturnRows(sqlmock.NewRows(privateColumns).AddRow("<exodus xmlns='exodus:ns'><stuff/>"))
 
-	elems, err = s.FetchPrivateXML("exodus:ns", "ortuman")
+	elems, err = s.FetchPrivateXML(context.Background(), "exodus:ns", "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.NotNil(t, err)
 	require.Equal(t, 0, len(elems))
@@ -64,7 +65,7 @@ func TestMySQLStorageFetchPrivateXML(t *testing.T) {
 		WithArgs("ortuman", "exodus:ns").
 		WillReturnRows(sqlmock.NewRows(privateColumns).AddRow(""))
 
-	elems, err = s.FetchPrivateXML("exodus:ns", "ortuman")
+	elems, err = s.FetchPrivateXML(context.Background(), "exodus:ns", "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 	require.Equal(t, 0, len(elems))
@@ -74,7 +75,7 @@ func TestMySQLStorageFetchPrivateXML(t *testing.T) {
 		WithArgs("ortuman", "exodus:ns").
 		WillReturnRows(sqlmock.NewRows(privateColumns))
 
-	elems, err = s.FetchPrivateXML("exodus:ns", "ortuman")
+	elems, err = s.FetchPrivateXML(context.Background(), "exodus:ns", "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 	require.Equal(t, 0, len(elems))
@@ -84,8 +85,29 @@ func TestMySQLStorageFetchPrivateXML(t *testing.T) {
 		WithArgs("ortuman", "exodus:ns").
 		WillReturnError(errMySQLStorage)
 
-	elems, err = s.FetchPrivateXML("exodus:ns", "ortuman")
+	elems, err = s.FetchPrivateXML(context.Background(), "exodus:ns", "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 	require.Equal(t, 0, len(elems))
 }
+
+func TestMySQLStorageFetchPrivateXMLNamespaces(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM private_storage (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows([]string{"namespace"}).AddRow("exodus:ns").AddRow("exodus:ns2"))
+
+	namespaces, err := s.FetchPrivateXMLNamespaces(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, []string{"exodus:ns", "exodus:ns2"}, namespaces)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM private_storage (.+)").
+		WithArgs("ortuman").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchPrivateXMLNamespaces(context.Background(), "ortuman")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
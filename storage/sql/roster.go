@@ -6,6 +6,7 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
 	"strings"
 
@@ -17,14 +18,14 @@ import (
 
 // InsertOrUpdateRosterItem inserts a new roster item entity into storage,
 // or updates it in case it's been previously inserted.
-func (s *Storage) InsertOrUpdateRosterItem(ri *rostermodel.Item) (rostermodel.Version, error) {
-	err := s.inTransaction(func(tx *sql.Tx) error {
+func (s *Storage) InsertOrUpdateRosterItem(ctx context.Context, ri *rostermodel.Item) (rostermodel.Version, error) {
+	err := s.inTransaction(ctx, func(tx *sql.Tx) error {
 		q := sq.Insert("roster_versions").
 			Columns("username", "created_at", "updated_at").
 			Values(ri.Username, nowExpr, nowExpr).
 			Suffix("ON DUPLICATE KEY UPDATE ver = ver + 1, updated_at = NOW()")
 
-		if _, err := q.RunWith(tx).Exec(); err != nil {
+		if _, err := q.RunWith(tx).ExecContext(ctx); err != nil {
 			return err
 		}
 		groups := strings.Join(ri.Groups, ";")
@@ -35,46 +36,46 @@ func (s *Storage) InsertOrUpdateRosterItem(ri *rostermodel.Item) (rostermodel.Ve
 			Values(ri.Username, ri.JID, ri.Name, ri.Subscription, groups, ri.Ask, verExpr, nowExpr, nowExpr).
 			Suffix("ON DUPLICATE KEY UPDATE name = ?, subscription = ?, `groups` = ?, ask = ?, ver = ver + 1, updated_at = NOW()", ri.Name, ri.Subscription, groups, ri.Ask)
 
-		_, err := q.RunWith(tx).Exec()
+		_, err := q.RunWith(tx).ExecContext(ctx)
 		return err
 	})
 	if err != nil {
 		return rostermodel.Version{}, err
 	}
-	return s.fetchRosterVer(ri.Username)
+	return s.fetchRosterVer(ctx, ri.Username)
 }
 
 // DeleteRosterItem deletes a roster item entity from storage.
-func (s *Storage) DeleteRosterItem(username, jid string) (rostermodel.Version, error) {
-	err := s.inTransaction(func(tx *sql.Tx) error {
+func (s *Storage) DeleteRosterItem(ctx context.Context, username, jid string) (rostermodel.Version, error) {
+	err := s.inTransaction(ctx, func(tx *sql.Tx) error {
 		q := sq.Insert("roster_versions").
 			Columns("username", "created_at", "updated_at").
 			Values(username, nowExpr, nowExpr).
 			Suffix("ON DUPLICATE KEY UPDATE ver = ver + 1, last_deletion_ver = ver, updated_at = NOW()")
 
-		if _, err := q.RunWith(tx).Exec(); err != nil {
+		if _, err := q.RunWith(tx).ExecContext(ctx); err != nil {
 			return err
 		}
 		_, err := sq.Delete("roster_items").
 			Where(sq.And{sq.Eq{"username": username}, sq.Eq{"jid": jid}}).
-			RunWith(tx).Exec()
+			RunWith(tx).ExecContext(ctx)
 		return err
 	})
 	if err != nil {
 		return rostermodel.Version{}, err
 	}
-	return s.fetchRosterVer(username)
+	return s.fetchRosterVer(ctx, username)
 }
 
 // FetchRosterItems retrieves from storage all roster item entities
 // associated to a given user.
-func (s *Storage) FetchRosterItems(username string) ([]rostermodel.Item, rostermodel.Version, error) {
+func (s *Storage) FetchRosterItems(ctx context.Context, username string) ([]rostermodel.Item, rostermodel.Version, error) {
 	q := sq.Select("username", "jid", "name", "subscription", "`groups`", "ask", "ver").
 		From("roster_items").
 		Where(sq.Eq{"username": username}).
 		OrderBy("created_at DESC")
 
-	rows, err := q.RunWith(s.db).Query()
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
 	if err != nil {
 		return nil, rostermodel.Version{}, err
 	}
@@ -84,7 +85,33 @@ func (s *Storage) FetchRosterItems(username string) ([]rostermodel.Item, rosterm
 	if err != nil {
 		return nil, rostermodel.Version{}, err
 	}
-	ver, err := s.fetchRosterVer(username)
+	ver, err := s.fetchRosterVer(ctx, username)
+	if err != nil {
+		return nil, rostermodel.Version{}, err
+	}
+	return items, ver, nil
+}
+
+// FetchRosterItemsPage retrieves from storage up to limit roster item entities
+// associated to a given user, sorted by contact JID and starting right after afterJID.
+func (s *Storage) FetchRosterItemsPage(ctx context.Context, username, afterJID string, limit int) ([]rostermodel.Item, rostermodel.Version, error) {
+	q := sq.Select("username", "jid", "name", "subscription", "`groups`", "ask", "ver").
+		From("roster_items").
+		Where(sq.And{sq.Eq{"username": username}, sq.Gt{"jid": afterJID}}).
+		OrderBy("jid").
+		Limit(uint64(limit))
+
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, rostermodel.Version{}, err
+	}
+	defer rows.Close()
+
+	items, err := s.scanRosterItemEntities(rows)
+	if err != nil {
+		return nil, rostermodel.Version{}, err
+	}
+	ver, err := s.fetchRosterVer(ctx, username)
 	if err != nil {
 		return nil, rostermodel.Version{}, err
 	}
@@ -92,13 +119,13 @@ func (s *Storage) FetchRosterItems(username string) ([]rostermodel.Item, rosterm
 }
 
 // FetchRosterItem retrieves from storage a roster item entity.
-func (s *Storage) FetchRosterItem(username, jid string) (*rostermodel.Item, error) {
+func (s *Storage) FetchRosterItem(ctx context.Context, username, jid string) (*rostermodel.Item, error) {
 	q := sq.Select("username", "jid", "name", "subscription", "`groups`", "ask", "ver").
 		From("roster_items").
 		Where(sq.And{sq.Eq{"username": username}, sq.Eq{"jid": jid}})
 
 	var ri rostermodel.Item
-	err := s.scanRosterItemEntity(&ri, q.RunWith(s.db).QueryRow())
+	err := s.scanRosterItemEntity(&ri, q.RunWith(s.db).QueryRowContext(ctx))
 	switch err {
 	case nil:
 		return &ri, nil
@@ -111,25 +138,25 @@ func (s *Storage) FetchRosterItem(username, jid string) (*rostermodel.Item, erro
 
 // InsertOrUpdateRosterNotification inserts a new roster notification entity
 // into storage, or updates it in case it's been previously inserted.
-func (s *Storage) InsertOrUpdateRosterNotification(rn *rostermodel.Notification) error {
+func (s *Storage) InsertOrUpdateRosterNotification(ctx context.Context, rn *rostermodel.Notification) error {
 	presenceXML := rn.Presence.String()
 	q := sq.Insert("roster_notifications").
 		Columns("contact", "jid", "elements", "updated_at", "created_at").
 		Values(rn.Contact, rn.JID, presenceXML, nowExpr, nowExpr).
 		Suffix("ON DUPLICATE KEY UPDATE elements = ?, updated_at = NOW()", presenceXML)
-	_, err := q.RunWith(s.db).Exec()
+	_, err := q.RunWith(s.db).ExecContext(ctx)
 	return err
 }
 
 // FetchRosterNotifications retrieves from storage all roster notifications
 // associated to a given user.
-func (s *Storage) FetchRosterNotifications(contact string) ([]rostermodel.Notification, error) {
+func (s *Storage) FetchRosterNotifications(ctx context.Context, contact string) ([]rostermodel.Notification, error) {
 	q := sq.Select("contact", "jid", "elements").
 		From("roster_notifications").
 		Where(sq.Eq{"contact": contact}).
 		OrderBy("created_at")
 
-	rows, err := q.RunWith(s.db).Query()
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -147,13 +174,13 @@ func (s *Storage) FetchRosterNotifications(contact string) ([]rostermodel.Notifi
 }
 
 // FetchRosterNotification retrieves from storage a roster notification entity.
-func (s *Storage) FetchRosterNotification(contact string, jid string) (*rostermodel.Notification, error) {
+func (s *Storage) FetchRosterNotification(ctx context.Context, contact string, jid string) (*rostermodel.Notification, error) {
 	q := sq.Select("contact", "jid", "elements").
 		From("roster_notifications").
 		Where(sq.And{sq.Eq{"contact": contact}, sq.Eq{"jid": jid}})
 
 	var rn rostermodel.Notification
-	err := s.scanRosterNotificationEntity(&rn, q.RunWith(s.db).QueryRow())
+	err := s.scanRosterNotificationEntity(&rn, q.RunWith(s.db).QueryRowContext(ctx))
 	switch err {
 	case nil:
 		return &rn, nil
@@ -165,19 +192,19 @@ func (s *Storage) FetchRosterNotification(contact string, jid string) (*rostermo
 }
 
 // DeleteRosterNotification deletes a roster notification entity from storage.
-func (s *Storage) DeleteRosterNotification(contact, jid string) error {
+func (s *Storage) DeleteRosterNotification(ctx context.Context, contact, jid string) error {
 	q := sq.Delete("roster_notifications").Where(sq.And{sq.Eq{"contact": contact}, sq.Eq{"jid": jid}})
-	_, err := q.RunWith(s.db).Exec()
+	_, err := q.RunWith(s.db).ExecContext(ctx)
 	return err
 }
 
-func (s *Storage) fetchRosterVer(username string) (rostermodel.Version, error) {
+func (s *Storage) fetchRosterVer(ctx context.Context, username string) (rostermodel.Version, error) {
 	q := sq.Select("IFNULL(MAX(ver), 0)", "IFNULL(MAX(last_deletion_ver), 0)").
 		From("roster_versions").
 		Where(sq.Eq{"username": username})
 
 	var ver rostermodel.Version
-	row := q.RunWith(s.db).QueryRow()
+	row := q.RunWith(s.db).QueryRowContext(ctx)
 	err := row.Scan(&ver.Ver, &ver.DeletionVer)
 	switch err {
 	case nil:
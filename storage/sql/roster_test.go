@@ -6,6 +6,7 @@
 package sql
 
 import (
+	"context"
 	"database/sql/driver"
 	"testing"
 
@@ -53,7 +54,7 @@ func TestMySQLStorageInsertRosterItem(t *testing.T) {
 		WithArgs("user").
 		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(1, 0))
 
-	_, err := s.InsertOrUpdateRosterItem(&ri)
+	_, err := s.InsertOrUpdateRosterItem(context.Background(), &ri)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 }
@@ -70,7 +71,7 @@ func TestMySQLStorageDeleteRosterItem(t *testing.T) {
 		WithArgs("user").
 		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(1, 0))
 
-	_, err := s.DeleteRosterItem("user", "contact")
+	_, err := s.DeleteRosterItem(context.Background(), "user", "contact")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
@@ -80,7 +81,7 @@ func TestMySQLStorageDeleteRosterItem(t *testing.T) {
 		WithArgs("user").WillReturnError(errMySQLStorage)
 	mock.ExpectRollback()
 
-	_, err = s.DeleteRosterItem("user", "contact")
+	_, err = s.DeleteRosterItem(context.Background(), "user", "contact")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -96,7 +97,7 @@ func TestMySQLStorageFetchRosterItems(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(0, 0))
 
-	rosterItems, _, err := s.FetchRosterItems("ortuman")
+	rosterItems, _, err := s.FetchRosterItems(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 	require.Equal(t, 1, len(rosterItems))
@@ -106,7 +107,7 @@ func TestMySQLStorageFetchRosterItems(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnError(errMySQLStorage)
 
-	_, _, err = s.FetchRosterItems("ortuman")
+	_, _, err = s.FetchRosterItems(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 
@@ -115,7 +116,7 @@ func TestMySQLStorageFetchRosterItems(t *testing.T) {
 		WithArgs("ortuman", "romeo").
 		WillReturnRows(sqlmock.NewRows(riColumns).AddRow("ortuman", "romeo", "Romeo", "both", "", false, 0))
 
-	ri, err := s.FetchRosterItem("ortuman", "romeo")
+	ri, err := s.FetchRosterItem(context.Background(), "ortuman", "romeo")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
@@ -124,7 +125,7 @@ func TestMySQLStorageFetchRosterItems(t *testing.T) {
 		WithArgs("ortuman", "romeo").
 		WillReturnRows(sqlmock.NewRows(riColumns))
 
-	ri, err = s.FetchRosterItem("ortuman", "romeo")
+	ri, err = s.FetchRosterItem(context.Background(), "ortuman", "romeo")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, ri)
 
@@ -133,7 +134,35 @@ func TestMySQLStorageFetchRosterItems(t *testing.T) {
 		WithArgs("ortuman", "romeo").
 		WillReturnError(errMySQLStorage)
 
-	_, err = s.FetchRosterItem("ortuman", "romeo")
+	_, err = s.FetchRosterItem(context.Background(), "ortuman", "romeo")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchRosterItemsPage(t *testing.T) {
+	var riColumns = []string{"user", "contact", "name", "subscription", "`groups`", "ask", "ver"}
+
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM roster_items WHERE \\(username = \\? AND jid > \\?\\) ORDER BY jid LIMIT 2").
+		WithArgs("ortuman", "juliet").
+		WillReturnRows(sqlmock.NewRows(riColumns).AddRow("ortuman", "romeo", "Romeo", "both", "", false, 0))
+	mock.ExpectQuery("SELECT (.+) FROM roster_versions (.+)").
+		WithArgs("ortuman").
+		WillReturnRows(sqlmock.NewRows([]string{"ver", "deletionVer"}).AddRow(2, 1))
+
+	rosterItems, ver, err := s.FetchRosterItemsPage(context.Background(), "ortuman", "juliet", 2)
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, 1, len(rosterItems))
+	require.Equal(t, "romeo", rosterItems[0].JID)
+	require.Equal(t, 2, ver.Ver)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT (.+) FROM roster_items (.+)").
+		WithArgs("ortuman", "").
+		WillReturnError(errMySQLStorage)
+
+	_, _, err = s.FetchRosterItemsPage(context.Background(), "ortuman", "", 2)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -157,7 +186,7 @@ func TestMySQLStorageInsertRosterNotification(t *testing.T) {
 		WithArgs(args...).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := s.InsertOrUpdateRosterNotification(&rn)
+	err := s.InsertOrUpdateRosterNotification(context.Background(), &rn)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
@@ -166,7 +195,7 @@ func TestMySQLStorageInsertRosterNotification(t *testing.T) {
 		WithArgs(args...).
 		WillReturnError(errMySQLStorage)
 
-	err = s.InsertOrUpdateRosterNotification(&rn)
+	err = s.InsertOrUpdateRosterNotification(context.Background(), &rn)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -176,7 +205,7 @@ func TestMySQLStorageDeleteRosterNotification(t *testing.T) {
 	mock.ExpectExec("DELETE FROM roster_notifications (.+)").
 		WithArgs("user", "contact").WillReturnResult(sqlmock.NewResult(0, 1))
 
-	err := s.DeleteRosterNotification("user", "contact")
+	err := s.DeleteRosterNotification(context.Background(), "user", "contact")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
@@ -184,7 +213,7 @@ func TestMySQLStorageDeleteRosterNotification(t *testing.T) {
 	mock.ExpectExec("DELETE FROM roster_notifications (.+)").
 		WithArgs("user", "contact").WillReturnError(errMySQLStorage)
 
-	err = s.DeleteRosterNotification("user", "contact")
+	err = s.DeleteRosterNotification(context.Background(), "user", "contact")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -197,7 +226,7 @@ func TestMySQLStorageFetchRosterNotifications(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows(rnColumns).AddRow("romeo", "contact", "<priority>8</priority>"))
 
-	rosterNotifications, err := s.FetchRosterNotifications("ortuman")
+	rosterNotifications, err := s.FetchRosterNotifications(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 	require.Equal(t, 1, len(rosterNotifications))
@@ -207,7 +236,7 @@ func TestMySQLStorageFetchRosterNotifications(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows(rnColumns))
 
-	rosterNotifications, err = s.FetchRosterNotifications("ortuman")
+	rosterNotifications, err = s.FetchRosterNotifications(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 	require.Equal(t, 0, len(rosterNotifications))
@@ -217,7 +246,7 @@ func TestMySQLStorageFetchRosterNotifications(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnError(errMySQLStorage)
 
-	_, err = s.FetchRosterNotifications("ortuman")
+	_, err = s.FetchRosterNotifications(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 
@@ -226,7 +255,7 @@ func TestMySQLStorageFetchRosterNotifications(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows(rnColumns).AddRow("romeo", "contact", "<priority>8"))
 
-	_, err = s.FetchRosterNotifications("ortuman")
+	_, err = s.FetchRosterNotifications(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.NotNil(t, err)
 }
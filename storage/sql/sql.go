@@ -6,6 +6,7 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -99,8 +100,8 @@ func (s *Storage) loop() {
 	}
 }
 
-func (s *Storage) inTransaction(f func(tx *sql.Tx) error) error {
-	tx, txErr := s.db.Begin()
+func (s *Storage) inTransaction(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, txErr := s.db.BeginTx(ctx, nil)
 	if txErr != nil {
 		return txErr
 	}
@@ -111,3 +112,15 @@ func (s *Storage) inTransaction(f func(tx *sql.Tx) error) error {
 	tx.Commit()
 	return nil
 }
+
+func (s *Storage) scanStrings(scanner rowsScanner) ([]string, error) {
+	var ret []string
+	for scanner.Next() {
+		var str string
+		if err := scanner.Scan(&str); err != nil {
+			return nil, err
+		}
+		ret = append(ret, str)
+	}
+	return ret, nil
+}
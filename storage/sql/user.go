@@ -6,6 +6,7 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
 	"strings"
 	"time"
@@ -18,7 +19,7 @@ import (
 
 // InsertOrUpdateUser inserts a new user entity into storage,
 // or updates it in case it's been previously inserted.
-func (s *Storage) InsertOrUpdateUser(u *model.User) error {
+func (s *Storage) InsertOrUpdateUser(ctx context.Context, u *model.User) error {
 	var presenceXML string
 	if u.LastPresence != nil {
 		buf := s.pool.Get()
@@ -26,8 +27,8 @@ func (s *Storage) InsertOrUpdateUser(u *model.User) error {
 		presenceXML = buf.String()
 		s.pool.Put(buf)
 	}
-	columns := []string{"username", "password", "updated_at", "created_at"}
-	values := []interface{}{u.Username, u.Password, nowExpr, nowExpr}
+	columns := []string{"username", "password", "disabled", "updated_at", "created_at"}
+	values := []interface{}{u.Username, u.Password, u.Disabled, nowExpr, nowExpr}
 
 	if len(presenceXML) > 0 {
 		columns = append(columns, []string{"last_presence", "last_presence_at"}...)
@@ -36,23 +37,23 @@ func (s *Storage) InsertOrUpdateUser(u *model.User) error {
 	var suffix string
 	var suffixArgs []interface{}
 	if len(presenceXML) > 0 {
-		suffix = "ON DUPLICATE KEY UPDATE password = ?, last_presence = ?, last_presence_at = NOW(), updated_at = NOW()"
-		suffixArgs = []interface{}{u.Password, presenceXML}
+		suffix = "ON DUPLICATE KEY UPDATE password = ?, disabled = ?, last_presence = ?, last_presence_at = NOW(), updated_at = NOW()"
+		suffixArgs = []interface{}{u.Password, u.Disabled, presenceXML}
 	} else {
-		suffix = "ON DUPLICATE KEY UPDATE password = ?, updated_at = NOW()"
-		suffixArgs = []interface{}{u.Password}
+		suffix = "ON DUPLICATE KEY UPDATE password = ?, disabled = ?, updated_at = NOW()"
+		suffixArgs = []interface{}{u.Password, u.Disabled}
 	}
 	q := sq.Insert("users").
 		Columns(columns...).
 		Values(values...).
 		Suffix(suffix, suffixArgs...)
-	_, err := q.RunWith(s.db).Exec()
+	_, err := q.RunWith(s.db).ExecContext(ctx)
 	return err
 }
 
 // FetchUser retrieves from storage a user entity.
-func (s *Storage) FetchUser(username string) (*model.User, error) {
-	q := sq.Select("username", "password", "last_presence", "last_presence_at").
+func (s *Storage) FetchUser(ctx context.Context, username string) (*model.User, error) {
+	q := sq.Select("username", "password", "last_presence", "last_presence_at", "disabled").
 		From("users").
 		Where(sq.Eq{"username": username})
 
@@ -60,7 +61,7 @@ func (s *Storage) FetchUser(username string) (*model.User, error) {
 	var presenceAt time.Time
 	var usr model.User
 
-	err := q.RunWith(s.db).QueryRow().Scan(&usr.Username, &usr.Password, &presenceXML, &presenceAt)
+	err := q.RunWith(s.db).QueryRowContext(ctx).Scan(&usr.Username, &usr.Password, &presenceXML, &presenceAt, &usr.Disabled)
 	switch err {
 	case nil:
 		if len(presenceXML) > 0 {
@@ -82,31 +83,53 @@ func (s *Storage) FetchUser(username string) (*model.User, error) {
 	}
 }
 
+// FetchUsernames retrieves from storage the username of every user entity.
+func (s *Storage) FetchUsernames(ctx context.Context) ([]string, error) {
+	q := sq.Select("username").
+		From("users").
+		OrderBy("username")
+
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return s.scanStrings(rows)
+}
+
 // DeleteUser deletes a user entity from storage.
-func (s *Storage) DeleteUser(username string) error {
-	return s.inTransaction(func(tx *sql.Tx) error {
+func (s *Storage) DeleteUser(ctx context.Context, username string) error {
+	return s.inTransaction(ctx, func(tx *sql.Tx) error {
 		var err error
-		_, err = sq.Delete("offline_messages").Where(sq.Eq{"username": username}).RunWith(tx).Exec()
+		_, err = sq.Delete("offline_messages").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = sq.Delete("roster_items").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = sq.Delete("roster_versions").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("roster_items").Where(sq.Eq{"username": username}).RunWith(tx).Exec()
+		_, err = sq.Delete("private_storage").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("roster_versions").Where(sq.Eq{"username": username}).RunWith(tx).Exec()
+		_, err = sq.Delete("vcards").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("private_storage").Where(sq.Eq{"username": username}).RunWith(tx).Exec()
+		_, err = sq.Delete("bookmarks").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("vcards").Where(sq.Eq{"username": username}).RunWith(tx).Exec()
+		_, err = sq.Delete("directory_entries").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
-		_, err = sq.Delete("users").Where(sq.Eq{"username": username}).RunWith(tx).Exec()
+		_, err = sq.Delete("users").Where(sq.Eq{"username": username}).RunWith(tx).ExecContext(ctx)
 		if err != nil {
 			return err
 		}
@@ -115,10 +138,10 @@ func (s *Storage) DeleteUser(username string) error {
 }
 
 // UserExists returns whether or not a user exists within storage.
-func (s *Storage) UserExists(username string) (bool, error) {
+func (s *Storage) UserExists(ctx context.Context, username string) (bool, error) {
 	q := sq.Select("COUNT(*)").From("users").Where(sq.Eq{"username": username})
 	var count int
-	err := q.RunWith(s.db).QueryRow().Scan(&count)
+	err := q.RunWith(s.db).QueryRowContext(ctx).Scan(&count)
 	switch err {
 	case nil:
 		return count > 0, nil
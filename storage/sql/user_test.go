@@ -6,6 +6,7 @@
 package sql
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -25,18 +26,18 @@ func TestMySQLStorageInsertUser(t *testing.T) {
 
 	s, mock := NewMock()
 	mock.ExpectExec("INSERT INTO users (.+) ON DUPLICATE KEY UPDATE (.+)").
-		WithArgs("ortuman", "1234", p.String(), "1234", p.String()).
+		WithArgs("ortuman", "1234", false, p.String(), "1234", false, p.String()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := s.InsertOrUpdateUser(&user)
+	err := s.InsertOrUpdateUser(context.Background(), &user)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
 	s, mock = NewMock()
 	mock.ExpectExec("INSERT INTO users (.+) ON DUPLICATE KEY UPDATE (.+)").
-		WithArgs("ortuman", "1234", p.String(), "1234", p.String()).
+		WithArgs("ortuman", "1234", false, p.String(), "1234", false, p.String()).
 		WillReturnError(errMySQLStorage)
-	err = s.InsertOrUpdateUser(&user)
+	err = s.InsertOrUpdateUser(context.Background(), &user)
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -54,11 +55,15 @@ func TestMySQLStorageDeleteUser(t *testing.T) {
 		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec("DELETE FROM vcards (.+)").
 		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM bookmarks (.+)").
+		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM directory_entries (.+)").
+		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec("DELETE FROM users (.+)").
 		WithArgs("ortuman").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
-	err := s.DeleteUser("ortuman")
+	err := s.DeleteUser(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 
@@ -68,7 +73,7 @@ func TestMySQLStorageDeleteUser(t *testing.T) {
 		WithArgs("ortuman").WillReturnError(errMySQLStorage)
 	mock.ExpectRollback()
 
-	err = s.DeleteUser("ortuman")
+	err = s.DeleteUser(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -78,29 +83,30 @@ func TestMySQLStorageFetchUser(t *testing.T) {
 	to, _ := jid.NewWithString("ortuman@jackal.im", true)
 	p := xmpp.NewPresence(from, to, xmpp.UnavailableType)
 
-	var userColumns = []string{"username", "password", "last_presence", "last_presence_at"}
+	var userColumns = []string{"username", "password", "last_presence", "last_presence_at", "disabled"}
 
 	s, mock := NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM users (.+)").
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows(userColumns))
 
-	usr, err := s.FetchUser("ortuman")
+	usr, err := s.FetchUser(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, usr)
 
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM users (.+)").
 		WithArgs("ortuman").
-		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("ortuman", "1234", p.String(), time.Now()))
-	_, err = s.FetchUser("ortuman")
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow("ortuman", "1234", p.String(), time.Now(), true))
+	usr, err = s.FetchUser(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
+	require.True(t, usr.Disabled)
 
 	s, mock = NewMock()
 	mock.ExpectQuery("SELECT (.+) FROM users (.+)").
 		WithArgs("ortuman").WillReturnError(errMySQLStorage)
-	_, err = s.FetchUser("ortuman")
+	_, err = s.FetchUser(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
@@ -113,7 +119,7 @@ func TestMySQLStorageUserExists(t *testing.T) {
 		WithArgs("ortuman").
 		WillReturnRows(sqlmock.NewRows(countColums).AddRow(1))
 
-	ok, err := s.UserExists("ortuman")
+	ok, err := s.UserExists(context.Background(), "ortuman")
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Nil(t, err)
 	require.True(t, ok)
@@ -122,7 +128,26 @@ func TestMySQLStorageUserExists(t *testing.T) {
 	mock.ExpectQuery("SELECT COUNT(.+) FROM users (.+)").
 		WithArgs("romeo").
 		WillReturnError(errMySQLStorage)
-	_, err = s.UserExists("romeo")
+	_, err = s.UserExists(context.Background(), "romeo")
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Equal(t, errMySQLStorage, err)
+}
+
+func TestMySQLStorageFetchUsernames(t *testing.T) {
+	s, mock := NewMock()
+	mock.ExpectQuery("SELECT username FROM users ORDER BY username").
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("noelia").AddRow("ortuman"))
+
+	usernames, err := s.FetchUsernames(context.Background())
+	require.Nil(t, mock.ExpectationsWereMet())
+	require.Nil(t, err)
+	require.Equal(t, []string{"noelia", "ortuman"}, usernames)
+
+	s, mock = NewMock()
+	mock.ExpectQuery("SELECT username FROM users ORDER BY username").
+		WillReturnError(errMySQLStorage)
+
+	_, err = s.FetchUsernames(context.Background())
 	require.Nil(t, mock.ExpectationsWereMet())
 	require.Equal(t, errMySQLStorage, err)
 }
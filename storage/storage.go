@@ -6,9 +6,12 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/ortuman/jackal/model"
 	"github.com/ortuman/jackal/model/rostermodel"
@@ -19,170 +22,417 @@ import (
 )
 
 type userStorage interface {
-	InsertOrUpdateUser(user *model.User) error
-	DeleteUser(username string) error
-	FetchUser(username string) (*model.User, error)
-	UserExists(username string) (bool, error)
+	InsertOrUpdateUser(ctx context.Context, user *model.User) error
+	DeleteUser(ctx context.Context, username string) error
+	FetchUser(ctx context.Context, username string) (*model.User, error)
+	UserExists(ctx context.Context, username string) (bool, error)
+	FetchUsernames(ctx context.Context) ([]string, error)
 }
 
 // InsertOrUpdateUser inserts a new user entity into storage,
 // or updates it in case it's been previously inserted.
-func InsertOrUpdateUser(user *model.User) error {
-	return instance().InsertOrUpdateUser(user)
+func InsertOrUpdateUser(ctx context.Context, user *model.User) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().InsertOrUpdateUser(ctx, user)
 }
 
 // DeleteUser deletes a user entity from storage.
-func DeleteUser(username string) error {
-	return instance().DeleteUser(username)
+func DeleteUser(ctx context.Context, username string) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().DeleteUser(ctx, username)
 }
 
 // FetchUser retrieves from storage a user entity.
-func FetchUser(username string) (*model.User, error) {
-	return instance().FetchUser(username)
+func FetchUser(ctx context.Context, username string) (*model.User, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchUser(ctx, username)
 }
 
 // UserExists returns whether or not a user exists within storage.
-func UserExists(username string) (bool, error) {
-	return instance().UserExists(username)
+func UserExists(ctx context.Context, username string) (bool, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().UserExists(ctx, username)
+}
+
+// FetchUsernames retrieves from storage the username of every user entity.
+func FetchUsernames(ctx context.Context) ([]string, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchUsernames(ctx)
 }
 
 type rosterStorage interface {
-	InsertOrUpdateRosterItem(ri *rostermodel.Item) (rostermodel.Version, error)
-	DeleteRosterItem(username, jid string) (rostermodel.Version, error)
-	FetchRosterItems(username string) ([]rostermodel.Item, rostermodel.Version, error)
-	FetchRosterItem(username, jid string) (*rostermodel.Item, error)
-	InsertOrUpdateRosterNotification(rn *rostermodel.Notification) error
-	DeleteRosterNotification(contact, jid string) error
-	FetchRosterNotification(contact string, jid string) (*rostermodel.Notification, error)
-	FetchRosterNotifications(contact string) ([]rostermodel.Notification, error)
+	InsertOrUpdateRosterItem(ctx context.Context, ri *rostermodel.Item) (rostermodel.Version, error)
+	DeleteRosterItem(ctx context.Context, username, jid string) (rostermodel.Version, error)
+	FetchRosterItems(ctx context.Context, username string) ([]rostermodel.Item, rostermodel.Version, error)
+	FetchRosterItemsPage(ctx context.Context, username, afterJID string, limit int) ([]rostermodel.Item, rostermodel.Version, error)
+	FetchRosterItem(ctx context.Context, username, jid string) (*rostermodel.Item, error)
+	InsertOrUpdateRosterNotification(ctx context.Context, rn *rostermodel.Notification) error
+	DeleteRosterNotification(ctx context.Context, contact, jid string) error
+	FetchRosterNotification(ctx context.Context, contact string, jid string) (*rostermodel.Notification, error)
+	FetchRosterNotifications(ctx context.Context, contact string) ([]rostermodel.Notification, error)
 }
 
 // InsertOrUpdateRosterItem inserts a new roster item entity into storage,
 // or updates it in case it's been previously inserted.
-func InsertOrUpdateRosterItem(ri *rostermodel.Item) (rostermodel.Version, error) {
-	return instance().InsertOrUpdateRosterItem(ri)
+func InsertOrUpdateRosterItem(ctx context.Context, ri *rostermodel.Item) (rostermodel.Version, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().InsertOrUpdateRosterItem(ctx, ri)
 }
 
 // DeleteRosterItem deletes a roster item entity from storage.
-func DeleteRosterItem(username, jid string) (rostermodel.Version, error) {
-	return instance().DeleteRosterItem(username, jid)
+func DeleteRosterItem(ctx context.Context, username, jid string) (rostermodel.Version, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().DeleteRosterItem(ctx, username, jid)
 }
 
 // FetchRosterItems retrieves from storage all roster item entities
 // associated to a given user.
-func FetchRosterItems(username string) ([]rostermodel.Item, rostermodel.Version, error) {
-	return instance().FetchRosterItems(username)
+func FetchRosterItems(ctx context.Context, username string) ([]rostermodel.Item, rostermodel.Version, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchRosterItems(ctx, username)
+}
+
+// FetchRosterItemsPage retrieves from storage up to limit roster item entities
+// associated to a given user, sorted by contact JID and starting right after afterJID.
+func FetchRosterItemsPage(ctx context.Context, username, afterJID string, limit int) ([]rostermodel.Item, rostermodel.Version, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchRosterItemsPage(ctx, username, afterJID, limit)
 }
 
 // FetchRosterItem retrieves from storage a roster item entity.
-func FetchRosterItem(username, jid string) (*rostermodel.Item, error) {
-	return instance().FetchRosterItem(username, jid)
+func FetchRosterItem(ctx context.Context, username, jid string) (*rostermodel.Item, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchRosterItem(ctx, username, jid)
 }
 
 // InsertOrUpdateRosterNotification inserts a new roster notification entity
 // into storage, or updates it in case it's been previously inserted.
-func InsertOrUpdateRosterNotification(rn *rostermodel.Notification) error {
-	return instance().InsertOrUpdateRosterNotification(rn)
+func InsertOrUpdateRosterNotification(ctx context.Context, rn *rostermodel.Notification) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().InsertOrUpdateRosterNotification(ctx, rn)
 }
 
 // DeleteRosterNotification deletes a roster notification entity from storage.
-func DeleteRosterNotification(contact, jid string) error {
-	return instance().DeleteRosterNotification(contact, jid)
+func DeleteRosterNotification(ctx context.Context, contact, jid string) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().DeleteRosterNotification(ctx, contact, jid)
 }
 
 // FetchRosterNotification retrieves from storage a roster notification entity.
-func FetchRosterNotification(contact string, jid string) (*rostermodel.Notification, error) {
-	return instance().FetchRosterNotification(contact, jid)
+func FetchRosterNotification(ctx context.Context, contact string, jid string) (*rostermodel.Notification, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchRosterNotification(ctx, contact, jid)
 }
 
 // FetchRosterNotifications retrieves from storage all roster notifications
 // associated to a given user.
-func FetchRosterNotifications(contact string) ([]rostermodel.Notification, error) {
-	return instance().FetchRosterNotifications(contact)
+func FetchRosterNotifications(ctx context.Context, contact string) ([]rostermodel.Notification, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchRosterNotifications(ctx, contact)
 }
 
 type offlineStorage interface {
-	InsertOfflineMessage(message *xmpp.Message, username string) error
-	CountOfflineMessages(username string) (int, error)
-	FetchOfflineMessages(username string) ([]*xmpp.Message, error)
-	DeleteOfflineMessages(username string) error
+	InsertOfflineMessage(ctx context.Context, message *model.OfflineMessage) error
+	CountOfflineMessages(ctx context.Context, username string) (int, error)
+	FetchOfflineMessages(ctx context.Context, username string) ([]model.OfflineMessage, error)
+	FetchOfflineMessagesPage(ctx context.Context, username string, after *model.OfflineMessage, limit int) ([]model.OfflineMessage, error)
+	DeleteOfflineMessage(ctx context.Context, username, id string) error
+	DeleteOfflineMessages(ctx context.Context, username string) error
+	DeleteOfflineMessagesOlderThan(ctx context.Context, t time.Time) (int, error)
 }
 
 // InsertOfflineMessage inserts a new message element into
 // user's offline queue.
-func InsertOfflineMessage(message *xmpp.Message, username string) error {
-	return instance().InsertOfflineMessage(message, username)
+func InsertOfflineMessage(ctx context.Context, message *model.OfflineMessage) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().InsertOfflineMessage(ctx, message)
 }
 
 // CountOfflineMessages returns current length of user's offline queue.
-func CountOfflineMessages(username string) (int, error) {
-	return instance().CountOfflineMessages(username)
+func CountOfflineMessages(ctx context.Context, username string) (int, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().CountOfflineMessages(ctx, username)
+}
+
+// FetchOfflineMessages retrieves from storage current user offline queue
+// sorted by creation date.
+func FetchOfflineMessages(ctx context.Context, username string) ([]model.OfflineMessage, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchOfflineMessages(ctx, username)
+}
+
+// FetchOfflineMessagesPage retrieves from storage up to limit messages
+// of a user offline queue sorted by creation date, starting right after
+// the given message or at the head of the queue if after is nil.
+func FetchOfflineMessagesPage(ctx context.Context, username string, after *model.OfflineMessage, limit int) ([]model.OfflineMessage, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchOfflineMessagesPage(ctx, username, after, limit)
 }
 
-// FetchOfflineMessages retrieves from storage current user offline queue.
-func FetchOfflineMessages(username string) ([]*xmpp.Message, error) {
-	return instance().FetchOfflineMessages(username)
+// DeleteOfflineMessage deletes a single message from a user offline queue.
+func DeleteOfflineMessage(ctx context.Context, username, id string) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().DeleteOfflineMessage(ctx, username, id)
 }
 
 // DeleteOfflineMessages clears a user offline queue.
-func DeleteOfflineMessages(username string) error {
-	return instance().DeleteOfflineMessages(username)
+func DeleteOfflineMessages(ctx context.Context, username string) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().DeleteOfflineMessages(ctx, username)
+}
+
+// DeleteOfflineMessagesOlderThan deletes every offline message
+// archived before t, returning the number of deleted messages.
+func DeleteOfflineMessagesOlderThan(ctx context.Context, t time.Time) (int, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().DeleteOfflineMessagesOlderThan(ctx, t)
 }
 
 type vCardStorage interface {
-	InsertOrUpdateVCard(vCard xmpp.XElement, username string) error
-	FetchVCard(username string) (xmpp.XElement, error)
+	InsertOrUpdateVCard(ctx context.Context, vCard xmpp.XElement, username string) error
+	FetchVCard(ctx context.Context, username string) (xmpp.XElement, error)
 }
 
 // InsertOrUpdateVCard inserts a new vCard element into storage,
 // or updates it in case it's been previously inserted.
-func InsertOrUpdateVCard(vCard xmpp.XElement, username string) error {
-	return instance().InsertOrUpdateVCard(vCard, username)
+func InsertOrUpdateVCard(ctx context.Context, vCard xmpp.XElement, username string) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().InsertOrUpdateVCard(ctx, vCard, username)
 }
 
 // FetchVCard retrieves from storage a vCard element associated
 // to a given user.
-func FetchVCard(username string) (xmpp.XElement, error) {
-	return instance().FetchVCard(username)
+func FetchVCard(ctx context.Context, username string) (xmpp.XElement, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchVCard(ctx, username)
 }
 
 type privateStorage interface {
-	FetchPrivateXML(namespace string, username string) ([]xmpp.XElement, error)
-	InsertOrUpdatePrivateXML(privateXML []xmpp.XElement, namespace string, username string) error
+	FetchPrivateXML(ctx context.Context, namespace string, username string) ([]xmpp.XElement, error)
+	InsertOrUpdatePrivateXML(ctx context.Context, privateXML []xmpp.XElement, namespace string, username string) error
+	FetchPrivateXMLNamespaces(ctx context.Context, username string) ([]string, error)
 }
 
 // FetchPrivateXML retrieves from storage a private element.
-func FetchPrivateXML(namespace string, username string) ([]xmpp.XElement, error) {
-	return instance().FetchPrivateXML(namespace, username)
+func FetchPrivateXML(ctx context.Context, namespace string, username string) ([]xmpp.XElement, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchPrivateXML(ctx, namespace, username)
 }
 
 // InsertOrUpdatePrivateXML inserts a new private element into storage,
 // or updates it in case it's been previously inserted.
-func InsertOrUpdatePrivateXML(privateXML []xmpp.XElement, namespace string, username string) error {
-	return instance().InsertOrUpdatePrivateXML(privateXML, namespace, username)
+func InsertOrUpdatePrivateXML(ctx context.Context, privateXML []xmpp.XElement, namespace string, username string) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().InsertOrUpdatePrivateXML(ctx, privateXML, namespace, username)
+}
+
+// FetchPrivateXMLNamespaces retrieves from storage the namespace
+// of every private element associated to a given user.
+func FetchPrivateXMLNamespaces(ctx context.Context, username string) ([]string, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchPrivateXMLNamespaces(ctx, username)
 }
 
 type blockListStorage interface {
-	InsertBlockListItems(items []model.BlockListItem) error
-	DeleteBlockListItems(items []model.BlockListItem) error
-	FetchBlockListItems(username string) ([]model.BlockListItem, error)
+	InsertBlockListItems(ctx context.Context, items []model.BlockListItem) error
+	DeleteBlockListItems(ctx context.Context, items []model.BlockListItem) error
+	FetchBlockListItems(ctx context.Context, username string) ([]model.BlockListItem, error)
+	FetchBlockListItemsPage(ctx context.Context, username, afterJID string, limit int) ([]model.BlockListItem, error)
 }
 
 // InsertBlockListItems inserts a set of block list item entities
 // into storage, only in case they haven't been previously inserted.
-func InsertBlockListItems(items []model.BlockListItem) error {
-	return instance().InsertBlockListItems(items)
+func InsertBlockListItems(ctx context.Context, items []model.BlockListItem) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().InsertBlockListItems(ctx, items)
 }
 
 // DeleteBlockListItems deletes a set of block list item entities from storage.
-func DeleteBlockListItems(items []model.BlockListItem) error {
-	return instance().DeleteBlockListItems(items)
+func DeleteBlockListItems(ctx context.Context, items []model.BlockListItem) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().DeleteBlockListItems(ctx, items)
 }
 
 // FetchBlockListItems retrieves from storage all block list item entities
 // associated to a given user.
-func FetchBlockListItems(username string) ([]model.BlockListItem, error) {
-	return instance().FetchBlockListItems(username)
+func FetchBlockListItems(ctx context.Context, username string) ([]model.BlockListItem, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchBlockListItems(ctx, username)
+}
+
+// FetchBlockListItemsPage retrieves from storage up to limit block list item entities
+// associated to a given user, sorted by JID and starting right after afterJID.
+func FetchBlockListItemsPage(ctx context.Context, username, afterJID string, limit int) ([]model.BlockListItem, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchBlockListItemsPage(ctx, username, afterJID, limit)
+}
+
+type auditStorage interface {
+	InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error
+	FetchAuditEvents(ctx context.Context, username string) ([]model.AuditEvent, error)
+}
+
+// InsertAuditEvent appends a new audit event entity into storage.
+func InsertAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().InsertAuditEvent(ctx, event)
+}
+
+// FetchAuditEvents retrieves from storage all audit event entities
+// associated to a given user sorted by creation date.
+func FetchAuditEvents(ctx context.Context, username string) ([]model.AuditEvent, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchAuditEvents(ctx, username)
+}
+
+type motdStorage interface {
+	InsertOrUpdateMOTD(ctx context.Context, motd *model.MOTD) error
+	FetchMOTD(ctx context.Context, host string) (*model.MOTD, error)
+	DeleteMOTD(ctx context.Context, host string) error
+}
+
+// InsertOrUpdateMOTD inserts a new host message of the day into storage,
+// or updates it in case it's been previously inserted.
+func InsertOrUpdateMOTD(ctx context.Context, motd *model.MOTD) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().InsertOrUpdateMOTD(ctx, motd)
+}
+
+// FetchMOTD retrieves from storage the message of the day of a given host.
+func FetchMOTD(ctx context.Context, host string) (*model.MOTD, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchMOTD(ctx, host)
+}
+
+// DeleteMOTD deletes from storage the message of the day of a given host.
+func DeleteMOTD(ctx context.Context, host string) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().DeleteMOTD(ctx, host)
+}
+
+type directoryStorage interface {
+	InsertOrUpdateDirectoryEntry(ctx context.Context, entry *model.DirectoryEntry) error
+	FetchDirectoryEntry(ctx context.Context, username string) (*model.DirectoryEntry, error)
+	SearchDirectoryEntries(ctx context.Context, query *model.DirectoryQuery, afterUsername string, limit int) ([]model.DirectoryEntry, error)
+}
+
+// InsertOrUpdateDirectoryEntry inserts a new user directory entry into storage,
+// or updates it in case it's been previously inserted.
+func InsertOrUpdateDirectoryEntry(ctx context.Context, entry *model.DirectoryEntry) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().InsertOrUpdateDirectoryEntry(ctx, entry)
+}
+
+// FetchDirectoryEntry retrieves from storage the directory entry of a given user.
+func FetchDirectoryEntry(ctx context.Context, username string) (*model.DirectoryEntry, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchDirectoryEntry(ctx, username)
+}
+
+// SearchDirectoryEntries retrieves from storage up to limit directory entries
+// matching a query, sorted by username and starting right after afterUsername.
+func SearchDirectoryEntries(ctx context.Context, query *model.DirectoryQuery, afterUsername string, limit int) ([]model.DirectoryEntry, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().SearchDirectoryEntries(ctx, query, afterUsername, limit)
+}
+
+type bookmarkStorage interface {
+	InsertOrUpdateBookmark(ctx context.Context, bookmark *model.Bookmark) error
+	DeleteBookmark(ctx context.Context, username, jid string) error
+	FetchBookmarks(ctx context.Context, username string) ([]model.Bookmark, error)
+}
+
+// InsertOrUpdateBookmark inserts a new bookmark entity into storage,
+// or updates it in case it's been previously inserted.
+func InsertOrUpdateBookmark(ctx context.Context, bookmark *model.Bookmark) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().InsertOrUpdateBookmark(ctx, bookmark)
+}
+
+// DeleteBookmark deletes a bookmark entity from storage.
+func DeleteBookmark(ctx context.Context, username, jid string) error {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().DeleteBookmark(ctx, username, jid)
+}
+
+// FetchBookmarks retrieves from storage all bookmark entities
+// associated to a given user sorted by JID.
+func FetchBookmarks(ctx context.Context, username string) ([]model.Bookmark, error) {
+	ctx, cancel := withCallTimeout(ctx)
+	defer cancel()
+	return instance().FetchBookmarks(ctx, username)
+}
+
+// ErrBackupNotSupported will be returned by Backup in case
+// the active storage doesn't support online backups.
+var ErrBackupNotSupported = errors.New("storage: backup not supported")
+
+type backupStorage interface {
+	Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error)
+}
+
+// Backup writes an online backup of every entity modified after version since,
+// returning the version it has been taken at. A zero since value produces a full backup.
+func Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error) {
+	bs, ok := instance().(backupStorage)
+	if !ok {
+		return 0, ErrBackupNotSupported
+	}
+	return bs.Backup(ctx, w, since)
+}
+
+type cacheStatsStorage interface {
+	CacheStats() map[string]CacheStats
+}
+
+// FetchCacheStats returns usage statistics of every cached entity type,
+// or nil in case storage caching is not enabled.
+func FetchCacheStats() map[string]CacheStats {
+	cs, ok := instance().(cacheStatsStorage)
+	if !ok {
+		return nil
+	}
+	return cs.CacheStats()
 }
 
 // Storage represents an entity storage interface.
@@ -195,23 +445,33 @@ type Storage interface {
 	vCardStorage
 	privateStorage
 	blockListStorage
+	auditStorage
+	motdStorage
+	directoryStorage
+	bookmarkStorage
 }
 
 var (
-	instMu sync.RWMutex
-	inst   Storage
+	instMu      sync.RWMutex
+	inst        Storage
+	instCtx     context.Context
+	instCancel  context.CancelFunc
+	callTimeout time.Duration
 )
 
 var Disabled Storage = &disabledStorage{}
 
 func init() {
 	inst = Disabled
+	instCtx, instCancel = context.WithCancel(context.Background())
 }
 
 func Set(storage Storage) {
 	instMu.Lock()
+	instCancel()
 	inst.Close()
 	inst = storage
+	instCtx, instCancel = context.WithCancel(context.Background())
 	instMu.Unlock()
 }
 
@@ -219,6 +479,44 @@ func Unset() {
 	Set(Disabled)
 }
 
+// SetCallTimeout sets the maximum amount of time a storage operation
+// is allowed to take. A zero value means operations never time out.
+func SetCallTimeout(timeout time.Duration) {
+	instMu.Lock()
+	callTimeout = timeout
+	instMu.Unlock()
+}
+
+// CancelCalls aborts every in-flight storage operation.
+// Operations issued afterwards fail right away until a new storage is set.
+func CancelCalls() {
+	instMu.RLock()
+	instCancel()
+	instMu.RUnlock()
+}
+
+func withCallTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	instMu.RLock()
+	timeout := callTimeout
+	sCtx := instCtx
+	instMu.RUnlock()
+
+	var cancel context.CancelFunc
+	if timeout == 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	if sCtx.Err() != nil {
+		cancel()
+	}
+	stop := context.AfterFunc(sCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
 func instance() Storage {
 	instMu.RLock()
 	s := inst
@@ -228,14 +526,19 @@ func instance() Storage {
 
 // Initialize initializes storage sub system.
 func New(config *Config) (Storage, error) {
+	var s Storage
 	switch config.Type {
 	case BadgerDB:
-		return badgerdb.New(config.BadgerDB), nil
+		s = badgerdb.New(config.BadgerDB)
 	case MySQL:
-		return sql.New(config.MySQL), nil
+		s = sql.New(config.MySQL)
 	case Memory:
-		return memstorage.New(), nil
+		s = memstorage.New()
 	default:
 		return nil, fmt.Errorf("storage: unrecognized storage type: %d", config.Type)
 	}
+	if config.Cache != nil {
+		s = newCachedStorage(s, config.Cache)
+	}
+	return s, nil
 }
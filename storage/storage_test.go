@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ortuman/jackal/model"
+	"github.com/ortuman/jackal/storage/memstorage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_CancelCalls(t *testing.T) {
+	Set(memstorage.New())
+	defer Unset()
+
+	require.Nil(t, InsertOrUpdateUser(context.Background(), &model.User{Username: "ortuman", Password: "1234"}))
+
+	CancelCalls()
+	_, err := FetchUser(context.Background(), "ortuman")
+	require.Equal(t, context.Canceled, err)
+
+	// a new storage instance accepts operations again
+	Set(memstorage.New())
+	_, err = FetchUser(context.Background(), "ortuman")
+	require.Nil(t, err)
+}
+
+func TestStorage_CallTimeout(t *testing.T) {
+	Set(memstorage.New())
+	defer Unset()
+
+	ctx, cancel := withCallTimeout(context.Background())
+	_, ok := ctx.Deadline()
+	require.False(t, ok)
+	cancel()
+
+	SetCallTimeout(defaultCallTimeout)
+	defer SetCallTimeout(0)
+
+	ctx, cancel = withCallTimeout(context.Background())
+	defer cancel()
+	_, ok = ctx.Deadline()
+	require.True(t, ok)
+}
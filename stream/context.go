@@ -5,18 +5,65 @@
 
 package stream
 
-import "sync"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
 // Context carries stream related variables across stream and its associated modules.
+// It also satisfies context.Context interface, being canceled once its stream gets disconnected,
+// so that it can be used to bound the lifetime of any operation performed on behalf of the stream.
 // Its methods are safe for simultaneous use by multiple goroutines.
 type Context struct {
-	mu sync.RWMutex
-	m  map[string]interface{}
+	mu         sync.RWMutex
+	m          map[string]interface{}
+	doneCh     chan struct{}
+	cancelOnce sync.Once
 }
 
 // NewContext returns an initialized stream context.
 func NewContext() *Context {
-	return &Context{m: make(map[string]interface{})}
+	return &Context{
+		m:      make(map[string]interface{}),
+		doneCh: make(chan struct{}),
+	}
+}
+
+// Cancel cancels the context. Intended to be invoked once its stream gets disconnected.
+func (ctx *Context) Cancel() {
+	ctx.cancelOnce.Do(func() { close(ctx.doneCh) })
+}
+
+// Deadline satisfies context.Context interface.
+// A stream context never has a deadline set.
+func (ctx *Context) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done satisfies context.Context interface.
+func (ctx *Context) Done() <-chan struct{} {
+	return ctx.doneCh
+}
+
+// Err satisfies context.Context interface.
+func (ctx *Context) Err() error {
+	select {
+	case <-ctx.doneCh:
+		return context.Canceled
+	default:
+		return nil
+	}
+}
+
+// Value satisfies context.Context interface, returning
+// the value stored within the context for a string key.
+func (ctx *Context) Value(key interface{}) interface{} {
+	k, ok := key.(string)
+	if !ok {
+		return nil
+	}
+	return ctx.Object(k)
 }
 
 // SetObject stores within the context an object reference.
@@ -6,6 +6,7 @@
 package stream
 
 import (
+	"context"
 	"testing"
 
 	"github.com/ortuman/jackal/xmpp"
@@ -49,3 +50,24 @@ func TestContext_Bool(t *testing.T) {
 	c.SetBool(true, "b")
 	require.True(t, c.Bool("b"))
 }
+
+func TestContext_Cancel(t *testing.T) {
+	var c context.Context = NewContext()
+	require.Nil(t, c.Err())
+	_, ok := c.Deadline()
+	require.False(t, ok)
+
+	c.(*Context).SetString("Hi world!", "str")
+	require.Equal(t, "Hi world!", c.Value("str"))
+	require.Nil(t, c.Value(1))
+
+	c.(*Context).Cancel()
+	c.(*Context).Cancel() // no-op
+	select {
+	case <-c.Done():
+		break
+	default:
+		require.FailNow(t, "context not canceled")
+	}
+	require.Equal(t, context.Canceled, c.Err())
+}
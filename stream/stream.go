@@ -18,6 +18,7 @@ import (
 // InStream represents a generic incoming stream.
 type InStream interface {
 	ID() string
+	Context() *Context
 	Disconnect(err error)
 }
 
@@ -31,8 +32,6 @@ type InOutStream interface {
 type C2S interface {
 	InOutStream
 
-	Context() *Context
-
 	Username() string
 	Domain() string
 	Resource() string
@@ -46,9 +45,31 @@ type C2S interface {
 	Presence() *xmpp.Presence
 }
 
+// RemoteC2S represents a client-to-server XMPP stream bound to a different
+// cluster node, whose element deliveries and disconnections may fail.
+type RemoteC2S interface {
+	C2S
+
+	// ForwardElement sends an element to the node the stream is bound to.
+	ForwardElement(elem xmpp.XElement) error
+
+	// Terminate requests the node the stream is bound to to disconnect it.
+	Terminate(err error) error
+}
+
+// Disconnect disconnects a stream, reporting whether or not the
+// request could be handed over in case it's bound to a different cluster node.
+func Disconnect(stm C2S, err error) error {
+	if rs, ok := stm.(RemoteC2S); ok {
+		return rs.Terminate(err)
+	}
+	stm.Disconnect(err)
+	return nil
+}
+
 // S2SIn represents an incoming server-to-server XMPP stream.
 type S2SIn interface {
-	InStream
+	InOutStream
 }
 
 // S2SOut represents an outgoing server-to-server XMPP stream.
@@ -260,5 +281,6 @@ func (m *MockC2S) disconnect(err error) {
 	if !m.isDisconnected {
 		m.discCh <- err
 		m.isDisconnected = true
+		m.ctx.Cancel()
 	}
 }
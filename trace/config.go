@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package trace
+
+import (
+	"fmt"
+
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+// Config represents a stanza tracing configuration.
+type Config struct {
+	JIDs      []*jid.JID
+	StreamIDs []string
+	FilePath  string
+	Live      bool
+}
+
+type configProxy struct {
+	JIDs      []string `yaml:"jids"`
+	StreamIDs []string `yaml:"stream_ids"`
+	FilePath  string   `yaml:"file_path"`
+	Live      bool     `yaml:"live"`
+}
+
+// UnmarshalYAML satisfies Unmarshaler interface.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := configProxy{}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	c.JIDs = nil
+	for _, s := range p.JIDs {
+		j, err := jid.NewWithString(s, false)
+		if err != nil {
+			return fmt.Errorf("trace.Config: invalid jid: %s", s)
+		}
+		c.JIDs = append(c.JIDs, j)
+	}
+	c.StreamIDs = p.StreamIDs
+	c.FilePath = p.FilePath
+	c.Live = p.Live
+	return nil
+}
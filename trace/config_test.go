@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfig(t *testing.T) {
+	cfg := Config{}
+	rawCfg := `
+jids:
+  - "ortuman@"
+`
+	err := yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.NotNil(t, err) // invalid jid
+
+	rawCfg = `
+jids:
+  - ortuman@localhost
+  - jackal.im
+stream_ids:
+  - c2s:default:1
+file_path: trace.log
+live: true
+`
+	err = yaml.Unmarshal([]byte(rawCfg), &cfg)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(cfg.JIDs))
+	require.Equal(t, "ortuman@localhost", cfg.JIDs[0].String())
+	require.Equal(t, "jackal.im", cfg.JIDs[1].String())
+	require.Equal(t, []string{"c2s:default:1"}, cfg.StreamIDs)
+	require.Equal(t, "trace.log", cfg.FilePath)
+	require.True(t, cfg.Live)
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package trace
+
+import "github.com/ortuman/jackal/xmpp"
+
+const redactedText = "[redacted]"
+
+const (
+	saslNamespace     = "urn:ietf:params:xml:ns:xmpp-sasl"
+	registerNamespace = "jabber:iq:register"
+	dataFormNamespace = "jabber:x:data"
+)
+
+// data form fields carrying credentials,
+// such as those of XEP-0133 user management commands.
+var sensitiveFields = map[string]bool{
+	"password":        true,
+	"password-verify": true,
+}
+
+// redact returns a copy of the element in which every credential
+// has been replaced. The element is returned as is if none was found.
+func redact(elem xmpp.XElement) xmpp.XElement {
+	if ret, ok := redactElement(elem, ""); ok {
+		return ret
+	}
+	return elem
+}
+
+func redactElement(elem xmpp.XElement, parentNamespace string) (xmpp.XElement, bool) {
+	namespace := elem.Namespace()
+	if len(namespace) == 0 {
+		namespace = parentNamespace
+	}
+	if isSensitive(elem.Name(), namespace) {
+		if len(elem.Text()) == 0 {
+			return elem, false
+		}
+		ret := xmpp.NewElementFromElement(elem)
+		ret.SetText(redactedText)
+		return ret, true
+	}
+	if namespace == dataFormNamespace && isSensitiveField(elem) {
+		return redactFieldValues(elem)
+	}
+	children := elem.Elements().All()
+
+	var redacted bool
+	ret := make([]xmpp.XElement, len(children))
+	for i, child := range children {
+		var ok bool
+		if ret[i], ok = redactElement(child, namespace); ok {
+			redacted = true
+		}
+	}
+	if !redacted {
+		return elem, false
+	}
+	e := xmpp.NewElementFromElement(elem)
+	e.ClearElements()
+	e.AppendElements(ret)
+	return e, true
+}
+
+func isSensitive(name, namespace string) bool {
+	switch namespace {
+	case saslNamespace:
+		// SASL initial response and challenge responses carry credentials
+		return name == "auth" || name == "response"
+	case registerNamespace:
+		return name == "password"
+	}
+	return false
+}
+
+func isSensitiveField(elem xmpp.XElement) bool {
+	if elem.Name() != "field" {
+		return false
+	}
+	return sensitiveFields[elem.Attributes().Get("var")] || elem.Attributes().Get("type") == "text-private"
+}
+
+func redactFieldValues(field xmpp.XElement) (xmpp.XElement, bool) {
+	children := field.Elements().All()
+
+	var redacted bool
+	ret := make([]xmpp.XElement, len(children))
+	for i, child := range children {
+		if child.Name() != "value" || len(child.Text()) == 0 {
+			ret[i] = child
+			continue
+		}
+		value := xmpp.NewElementFromElement(child)
+		value.SetText(redactedText)
+		ret[i] = value
+		redacted = true
+	}
+	if !redacted {
+		return field, false
+	}
+	e := xmpp.NewElementFromElement(field)
+	e.ClearElements()
+	e.AppendElements(ret)
+	return e, true
+}
@@ -0,0 +1,293 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package trace
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+)
+
+const watcherBufferSize = 256
+
+const timeFormat = "2006-01-02 15:04:05.000"
+
+const (
+	sendDirection    = "SEND"
+	receiveDirection = "RECV"
+)
+
+type filter struct {
+	jids      []*jid.JID
+	streamIDs map[string]struct{}
+}
+
+func newFilter(jids []*jid.JID, streamIDs []string) *filter {
+	f := &filter{jids: jids, streamIDs: make(map[string]struct{}, len(streamIDs))}
+	for _, streamID := range streamIDs {
+		f.streamIDs[streamID] = struct{}{}
+	}
+	return f
+}
+
+func (f *filter) matchesStream(streamID string, j *jid.JID) bool {
+	if _, ok := f.streamIDs[streamID]; ok {
+		return true
+	}
+	return f.matchesJID(j)
+}
+
+func (f *filter) matchesJID(j *jid.JID) bool {
+	if j == nil {
+		return false
+	}
+	for _, fj := range f.jids {
+		switch {
+		case fj.IsFullWithUser():
+			if j.Matches(fj, jid.MatchesBare|jid.MatchesResource) {
+				return true
+			}
+		case len(fj.Node()) > 0:
+			if j.Matches(fj, jid.MatchesBare) {
+				return true
+			}
+		default:
+			if j.Matches(fj, jid.MatchesDomain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type watcher struct {
+	filter *filter
+	lineCh chan string
+}
+
+// Tracer records raw stream traffic and routing decisions
+// for a selected set of JIDs and stream identifiers.
+type Tracer struct {
+	filter   *filter
+	live     bool
+	mu       sync.RWMutex
+	f        io.WriteCloser
+	watchers map[*watcher]struct{}
+	closeCh  chan struct{}
+	closed   bool
+}
+
+// New returns a new tracer instance writing its output to the configured file.
+func New(config *Config) (*Tracer, error) {
+	t := &Tracer{
+		filter:   newFilter(config.JIDs, config.StreamIDs),
+		live:     config.Live,
+		watchers: make(map[*watcher]struct{}),
+		closeCh:  make(chan struct{}),
+	}
+	if len(config.FilePath) > 0 {
+		if err := os.MkdirAll(filepath.Dir(config.FilePath), os.ModePerm); err != nil {
+			return nil, err
+		}
+		// traced stanzas carry private user data
+		f, err := os.OpenFile(config.FilePath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Chmod(0600); err != nil {
+			f.Close()
+			return nil, err
+		}
+		t.f = f
+	}
+	return t, nil
+}
+
+// Close closes tracer output file and ends every live trace stream.
+func (t *Tracer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		close(t.closeCh)
+		t.closed = true
+	}
+	if t.f == nil {
+		return nil
+	}
+	err := t.f.Close()
+	t.f = nil
+	return err
+}
+
+// Live returns whether or not traced lines
+// can be followed live by means of ServeHTTP.
+func (t *Tracer) Live() bool {
+	return t.live
+}
+
+// ServeHTTP streams traced lines to the client until the request is cancelled.
+// Traced entities must be selected by means of 'jid' and 'stream_id' query parameters.
+func (t *Tracer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	var jids []*jid.JID
+	for _, s := range q["jid"] {
+		j, err := jid.NewWithString(s, false)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid jid: %s", s), http.StatusBadRequest)
+			return
+		}
+		jids = append(jids, j)
+	}
+	streamIDs := q["stream_id"]
+	if len(jids) == 0 && len(streamIDs) == 0 {
+		http.Error(w, "jid or stream_id parameter required", http.StatusBadRequest)
+		return
+	}
+	wt := &watcher{
+		filter: newFilter(jids, streamIDs),
+		lineCh: make(chan string, watcherBufferSize),
+	}
+	t.mu.Lock()
+	t.watchers[wt] = struct{}{}
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		delete(t.watchers, wt)
+		t.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case line := <-wt.lineCh:
+			if _, err := io.WriteString(w, line); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-t.closeCh:
+			return
+		}
+	}
+}
+
+func (t *Tracer) traceStream(direction, streamID string, j *jid.JID, elem xmpp.XElement) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var line string
+	getLine := func() string {
+		if len(line) == 0 {
+			var jidStr string
+			if j != nil {
+				jidStr = j.String()
+			}
+			line = fmt.Sprintf("%s %s %s %s %s\n", time.Now().Format(timeFormat), direction, streamID, jidStr, redact(elem))
+		}
+		return line
+	}
+	if t.f != nil && t.filter.matchesStream(streamID, j) {
+		io.WriteString(t.f, getLine())
+	}
+	for wt := range t.watchers {
+		if wt.filter.matchesStream(streamID, j) {
+			wt.send(getLine())
+		}
+	}
+}
+
+func (t *Tracer) traceRoute(stanza xmpp.Stanza, result string) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	from, to := stanza.FromJID(), stanza.ToJID()
+
+	var line string
+	getLine := func() string {
+		if len(line) == 0 {
+			line = fmt.Sprintf("%s ROUTE %s -> %s: %s\n", time.Now().Format(timeFormat), from, to, result)
+		}
+		return line
+	}
+	if t.f != nil && (t.filter.matchesJID(from) || t.filter.matchesJID(to)) {
+		io.WriteString(t.f, getLine())
+	}
+	for wt := range t.watchers {
+		if wt.filter.matchesJID(from) || wt.filter.matchesJID(to) {
+			wt.send(getLine())
+		}
+	}
+}
+
+func (wt *watcher) send(line string) {
+	select {
+	case wt.lineCh <- line:
+	default:
+		// slow client... discard line
+	}
+}
+
+var (
+	instMu sync.RWMutex
+	inst   *Tracer
+)
+
+// Set sets the global tracer instance.
+func Set(tracer *Tracer) {
+	instMu.Lock()
+	inst = tracer
+	instMu.Unlock()
+}
+
+// Unset removes the global tracer instance.
+func Unset() {
+	Set(nil)
+}
+
+// Send traces an element sent through a stream.
+func Send(streamID string, j *jid.JID, elem xmpp.XElement) {
+	if t := instance(); t != nil {
+		t.traceStream(sendDirection, streamID, j, elem)
+	}
+}
+
+// Receive traces an element received from a stream.
+func Receive(streamID string, j *jid.JID, elem xmpp.XElement) {
+	if t := instance(); t != nil {
+		t.traceStream(receiveDirection, streamID, j, elem)
+	}
+}
+
+// Route traces a stanza routing decision.
+func Route(stanza xmpp.Stanza, result string) {
+	if t := instance(); t != nil {
+		t.traceRoute(stanza, result)
+	}
+}
+
+func instance() *Tracer {
+	instMu.RLock()
+	t := inst
+	instMu.RUnlock()
+	return t
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package trace
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/ortuman/jackal/xmpp/jid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace_Filter(t *testing.T) {
+	j1, _ := jid.New("ortuman", "localhost", "balcony", true)
+	j2, _ := jid.New("noelia", "localhost", "yard", true)
+	j3, _ := jid.New("romeo", "jackal.im", "garden", true)
+
+	f := newFilter([]*jid.JID{tUtilTraceJID(t, "ortuman@localhost")}, []string{"c2s:default:3"})
+	require.True(t, f.matchesStream("c2s:default:1", j1))
+	require.False(t, f.matchesStream("c2s:default:2", j2))
+	require.True(t, f.matchesStream("c2s:default:3", j2))
+	require.False(t, f.matchesStream("c2s:default:4", nil))
+
+	f = newFilter([]*jid.JID{tUtilTraceJID(t, "ortuman@localhost/yard")}, nil)
+	require.False(t, f.matchesJID(j1))
+
+	f = newFilter([]*jid.JID{tUtilTraceJID(t, "jackal.im")}, nil)
+	require.False(t, f.matchesJID(j1))
+	require.True(t, f.matchesJID(j3))
+}
+
+func TestTrace_Redact(t *testing.T) {
+	auth := xmpp.NewElementNamespace("auth", saslNamespace)
+	auth.SetAttribute("mechanism", "PLAIN")
+	auth.SetText("AGp1bGlldAByMG0zMG15cjBtMzA=")
+
+	redacted := redact(auth)
+	require.Equal(t, redactedText, redacted.Text())
+	require.Equal(t, "PLAIN", redacted.Attributes().Get("mechanism"))
+	require.Equal(t, "AGp1bGlldAByMG0zMG15cjBtMzA=", auth.Text()) // original element remains untouched
+
+	iq := xmpp.NewElementName("iq")
+	iq.SetType("set")
+	query := xmpp.NewElementNamespace("query", registerNamespace)
+	username := xmpp.NewElementName("username")
+	username.SetText("ortuman")
+	password := xmpp.NewElementName("password")
+	password.SetText("1234")
+	query.AppendElements([]xmpp.XElement{username, password})
+	iq.AppendElement(query)
+
+	redacted = redact(iq)
+	q := redacted.Elements().ChildNamespace("query", registerNamespace)
+	require.NotNil(t, q)
+	require.Equal(t, "ortuman", q.Elements().Child("username").Text())
+	require.Equal(t, redactedText, q.Elements().Child("password").Text())
+	require.False(t, strings.Contains(redacted.String(), "1234"))
+
+	// XEP-0133 user management forms
+	form := xmpp.NewElementNamespace("x", dataFormNamespace)
+	form.SetAttribute("type", "submit")
+	for _, v := range [][2]string{{"accountjid", "noelia@jackal.im"}, {"password", "1234"}, {"password-verify", "1234"}} {
+		field := xmpp.NewElementName("field")
+		field.SetAttribute("var", v[0])
+		field.AppendElement(xmpp.NewElementName("value").SetText(v[1]))
+		form.AppendElement(field)
+	}
+	command := xmpp.NewElementNamespace("command", "http://jabber.org/protocol/commands")
+	command.AppendElement(form)
+	iq = xmpp.NewElementName("iq")
+	iq.SetType("set")
+	iq.AppendElement(command)
+
+	redacted = redact(iq)
+	require.False(t, strings.Contains(redacted.String(), "1234"))
+	require.True(t, strings.Contains(redacted.String(), "noelia@jackal.im"))
+	require.True(t, strings.Contains(iq.String(), "1234"))
+
+	msg := xmpp.NewElementName("message")
+	require.Equal(t, msg, redact(msg))
+}
+
+func TestTrace_File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jackal_trace")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filePath := filepath.Join(dir, "trace.log")
+	tr, err := New(&Config{JIDs: []*jid.JID{tUtilTraceJID(t, "ortuman@localhost")}, FilePath: filePath})
+	require.Nil(t, err)
+	Set(tr)
+	defer Unset()
+
+	j1, _ := jid.New("ortuman", "localhost", "balcony", true)
+	j2, _ := jid.New("noelia", "localhost", "yard", true)
+
+	Receive("c2s:default:1", j1, xmpp.NewElementName("presence"))
+	Send("c2s:default:2", j2, xmpp.NewElementName("presence"))
+
+	msg, _ := xmpp.NewMessageFromElement(xmpp.NewElementName("message"), j2, j1)
+	Route(msg, "delivered to stream c2s:default:1")
+
+	require.Nil(t, tr.Close())
+
+	fi, err := os.Stat(filePath)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	b, err := ioutil.ReadFile(filePath)
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Equal(t, 2, len(lines))
+	require.True(t, strings.HasSuffix(lines[0], "RECV c2s:default:1 ortuman@localhost/balcony <presence/>"))
+	require.True(t, strings.HasSuffix(lines[1], "ROUTE noelia@localhost/yard -> ortuman@localhost/balcony: delivered to stream c2s:default:1"))
+}
+
+func TestTrace_Streaming(t *testing.T) {
+	tr, err := New(&Config{})
+	require.Nil(t, err)
+	Set(tr)
+	defer Unset()
+
+	srv := httptest.NewServer(tr)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"?stream_id=c2s:default:2", nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	j, _ := jid.New("ortuman", "localhost", "balcony", true)
+	Send("c2s:default:1", j, xmpp.NewElementName("message"))
+	Send("c2s:default:2", j, xmpp.NewElementName("iq"))
+
+	lineCh := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		lineCh <- line
+	}()
+	select {
+	case line := <-lineCh:
+		require.True(t, strings.HasSuffix(line, "SEND c2s:default:2 ortuman@localhost/balcony <iq/>\n"))
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "trace line not received")
+	}
+	resp, err = http.Get(srv.URL + "?jid=ortuman@")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// whole server traffic is never streamed
+	resp, err = http.Get(srv.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func tUtilTraceJID(t *testing.T, s string) *jid.JID {
+	j, err := jid.NewWithString(s, true)
+	require.Nil(t, err)
+	return j
+}
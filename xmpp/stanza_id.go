@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xmpp
+
+const (
+	stanzaIDNamespace = "urn:xmpp:sid:0"
+)
+
+// StanzaID returns element's unique stanza ID (XEP-0359)
+// assigned by a given entity, or an empty string if not present.
+func (e *Element) StanzaID(by string) string {
+	for _, sid := range e.elements.ChildrenNamespace("stanza-id", stanzaIDNamespace) {
+		if sid.Attributes().Get("by") == by {
+			return sid.Attributes().Get("id")
+		}
+	}
+	return ""
+}
+
+// SetStanzaID attaches element's unique stanza ID (XEP-0359),
+// removing any other previously assigned by the same entity.
+func (e *Element) SetStanzaID(by string, id string) {
+	var elements []XElement
+	for _, elem := range e.elements.All() {
+		if elem.Name() == "stanza-id" && elem.Namespace() == stanzaIDNamespace && elem.Attributes().Get("by") == by {
+			continue
+		}
+		elements = append(elements, elem)
+	}
+	sid := NewElementNamespace("stanza-id", stanzaIDNamespace)
+	sid.SetAttribute("by", by)
+	sid.SetAttribute("id", id)
+
+	e.elements.clear()
+	e.elements.append(elements...)
+	e.elements.append(sid)
+}
@@ -0,0 +1,34 @@
+/*
+ * Copyright (c) 2018 Miguel Ángel Ortuño.
+ * See the LICENSE file for more information.
+ */
+
+package xmpp_test
+
+import (
+	"testing"
+
+	"github.com/ortuman/jackal/xmpp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStanzaID(t *testing.T) {
+	e := xmpp.NewElementName("message")
+	require.Equal(t, "", e.StanzaID("ortuman@jackal.im"))
+
+	forged := xmpp.NewElementNamespace("stanza-id", "urn:xmpp:sid:0")
+	forged.SetAttribute("by", "ortuman@jackal.im")
+	forged.SetAttribute("id", "forged")
+	e.AppendElement(forged)
+	other := xmpp.NewElementNamespace("stanza-id", "urn:xmpp:sid:0")
+	other.SetAttribute("by", "room@conference.jackal.im")
+	other.SetAttribute("id", "1234")
+	e.AppendElement(other)
+	e.AppendElement(xmpp.NewElementName("body"))
+
+	e.SetStanzaID("ortuman@jackal.im", "abcd")
+	require.Equal(t, "abcd", e.StanzaID("ortuman@jackal.im"))
+	require.Equal(t, "1234", e.StanzaID("room@conference.jackal.im"))
+	require.Equal(t, 2, len(e.Elements().ChildrenNamespace("stanza-id", "urn:xmpp:sid:0")))
+	require.NotNil(t, e.Elements().Child("body"))
+}